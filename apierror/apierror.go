@@ -0,0 +1,198 @@
+// Package apierror writes error responses for both API versions.
+//
+// v1 (/api/secretnotes) keeps its historical shape, {"error": "message"} plus
+// any details as top-level fields, and the status code each handler has
+// always used. v2 (/api/secretnotes/v2) answers with a typed envelope and a
+// status derived from the error code:
+//
+//	{"error": {"code": "NOTE_NOT_FOUND", "message": "note not found", "details": {...}}}
+package apierror
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// Code is a machine-readable error code returned by the v2 API
+type Code string
+
+const (
+	BadRequest           Code = "BAD_REQUEST"            // malformed body or invalid field
+	BadPassphrase        Code = "BAD_PASSPHRASE"         // missing, too short or otherwise unusable passphrase
+	Unauthorized         Code = "UNAUTHORIZED"           // missing or rejected credentials on a private deployment
+	TokenExpired         Code = "TOKEN_EXPIRED"          // the X-Access-Token is unknown or expired, or a renewal proof failed
+	NoteNotFound         Code = "NOTE_NOT_FOUND"         // no note for the passphrase
+	NoteDeleted          Code = "NOTE_DELETED"           // the note is in the trash; POST /notes/undelete restores it
+	FileNotFound         Code = "FILE_NOT_FOUND"         // the note has no attachment
+	ThumbnailNotFound    Code = "THUMBNAIL_NOT_FOUND"    // the attachment isn't an image, or predates thumbnails
+	PasteNotFound        Code = "PASTE_NOT_FOUND"        // unknown or expired paste
+	SubscriptionNotFound Code = "SUBSCRIPTION_NOT_FOUND" // the note has no digest subscription
+	WebhookNotFound      Code = "WEBHOOK_NOT_FOUND"      // the note has no webhook
+	BlobNotFound         Code = "BLOB_NOT_FOUND"         // nothing is stored under the blob lookup key
+	PassphraseInUse      Code = "PASSPHRASE_IN_USE"      // another note already uses the passphrase
+	AttachmentConflict   Code = "ATTACHMENT_CONFLICT"    // both notes carry an attachment
+	NoteLocked           Code = "NOTE_LOCKED"            // another session holds the editing lock
+	NoteReadOnly         Code = "NOTE_READ_ONLY"         // the note is marked read-only; DELETE /notes/read-only to edit it
+	RequestInProgress    Code = "REQUEST_IN_PROGRESS"    // a request with the same Idempotency-Key is still running
+	PayloadTooLarge      Code = "PAYLOAD_TOO_LARGE"      // body, note or upload over the configured limit
+	QuotaExceeded        Code = "QUOTA_EXCEEDED"         // the passphrase's attachments would go over their total size limit
+	UnsupportedMediaType Code = "UNSUPPORTED_MEDIA_TYPE" // an upload's type isn't allowed, or contradicts its content
+	MalwareDetected      Code = "MALWARE_DETECTED"       // the malware scanner flagged an upload
+	DecryptionFailed     Code = "DECRYPTION_FAILED"      // stored data could not be decrypted with the passphrase
+	WrongPassphrase      Code = "WRONG_PASSPHRASE"       // the data doesn't open with the passphrase, or was tampered with
+	CorruptCiphertext    Code = "CORRUPT_CIPHERTEXT"     // the data is malformed, so no passphrase would open it
+	InvalidArchive       Code = "INVALID_ARCHIVE"        // an import archive is malformed or fails its manifest checks
+	IdempotencyKeyReused Code = "IDEMPOTENCY_KEY_REUSED" // the Idempotency-Key was used for a different request
+	RateLimited          Code = "RATE_LIMITED"           // throttled or temporarily banned
+	ScanUnavailable      Code = "SCAN_UNAVAILABLE"       // uploads can't be accepted while the malware scanner is unreachable
+	Internal             Code = "INTERNAL_ERROR"         // anything else
+)
+
+// Status returns the HTTP status the v2 API uses for the code
+func (c Code) Status() int {
+	switch c {
+	case BadRequest, BadPassphrase:
+		return http.StatusBadRequest
+	case NoteNotFound, FileNotFound, ThumbnailNotFound, PasteNotFound, SubscriptionNotFound, WebhookNotFound, BlobNotFound:
+		return http.StatusNotFound
+	case PassphraseInUse, AttachmentConflict, NoteLocked, RequestInProgress:
+		return http.StatusConflict
+	case Unauthorized, TokenExpired, WrongPassphrase:
+		return http.StatusUnauthorized
+	case NoteDeleted:
+		return http.StatusGone
+	case NoteReadOnly:
+		return http.StatusLocked
+	case PayloadTooLarge, QuotaExceeded:
+		return http.StatusRequestEntityTooLarge
+	case UnsupportedMediaType:
+		return http.StatusUnsupportedMediaType
+	case DecryptionFailed, CorruptCiphertext, InvalidArchive, IdempotencyKeyReused, MalwareDetected:
+		return http.StatusUnprocessableEntity
+	case RateLimited:
+		return http.StatusTooManyRequests
+	case ScanUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// FromError maps a service error to its code, or fallback when it isn't one
+// of the known sentinels
+func FromError(err error, fallback Code) Code {
+	switch {
+	case errors.Is(err, services.ErrNoteNotFound):
+		return NoteNotFound
+	case errors.Is(err, services.ErrFileNotFound):
+		return FileNotFound
+	case errors.Is(err, services.ErrThumbnailNotFound):
+		return ThumbnailNotFound
+	case errors.Is(err, services.ErrPasteNotFound):
+		return PasteNotFound
+	case errors.Is(err, services.ErrSubscriptionNotFound):
+		return SubscriptionNotFound
+	case errors.Is(err, services.ErrWebhookNotFound):
+		return WebhookNotFound
+	case errors.Is(err, services.ErrBlobNotFound):
+		return BlobNotFound
+	case errors.Is(err, services.ErrPhraseInUse):
+		return PassphraseInUse
+	case errors.Is(err, services.ErrLockHeld):
+		return NoteLocked
+	case errors.Is(err, services.ErrWrongPassphrase):
+		return WrongPassphrase
+	case errors.Is(err, services.ErrCorruptCiphertext):
+		return CorruptCiphertext
+	case errors.Is(err, services.ErrDecryptionFailed):
+		return DecryptionFailed
+	case errors.Is(err, services.ErrInvalidArchive):
+		return InvalidArchive
+	case errors.Is(err, services.ErrContentTypeMismatch), errors.Is(err, services.ErrContentTypeNotAllowed):
+		return UnsupportedMediaType
+	case errors.Is(err, services.ErrMalwareDetected):
+		return MalwareDetected
+	case errors.Is(err, services.ErrScanUnavailable):
+		return ScanUnavailable
+	case errors.Is(err, services.ErrInvalidMetadata), errors.Is(err, services.ErrDestroyInPast), errors.Is(err, services.ErrInvalidBlob), errors.Is(err, services.ErrInvalidFilename),
+		errors.Is(err, services.ErrInvalidShare), errors.Is(err, services.ErrNotEnoughShares), errors.Is(err, services.ErrInvalidRetention):
+		return BadRequest
+	}
+	return fallback
+}
+
+// versionKey is the request store key marking v2 requests
+const versionKey = "secretnotes.apiVersion"
+
+// UseV2 marks every request on the route group as a v2 request. It runs ahead
+// of all other middlewares so their errors use the v2 envelope too.
+func UseV2() *hook.Handler[*core.RequestEvent] {
+	return &hook.Handler[*core.RequestEvent]{
+		Id:       "secretnotesApiV2",
+		Priority: apis.DefaultBodyLimitMiddlewarePriority - 2,
+		Func: func(e *core.RequestEvent) error {
+			e.Set(versionKey, 2)
+			return e.Next()
+		},
+	}
+}
+
+// IsV2 reports whether the request came in through the v2 route group
+func IsV2(e *core.RequestEvent) bool {
+	version, _ := e.Get(versionKey).(int)
+	return version == 2
+}
+
+// codeKey is the request store key holding the code of the error answered
+const codeKey = "secretnotes.errorCode"
+
+// SetCode records code as the error the request is answered with, for
+// responses written without Respond, such as a HEAD request's bare 404
+func SetCode(e *core.RequestEvent, code Code) {
+	e.Set(codeKey, code)
+}
+
+// ResponseCode returns the code of the error the request was answered with,
+// or "" when it succeeded, so middlewares can tell errors of one status apart
+func ResponseCode(e *core.RequestEvent) Code {
+	code, _ := e.Get(codeKey).(Code)
+	return code
+}
+
+// Respond writes an error response. v1 requests get legacyStatus and the flat
+// {"error": message} body with details merged in; v2 requests get the code's
+// status and the typed envelope. Decryption failures of a known kind get the
+// code's status on both, 401 for a wrong passphrase and 422 for corrupt data,
+// rather than whatever status the handler falls back to.
+func Respond(e *core.RequestEvent, legacyStatus int, code Code, message string, details map[string]any) error {
+	SetCode(e, code)
+	if IsV2(e) {
+		body := map[string]any{
+			"code":    code,
+			"message": message,
+		}
+		if len(details) > 0 {
+			body["details"] = details
+		}
+		return e.JSON(code.Status(), map[string]any{"error": body})
+	}
+
+	if code == WrongPassphrase || code == CorruptCiphertext {
+		legacyStatus = code.Status()
+	}
+	if len(details) == 0 {
+		return e.JSON(legacyStatus, map[string]string{"error": message})
+	}
+	body := make(map[string]any, len(details)+1)
+	for k, v := range details {
+		body[k] = v
+	}
+	body["error"] = message
+	return e.JSON(legacyStatus, body)
+}
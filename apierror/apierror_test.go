@@ -0,0 +1,107 @@
+package apierror
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+func newEvent(v2 bool) (*core.RequestEvent, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	e := &core.RequestEvent{}
+	e.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	e.Response = rec
+	if v2 {
+		e.Set(versionKey, 2)
+	}
+	return e, rec
+}
+
+func TestRespondV1KeepsLegacyShape(t *testing.T) {
+	e, rec := newEvent(false)
+	if err := Respond(e, http.StatusNotFound, DecryptionFailed, "boom", map[string]any{"limit": 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want legacy 404", rec.Code)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["error"] != "boom" || body["limit"] != float64(5) {
+		t.Errorf("body = %v, want flat error with details", body)
+	}
+}
+
+func TestRespondV2Envelope(t *testing.T) {
+	e, rec := newEvent(true)
+	if err := Respond(e, http.StatusNotFound, DecryptionFailed, "boom", map[string]any{"limit": 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422 from the code", rec.Code)
+	}
+	var body struct {
+		Error struct {
+			Code    Code           `json:"code"`
+			Message string         `json:"message"`
+			Details map[string]any `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error.Code != DecryptionFailed || body.Error.Message != "boom" || body.Error.Details["limit"] != float64(5) {
+		t.Errorf("body = %+v", body)
+	}
+}
+
+func TestRespondDecryptionStatus(t *testing.T) {
+	for _, c := range []struct {
+		code Code
+		want int
+	}{
+		{WrongPassphrase, http.StatusUnauthorized},
+		{CorruptCiphertext, http.StatusUnprocessableEntity},
+	} {
+		for _, v2 := range []bool{false, true} {
+			e, rec := newEvent(v2)
+			if err := Respond(e, http.StatusInternalServerError, c.code, "boom", nil); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != c.want {
+				t.Errorf("%s (v2 %v): status = %d, want %d", c.code, v2, rec.Code, c.want)
+			}
+		}
+	}
+}
+
+func TestFromError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want Code
+	}{
+		{services.ErrNoteNotFound, NoteNotFound},
+		{fmt.Errorf("wrapped: %w", services.ErrDecryptionFailed), DecryptionFailed},
+		{fmt.Errorf("failed to decrypt file: %w", services.ErrWrongPassphrase), WrongPassphrase},
+		{&services.EnvelopeError{Reason: "truncated"}, CorruptCiphertext},
+		{&services.EnvelopeError{Reason: "version 9", Unsupported: true}, DecryptionFailed},
+		{services.ErrPhraseInUse, PassphraseInUse},
+		{fmt.Errorf("%w: missing note", services.ErrInvalidArchive), InvalidArchive},
+		{fmt.Errorf("something else"), BadRequest},
+	}
+	for _, c := range cases {
+		if got := FromError(c.err, BadRequest); got != c.want {
+			t.Errorf("FromError(%v) = %s, want %s", c.err, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// newAuditEncryptionCommand builds the "audit-encryption" admin command, which
+// flags stored values that read as plaintext without decryption. It exits
+// non-zero when any are found, so it can guard deployments and cron jobs.
+func newAuditEncryptionCommand(integrityService *services.IntegrityService) *cobra.Command {
+	var asJSON bool
+
+	command := &cobra.Command{
+		Use:          "audit-encryption",
+		Short:        "Checks that every stored note, attachment and notification target is ciphertext",
+		SilenceUsage: true,
+		RunE: func(command *cobra.Command, args []string) error {
+			audit, err := integrityService.AuditEncryption()
+			if err != nil {
+				return err
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(audit); err != nil {
+					return err
+				}
+			} else {
+				printEncryptionAudit(audit)
+			}
+
+			if len(audit.Findings) > 0 {
+				// PocketBase ignores command errors, so exit explicitly for scripts and cron
+				os.Exit(1)
+			}
+			return nil
+		},
+	}
+
+	command.Flags().BoolVar(&asJSON, "json", false, "print the report as JSON")
+
+	return command
+}
+
+// printEncryptionAudit writes a human-readable audit report to stdout
+func printEncryptionAudit(audit *services.EncryptionAudit) {
+	collections := make([]string, 0, len(audit.Checked))
+	for collection := range audit.Checked {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+	for _, collection := range collections {
+		fmt.Printf("%-18s %d checked, %d flagged\n", collection, audit.Checked[collection], audit.Flagged[collection])
+	}
+
+	if len(audit.Findings) == 0 {
+		fmt.Println("All stored values are ciphertext")
+		return
+	}
+	for _, finding := range audit.Findings {
+		fmt.Printf("%-18s %-15s %s %s\n", finding.Collection, finding.RecordID, finding.Field, finding.Reason)
+	}
+	fmt.Println("Flagged note messages are encrypted again the next time their owner saves the note")
+}
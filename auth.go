@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/ktappdev/secretnotes-go-backend/config"
+	"github.com/ktappdev/secretnotes-go-backend/middleware"
+)
+
+// newAuthenticator builds the authentication layer selected by cfg.Mode, or
+// returns nil when the API is open (the default)
+func newAuthenticator(cfg config.AuthConfig) (middleware.Authenticator, error) {
+	switch cfg.Mode {
+	case "token":
+		return middleware.NewStaticTokens(cfg.Tokens), nil
+	case "basic":
+		return middleware.NewBasicAuth(cfg.BasicUsers)
+	case "oidc":
+		return middleware.NewTokenIntrospection(cfg.IntrospectionURL, cfg.ClientID, cfg.ClientSecret, cfg.CacheTTL), nil
+	default:
+		return nil, nil
+	}
+}
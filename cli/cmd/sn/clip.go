@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/atotto/clipboard"
+
+	"github.com/ktappdev/secretnotes-go-backend/cli/internal/api"
+)
+
+// runClip implements `sn clip push|pull [passphrase]`, a non-interactive bridge
+// between the system clipboard and the note.
+func runClip(client *api.Client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: sn clip push|pull [--clear-after 30s] [passphrase]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("clip "+action, flag.ContinueOnError)
+	clearAfter := fs.Duration("clear-after", 30*time.Second, "Clear the clipboard after this long (pull only, 0 disables)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	passphrase, err := subcommandPassphrase(fs.Args())
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(passphrase)
+
+	switch action {
+	case "push":
+		return clipPush(client, passphrase)
+	case "pull":
+		return clipPull(client, passphrase, *clearAfter)
+	default:
+		return fmt.Errorf("unknown clip action %q (expected push or pull)", action)
+	}
+}
+
+// clipPush appends the current clipboard content to the note with a timestamp header
+func clipPush(client *api.Client, passphrase []byte) error {
+	content, err := clipboard.ReadAll()
+	if err != nil {
+		return fmt.Errorf("read clipboard: %w", err)
+	}
+	if content == "" {
+		return fmt.Errorf("clipboard is empty")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	note, err := client.GetOrCreateNote(ctx, passphrase)
+	if err != nil {
+		return err
+	}
+	if _, err := client.UpdateNote(ctx, passphrase, appendClipEntry(note.Message, content, time.Now())); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Pushed %d bytes from clipboard to note\n", len(content))
+	return nil
+}
+
+// clipPull copies the note into the clipboard and clears it again after clearAfter,
+// unless the clipboard has been overwritten in the meantime.
+func clipPull(client *api.Client, passphrase []byte, clearAfter time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	note, err := client.GetOrCreateNote(ctx, passphrase)
+	if err != nil {
+		return err
+	}
+	if err := clipboard.WriteAll(note.Message); err != nil {
+		return fmt.Errorf("write clipboard: %w", err)
+	}
+
+	if clearAfter <= 0 {
+		fmt.Fprintln(os.Stderr, "Copied note to clipboard")
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Copied note to clipboard; clearing in %s (Ctrl+C clears now)\n", clearAfter)
+	waitCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	select {
+	case <-time.After(clearAfter):
+	case <-waitCtx.Done():
+	}
+
+	if current, err := clipboard.ReadAll(); err == nil && current == note.Message {
+		if err := clipboard.WriteAll(""); err != nil {
+			return fmt.Errorf("clear clipboard: %w", err)
+		}
+		fmt.Fprintln(os.Stderr, "Clipboard cleared")
+	}
+	return nil
+}
+
+// appendClipEntry appends content to message under a timestamp header
+func appendClipEntry(message, content string, at time.Time) string {
+	entry := fmt.Sprintf("[%s]\n%s", at.Format("2006-01-02 15:04:05"), content)
+	if message == "" {
+		return entry
+	}
+	return message + "\n\n" + entry
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ktappdev/secretnotes-go-backend/cli/internal/api"
+)
+
+// runGenerate implements `sn generate [--words 6] [--separator -]`, printing a
+// passphrase of random words to use for a new note.
+func runGenerate(client *api.Client, args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	words := fs.Int("words", 6, "Number of words (4-24), 11 bits of entropy each")
+	separator := fs.String("separator", "-", "Characters between the words (may be empty)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("usage: sn generate [--words 6] [--separator -]")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	phrase, err := client.GeneratePhrase(ctx, *words, *separator)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d words, %.0f bits of entropy:\n", phrase.Words, phrase.Entropy)
+	fmt.Println(phrase.Passphrase)
+	return nil
+}
@@ -78,12 +78,13 @@ func main() {
 		}
 	}
 
-	// Check for positional passphrase argument
+	// Check for a subcommand or positional passphrase argument
 	args := flag.Args()
+	subcommand := isSubcommand(args)
 	var passphrase []byte
 	var passphraseFromArg bool
 
-	if len(args) > 0 {
+	if len(args) > 0 && !subcommand {
 		passphraseStr := args[0]
 		if len(passphraseStr) < 3 {
 			log.Fatalf("passphrase must be at least 3 characters")
@@ -146,6 +147,12 @@ func main() {
 
 	// Health check fast-fail
 	client := api.NewClient(server.URL, server.VerifyTLS)
+	// Private deployments: SN_AUTH_TOKEN overrides the server's configured token
+	authToken := server.AuthToken
+	if v := os.Getenv("SN_AUTH_TOKEN"); v != "" {
+		authToken = v
+	}
+	client.SetAuthToken(authToken)
 	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
 	defer cancel()
 	if err := client.Health(ctx); err != nil {
@@ -172,6 +179,34 @@ func main() {
 		}
 	}
 
+	// Warn about clock skew; lock expiry times are shown on the local clock
+	skewCtx, skewCancel := context.WithTimeout(context.Background(), 4*time.Second)
+	if skew, err := client.MeasureSkew(skewCtx); err == nil {
+		if msg := describeSkew(skew); msg != "" {
+			fmt.Fprintf(os.Stderr, "warning: %s; time-based features may misbehave, consider syncing your clock\n", msg)
+		}
+	}
+	skewCancel()
+
+	// Non-interactive subcommands
+	if subcommand {
+		run := runClip
+		switch args[0] {
+		case "status":
+			run = runStatus
+		case "recovery-kit":
+			run = runRecoveryKit
+		case "recover":
+			run = runRecover
+		case "generate":
+			run = runGenerate
+		}
+		if err := run(client, args[1:]); err != nil {
+			log.Fatalf("%s: %v", args[0], err)
+		}
+		return
+	}
+
 	// Prompt for passphrase (never saved) if not provided as argument
 	if !passphraseFromArg {
 		var err error
@@ -183,6 +218,11 @@ func main() {
 	// Ensure we zero the buffer on exit
 	defer zeroBytes(passphrase)
 
+	// Operator branding for the about screen; older servers simply don't have it
+	aboutCtx, aboutCancel := context.WithTimeout(context.Background(), 4*time.Second)
+	about, _ := client.About(aboutCtx)
+	aboutCancel()
+
 	// Start TUI editor
 	app := tui.NewEditorApp(
 		client,
@@ -198,6 +238,9 @@ func main() {
 			return config.Save(cfgPath, &cfg)
 		},
 	)
+	if about != nil {
+		app.SetServerAbout(about.Name, about.About)
+	}
 
 	// Handle Ctrl+C as graceful cancel
 	ctxRun, stop := signal.NotifyContext(context.Background(), os.Interrupt)
@@ -222,6 +265,45 @@ func promptPassphrase() ([]byte, error) {
 	return b, nil
 }
 
+// isSubcommand reports whether args start with a known subcommand rather than a
+// positional passphrase. A bare word is still treated as a passphrase, so a
+// subcommand needs its action (e.g. "clip push"); "status", "recovery-kit",
+// "recover" and "generate" take no action and are reserved.
+func isSubcommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "status", "recovery-kit", "recover", "generate":
+		return true
+	}
+	return len(args) >= 2 && args[0] == "clip"
+}
+
+// subcommandPassphrase returns the passphrase given as a trailing argument, or prompts for it
+func subcommandPassphrase(args []string) ([]byte, error) {
+	if len(args) > 0 {
+		if len(args[0]) < 3 {
+			return nil, fmt.Errorf("passphrase must be at least 3 characters")
+		}
+		return []byte(args[0]), nil
+	}
+	return promptPassphrase()
+}
+
+// describeSkew explains a measured clock skew (server minus local), or returns
+// "" when it is within api.SkewWarnThreshold
+func describeSkew(skew time.Duration) string {
+	direction := "behind"
+	if skew < 0 {
+		skew, direction = -skew, "ahead of"
+	}
+	if skew <= api.SkewWarnThreshold {
+		return ""
+	}
+	return fmt.Sprintf("your clock is %s %s the server's", skew.Round(time.Second), direction)
+}
+
 func zeroBytes(b []byte) {
 	for i := range b {
 		b[i] = 0
@@ -4,6 +4,9 @@ import (
 	"flag"
 	"os"
 	"testing"
+	"time"
+
+	"github.com/ktappdev/secretnotes-go-backend/cli/internal/api"
 )
 
 func TestPositionalPassphrase(t *testing.T) {
@@ -55,4 +58,82 @@ func TestMinimumPassphraseLength(t *testing.T) {
 	if len(passphrase) < 3 {
 		t.Errorf("Expected passphrase 'abc' to be valid, but it failed length check")
 	}
-}
\ No newline at end of file
+}
+
+func TestIsSubcommand(t *testing.T) {
+	if !isSubcommand([]string{"clip", "push"}) {
+		t.Errorf("Expected 'clip push' to be a subcommand")
+	}
+	if isSubcommand([]string{"clip"}) {
+		t.Errorf("Expected a bare 'clip' to be treated as a passphrase")
+	}
+	if !isSubcommand([]string{"status"}) || !isSubcommand([]string{"status", "mypass"}) {
+		t.Errorf("Expected 'status' to be a subcommand with or without a passphrase")
+	}
+	if !isSubcommand([]string{"recovery-kit"}) || !isSubcommand([]string{"recover"}) || !isSubcommand([]string{"generate", "--words", "8"}) {
+		t.Errorf("Expected 'recovery-kit', 'recover' and 'generate' to be subcommands")
+	}
+	if isSubcommand([]string{"testpassphrase"}) {
+		t.Errorf("Expected 'testpassphrase' to be treated as a passphrase")
+	}
+}
+
+func TestDescribeSkew(t *testing.T) {
+	cases := []struct {
+		skew time.Duration
+		want string
+	}{
+		{0, ""},
+		{10 * time.Second, ""},
+		{-30 * time.Second, ""},
+		{90 * time.Second, "your clock is 1m30s behind the server's"},
+		{-2*time.Minute - 400*time.Millisecond, "your clock is 2m0s ahead of the server's"},
+	}
+	for _, c := range cases {
+		if got := describeSkew(c.skew); got != c.want {
+			t.Errorf("describeSkew(%v) = %q, want %q", c.skew, got, c.want)
+		}
+	}
+}
+
+func TestAppendClipEntry(t *testing.T) {
+	at := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+
+	if got := appendClipEntry("", "secret", at); got != "[2024-05-01 09:30:00]\nsecret" {
+		t.Errorf("Unexpected entry for empty note: %q", got)
+	}
+	if got := appendClipEntry("existing", "secret", at); got != "existing\n\n[2024-05-01 09:30:00]\nsecret" {
+		t.Errorf("Unexpected entry for existing note: %q", got)
+	}
+}
+
+func TestDescribeNote(t *testing.T) {
+	now := time.Date(2024, 5, 1, 14, 7, 0, 0, time.Local)
+	note := &api.Note{Message: "héllo", HasImage: true}
+	got := describeNote(note, now.Add(-time.Hour), now.Add(-5*time.Minute), now)
+	if want := "5 characters, 1 attachment; created 13:07, last saved 14:02 (5m ago)"; got != want {
+		t.Errorf("describeNote = %q, want %q", got, want)
+	}
+
+	note = &api.Note{Message: "x", Title: "Groceries", Tags: []string{"home", "weekly"}}
+	got = describeNote(note, time.Time{}, time.Time{}, now)
+	if want := `"Groceries" [home, weekly] 1 character`; got != want {
+		t.Errorf("describeNote = %q, want %q", got, want)
+	}
+}
+
+func TestDescribeUsage(t *testing.T) {
+	cases := []struct {
+		usage api.Usage
+		want  string
+	}{
+		{api.Usage{NoteBytes: 10, NoteLimit: 1 << 20, AttachmentLimit: 50 << 20}, ""},
+		{api.Usage{NoteBytes: 900 << 10, NoteLimit: 1 << 20}, "note at 87% of its 1.0 MB limit"},
+		{api.Usage{NoteLimit: 1 << 20, AttachmentBytes: 1536, AttachmentLimit: 50 << 20}, "attachments use 1.5 KB of 50.0 MB"},
+	}
+	for _, c := range cases {
+		if got := describeUsage(c.usage); got != c.want {
+			t.Errorf("describeUsage(%+v) = %q, want %q", c.usage, got, c.want)
+		}
+	}
+}
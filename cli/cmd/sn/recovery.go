@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ktappdev/secretnotes-go-backend/cli/internal/api"
+)
+
+// runRecoveryKit implements `sn recovery-kit [--threshold 3] [--shares 5]
+// [passphrase]`, printing shares of the passphrase to write down or hand out.
+func runRecoveryKit(client *api.Client, args []string) error {
+	fs := flag.NewFlagSet("recovery-kit", flag.ContinueOnError)
+	threshold := fs.Int("threshold", 3, "Shares needed to recover the passphrase")
+	n := fs.Int("shares", 5, "Shares to create")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	passphrase, err := subcommandPassphrase(fs.Args())
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(passphrase)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	kit, err := client.RecoveryKit(ctx, passphrase, *threshold, *n)
+	if err != nil {
+		return err
+	}
+	fmt.Print(formatRecoveryKit(kit))
+	return nil
+}
+
+// formatRecoveryKit lays a kit out for printing, one numbered share per line
+func formatRecoveryKit(kit *api.RecoveryKit) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Recovery kit %s: any %d of these %d shares recover the passphrase.\n", kit.KitID, kit.Threshold, len(kit.Shares))
+	fmt.Fprintln(&b, "Keep them apart; recover with `sn recover`.")
+	fmt.Fprintln(&b)
+	for i, share := range kit.Shares {
+		fmt.Fprintf(&b, "%2d. %s\n", i+1, share)
+	}
+	return b.String()
+}
+
+// runRecover implements `sn recover`, reading shares one per line until an
+// empty line or end of input and printing the passphrase they rebuild.
+func runRecover(client *api.Client, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: sn recover (shares are read from the terminal, one per line)")
+	}
+
+	fmt.Fprintln(os.Stderr, "Enter the recovery shares, one per line, then an empty line:")
+	var shares []string
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			break
+		}
+		shares = append(shares, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(shares) == 0 {
+		return fmt.Errorf("no shares given")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	recovery, err := client.Recover(ctx, shares)
+	if err != nil {
+		return err
+	}
+	if !recovery.NoteExists {
+		fmt.Fprintln(os.Stderr, "warning: no note exists for the recovered passphrase")
+	}
+	fmt.Fprintf(os.Stderr, "Recovered the passphrase of kit %s:\n", recovery.KitID)
+	fmt.Println(recovery.Passphrase)
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ktappdev/secretnotes-go-backend/cli/internal/api"
+	"github.com/ktappdev/secretnotes-go-backend/cli/internal/tui"
+)
+
+// runStatus implements `sn status [passphrase]`, printing a one-line summary of
+// the note without opening the editor.
+func runStatus(client *api.Client, args []string) error {
+	passphrase, err := subcommandPassphrase(args)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(passphrase)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	note, err := client.GetOrCreateNote(ctx, passphrase)
+	if err != nil {
+		return err
+	}
+	summary := describeNote(note, client.ServerToLocal(note.Created), client.ServerToLocal(note.Updated), time.Now())
+	var lastAccessed time.Time
+	if note.LastAccessed != nil {
+		lastAccessed = client.ServerToLocal(*note.LastAccessed)
+	}
+	summary += "; " + tui.AccessSummary(note.AccessCount, lastAccessed, time.Now())
+	if note.ReadOnly {
+		summary += "; read-only"
+	}
+	if note.Usage != nil {
+		if usage := describeUsage(*note.Usage); usage != "" {
+			summary += "; " + usage
+		}
+	}
+	if note.DestroyAt != nil {
+		summary += "; " + tui.DestroyWarning(client.ServerToLocal(*note.DestroyAt), time.Now())
+	}
+	fmt.Println(summary)
+	return nil
+}
+
+// describeNote summarises a note's title, tags, size and timestamps (already on
+// the local clock)
+func describeNote(note *api.Note, created, updated, now time.Time) string {
+	summary := fmt.Sprintf("%d characters", len([]rune(note.Message)))
+	if len([]rune(note.Message)) == 1 {
+		summary = "1 character"
+	}
+	if len(note.Tags) > 0 {
+		summary = fmt.Sprintf("[%s] %s", strings.Join(note.Tags, ", "), summary)
+	}
+	if note.Title != "" {
+		summary = fmt.Sprintf("%q %s", note.Title, summary)
+	}
+	if note.HasImage {
+		summary += ", 1 attachment"
+	}
+	if times := tui.NoteTimes(created, updated, now); times != "" {
+		summary += "; " + times
+	}
+	return summary
+}
+
+// describeUsage mentions the quotas worth knowing about: attachment space
+// once some is used, and the note size once it nears its limit
+func describeUsage(usage api.Usage) string {
+	var parts []string
+	if usage.NoteLimit > 0 && usage.NoteBytes*10 >= usage.NoteLimit*8 {
+		parts = append(parts, fmt.Sprintf("note at %d%% of its %s limit", usage.NoteBytes*100/usage.NoteLimit, formatBytes(usage.NoteLimit)))
+	}
+	if usage.AttachmentBytes > 0 {
+		part := "attachments use " + formatBytes(usage.AttachmentBytes)
+		if usage.AttachmentLimit > 0 {
+			part += " of " + formatBytes(usage.AttachmentLimit)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatBytes renders a size in B, KB or MB (powers of 1024)
+func formatBytes(n int64) string {
+	switch {
+	case n < 1<<10:
+		return fmt.Sprintf("%d B", n)
+	case n < 1<<20:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	}
+}
@@ -0,0 +1,6 @@
+// Package e2e holds end-to-end tests that build the server and the sn CLI,
+// boot the server on a random port with a throwaway data directory and drive
+// both through real flows. They are behind the e2e build tag:
+//
+//	go test -tags e2e ./cli/e2e/
+package e2e
@@ -0,0 +1,566 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/ktappdev/secretnotes-go-backend/cli/internal/api"
+	"github.com/ktappdev/secretnotes-go-backend/cli/internal/tui"
+)
+
+type note struct {
+	ID       string   `json:"id"`
+	Message  string   `json:"message"`
+	Title    string   `json:"title"`
+	Tags     []string `json:"tags"`
+	HasImage bool     `json:"hasImage"`
+}
+
+// TestNoteLifecycle creates, edits, attaches to, shares and cleans up a note
+// through the API, checking each step with `sn status`
+func TestNoteLifecycle(t *testing.T) {
+	const phrase = "e2e-lifecycle-phrase"
+
+	var created note
+	if status := apiJSON(t, http.MethodPut, "/notes", phrase, map[string]any{"message": "first draft", "title": "Lifecycle"}, &created); status != http.StatusCreated {
+		t.Fatalf("create: status %d", status)
+	}
+	if out := sn(t, "status", phrase); !strings.Contains(out, `"Lifecycle"`) || !strings.Contains(out, "11 characters") {
+		t.Fatalf("sn status after create: %q", out)
+	}
+
+	var edited note
+	if status := apiJSON(t, http.MethodPatch, "/notes", phrase, map[string]any{"message": "second draft\nwith milk"}, &edited); status != http.StatusOK {
+		t.Fatalf("edit: status %d", status)
+	}
+	if edited.ID != created.ID || edited.Title != "Lifecycle" {
+		t.Fatalf("edit changed identity or metadata: %+v", edited)
+	}
+
+	var found struct {
+		Matches []struct {
+			Line int `json:"line"`
+		} `json:"matches"`
+	}
+	if status := apiCall(t, http.MethodGet, "/notes/search?q=MILK", phrase, nil, "", &found); status != http.StatusOK || len(found.Matches) != 1 || found.Matches[0].Line != 2 {
+		t.Fatalf("search: status %d, %+v", status, found)
+	}
+
+	image := []byte("\x89PNG fake image bytes")
+	body, contentType := multipartBody(t, "image", "photo.png", image)
+	if status := apiCall(t, http.MethodPost, "/notes/image", phrase, body, contentType, nil); status != http.StatusOK {
+		t.Fatalf("upload: status %d", status)
+	}
+	var downloaded []byte
+	if status := apiCall(t, http.MethodGet, "/notes/image", phrase, nil, "", &downloaded); status != http.StatusOK || !bytes.Equal(downloaded, image) {
+		t.Fatalf("download: status %d, %q", status, downloaded)
+	}
+	if out := sn(t, "status", phrase); !strings.Contains(out, "1 attachment") {
+		t.Fatalf("sn status after upload: %q", out)
+	}
+
+	var paste struct {
+		ID      string `json:"id"`
+		Content string `json:"content"`
+	}
+	if status := apiJSON(t, http.MethodPost, "/paste", "", map[string]any{"content": "shared snippet", "expiresIn": 60}, &paste); status != http.StatusCreated {
+		t.Fatalf("share: status %d", status)
+	}
+	paste.Content = ""
+	if status := apiCall(t, http.MethodGet, "/paste/"+paste.ID, "", nil, "", &paste); status != http.StatusOK || paste.Content != "shared snippet" {
+		t.Fatalf("open paste: status %d, %+v", status, paste)
+	}
+
+	if status := apiCall(t, http.MethodDelete, "/notes/image", phrase, nil, "", nil); status != http.StatusOK {
+		t.Fatalf("delete image: status %d", status)
+	}
+	if status := apiCall(t, http.MethodGet, "/notes/image", phrase, nil, "", nil); status != http.StatusNotFound {
+		t.Fatalf("image still served after delete: status %d", status)
+	}
+}
+
+// TestExportImport exports a note and checks the archive is refused over a
+// note that still has content; a full restore needs a server without the note
+func TestExportImport(t *testing.T) {
+	const phrase = "e2e-export-phrase"
+	apiJSON(t, http.MethodPut, "/notes", phrase, map[string]any{"message": "keep me", "tags": []string{"backup"}}, nil)
+
+	var archive []byte
+	if status := apiCall(t, http.MethodGet, "/export", phrase, nil, "", &archive); status != http.StatusOK {
+		t.Fatalf("export: status %d", status)
+	}
+
+	// importing over a note with content is refused
+	body, contentType := multipartBody(t, "archive", "backup.tar.enc", archive)
+	if status := apiCall(t, http.MethodPost, "/import", phrase, body, contentType, nil); status != http.StatusConflict {
+		t.Fatalf("import over existing note: status %d", status)
+	}
+}
+
+// TestEditorSavesNote types into the real TUI model and saves with Ctrl+S
+func TestEditorSavesNote(t *testing.T) {
+	const phrase = "e2e-editor-phrase"
+	client := api.NewClient(baseURL, false)
+	app := tui.NewEditorApp(client, []byte(phrase), "e2e", false, time.Second, func(bool, int) error { return nil })
+
+	var model tea.Model = app
+	model = drive(model, model.Init())
+	model = typeText(model, "typed in the editor")
+	model = drive(model, func() tea.Msg { return tea.KeyMsg{Type: tea.KeyCtrlS} })
+
+	if view := model.View(); !strings.Contains(view, "Saved") || !strings.Contains(view, "last saved") {
+		t.Errorf("status bar after save: %q", view)
+	}
+
+	var saved note
+	apiCall(t, http.MethodGet, "/notes", phrase, nil, "", &saved)
+	if saved.Message != "typed in the editor" {
+		t.Fatalf("saved message = %q", saved.Message)
+	}
+}
+
+// TestEditorSeesOtherEditor opens the same note in two editors; the second
+// must notice the first one's editing lock
+func TestEditorSeesOtherEditor(t *testing.T) {
+	const phrase = "e2e-two-editors"
+	client := api.NewClient(baseURL, false)
+	noPref := func(bool, int) error { return nil }
+
+	var first tea.Model = tui.NewEditorApp(client, []byte(phrase), "e2e", false, time.Second, noPref)
+	first = drive(first, first.Init())
+
+	var second tea.Model = tui.NewEditorApp(client, []byte(phrase), "e2e", false, time.Second, noPref)
+	second = drive(second, second.Init())
+	if view := second.View(); !strings.Contains(view, "Editing elsewhere") {
+		t.Fatalf("second editor did not see the lock: %q", view)
+	}
+	if view := first.View(); strings.Contains(view, "Editing elsewhere") {
+		t.Fatalf("first editor sees its own lock: %q", view)
+	}
+}
+
+// TestEditorTabs edits two notes side by side in one editor, each saved
+// under its own passphrase
+func TestEditorTabs(t *testing.T) {
+	const first, second = "e2e-tab-one", "e2e-tab-two"
+	client := api.NewClient(baseURL, false)
+	var model tea.Model = tui.NewEditorApp(client, []byte(first), "e2e", false, time.Second, func(bool, int) error { return nil })
+	model = drive(model, model.Init())
+
+	key := func(k tea.KeyType) tea.Cmd { return func() tea.Msg { return tea.KeyMsg{Type: k} } }
+	model = drive(model, key(tea.KeyCtrlN))
+	model = typeText(model, second)
+	model = drive(model, key(tea.KeyEnter))
+	model = typeText(model, "second tab")
+	model = drive(model, key(tea.KeyCtrlS))
+
+	if view := model.View(); !strings.Contains(view, "1 Note 1") || !strings.Contains(view, "2 Note 2") {
+		t.Fatalf("no tab bar with both notes: %q", view)
+	}
+
+	model = drive(model, key(tea.KeyCtrlLeft))
+	model = typeText(model, "first tab")
+	model = drive(model, key(tea.KeyCtrlS))
+
+	for phrase, want := range map[string]string{first: "first tab", second: "second tab"} {
+		var saved note
+		apiCall(t, http.MethodGet, "/notes", phrase, nil, "", &saved)
+		if saved.Message != want {
+			t.Errorf("note for %s = %q, want %q", phrase, saved.Message, want)
+		}
+	}
+}
+
+// TestScheduledDestruction schedules a note's deletion and checks it is
+// readable (with the pending time) until then and gone afterwards
+func TestScheduledDestruction(t *testing.T) {
+	const phrase = "e2e-destroy-phrase"
+	var created note
+	apiJSON(t, http.MethodPut, "/notes", phrase, map[string]any{"message": "burn after reading"}, &created)
+
+	var scheduled struct {
+		DestroyAt *time.Time `json:"destroyAt"`
+	}
+	if status := apiJSON(t, http.MethodPut, "/notes/destroy", phrase, map[string]any{"destroyIn": 1}, &scheduled); status != http.StatusOK || scheduled.DestroyAt == nil {
+		t.Fatalf("schedule: status %d, %+v", status, scheduled)
+	}
+	if out := sn(t, "status", phrase); !strings.Contains(out, "self-destructs") {
+		t.Fatalf("sn status does not warn about the pending deletion: %q", out)
+	}
+
+	time.Sleep(time.Until(*scheduled.DestroyAt) + 100*time.Millisecond)
+	var after note
+	apiCall(t, http.MethodGet, "/notes", phrase, nil, "", &after)
+	if after.ID == created.ID || after.Message != "" {
+		t.Fatalf("note still served after its destruction time: %+v", after)
+	}
+}
+
+// TestDeleteAndUndelete deletes a note by accident and recovers it
+func TestDeleteAndUndelete(t *testing.T) {
+	const phrase = "e2e-trash-phrase"
+	var created note
+	apiJSON(t, http.MethodPut, "/notes", phrase, map[string]any{"message": "do not lose me", "tags": []string{"keep"}}, &created)
+
+	if status := apiCall(t, http.MethodDelete, "/notes", phrase, nil, "", nil); status != http.StatusOK {
+		t.Fatalf("delete: status %d", status)
+	}
+	if status := apiCall(t, http.MethodGet, "/notes", phrase, nil, "", nil); status != http.StatusGone {
+		t.Fatalf("deleted note: status %d, want 410", status)
+	}
+
+	var restored note
+	if status := apiCall(t, http.MethodPost, "/notes/undelete", phrase, nil, "", &restored); status != http.StatusOK {
+		t.Fatalf("undelete: status %d", status)
+	}
+	if restored.ID != created.ID || restored.Message != "do not lose me" || len(restored.Tags) != 1 {
+		t.Fatalf("restored note differs: %+v", restored)
+	}
+	if status := apiCall(t, http.MethodPost, "/notes/undelete", phrase, nil, "", nil); status != http.StatusNotFound {
+		t.Fatalf("undelete of a live note: status %d, want 404", status)
+	}
+}
+
+// TestReadOnly locks a reference note against edits and unlocks it again
+func TestReadOnly(t *testing.T) {
+	const phrase = "e2e-read-only-phrase"
+	apiJSON(t, http.MethodPut, "/notes", phrase, map[string]any{"message": "recovery codes"}, nil)
+
+	if status := apiCall(t, http.MethodPut, "/notes/read-only", phrase, nil, "", nil); status != http.StatusOK {
+		t.Fatalf("set read-only: status %d", status)
+	}
+	var locked struct {
+		ReadOnly bool `json:"readOnly"`
+	}
+	apiCall(t, http.MethodGet, "/notes", phrase, nil, "", &locked)
+	if !locked.ReadOnly {
+		t.Fatal("GET /notes does not report the note as read-only")
+	}
+	if status := apiJSON(t, http.MethodPatch, "/notes", phrase, map[string]any{"message": "oops"}, nil); status != http.StatusLocked {
+		t.Fatalf("edit of a read-only note: status %d, want 423", status)
+	}
+	if out := sn(t, "status", phrase); !strings.Contains(out, "read-only") {
+		t.Fatalf("sn status does not mention the flag: %q", out)
+	}
+
+	if status := apiCall(t, http.MethodDelete, "/notes/read-only", phrase, nil, "", nil); status != http.StatusOK {
+		t.Fatalf("clear read-only: status %d", status)
+	}
+	var edited note
+	if status := apiJSON(t, http.MethodPatch, "/notes", phrase, map[string]any{"message": "new codes"}, &edited); status != http.StatusOK || edited.Message != "new codes" {
+		t.Fatalf("edit after unlocking: status %d, %+v", status, edited)
+	}
+}
+
+// TestAccessCounters checks that reads are counted and reported to the next
+// reader, without touching the note's updated time
+func TestAccessCounters(t *testing.T) {
+	const phrase = "e2e-counter-phrase"
+	apiJSON(t, http.MethodPut, "/notes", phrase, map[string]any{"message": "who reads this?"}, nil)
+
+	type counted struct {
+		AccessCount  int        `json:"accessCount"`
+		LastAccessed *time.Time `json:"lastAccessed"`
+		Updated      time.Time  `json:"updated"`
+	}
+	var first, second counted
+	apiCall(t, http.MethodGet, "/notes", phrase, nil, "", &first)
+	apiCall(t, http.MethodGet, "/notes", phrase, nil, "", &second)
+	if first.AccessCount != 0 || first.LastAccessed != nil {
+		t.Fatalf("first read reports earlier reads: %+v", first)
+	}
+	if second.AccessCount != 1 || second.LastAccessed == nil || !second.Updated.Equal(first.Updated) {
+		t.Fatalf("second read: %+v (first %+v)", second, first)
+	}
+	if out := sn(t, "status", phrase); !strings.Contains(out, "opened 2 times before") {
+		t.Fatalf("sn status does not report reads: %q", out)
+	}
+}
+
+// TestBranding checks that the operator's branding reaches the health check
+// and the about document the CLI reads
+func TestBranding(t *testing.T) {
+	var health struct {
+		Message string `json:"message"`
+	}
+	apiCall(t, http.MethodGet, "/", "", nil, "", &health)
+	if health.Message != "E2E Notes API is live" {
+		t.Fatalf("health message %q", health.Message)
+	}
+
+	about, err := api.NewClient(baseURL, true).About(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if about.Name != "E2E Notes" || about.About != "Run by the e2e suite" {
+		t.Fatalf("about: %+v", about)
+	}
+}
+
+// TestPhraseStrength checks that the CLI gets a verdict on weak and strong
+// passphrases, and that the brand name counts as a guessable word
+func TestPhraseStrength(t *testing.T) {
+	client := api.NewClient(baseURL, true)
+	for phrase, acceptable := range map[string]bool{
+		"password123":                 false,
+		"E2E Notes":                   false,
+		"orbit lantern maple quietly": true,
+	} {
+		strength, err := client.PhraseStrength(context.Background(), []byte(phrase))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strength.Acceptable != acceptable {
+			t.Fatalf("%q: expected acceptable=%v, got %+v", phrase, acceptable, strength)
+		}
+		if !acceptable && len(strength.Suggestions) == 0 {
+			t.Fatalf("%q: expected suggestions, got %+v", phrase, strength)
+		}
+	}
+}
+
+// TestAccessLog checks that requests on a note show up in its access log,
+// newest first, and that the log does not survive a move to a new passphrase
+func TestAccessLog(t *testing.T) {
+	const phrase = "e2e-access-log-phrase"
+	apiCall(t, http.MethodGet, "/notes", phrase, nil, "", nil)
+	apiJSON(t, http.MethodPut, "/notes", phrase, map[string]any{"message": "logged"}, nil)
+
+	type accessLog struct {
+		Entries []struct {
+			Time      time.Time `json:"time"`
+			Operation string    `json:"operation"`
+		} `json:"entries"`
+	}
+	var got accessLog
+	apiCall(t, http.MethodGet, "/notes/access-log", phrase, nil, "", &got)
+	apiCall(t, http.MethodGet, "/notes/access-log", phrase, nil, "", &got)
+	if len(got.Entries) != 2 || got.Entries[0].Operation != "PUT /notes" || got.Entries[1].Operation != "GET /notes" {
+		t.Fatalf("access log: %+v", got.Entries)
+	}
+
+	const moved = "e2e-access-log-moved"
+	if status := apiJSON(t, http.MethodPost, "/notes/rekey", phrase, map[string]any{"newPassphrase": moved}, nil); status != http.StatusOK {
+		t.Fatalf("rekey: status %d", status)
+	}
+	apiCall(t, http.MethodGet, "/notes/access-log", moved, nil, "", &got)
+	if len(got.Entries) != 0 {
+		t.Fatalf("access log after rekey: %+v", got.Entries)
+	}
+}
+
+// TestWebhook checks that a registered webhook gets signed, content-free pings
+// for changes, except those made by its own client
+func TestWebhook(t *testing.T) {
+	type ping struct {
+		event, signature, timestamp string
+		body                        []byte
+	}
+	pings := make(chan ping, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		pings <- ping{r.Header.Get("X-SecretNotes-Event"), r.Header.Get("X-SecretNotes-Signature"), r.Header.Get("X-SecretNotes-Timestamp"), body}
+	}))
+	defer receiver.Close()
+
+	const phrase = "e2e-webhook-phrase"
+	apiCall(t, http.MethodGet, "/notes", phrase, nil, "", nil)
+	var hook struct {
+		Secret string `json:"secret"`
+	}
+	if status := apiJSON(t, http.MethodPut, "/notes/webhook", phrase, map[string]any{"url": receiver.URL, "clientId": "laptop"}, &hook); status != http.StatusOK || hook.Secret == "" {
+		t.Fatalf("register: status %d, %+v", status, hook)
+	}
+
+	put := func(clientID, message string) {
+		body, _ := json.Marshal(map[string]any{"message": message})
+		req, _ := http.NewRequest(http.MethodPut, baseURL+"/api/secretnotes/notes", bytes.NewReader(body))
+		req.Header.Set("X-Passphrase", phrase)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Client-Id", clientID)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	put("laptop", "my own edit")
+	put("phone", "an edit from elsewhere")
+
+	select {
+	case p := <-pings:
+		mac := hmac.New(sha256.New, []byte(hook.Secret))
+		mac.Write([]byte(p.timestamp + "."))
+		mac.Write(p.body)
+		if p.event != "note.updated" || p.signature != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Fatalf("ping: %+v", p)
+		}
+		if bytes.Contains(p.body, []byte("elsewhere")) {
+			t.Fatalf("ping leaks content: %s", p.body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no ping for an edit from another client")
+	}
+	select {
+	case p := <-pings:
+		t.Fatalf("unexpected second ping (the laptop's own edit?): %+v", p)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+// TestBlobs stores client-encrypted data and reads it back: the server only
+// ever sees the lookup key and ciphertext
+func TestBlobs(t *testing.T) {
+	passphrase := "blob " + t.Name()
+	lookup := sha256.Sum256([]byte("lookup:" + passphrase))
+	key := sha256.Sum256([]byte("key:" + passphrase))
+	lookupKey := hex.EncodeToString(lookup[:])
+
+	block, _ := aes.NewCipher(key[:])
+	gcm, _ := cipher.NewGCM(block)
+	nonce := make([]byte, gcm.NonceSize())
+	sealed := gcm.Seal(nonce, nonce, []byte("only the client can read this"), nil)
+
+	blobCall := func(method string, body any, out any) int {
+		var reader io.Reader
+		if body != nil {
+			raw, _ := json.Marshal(body)
+			reader = bytes.NewReader(raw)
+		}
+		req, _ := http.NewRequest(method, baseURL+"/api/secretnotes/blobs", reader)
+		req.Header.Set("X-Blob-Key", lookupKey)
+		req.Header.Set("Content-Type", "application/json")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if out != nil {
+			json.NewDecoder(res.Body).Decode(out)
+		}
+		return res.StatusCode
+	}
+
+	put := map[string]any{
+		"format":     map[string]any{"version": 1, "name": "aes-256-gcm+sha256", "params": map[string]any{"nonceBytes": 12}},
+		"ciphertext": base64.StdEncoding.EncodeToString(sealed),
+	}
+	if status := blobCall(http.MethodPost, put, nil); status != http.StatusCreated {
+		t.Fatalf("create: status %d", status)
+	}
+	if status := blobCall(http.MethodPost, put, nil); status != http.StatusOK {
+		t.Fatalf("replace: status %d", status)
+	}
+
+	var blob struct {
+		Format struct {
+			Version int            `json:"version"`
+			Name    string         `json:"name"`
+			Params  map[string]any `json:"params"`
+		} `json:"format"`
+		Ciphertext string `json:"ciphertext"`
+	}
+	if status := blobCall(http.MethodGet, nil, &blob); status != http.StatusOK {
+		t.Fatalf("get: status %d", status)
+	}
+	if blob.Format.Version != 1 || blob.Format.Name != "aes-256-gcm+sha256" || blob.Format.Params["nonceBytes"] != float64(12) {
+		t.Fatalf("format not stored verbatim: %+v", blob.Format)
+	}
+	stored, _ := base64.StdEncoding.DecodeString(blob.Ciphertext)
+	plain, err := gcm.Open(nil, stored[:gcm.NonceSize()], stored[gcm.NonceSize():], nil)
+	if err != nil || string(plain) != "only the client can read this" {
+		t.Fatalf("ciphertext changed in storage: %v", err)
+	}
+
+	if status := blobCall(http.MethodDelete, nil, nil); status != http.StatusOK {
+		t.Fatalf("delete: status %d", status)
+	}
+	if status := blobCall(http.MethodGet, nil, nil); status != http.StatusNotFound {
+		t.Fatalf("get after delete: status %d", status)
+	}
+}
+
+// TestAccessTokens opens a session with the passphrase, uses the token in its
+// place, renews it by challenge-response and ends it
+func TestAccessTokens(t *testing.T) {
+	phrase := "tokens " + t.Name()
+	if status := apiJSON(t, http.MethodPut, "/notes", phrase, map[string]any{"message": "via token"}, nil); status >= 300 {
+		t.Fatalf("create: status %d", status)
+	}
+
+	withToken := func(method, path, token string, body any, out any) int {
+		var reader io.Reader
+		if body != nil {
+			raw, _ := json.Marshal(body)
+			reader = bytes.NewReader(raw)
+		}
+		req, _ := http.NewRequest(method, baseURL+"/api/secretnotes"+path, reader)
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("X-Access-Token", token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if out != nil {
+			json.NewDecoder(res.Body).Decode(out)
+		}
+		return res.StatusCode
+	}
+
+	var session struct {
+		Token string `json:"token"`
+	}
+	if status := apiCall(t, http.MethodPost, "/auth/token", phrase, nil, "", &session); status != http.StatusCreated || session.Token == "" {
+		t.Fatalf("open: status %d, %+v", status, session)
+	}
+
+	var got note
+	if status := withToken(http.MethodGet, "/notes", session.Token, nil, &got); status != http.StatusOK || got.Message != "via token" {
+		t.Fatalf("read with token: status %d, %+v", status, got)
+	}
+	if status := withToken(http.MethodPost, "/auth/token", session.Token, nil, nil); status != http.StatusBadRequest {
+		t.Fatalf("a token must not open a session of its own: status %d", status)
+	}
+
+	var challenge struct {
+		Nonce string `json:"nonce"`
+	}
+	withToken(http.MethodPost, "/auth/challenge", "", nil, &challenge)
+	mac := hmac.New(sha256.New, []byte(phrase))
+	mac.Write([]byte(challenge.Nonce))
+	old := session.Token
+	renew := map[string]any{"token": old, "nonce": challenge.Nonce, "proof": hex.EncodeToString(mac.Sum(nil))}
+	if status := withToken(http.MethodPost, "/auth/token/renew", "", renew, &session); status != http.StatusOK || session.Token == old {
+		t.Fatalf("renew: status %d", status)
+	}
+	if status := withToken(http.MethodGet, "/notes", old, nil, nil); status != http.StatusUnauthorized {
+		t.Fatalf("replaced token still works: status %d", status)
+	}
+
+	if status := withToken(http.MethodDelete, "/auth/token", session.Token, nil, nil); status != http.StatusOK {
+		t.Fatalf("close: status %d", status)
+	}
+	if status := withToken(http.MethodGet, "/notes", session.Token, nil, nil); status != http.StatusUnauthorized {
+		t.Fatalf("closed session still works: status %d", status)
+	}
+}
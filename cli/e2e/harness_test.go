@@ -0,0 +1,220 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// baseURL, snBinary and workDir are set up once by TestMain
+var (
+	baseURL  string
+	snBinary string
+	workDir  string
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "secretnotes-e2e-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	workDir = dir
+
+	serverBinary := filepath.Join(dir, "snsrv")
+	snBinary = filepath.Join(dir, "sn")
+	for _, build := range [][]string{{serverBinary, "../.."}, {snBinary, "../cmd/sn"}} {
+		cmd := exec.Command("go", "build", "-o", build[0], build[1])
+		cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "building %s: %v\n", build[1], err)
+			return 1
+		}
+	}
+
+	addr, err := freeAddr()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	baseURL = "http://" + addr
+
+	server := exec.Command(serverBinary, "serve", "--http", addr, "--dir", filepath.Join(dir, "pb_data"))
+	server.Env = append(os.Environ(),
+		"SECRETNOTES_PASTE_ENABLED=true",
+		"SECRETNOTES_BLOBS_ENABLED=true",
+		"SECRETNOTES_RATE_LIMIT_ENABLED=false",
+		"SECRETNOTES_ABUSE_ENABLED=false",
+		"SECRETNOTES_BRAND_NAME=E2E Notes",
+		"SECRETNOTES_ABOUT_TEXT=Run by the e2e suite",
+		"SECRETNOTES_NOTIFICATION_KEY=e2e-notification-key",
+		"SECRETNOTES_WEBHOOK_ALLOW_PRIVATE=true",
+		"SECRETNOTES_WEBHOOK_MIN_INTERVAL=1ms",
+	)
+	logFile, _ := os.Create(filepath.Join(dir, "server.log"))
+	server.Stdout, server.Stderr = logFile, logFile
+	if err := server.Start(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer func() {
+		_ = server.Process.Kill()
+		_ = server.Wait()
+	}()
+
+	if err := waitHealthy(15 * time.Second); err != nil {
+		logs, _ := os.ReadFile(filepath.Join(dir, "server.log"))
+		fmt.Fprintf(os.Stderr, "%v\n%s", err, logs)
+		return 1
+	}
+	return m.Run()
+}
+
+// freeAddr finds a loopback address with a port nobody is listening on
+func freeAddr() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return l.Addr().String(), nil
+}
+
+func waitHealthy(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		res, err := http.Get(baseURL + "/api/secretnotes/")
+		if err == nil {
+			res.Body.Close()
+			if res.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("server did not become healthy within %v", timeout)
+}
+
+// sn runs the CLI against the test server and returns its stdout
+func sn(t *testing.T, args ...string) string {
+	t.Helper()
+	args = append([]string{"-url", baseURL, "-config", filepath.Join(t.TempDir(), "config.json")}, args...)
+	cmd := exec.Command(snBinary, args...)
+	cmd.Env = append(os.Environ(), "HOME="+t.TempDir())
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("sn %s: %v\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+	return stdout.String()
+}
+
+// apiCall sends a request to the API and decodes a JSON response into out (if non-nil)
+func apiCall(t *testing.T, method, path, phrase string, body io.Reader, contentType string, out any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, baseURL+"/api/secretnotes"+path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if phrase != "" {
+		req.Header.Set("X-Passphrase", phrase)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if out != nil {
+		if raw, ok := out.(*[]byte); ok {
+			*raw, _ = io.ReadAll(res.Body)
+		} else if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return res.StatusCode
+}
+
+func apiJSON(t *testing.T, method, path, phrase string, body any, out any) int {
+	t.Helper()
+	raw, _ := json.Marshal(body)
+	return apiCall(t, method, path, phrase, bytes.NewReader(raw), "application/json", out)
+}
+
+// multipartBody builds a single-file multipart form
+func multipartBody(t *testing.T, field, filename string, content []byte) (io.Reader, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	part, err := w.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	w.Close()
+	return &buf, w.FormDataContentType()
+}
+
+// drive feeds cmd's messages back into the Bubble Tea model until nothing is
+// left to run, the way tea.Program would. Commands that don't finish within
+// cmdTimeout (heartbeat and clock ticks) are dropped.
+func drive(model tea.Model, cmd tea.Cmd) tea.Model {
+	const cmdTimeout = 500 * time.Millisecond
+	queue := []tea.Cmd{cmd}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if next == nil {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), cmdTimeout)
+		result := make(chan tea.Msg, 1)
+		go func() { result <- next() }()
+		var msg tea.Msg
+		select {
+		case msg = <-result:
+		case <-ctx.Done():
+		}
+		cancel()
+
+		switch msg := msg.(type) {
+		case nil:
+		case tea.BatchMsg:
+			queue = append(queue, msg...)
+		default:
+			var follow tea.Cmd
+			model, follow = model.Update(msg)
+			queue = append(queue, follow)
+		}
+	}
+	return model
+}
+
+// typeText sends s to the model as one burst of key presses, as a terminal
+// does for pasted text
+func typeText(model tea.Model, s string) tea.Model {
+	return drive(model, func() tea.Msg { return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)} })
+}
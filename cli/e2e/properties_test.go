@@ -0,0 +1,196 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"math/rand"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+	"unicode/utf8"
+)
+
+// Property tests drive the running server with random passphrases and
+// messages. A failure prints the generated input; rerun with the same seed
+// (logged at the start) to reproduce it.
+
+// propertyRuns is how many random cases each property checks
+const propertyRuns = 25
+
+// timedNote is a note response including its timestamps
+type timedNote struct {
+	note
+	Created    time.Time `json:"created"`
+	Updated    time.Time `json:"updated"`
+	WasCreated bool      `json:"wasCreated"`
+}
+
+// phrase is a random passphrase: 3-64 printable characters without surrounding
+// spaces, since it travels in the X-Passphrase header. A prefix keeps cases
+// from landing on notes made by the other tests.
+type phrase string
+
+func (phrase) Generate(r *rand.Rand, size int) reflect.Value {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.~!@#$%^&*() "
+	n := 3 + r.Intn(62)
+	var b strings.Builder
+	b.WriteString("prop-")
+	for b.Len() < n {
+		b.WriteByte(alphabet[r.Intn(len(alphabet))])
+	}
+	return reflect.ValueOf(phrase(strings.TrimSpace(b.String()) + "x"))
+}
+
+// content is a random valid UTF-8 message: mostly ASCII with multi-byte
+// scripts, emoji and newlines mixed in, from empty up to a few kilobytes
+type content string
+
+func (content) Generate(r *rand.Rand, size int) reflect.Value {
+	ranges := [][2]rune{
+		{0x20, 0x7e},       // ASCII
+		{0x00c0, 0x024f},   // Latin accents
+		{0x0400, 0x04ff},   // Cyrillic
+		{0x4e00, 0x9fff},   // CJK
+		{0x1f300, 0x1f64f}, // emoji
+	}
+	lengths := []int{0, 1, 16, 256, 4096}
+	n := r.Intn(lengths[r.Intn(len(lengths))] + 1)
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		if r.Intn(20) == 0 {
+			b.WriteByte('\n')
+			continue
+		}
+		span := ranges[0]
+		if r.Intn(3) == 0 {
+			span = ranges[r.Intn(len(ranges))]
+		}
+		b.WriteRune(span[0] + rune(r.Intn(int(span[1]-span[0]+1))))
+	}
+	return reflect.ValueOf(content(b.String()))
+}
+
+// checkProperty runs f against random inputs with a logged seed
+func checkProperty(t *testing.T, f any) {
+	t.Helper()
+	seed := time.Now().UnixNano()
+	t.Logf("seed %d", seed)
+	if err := quick.Check(f, &quick.Config{MaxCount: propertyRuns, Rand: rand.New(rand.NewSource(seed))}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestPropertyWhatYouPutIsWhatYouGet checks that a saved message reads back
+// byte for byte, and that a save never moves the note's identity or creation time
+func TestPropertyWhatYouPutIsWhatYouGet(t *testing.T) {
+	checkProperty(t, func(p phrase, first, second content) bool {
+		if !utf8.ValidString(string(first)) || !utf8.ValidString(string(second)) {
+			return false
+		}
+
+		var put timedNote
+		if status := apiJSON(t, http.MethodPut, "/notes", string(p), map[string]any{"message": first}, &put); status != http.StatusOK && status != http.StatusCreated {
+			t.Logf("PUT: status %d", status)
+			return false
+		}
+		var got timedNote
+		if status := apiCall(t, http.MethodGet, "/notes", string(p), nil, "", &got); status != http.StatusOK || got.WasCreated {
+			t.Logf("GET after PUT: status %d, wasCreated %v", status, got.WasCreated)
+			return false
+		}
+		if got.Message != string(first) || got.ID != put.ID {
+			t.Logf("GET after PUT returned %q (id %s), want %q (id %s)", got.Message, got.ID, first, put.ID)
+			return false
+		}
+
+		var patched timedNote
+		if status := apiJSON(t, http.MethodPatch, "/notes", string(p), map[string]any{"message": second}, &patched); status != http.StatusOK {
+			t.Logf("PATCH: status %d", status)
+			return false
+		}
+		if patched.Message != string(second) || patched.ID != put.ID {
+			t.Logf("PATCH returned %q (id %s), want %q (id %s)", patched.Message, patched.ID, second, put.ID)
+			return false
+		}
+		if !patched.Created.Equal(put.Created) || patched.Updated.Before(patched.Created) {
+			t.Logf("update moved timestamps: created %v -> %v, updated %v", put.Created, patched.Created, patched.Updated)
+			return false
+		}
+		return true
+	})
+}
+
+// TestPropertyCreatedOnlyOnce checks that only the first request for a
+// passphrase reports creating its note, however quickly the next one follows
+func TestPropertyCreatedOnlyOnce(t *testing.T) {
+	checkProperty(t, func(p phrase) bool {
+		p += phrase("-" + strconv.FormatInt(time.Now().UnixNano(), 36)) // always a fresh note
+
+		var first, second timedNote
+		firstStatus := apiCall(t, http.MethodGet, "/notes", string(p), nil, "", &first)
+		secondStatus := apiCall(t, http.MethodGet, "/notes", string(p), nil, "", &second)
+		if firstStatus != http.StatusCreated || !first.WasCreated || secondStatus != http.StatusOK || second.WasCreated {
+			t.Logf("first GET: %d wasCreated %v; second GET: %d wasCreated %v", firstStatus, first.WasCreated, secondStatus, second.WasCreated)
+			return false
+		}
+		return true
+	})
+}
+
+// TestPropertyPhrasesAreIsolated checks that writing under one passphrase is
+// never visible under another
+func TestPropertyPhrasesAreIsolated(t *testing.T) {
+	checkProperty(t, func(a, b phrase, message content) bool {
+		if a == b {
+			return true
+		}
+		var before timedNote
+		apiCall(t, http.MethodGet, "/notes", string(b), nil, "", &before)
+
+		apiJSON(t, http.MethodPut, "/notes", string(a), map[string]any{"message": message}, nil)
+
+		var after timedNote
+		apiCall(t, http.MethodGet, "/notes", string(b), nil, "", &after)
+		if after.ID != before.ID || after.Message != before.Message {
+			t.Logf("saving under %q changed the note under %q: %q -> %q", a, b, before.Message, after.Message)
+			return false
+		}
+		return true
+	})
+}
+
+// TestPropertyImageDeleteClearsHasImage checks that hasImage follows
+// uploading and deleting an attachment, whatever its content
+func TestPropertyImageDeleteClearsHasImage(t *testing.T) {
+	checkProperty(t, func(p phrase, message content, image []byte) bool {
+		apiJSON(t, http.MethodPut, "/notes", string(p), map[string]any{"message": message}, nil)
+
+		body, contentType := multipartBody(t, "image", "image.png", append([]byte("\x89PNG"), image...))
+		if status := apiCall(t, http.MethodPost, "/notes/image", string(p), body, contentType, nil); status != http.StatusOK {
+			t.Logf("upload: status %d", status)
+			return false
+		}
+		var withImage timedNote
+		apiCall(t, http.MethodGet, "/notes", string(p), nil, "", &withImage)
+		if !withImage.HasImage {
+			t.Logf("hasImage is false after upload")
+			return false
+		}
+
+		if status := apiCall(t, http.MethodDelete, "/notes/image", string(p), nil, "", nil); status != http.StatusOK {
+			t.Logf("delete image: status %d", status)
+			return false
+		}
+		var withoutImage timedNote
+		apiCall(t, http.MethodGet, "/notes", string(p), nil, "", &withoutImage)
+		if withoutImage.HasImage || withoutImage.Message != string(message) {
+			t.Logf("after deleting the image: hasImage %v, message %q", withoutImage.HasImage, withoutImage.Message)
+			return false
+		}
+		return true
+	})
+}
@@ -3,11 +3,16 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 )
 
@@ -15,14 +20,41 @@ type Client struct {
 	BaseURL   string
 	VerifyTLS bool
 	hc        *http.Client
+
+	// skew is how far the server clock is ahead of ours (negative when behind),
+	// as measured by MeasureSkew
+	skew time.Duration
 }
 
+// ErrReadOnly is returned by UpdateNote when the note is marked read-only
+var ErrReadOnly = errors.New("note is read-only")
+
+// SkewWarnThreshold is the clock skew above which users should be warned
+const SkewWarnThreshold = 30 * time.Second
+
 type Note struct {
-	ID      string      `json:"id"`
-	Message string      `json:"message"`
-	HasImage bool       `json:"hasImage"`
-	Created any         `json:"created"`
-	Updated any         `json:"updated"`
+	ID           string     `json:"id"`
+	Message      string     `json:"message"`
+	Title        string     `json:"title"` // empty on servers without note metadata
+	Tags         []string   `json:"tags"`
+	HasImage     bool       `json:"hasImage"`
+	Created      time.Time  `json:"created"`
+	Updated      time.Time  `json:"updated"`
+	DestroyAt    *time.Time `json:"destroyAt"`    // scheduled deletion; nil when none
+	AccessCount  int        `json:"accessCount"`  // reads before this one
+	LastAccessed *time.Time `json:"lastAccessed"` // the most recent of those; nil if none
+	ReadOnly     bool       `json:"readOnly"`     // edits are refused until it is unlocked
+	Usage        *Usage     `json:"usage"`        // nil on servers without quotas
+
+	New bool `json:"-"` // GetOrCreateNote created the note (201)
+}
+
+// Usage is how much of the passphrase's quota is used. Limits of 0 mean none.
+type Usage struct {
+	NoteBytes       int64 `json:"noteBytes"`
+	NoteLimit       int64 `json:"noteLimit"`
+	AttachmentBytes int64 `json:"attachmentBytes"`
+	AttachmentLimit int64 `json:"attachmentLimit"`
 }
 
 func NewClient(baseURL string, verifyTLS bool) *Client {
@@ -49,6 +81,84 @@ func (c *Client) Health(ctx context.Context) error {
 	return nil
 }
 
+// About is the server's branding, as configured by its operator
+type About struct {
+	Name  string `json:"name"`
+	About string `json:"about"`
+}
+
+// About fetches the server's branding. Servers that predate the endpoint
+// answer 404, which is reported as an error like any other failure.
+func (c *Client) About(ctx context.Context) (*About, error) {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api/secretnotes/about", nil)
+	req.Header.Set("User-Agent", "SecretNotes-CLI/1.0")
+	res, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("about %d: %s", res.StatusCode, string(b))
+	}
+	var about About
+	if err := json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&about); err != nil {
+		return nil, fmt.Errorf("about: %w", err)
+	}
+	return &about, nil
+}
+
+// MeasureSkew compares the local clock with the server's, using the midpoint of
+// the request round trip, and remembers the result for ServerToLocal. Servers
+// without the /time endpoint are measured from the Date header (1s precision).
+func (c *Client) MeasureSkew(ctx context.Context) (time.Duration, error) {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api/secretnotes/time", nil)
+	req.Header.Set("User-Agent", "SecretNotes-CLI/1.0")
+	sent := time.Now()
+	res, err := c.hc.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	received := time.Now()
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return 0, fmt.Errorf("server time %d: %s", res.StatusCode, string(b))
+	}
+
+	var body struct {
+		UnixMs int64 `json:"unixMs"`
+	}
+	_ = json.NewDecoder(io.LimitReader(res.Body, 4096)).Decode(&body)
+	var server time.Time
+	switch {
+	case body.UnixMs > 0:
+		server = time.UnixMilli(body.UnixMs)
+	case res.Header.Get("Date") != "":
+		if server, err = http.ParseTime(res.Header.Get("Date")); err != nil {
+			return 0, fmt.Errorf("server time: %w", err)
+		}
+	default:
+		return 0, fmt.Errorf("server time: not reported")
+	}
+
+	midpoint := sent.Add(received.Sub(sent) / 2)
+	c.skew = server.Sub(midpoint)
+	return c.skew, nil
+}
+
+// ClockSkew returns the last measured skew (server minus local clock)
+func (c *Client) ClockSkew() time.Duration { return c.skew }
+
+// ServerToLocal converts a timestamp issued by the server to the local clock.
+// Only use it for display and local timers; never adjust what is sent back.
+func (c *Client) ServerToLocal(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.Add(-c.skew)
+}
+
 func (c *Client) GetOrCreateNote(ctx context.Context, passphrase []byte) (*Note, error) {
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api/secretnotes/notes", nil)
 	attachHeaders(req, passphrase)
@@ -65,19 +175,94 @@ func (c *Client) GetOrCreateNote(ctx context.Context, passphrase []byte) (*Note,
 	if err := json.NewDecoder(res.Body).Decode(&note); err != nil {
 		return nil, err
 	}
+	note.New = res.StatusCode == http.StatusCreated
 	return &note, nil
 }
 
-func (c *Client) UpdateNote(ctx context.Context, passphrase []byte, message string) (*Note, error) {
-	body, _ := json.Marshal(map[string]string{"message": message})
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPatch, c.BaseURL+"/api/secretnotes/notes", bytes.NewReader(body))
+// PhraseStrength is the server's estimate of how guessable a passphrase is
+type PhraseStrength struct {
+	Score       int      `json:"score"`      // 0 (too guessable) to 4
+	Acceptable  bool     `json:"acceptable"` // score of 3 or more
+	Warning     string   `json:"warning"`
+	Suggestions []string `json:"suggestions"`
+}
+
+// PhraseStrength asks the server how guessable passphrase is. The phrase is
+// sent as a candidate, not as the note's passphrase, so it opens nothing.
+func (c *Client) PhraseStrength(ctx context.Context, passphrase []byte) (*PhraseStrength, error) {
+	body, _ := json.Marshal(map[string]string{"phrase": string(passphrase)})
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/api/secretnotes/phrase/strength", bytes.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
-	attachHeaders(req, passphrase)
+	req.Header.Set("User-Agent", "SecretNotes-CLI/1.0")
+	res, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("phrase strength %d: %s", res.StatusCode, string(b))
+	}
+	var strength PhraseStrength
+	if err := json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&strength); err != nil {
+		return nil, fmt.Errorf("phrase strength: %w", err)
+	}
+	return &strength, nil
+}
+
+// GeneratedPhrase is a passphrase of random words suggested by the server
+type GeneratedPhrase struct {
+	Passphrase string  `json:"passphrase"`
+	Words      int     `json:"words"`
+	Entropy    float64 `json:"entropy"` // bits
+}
+
+// GeneratePhrase asks the server for a passphrase of words random BIP39 words
+// joined by separator
+func (c *Client) GeneratePhrase(ctx context.Context, words int, separator string) (*GeneratedPhrase, error) {
+	query := url.Values{"words": {strconv.Itoa(words)}, "separator": {separator}}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api/secretnotes/phrase/generate?"+query.Encode(), nil)
+	req.Header.Set("User-Agent", "SecretNotes-CLI/1.0")
 	res, err := c.hc.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("generate phrase %d: %s", res.StatusCode, string(b))
+	}
+	var phrase GeneratedPhrase
+	if err := json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&phrase); err != nil {
+		return nil, fmt.Errorf("generate phrase: %w", err)
+	}
+	return &phrase, nil
+}
+
+// UpdateNote saves the note's message. The request carries an Idempotency-Key
+// and is retried once if the connection fails, so a save that reached the
+// server but lost its response is not applied twice.
+func (c *Client) UpdateNote(ctx context.Context, passphrase []byte, message string) (*Note, error) {
+	body, _ := json.Marshal(map[string]string{"message": message})
+	key := newIdempotencyKey()
+	var res *http.Response
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPatch, c.BaseURL+"/api/secretnotes/notes", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		attachHeaders(req, passphrase)
+		if res, err = c.hc.Do(req); err == nil || ctx.Err() != nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusLocked {
+		return nil, ErrReadOnly
+	}
 	if res.StatusCode != http.StatusOK {
 		b, _ := io.ReadAll(io.LimitReader(res.Body, 2048))
 		return nil, fmt.Errorf("update note %d: %s", res.StatusCode, string(b))
@@ -89,12 +274,165 @@ func (c *Client) UpdateNote(ctx context.Context, passphrase []byte, message stri
 	return &note, nil
 }
 
+// Lock is an advisory editing lock on a note. ExpiresAt is on the local clock.
+type Lock struct {
+	SessionID string    `json:"sessionId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// LockedError is returned by AcquireLock when another session is editing the
+// note. ExpiresAt is on the local clock.
+type LockedError struct {
+	ExpiresAt time.Time
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("note is being edited elsewhere (lock expires %s)", e.ExpiresAt.Local().Format("15:04:05"))
+}
+
+// AcquireLock takes or renews the editing lock for sessionID. Call it again
+// before the lock expires to keep it.
+func (c *Client) AcquireLock(ctx context.Context, passphrase []byte, sessionID string) (*Lock, error) {
+	body, _ := json.Marshal(map[string]string{"sessionId": sessionID})
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/api/secretnotes/notes/lock", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	attachHeaders(req, passphrase)
+	res, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusConflict {
+		var held struct {
+			ExpiresAt time.Time `json:"expiresAt"`
+		}
+		_ = json.NewDecoder(res.Body).Decode(&held)
+		return nil, &LockedError{ExpiresAt: c.ServerToLocal(held.ExpiresAt)}
+	}
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 2048))
+		return nil, fmt.Errorf("acquire lock %d: %s", res.StatusCode, string(b))
+	}
+	var lock Lock
+	if err := json.NewDecoder(res.Body).Decode(&lock); err != nil {
+		return nil, err
+	}
+	lock.ExpiresAt = c.ServerToLocal(lock.ExpiresAt)
+	return &lock, nil
+}
+
+// ReleaseLock drops the editing lock if sessionID holds it
+func (c *Client) ReleaseLock(ctx context.Context, passphrase []byte, sessionID string) error {
+	body, _ := json.Marshal(map[string]string{"sessionId": sessionID})
+	req, _ := http.NewRequestWithContext(ctx, http.MethodDelete, c.BaseURL+"/api/secretnotes/notes/lock", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	attachHeaders(req, passphrase)
+	res, err := c.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 2048))
+		return fmt.Errorf("release lock %d: %s", res.StatusCode, string(b))
+	}
+	return nil
+}
+
+// RecoveryKit is a passphrase split into shares, any Threshold of which recover it
+type RecoveryKit struct {
+	KitID     string   `json:"kitId"`
+	Threshold int      `json:"threshold"`
+	Shares    []string `json:"shares"`
+}
+
+// RecoveryKit asks the server to split passphrase into a kit of n shares, any
+// threshold of which recover it. The server keeps no copy.
+func (c *Client) RecoveryKit(ctx context.Context, passphrase []byte, threshold, n int) (*RecoveryKit, error) {
+	body, _ := json.Marshal(map[string]int{"threshold": threshold, "shares": n})
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/api/secretnotes/notes/recovery-kit", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	attachHeaders(req, passphrase)
+	res, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 2048))
+		return nil, fmt.Errorf("recovery kit %d: %s", res.StatusCode, string(b))
+	}
+	var kit RecoveryKit
+	if err := json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&kit); err != nil {
+		return nil, fmt.Errorf("recovery kit: %w", err)
+	}
+	return &kit, nil
+}
+
+// Recovery is a passphrase rebuilt from the shares of a recovery kit
+type Recovery struct {
+	Passphrase string `json:"passphrase"`
+	KitID      string `json:"kitId"`
+	NoteExists bool   `json:"noteExists"`
+}
+
+// Recover rebuilds a passphrase from the shares of a recovery kit
+func (c *Client) Recover(ctx context.Context, shares []string) (*Recovery, error) {
+	body, _ := json.Marshal(map[string][]string{"shares": shares})
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/api/secretnotes/recover", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SecretNotes-CLI/1.0")
+	res, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 2048))
+		return nil, fmt.Errorf("recover %d: %s", res.StatusCode, string(b))
+	}
+	var recovery Recovery
+	if err := json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&recovery); err != nil {
+		return nil, fmt.Errorf("recover: %w", err)
+	}
+	return &recovery, nil
+}
+
+// newIdempotencyKey returns a random key identifying one logical write
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 func attachHeaders(req *http.Request, passphrase []byte) {
 	// Construct header string transiently
 	req.Header.Set("X-Passphrase", string(passphrase))
 	req.Header.Set("User-Agent", "SecretNotes-CLI/1.0")
 }
 
+// SetAuthToken sends token as an "Authorization: Bearer" header on every
+// request, for servers running behind SECRETNOTES_AUTH_MODE=token or oidc.
+// Servers using basic auth take the credentials from the URL instead.
+func (c *Client) SetAuthToken(token string) {
+	if token == "" {
+		return
+	}
+	c.hc.Transport = &bearerTransport{token: token, next: c.hc.Transport}
+}
+
+// bearerTransport adds an Authorization header to outgoing requests
+type bearerTransport struct {
+	token string
+	next  http.RoundTripper
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.next.RoundTrip(req)
+}
+
 func trimTrailingSlash(s string) string {
 	for len(s) > 0 && s[len(s)-1] == '/' {
 		s = s[:len(s)-1]
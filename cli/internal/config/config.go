@@ -20,6 +20,7 @@ type Server struct {
 	Name      string `json:"name"`
 	URL       string `json:"url"`
 	VerifyTLS bool   `json:"verifyTLS"`
+	AuthToken string `json:"authToken,omitempty"` // bearer token for servers with an auth layer
 }
 
 type Preferences struct {
@@ -2,12 +2,16 @@ package tui
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/atotto/clipboard"
 	"github.com/charmbracelet/bubbles/textinput"
-	"github.com/charmbracelet/bubbles/textarea"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 
@@ -16,48 +20,36 @@ import (
 
 type EditorApp struct {
 	client      *api.Client
-	pass        []byte
 	serverName  string
 
+	// open notes; the active one is embedded so its state reads as the app's
+	*noteTab
+	tabs        []*noteTab
+	active      int
+
 	// exit semantics
 	exitMode    string // "wipe" clears screen+scrollback; "clear" clears screen only
 
 	// UI state
-	ta          textarea.Model
-	status      string
-	lastSaved   time.Time
-	autosave    bool
+	autosaveDefault bool // for newly opened tabs
 	debounce    time.Duration
-	saveTimer   *time.Timer
-	seq         int // debounce sequence
 
 	// Passphrase prompt
 	prompting   bool
+	promptTab   bool // the passphrase opens a new tab instead of replacing this one
 	pin         textinput.Model
 
 	// View modes
 	plainCopyMode bool
 	showAbout     bool
-
-	// connectivity
-	connected  bool
+	serverBrand   string // operator's service name and about text, from GET /about
+	serverAbout   string
 
 	// persistence
 	savePref    func(enabled bool, debounceMs int) error
-
-	// data
-	loaded      bool
-	initialErr  error
 }
 
 func NewEditorApp(client *api.Client, passphrase []byte, serverName string, autosave bool, debounce time.Duration, savePref func(bool, int) error) *EditorApp {
-	ta := textarea.New()
-	ta.Placeholder = "Loading note..."
-	ta.Focus()
-	// reasonable sizes; Bubble Tea will reflow in terminal
-	ta.SetWidth(100)
-	ta.SetHeight(24)
-
 	pin := textinput.New()
 	pin.Placeholder = "Enter new passphrase"
 	pin.Prompt = ""
@@ -66,23 +58,43 @@ func NewEditorApp(client *api.Client, passphrase []byte, serverName string, auto
 	pin.CharLimit = 256
 	pin.Width = 48
 
-	return &EditorApp{
+	a := &EditorApp{
 		client:     client,
-		pass:       passphrase,
 		serverName: serverName,
-		ta:         ta,
-		status:     "",
-		autosave:   autosave,
+		autosaveDefault: autosave,
 		debounce:   debounce,
 		pin:        pin,
 		savePref:   savePref,
 	}
+	a.tabs = []*noteTab{newNoteTab(client, passphrase, autosave)}
+	a.switchTab(0)
+	return a
+}
+
+// lockHeartbeat is how often the editing lock is renewed; the server lets it
+// lapse after a minute without renewal.
+const lockHeartbeat = 20 * time.Second
+
+// clockRefresh is how often the status bar is redrawn so "saved 5m ago" stays current
+const clockRefresh = 30 * time.Second
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
 }
 
 // Run starts the Bubble Tea program
 func (a *EditorApp) Run(ctx context.Context) error {
 	p := tea.NewProgram(a, tea.WithContext(ctx), tea.WithAltScreen())
 	_, err := p.Run()
+	// Best-effort release so others don't wait for the locks to expire
+	rctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	for _, t := range a.tabs {
+		_ = a.client.ReleaseLock(rctx, t.pass, t.sessionID)
+		for i := range t.pass { t.pass[i] = 0 }
+	}
 	return err
 }
 
@@ -91,7 +103,7 @@ func (a *EditorApp) ExitMode() string { return a.exitMode }
 
 // Init loads note
 func (a *EditorApp) Init() tea.Cmd {
-	return a.loadNoteCmd()
+	return tea.Batch(a.start(), clockTickCmd())
 }
 
 func (a *EditorApp) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -116,15 +128,26 @@ func (a *EditorApp) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					a.status = "Passphrase must be at least 3 characters"
 					return a, nil
 				}
-				// swap passphrase (best-effort zero existing buffer)
+				if a.promptTab {
+					a.prompting, a.promptTab = false, false
+					a.pin.Reset()
+					a.ta.Focus()
+					return a, a.openTab([]byte(val))
+				}
+				// release the old note's lock, then swap passphrase (best-effort zero existing buffer)
+				release := a.releaseLockCmd()
 				for i := range a.pass { a.pass[i] = 0 }
 				a.pass = []byte(val)
 				a.prompting = false
 				a.pin.Reset()
 				a.ta.Focus()
-				return a, a.loadNoteCmd()
+				a.lockGen++
+				a.lockedByOther, a.confirmSave, a.forceSave = false, false, false
+				a.noteTitle, a.noteCreated, a.noteUpdated, a.noteDestroy = "", time.Time{}, time.Time{}, time.Time{}
+				a.readOnly = false
+				return a, tea.Batch(release, a.start())
 			case "esc", "ctrl+c":
-				a.prompting = false
+				a.prompting, a.promptTab = false, false
 				a.pin.Reset()
 				a.ta.Focus()
 				return a, nil
@@ -139,22 +162,44 @@ func (a *EditorApp) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			a.showAbout = !a.showAbout
 			return a, nil
 		case "ctrl+shift+s", "ctrl+S", "alt+s":
-			// Toggle autosave and persist preference
+			// Toggle this tab's autosave and persist it as the preference
 			a.autosave = !a.autosave
+			a.autosaveDefault = a.autosave
 			if a.savePref != nil {
 				_ = a.savePref(a.autosave, int(a.debounce/time.Millisecond))
 			}
 			if a.autosave { a.status = "Autosave: on" } else { a.status = "Autosave: off" }
 			return a, nil
 		case "ctrl+s":
+			if a.lockedByOther && !a.forceSave {
+				if !a.confirmSave {
+					a.confirmSave = true
+					a.status = "Someone else is editing this note — press Ctrl+S again to save anyway"
+					return a, nil
+				}
+				a.forceSave = true
+			}
 			return a, a.saveCmd()
-		case "ctrl+p":
+		case "ctrl+p", "ctrl+n":
 			a.prompting = true
+			a.promptTab = s == "ctrl+n"
 			a.pin.SetValue("")
 			a.pin.Focus()
 			a.ta.Blur()
 			a.status = "Enter new passphrase and press Enter"
 			return a, nil
+		case "alt+w":
+			return a, a.closeTab()
+		case "ctrl+right", "ctrl+left":
+			step := 1
+			if s == "ctrl+left" {
+				step = len(a.tabs) - 1
+			}
+			a.switchTab((a.active + step) % len(a.tabs))
+			return a, nil
+		case "alt+1", "alt+2", "alt+3", "alt+4", "alt+5", "alt+6", "alt+7", "alt+8", "alt+9":
+			a.switchTab(int(s[len(s)-1] - '1'))
+			return a, nil
 case "ctrl+t":
 			a.plainCopyMode = !a.plainCopyMode
 			if a.plainCopyMode {
@@ -176,36 +221,107 @@ case "ctrl+t":
 			return a, tea.Quit
 		}
 case loadedMsg:
+		t := m.tab
+		if a.tabIndex(t) < 0 {
+			return a, nil // closed meanwhile
+		}
 		if m.err != nil {
-			a.initialErr = m.err
-			a.connected = false
-			a.ta.Placeholder = "Failed to load note (press Ctrl+Q to quit)"
-			a.status = "Offline"
+			t.initialErr = m.err
+			t.connected = false
+			t.ta.Placeholder = "Failed to load note (press Ctrl+Q to quit)"
+			t.status = "Offline"
 			return a, nil
 		}
-		a.loaded = true
-		a.connected = true
-	a.ta.SetValue(m.note.Message)
-		a.ta.Placeholder = "Start typing your secure note..."
+		t.loaded = true
+		t.connected = true
+	t.ta.SetValue(m.note.Message)
+		t.savedText = m.note.Message
+		t.setNoteInfo(m.note)
+		t.ta.Placeholder = "Start typing your secure note..."
 		// Clear transient status to avoid duplicate "Connected" in footer
-		a.status = ""
+		t.status = ""
+		if t.readOnly {
+			t.status = "This note is read-only; changes won't be saved"
+		}
+		if m.note.New {
+			// a fresh note: say so now if its passphrase is easy to guess
+			return a, t.checkStrengthCmd()
+		}
+		return a, nil
+	case strengthMsg:
+		t := m.tab
+		if a.tabIndex(t) >= 0 && m.gen == t.lockGen && m.err == nil && !m.strength.Acceptable {
+			warning := stripControl(m.strength.Warning)
+			if warning == "" {
+				warning = "it is easy to guess"
+			}
+			t.status = fmt.Sprintf("Weak passphrase: %s (Ctrl+P to pick another)", warning)
+		}
 		return a, nil
 case savedMsg:
+		t := m.tab
+		if a.tabIndex(t) < 0 {
+			return a, nil
+		}
+		if errors.Is(m.err, api.ErrReadOnly) {
+			t.readOnly = true
+			t.status = "Not saved: this note is read-only"
+			return a, nil
+		}
 		if m.err != nil {
-			a.connected = false
-			a.status = "Offline (save failed)"
+			t.connected = false
+			t.status = "Offline (save failed)"
 			return a, nil
 		}
-		a.connected = true
-		a.lastSaved = time.Now()
-		a.status = fmt.Sprintf("Saved %s", a.lastSaved.Format("15:04:05"))
+		t.connected = true
+		t.lastSaved = time.Now()
+		t.savedText = m.text
+		t.setNoteInfo(m.note)
+		t.status = fmt.Sprintf("Saved %s", t.lastSaved.Format("15:04:05"))
 		return a, nil
 	case autoSaveMsg:
-		// Only save if token matches the latest sequence
-		if m.seq == a.seq {
-			return a, a.saveCmd()
+		// Only save if token matches the tab's latest sequence
+		t := m.tab
+		if a.tabIndex(t) >= 0 && m.seq == t.seq {
+			if t.readOnly {
+				t.status = "Autosave off: this note is read-only"
+				return a, nil
+			}
+			if t.lockedByOther && !t.forceSave {
+				t.status = "Autosave paused: someone else is editing (Ctrl+S to save anyway)"
+				return a, nil
+			}
+			return a, t.saveCmd()
+		}
+		return a, nil
+	case lockMsg:
+		t := m.tab
+		if a.tabIndex(t) < 0 || m.gen != t.lockGen {
+			return a, nil
+		}
+		if m.err != nil {
+			var locked *api.LockedError
+			if errors.As(m.err, &locked) {
+				if !t.lockedByOther {
+					t.status = "Someone else is editing this note"
+				}
+				t.lockedByOther = true
+				t.lockExpires = locked.ExpiresAt
+			}
+			// Other errors (offline, older server) leave the lock state as is
+		} else if t.lockedByOther {
+			t.lockedByOther, t.confirmSave, t.forceSave = false, false, false
+			t.status = "The other editor has left; you now hold the lock"
+		}
+		gen := t.lockGen
+		return a, tea.Tick(lockHeartbeat, func(time.Time) tea.Msg { return lockTickMsg{tab: t, gen: gen} })
+	case lockTickMsg:
+		if a.tabIndex(m.tab) >= 0 && m.gen == m.tab.lockGen {
+			return a, m.tab.acquireLockCmd()
 		}
 		return a, nil
+	case clockTickMsg:
+		return a, clockTickCmd()
 	}
 
 	// Delegate to textarea
@@ -215,9 +331,9 @@ case savedMsg:
 	// If content changed and autosave enabled, schedule debounced save via sequence token
 	if a.autosave && a.loaded && a.ta.Value() != prev {
 		a.seq++
-		seq := a.seq
+		t, seq := a.noteTab, a.seq
 		deb := a.debounce
-		return a, tea.Tick(deb, func(time.Time) tea.Msg { return autoSaveMsg{seq: seq} })
+		return a, tea.Tick(deb, func(time.Time) tea.Msg { return autoSaveMsg{tab: t, seq: seq} })
 	}
 	return a, cmd
 }
@@ -233,31 +349,55 @@ func (a *EditorApp) View() string {
 		conn = "Connected"
 	}
 	status := fmt.Sprintf("Status: %s  |  Autosave: %v", conn, a.autosave)
+	if a.noteTitle != "" {
+		status = fmt.Sprintf("%s  |  Status: %s  |  Autosave: %v", a.noteTitle, conn, a.autosave)
+	}
+	if times := NoteTimes(a.noteCreated, a.noteUpdated, time.Now()); times != "" {
+		status = fmt.Sprintf("%s  |  %s", status, times)
+	}
+	if warning := DestroyWarning(a.noteDestroy, time.Now()); warning != "" {
+		status = fmt.Sprintf("%s  |  %s", status, warning)
+	}
+	if a.lockedByOther {
+		status = fmt.Sprintf("%s  |  Editing elsewhere until %s", status, a.lockExpires.Local().Format("15:04:05"))
+	}
 	if a.status != "" && a.status != "Connected" {
 		status = fmt.Sprintf("%s  |  %s", status, a.status)
 	}
 	base := border.Render(a.ta.View()) + "\n" + lipgloss.NewStyle().Faint(true).Render(status)
+	if bar := a.tabBar(); bar != "" {
+		base = bar + "\n" + base
+	}
 	// footer hints
 	hints := "?: About • Ctrl+T Plain • Ctrl+Y Copy • Ctrl+P Passphrase • Alt+S Autosave • Ctrl+S Save • Ctrl+Q Quit"
+	hints += "\nCtrl+N New tab • Ctrl+←/→ or Alt+1-9 Switch • Alt+W Close tab"
 	base = base + "\n" + lipgloss.NewStyle().Faint(true).Render(hints)
 	if a.showAbout {
 		// About modal
 		header := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("63")).Render("SecretNotes CLI")
 		sub := lipgloss.NewStyle().Italic(true).Foreground(lipgloss.Color("135")).Render("Created by Clint and Ken for Lugetech")
-		body := "A zero‑knowledge, passphrase‑based, single‑note editor.\n" +
+		body := "A zero‑knowledge, passphrase‑based note editor.\n" +
 			"One passphrase → one note, encrypted end‑to‑end.\n" +
 			"No accounts, no tracking — your secret stays yours.\n" +
 			"Text‑first TUI with save, autosave, and quick copy.\n" +
 			"Privacy: Ctrl+Q wipes screen + history, Ctrl+C clears screen only.\n" +
 			"Note: Not all terminals clear scrollback; for maximum privacy close your terminal or run with SN_WIPE_AGGRESSIVE=1."
 		warn := lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Bold(true).Render("Important: If you forget your passphrase, your note is permanently unrecoverable.")
+		if a.serverAbout != "" {
+			title := lipgloss.NewStyle().Bold(true).Render("About " + a.serverBrand)
+			body += "\n\n" + title + "\n" + a.serverAbout
+		}
 		modalBorder := lipgloss.NewStyle().BorderStyle(lipgloss.RoundedBorder()).Padding(1, 2)
 		modal := modalBorder.Render(header+"\n"+sub+"\n\n"+body+"\n\n"+warn+"\n\nPress ? or Esc to close")
 		return base + "\n" + modal
 	}
 	if a.prompting {
 		modalBorder := lipgloss.NewStyle().BorderStyle(lipgloss.RoundedBorder()).Padding(1, 2)
-		title := lipgloss.NewStyle().Bold(true).Render("Change passphrase")
+		heading := "Change passphrase"
+		if a.promptTab {
+			heading = "Open a note in a new tab"
+		}
+		title := lipgloss.NewStyle().Bold(true).Render(heading)
 		prompt := "New passphrase: " + a.pin.View() + "\nPress Enter to load, Esc to cancel"
 		warn := lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Bold(true).Render("No recovery: If you forget your passphrase, nobody can recover your note.")
 		modal := modalBorder.Render(title+"\n"+prompt+"\n\n"+warn)
@@ -268,25 +408,105 @@ func (a *EditorApp) View() string {
 
 // Messages and commands
 
-type loadedMsg struct{ note *api.Note; err error }
-type savedMsg struct{ note *api.Note; err error }
-type autoSaveMsg struct{ seq int }
+type loadedMsg struct{ tab *noteTab; note *api.Note; err error }
+type savedMsg struct{ tab *noteTab; text string; note *api.Note; err error }
+type autoSaveMsg struct{ tab *noteTab; seq int }
+type lockMsg struct{ tab *noteTab; gen int; err error }
+type lockTickMsg struct{ tab *noteTab; gen int }
+type clockTickMsg struct{}
+type strengthMsg struct{ tab *noteTab; gen int; strength *api.PhraseStrength; err error }
+
+// SetServerAbout adds the server operator's about text to the about screen.
+// Control characters are dropped so a server can't send terminal escapes.
+func (a *EditorApp) SetServerAbout(name, about string) {
+	a.serverBrand = stripControl(name)
+	a.serverAbout = stripControl(about)
+}
+
+// stripControl removes control characters other than newlines
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r != '\n' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func clockTickCmd() tea.Cmd {
+	return tea.Tick(clockRefresh, func(time.Time) tea.Msg { return clockTickMsg{} })
+}
+
+// setNoteInfo records the note's title and timestamps for the status bar
+func (t *noteTab) setNoteInfo(note *api.Note) {
+	if note == nil {
+		return
+	}
+	t.noteTitle = note.Title
+	t.noteCreated = t.client.ServerToLocal(note.Created)
+	t.noteUpdated = t.client.ServerToLocal(note.Updated)
+	t.readOnly = note.ReadOnly
+	t.noteDestroy = time.Time{}
+	if note.DestroyAt != nil {
+		t.noteDestroy = t.client.ServerToLocal(*note.DestroyAt)
+	}
+}
+
+func (t *noteTab) loadNoteCmd() tea.Cmd {
+	pass := append([]byte(nil), t.pass...)
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+		note, err := t.client.GetOrCreateNote(ctx, pass)
+		for i := range pass { pass[i] = 0 }
+		return loadedMsg{tab: t, note: note, err: err}
+	}
+}
 
-func (a *EditorApp) loadNoteCmd() tea.Cmd {
+func (t *noteTab) saveCmd() tea.Cmd {
+	content := t.ta.Value()
+	pass := append([]byte(nil), t.pass...)
 	return func() tea.Msg {
 		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
 		defer cancel()
-		note, err := a.client.GetOrCreateNote(ctx, a.pass)
-		return loadedMsg{note: note, err: err}
+		note, err := t.client.UpdateNote(ctx, pass, content)
+		for i := range pass { pass[i] = 0 }
+		return savedMsg{tab: t, text: content, note: note, err: err}
+	}
+}
+func (t *noteTab) acquireLockCmd() tea.Cmd {
+	gen := t.lockGen
+	pass := append([]byte(nil), t.pass...)
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+		_, err := t.client.AcquireLock(ctx, pass, t.sessionID)
+		for i := range pass { pass[i] = 0 }
+		return lockMsg{tab: t, gen: gen, err: err}
 	}
 }
 
-func (a *EditorApp) saveCmd() tea.Cmd {
-	content := a.ta.Value()
+// checkStrengthCmd asks the server to rate the current passphrase; servers
+// without the endpoint answer with an error, which is ignored
+func (t *noteTab) checkStrengthCmd() tea.Cmd {
+	gen := t.lockGen
+	pass := append([]byte(nil), t.pass...)
 	return func() tea.Msg {
 		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
 		defer cancel()
-		note, err := a.client.UpdateNote(ctx, a.pass, content)
-		return savedMsg{note: note, err: err}
+		strength, err := t.client.PhraseStrength(ctx, pass)
+		for i := range pass { pass[i] = 0 }
+		return strengthMsg{tab: t, gen: gen, strength: strength, err: err}
 	}
-}
\ No newline at end of file
+}
+
+func (t *noteTab) releaseLockCmd() tea.Cmd {
+	pass := append([]byte(nil), t.pass...)
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+		_ = t.client.ReleaseLock(ctx, pass, t.sessionID)
+		for i := range pass { pass[i] = 0 }
+		return nil
+	}
+}
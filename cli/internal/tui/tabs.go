@@ -0,0 +1,176 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textarea"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/ktappdev/secretnotes-go-backend/cli/internal/api"
+)
+
+// maxTabs caps the open notes; each keeps its passphrase in memory and its
+// editing lock renewed
+const maxTabs = 9
+
+// noteTab is one open note with its own passphrase, buffer, autosave and
+// editing lock, so notes in other tabs keep saving while you look elsewhere
+type noteTab struct {
+	client *api.Client
+	pass   []byte
+
+	ta        textarea.Model
+	status    string
+	lastSaved time.Time
+	savedText string // the note as last loaded or saved, to spot unsaved edits
+	autosave  bool
+	seq       int // debounce sequence
+
+	// connectivity
+	connected bool
+
+	// advisory editing lock
+	sessionID     string
+	lockGen       int // bumped on passphrase change so stale lock replies are ignored
+	lockedByOther bool
+	lockExpires   time.Time
+	confirmSave   bool // first Ctrl+S while locked asks for confirmation
+	forceSave     bool // user chose to write despite the other editor
+	confirmClose  bool // first Alt+W with unsaved edits asks for confirmation
+
+	// data
+	loaded      bool
+	initialErr  error
+	noteTitle   string
+	noteCreated time.Time // local clock; zero until the note has loaded
+	noteUpdated time.Time
+	noteDestroy time.Time // local clock; zero unless a deletion is scheduled
+	readOnly    bool      // the server refuses edits until the note is unlocked
+}
+
+func newNoteTab(client *api.Client, passphrase []byte, autosave bool) *noteTab {
+	ta := textarea.New()
+	ta.Placeholder = "Loading note..."
+	// reasonable sizes; Bubble Tea will reflow in terminal
+	ta.SetWidth(100)
+	ta.SetHeight(24)
+
+	return &noteTab{
+		client:    client,
+		pass:      passphrase,
+		ta:        ta,
+		autosave:  autosave,
+		sessionID: newSessionID(),
+	}
+}
+
+// start loads the tab's note and takes its editing lock
+func (t *noteTab) start() tea.Cmd {
+	return tea.Batch(t.loadNoteCmd(), t.acquireLockCmd())
+}
+
+// unsaved reports whether the buffer differs from the note as last loaded or saved
+func (t *noteTab) unsaved() bool {
+	return t.loaded && t.ta.Value() != t.savedText
+}
+
+// label is the tab's name in the tab bar: its title, else its position
+func (t *noteTab) label(i int) string {
+	name := fmt.Sprintf("Note %d", i+1)
+	if t.noteTitle != "" {
+		name = t.noteTitle
+		if r := []rune(name); len(r) > 20 {
+			name = string(r[:19]) + "…"
+		}
+	}
+	if t.unsaved() {
+		name += " *"
+	}
+	return fmt.Sprintf("%d %s", i+1, name)
+}
+
+// openTab adds a tab for passphrase and switches to it
+func (a *EditorApp) openTab(passphrase []byte) tea.Cmd {
+	if len(a.tabs) >= maxTabs {
+		a.status = fmt.Sprintf("At most %d notes can be open; close one with Alt+W", maxTabs)
+		return nil
+	}
+	t := newNoteTab(a.client, passphrase, a.autosave)
+	a.tabs = append(a.tabs, t)
+	a.switchTab(len(a.tabs) - 1)
+	return t.start()
+}
+
+// closeTab closes the active tab and releases its lock. The last tab stays
+// open; Ctrl+Q quits instead.
+func (a *EditorApp) closeTab() tea.Cmd {
+	if len(a.tabs) == 1 {
+		a.status = "This is the only open note (Ctrl+Q to quit)"
+		return nil
+	}
+	if a.unsaved() && !a.confirmClose {
+		a.confirmClose = true
+		a.status = "Unsaved changes — press Alt+W again to close anyway"
+		return nil
+	}
+	closed := a.noteTab
+	release := closed.releaseLockCmd()
+	closed.lockGen++ // stop its heartbeat
+	for i := range closed.pass {
+		closed.pass[i] = 0
+	}
+
+	i := a.tabIndex(closed)
+	a.tabs = append(a.tabs[:i], a.tabs[i+1:]...)
+	if i == len(a.tabs) {
+		i--
+	}
+	a.switchTab(i)
+	return release
+}
+
+// switchTab makes tab i the active one
+func (a *EditorApp) switchTab(i int) {
+	if i < 0 || i >= len(a.tabs) {
+		return
+	}
+	if a.noteTab != nil {
+		a.ta.Blur()
+		a.confirmClose = false
+	}
+	a.active = i
+	a.noteTab = a.tabs[i]
+	a.ta.Focus()
+}
+
+// tabIndex returns the position of t, or -1 once it has been closed
+func (a *EditorApp) tabIndex(t *noteTab) int {
+	for i, open := range a.tabs {
+		if open == t {
+			return i
+		}
+	}
+	return -1
+}
+
+// tabBar lists the open notes, highlighting the active one. A single note
+// gets no tab bar.
+func (a *EditorApp) tabBar() string {
+	if len(a.tabs) < 2 {
+		return ""
+	}
+	active := lipgloss.NewStyle().Bold(true).Reverse(true).Padding(0, 1)
+	inactive := lipgloss.NewStyle().Faint(true).Padding(0, 1)
+	labels := make([]string, len(a.tabs))
+	for i, t := range a.tabs {
+		style := inactive
+		if i == a.active {
+			style = active
+		}
+		labels[i] = style.Render(stripControl(t.label(i)))
+	}
+	return strings.Join(labels, " ")
+}
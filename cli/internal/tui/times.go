@@ -0,0 +1,78 @@
+package tui
+
+import (
+	"fmt"
+	"time"
+)
+
+// NoteTimes describes when a note was created and last saved, e.g.
+// "created 1 May 2024 09:30, last saved 14:02 (5m ago)". Times are shown in
+// the local timezone; dates are left out for times earlier today.
+func NoteTimes(created, updated, now time.Time) string {
+	if created.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("created %s, last saved %s (%s)", shortTime(created, now), shortTime(updated, now), ago(updated, now))
+}
+
+// DestroyWarning describes a pending scheduled deletion, e.g. "self-destructs
+// 18:30 (in 2h)", or returns "" when none is scheduled
+func DestroyWarning(at, now time.Time) string {
+	if at.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("self-destructs %s (%s)", shortTime(at, now), until(at, now))
+}
+
+// AccessSummary describes how often a note was read before, e.g. "opened 3
+// times before, last 2h ago", so users notice reads that weren't theirs
+func AccessSummary(count int, last, now time.Time) string {
+	switch {
+	case count == 0 || last.IsZero():
+		return "never opened before"
+	case count == 1:
+		return fmt.Sprintf("opened once before, %s", ago(last, now))
+	}
+	return fmt.Sprintf("opened %d times before, last %s", count, ago(last, now))
+}
+
+// shortTime formats t relative to now: "15:04" today, "2 Jan 15:04" this year,
+// "2 Jan 2006 15:04" otherwise
+func shortTime(t, now time.Time) string {
+	t, now = t.Local(), now.Local()
+	switch {
+	case t.YearDay() == now.YearDay() && t.Year() == now.Year():
+		return t.Format("15:04")
+	case t.Year() == now.Year():
+		return t.Format("2 Jan 15:04")
+	}
+	return t.Format("2 Jan 2006 15:04")
+}
+
+// ago describes how long before now t was, in its largest unit
+func ago(t, now time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	}
+	return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+}
+
+// until describes how long after now t is, in its largest unit
+func until(t, now time.Time) string {
+	d := t.Sub(now)
+	switch {
+	case d < time.Minute:
+		return "in under a minute"
+	case d < time.Hour:
+		return fmt.Sprintf("in %dm", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("in %dh", int(d/time.Hour))
+	}
+	return fmt.Sprintf("in %dd", int(d/(24*time.Hour)))
+}
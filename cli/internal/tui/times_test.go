@@ -0,0 +1,60 @@
+package tui
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNoteTimes(t *testing.T) {
+	now := time.Date(2024, 5, 1, 14, 7, 0, 0, time.Local)
+	cases := []struct {
+		created, updated time.Time
+		want             string
+	}{
+		{time.Time{}, time.Time{}, ""},
+		{now.Add(-3 * time.Hour), now.Add(-20 * time.Second), "created 11:07, last saved 14:06 (just now)"},
+		{now.AddDate(0, -1, 0), now.Add(-5 * time.Minute), "created 1 Apr 14:07, last saved 14:02 (5m ago)"},
+		{now.AddDate(-1, 0, 0), now.AddDate(0, 0, -2), "created 1 May 2023 14:07, last saved 29 Apr 14:07 (2d ago)"},
+	}
+	for _, c := range cases {
+		if got := NoteTimes(c.created, c.updated, now); got != c.want {
+			t.Errorf("NoteTimes(%v, %v) = %q, want %q", c.created, c.updated, got, c.want)
+		}
+	}
+}
+
+func TestDestroyWarning(t *testing.T) {
+	now := time.Date(2024, 5, 1, 14, 7, 0, 0, time.Local)
+	cases := []struct {
+		at   time.Time
+		want string
+	}{
+		{time.Time{}, ""},
+		{now.Add(20 * time.Second), "self-destructs 14:07 (in under a minute)"},
+		{now.Add(4 * time.Hour), "self-destructs 18:07 (in 4h)"},
+		{now.AddDate(0, 0, 3), "self-destructs 4 May 14:07 (in 3d)"},
+	}
+	for _, c := range cases {
+		if got := DestroyWarning(c.at, now); got != c.want {
+			t.Errorf("DestroyWarning(%v) = %q, want %q", c.at, got, c.want)
+		}
+	}
+}
+
+func TestAccessSummary(t *testing.T) {
+	now := time.Date(2024, 5, 1, 14, 7, 0, 0, time.Local)
+	cases := []struct {
+		count int
+		last  time.Time
+		want  string
+	}{
+		{0, time.Time{}, "never opened before"},
+		{1, now.Add(-10 * time.Second), "opened once before, just now"},
+		{12, now.Add(-3 * time.Hour), "opened 12 times before, last 3h ago"},
+	}
+	for _, c := range cases {
+		if got := AccessSummary(c.count, c.last, now); got != c.want {
+			t.Errorf("AccessSummary(%d, %v) = %q, want %q", c.count, c.last, got, c.want)
+		}
+	}
+}
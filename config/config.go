@@ -0,0 +1,1101 @@
+// Package config loads server settings from SECRETNOTES_* environment variables.
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds operator-tunable server settings
+type Config struct {
+	Limits    LimitsConfig
+	Paste     PasteConfig
+	Blobs     BlobConfig
+	RateLimit RateLimitConfig
+	SMTP      SMTPConfig
+	Abuse     AbuseConfig
+	Compress  CompressionConfig
+
+	Idempotency IdempotencyConfig
+	Sessions    SessionConfig
+	Stats       StatsConfig
+	Deletion    DeletionConfig
+	Retention   RetentionConfig
+	Auth        AuthConfig
+	Branding    BrandingConfig
+	Webhooks    WebhookConfig
+	Resources   ResourceConfig
+	Encryption  EncryptionConfig
+	Scan        ScanConfig
+	Archives    ArchiveConfig
+	S3          S3Config
+
+	// NotificationKey is a server-held secret used to encrypt notification
+	// targets (e.g. digest email addresses) that must be readable without the
+	// note's passphrase. Notification features are disabled when it is empty.
+	NotificationKey string
+
+	// DataDir holds the SQLite databases and, unless S3 is configured, the
+	// encrypted files. Empty means PocketBase's default, pb_data next to the
+	// executable; PocketBase's --dir flag still overrides either.
+	DataDir string
+
+	// ShredFiles overwrites deleted and replaced attachment files before
+	// PocketBase removes them from disk, and removes every stored version
+	// of them from a versioned S3 bucket
+	ShredFiles bool
+
+	// LogRequests prints one line per API request (route, status, duration)
+	LogRequests bool
+}
+
+// Profiles lists the supported values of SECRETNOTES_PROFILE
+var Profiles = []string{"default", "low-memory"}
+
+// ResourceConfig bounds the server's own memory use. The "low-memory"
+// profile tightens these and a few other defaults for small hosts (256 MB
+// VPS, Raspberry Pi); individual settings still override the profile.
+type ResourceConfig struct {
+	Profile         string // "default" or "low-memory"
+	KDFConcurrency  int    // Passphrase key derivations run at once; 0 means unlimited
+	ChunkWorkers    int    // Chunks of one attachment encrypted or decrypted at once; 0 means one per CPU
+	MultipartMemory int64  // Bytes of a multipart upload parsed in memory; the rest spills to temp files
+	DBMaxOpenConns  int    // SQLite connections; 0 keeps PocketBase's default
+	DBMaxIdleConns  int    // Idle SQLite connections (each keeps its own page cache); 0 keeps PocketBase's default
+	MemoryLimit     int64  // Soft Go heap limit in bytes, unless GOMEMLIMIT is set; 0 means none
+}
+
+// CipherChoices lists the supported values of SECRETNOTES_CIPHER
+var CipherChoices = []string{"auto", "aes-256-gcm", "chacha20-poly1305"}
+
+// ChunkCipherChoices lists the supported values of SECRETNOTES_CHUNK_CIPHER
+var ChunkCipherChoices = []string{"auto", "aes-256-gcm", "chacha20-poly1305", "aes-256-gcm-siv"}
+
+// KDFChoices lists the supported values of SECRETNOTES_KDF
+var KDFChoices = []string{"pbkdf2-sha256", "scrypt"}
+
+// Bounds of the PBKDF2 iteration count and salt length. Servers refuse to
+// decrypt envelopes asking for more iterations, so the limit matches theirs.
+const (
+	MinPBKDF2Iterations = 1000
+	MaxPBKDF2Iterations = 10_000_000
+	MinSaltSize         = 8
+	MaxSaltSize         = 64
+)
+
+// EncryptionConfig selects the cipher and key derivation for new encryptions.
+// Data written with any of them stays readable whatever is chosen, since each
+// ciphertext records its own.
+type EncryptionConfig struct {
+	Cipher           string // "auto" (AES-GCM with AES hardware, ChaCha20-Poly1305 without), or a fixed cipher
+	KDF              string // "pbkdf2-sha256" or "scrypt"
+	PBKDF2Iterations int    // PBKDF2 cost
+	SaltSize         int    // Salt length in bytes
+	ChunkThreshold   int64  // Attachments larger than this many bytes are encrypted in streamable chunks (audio always is)
+	ChunkCipher      string // "auto" (the same as Cipher), or a fixed cipher for chunked attachments
+
+	KeyCacheSize int           // Derived keys kept in memory so repeated reads skip the KDF; 0 disables the cache
+	KeyCacheTTL  time.Duration // How long a cached key is kept
+
+	Peppers  map[byte][]byte // Server secrets mixed into stored fields' keys, by id; none by default
+	PepperID byte            // Id of the pepper new encryptions use, 0 when there are none
+
+	KMSCommand []string      // Plugin command that wraps data keys with a KMS or HSM; none by default
+	KMSTimeout time.Duration // How long a KMS call may take
+
+	ServerLayerKeys  map[byte][]byte // Server keys stored data is sealed in again after the passphrase, by id; none by default
+	ServerLayerKeyID byte            // Id of the server layer key new encryptions use, 0 when there are none
+
+	FIPS bool // Only FIPS-approved algorithms and parameters; always on in builds tagged fips
+
+	Compression      bool // zstd-compress note messages before encrypting them
+	CompressMinBytes int  // Smallest note message compressed
+}
+
+// LimitsConfig caps request payload sizes
+type LimitsConfig struct {
+	MaxNoteBytes       int64    // Maximum note message size in bytes
+	MaxUploadBytes     int64    // Maximum uploaded file size in bytes
+	MaxAttachmentBytes int64    // Maximum total attachment size per passphrase in bytes
+	MaxAttachments     int      // Maximum number of attachments per passphrase
+	UploadTypes        []string // Content types uploads may have, like image/* or application/pdf; empty allows any
+}
+
+// PasteConfig controls the optional public paste feature
+type PasteConfig struct {
+	Enabled       bool          // Register the /paste routes (off by default)
+	MaxBytes      int           // Maximum paste size in bytes
+	TTL           time.Duration // Maximum (and default) lifetime of a paste
+	RatePerMinute int           // Requests per minute allowed per client IP
+}
+
+// BlobConfig controls the optional opaque blob mode, where clients encrypt
+// locally and the server stores ciphertext it can't read
+type BlobConfig struct {
+	Enabled bool // Register the /blobs routes (off by default)
+}
+
+// RateLimitConfig controls throttling of the /api/secretnotes routes
+type RateLimitConfig struct {
+	Enabled         bool // Apply the per-IP and per-phrase limiters
+	IPPerMinute     int  // Requests per minute allowed per client IP
+	PhrasePerMinute int  // Requests per minute allowed per passphrase hash
+	Burst           int  // Requests allowed in a quick burst before throttling
+}
+
+// AbuseConfig controls progressive bans for clients that look like they are
+// guessing passphrases
+type AbuseConfig struct {
+	Enabled     bool          // Track clients and ban offenders
+	MaxMisses   int           // Distinct passphrases finding no note or attachment allowed per window
+	MaxFailures int           // Wrong passphrases for existing data allowed per window
+	Window      time.Duration // Observation window
+	BaseBan     time.Duration // First ban length; doubles with every strike
+	MaxBan      time.Duration // Upper bound for a single ban
+}
+
+// CompressionConfig controls gzip/brotli response compression. Routes are
+// grouped into classes ("public", "metadata", "secret"); responses carrying
+// decrypted content ("secret") are not compressed by default because the
+// compressed size can leak secrets (BREACH).
+type CompressionConfig struct {
+	Enabled  bool     // Compress responses at all
+	Classes  []string // Route classes whose responses are compressed
+	MinBytes int      // Smaller responses are sent uncompressed
+}
+
+// IdempotencyConfig controls replay of mutating requests that carry an
+// Idempotency-Key header
+type IdempotencyConfig struct {
+	Enabled    bool          // Honour Idempotency-Key headers
+	TTL        time.Duration // How long responses are kept for replay
+	MaxEntries int           // Keys remembered at once; requests beyond this run without replay protection
+}
+
+// SessionConfig controls access tokens that stand in for the passphrase
+// (POST /auth/token), renewed by challenge-response
+type SessionConfig struct {
+	Enabled     bool          // Serve the /auth routes and accept X-Access-Token
+	TokenTTL    time.Duration // How long a token works before it must be renewed
+	MaxAge      time.Duration // How long a session can be renewed before the passphrase is needed again
+	MaxSessions int           // Sessions open at once; more are refused until some end
+}
+
+// CompressionClasses lists the route classes known to the compression middleware
+var CompressionClasses = []string{"public", "metadata", "secret"}
+
+// StatsConfig controls the optional public /stats endpoint
+type StatsConfig struct {
+	Enabled bool          // Register /stats (off by default)
+	Refresh time.Duration // How long one noisy snapshot is served before a new one is drawn
+}
+
+// DeletionConfig controls the trash that deleted notes wait in before they are
+// purged for good
+type DeletionConfig struct {
+	Grace time.Duration // How long a deleted note can be restored with /notes/undelete
+}
+
+// RetentionConfig is the server-wide attachment retention rule. It applies to
+// every note, on top of any rule a note sets for itself; zero values mean no
+// limit.
+type RetentionConfig struct {
+	MaxAge time.Duration // Attachments uploaded longer ago than this are purged
+	Keep   int           // Only each note's newest this many attachments are kept
+}
+
+// WebhookConfig controls outgoing note webhooks (enabled together with the
+// other notification features by SECRETNOTES_NOTIFICATION_KEY)
+type WebhookConfig struct {
+	AllowPrivate bool          // Allow plain http and private/loopback targets (for testing and internal automation)
+	MinInterval  time.Duration // Pings of the same kind for one note are sent at most this often
+	Timeout      time.Duration // Per-delivery timeout
+}
+
+// ScanConfig controls the optional malware scan of uploads, done by a ClamAV
+// daemon before anything is encrypted
+type ScanConfig struct {
+	ClamdAddress string        // tcp://host:port or unix:///path/to/clamd.sock; scanning is off when empty
+	Timeout      time.Duration // For one scan, connecting included
+	FailOpen     bool          // Accept uploads when clamd can't be reached instead of refusing them
+}
+
+// ArchiveConfig controls the signing of export archives and which signed
+// archives imports accept
+type ArchiveConfig struct {
+	SigningKey    []byte   // Ed25519 seed export manifests are signed with; exports are unsigned without one
+	TrustedKeys   [][]byte // Ed25519 public keys of other servers whose signatures imports accept
+	RequireSigned bool     // Refuse imports not signed by this server or a trusted key
+}
+
+// BrandingConfig lets white-labeled deployments rename the service without
+// code changes. Clients fetch it from GET /api/secretnotes/about.
+type BrandingConfig struct {
+	Name          string // Service name in the about document and emails
+	HealthMessage string // Message of the health check (GET /api/secretnotes/)
+	About         string // Free text shown in the CLI's about screen
+
+	// Share-page branding, passed through to web clients as-is
+	LogoURL     string
+	AccentColor string // #rgb or #rrggbb
+	Footer      string
+}
+
+// AuthModes lists the supported values of SECRETNOTES_AUTH_MODE
+var AuthModes = []string{"none", "token", "basic", "oidc"}
+
+// AuthConfig controls the optional authentication layer for private
+// deployments. It is checked before the passphrase and does not replace it.
+type AuthConfig struct {
+	Mode string // "none" (default), "token", "basic" or "oidc"
+
+	Tokens     []string // Accepted bearer tokens (token mode)
+	BasicUsers []string // "user:bcrypt-hash" entries (basic mode)
+
+	IntrospectionURL string        // RFC 7662 token introspection endpoint (oidc mode)
+	ClientID         string        // Client credentials for the introspection endpoint
+	ClientSecret     string        //
+	CacheTTL         time.Duration // How long an accepted token is trusted before it is checked again
+}
+
+// SMTPConfig overrides PocketBase's mail settings. When Host is empty the
+// settings from the PocketBase admin UI are used unchanged.
+type SMTPConfig struct {
+	Host        string
+	Port        int
+	Username    string
+	Password    string
+	TLS         bool
+	FromAddress string
+	FromName    string
+}
+
+// S3Config moves PocketBase's file storage, and with it every encrypted
+// attachment, from pb_data/storage to an S3-compatible bucket (AWS S3, MinIO,
+// R2 and the like). When Bucket is empty the storage settings from the
+// PocketBase admin UI are used unchanged.
+type S3Config struct {
+	Bucket         string
+	Region         string
+	Endpoint       string // https://s3.<region>.amazonaws.com, or the MinIO/R2 URL
+	AccessKey      string
+	Secret         string
+	ForcePathStyle bool // Address the bucket as <endpoint>/<bucket>, as MinIO needs
+}
+
+// Default returns the settings used when no environment overrides are present
+func Default() Config {
+	return Config{
+		Limits: LimitsConfig{
+			MaxNoteBytes:       1 << 20,  // 1 MB
+			MaxUploadBytes:     10 << 20, // 10 MB
+			MaxAttachmentBytes: 50 << 20, // 50 MB
+			MaxAttachments:     20,
+		},
+		Paste: PasteConfig{
+			Enabled:       false,
+			MaxBytes:      64 << 10, // 64 KB
+			TTL:           24 * time.Hour,
+			RatePerMinute: 10,
+		},
+		Blobs: BlobConfig{
+			Enabled: false,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:         true,
+			IPPerMinute:     120,
+			PhrasePerMinute: 60,
+			Burst:           20,
+		},
+		SMTP: SMTPConfig{
+			Port:     587,
+			FromName: "Secret Notes",
+		},
+		S3: S3Config{
+			Region: "us-east-1",
+		},
+		Abuse: AbuseConfig{
+			Enabled:     true,
+			MaxMisses:   20,
+			MaxFailures: 5,
+			Window:      10 * time.Minute,
+			BaseBan:     time.Minute,
+			MaxBan:      24 * time.Hour,
+		},
+		Compress: CompressionConfig{
+			Enabled:  true,
+			Classes:  []string{"public", "metadata"},
+			MinBytes: 1024,
+		},
+		Idempotency: IdempotencyConfig{
+			Enabled:    true,
+			TTL:        10 * time.Minute,
+			MaxEntries: 10000,
+		},
+		Sessions: SessionConfig{
+			Enabled:     true,
+			TokenTTL:    5 * time.Minute,
+			MaxAge:      12 * time.Hour,
+			MaxSessions: 10000,
+		},
+		Stats: StatsConfig{
+			Enabled: false,
+			Refresh: time.Hour,
+		},
+		Deletion: DeletionConfig{
+			Grace: 7 * 24 * time.Hour,
+		},
+		Auth: AuthConfig{
+			Mode:     "none",
+			CacheTTL: time.Minute,
+		},
+		Webhooks: WebhookConfig{
+			MinInterval: 10 * time.Second,
+			Timeout:     5 * time.Second,
+		},
+		Branding: BrandingConfig{
+			Name:          "Secret Notes",
+			HealthMessage: "Secret Notes API is live",
+		},
+		Encryption: EncryptionConfig{
+			Cipher:           "auto",
+			ChunkCipher:      "auto",
+			KDF:              "pbkdf2-sha256",
+			PBKDF2Iterations: 10000,
+			SaltSize:         16,
+			ChunkThreshold:   1 << 20, // 1 MB
+			KeyCacheTTL:      5 * time.Minute,
+			KMSTimeout:       10 * time.Second,
+			FIPS:             fipsBuild,
+			Compression:      true,
+			CompressMinBytes: 4 << 10, // 4 KB
+		},
+		Scan: ScanConfig{
+			Timeout: 30 * time.Second,
+		},
+		Resources: ResourceConfig{
+			Profile:         "default",
+			MultipartMemory: 10 << 20, // 10 MB
+		},
+		ShredFiles: true,
+	}
+}
+
+// applyLowMemory trades throughput and retry safety for a small, steady
+// footprint: uploads are capped lower and spill to disk early, smaller
+// attachments are encrypted in chunks so downloads don't decrypt them whole and
+// one chunk at a time, key derivations queue instead of piling up, the in-memory idempotency cache is
+// off (it also keeps upload bodies buffered for fingerprinting), fewer
+// access-token sessions are held and SQLite keeps few connections and page
+// caches around.
+func applyLowMemory(cfg *Config) {
+	cfg.Resources.Profile = "low-memory"
+	cfg.Resources.KDFConcurrency = 2
+	cfg.Resources.ChunkWorkers = 1
+	cfg.Resources.MultipartMemory = 256 << 10 // 256 KB
+	cfg.Resources.DBMaxOpenConns = 8
+	cfg.Resources.DBMaxIdleConns = 2
+	cfg.Resources.MemoryLimit = 160 << 20 // 160 MB
+
+	cfg.Limits.MaxUploadBytes = 4 << 20       // 4 MB
+	cfg.Encryption.ChunkThreshold = 256 << 10 // 256 KB
+	cfg.Idempotency.Enabled = false
+	cfg.Idempotency.MaxEntries = 500
+	cfg.Sessions.MaxSessions = 1000
+}
+
+// Load reads settings from the environment on top of Default
+func Load() (*Config, error) {
+	cfg := Default()
+	var err error
+
+	// The profile only changes defaults, so it is applied before anything else
+	profile := strings.ToLower(envString("SECRETNOTES_PROFILE", cfg.Resources.Profile))
+	switch profile {
+	case "default":
+	case "low-memory":
+		applyLowMemory(&cfg)
+	default:
+		return nil, fmt.Errorf("SECRETNOTES_PROFILE: unknown value %q (expected one of %s)", profile, strings.Join(Profiles, ", "))
+	}
+
+	if cfg.Limits.MaxNoteBytes, err = envInt64("SECRETNOTES_MAX_NOTE_BYTES", cfg.Limits.MaxNoteBytes); err != nil {
+		return nil, err
+	}
+	if cfg.Limits.MaxUploadBytes, err = envInt64("SECRETNOTES_MAX_UPLOAD_BYTES", cfg.Limits.MaxUploadBytes); err != nil {
+		return nil, err
+	}
+	if cfg.Limits.MaxAttachmentBytes, err = envInt64("SECRETNOTES_MAX_ATTACHMENT_BYTES", cfg.Limits.MaxAttachmentBytes); err != nil {
+		return nil, err
+	}
+	if cfg.Limits.MaxAttachments, err = envInt("SECRETNOTES_MAX_ATTACHMENTS", cfg.Limits.MaxAttachments); err != nil {
+		return nil, err
+	}
+	if cfg.Limits.UploadTypes, err = envContentTypes("SECRETNOTES_UPLOAD_TYPES"); err != nil {
+		return nil, err
+	}
+
+	if cfg.Paste.Enabled, err = envBool("SECRETNOTES_PASTE_ENABLED", cfg.Paste.Enabled); err != nil {
+		return nil, err
+	}
+	if cfg.Paste.MaxBytes, err = envInt("SECRETNOTES_PASTE_MAX_BYTES", cfg.Paste.MaxBytes); err != nil {
+		return nil, err
+	}
+	if cfg.Paste.TTL, err = envDuration("SECRETNOTES_PASTE_TTL", cfg.Paste.TTL); err != nil {
+		return nil, err
+	}
+	if cfg.Paste.RatePerMinute, err = envInt("SECRETNOTES_PASTE_RATE_PER_MINUTE", cfg.Paste.RatePerMinute); err != nil {
+		return nil, err
+	}
+
+	if cfg.Blobs.Enabled, err = envBool("SECRETNOTES_BLOBS_ENABLED", cfg.Blobs.Enabled); err != nil {
+		return nil, err
+	}
+
+	if cfg.RateLimit.Enabled, err = envBool("SECRETNOTES_RATE_LIMIT_ENABLED", cfg.RateLimit.Enabled); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimit.IPPerMinute, err = envInt("SECRETNOTES_RATE_LIMIT_IP_PER_MINUTE", cfg.RateLimit.IPPerMinute); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimit.PhrasePerMinute, err = envInt("SECRETNOTES_RATE_LIMIT_PHRASE_PER_MINUTE", cfg.RateLimit.PhrasePerMinute); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimit.Burst, err = envInt("SECRETNOTES_RATE_LIMIT_BURST", cfg.RateLimit.Burst); err != nil {
+		return nil, err
+	}
+
+	cfg.SMTP.Host = envString("SECRETNOTES_SMTP_HOST", cfg.SMTP.Host)
+	if cfg.SMTP.Port, err = envInt("SECRETNOTES_SMTP_PORT", cfg.SMTP.Port); err != nil {
+		return nil, err
+	}
+	cfg.SMTP.Username = envString("SECRETNOTES_SMTP_USERNAME", cfg.SMTP.Username)
+	cfg.SMTP.Password = envString("SECRETNOTES_SMTP_PASSWORD", cfg.SMTP.Password)
+	if cfg.SMTP.TLS, err = envBool("SECRETNOTES_SMTP_TLS", cfg.SMTP.TLS); err != nil {
+		return nil, err
+	}
+	cfg.SMTP.FromAddress = envString("SECRETNOTES_SMTP_FROM", cfg.SMTP.FromAddress)
+	if err := loadBranding(&cfg.Branding); err != nil {
+		return nil, err
+	}
+	// Mail goes out under the brand unless a sender name is set explicitly
+	cfg.SMTP.FromName = envString("SECRETNOTES_SMTP_FROM_NAME", cfg.Branding.Name)
+
+	if cfg.Abuse.Enabled, err = envBool("SECRETNOTES_ABUSE_ENABLED", cfg.Abuse.Enabled); err != nil {
+		return nil, err
+	}
+	if cfg.Abuse.MaxMisses, err = envInt("SECRETNOTES_ABUSE_MAX_MISSES", cfg.Abuse.MaxMisses); err != nil {
+		return nil, err
+	}
+	if cfg.Abuse.MaxFailures, err = envInt("SECRETNOTES_ABUSE_MAX_FAILURES", cfg.Abuse.MaxFailures); err != nil {
+		return nil, err
+	}
+	if cfg.Abuse.Window, err = envDuration("SECRETNOTES_ABUSE_WINDOW", cfg.Abuse.Window); err != nil {
+		return nil, err
+	}
+	if cfg.Abuse.BaseBan, err = envDuration("SECRETNOTES_ABUSE_BASE_BAN", cfg.Abuse.BaseBan); err != nil {
+		return nil, err
+	}
+	if cfg.Abuse.MaxBan, err = envDuration("SECRETNOTES_ABUSE_MAX_BAN", cfg.Abuse.MaxBan); err != nil {
+		return nil, err
+	}
+
+	if cfg.Compress.Enabled, err = envBool("SECRETNOTES_COMPRESSION_ENABLED", cfg.Compress.Enabled); err != nil {
+		return nil, err
+	}
+	if cfg.Compress.Classes, err = envList("SECRETNOTES_COMPRESSION_CLASSES", cfg.Compress.Classes, CompressionClasses); err != nil {
+		return nil, err
+	}
+	if cfg.Compress.MinBytes, err = envInt("SECRETNOTES_COMPRESSION_MIN_BYTES", cfg.Compress.MinBytes); err != nil {
+		return nil, err
+	}
+
+	if cfg.Idempotency.Enabled, err = envBool("SECRETNOTES_IDEMPOTENCY_ENABLED", cfg.Idempotency.Enabled); err != nil {
+		return nil, err
+	}
+	if cfg.Idempotency.TTL, err = envDuration("SECRETNOTES_IDEMPOTENCY_TTL", cfg.Idempotency.TTL); err != nil {
+		return nil, err
+	}
+	if cfg.Idempotency.MaxEntries, err = envInt("SECRETNOTES_IDEMPOTENCY_MAX_ENTRIES", cfg.Idempotency.MaxEntries); err != nil {
+		return nil, err
+	}
+
+	if cfg.Sessions.Enabled, err = envBool("SECRETNOTES_SESSIONS_ENABLED", cfg.Sessions.Enabled); err != nil {
+		return nil, err
+	}
+	if cfg.Sessions.TokenTTL, err = envDuration("SECRETNOTES_SESSION_TOKEN_TTL", cfg.Sessions.TokenTTL); err != nil {
+		return nil, err
+	}
+	if cfg.Sessions.MaxAge, err = envDuration("SECRETNOTES_SESSION_MAX_AGE", cfg.Sessions.MaxAge); err != nil {
+		return nil, err
+	}
+	if cfg.Sessions.MaxSessions, err = envInt("SECRETNOTES_SESSION_MAX", cfg.Sessions.MaxSessions); err != nil {
+		return nil, err
+	}
+
+	if cfg.Stats.Enabled, err = envBool("SECRETNOTES_STATS_ENABLED", cfg.Stats.Enabled); err != nil {
+		return nil, err
+	}
+	if cfg.Stats.Refresh, err = envDuration("SECRETNOTES_STATS_REFRESH", cfg.Stats.Refresh); err != nil {
+		return nil, err
+	}
+
+	if cfg.Deletion.Grace, err = envDuration("SECRETNOTES_DELETE_GRACE", cfg.Deletion.Grace); err != nil {
+		return nil, err
+	}
+
+	if cfg.Retention.MaxAge, err = envDuration("SECRETNOTES_ATTACHMENT_MAX_AGE", cfg.Retention.MaxAge); err != nil {
+		return nil, err
+	}
+	if cfg.Retention.Keep, err = envInt("SECRETNOTES_ATTACHMENT_KEEP", cfg.Retention.Keep); err != nil {
+		return nil, err
+	}
+
+	if err := loadAuth(&cfg.Auth); err != nil {
+		return nil, err
+	}
+
+	if cfg.Webhooks.AllowPrivate, err = envBool("SECRETNOTES_WEBHOOK_ALLOW_PRIVATE", cfg.Webhooks.AllowPrivate); err != nil {
+		return nil, err
+	}
+	if cfg.Webhooks.MinInterval, err = envDuration("SECRETNOTES_WEBHOOK_MIN_INTERVAL", cfg.Webhooks.MinInterval); err != nil {
+		return nil, err
+	}
+	if cfg.Webhooks.Timeout, err = envDuration("SECRETNOTES_WEBHOOK_TIMEOUT", cfg.Webhooks.Timeout); err != nil {
+		return nil, err
+	}
+
+	if cfg.Resources.KDFConcurrency, err = envInt("SECRETNOTES_KDF_CONCURRENCY", cfg.Resources.KDFConcurrency); err != nil {
+		return nil, err
+	}
+	if cfg.Resources.ChunkWorkers, err = envInt("SECRETNOTES_CHUNK_WORKERS", cfg.Resources.ChunkWorkers); err != nil {
+		return nil, err
+	}
+	if cfg.Resources.MultipartMemory, err = envInt64("SECRETNOTES_MULTIPART_MEMORY_BYTES", cfg.Resources.MultipartMemory); err != nil {
+		return nil, err
+	}
+	if cfg.Resources.DBMaxOpenConns, err = envInt("SECRETNOTES_DB_MAX_OPEN_CONNS", cfg.Resources.DBMaxOpenConns); err != nil {
+		return nil, err
+	}
+	if cfg.Resources.DBMaxIdleConns, err = envInt("SECRETNOTES_DB_MAX_IDLE_CONNS", cfg.Resources.DBMaxIdleConns); err != nil {
+		return nil, err
+	}
+	if cfg.Resources.MemoryLimit, err = envInt64("SECRETNOTES_MEMORY_LIMIT_BYTES", cfg.Resources.MemoryLimit); err != nil {
+		return nil, err
+	}
+
+	cfg.Encryption.Cipher = strings.ToLower(envString("SECRETNOTES_CIPHER", cfg.Encryption.Cipher))
+	if !slices.Contains(CipherChoices, cfg.Encryption.Cipher) {
+		return nil, fmt.Errorf("SECRETNOTES_CIPHER: unknown value %q (expected one of %s)", cfg.Encryption.Cipher, strings.Join(CipherChoices, ", "))
+	}
+	cfg.Encryption.ChunkCipher = strings.ToLower(envString("SECRETNOTES_CHUNK_CIPHER", cfg.Encryption.ChunkCipher))
+	if !slices.Contains(ChunkCipherChoices, cfg.Encryption.ChunkCipher) {
+		return nil, fmt.Errorf("SECRETNOTES_CHUNK_CIPHER: unknown value %q (expected one of %s)", cfg.Encryption.ChunkCipher, strings.Join(ChunkCipherChoices, ", "))
+	}
+	cfg.Encryption.KDF = strings.ToLower(envString("SECRETNOTES_KDF", cfg.Encryption.KDF))
+	if !slices.Contains(KDFChoices, cfg.Encryption.KDF) {
+		return nil, fmt.Errorf("SECRETNOTES_KDF: unknown value %q (expected one of %s)", cfg.Encryption.KDF, strings.Join(KDFChoices, ", "))
+	}
+	if cfg.Encryption.PBKDF2Iterations, err = envInt("SECRETNOTES_PBKDF2_ITERATIONS", cfg.Encryption.PBKDF2Iterations); err != nil {
+		return nil, err
+	}
+	if cfg.Encryption.PBKDF2Iterations < MinPBKDF2Iterations || cfg.Encryption.PBKDF2Iterations > MaxPBKDF2Iterations {
+		return nil, fmt.Errorf("SECRETNOTES_PBKDF2_ITERATIONS: must be between %d and %d", MinPBKDF2Iterations, MaxPBKDF2Iterations)
+	}
+	if cfg.Encryption.SaltSize, err = envInt("SECRETNOTES_SALT_SIZE", cfg.Encryption.SaltSize); err != nil {
+		return nil, err
+	}
+	if cfg.Encryption.SaltSize < MinSaltSize || cfg.Encryption.SaltSize > MaxSaltSize {
+		return nil, fmt.Errorf("SECRETNOTES_SALT_SIZE: must be between %d and %d bytes", MinSaltSize, MaxSaltSize)
+	}
+	if cfg.Encryption.FIPS, err = envBool("SECRETNOTES_FIPS", cfg.Encryption.FIPS); err != nil {
+		return nil, err
+	}
+	if err := checkFIPS(&cfg.Encryption); err != nil {
+		return nil, err
+	}
+	if cfg.Encryption.Compression, err = envBool("SECRETNOTES_COMPRESSION", cfg.Encryption.Compression); err != nil {
+		return nil, err
+	}
+	if cfg.Encryption.CompressMinBytes, err = envInt("SECRETNOTES_COMPRESSION_MIN_BYTES", cfg.Encryption.CompressMinBytes); err != nil {
+		return nil, err
+	}
+	if cfg.Encryption.ChunkThreshold, err = envInt64("SECRETNOTES_CHUNK_THRESHOLD", cfg.Encryption.ChunkThreshold); err != nil {
+		return nil, err
+	}
+	if cfg.Encryption.KeyCacheSize, err = envInt("SECRETNOTES_KEY_CACHE_SIZE", cfg.Encryption.KeyCacheSize); err != nil {
+		return nil, err
+	}
+	if cfg.Encryption.KeyCacheTTL, err = envDuration("SECRETNOTES_KEY_CACHE_TTL", cfg.Encryption.KeyCacheTTL); err != nil {
+		return nil, err
+	}
+	if err := loadPeppers(&cfg.Encryption); err != nil {
+		return nil, err
+	}
+	if err := loadServerLayerKeys(&cfg.Encryption); err != nil {
+		return nil, err
+	}
+	cfg.Encryption.KMSCommand = strings.Fields(os.Getenv("SECRETNOTES_KMS_COMMAND"))
+	if cfg.Encryption.KMSTimeout, err = envDuration("SECRETNOTES_KMS_TIMEOUT", cfg.Encryption.KMSTimeout); err != nil {
+		return nil, err
+	}
+
+	cfg.Scan.ClamdAddress = envString("SECRETNOTES_CLAMD_ADDRESS", cfg.Scan.ClamdAddress)
+	if cfg.Scan.Timeout, err = envDuration("SECRETNOTES_SCAN_TIMEOUT", cfg.Scan.Timeout); err != nil {
+		return nil, err
+	}
+	if cfg.Scan.FailOpen, err = envBool("SECRETNOTES_SCAN_FAIL_OPEN", cfg.Scan.FailOpen); err != nil {
+		return nil, err
+	}
+
+	if err := loadArchiveKeys(&cfg.Archives); err != nil {
+		return nil, err
+	}
+	if err := loadS3(&cfg.S3); err != nil {
+		return nil, err
+	}
+
+	cfg.NotificationKey = envString("SECRETNOTES_NOTIFICATION_KEY", cfg.NotificationKey)
+
+	if cfg.DataDir = envString("SECRETNOTES_DATA_DIR", cfg.DataDir); cfg.DataDir != "" {
+		if cfg.DataDir, err = checkDataDir(cfg.DataDir); err != nil {
+			return nil, fmt.Errorf("SECRETNOTES_DATA_DIR: %w", err)
+		}
+	}
+
+	if cfg.ShredFiles, err = envBool("SECRETNOTES_SHRED_FILES", cfg.ShredFiles); err != nil {
+		return nil, err
+	}
+
+	if cfg.LogRequests, err = envBool("SECRETNOTES_LOG_REQUESTS", cfg.LogRequests); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// loadBranding reads the SECRETNOTES_BRAND_* settings. A custom name also
+// renames the default health message.
+func loadBranding(brand *BrandingConfig) error {
+	if name := envString("SECRETNOTES_BRAND_NAME", ""); name != "" {
+		brand.Name = name
+		brand.HealthMessage = name + " API is live"
+	}
+	brand.HealthMessage = envString("SECRETNOTES_HEALTH_MESSAGE", brand.HealthMessage)
+	brand.About = envString("SECRETNOTES_ABOUT_TEXT", brand.About)
+	brand.LogoURL = envString("SECRETNOTES_BRAND_LOGO_URL", brand.LogoURL)
+	brand.Footer = envString("SECRETNOTES_BRAND_FOOTER", brand.Footer)
+
+	brand.AccentColor = envString("SECRETNOTES_BRAND_ACCENT_COLOR", brand.AccentColor)
+	if brand.AccentColor != "" && !isHexColor(brand.AccentColor) {
+		return fmt.Errorf("SECRETNOTES_BRAND_ACCENT_COLOR: expected #rgb or #rrggbb, got %q", brand.AccentColor)
+	}
+	return nil
+}
+
+// isHexColor reports whether s is a CSS hex color like #0af or #00aaff
+func isHexColor(s string) bool {
+	if len(s) != 4 && len(s) != 7 || s[0] != '#' {
+		return false
+	}
+	for _, c := range strings.ToLower(s[1:]) {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// loadAuth reads the SECRETNOTES_AUTH_* settings and checks that the chosen
+// mode has what it needs
+func loadAuth(auth *AuthConfig) error {
+	mode := strings.ToLower(envString("SECRETNOTES_AUTH_MODE", auth.Mode))
+	if !slices.Contains(AuthModes, mode) {
+		return fmt.Errorf("SECRETNOTES_AUTH_MODE: unknown value %q (expected one of %s)", mode, strings.Join(AuthModes, ", "))
+	}
+	auth.Mode = mode
+
+	auth.Tokens = envValues("SECRETNOTES_AUTH_TOKENS")
+	auth.BasicUsers = envValues("SECRETNOTES_AUTH_BASIC_USERS")
+	auth.IntrospectionURL = envString("SECRETNOTES_AUTH_INTROSPECTION_URL", auth.IntrospectionURL)
+	auth.ClientID = envString("SECRETNOTES_AUTH_CLIENT_ID", auth.ClientID)
+	auth.ClientSecret = envString("SECRETNOTES_AUTH_CLIENT_SECRET", auth.ClientSecret)
+	var err error
+	if auth.CacheTTL, err = envDuration("SECRETNOTES_AUTH_CACHE_TTL", auth.CacheTTL); err != nil {
+		return err
+	}
+
+	switch {
+	case mode == "token" && len(auth.Tokens) == 0:
+		return fmt.Errorf("SECRETNOTES_AUTH_TOKENS: required when SECRETNOTES_AUTH_MODE is token")
+	case mode == "basic" && len(auth.BasicUsers) == 0:
+		return fmt.Errorf("SECRETNOTES_AUTH_BASIC_USERS: required when SECRETNOTES_AUTH_MODE is basic")
+	case mode == "oidc" && auth.IntrospectionURL == "":
+		return fmt.Errorf("SECRETNOTES_AUTH_INTROSPECTION_URL: required when SECRETNOTES_AUTH_MODE is oidc")
+	}
+	return nil
+}
+
+// loadS3 reads the SECRETNOTES_S3_* settings. Setting a bucket turns S3
+// storage on, and then the endpoint and credentials are required.
+func loadS3(s3 *S3Config) error {
+	s3.Bucket = envString("SECRETNOTES_S3_BUCKET", s3.Bucket)
+	s3.Region = envString("SECRETNOTES_S3_REGION", s3.Region)
+	s3.Endpoint = envString("SECRETNOTES_S3_ENDPOINT", s3.Endpoint)
+	s3.AccessKey = envString("SECRETNOTES_S3_ACCESS_KEY", s3.AccessKey)
+	s3.Secret = envString("SECRETNOTES_S3_SECRET", s3.Secret)
+	var err error
+	if s3.ForcePathStyle, err = envBool("SECRETNOTES_S3_FORCE_PATH_STYLE", s3.ForcePathStyle); err != nil {
+		return err
+	}
+	if s3.Bucket == "" {
+		return nil
+	}
+
+	switch {
+	case s3.Endpoint == "":
+		return fmt.Errorf("SECRETNOTES_S3_ENDPOINT: required when SECRETNOTES_S3_BUCKET is set")
+	case !strings.HasPrefix(s3.Endpoint, "https://") && !strings.HasPrefix(s3.Endpoint, "http://"):
+		return fmt.Errorf("SECRETNOTES_S3_ENDPOINT: expected an http:// or https:// URL, got %q", s3.Endpoint)
+	case s3.AccessKey == "" || s3.Secret == "":
+		return fmt.Errorf("SECRETNOTES_S3_ACCESS_KEY and SECRETNOTES_S3_SECRET: required when SECRETNOTES_S3_BUCKET is set")
+	}
+	return nil
+}
+
+// checkDataDir makes the data directory absolute, creates it if it's missing
+// and checks that the server can write to it, so a mistyped path or a volume
+// mounted read-only fails at startup rather than at the first write
+func checkDataDir(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(dir)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", fmt.Errorf("%s doesn't exist and can't be created: %w", dir, err)
+		}
+	case err != nil:
+		return "", err
+	case !info.IsDir():
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+
+	probe, err := os.CreateTemp(dir, ".secretnotes-write-check-*")
+	if err != nil {
+		return "", fmt.Errorf("%s is not writable by uid %d; mount it read-write or change its owner: %w", dir, os.Getuid(), err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return dir, nil
+}
+
+// Floors FIPS mode puts on the PBKDF2 iteration count and salt length, after
+// NIST SP 800-132
+const (
+	MinFIPSPBKDF2Iterations = 1000
+	MinFIPSSaltSize         = 16
+)
+
+// checkFIPS rejects encryption settings FIPS mode doesn't allow, and pins the
+// "auto" cipher to AES-GCM, which it would otherwise leave for
+// ChaCha20-Poly1305 on CPUs without AES instructions
+func checkFIPS(enc *EncryptionConfig) error {
+	if fipsBuild && !enc.FIPS {
+		return fmt.Errorf("SECRETNOTES_FIPS: this server was built for FIPS mode only")
+	}
+	if !enc.FIPS {
+		return nil
+	}
+	switch {
+	case enc.Cipher == "auto":
+		enc.Cipher = "aes-256-gcm"
+	case enc.Cipher != "aes-256-gcm":
+		return fmt.Errorf("SECRETNOTES_CIPHER: %s is not FIPS-approved (use aes-256-gcm)", enc.Cipher)
+	}
+	if enc.ChunkCipher != "auto" && enc.ChunkCipher != "aes-256-gcm" {
+		return fmt.Errorf("SECRETNOTES_CHUNK_CIPHER: %s is not FIPS-approved (use aes-256-gcm)", enc.ChunkCipher)
+	}
+	if enc.KDF != "pbkdf2-sha256" {
+		return fmt.Errorf("SECRETNOTES_KDF: %s is not FIPS-approved (use pbkdf2-sha256)", enc.KDF)
+	}
+	if enc.PBKDF2Iterations < MinFIPSPBKDF2Iterations {
+		return fmt.Errorf("SECRETNOTES_PBKDF2_ITERATIONS: FIPS mode needs at least %d", MinFIPSPBKDF2Iterations)
+	}
+	if enc.SaltSize < MinFIPSSaltSize {
+		return fmt.Errorf("SECRETNOTES_SALT_SIZE: FIPS mode needs at least %d bytes", MinFIPSSaltSize)
+	}
+	return nil
+}
+
+// minPepperLength is the shortest pepper accepted, in bytes
+const minPepperLength = 16
+
+// loadPeppers reads the server pepper from SECRETNOTES_PEPPER, or the peppers
+// of a keyfile named by SECRETNOTES_PEPPER_FILE with one "<id>:<secret>" line
+// per pepper (ids 1 to 255; blank lines and # comments are skipped), so old
+// peppers can stay readable while data moves to a new one. New encryptions
+// use SECRETNOTES_PEPPER_ID, or else the single pepper's id 1 or the keyfile's
+// highest id.
+func loadPeppers(enc *EncryptionConfig) error {
+	secret := os.Getenv("SECRETNOTES_PEPPER")
+	path := strings.TrimSpace(os.Getenv("SECRETNOTES_PEPPER_FILE"))
+	if secret != "" && path != "" {
+		return fmt.Errorf("SECRETNOTES_PEPPER and SECRETNOTES_PEPPER_FILE can't both be set")
+	}
+
+	peppers := make(map[byte][]byte)
+	switch {
+	case secret != "":
+		peppers[1] = []byte(secret)
+	case path != "":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("SECRETNOTES_PEPPER_FILE: %w", err)
+		}
+		for i, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			idText, pepper, ok := strings.Cut(line, ":")
+			id, err := strconv.Atoi(strings.TrimSpace(idText))
+			if !ok || err != nil || id < 1 || id > 255 {
+				return fmt.Errorf("SECRETNOTES_PEPPER_FILE: line %d: expected <id>:<secret> with an id from 1 to 255", i+1)
+			}
+			if _, dup := peppers[byte(id)]; dup {
+				return fmt.Errorf("SECRETNOTES_PEPPER_FILE: line %d: pepper %d is listed twice", i+1, id)
+			}
+			peppers[byte(id)] = []byte(strings.TrimSpace(pepper))
+		}
+	default:
+		if os.Getenv("SECRETNOTES_PEPPER_ID") != "" {
+			return fmt.Errorf("SECRETNOTES_PEPPER_ID: no pepper is configured")
+		}
+		return nil
+	}
+
+	for id, pepper := range peppers {
+		if len(pepper) < minPepperLength {
+			return fmt.Errorf("pepper %d is shorter than %d bytes", id, minPepperLength)
+		}
+		enc.PepperID = max(enc.PepperID, id)
+	}
+	current, err := envInt("SECRETNOTES_PEPPER_ID", int(enc.PepperID))
+	if err != nil {
+		return err
+	}
+	if _, ok := peppers[byte(current)]; !ok || current > 255 {
+		return fmt.Errorf("SECRETNOTES_PEPPER_ID: pepper %d is not configured", current)
+	}
+	enc.Peppers, enc.PepperID = peppers, byte(current)
+	return nil
+}
+
+// serverLayerKeySize is the length of server layer keys, in bytes
+const serverLayerKeySize = 32
+
+// loadServerLayerKeys reads the server layer keys from the keyfile named by
+// SECRETNOTES_SERVER_LAYER_KEY_FILE, one "<id>:<base64 key>" line per key
+// (ids 1 to 255; blank lines and # comments are skipped). New encryptions
+// use SECRETNOTES_SERVER_LAYER_KEY_ID, or else the keyfile's highest id; 0
+// writes no layer while the listed keys stay readable.
+func loadServerLayerKeys(enc *EncryptionConfig) error {
+	path := strings.TrimSpace(os.Getenv("SECRETNOTES_SERVER_LAYER_KEY_FILE"))
+	if path == "" {
+		if os.Getenv("SECRETNOTES_SERVER_LAYER_KEY_ID") != "" {
+			return fmt.Errorf("SECRETNOTES_SERVER_LAYER_KEY_ID: no server layer key is configured")
+		}
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("SECRETNOTES_SERVER_LAYER_KEY_FILE: %w", err)
+	}
+
+	keys := make(map[byte][]byte)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		idText, encoded, ok := strings.Cut(line, ":")
+		id, err := strconv.Atoi(strings.TrimSpace(idText))
+		if !ok || err != nil || id < 1 || id > 255 {
+			return fmt.Errorf("SECRETNOTES_SERVER_LAYER_KEY_FILE: line %d: expected <id>:<base64 key> with an id from 1 to 255", i+1)
+		}
+		if _, dup := keys[byte(id)]; dup {
+			return fmt.Errorf("SECRETNOTES_SERVER_LAYER_KEY_FILE: line %d: key %d is listed twice", i+1, id)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || len(key) != serverLayerKeySize {
+			return fmt.Errorf("SECRETNOTES_SERVER_LAYER_KEY_FILE: line %d: key %d is not a base64 %d-byte key", i+1, id, serverLayerKeySize)
+		}
+		keys[byte(id)] = key
+		enc.ServerLayerKeyID = max(enc.ServerLayerKeyID, byte(id))
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("SECRETNOTES_SERVER_LAYER_KEY_FILE: no keys in %s", path)
+	}
+
+	// 0 is allowed here, unlike envInt: it takes the layer off
+	current := int(enc.ServerLayerKeyID)
+	if v := strings.TrimSpace(os.Getenv("SECRETNOTES_SERVER_LAYER_KEY_ID")); v != "" {
+		if current, err = strconv.Atoi(v); err != nil || current < 0 {
+			return fmt.Errorf("SECRETNOTES_SERVER_LAYER_KEY_ID: expected a key id or 0, got %q", v)
+		}
+	}
+	if _, ok := keys[byte(current)]; current != 0 && (!ok || current > 255) {
+		return fmt.Errorf("SECRETNOTES_SERVER_LAYER_KEY_ID: key %d is not configured", current)
+	}
+	enc.ServerLayerKeys, enc.ServerLayerKeyID = keys, byte(current)
+	return nil
+}
+
+// loadArchiveKeys reads the archive signing key from SECRETNOTES_SIGNING_KEY_FILE,
+// a file holding a base64 Ed25519 seed, and the other servers' public keys in
+// SECRETNOTES_TRUSTED_SIGNING_KEYS, base64 and comma-separated
+func loadArchiveKeys(archives *ArchiveConfig) error {
+	if path := strings.TrimSpace(os.Getenv("SECRETNOTES_SIGNING_KEY_FILE")); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("SECRETNOTES_SIGNING_KEY_FILE: %w", err)
+		}
+		seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return fmt.Errorf("SECRETNOTES_SIGNING_KEY_FILE: expected a base64 %d-byte key", ed25519.SeedSize)
+		}
+		archives.SigningKey = seed
+	}
+	for _, key := range strings.Split(os.Getenv("SECRETNOTES_TRUSTED_SIGNING_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key == "" {
+			continue
+		}
+		pub, err := base64.StdEncoding.DecodeString(key)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			return fmt.Errorf("SECRETNOTES_TRUSTED_SIGNING_KEYS: %q is not a base64 %d-byte public key", key, ed25519.PublicKeySize)
+		}
+		archives.TrustedKeys = append(archives.TrustedKeys, pub)
+	}
+
+	var err error
+	if archives.RequireSigned, err = envBool("SECRETNOTES_REQUIRE_SIGNED_IMPORTS", archives.RequireSigned); err != nil {
+		return err
+	}
+	if archives.RequireSigned && archives.SigningKey == nil && len(archives.TrustedKeys) == 0 {
+		return fmt.Errorf("SECRETNOTES_REQUIRE_SIGNED_IMPORTS: no signing key or trusted key is configured")
+	}
+	return nil
+}
+
+func envString(name string, fallback string) string {
+	if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envBool(name string, fallback bool) (bool, error) {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: expected a boolean, got %q", name, v)
+	}
+	return b, nil
+}
+
+func envInt(name string, fallback int) (int, error) {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s: expected a positive integer, got %q", name, v)
+	}
+	return n, nil
+}
+
+func envInt64(name string, fallback int64) (int64, error) {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s: expected a positive integer, got %q", name, v)
+	}
+	return n, nil
+}
+
+// envValues reads a comma-separated list of free-form values, dropping empty ones
+func envValues(name string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// envContentTypes reads a comma-separated list of content types, each either
+// type/subtype or a type/* wildcard
+func envContentTypes(name string) ([]string, error) {
+	var types []string
+	for _, v := range envValues(name) {
+		v = strings.ToLower(v)
+		major, minor, ok := strings.Cut(v, "/")
+		if v != "*" && (!ok || major == "" || minor == "" || strings.ContainsAny(minor, "/;") || (major == "*" && minor != "*")) {
+			return nil, fmt.Errorf("%s: %q is not a content type like image/png or image/*", name, v)
+		}
+		types = append(types, v)
+	}
+	return types, nil
+}
+
+// envList reads a comma-separated list whose items must all be in allowed
+func envList(name string, fallback []string, allowed []string) ([]string, error) {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return fallback, nil
+	}
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		if !slices.Contains(allowed, item) {
+			return nil, fmt.Errorf("%s: unknown value %q (expected one of %s)", name, item, strings.Join(allowed, ", "))
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func envDuration(name string, fallback time.Duration) (time.Duration, error) {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s: expected a positive duration like 24h, got %q", name, v)
+	}
+	return d, nil
+}
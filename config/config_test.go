@@ -0,0 +1,651 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Paste.Enabled {
+		t.Fatalf("expected paste mode to be disabled by default")
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	t.Setenv("SECRETNOTES_PASTE_ENABLED", "true")
+	t.Setenv("SECRETNOTES_PASTE_TTL", "2h")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Paste.Enabled {
+		t.Fatalf("expected paste mode to be enabled")
+	}
+	if cfg.Paste.TTL != 2*time.Hour {
+		t.Fatalf("expected TTL 2h, got %v", cfg.Paste.TTL)
+	}
+}
+
+func TestLoadRejectsInvalidValues(t *testing.T) {
+	t.Setenv("SECRETNOTES_PASTE_MAX_BYTES", "lots")
+
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected an error for a non-numeric size")
+	}
+}
+
+func TestLoadCompressionClasses(t *testing.T) {
+	t.Setenv("SECRETNOTES_COMPRESSION_CLASSES", "public, Secret")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Compress.Classes) != 2 || cfg.Compress.Classes[1] != "secret" {
+		t.Fatalf("expected [public secret], got %v", cfg.Compress.Classes)
+	}
+
+	t.Setenv("SECRETNOTES_COMPRESSION_CLASSES", "public,everything")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected an error for an unknown class")
+	}
+}
+
+func TestLoadUploadTypes(t *testing.T) {
+	t.Setenv("SECRETNOTES_UPLOAD_TYPES", "Image/*, application/pdf")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Limits.UploadTypes) != 2 || cfg.Limits.UploadTypes[0] != "image/*" {
+		t.Fatalf("expected [image/* application/pdf], got %v", cfg.Limits.UploadTypes)
+	}
+
+	t.Setenv("SECRETNOTES_UPLOAD_TYPES", "images")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected an error for a malformed content type")
+	}
+}
+
+func TestLoadMaxAttachments(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Limits.MaxAttachments != 20 {
+		t.Fatalf("expected 20 attachments by default, got %d", cfg.Limits.MaxAttachments)
+	}
+
+	t.Setenv("SECRETNOTES_MAX_ATTACHMENTS", "5")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Limits.MaxAttachments != 5 {
+		t.Fatalf("expected 5 attachments, got %d", cfg.Limits.MaxAttachments)
+	}
+
+	t.Setenv("SECRETNOTES_MAX_ATTACHMENTS", "0")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected an error for a zero count")
+	}
+}
+
+func TestLoadAttachmentRetention(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Retention.MaxAge != 0 || cfg.Retention.Keep != 0 {
+		t.Fatalf("expected no retention rule by default, got %+v", cfg.Retention)
+	}
+
+	t.Setenv("SECRETNOTES_ATTACHMENT_MAX_AGE", "720h")
+	t.Setenv("SECRETNOTES_ATTACHMENT_KEEP", "3")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Retention.MaxAge != 720*time.Hour || cfg.Retention.Keep != 3 {
+		t.Fatalf("expected 720h and 3, got %+v", cfg.Retention)
+	}
+}
+
+func TestLoadAuth(t *testing.T) {
+	t.Setenv("SECRETNOTES_AUTH_MODE", "Token")
+	t.Setenv("SECRETNOTES_AUTH_TOKENS", "Secret-A, secret-b,")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Auth.Mode != "token" || len(cfg.Auth.Tokens) != 2 || cfg.Auth.Tokens[0] != "Secret-A" {
+		t.Fatalf("expected token mode with [Secret-A secret-b], got %q %v", cfg.Auth.Mode, cfg.Auth.Tokens)
+	}
+
+	t.Setenv("SECRETNOTES_AUTH_TOKENS", "")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected an error for token mode without tokens")
+	}
+
+	t.Setenv("SECRETNOTES_AUTH_MODE", "kerberos")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected an error for an unknown mode")
+	}
+}
+
+func TestLoadBranding(t *testing.T) {
+	t.Setenv("SECRETNOTES_BRAND_NAME", "Acme Vault")
+	t.Setenv("SECRETNOTES_BRAND_ACCENT_COLOR", "#0a7")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Branding.HealthMessage != "Acme Vault API is live" || cfg.SMTP.FromName != "Acme Vault" {
+		t.Fatalf("expected the brand name to carry over, got %q / %q", cfg.Branding.HealthMessage, cfg.SMTP.FromName)
+	}
+
+	t.Setenv("SECRETNOTES_BRAND_ACCENT_COLOR", "red; background: url(x)")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected an error for a non-hex accent color")
+	}
+}
+
+func TestLoadLowMemoryProfile(t *testing.T) {
+	t.Setenv("SECRETNOTES_PROFILE", "low-memory")
+	t.Setenv("SECRETNOTES_MAX_UPLOAD_BYTES", "1048576")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Resources.KDFConcurrency == 0 || cfg.Idempotency.Enabled {
+		t.Fatalf("expected capped key derivation and no idempotency cache, got %+v", cfg.Resources)
+	}
+	if cfg.Limits.MaxUploadBytes != 1<<20 {
+		t.Fatalf("expected the explicit upload limit to win over the profile, got %d", cfg.Limits.MaxUploadBytes)
+	}
+	if cfg.Encryption.ChunkThreshold != 256<<10 {
+		t.Fatalf("expected a lower chunk threshold, got %d", cfg.Encryption.ChunkThreshold)
+	}
+	if cfg.Resources.ChunkWorkers != 1 {
+		t.Fatalf("expected chunks to be encrypted one at a time, got %d", cfg.Resources.ChunkWorkers)
+	}
+
+	t.Setenv("SECRETNOTES_PROFILE", "tiny")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected an error for an unknown profile")
+	}
+}
+
+func TestLoadKDF(t *testing.T) {
+	if fipsBuild {
+		t.Skip("scrypt is refused in FIPS builds")
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Encryption.KDF != "pbkdf2-sha256" {
+		t.Fatalf("expected PBKDF2 by default, got %q", cfg.Encryption.KDF)
+	}
+
+	t.Setenv("SECRETNOTES_KDF", "Scrypt")
+	if cfg, err = Load(); err != nil || cfg.Encryption.KDF != "scrypt" {
+		t.Fatalf("expected scrypt, got %+v (%v)", cfg, err)
+	}
+
+	t.Setenv("SECRETNOTES_KDF", "argon2id")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected an error for an unknown KDF")
+	}
+}
+
+func TestLoadChunkCipher(t *testing.T) {
+	if fipsBuild {
+		t.Skip("AES-GCM-SIV is refused in FIPS builds")
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Encryption.ChunkCipher != "auto" {
+		t.Fatalf("expected chunks to use the main cipher by default, got %q", cfg.Encryption.ChunkCipher)
+	}
+
+	t.Setenv("SECRETNOTES_CHUNK_CIPHER", "AES-256-GCM-SIV")
+	if cfg, err = Load(); err != nil || cfg.Encryption.ChunkCipher != "aes-256-gcm-siv" {
+		t.Fatalf("expected AES-GCM-SIV, got %+v (%v)", cfg, err)
+	}
+
+	t.Setenv("SECRETNOTES_CHUNK_CIPHER", "aes-128-ocb")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected an error for an unknown cipher")
+	}
+}
+
+func TestLoadKDFCost(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Encryption.PBKDF2Iterations != 10000 || cfg.Encryption.SaltSize != 16 {
+		t.Fatalf("unexpected defaults %+v", cfg.Encryption)
+	}
+
+	t.Setenv("SECRETNOTES_PBKDF2_ITERATIONS", "600000")
+	t.Setenv("SECRETNOTES_SALT_SIZE", "32")
+	t.Setenv("SECRETNOTES_CHUNK_THRESHOLD", "8388608")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Encryption.PBKDF2Iterations != 600000 || cfg.Encryption.SaltSize != 32 || cfg.Encryption.ChunkThreshold != 8<<20 {
+		t.Fatalf("unexpected encryption config %+v", cfg.Encryption)
+	}
+
+	for name, value := range map[string]string{
+		"SECRETNOTES_PBKDF2_ITERATIONS": "100",
+		"SECRETNOTES_SALT_SIZE":         "128",
+		"SECRETNOTES_CHUNK_THRESHOLD":   "0",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected an error for %s=%s", name, value)
+			}
+		})
+	}
+}
+
+func TestLoadKeyCache(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Encryption.KeyCacheSize != 0 {
+		t.Fatalf("expected the key cache to be off by default, got %d", cfg.Encryption.KeyCacheSize)
+	}
+
+	t.Setenv("SECRETNOTES_KEY_CACHE_SIZE", "1000")
+	t.Setenv("SECRETNOTES_KEY_CACHE_TTL", "30s")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Encryption.KeyCacheSize != 1000 || cfg.Encryption.KeyCacheTTL != 30*time.Second {
+		t.Fatalf("unexpected encryption config %+v", cfg.Encryption)
+	}
+}
+
+func TestLoadPepper(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Encryption.Peppers != nil || cfg.Encryption.PepperID != 0 {
+		t.Fatalf("expected no pepper by default, got %+v", cfg.Encryption)
+	}
+
+	t.Setenv("SECRETNOTES_PEPPER", "a pepper of sixteen bytes or more")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Encryption.PepperID != 1 || string(cfg.Encryption.Peppers[1]) != "a pepper of sixteen bytes or more" {
+		t.Fatalf("unexpected encryption config %+v", cfg.Encryption)
+	}
+
+	path := filepath.Join(t.TempDir(), "peppers")
+	keyfile := "# retired after the 2026 rotation\n1:the first pepper, long enough\n\n2: the second pepper, long enough\n"
+	if err := os.WriteFile(path, []byte(keyfile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SECRETNOTES_PEPPER", "")
+	t.Setenv("SECRETNOTES_PEPPER_FILE", path)
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Encryption.PepperID != 2 || len(cfg.Encryption.Peppers) != 2 || string(cfg.Encryption.Peppers[2]) != "the second pepper, long enough" {
+		t.Fatalf("unexpected encryption config %+v", cfg.Encryption)
+	}
+	t.Setenv("SECRETNOTES_PEPPER_ID", "1")
+	if cfg, err = Load(); err != nil || cfg.Encryption.PepperID != 1 {
+		t.Fatalf("expected pepper 1 to be current, got %+v, %v", cfg, err)
+	}
+
+	for _, tc := range []struct{ pepper, file, id string }{
+		{pepper: "short"},
+		{pepper: "a pepper of sixteen bytes or more", file: path},
+		{pepper: "a pepper of sixteen bytes or more", id: "3"},
+		{id: "1"},
+		{file: filepath.Join(t.TempDir(), "missing")},
+		{file: path, id: "300"},
+	} {
+		t.Setenv("SECRETNOTES_PEPPER", tc.pepper)
+		t.Setenv("SECRETNOTES_PEPPER_FILE", tc.file)
+		t.Setenv("SECRETNOTES_PEPPER_ID", tc.id)
+		if _, err := Load(); err == nil {
+			t.Fatalf("expected an error for %+v", tc)
+		}
+	}
+
+	for _, keyfile := range []string{"no id here\n", "0:a pepper of sixteen bytes or more\n", "1:short\n", "1:a pepper of sixteen bytes\n1:a pepper of sixteen bytes\n"} {
+		if err := os.WriteFile(path, []byte(keyfile), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("SECRETNOTES_PEPPER", "")
+		t.Setenv("SECRETNOTES_PEPPER_FILE", path)
+		t.Setenv("SECRETNOTES_PEPPER_ID", "")
+		if _, err := Load(); err == nil {
+			t.Fatalf("expected an error for keyfile %q", keyfile)
+		}
+	}
+}
+
+func TestLoadServerLayerKeys(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Encryption.ServerLayerKeys != nil || cfg.Encryption.ServerLayerKeyID != 0 {
+		t.Fatalf("expected no server layer by default, got %+v", cfg.Encryption)
+	}
+
+	key1 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	key2 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+	path := filepath.Join(t.TempDir(), "layer-keys")
+	if err := os.WriteFile(path, []byte("# retired\n1:"+key1+"\n\n2: "+key2+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SECRETNOTES_SERVER_LAYER_KEY_FILE", path)
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Encryption.ServerLayerKeyID != 2 || len(cfg.Encryption.ServerLayerKeys) != 2 || cfg.Encryption.ServerLayerKeys[1][0] != 1 {
+		t.Fatalf("unexpected encryption config %+v", cfg.Encryption)
+	}
+	t.Setenv("SECRETNOTES_SERVER_LAYER_KEY_ID", "0")
+	if cfg, err = Load(); err != nil || cfg.Encryption.ServerLayerKeyID != 0 || len(cfg.Encryption.ServerLayerKeys) != 2 {
+		t.Fatalf("expected keys without a current one, got %+v, %v", cfg, err)
+	}
+
+	for _, tc := range []struct{ file, id string }{
+		{id: "1"},
+		{file: path, id: "3"},
+		{file: filepath.Join(t.TempDir(), "missing")},
+	} {
+		t.Setenv("SECRETNOTES_SERVER_LAYER_KEY_FILE", tc.file)
+		t.Setenv("SECRETNOTES_SERVER_LAYER_KEY_ID", tc.id)
+		if _, err := Load(); err == nil {
+			t.Fatalf("expected an error for %+v", tc)
+		}
+	}
+
+	for _, keyfile := range []string{"", "no id here\n", "0:" + key1 + "\n", "1:c2hvcnQ=\n", "1:" + key1 + "\n1:" + key2 + "\n"} {
+		if err := os.WriteFile(path, []byte(keyfile), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("SECRETNOTES_SERVER_LAYER_KEY_FILE", path)
+		t.Setenv("SECRETNOTES_SERVER_LAYER_KEY_ID", "")
+		if _, err := Load(); err == nil {
+			t.Fatalf("expected an error for keyfile %q", keyfile)
+		}
+	}
+}
+
+func TestLoadS3(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.S3.Bucket != "" {
+		t.Fatalf("expected local storage by default, got %+v", cfg.S3)
+	}
+
+	t.Setenv("SECRETNOTES_S3_BUCKET", "notes")
+	t.Setenv("SECRETNOTES_S3_ENDPOINT", "http://minio:9000")
+	t.Setenv("SECRETNOTES_S3_ACCESS_KEY", "access")
+	t.Setenv("SECRETNOTES_S3_SECRET", "secret")
+	t.Setenv("SECRETNOTES_S3_FORCE_PATH_STYLE", "true")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := S3Config{Bucket: "notes", Region: "us-east-1", Endpoint: "http://minio:9000", AccessKey: "access", Secret: "secret", ForcePathStyle: true}
+	if cfg.S3 != want {
+		t.Fatalf("expected %+v, got %+v", want, cfg.S3)
+	}
+
+	for name, value := range map[string]string{
+		"SECRETNOTES_S3_ENDPOINT":   "minio:9000",
+		"SECRETNOTES_S3_SECRET":     "",
+		"SECRETNOTES_S3_ACCESS_KEY": "",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected an error with %s=%q", name, value)
+			}
+		})
+	}
+	t.Setenv("SECRETNOTES_S3_ENDPOINT", "")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected an error without an endpoint")
+	}
+}
+
+func TestLoadDataDir(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.DataDir != "" {
+		t.Fatalf("expected PocketBase's default data directory, got %q", cfg.DataDir)
+	}
+
+	dir := filepath.Join(t.TempDir(), "volume", "pb_data")
+	t.Setenv("SECRETNOTES_DATA_DIR", dir)
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.DataDir != dir {
+		t.Fatalf("expected %q, got %q", dir, cfg.DataDir)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Fatalf("expected the directory to be created, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("expected the write check to clean up, found %v", entries)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(filepath.Dir(dir)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	t.Setenv("SECRETNOTES_DATA_DIR", "pb_data")
+	if cfg, err = Load(); err != nil || !filepath.IsAbs(cfg.DataDir) {
+		t.Fatalf("expected a relative path to be made absolute, got %q, %v", cfg.DataDir, err)
+	}
+	if want, _ := os.Stat(dir); want == nil || !sameDir(t, cfg.DataDir, want) {
+		t.Fatalf("expected %q to be %q", cfg.DataDir, dir)
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{file, filepath.Join(file, "pb_data")} {
+		t.Setenv("SECRETNOTES_DATA_DIR", bad)
+		if _, err := Load(); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+
+	if os.Geteuid() != 0 {
+		readOnly := t.TempDir()
+		if err := os.Chmod(readOnly, 0o500); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("SECRETNOTES_DATA_DIR", readOnly)
+		if _, err := Load(); err == nil {
+			t.Fatal("expected an error for a read-only directory")
+		}
+	}
+}
+
+// sameDir reports whether path is the directory want describes
+func sameDir(t *testing.T, path string, want os.FileInfo) bool {
+	t.Helper()
+	info, err := os.Stat(path)
+	return err == nil && os.SameFile(info, want)
+}
+
+func TestLoadKMS(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Encryption.KMSCommand) != 0 {
+		t.Fatalf("expected no KMS by default, got %q", cfg.Encryption.KMSCommand)
+	}
+
+	t.Setenv("SECRETNOTES_KMS_COMMAND", "/usr/local/bin/secretnotes-kms  --key alias/secretnotes")
+	t.Setenv("SECRETNOTES_KMS_TIMEOUT", "3s")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(cfg.Encryption.KMSCommand, []string{"/usr/local/bin/secretnotes-kms", "--key", "alias/secretnotes"}) || cfg.Encryption.KMSTimeout != 3*time.Second {
+		t.Fatalf("unexpected encryption config %+v", cfg.Encryption)
+	}
+}
+
+func TestLoadArchiveKeys(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Archives.SigningKey != nil || cfg.Archives.RequireSigned {
+		t.Fatalf("expected unsigned exports by default, got %+v", cfg.Archives)
+	}
+
+	t.Setenv("SECRETNOTES_REQUIRE_SIGNED_IMPORTS", "true")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected an error for required signatures without any key")
+	}
+
+	path := filepath.Join(t.TempDir(), "signing.key")
+	os.WriteFile(path, []byte("BwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwc=\n"), 0o600)
+	t.Setenv("SECRETNOTES_SIGNING_KEY_FILE", path)
+	t.Setenv("SECRETNOTES_TRUSTED_SIGNING_KEYS", "CAgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAg=, CQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQk=")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Archives.SigningKey) != 32 || cfg.Archives.SigningKey[0] != 7 || len(cfg.Archives.TrustedKeys) != 2 || !cfg.Archives.RequireSigned {
+		t.Fatalf("unexpected archive config %+v", cfg.Archives)
+	}
+
+	t.Setenv("SECRETNOTES_TRUSTED_SIGNING_KEYS", "c2hvcnQ=")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected an error for a short trusted key")
+	}
+	t.Setenv("SECRETNOTES_TRUSTED_SIGNING_KEYS", "")
+	os.WriteFile(path, []byte("not base64"), 0o600)
+	if _, err := Load(); err == nil {
+		t.Fatal("expected an error for an unreadable signing key")
+	}
+}
+
+func TestLoadFIPS(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Encryption.FIPS != fipsBuild {
+		t.Fatalf("expected FIPS mode to follow the build, got %v", cfg.Encryption.FIPS)
+	}
+
+	t.Setenv("SECRETNOTES_FIPS", "true")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Encryption.FIPS || cfg.Encryption.Cipher != "aes-256-gcm" {
+		t.Fatalf("expected FIPS mode to pin AES-GCM, got %+v", cfg.Encryption)
+	}
+
+	for name, value := range map[string]string{
+		"SECRETNOTES_CIPHER":            "chacha20-poly1305",
+		"SECRETNOTES_CHUNK_CIPHER":      "aes-256-gcm-siv",
+		"SECRETNOTES_KDF":               "scrypt",
+		"SECRETNOTES_SALT_SIZE":         "8",
+		"SECRETNOTES_PBKDF2_ITERATIONS": "999",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected %s=%s to be refused in FIPS mode", name, value)
+			}
+		})
+	}
+
+	if fipsBuild {
+		t.Setenv("SECRETNOTES_FIPS", "false")
+		if _, err := Load(); err == nil {
+			t.Fatal("expected a FIPS build to refuse SECRETNOTES_FIPS=false")
+		}
+	}
+}
+
+func TestLoadCompression(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Encryption.Compression || cfg.Encryption.CompressMinBytes != 4096 {
+		t.Fatalf("unexpected compression defaults %+v", cfg.Encryption)
+	}
+
+	t.Setenv("SECRETNOTES_COMPRESSION", "false")
+	t.Setenv("SECRETNOTES_COMPRESSION_MIN_BYTES", "512")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Encryption.Compression || cfg.Encryption.CompressMinBytes != 512 {
+		t.Fatalf("unexpected encryption config %+v", cfg.Encryption)
+	}
+}
+
+func TestLoadScan(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Scan.ClamdAddress != "" || cfg.Scan.Timeout != 30*time.Second || cfg.Scan.FailOpen {
+		t.Fatalf("expected scanning off by default, got %+v", cfg.Scan)
+	}
+
+	t.Setenv("SECRETNOTES_CLAMD_ADDRESS", "tcp://clamav:3310")
+	t.Setenv("SECRETNOTES_SCAN_TIMEOUT", "5s")
+	t.Setenv("SECRETNOTES_SCAN_FAIL_OPEN", "true")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Scan.ClamdAddress != "tcp://clamav:3310" || cfg.Scan.Timeout != 5*time.Second || !cfg.Scan.FailOpen {
+		t.Fatalf("unexpected scan config %+v", cfg.Scan)
+	}
+
+	t.Setenv("SECRETNOTES_SCAN_TIMEOUT", "soon")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected an error for an invalid scan timeout")
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !fips
+
+package config
+
+// fipsBuild is set by building with -tags fips; see fips_on.go
+const fipsBuild = false
@@ -0,0 +1,7 @@
+//go:build fips
+
+package config
+
+// fipsBuild is set by building with -tags fips, which makes FIPS mode the
+// only mode: SECRETNOTES_FIPS can't turn it off
+const fipsBuild = true
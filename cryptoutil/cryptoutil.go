@@ -0,0 +1,17 @@
+// Package cryptoutil holds small helpers for handling secrets in memory.
+package cryptoutil
+
+import "runtime"
+
+// Wipe overwrites each buffer with zeros, for plaintext and keys that
+// shouldn't linger in the heap once they've been used. Go's garbage collector
+// may already have copied a buffer elsewhere, and strings can't be wiped at
+// all, so this narrows the window in which a memory dump reveals secrets
+// rather than closing it.
+func Wipe(bufs ...[]byte) {
+	for _, b := range bufs {
+		clear(b)
+	}
+	// keep the writes from being optimized away as dead stores
+	runtime.KeepAlive(bufs)
+}
@@ -0,0 +1,18 @@
+package cryptoutil
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWipe(t *testing.T) {
+	key := []byte("a derived key")
+	plain := []byte("a decrypted note")
+	Wipe(key, plain[2:], nil)
+	if !bytes.Equal(key, make([]byte, len(key))) {
+		t.Fatalf("expected the key to be zeroed, got %q", key)
+	}
+	if string(plain[:2]) != "a " || !bytes.Equal(plain[2:], make([]byte, len(plain)-2)) {
+		t.Fatalf("expected only the slice to be zeroed, got %q", plain)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// newFsckCommand builds the "fsck" admin command, which checks stored notes,
+// attachments and subscriptions and optionally repairs what it safely can.
+// It exits non-zero while problems remain.
+func newFsckCommand(integrityService *services.IntegrityService) *cobra.Command {
+	var repair, deleteOrphans, asJSON bool
+
+	command := &cobra.Command{
+		Use:          "fsck",
+		Short:        "Checks notes and attachments for corrupt or orphaned records",
+		SilenceUsage: true,
+		RunE: func(command *cobra.Command, args []string) error {
+			report, err := integrityService.CheckIntegrity(services.IntegrityOptions{
+				Repair:        repair,
+				DeleteOrphans: deleteOrphans,
+			})
+			if err != nil {
+				return err
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(report); err != nil {
+					return err
+				}
+			} else {
+				printIntegrityReport(report)
+			}
+
+			if n := report.Unrepaired(); n > 0 {
+				// PocketBase ignores command errors, so exit explicitly for scripts and cron
+				fmt.Fprintf(os.Stderr, "%d problem(s) remain\n", n)
+				os.Exit(1)
+			}
+			return nil
+		},
+	}
+
+	command.Flags().BoolVar(&repair, "repair", false, "fix image_hash references and content reference counts, and delete unreadable attachments")
+	command.Flags().BoolVar(&deleteOrphans, "delete-orphans", false, "delete attachments and subscriptions that have no note, and unused attachment contents")
+	command.Flags().BoolVar(&asJSON, "json", false, "print the report as JSON")
+
+	return command
+}
+
+// printIntegrityReport writes a human-readable fsck report to stdout
+func printIntegrityReport(report *services.IntegrityReport) {
+	fmt.Printf("Checked %d notes, %d attachments, %d subscriptions\n",
+		report.Checked["notes"], report.Checked["encrypted_files"], report.Checked["note_subscriptions"])
+	if len(report.Issues) == 0 {
+		fmt.Println("No problems found")
+		return
+	}
+
+	fixable := 0
+	for _, issue := range report.Issues {
+		status := "manual"
+		switch {
+		case issue.Repaired:
+			status = "repaired (" + issue.Repair + ")"
+		case issue.RepairErr != "":
+			status = "repair failed: " + issue.RepairErr
+		case issue.Repair != services.RepairNone:
+			status = "fixable (" + issue.Repair + ")"
+			fixable++
+		}
+		fmt.Printf("%-18s %-15s %s [%s]\n", issue.Collection, issue.RecordID, issue.Problem, status)
+	}
+	if fixable > 0 {
+		fmt.Println("Run again with --repair (and --delete-orphans for orphaned records) to apply fixable repairs")
+	}
+}
@@ -0,0 +1,238 @@
+// Package gcmsiv implements AES-GCM-SIV (RFC 8452), a nonce-misuse-resistant
+// AEAD. Sealing two messages under the same key and nonce reveals only
+// whether they are identical, where AES-GCM would leak their XOR and let the
+// authentication key be recovered.
+package gcmsiv
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+
+	"github.com/ktappdev/secretnotes-go-backend/cryptoutil"
+)
+
+const (
+	// NonceSize and TagSize are those of AES-GCM
+	NonceSize = 12
+	TagSize   = 16
+
+	// maxPlaintext is the RFC's limit of 2^36 bytes per message
+	maxPlaintext = 1 << 36
+)
+
+var errOpen = errors.New("gcmsiv: message authentication failed")
+
+type aead struct {
+	block  cipher.Block // keyed with the key-generating key
+	keyLen int
+}
+
+// New returns AES-GCM-SIV keyed with a 16- or 32-byte key. Like the standard
+// library's AEADs, it is safe for concurrent use.
+func New(key []byte) (cipher.AEAD, error) {
+	if len(key) != 16 && len(key) != 32 {
+		return nil, errors.New("gcmsiv: key must be 16 or 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &aead{block: block, keyLen: len(key)}, nil
+}
+
+func (a *aead) NonceSize() int { return NonceSize }
+func (a *aead) Overhead() int  { return TagSize }
+
+// Seal implements cipher.AEAD
+func (a *aead) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != NonceSize {
+		panic("gcmsiv: incorrect nonce length")
+	}
+	if uint64(len(plaintext)) > maxPlaintext || uint64(len(additionalData)) > maxPlaintext {
+		panic("gcmsiv: message too large")
+	}
+	authKey, block := a.messageKeys(nonce)
+	var tag [TagSize]byte
+	a.tag(&tag, authKey, block, nonce, plaintext, additionalData)
+	cryptoutil.Wipe(authKey)
+
+	ret, out := sliceForAppend(dst, len(plaintext)+TagSize)
+	ctr(block, out[:len(plaintext)], plaintext, &tag)
+	copy(out[len(plaintext):], tag[:])
+	return ret
+}
+
+// Open implements cipher.AEAD
+func (a *aead) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != NonceSize {
+		panic("gcmsiv: incorrect nonce length")
+	}
+	if len(ciphertext) < TagSize || uint64(len(ciphertext)) > maxPlaintext+TagSize || uint64(len(additionalData)) > maxPlaintext {
+		return nil, errOpen
+	}
+	var tag [TagSize]byte
+	copy(tag[:], ciphertext[len(ciphertext)-TagSize:])
+	ciphertext = ciphertext[:len(ciphertext)-TagSize]
+
+	authKey, block := a.messageKeys(nonce)
+	defer cryptoutil.Wipe(authKey)
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	ctr(block, out, ciphertext, &tag)
+
+	var expected [TagSize]byte
+	a.tag(&expected, authKey, block, nonce, out, additionalData)
+	if subtle.ConstantTimeCompare(expected[:], tag[:]) != 1 {
+		clear(out)
+		return nil, errOpen
+	}
+	return ret, nil
+}
+
+// messageKeys derives the per-nonce POLYVAL key and AES key (RFC 8452,
+// section 4): the first halves of the key-generating key's encryptions of a
+// little-endian counter followed by the nonce
+func (a *aead) messageKeys(nonce []byte) ([]byte, cipher.Block) {
+	keys := make([]byte, 16+a.keyLen)
+	var in, out [16]byte
+	copy(in[4:], nonce)
+	for i := 0; i < len(keys)/8; i++ {
+		binary.LittleEndian.PutUint32(in[:4], uint32(i))
+		a.block.Encrypt(out[:], in[:])
+		copy(keys[8*i:], out[:8])
+	}
+	clear(out[:])
+	block, err := aes.NewCipher(keys[16:])
+	if err != nil {
+		panic(err) // the key length is valid
+	}
+	cryptoutil.Wipe(keys[16:])
+	return keys[:16], block
+}
+
+// tag computes the tag of plaintext and additionalData into out
+func (a *aead) tag(out *[TagSize]byte, authKey []byte, block cipher.Block, nonce, plaintext, additionalData []byte) {
+	p := newPolyval(authKey)
+	p.update(additionalData)
+	p.update(plaintext)
+	var lengths [16]byte
+	binary.LittleEndian.PutUint64(lengths[:8], uint64(len(additionalData))*8)
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(plaintext))*8)
+	p.update(lengths[:])
+
+	p.sum(out)
+	for i := range nonce {
+		out[i] ^= nonce[i]
+	}
+	out[15] &= 0x7f
+	block.Encrypt(out[:], out[:])
+}
+
+// ctr XORs src with the key stream of the counter mode starting at tag, with
+// its top bit set, into dst. The counter is the first 32 bits, little-endian.
+func ctr(block cipher.Block, dst, src []byte, tag *[TagSize]byte) {
+	counter := *tag
+	counter[15] |= 0x80
+	n := binary.LittleEndian.Uint32(counter[:4])
+	var stream [16]byte
+	for len(src) > 0 {
+		block.Encrypt(stream[:], counter[:])
+		k := subtle.XORBytes(dst, src, stream[:])
+		dst, src = dst[k:], src[k:]
+		n++
+		binary.LittleEndian.PutUint32(counter[:4], n)
+	}
+	clear(stream[:])
+}
+
+// polyval is the POLYVAL universal hash of RFC 8452, over GF(2^128) with the
+// polynomial x^128 + x^127 + x^126 + x^121 + 1. Elements are held as two
+// little-endian halves, bit i of the field element being bit i of lo:hi.
+type polyval struct {
+	hLo, hHi uint64
+	sLo, sHi uint64
+}
+
+func newPolyval(key []byte) *polyval {
+	return &polyval{hLo: binary.LittleEndian.Uint64(key[:8]), hHi: binary.LittleEndian.Uint64(key[8:16])}
+}
+
+// update absorbs data, zero-padded to whole blocks
+func (p *polyval) update(data []byte) {
+	var block [16]byte
+	for len(data) > 0 {
+		n := copy(block[:], data)
+		clear(block[n:])
+		data = data[n:]
+		p.sLo ^= binary.LittleEndian.Uint64(block[:8])
+		p.sHi ^= binary.LittleEndian.Uint64(block[8:])
+		p.sLo, p.sHi = dot(p.sLo, p.sHi, p.hLo, p.hHi)
+	}
+	clear(block[:])
+}
+
+// sum writes the hash of everything absorbed
+func (p *polyval) sum(out *[TagSize]byte) {
+	binary.LittleEndian.PutUint64(out[:8], p.sLo)
+	binary.LittleEndian.PutUint64(out[8:], p.sHi)
+}
+
+// dot returns a * b * x^-128 in POLYVAL's field
+func dot(aLo, aHi, bLo, bHi uint64) (uint64, uint64) {
+	// the 256-bit carry-less product c3:c2:c1:c0
+	c0, c1 := clmul(aLo, bLo)
+	m0, m1 := clmul(aLo, bHi)
+	n0, n1 := clmul(aHi, bLo)
+	c2, c3 := clmul(aHi, bHi)
+	c1 ^= m0 ^ n0
+	c2 ^= m1 ^ n1
+
+	// Montgomery reduction: add multiples of the polynomial that clear the
+	// low 128 bits, 64 at a time, and keep the high half
+	c1 ^= c0<<63 ^ c0<<62 ^ c0<<57
+	c2 ^= c0 ^ c0>>1 ^ c0>>2 ^ c0>>7
+	c2 ^= c1<<63 ^ c1<<62 ^ c1<<57
+	c3 ^= c1 ^ c1>>1 ^ c1>>2 ^ c1>>7
+	return c2, c3
+}
+
+// clmul returns the 128-bit carry-less product of x and y as lo, hi
+func clmul(x, y uint64) (uint64, uint64) {
+	lo := bmul64(x, y)
+	hi := bits.Reverse64(bmul64(bits.Reverse64(x), bits.Reverse64(y))) >> 1
+	return lo, hi
+}
+
+// bmul64 returns the low 64 bits of the carry-less product of x and y in
+// constant time, with integer multiplications whose carries fall into the
+// gaps between the bits kept (after BearSSL's ghash_ctmul64)
+func bmul64(x, y uint64) uint64 {
+	const (
+		m0 = 0x1111111111111111
+		m1 = 0x2222222222222222
+		m2 = 0x4444444444444444
+		m3 = 0x8888888888888888
+	)
+	x0, x1, x2, x3 := x&m0, x&m1, x&m2, x&m3
+	y0, y1, y2, y3 := y&m0, y&m1, y&m2, y&m3
+	z0 := x0*y0 ^ x1*y3 ^ x2*y2 ^ x3*y1
+	z1 := x0*y1 ^ x1*y0 ^ x2*y3 ^ x3*y2
+	z2 := x0*y2 ^ x1*y1 ^ x2*y0 ^ x3*y3
+	z3 := x0*y3 ^ x1*y2 ^ x2*y1 ^ x3*y0
+	return z0&m0 | z1&m1 | z2&m2 | z3&m3
+}
+
+// sliceForAppend extends in by n bytes, returning the whole slice and the
+// extension, as the standard library's AEADs do
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	return head, head[len(in):]
+}
@@ -0,0 +1,90 @@
+package gcmsiv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// The worked example of RFC 8452, appendix A
+func TestPolyval(t *testing.T) {
+	p := newPolyval(unhex("25629347589242761d31f826ba4b757b"))
+	p.update(unhex("4f4f95668c83dfb6401762bb2d01a262d1a24ddd2721d006bbe45f20d3c9f362"))
+	var sum [TagSize]byte
+	p.sum(&sum)
+	if got := hex.EncodeToString(sum[:]); got != "f7a3b47b846119fae5b7866cf5e5b77e" {
+		t.Fatalf("POLYVAL = %s", got)
+	}
+}
+
+// Test vectors from RFC 8452, appendix C
+func TestVectors(t *testing.T) {
+	for _, v := range []struct{ key, nonce, plaintext, aad, result string }{
+		{"01000000000000000000000000000000", "030000000000000000000000", "", "", "dc20e2d83f25705bb49e439eca56de25"},
+		{"01000000000000000000000000000000", "030000000000000000000000", "0100000000000000", "", "b5d839330ac7b786578782fff6013b815b287c22493a364c"},
+		{"0100000000000000000000000000000000000000000000000000000000000000", "030000000000000000000000", "", "", "07f5f4169bbf55a8400cd47ea6fd400f"},
+		{"0100000000000000000000000000000000000000000000000000000000000000", "030000000000000000000000", "0100000000000000", "", "c2ef328e5c71c83b843122130f7364b761e0b97427e3df28"},
+	} {
+		aead, err := New(unhex(v.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sealed := aead.Seal(nil, unhex(v.nonce), unhex(v.plaintext), unhex(v.aad))
+		if got := hex.EncodeToString(sealed); got != v.result {
+			t.Errorf("%s/%s: sealed %s, want %s", v.key, v.plaintext, got, v.result)
+			continue
+		}
+		opened, err := aead.Open(nil, unhex(v.nonce), sealed, unhex(v.aad))
+		if err != nil || !bytes.Equal(opened, unhex(v.plaintext)) {
+			t.Errorf("%s/%s: open failed: %v", v.key, v.plaintext, err)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	aead, err := New(bytes.Repeat([]byte{9}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, NonceSize)
+	for _, size := range []int{1, 15, 16, 17, 100, 4097} {
+		plaintext := bytes.Repeat([]byte{byte(size)}, size)
+		aad := []byte("header")
+		sealed := aead.Seal([]byte("prefix"), nonce, plaintext, aad)
+		if len(sealed) != len("prefix")+size+TagSize || !bytes.HasPrefix(sealed, []byte("prefix")) {
+			t.Fatalf("%d: unexpected sealed length %d", size, len(sealed))
+		}
+		sealed = sealed[len("prefix"):]
+		opened, err := aead.Open(nil, nonce, sealed, aad)
+		if err != nil || !bytes.Equal(opened, plaintext) {
+			t.Fatalf("%d: round trip failed: %v", size, err)
+		}
+
+		// a repeated nonce only shows that the message repeated
+		if again := aead.Seal(nil, nonce, plaintext, aad); !bytes.Equal(again, sealed) {
+			t.Fatalf("%d: sealing is not deterministic", size)
+		}
+
+		for i := range sealed {
+			tampered := bytes.Clone(sealed)
+			tampered[i] ^= 1
+			if _, err := aead.Open(nil, nonce, tampered, aad); err == nil {
+				t.Fatalf("%d: flipped byte %d was accepted", size, i)
+			}
+		}
+		if _, err := aead.Open(nil, nonce, sealed, []byte("other")); err == nil {
+			t.Fatalf("%d: wrong additional data was accepted", size)
+		}
+	}
+	if _, err := New(make([]byte, 24)); err == nil {
+		t.Fatal("expected an error for a 24-byte key")
+	}
+}
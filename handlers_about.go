@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/config"
+)
+
+// handleAbout serves the operator's branding, so white-labeled deployments
+// can rename the service and style their share pages without forking clients
+func handleAbout(e *core.RequestEvent, brand config.BrandingConfig) error {
+	e.Response.Header().Set("Cache-Control", "public, max-age=300")
+	return e.JSON(http.StatusOK, map[string]any{
+		"name":  brand.Name,
+		"about": brand.About,
+		"share": map[string]string{
+			"logoUrl":     brand.LogoURL,
+			"accentColor": brand.AccentColor,
+			"footer":      brand.Footer,
+		},
+	})
+}
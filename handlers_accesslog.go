@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/middleware"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// handleGetAccessLog returns the newest entries of the note's access log
+// (?limit=, at most services.MaxAccessLogEntries), newest first
+func handleGetAccessLog(e *core.RequestEvent, phrase, limit string, accessLog *services.AccessLogService) error {
+	n := 0
+	if limit != "" {
+		var err error
+		if n, err = strconv.Atoi(limit); err != nil || n < 1 {
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "limit must be a positive number", nil)
+		}
+	}
+
+	entries, err := accessLog.List(phrase, n)
+	if err != nil {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, err.Error(), nil)
+	}
+	return e.JSON(http.StatusOK, map[string]any{
+		"entries": entries,
+	})
+}
+
+// unloggedOperations are left out of the access log: reading the log itself,
+// HEAD probes, which sync tools repeat often, and rekeying, after which the
+// old passphrase has no note (or log) left
+var unloggedOperations = map[string]bool{
+	"GET /notes/access-log": true,
+	"HEAD /notes":           true,
+	"HEAD /notes/image":     true,
+	"POST /notes/rekey":     true,
+}
+
+// logNoteAccess appends successful requests to the note's encrypted access log
+func logNoteAccess(accessLog *services.AccessLogService) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		err := e.Next()
+		if err != nil || e.Status() >= http.StatusBadRequest {
+			return err
+		}
+
+		operation := accessLogOperation(e.Request.Pattern)
+		if operation == "" || unloggedOperations[operation] {
+			return nil
+		}
+		accessLog.Append(middleware.Phrase(e), operation, e.Request.UserAgent())
+		return nil
+	}
+}
+
+// accessLogOperation turns a route pattern like "GET /api/secretnotes/v2/notes/image"
+// into "GET /notes/image", dropping the API prefix and version
+func accessLogOperation(pattern string) string {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		return ""
+	}
+	path = strings.TrimPrefix(path, "/api/secretnotes")
+	path = strings.TrimPrefix(path, "/v2")
+	return method + " " + path
+}
+
+// registerAccessLogHooks drops a note's access log when the note is deleted
+// or moved to a new passphrase
+func registerAccessLogHooks(app core.App, accessLog *services.AccessLogService) {
+	app.OnRecordAfterUpdateSuccess("notes").BindFunc(func(e *core.RecordEvent) error {
+		if oldHash := e.Record.Original().GetString("phrase_hash"); oldHash != e.Record.GetString("phrase_hash") {
+			accessLog.DeleteForPhrase(e.App, oldHash)
+		}
+		return e.Next()
+	})
+
+	app.OnRecordAfterDeleteSuccess("notes").BindFunc(func(e *core.RecordEvent) error {
+		accessLog.DeleteForPhrase(e.App, e.Record.GetString("phrase_hash"))
+		return e.Next()
+	})
+}
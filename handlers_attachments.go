@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// handleListAttachments describes the note's attachments, oldest first,
+// without sending their content, along with the retention policy they are
+// kept under
+func handleListAttachments(e *core.RequestEvent, phrase string, fileService *services.FileService) error {
+	attachments, err := fileService.ListAttachments(phrase)
+	if err != nil {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+	retention, err := fileService.AttachmentRetention(phrase)
+	if err != nil {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, err.Error(), nil)
+	}
+	return e.JSON(http.StatusOK, map[string]any{
+		"attachments": attachments,
+		"retention":   retention,
+	})
+}
+
+// handleSetAttachmentRetention sets the note's own attachment retention rule,
+// or clears it when the rule is zero, and answers with the policy that now
+// applies
+func handleSetAttachmentRetention(e *core.RequestEvent, phrase string, retention services.Retention, noteService *services.NoteService, fileService *services.FileService) error {
+	if err := noteService.SetAttachmentRetention(phrase, retention); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrNoteNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrInvalidRetention):
+			status = http.StatusBadRequest
+		}
+		return apierror.Respond(e, status, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+
+	policy, err := fileService.AttachmentRetention(phrase)
+	if err != nil {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, err.Error(), nil)
+	}
+	return e.JSON(http.StatusOK, map[string]any{
+		"retention": policy,
+	})
+}
+
+// handleDeleteAttachment removes one attachment and points the note at the
+// one served next, if any
+func handleDeleteAttachment(e *core.RequestEvent, phrase, id string, noteService *services.NoteService, fileService *services.FileService) error {
+	imageHash, err := fileService.DeleteAttachment(phrase, id)
+	if err != nil {
+		return apierror.Respond(e, http.StatusNotFound, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+
+	if err := noteService.UpdateNoteImageHash(phrase, imageHash); err != nil && !errors.Is(err, services.ErrNoteNotFound) {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, "Failed to update image reference: "+err.Error(), nil)
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"message":  "Attachment deleted successfully",
+		"hasImage": imageHash != "",
+	})
+}
+
+// handleRenameAttachment changes an attachment's filename without touching its data
+func handleRenameAttachment(e *core.RequestEvent, phrase, id string, fileService *services.FileService) error {
+	data := struct {
+		Name string `json:"name"`
+	}{}
+	if err := e.BindBody(&data); err != nil {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Invalid request body", nil)
+	}
+
+	attachment, err := fileService.RenameAttachment(phrase, id, data.Name)
+	if err != nil {
+		code := apierror.FromError(err, apierror.Internal)
+		return apierror.Respond(e, code.Status(), code, err.Error(), nil)
+	}
+	return e.JSON(http.StatusOK, attachment)
+}
+
+// registerAttachmentHooks releases an attachment's shared content when the
+// attachment is deleted or points at other content (after a rekey), so stored
+// data goes away with its last attachment
+func registerAttachmentHooks(app core.App, fileService *services.FileService) {
+	app.OnRecordAfterUpdateSuccess("encrypted_files").BindFunc(func(e *core.RecordEvent) error {
+		if old := e.Record.Original().GetString("content"); old != "" && old != e.Record.GetString("content") {
+			if err := fileService.ReleaseContent(e.App, old); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}
+		return e.Next()
+	})
+
+	app.OnRecordAfterDeleteSuccess("encrypted_files").BindFunc(func(e *core.RecordEvent) error {
+		if content := e.Record.GetString("content"); content != "" {
+			if err := fileService.ReleaseContent(e.App, content); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}
+		return e.Next()
+	})
+}
+
+// registerShredHooks shreds attachment files (see FileService.ShredFile) as
+// records are deleted or their files replaced. Both hooks run just ahead of
+// PocketBase's own, which remove the files from storage.
+func registerShredHooks(app core.App, fileService *services.FileService) {
+	app.OnModelAfterDeleteSuccess().Bind(&hook.Handler[*core.ModelEvent]{
+		Func: func(e *core.ModelEvent) error {
+			if rec, ok := e.Model.(*core.Record); ok {
+				if err := fileService.ShredRecordFiles(e.App, rec); err != nil {
+					log.Printf("Warning: failed to shred deleted files: %v", err)
+				}
+			}
+			return e.Next()
+		},
+		Priority: -100,
+	})
+
+	app.OnRecordAfterUpdateSuccess("encrypted_files", "attachment_contents").Bind(&hook.Handler[*core.RecordEvent]{
+		Func: func(e *core.RecordEvent) error {
+			if err := fileService.ShredReplacedFiles(e.App, e.Record); err != nil {
+				log.Printf("Warning: failed to shred replaced files: %v", err)
+			}
+			return e.Next()
+		},
+		Priority: -100,
+	})
+}
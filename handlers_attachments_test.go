@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ktappdev/secretnotes-go-backend/services"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// migratedApp returns a bootstrapped app with every migration applied, its
+// data kept in a temporary directory
+func migratedApp(t *testing.T) *pocketbase.PocketBase {
+	t.Helper()
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.ResetBootstrapState() })
+	if err := app.RunAllMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+// newEvent returns a request event on app whose response is recorded
+func newEvent(app core.App, method, target string, body io.Reader) (*core.RequestEvent, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	e := &core.RequestEvent{App: app}
+	e.Request, e.Response = httptest.NewRequest(method, target, body), rec
+	return e, rec
+}
+
+// section returns a reader over data, as uploads are stored from
+func section(data string) *io.SectionReader {
+	return io.NewSectionReader(strings.NewReader(data), 0, int64(len(data)))
+}
+
+func TestAttachmentContentRefs(t *testing.T) {
+	app := migratedApp(t)
+	fileService := services.NewFileService(app, services.NewEncryptionService())
+	registerAttachmentHooks(app, fileService)
+
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+
+	// content returns the stored attachment content, failing unless there is
+	// exactly one
+	content := func() *core.Record {
+		t.Helper()
+		records, err := app.FindAllRecords("attachment_contents")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 {
+			t.Fatalf("expected one stored content, got %d", len(records))
+		}
+		return records[0]
+	}
+	stored := func(rec *core.Record) bool {
+		t.Helper()
+		ok, err := fsys.Exists(rec.BaseFilesPath() + "/" + rec.GetString("data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	// PocketBase removes a deleted record's files in the background
+	deleted := func(rec *core.Record) bool {
+		t.Helper()
+		for i := 0; i < 50; i++ {
+			if !stored(rec) {
+				return true
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		return false
+	}
+	importFiles := func(phrase string, n int) {
+		t.Helper()
+		files := make([]services.DecryptedFile, n)
+		for i := range files {
+			files[i] = services.DecryptedFile{Name: "same.txt", ContentType: "text/plain", Data: []byte("the same attachment")}
+		}
+		err := app.RunInTransaction(func(txApp core.App) error {
+			_, err := fileService.ImportFiles(txApp, phrase, files)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	attachments := func(phrase string) []services.Attachment {
+		t.Helper()
+		list, err := fileService.ListAttachments(phrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+
+	phrase := "content-refs-phrase"
+	importFiles(phrase, 2)
+	if refs := content().GetInt("refs"); refs != 2 {
+		t.Fatalf("expected two attachments to share the content, got %d refs", refs)
+	}
+
+	// re-uploading the same content replaces both attachments with one
+	if _, err := fileService.StoreEncryptedFile(phrase, section("the same attachment"), "again.txt", "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if refs := content().GetInt("refs"); refs != 1 {
+		t.Fatalf("expected the replaced attachments to be released, got %d refs", refs)
+	}
+
+	// deleting one of two references keeps the content
+	importFiles(phrase, 1)
+	list := attachments(phrase)
+	if len(list) != 2 {
+		t.Fatalf("expected two attachments, got %d", len(list))
+	}
+	if _, err := fileService.DeleteAttachment(phrase, list[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	old := content()
+	if refs := old.GetInt("refs"); refs != 1 {
+		t.Fatalf("expected one reference left, got %d", refs)
+	}
+	if !stored(old) {
+		t.Fatal("expected the content to still be stored")
+	}
+
+	// rekeying seals the content under the new phrase and releases the old one
+	newPhrase := "content-refs-new-phrase"
+	err = app.RunInTransaction(func(txApp core.App) error {
+		_, err := fileService.RekeyFiles(txApp, phrase, newPhrase)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rekeyed := content()
+	if rekeyed.Id == old.Id || rekeyed.GetInt("refs") != 1 {
+		t.Fatalf("expected a new content with one reference, got %s with %d", rekeyed.Id, rekeyed.GetInt("refs"))
+	}
+	if !deleted(old) {
+		t.Fatal("expected the old content's data to be deleted")
+	}
+
+	// releasing the last reference deletes the content and its data
+	list = attachments(newPhrase)
+	if len(list) != 1 {
+		t.Fatalf("expected one attachment after rekeying, got %d", len(list))
+	}
+	if _, err := fileService.DeleteAttachment(newPhrase, list[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := app.CountRecords("attachment_contents"); n != 0 {
+		t.Fatalf("expected the content to be deleted, got %d", n)
+	}
+	if !deleted(rekeyed) {
+		t.Fatal("expected the content's data to be deleted")
+	}
+}
+
+func TestDeleteAttachment(t *testing.T) {
+	app := migratedApp(t)
+	encryption := services.NewEncryptionService()
+	noteService := services.NewNoteService(app, encryption)
+	fileService := services.NewFileService(app, encryption)
+	registerAttachmentHooks(app, fileService)
+
+	phrase := "delete-attachment-phrase"
+	if _, _, err := noteService.GetOrCreateNote(phrase); err != nil {
+		t.Fatal(err)
+	}
+	// the last two share their stored content
+	files := []services.DecryptedFile{
+		{Name: "first.txt", ContentType: "text/plain", Data: []byte("the first attachment")},
+		{Name: "second.txt", ContentType: "text/plain", Data: []byte("a shared attachment")},
+		{Name: "third.txt", ContentType: "text/plain", Data: []byte("a shared attachment")},
+	}
+	var imageHash string
+	err := app.RunInTransaction(func(txApp core.App) error {
+		var err error
+		imageHash, err = fileService.ImportFiles(txApp, phrase, files)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := noteService.UpdateNoteImageHash(phrase, imageHash); err != nil {
+		t.Fatal(err)
+	}
+	list, err := fileService.ListAttachments(phrase)
+	if err != nil || len(list) != 3 {
+		t.Fatalf("expected three attachments, got %d (%v)", len(list), err)
+	}
+	ids := map[string]string{}
+	for _, a := range list {
+		ids[a.Name] = a.ID
+	}
+
+	deleteAttachment := func(phrase, id string) (int, bool) {
+		t.Helper()
+		e, rec := newEvent(app, http.MethodDelete, "/api/secretnotes/notes/attachments/"+id, nil)
+		if err := handleDeleteAttachment(e, phrase, id, noteService, fileService); err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			HasImage bool `json:"hasImage"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body.HasImage
+	}
+	served := func() string {
+		t.Helper()
+		file, err := fileService.OpenFile(phrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	noteImageHash := func() string {
+		t.Helper()
+		note, err := noteService.FindNote(phrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return note.ImageHash
+	}
+
+	// deleting the served attachment moves the note to the next one
+	if code, hasImage := deleteAttachment(phrase, ids["first.txt"]); code != http.StatusOK || !hasImage {
+		t.Fatalf("expected the attachment deleted with others left, got %d", code)
+	}
+	if served() != "a shared attachment" {
+		t.Fatal("expected the remaining attachments readable")
+	}
+	if got := noteImageHash(); got == "" || got == imageHash {
+		t.Fatalf("expected the note to follow the remaining attachment, got %q", got)
+	}
+	followed := noteImageHash()
+
+	// deleting one of two sharing content releases its reference only
+	if code, _ := deleteAttachment(phrase, ids["second.txt"]); code != http.StatusOK {
+		t.Fatalf("expected the attachment deleted, got %d", code)
+	}
+	contents, err := app.FindAllRecords("attachment_contents")
+	if err != nil || len(contents) != 1 || contents[0].GetInt("refs") != 1 {
+		t.Fatalf("expected the shared content kept with one reference, got %d records (%v)", len(contents), err)
+	}
+	if served() != "a shared attachment" || noteImageHash() != followed {
+		t.Fatal("expected the last attachment readable and still referenced")
+	}
+	checkContentRefs(t, app)
+
+	// another passphrase can't delete it
+	if code, _ := deleteAttachment("delete-attachment-other", ids["third.txt"]); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for another passphrase's attachment, got %d", code)
+	}
+
+	if code, hasImage := deleteAttachment(phrase, ids["third.txt"]); code != http.StatusOK || hasImage {
+		t.Fatalf("expected the last attachment deleted, got %d", code)
+	}
+	if got := noteImageHash(); got != "" {
+		t.Fatalf("expected no image reference, got %q", got)
+	}
+	if n, _ := app.CountRecords("attachment_contents"); n != 0 {
+		t.Fatalf("expected the content released, got %d", n)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/middleware"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// blobKey returns the client's blob lookup key from the X-Blob-Key header
+func blobKey(e *core.RequestEvent) string {
+	return e.Request.Header.Get("X-Blob-Key")
+}
+
+// handlePutBlob stores client-encrypted ciphertext under the lookup key,
+// replacing any blob already there. The decoded ciphertext counts against
+// the note size limit. The response leaves out the ciphertext.
+func handlePutBlob(e *core.RequestEvent, maxBytes int64, blobService *services.BlobService) error {
+	data := struct {
+		Format     services.BlobFormat `json:"format"`
+		Ciphertext string              `json:"ciphertext"`
+	}{}
+	if err := e.BindBody(&data); err != nil {
+		if middleware.IsBodyTooLarge(err) {
+			return middleware.PayloadTooLarge(e, "note", maxBytes, -1)
+		}
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Invalid request body", nil)
+	}
+	padding := len(data.Ciphertext) - len(strings.TrimRight(data.Ciphertext, "="))
+	if size := int64(base64.StdEncoding.DecodedLen(len(data.Ciphertext)) - padding); size > maxBytes {
+		return middleware.PayloadTooLarge(e, "note", maxBytes, size)
+	}
+
+	blob, created, err := blobService.PutBlob(blobKey(e), data.Format, data.Ciphertext)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidBlob) {
+			status = http.StatusBadRequest
+		}
+		return apierror.Respond(e, status, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	blob.Ciphertext = ""
+	return e.JSON(status, blob)
+}
+
+// handleGetBlob returns the blob stored under the lookup key, verbatim
+func handleGetBlob(e *core.RequestEvent, blobService *services.BlobService) error {
+	blob, err := blobService.GetBlob(blobKey(e))
+	if err != nil {
+		return blobError(e, err)
+	}
+
+	e.Response.Header().Set("Cache-Control", "no-store")
+	return e.JSON(http.StatusOK, blob)
+}
+
+// handleDeleteBlob removes the blob stored under the lookup key
+func handleDeleteBlob(e *core.RequestEvent, blobService *services.BlobService) error {
+	if err := blobService.DeleteBlob(blobKey(e)); err != nil {
+		return blobError(e, err)
+	}
+
+	return e.JSON(http.StatusOK, map[string]string{
+		"message": "Blob deleted",
+	})
+}
+
+func blobError(e *core.RequestEvent, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrInvalidBlob):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrBlobNotFound):
+		status = http.StatusNotFound
+	}
+	return apierror.Respond(e, status, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"cmp"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/config"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// handleCapabilities tells clients what this server supports before they rely
+// on it: the optional features that are enabled, payload limits, and the
+// cipher new data is encrypted with (which depends on the host's CPU), and the
+// key export archives are signed with, if any
+func handleCapabilities(e *core.RequestEvent, limits config.LimitsConfig, features map[string]bool, encryption *services.Service, signer *services.ArchiveSigner) error {
+	e.Response.Header().Set("Cache-Control", "public, max-age=300")
+	ciphers, kdfs := services.Ciphers, services.KDFs
+	if encryption.FIPS() {
+		ciphers, kdfs = services.FIPSCiphers, services.FIPSKDFs
+	}
+	var signing map[string]string
+	if signer != nil {
+		signing = map[string]string{
+			"algorithm": services.SignatureEd25519,
+			"keyId":     signer.KeyID(),
+			"publicKey": base64.StdEncoding.EncodeToString(signer.PublicKey()),
+		}
+	}
+	return e.JSON(http.StatusOK, map[string]any{
+		"features": features,
+		"limits": map[string]int64{
+			"maxNoteBytes":   limits.MaxNoteBytes,
+			"maxUploadBytes": limits.MaxUploadBytes,
+		},
+		"encryption": map[string]any{
+			"cipher":      encryption.Cipher,
+			"chunkCipher": cmp.Or(encryption.ChunkCipher, encryption.Cipher),
+			"ciphers":     ciphers,
+			"aesHardware": services.HasAESHardware(),
+			"kdf":         encryption.KDF,
+			"kdfs":        kdfs,
+			"fips":        encryption.FIPS(),
+		},
+		"archiveSigningKey": signing,
+	})
+}
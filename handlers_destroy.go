@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// handleScheduleDestruction schedules the note's deletion at the given time, or
+// cancels a pending one when it is zero. Unlike TTL-on-read, the note stays
+// readable until then; a cron job deletes it along with its attachments.
+func handleScheduleDestruction(e *core.RequestEvent, phrase string, at time.Time, noteService *services.NoteService) error {
+	note, err := noteService.ScheduleDestruction(phrase, at)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrNoteNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrDestroyInPast):
+			status = http.StatusBadRequest
+		}
+		return apierror.Respond(e, status, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"destroyAt": note.DestroyAt,
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// handleSubscribeDigest creates or replaces the note's digest email subscription
+func handleSubscribeDigest(e *core.RequestEvent, phrase, email, mode string, digestService *services.DigestService) error {
+	if mode == "" {
+		mode = services.DigestModeDaily
+	}
+
+	sub, err := digestService.Subscribe(phrase, email, mode)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrNoteNotFound) {
+			status = http.StatusNotFound
+		}
+		return apierror.Respond(e, status, apierror.FromError(err, apierror.BadRequest), err.Error(), nil)
+	}
+
+	return e.JSON(http.StatusOK, sub)
+}
+
+// handleGetDigest returns the note's digest email subscription
+func handleGetDigest(e *core.RequestEvent, phrase string, digestService *services.DigestService) error {
+	sub, err := digestService.GetSubscription(phrase)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrSubscriptionNotFound) {
+			status = http.StatusNotFound
+		}
+		return apierror.Respond(e, status, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+
+	return e.JSON(http.StatusOK, sub)
+}
+
+// handleUnsubscribeDigest removes the note's digest email subscription
+func handleUnsubscribeDigest(e *core.RequestEvent, phrase string, digestService *services.DigestService) error {
+	if err := digestService.Unsubscribe(phrase); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrSubscriptionNotFound) {
+			status = http.StatusNotFound
+		}
+		return apierror.Respond(e, status, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+
+	return e.JSON(http.StatusOK, map[string]string{
+		"message": "Unsubscribed from digest emails",
+	})
+}
+
+// registerDigestHooks records note activity for digest subscribers and keeps
+// subscriptions attached to their note across rekeys and deletes.
+func registerDigestHooks(app core.App, noteService *services.NoteService, digestService *services.DigestService) {
+	noteService.OnAccess(func(phraseHash string) {
+		digestService.RecordEvent(app, phraseHash, services.DigestEventAccessed)
+	})
+
+	app.OnRecordAfterUpdateSuccess("notes").BindFunc(func(e *core.RecordEvent) error {
+		oldHash := e.Record.Original().GetString("phrase_hash")
+		newHash := e.Record.GetString("phrase_hash")
+		if oldHash != newHash {
+			digestService.MovePhrase(e.App, oldHash, newHash)
+		} else {
+			digestService.RecordEvent(e.App, newHash, services.DigestEventChanged)
+		}
+		return e.Next()
+	})
+
+	app.OnRecordAfterCreateSuccess("encrypted_files").BindFunc(func(e *core.RecordEvent) error {
+		digestService.RecordEvent(e.App, e.Record.GetString("phrase_hash"), services.DigestEventAttachment)
+		return e.Next()
+	})
+
+	app.OnRecordAfterDeleteSuccess("notes").BindFunc(func(e *core.RecordEvent) error {
+		digestService.DeleteForPhrase(e.App, e.Record.GetString("phrase_hash"))
+		return e.Next()
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/cryptoutil"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// handleExport sends the note and all attachments as a single archive,
+// encrypted with the passphrase (see services.BuildArchive) and signed by
+// signer unless it is nil. It never creates a note: unknown passphrases get 404.
+func handleExport(e *core.RequestEvent, phrase string, signer *services.ArchiveSigner, noteService *services.NoteService, fileService *services.FileService) error {
+	note, err := noteService.FindNote(phrase)
+	if err != nil {
+		return apierror.Respond(e, http.StatusNotFound, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+	files, err := fileService.RetrieveDecryptedFiles(phrase)
+	if err != nil {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.FromError(err, apierror.Internal), "Failed to read attachments", nil)
+	}
+	defer func() {
+		for _, file := range files {
+			cryptoutil.Wipe(file.Data)
+		}
+	}()
+
+	now := time.Now()
+	archive, err := services.BuildArchive(note, files, now, signer)
+	if err != nil {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, "Failed to build archive", nil)
+	}
+	sealed, err := fileService.Encryption.EncryptData(archive, phrase)
+	cryptoutil.Wipe(archive)
+	if err != nil {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, "Failed to encrypt archive", nil)
+	}
+
+	filename := fmt.Sprintf("secretnotes-%s.tar.enc", now.UTC().Format("20060102-150405"))
+	e.Response.Header().Set("Content-Type", "application/octet-stream")
+	e.Response.Header().Set("Content-Disposition", services.ContentDisposition(services.DispositionAttachment, filename))
+	e.Response.Header().Set("Content-Length", strconv.Itoa(len(sealed)))
+	e.Response.Header().Set("Cache-Control", "no-store")
+	e.Response.WriteHeader(http.StatusOK)
+	_, err = e.Response.Write(sealed)
+	return err
+}
+
+// handleExportNote sends the decrypted note as a Markdown, plain text or JSON
+// download. Like handleExport it never creates a note.
+func handleExportNote(e *core.RequestEvent, phrase, format string, noteService *services.NoteService) error {
+	if format == "" {
+		format = services.FormatText
+	}
+	note, err := noteService.FindNote(phrase)
+	if err != nil {
+		return apierror.Respond(e, http.StatusNotFound, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+	body, contentType, err := services.RenderNote(note, format)
+	if err != nil {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, err.Error(), nil)
+	}
+	defer cryptoutil.Wipe(body)
+
+	e.Response.Header().Set("Content-Type", contentType)
+	e.Response.Header().Set("Content-Disposition", services.ContentDisposition(services.DispositionAttachment, services.NoteFilename(note, format)))
+	e.Response.Header().Set("Cache-Control", "no-store")
+	e.Response.WriteHeader(http.StatusOK)
+	_, err = e.Response.Write(body)
+	return err
+}
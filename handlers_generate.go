@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// handleGeneratePhrase suggests a passphrase of random BIP39 words, so users
+// needn't invent one. words and separator are the query parameters, and
+// default to six words joined by dashes. Nothing is stored or logged.
+func handleGeneratePhrase(e *core.RequestEvent) error {
+	query := e.Request.URL.Query()
+	n := services.DefaultGeneratedWords
+	if words := query.Get("words"); words != "" {
+		var err error
+		if n, err = strconv.Atoi(words); err != nil {
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "words must be a number", nil)
+		}
+	}
+	// an empty separator runs the words together
+	separator := services.DefaultSeparator
+	if query.Has("separator") {
+		separator = query.Get("separator")
+	}
+
+	phrase, err := services.GeneratePassphrase(n, separator)
+	if err != nil {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, err.Error(), map[string]any{
+			"minWords": services.MinGeneratedWords,
+			"maxWords": services.MaxGeneratedWords,
+		})
+	}
+	e.Response.Header().Set("Cache-Control", "no-store")
+	return e.JSON(http.StatusOK, phrase)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/middleware"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// handleHeadNote describes the note in headers without decrypting it or, unlike
+// GET, creating it: X-Note-Exists, X-Note-Size (decrypted bytes) and Last-Modified
+func handleHeadNote(e *core.RequestEvent, phrase string, noteService *services.NoteService) error {
+	stat, err := noteService.StatNote(phrase)
+	if err != nil {
+		if errors.Is(err, services.ErrNoteNotFound) {
+			e.Response.Header().Set("X-Note-Exists", "false")
+			apierror.SetCode(e, apierror.NoteNotFound)
+			return e.NoContent(http.StatusNotFound)
+		}
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, err.Error(), nil)
+	}
+
+	header := e.Response.Header()
+	header.Set("X-Note-Exists", "true")
+	header.Set("X-Note-Size", strconv.FormatInt(stat.Size, 10))
+	header.Set("Last-Modified", stat.Updated.UTC().Format(http.TimeFormat))
+	header.Set("Cache-Control", "private, no-cache")
+	return e.NoContent(http.StatusOK)
+}
+
+// handleHeadImage answers with the headers GET /notes/image would send,
+// Content-Length being the decrypted size, without reading the attachment
+func handleHeadImage(e *core.RequestEvent, phrase string, fileService *services.FileService) error {
+	stat, err := fileService.StatFile(phrase)
+	if err != nil {
+		// GET's 404, minus the body a HEAD response can't carry
+		apierror.SetCode(e, apierror.FromError(err, apierror.Internal))
+		return e.NoContent(http.StatusNotFound)
+	}
+	e.Response.Header().Set("Cache-Control", "private, no-cache")
+	if middleware.NotModified(e, stat.ETag, stat.Modified) {
+		return e.NoContent(http.StatusNotModified)
+	}
+
+	header := e.Response.Header()
+	header.Set("Content-Type", stat.ContentType)
+	header.Set("Content-Length", strconv.FormatInt(stat.Size, 10))
+	header.Set("Accept-Ranges", "bytes")
+	return e.NoContent(http.StatusOK)
+}
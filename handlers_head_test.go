@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+func TestHeadNote(t *testing.T) {
+	app := migratedApp(t)
+	noteService := services.NewNoteService(app, services.NewEncryptionService())
+	phrase := "head-note-phrase"
+
+	e, rec := newEvent(app, http.MethodHead, "/api/secretnotes/notes", nil)
+	if err := handleHeadNote(e, phrase, noteService); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusNotFound || rec.Header().Get("X-Note-Exists") != "false" || rec.Body.Len() != 0 {
+		t.Fatalf("expected an empty 404 with X-Note-Exists false, got %d %q %q", rec.Code, rec.Header().Get("X-Note-Exists"), rec.Body.String())
+	}
+	if _, err := noteService.StatNote(phrase); err == nil {
+		t.Fatal("expected HEAD not to create the note")
+	}
+
+	if _, _, err := noteService.GetOrCreateNote(phrase); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := noteService.UpdateNote(phrase, "hello", services.NoteMetadata{}); err != nil {
+		t.Fatal(err)
+	}
+	e, rec = newEvent(app, http.MethodHead, "/api/secretnotes/notes", nil)
+	if err := handleHeadNote(e, phrase, noteService); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Fatalf("expected an empty 200, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("X-Note-Exists") != "true" || rec.Header().Get("X-Note-Size") != "5" {
+		t.Fatalf("expected the note's existence and size, got %v", rec.Header())
+	}
+	if _, err := http.ParseTime(rec.Header().Get("Last-Modified")); err != nil {
+		t.Fatalf("expected a Last-Modified date, got %q", rec.Header().Get("Last-Modified"))
+	}
+}
+
+func TestHeadImage(t *testing.T) {
+	app := migratedApp(t)
+	fileService := services.NewFileService(app, services.NewEncryptionService())
+	phrase := "head-image-phrase"
+
+	e, rec := newEvent(app, http.MethodHead, "/api/secretnotes/notes/image", nil)
+	if err := handleHeadImage(e, phrase, fileService); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusNotFound || rec.Body.Len() != 0 {
+		t.Fatalf("expected an empty 404, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	if _, err := fileService.StoreEncryptedFile(phrase, section("image data"), "image.txt", "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	e, rec = newEvent(app, http.MethodHead, "/api/secretnotes/notes/image", nil)
+	if err := handleHeadImage(e, phrase, fileService); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Fatalf("expected an empty 200, got %d %q", rec.Code, rec.Body.String())
+	}
+	header := rec.Header()
+	if header.Get("Content-Length") != "10" || header.Get("Content-Type") != "text/plain" || header.Get("ETag") == "" {
+		t.Fatalf("expected the decrypted size, type and version, got %v", header)
+	}
+	if _, err := http.ParseTime(header.Get("Last-Modified")); err != nil {
+		t.Fatalf("expected a Last-Modified date, got %q", header.Get("Last-Modified"))
+	}
+
+	// a client with this version gets 304
+	e, rec = newEvent(app, http.MethodHead, "/api/secretnotes/notes/image", nil)
+	e.Request.Header.Set("If-None-Match", header.Get("ETag"))
+	if err := handleHeadImage(e, phrase, fileService); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("expected an empty 304, got %d %q", rec.Code, rec.Body.String())
+	}
+}
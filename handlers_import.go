@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/config"
+	"github.com/ktappdev/secretnotes-go-backend/cryptoutil"
+	"github.com/ktappdev/secretnotes-go-backend/middleware"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// handleImport restores a note and its attachments from an archive written by
+// handleExport, which must be encrypted with the request's passphrase and, if
+// trust requires it, signed by a trusted key. It refuses to overwrite a note
+// that already has content or attachments.
+func handleImport(e *core.RequestEvent, phrase string, limits config.LimitsConfig, multipartMemory int64, scan func(context.Context, io.Reader) error, trust services.ArchiveTrust, noteService *services.NoteService, fileService *services.FileService) error {
+	if err := e.Request.ParseMultipartForm(multipartMemory); err != nil {
+		if middleware.IsBodyTooLarge(err) {
+			return middleware.PayloadTooLarge(e, "upload", limits.MaxUploadBytes, -1)
+		}
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Failed to parse form", nil)
+	}
+	file, _, err := e.Request.FormFile("archive")
+	if err != nil {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "No archive file provided", nil)
+	}
+	defer file.Close()
+	sealed, err := io.ReadAll(file)
+	if err != nil {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Failed to read archive", nil)
+	}
+
+	raw, err := fileService.Encryption.DecryptData(sealed, phrase)
+	if err != nil {
+		return apierror.Respond(e, http.StatusUnprocessableEntity, apierror.FromError(err, apierror.DecryptionFailed), "Archive could not be decrypted with this passphrase", nil)
+	}
+	defer cryptoutil.Wipe(raw)
+	archive, err := services.ReadArchive(raw)
+	if err != nil {
+		return apierror.Respond(e, http.StatusUnprocessableEntity, apierror.FromError(err, apierror.InvalidArchive), err.Error(), nil)
+	}
+	if err := trust.Check(archive); err != nil {
+		return apierror.Respond(e, http.StatusUnprocessableEntity, apierror.InvalidArchive, err.Error(), nil)
+	}
+	var signature map[string]any
+	if archive.SignedBy != nil {
+		signature = map[string]any{
+			"keyId":   services.SigningKeyID(archive.SignedBy),
+			"trusted": trust.Trusted(archive),
+		}
+	}
+
+	meta, err := services.NormalizeMetadata(services.NoteMetadata{
+		Title: &archive.Manifest.Note.Title,
+		Tags:  &archive.Manifest.Note.Tags,
+	})
+	if err != nil {
+		return apierror.Respond(e, http.StatusUnprocessableEntity, apierror.InvalidArchive, err.Error(), nil)
+	}
+	if err := noteService.CheckNoteQuota(e.App, phrase, int64(len(archive.Message))); err != nil {
+		return quotaError(e, err)
+	}
+	var attachmentBytes int64
+	for i, attachment := range archive.Attachments {
+		size := int64(len(attachment.Data))
+		if size > limits.MaxUploadBytes {
+			return middleware.PayloadTooLarge(e, "upload", limits.MaxUploadBytes, size)
+		}
+		attachmentBytes += size
+
+		// archives get the same content checks as uploads
+		contentType, err := services.SniffContentType(attachment.Data, attachment.ContentType)
+		if err != nil {
+			return apierror.Respond(e, http.StatusUnsupportedMediaType, apierror.UnsupportedMediaType, attachment.Name+": "+err.Error(), nil)
+		}
+		if !services.ContentTypeAllowed(contentType, limits.UploadTypes) {
+			return uploadTypeNotAllowed(e, contentType, limits.UploadTypes)
+		}
+		archive.Attachments[i].ContentType = contentType
+		if err := scan(e.Request.Context(), bytes.NewReader(attachment.Data)); err != nil {
+			return scanRejected(e, attachment.Name, err)
+		}
+	}
+	// the note has no attachments yet, or the import is refused below
+	if err := noteService.CheckAttachmentQuota(e.App, phrase, attachmentBytes, len(archive.Attachments), true); err != nil {
+		return quotaError(e, err)
+	}
+
+	var note *services.Note
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		// stray attachments would be mixed up with the imported ones
+		if count, err := fileService.CountFiles(txApp, phrase); err != nil {
+			return err
+		} else if count > 0 {
+			return services.ErrPhraseInUse
+		}
+		imageHash, err := fileService.ImportFiles(txApp, phrase, archive.Attachments)
+		if err != nil {
+			return err
+		}
+		note, err = noteService.ImportNote(txApp, phrase, archive.Message, imageHash, meta)
+		return err
+	})
+	var quotaErr *services.QuotaError
+	if errors.As(err, &quotaErr) {
+		return quotaError(e, err)
+	}
+	if err != nil {
+		if errors.Is(err, services.ErrPhraseInUse) {
+			return apierror.Respond(e, http.StatusConflict, apierror.PassphraseInUse, "A note with content or attachments already exists for this passphrase", nil)
+		}
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+
+	return e.JSON(http.StatusCreated, map[string]any{
+		"id":       note.ID,
+		"message":  note.Message,
+		"title":    note.Title,
+		"tags":     note.Tags,
+		"hasImage": note.ImageHash != "",
+		"created":  note.Created,
+		"updated":  note.Updated,
+		"imported": map[string]any{
+			"exportedAt":  archive.Manifest.ExportedAt,
+			"attachments": len(archive.Attachments),
+			// this server keeps no message history, so earlier revisions are dropped
+			"versions":        0,
+			"versionsSkipped": len(archive.Versions),
+			"signature":       signature,
+		},
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// handleAcquireLock takes or renews the advisory editing lock for the session.
+// When another session holds it, 409 is returned along with that lock's expiry.
+func handleAcquireLock(e *core.RequestEvent, phrase, sessionID string, lockService *services.LockService) error {
+	if sessionID == "" {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "sessionId is required", nil)
+	}
+
+	lock, err := lockService.Acquire(phrase, sessionID)
+	if errors.Is(err, services.ErrLockHeld) {
+		return apierror.Respond(e, http.StatusConflict, apierror.NoteLocked, err.Error(), map[string]any{
+			"expiresAt": lock.ExpiresAt,
+		})
+	}
+
+	return e.JSON(http.StatusOK, lock)
+}
+
+// handleGetLock reports whether the note is currently locked, without revealing the holder
+func handleGetLock(e *core.RequestEvent, phrase string, lockService *services.LockService) error {
+	lock, ok := lockService.Current(phrase)
+	if !ok {
+		return e.JSON(http.StatusOK, map[string]any{
+			"locked": false,
+		})
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"locked":    true,
+		"expiresAt": lock.ExpiresAt,
+	})
+}
+
+// handleReleaseLock drops the session's lock (a no-op if it doesn't hold it)
+func handleReleaseLock(e *core.RequestEvent, phrase, sessionID string, lockService *services.LockService) error {
+	lockService.Release(phrase, sessionID)
+
+	return e.JSON(http.StatusOK, map[string]string{
+		"message": "Lock released",
+	})
+}
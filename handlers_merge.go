@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// errImageConflict is returned when both notes being merged carry an image;
+// a note only has a single image slot so one of them must be removed first.
+var errImageConflict = errors.New("both notes have an image; delete one before merging")
+
+// handleMergeNote appends the source note to the destination note, moves the
+// source attachments under the destination passphrase and deletes the source.
+func handleMergeNote(e *core.RequestEvent, sourcePhrase, destPhrase string, noteService *services.NoteService, fileService *services.FileService) error {
+	if sourcePhrase == destPhrase {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadPassphrase, "Source and destination passphrases must differ", nil)
+	}
+
+	// the middleware only moved the request's passphrase off a legacy hash
+	if _, err := noteService.MoveLegacyPhraseHash(sourcePhrase); err != nil {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, err.Error(), nil)
+	}
+
+	// the source's fields are all decrypted; the request's scope covers the destination
+	defer noteService.Encryption.Scope(sourcePhrase)()
+
+	// the source is deleted by the merge, so it must not be read-only either
+	readOnly, err := noteService.IsReadOnly(sourcePhrase)
+	if err != nil {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, err.Error(), nil)
+	}
+	if readOnly {
+		return noteReadOnly(e)
+	}
+
+	var note *services.Note
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		sourceFiles, err := fileService.CountFiles(txApp, sourcePhrase)
+		if err != nil {
+			return err
+		}
+		destFiles, err := fileService.CountFiles(txApp, destPhrase)
+		if err != nil {
+			return err
+		}
+		if sourceFiles > 0 && destFiles > 0 {
+			return errImageConflict
+		}
+		sourceBytes, err := noteService.AttachmentBytes(txApp, sourcePhrase)
+		if err != nil {
+			return err
+		}
+		if err := noteService.CheckAttachmentQuota(txApp, destPhrase, sourceBytes, sourceFiles, false); err != nil {
+			return err
+		}
+
+		imageHash, err := fileService.RekeyFiles(txApp, sourcePhrase, destPhrase)
+		if err != nil {
+			return err
+		}
+		note, err = noteService.MergeNotes(txApp, sourcePhrase, destPhrase, imageHash)
+		return err
+	})
+	var quotaErr *services.QuotaError
+	if errors.As(err, &quotaErr) {
+		return quotaError(e, err)
+	}
+	if err != nil {
+		status, code := http.StatusInternalServerError, apierror.FromError(err, apierror.Internal)
+		switch {
+		case errors.Is(err, errImageConflict):
+			status, code = http.StatusConflict, apierror.AttachmentConflict
+		case errors.Is(err, services.ErrNoteNotFound):
+			status = http.StatusNotFound
+		}
+		return apierror.Respond(e, status, code, err.Error(), nil)
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"id":       note.ID,
+		"message":  note.Message,
+		"title":    note.Title,
+		"tags":     note.Tags,
+		"hasImage": note.ImageHash != "",
+		"created":  note.Created,
+		"updated":  note.Updated,
+	})
+}
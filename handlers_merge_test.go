@@ -0,0 +1,168 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+
+	"github.com/ktappdev/secretnotes-go-backend/middleware"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+func TestMergeNote(t *testing.T) {
+	app := migratedApp(t)
+	encryption := services.NewEncryptionService()
+	noteService := services.NewNoteService(app, encryption)
+	fileService := services.NewFileService(app, encryption)
+	registerAttachmentHooks(app, fileService)
+
+	save := func(phrase, message, title string, tags ...string) {
+		t.Helper()
+		if _, _, err := noteService.GetOrCreateNote(phrase); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := noteService.UpdateNote(phrase, message, services.NoteMetadata{Title: &title, Tags: &tags}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	attach := func(phrase, data string) {
+		t.Helper()
+		imageHash, err := fileService.StoreEncryptedFile(phrase, section(data), "file.txt", "text/plain")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := noteService.UpdateNoteImageHash(phrase, imageHash); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// merge runs POST /notes/merge from source into dest, behind the
+	// route's read-only check, and returns the status
+	merge := func(source, dest string) int {
+		t.Helper()
+		e, rec := newEvent(app, http.MethodPost, "/api/secretnotes/notes/merge", nil)
+		middleware.SetPhrase(e, dest)
+		chain := &hook.Hook[*core.RequestEvent]{}
+		chain.BindFunc(refuseReadOnly(noteService))
+		err := chain.Trigger(e, func(e *core.RequestEvent) error {
+			return handleMergeNote(e, source, dest, noteService, fileService)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code
+	}
+	note := func(phrase string) *services.Note {
+		t.Helper()
+		note, err := noteService.FindNote(phrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return note
+	}
+	attachment := func(phrase string) string {
+		t.Helper()
+		file, err := fileService.OpenFile(phrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	save("merge-dest", "destination text", "", "a", "b")
+	save("merge-source", "source text", "Source title", "b", "c")
+	attach("merge-source", "the source's attachment")
+
+	// both notes having an attachment is refused and nothing changes
+	save("merge-other", "another note", "")
+	attach("merge-other", "another attachment")
+	if code := merge("merge-source", "merge-other"); code != http.StatusConflict {
+		t.Fatalf("expected 409 when both notes have an attachment, got %d", code)
+	}
+	if note("merge-other").Message != "another note" || attachment("merge-source") != "the source's attachment" {
+		t.Fatal("expected both notes untouched")
+	}
+
+	// a read-only destination is refused
+	if err := noteService.SetReadOnly("merge-dest", true); err != nil {
+		t.Fatal(err)
+	}
+	if code := merge("merge-source", "merge-dest"); code != http.StatusLocked {
+		t.Fatalf("expected 423 for a read-only destination, got %d", code)
+	}
+	if err := noteService.SetReadOnly("merge-dest", false); err != nil {
+		t.Fatal(err)
+	}
+	if note("merge-dest").Message != "destination text" || note("merge-source").Message != "source text" {
+		t.Fatal("expected both notes untouched")
+	}
+
+	// so is a merge over the note or attachment quota
+	noteService.SetQuota(services.Quota{MaxNoteBytes: 20})
+	if code := merge("merge-source", "merge-dest"); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for a merged note over the quota, got %d", code)
+	}
+	noteService.SetQuota(services.Quota{MaxAttachmentBytes: 5})
+	if code := merge("merge-source", "merge-dest"); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for attachments over the quota, got %d", code)
+	}
+	noteService.SetQuota(services.Quota{})
+	if note("merge-dest").Message != "destination text" || attachment("merge-source") != "the source's attachment" {
+		t.Fatal("expected both notes untouched")
+	}
+
+	if code := merge("merge-source", "merge-dest"); code != http.StatusOK {
+		t.Fatalf("expected the merge to succeed, got %d", code)
+	}
+	merged := note("merge-dest")
+	if merged.Message != "destination text\n\nsource text" {
+		t.Fatalf("expected the messages joined, got %q", merged.Message)
+	}
+	if merged.Title != "Source title" || !slices.Equal(merged.Tags, []string{"a", "b", "c"}) {
+		t.Fatalf("expected the source's title and both tag sets, got %q and %v", merged.Title, merged.Tags)
+	}
+	if _, err := noteService.StatNote("merge-source"); err == nil {
+		t.Fatal("expected the source note deleted")
+	}
+	if attachment("merge-dest") != "the source's attachment" || merged.ImageHash == "" {
+		t.Fatal("expected the attachment moved to the destination")
+	}
+	if n, _ := fileService.CountFiles(app, "merge-source"); n != 0 {
+		t.Fatalf("expected no attachments left under the source, got %d", n)
+	}
+	checkContentRefs(t, app)
+}
+
+func TestMergeNotesReadOnly(t *testing.T) {
+	app := migratedApp(t)
+	noteService := services.NewNoteService(app, services.NewEncryptionService())
+	for _, phrase := range []string{"merge-ro-source", "merge-ro-dest"} {
+		if _, _, err := noteService.GetOrCreateNote(phrase); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := noteService.SetReadOnly("merge-ro-dest", true); err != nil {
+		t.Fatal(err)
+	}
+
+	var note *services.Note
+	err := app.RunInTransaction(func(txApp core.App) error {
+		var err error
+		note, err = noteService.MergeNotes(txApp, "merge-ro-source", "merge-ro-dest", "")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !note.ReadOnly {
+		t.Fatal("expected the merged note to report the destination's read-only flag")
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// uploadTypeNotAllowed answers 415 for an upload whose content type isn't in
+// SECRETNOTES_UPLOAD_TYPES, listing the types that are
+func uploadTypeNotAllowed(e *core.RequestEvent, contentType string, allowed []string) error {
+	msg := services.ErrContentTypeNotAllowed.Error() + ": " + contentType
+	return apierror.Respond(e, http.StatusUnsupportedMediaType, apierror.UnsupportedMediaType, msg, map[string]any{
+		"contentType": contentType,
+		"allowed":     allowed,
+	})
+}
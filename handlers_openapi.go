@@ -0,0 +1,44 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// openAPISpec is the hand-maintained OpenAPI 3 description of every route.
+// Keep it in step with the routes registered in main.go.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// buildOpenAPISpec returns the spec with the paths of disabled optional
+// features (marked with "x-secretnotes-feature") removed, so clients only
+// see what this server actually serves.
+func buildOpenAPISpec(enabled map[string]bool) ([]byte, error) {
+	var spec map[string]any
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse openapi.json: %w", err)
+	}
+
+	paths, _ := spec["paths"].(map[string]any)
+	for path, item := range paths {
+		op, _ := item.(map[string]any)
+		if feature, ok := op["x-secretnotes-feature"].(string); ok && !enabled[feature] {
+			delete(paths, path)
+		}
+	}
+
+	return json.Marshal(spec)
+}
+
+// handleOpenAPI serves the prebuilt OpenAPI document
+func handleOpenAPI(e *core.RequestEvent, spec []byte) error {
+	e.Response.Header().Set("Content-Type", "application/json")
+	e.Response.WriteHeader(http.StatusOK)
+	_, err := e.Response.Write(spec)
+	return err
+}
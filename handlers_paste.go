@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/config"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// handleCreatePaste stores a public paste. The lifetime defaults to (and is
+// capped at) the configured TTL; clients may ask for less via expiresIn seconds.
+func handleCreatePaste(e *core.RequestEvent, cfg config.PasteConfig, pasteService *services.PasteService) error {
+	data := struct {
+		Content   string `json:"content"`
+		ExpiresIn int    `json:"expiresIn"`
+	}{}
+	if err := e.BindBody(&data); err != nil {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Invalid request body", nil)
+	}
+
+	if data.Content == "" {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Paste content must not be empty", nil)
+	}
+	if len(data.Content) > cfg.MaxBytes {
+		return apierror.Respond(e, http.StatusRequestEntityTooLarge, apierror.PayloadTooLarge, fmt.Sprintf("Paste exceeds the %d byte limit", cfg.MaxBytes), map[string]any{
+			"limit": cfg.MaxBytes,
+		})
+	}
+
+	ttl := cfg.TTL
+	if data.ExpiresIn > 0 {
+		if requested := time.Duration(data.ExpiresIn) * time.Second; requested < ttl {
+			ttl = requested
+		}
+	}
+
+	paste, err := pasteService.CreatePaste(data.Content, ttl)
+	if err != nil {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, err.Error(), nil)
+	}
+
+	return e.JSON(http.StatusCreated, paste)
+}
+
+// handleGetPaste returns a paste by ID, or 404 once it has expired
+func handleGetPaste(e *core.RequestEvent, pasteService *services.PasteService) error {
+	paste, err := pasteService.GetPaste(e.Request.PathValue("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrPasteNotFound) {
+			status = http.StatusNotFound
+		}
+		return apierror.Respond(e, status, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+
+	return e.JSON(http.StatusOK, paste)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// quotaError answers 413 for a *services.QuotaError, with the limit, the
+// passphrase's current usage and the size the change would have brought it
+// to; for the attachment count cap these are counts rather than bytes. Other
+// errors get a 500.
+func quotaError(e *core.RequestEvent, err error) error {
+	var quotaErr *services.QuotaError
+	if !errors.As(err, &quotaErr) {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+
+	details := map[string]any{
+		"limit": quotaErr.Limit,
+		"usage": quotaErr.Usage,
+		"size":  quotaErr.Size,
+	}
+	switch quotaErr.What {
+	case "note":
+		msg := fmt.Sprintf("The note exceeds the %d byte limit", quotaErr.Limit)
+		return apierror.Respond(e, http.StatusRequestEntityTooLarge, apierror.PayloadTooLarge, msg, details)
+	case "attachment count":
+		msg := fmt.Sprintf("The note would have %d attachments, over the limit of %d (%d stored)", quotaErr.Size, quotaErr.Limit, quotaErr.Usage)
+		return apierror.Respond(e, http.StatusRequestEntityTooLarge, apierror.QuotaExceeded, msg, details)
+	}
+	msg := fmt.Sprintf("Attachments would take %d bytes, over the %d byte limit per passphrase (%d bytes in use)", quotaErr.Size, quotaErr.Limit, quotaErr.Usage)
+	return apierror.Respond(e, http.StatusRequestEntityTooLarge, apierror.QuotaExceeded, msg, details)
+}
+
+// handleGetStorageUsage reports how many bytes of ciphertext the passphrase
+// has stored, from record metadata alone, for storage meters
+func handleGetStorageUsage(e *core.RequestEvent, phrase string, noteService *services.NoteService) error {
+	usage, err := noteService.StorageUsage(phrase)
+	if err != nil {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, err.Error(), nil)
+	}
+	return e.JSON(http.StatusOK, usage)
+}
+
+// handleGetUsage reports how much of its quota the passphrase uses, without
+// decrypting the note, so clients can warn before an upload hits a cap
+func handleGetUsage(e *core.RequestEvent, phrase string, noteService *services.NoteService) error {
+	usage, err := noteService.StoredUsage(phrase)
+	if err != nil {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, err.Error(), nil)
+	}
+	return e.JSON(http.StatusOK, usage)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// handleGetRawNote sends just the decrypted message as plain text, for shell
+// pipelines that shouldn't need a JSON parser. It never creates a note.
+func handleGetRawNote(e *core.RequestEvent, phrase string, noteService *services.NoteService) error {
+	note, err := noteService.FindNote(phrase)
+	if err != nil {
+		return apierror.Respond(e, http.StatusNotFound, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+
+	e.Response.Header().Set("Cache-Control", "no-store")
+	e.Response.Header().Set("Last-Modified", note.Updated.UTC().Format(http.TimeFormat))
+	return e.Blob(http.StatusOK, "text/plain; charset=utf-8", []byte(note.Message))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+func TestGetRawNote(t *testing.T) {
+	app := migratedApp(t)
+	noteService := services.NewNoteService(app, services.NewEncryptionService())
+	phrase := "raw-note-phrase"
+
+	e, rec := newEvent(app, http.MethodGet, "/api/secretnotes/notes/raw", nil)
+	if err := handleGetRawNote(e, phrase, noteService); err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); rec.Code != http.StatusNotFound || err != nil || body.Error == "" {
+		t.Fatalf("expected a JSON 404 for a missing note, got %d %q", rec.Code, rec.Body.String())
+	}
+	if code := apierror.ResponseCode(e); code != apierror.NoteNotFound {
+		t.Fatalf("expected %s, got %s", apierror.NoteNotFound, code)
+	}
+	if _, err := noteService.StatNote(phrase); err == nil {
+		t.Fatal("expected the raw endpoint not to create the note")
+	}
+
+	message := "line one\nline <two> & \"three\"\n"
+	if _, _, err := noteService.GetOrCreateNote(phrase); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := noteService.UpdateNote(phrase, message, services.NoteMetadata{}); err != nil {
+		t.Fatal(err)
+	}
+	e, rec = newEvent(app, http.MethodGet, "/api/secretnotes/notes/raw", nil)
+	if err := handleGetRawNote(e, phrase, noteService); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || rec.Body.String() != message {
+		t.Fatalf("expected the message as sent, got %d %q", rec.Code, rec.Body.String())
+	}
+	header := rec.Header()
+	if header.Get("Content-Type") != "text/plain; charset=utf-8" || header.Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected uncached plain text, got %v", header)
+	}
+	if _, err := http.ParseTime(header.Get("Last-Modified")); err != nil {
+		t.Fatalf("expected a Last-Modified date, got %q", header.Get("Last-Modified"))
+	}
+}
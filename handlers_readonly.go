@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/middleware"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// handleSetReadOnly marks the note read-only, or writable again
+func handleSetReadOnly(e *core.RequestEvent, phrase string, readOnly bool, noteService *services.NoteService) error {
+	if err := noteService.SetReadOnly(phrase, readOnly); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrNoteNotFound) {
+			status = http.StatusNotFound
+		}
+		return apierror.Respond(e, status, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"readOnly": readOnly,
+	})
+}
+
+// refuseReadOnly answers 423 for changes to a read-only note, so autosaving
+// clients can't overwrite reference notes by accident
+func refuseReadOnly(noteService *services.NoteService) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		readOnly, err := noteService.IsReadOnly(middleware.Phrase(e))
+		if err != nil {
+			return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, err.Error(), nil)
+		}
+		if readOnly {
+			return noteReadOnly(e)
+		}
+		return e.Next()
+	}
+}
+
+func noteReadOnly(e *core.RequestEvent) error {
+	return apierror.Respond(e, http.StatusLocked, apierror.NoteReadOnly, "Note is read-only; clear it with DELETE /notes/read-only to make changes", nil)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// handleRecoveryKit splits the note's passphrase into a k-of-n recovery kit.
+// Nothing is stored: the shares are only in the response, which is never
+// cached.
+func handleRecoveryKit(e *core.RequestEvent, phrase string, noteService *services.NoteService) error {
+	data := struct {
+		Threshold int `json:"threshold"`
+		Shares    int `json:"shares"`
+	}{}
+	if err := e.BindBody(&data); err != nil {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Invalid request body", nil)
+	}
+	if _, err := noteService.StatNote(phrase); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrNoteNotFound) {
+			status = http.StatusNotFound
+		}
+		return apierror.Respond(e, status, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+
+	kit, err := services.SplitPhrase(phrase, data.Threshold, data.Shares)
+	if err != nil {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, err.Error(), map[string]any{
+			"maxShares": services.MaxRecoveryShares,
+		})
+	}
+	e.Response.Header().Set("Cache-Control", "no-store")
+	return e.JSON(http.StatusOK, map[string]any{
+		"kitId":     kit.ID,
+		"threshold": kit.Threshold,
+		"shares":    kit.Shares,
+	})
+}
+
+// handleRecover rebuilds a passphrase from the shares of a recovery kit and
+// reports whether a note exists for it
+func handleRecover(e *core.RequestEvent, noteService *services.NoteService) error {
+	data := struct {
+		Shares []string `json:"shares"`
+	}{}
+	if err := e.BindBody(&data); err != nil {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Invalid request body", nil)
+	}
+	if len(data.Shares) > services.MaxRecoveryShares {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Too many shares", map[string]any{
+			"limit": services.MaxRecoveryShares,
+		})
+	}
+
+	phrase, kitID, err := services.RecoverPhrase(data.Shares)
+	if err != nil {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.FromError(err, apierror.BadRequest), err.Error(), nil)
+	}
+	_, err = noteService.StatNote(phrase)
+	if err != nil && !errors.Is(err, services.ErrNoteNotFound) {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, err.Error(), nil)
+	}
+	e.Response.Header().Set("Cache-Control", "no-store")
+	return e.JSON(http.StatusOK, map[string]any{
+		"passphrase": phrase,
+		"kitId":      kitID,
+		"noteExists": err == nil,
+	})
+}
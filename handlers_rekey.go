@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// handleRekeyNote moves the note and all attachments from oldPhrase to newPhrase,
+// re-encrypting everything in a single transaction.
+func handleRekeyNote(e *core.RequestEvent, oldPhrase, newPhrase string, noteService *services.NoteService, fileService *services.FileService) error {
+	if oldPhrase == newPhrase {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadPassphrase, "New passphrase must differ from the current passphrase", nil)
+	}
+
+	// the middleware only moved the request's passphrase off a legacy hash, and
+	// a note left under one would go unnoticed here
+	if _, err := noteService.MoveLegacyPhraseHash(newPhrase); err != nil {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, err.Error(), nil)
+	}
+
+	// everything is re-encrypted under the new passphrase, so derive its key once
+	defer noteService.Encryption.Scope(newPhrase)()
+
+	var note *services.Note
+	err := e.App.RunInTransaction(func(txApp core.App) error {
+		// refuse a taken passphrase before re-encrypting any attachment;
+		// stray attachments under it would be mixed up with the moved ones
+		if err := noteService.CheckPhraseFree(txApp, newPhrase); err != nil {
+			return err
+		}
+		if count, err := fileService.CountFiles(txApp, newPhrase); err != nil {
+			return err
+		} else if count > 0 {
+			return services.ErrPhraseInUse
+		}
+		imageHash, err := fileService.RekeyFiles(txApp, oldPhrase, newPhrase)
+		if err != nil {
+			return err
+		}
+		note, err = noteService.RekeyNote(txApp, oldPhrase, newPhrase, imageHash)
+		return err
+	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrPhraseInUse):
+			status = http.StatusConflict
+		case errors.Is(err, services.ErrNoteNotFound):
+			status = http.StatusNotFound
+		}
+		return apierror.Respond(e, status, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"id":       note.ID,
+		"message":  note.Message,
+		"title":    note.Title,
+		"tags":     note.Tags,
+		"hasImage": note.ImageHash != "",
+		"created":  note.Created,
+		"updated":  note.Updated,
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// checkContentRefs fails unless every attachment_contents record counts as
+// many references as there are attachments stored in it
+func checkContentRefs(t *testing.T, app core.App) {
+	t.Helper()
+	contents, err := app.FindAllRecords("attachment_contents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range contents {
+		n, err := app.CountRecords("encrypted_files", dbx.HashExp{"content": content.Id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(content.GetInt("refs")) != n {
+			t.Fatalf("content %s counts %d references for %d attachments", content.Id, content.GetInt("refs"), n)
+		}
+	}
+}
+
+func TestRekeyNote(t *testing.T) {
+	app := migratedApp(t)
+	encryption := services.NewEncryptionService()
+	noteService := services.NewNoteService(app, encryption)
+	fileService := services.NewFileService(app, encryption)
+	registerAttachmentHooks(app, fileService)
+
+	save := func(phrase, message string) {
+		t.Helper()
+		if _, _, err := noteService.GetOrCreateNote(phrase); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := noteService.UpdateNote(phrase, message, services.NoteMetadata{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	attach := func(phrase, data string) {
+		t.Helper()
+		imageHash, err := fileService.StoreEncryptedFile(phrase, section(data), "file.txt", "text/plain")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := noteService.FindNote(phrase); err == nil {
+			if err := noteService.UpdateNoteImageHash(phrase, imageHash); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	rekey := func(oldPhrase, newPhrase string) int {
+		t.Helper()
+		e, rec := newEvent(app, http.MethodPost, "/api/secretnotes/notes/rekey", nil)
+		if err := handleRekeyNote(e, oldPhrase, newPhrase, noteService, fileService); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code
+	}
+	message := func(phrase string) string {
+		t.Helper()
+		note, err := noteService.FindNote(phrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return note.Message
+	}
+	attachment := func(phrase string) string {
+		t.Helper()
+		file, err := fileService.OpenFile(phrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	oldPhrase := "rekey-old-phrase"
+	save(oldPhrase, "the note to move")
+	attach(oldPhrase, "the attachment to move")
+
+	// a passphrase that has a note is refused and nothing moves
+	save("rekey-taken-phrase", "someone else's note")
+	if code := rekey(oldPhrase, "rekey-taken-phrase"); code != http.StatusConflict {
+		t.Fatalf("expected 409 for a passphrase with a note, got %d", code)
+	}
+	if message(oldPhrase) != "the note to move" || message("rekey-taken-phrase") != "someone else's note" {
+		t.Fatal("expected both notes untouched")
+	}
+	if attachment(oldPhrase) != "the attachment to move" {
+		t.Fatal("expected the attachment untouched")
+	}
+
+	// so is one with stray attachments
+	attach("rekey-stray-phrase", "a stray attachment")
+	if code := rekey(oldPhrase, "rekey-stray-phrase"); code != http.StatusConflict {
+		t.Fatalf("expected 409 for a passphrase with attachments, got %d", code)
+	}
+	if n, _ := fileService.CountFiles(app, "rekey-stray-phrase"); n != 1 {
+		t.Fatalf("expected the stray attachment untouched, got %d", n)
+	}
+	if attachment(oldPhrase) != "the attachment to move" || attachment("rekey-stray-phrase") != "a stray attachment" {
+		t.Fatal("expected both attachments untouched")
+	}
+	checkContentRefs(t, app)
+
+	newPhrase := "rekey-new-phrase"
+	if code := rekey(oldPhrase, newPhrase); code != http.StatusOK {
+		t.Fatalf("expected the rekey to succeed, got %d", code)
+	}
+	if message(newPhrase) != "the note to move" || attachment(newPhrase) != "the attachment to move" {
+		t.Fatal("expected the note and attachment under the new passphrase")
+	}
+	oldHash := encryption.PhraseHash(oldPhrase)
+	for _, collection := range []string{"notes", "encrypted_files", "attachment_contents"} {
+		if n, _ := app.CountRecords(collection, dbx.HashExp{"phrase_hash": oldHash}); n != 0 {
+			t.Fatalf("expected nothing left in %s under the old passphrase, got %d", collection, n)
+		}
+	}
+	if _, err := noteService.FindNote(oldPhrase); err == nil {
+		t.Fatal("expected no note under the old passphrase")
+	}
+	if _, err := fileService.OpenFile(oldPhrase); err == nil {
+		t.Fatal("expected no attachment under the old passphrase")
+	}
+
+	// the moved records open only with the new passphrase
+	moved, err := app.FindFirstRecordByData("encrypted_files", "phrase_hash", encryption.PhraseHash(newPhrase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved.Set("phrase_hash", oldHash)
+	if err := app.Save(moved); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fileService.ListAttachments(oldPhrase); err == nil {
+		t.Fatal("expected the moved attachment not to decrypt with the old passphrase")
+	}
+	moved.Set("phrase_hash", encryption.PhraseHash(newPhrase))
+	if err := app.Save(moved); err != nil {
+		t.Fatal(err)
+	}
+	checkContentRefs(t, app)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// scanUpload runs the configured malware scan over an upload's plaintext; a
+// no-op unless SECRETNOTES_CLAMD_ADDRESS is set
+func (s *server) scanUpload(ctx context.Context, content io.Reader) error {
+	return services.ScanUpload(ctx, s.scanner, content, s.cfg.Scan.FailOpen)
+}
+
+// scanRejected answers 422 for flagged content, naming the signature, and
+// 503 when the scanner gave no verdict
+func scanRejected(e *core.RequestEvent, name string, err error) error {
+	if errors.Is(err, services.ErrMalwareDetected) {
+		return apierror.Respond(e, http.StatusUnprocessableEntity, apierror.MalwareDetected, services.ErrMalwareDetected.Error(), map[string]any{
+			"fileName":  name,
+			"signature": services.MalwareSignature(err),
+		})
+	}
+	return apierror.Respond(e, http.StatusServiceUnavailable, apierror.FromError(err, apierror.Internal), services.ErrScanUnavailable.Error(), nil)
+}
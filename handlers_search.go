@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// handleSearchNote decrypts the note within the request and returns the lines
+// matching query, so thin clients needn't download a large note to search it.
+// It never creates a note.
+func handleSearchNote(e *core.RequestEvent, phrase, query string, noteService *services.NoteService) error {
+	if query == "" {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Missing search query (q)", nil)
+	}
+	if utf8.RuneCountInString(query) > services.MaxSearchQueryLength {
+		msg := fmt.Sprintf("Search query is longer than %d characters", services.MaxSearchQueryLength)
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, msg, nil)
+	}
+
+	note, err := noteService.FindNote(phrase)
+	if err != nil {
+		return apierror.Respond(e, http.StatusNotFound, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+
+	result := services.SearchMessage(note.Message, query, services.MaxSearchMatches)
+	return e.JSON(http.StatusOK, map[string]any{
+		"query":      query,
+		"matches":    result.Matches,
+		"truncated":  result.Truncated,
+		"totalLines": result.TotalLines,
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/middleware"
+)
+
+// handleOpenSession exchanges the passphrase, sent this once, for a
+// short-lived access token clients send as X-Access-Token instead. An access
+// token can't open a session of its own; renewals need the challenge proof.
+func handleOpenSession(e *core.RequestEvent, phrase string, sessions *middleware.SessionStore) error {
+	if middleware.AccessToken(e) != "" {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Send the passphrase, not an access token, to open a session; use /auth/token/renew to renew", nil)
+	}
+
+	token, err := sessions.Open(phrase)
+	if err != nil {
+		return sessionError(e, err)
+	}
+
+	e.Response.Header().Set("Cache-Control", "no-store")
+	return e.JSON(http.StatusCreated, token)
+}
+
+// handleSessionChallenge hands out a single-use nonce to renew a token with
+func handleSessionChallenge(e *core.RequestEvent, sessions *middleware.SessionStore) error {
+	nonce, expiresAt, err := sessions.Challenge()
+	if err != nil {
+		return sessionError(e, err)
+	}
+
+	e.Response.Header().Set("Cache-Control", "no-store")
+	return e.JSON(http.StatusOK, map[string]any{
+		"nonce":     nonce,
+		"expiresAt": expiresAt.UTC(),
+	})
+}
+
+// handleRenewSession swaps a token, expired or not, for a new one given
+// proof = hex HMAC-SHA256(passphrase, nonce) for a nonce from /auth/challenge,
+// keyed with the passphrase in NFKC form (see middleware.SessionProof)
+func handleRenewSession(e *core.RequestEvent, sessions *middleware.SessionStore) error {
+	data := struct {
+		Token string `json:"token"`
+		Nonce string `json:"nonce"`
+		Proof string `json:"proof"`
+	}{}
+	if err := e.BindBody(&data); err != nil {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Invalid request body", nil)
+	}
+	if data.Token == "" || data.Nonce == "" || data.Proof == "" {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "token, nonce and proof are required", nil)
+	}
+
+	token, err := sessions.Renew(data.Token, data.Nonce, data.Proof)
+	if err != nil {
+		return sessionError(e, err)
+	}
+
+	e.Response.Header().Set("Cache-Control", "no-store")
+	return e.JSON(http.StatusOK, token)
+}
+
+// handleCloseSession ends the session of the request's access token
+func handleCloseSession(e *core.RequestEvent, sessions *middleware.SessionStore) error {
+	token := middleware.AccessToken(e)
+	if token == "" {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "X-Access-Token is required", nil)
+	}
+	sessions.Close(token)
+
+	return e.JSON(http.StatusOK, map[string]string{
+		"message": "Session ended",
+	})
+}
+
+func sessionError(e *core.RequestEvent, err error) error {
+	switch {
+	case errors.Is(err, middleware.ErrSessionNotFound), errors.Is(err, middleware.ErrBadProof):
+		return apierror.Respond(e, http.StatusUnauthorized, apierror.TokenExpired, err.Error(), nil)
+	case errors.Is(err, middleware.ErrTooManySessions):
+		return apierror.Respond(e, http.StatusServiceUnavailable, apierror.Internal, err.Error(), nil)
+	}
+	return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, err.Error(), nil)
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// handleStats serves the public stats snapshot (see services.PublicStats)
+func handleStats(e *core.RequestEvent, statsService *services.StatsService) error {
+	stats, err := statsService.PublicStats()
+	if err != nil {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, "Failed to gather stats", nil)
+	}
+	return e.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/config"
+	"github.com/ktappdev/secretnotes-go-backend/middleware"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// maxStrengthUserInputs caps the extra words a client can ask to be treated as guessable
+const maxStrengthUserInputs = 20
+
+// handlePhraseStrength estimates how guessable a candidate passphrase is, so
+// clients can warn before a weak one guards a note. The candidate is read from
+// "phrase" rather than "passphrase" so that checking it is not mistaken for
+// opening a note (rate limits and abuse tracking key on the passphrase). The
+// brand name is always part of userInputs.
+func handlePhraseStrength(e *core.RequestEvent, limits config.LimitsConfig, brand config.BrandingConfig) error {
+	data := struct {
+		Phrase     string   `json:"phrase"`
+		UserInputs []string `json:"userInputs"`
+	}{}
+	if err := e.BindBody(&data); err != nil {
+		if middleware.IsBodyTooLarge(err) {
+			return middleware.PayloadTooLarge(e, "note", limits.MaxNoteBytes, -1)
+		}
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Invalid request body", nil)
+	}
+	if data.Phrase == "" {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "phrase is required", nil)
+	}
+	if len(data.UserInputs) > maxStrengthUserInputs {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Too many userInputs", map[string]any{
+			"limit": maxStrengthUserInputs,
+		})
+	}
+
+	strength := services.EstimateStrength(data.Phrase, append(data.UserInputs, brand.Name))
+	e.Response.Header().Set("Cache-Control", "no-store")
+	return e.JSON(http.StatusOK, map[string]any{
+		"score":       strength.Score,
+		"guesses":     strength.Guesses,
+		"entropy":     strength.Entropy,
+		"crackTimes":  strength.CrackTimes,
+		"warning":     strength.Warning,
+		"suggestions": strength.Suggestions,
+		"acceptable":  strength.Score >= 3,
+	})
+}
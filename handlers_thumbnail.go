@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/cryptoutil"
+	"github.com/ktappdev/secretnotes-go-backend/middleware"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// handleGetThumbnail sends the decrypted JPEG preview of an image attachment.
+// It shares the attachment's ETag, so a client's cached preview goes stale
+// exactly when the attachment changes.
+func handleGetThumbnail(e *core.RequestEvent, phrase string, fileService *services.FileService) error {
+	etag, modified, err := fileService.FileVersion(phrase)
+	if err != nil {
+		return apierror.Respond(e, http.StatusNotFound, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+	e.Response.Header().Set("Cache-Control", "private, no-cache")
+	if middleware.NotModified(e, etag, modified) {
+		return e.NoContent(http.StatusNotModified)
+	}
+
+	thumbnail, err := fileService.RetrieveThumbnail(phrase)
+	if err != nil {
+		code := apierror.FromError(err, apierror.Internal)
+		return apierror.Respond(e, code.Status(), code, err.Error(), nil)
+	}
+	defer cryptoutil.Wipe(thumbnail)
+	return e.Blob(http.StatusOK, services.ThumbnailContentType, thumbnail)
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// handleTime reports the server clock so clients can detect and compensate
+// for clock skew before relying on server-issued expiry times
+func handleTime(e *core.RequestEvent) error {
+	now := time.Now().UTC()
+	e.Response.Header().Set("Cache-Control", "no-store")
+	return e.JSON(http.StatusOK, map[string]any{
+		"now":    now.Format(time.RFC3339Nano),
+		"unixMs": now.UnixMilli(),
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/middleware"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// handleDeleteNote moves the note to the trash. It can be restored with
+// POST /notes/undelete until purgeAt; after that it is gone for good.
+func handleDeleteNote(e *core.RequestEvent, phrase string, grace time.Duration, noteService *services.NoteService) error {
+	deletedAt, err := noteService.DeleteNote(phrase)
+	if err != nil {
+		return apierror.Respond(e, http.StatusNotFound, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"message":   "Note deleted",
+		"deletedAt": deletedAt,
+		"purgeAt":   deletedAt.Add(grace),
+	})
+}
+
+// handleUndeleteNote restores a note from the trash
+func handleUndeleteNote(e *core.RequestEvent, phrase string, grace time.Duration, noteService *services.NoteService) error {
+	note, err := noteService.UndeleteNote(phrase, grace)
+	if err != nil {
+		return apierror.Respond(e, http.StatusNotFound, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+	usage, err := noteService.Usage(phrase, note.Message)
+	if err != nil {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, err.Error(), nil)
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"id":           note.ID,
+		"message":      note.Message,
+		"title":        note.Title,
+		"tags":         note.Tags,
+		"hasImage":     note.ImageHash != "",
+		"created":      note.Created,
+		"updated":      note.Updated,
+		"destroyAt":    note.DestroyAt,
+		"accessCount":  note.AccessCount,
+		"lastAccessed": note.LastAccessed,
+		"readOnly":     note.ReadOnly,
+		"usage":        usage,
+	})
+}
+
+// refuseDeleted answers 410 for a note in the trash, so it is neither read,
+// changed nor recreated until it is restored or purged
+func refuseDeleted(grace time.Duration, noteService *services.NoteService) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		deletedAt, err := noteService.FindDeleted(middleware.Phrase(e), grace)
+		if err != nil {
+			return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, err.Error(), nil)
+		}
+		if deletedAt != nil {
+			return apierror.Respond(e, http.StatusGone, apierror.NoteDeleted, "Note was deleted; restore it with POST /notes/undelete", map[string]any{
+				"deletedAt": deletedAt,
+				"purgeAt":   deletedAt.Add(grace),
+			})
+		}
+		return e.Next()
+	}
+}
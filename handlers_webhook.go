@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/middleware"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// webhookEvents maps the operations that change a note to the ping they send
+var webhookEvents = map[string]string{
+	"PUT /notes":        services.WebhookEventNoteUpdated,
+	"PATCH /notes":      services.WebhookEventNoteUpdated,
+	"POST /notes/merge": services.WebhookEventNoteUpdated,
+	"POST /import":      services.WebhookEventNoteUpdated,
+	"POST /notes/image": services.WebhookEventAttachmentAdded,
+}
+
+// handleRegisterWebhook creates or replaces the note's webhook and returns its
+// signing secret, which is not shown again
+func handleRegisterWebhook(e *core.RequestEvent, phrase, url, clientID string, webhookService *services.WebhookService) error {
+	hook, err := webhookService.Register(phrase, url, clientID)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrNoteNotFound) {
+			status = http.StatusNotFound
+		}
+		return apierror.Respond(e, status, apierror.FromError(err, apierror.BadRequest), err.Error(), nil)
+	}
+
+	return e.JSON(http.StatusOK, hook)
+}
+
+// handleGetWebhook returns the note's webhook without its secret
+func handleGetWebhook(e *core.RequestEvent, phrase string, webhookService *services.WebhookService) error {
+	hook, err := webhookService.GetWebhook(phrase)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrWebhookNotFound) {
+			status = http.StatusNotFound
+		}
+		return apierror.Respond(e, status, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+
+	return e.JSON(http.StatusOK, hook)
+}
+
+// handleUnregisterWebhook removes the note's webhook
+func handleUnregisterWebhook(e *core.RequestEvent, phrase string, webhookService *services.WebhookService) error {
+	if err := webhookService.Unregister(phrase); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrWebhookNotFound) {
+			status = http.StatusNotFound
+		}
+		return apierror.Respond(e, status, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+
+	return e.JSON(http.StatusOK, map[string]string{
+		"message": "Webhook removed",
+	})
+}
+
+// notifyWebhooks pings the note's webhook after requests that change it. The
+// X-Client-Id header identifies the device making the change.
+func notifyWebhooks(webhookService *services.WebhookService) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		err := e.Next()
+		if err != nil || e.Status() >= http.StatusBadRequest {
+			return err
+		}
+
+		if event, ok := webhookEvents[accessLogOperation(e.Request.Pattern)]; ok {
+			webhookService.Notify(middleware.Phrase(e), event, e.Request.Header.Get("X-Client-Id"))
+		}
+		return nil
+	}
+}
+
+// registerWebhookHooks keeps webhooks attached to their note across rekeys
+// and deletes
+func registerWebhookHooks(app core.App, webhookService *services.WebhookService) {
+	app.OnRecordAfterUpdateSuccess("notes").BindFunc(func(e *core.RecordEvent) error {
+		if oldHash, newHash := e.Record.Original().GetString("phrase_hash"), e.Record.GetString("phrase_hash"); oldHash != newHash {
+			webhookService.MovePhrase(e.App, oldHash, newHash)
+		}
+		return e.Next()
+	})
+
+	app.OnRecordAfterDeleteSuccess("notes").BindFunc(func(e *core.RecordEvent) error {
+		webhookService.DeleteForPhrase(e.App, e.Record.GetString("phrase_hash"))
+		return e.Next()
+	})
+}
@@ -1,23 +1,48 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
 	"crypto/sha256"
-	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/mail"
 	"os"
+	"runtime/debug"
+	"time"
 
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/dbx"
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/config"
+	"github.com/ktappdev/secretnotes-go-backend/middleware"
 	_ "github.com/ktappdev/secretnotes-go-backend/migrations" // Import migrations
 	"github.com/ktappdev/secretnotes-go-backend/services"
 )
 
 func main() {
-	app := pocketbase.New()
+	// Load operator settings from SECRETNOTES_* environment variables
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
+	// Resource caps of the selected profile (SECRETNOTES_PROFILE)
+	if cfg.Resources.MemoryLimit > 0 && os.Getenv("GOMEMLIMIT") == "" {
+		debug.SetMemoryLimit(cfg.Resources.MemoryLimit)
+	}
+
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir:   cfg.DataDir,
+		DataMaxOpenConns: cfg.Resources.DBMaxOpenConns,
+		DataMaxIdleConns: cfg.Resources.DBMaxIdleConns,
+	})
 	
 	// Respect CLI args; default to serving on 127.0.0.1:8091 when no args provided
 	if len(os.Args) <= 1 {
@@ -26,121 +51,289 @@ func main() {
 
 	// Initialize services
 	encryptionService := services.NewEncryptionService()
+	encryptionService.LimitKDF(cfg.Resources.KDFConcurrency)
+	encryptionService.ParallelChunks(cfg.Resources.ChunkWorkers)
+	encryptionService.CacheKeys(cfg.Encryption.KeyCacheSize, cfg.Encryption.KeyCacheTTL)
+	if cfg.Encryption.Compression {
+		encryptionService.CompressMessages(cfg.Encryption.CompressMinBytes)
+	}
+	if err := encryptionService.SetPeppers(cfg.Encryption.Peppers, cfg.Encryption.PepperID); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	if err := encryptionService.SetServerLayerKeys(cfg.Encryption.ServerLayerKeys, cfg.Encryption.ServerLayerKeyID); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	if len(cfg.Encryption.KMSCommand) > 0 {
+		kms := &services.CommandKeyWrapper{Command: cfg.Encryption.KMSCommand, Timeout: cfg.Encryption.KMSTimeout}
+		if err := encryptionService.UseKMS(kms); err != nil {
+			log.Fatalf("SECRETNOTES_KMS_COMMAND: %v", err)
+		}
+	}
+	if cfg.Encryption.Cipher != "auto" {
+		encryptionService.Cipher = cfg.Encryption.Cipher
+	} else if !services.HasAESHardware() {
+		log.Printf("No AES hardware acceleration detected; encrypting with %s", encryptionService.Cipher)
+	}
+	if cfg.Encryption.ChunkCipher != "auto" {
+		encryptionService.ChunkCipher = cfg.Encryption.ChunkCipher
+	}
+	encryptionService.KDF = cfg.Encryption.KDF
+	encryptionService.Iterations = cfg.Encryption.PBKDF2Iterations
+	encryptionService.SaltSize = cfg.Encryption.SaltSize
+	if cfg.Encryption.FIPS {
+		if err := encryptionService.RequireFIPS(); err != nil {
+			log.Fatalf("invalid configuration: SECRETNOTES_FIPS: %v", err)
+		}
+		log.Printf("FIPS mode: encrypting with %s and %s only", encryptionService.Cipher, encryptionService.KDF)
+	}
 	noteService := services.NewNoteService(app, encryptionService)
+	quota := services.Quota{MaxNoteBytes: cfg.Limits.MaxNoteBytes, MaxAttachmentBytes: cfg.Limits.MaxAttachmentBytes, MaxAttachments: cfg.Limits.MaxAttachments}
+	noteService.SetQuota(quota)
 	fileService := services.NewFileService(app, encryptionService)
+	fileService.SetQuota(quota)
+	fileService.SetChunkThreshold(cfg.Encryption.ChunkThreshold)
+	fileService.SetRetention(services.Retention{
+		MaxAge: int64(cfg.Retention.MaxAge / time.Second),
+		Keep:   cfg.Retention.Keep,
+	})
+	registerAttachmentHooks(app, fileService)
+	if cfg.ShredFiles {
+		registerShredHooks(app, fileService)
+	}
+	pasteService := services.NewPasteService(app)
+	blobService := services.NewBlobService(app)
+	abuseService := services.NewAbuseService(app, cfg.Abuse)
+	accessLogService := services.NewAccessLogService(app, encryptionService)
+	registerAccessLogHooks(app, accessLogService)
+	lockService := services.NewLockService(60 * time.Second)
+
+	// Optional change/access digest emails (requires SECRETNOTES_NOTIFICATION_KEY)
+	var digestService *services.DigestService
+	if cfg.NotificationKey != "" {
+		digestService = services.NewDigestService(app, encryptionService, cfg.NotificationKey, mail.Address{
+			Name:    cfg.SMTP.FromName,
+			Address: cfg.SMTP.FromAddress,
+		}, cfg.Branding.Name)
+		registerDigestHooks(app, noteService, digestService)
+		app.Cron().MustAdd("sendNoteDigests", "*/5 * * * *", func() {
+			if n, err := digestService.SendDue(); err != nil {
+				log.Printf("Warning: failed to send note digests: %v", err)
+			} else if n > 0 {
+				log.Printf("Sent %d note digests", n)
+			}
+		})
+	}
+
+	// Optional outgoing note webhooks (also requires SECRETNOTES_NOTIFICATION_KEY)
+	var webhookService *services.WebhookService
+	if cfg.NotificationKey != "" {
+		webhookService = services.NewWebhookService(app, encryptionService, cfg.NotificationKey, cfg.Webhooks)
+		registerWebhookHooks(app, webhookService)
+	}
+
+	// Purge expired pastes in the background (only when paste mode is on)
+	if cfg.Paste.Enabled {
+		app.Cron().MustAdd("purgeExpiredPastes", "*/10 * * * *", func() {
+			if n, err := pasteService.PurgeExpiredPastes(); err != nil {
+				log.Printf("Warning: failed to purge expired pastes: %v", err)
+			} else if n > 0 {
+				log.Printf("Purged %d expired pastes", n)
+			}
+		})
+	}
+
+	// Delete notes whose scheduled destruction time has passed
+	app.Cron().MustAdd("purgeDestroyedNotes", "* * * * *", func() {
+		if n, err := noteService.PurgeDestroyedNotes(); err != nil {
+			log.Printf("Warning: failed to purge destroyed notes: %v", err)
+		} else if n > 0 {
+			log.Printf("Destroyed %d notes on schedule", n)
+		}
+	})
+
+	// Purge deleted notes once their recovery window has passed
+	app.Cron().MustAdd("purgeDeletedNotes", "*/10 * * * *", func() {
+		if n, err := noteService.PurgeDeletedNotes(cfg.Deletion.Grace); err != nil {
+			log.Printf("Warning: failed to purge deleted notes: %v", err)
+		} else if n > 0 {
+			log.Printf("Purged %d deleted notes", n)
+		}
+	})
+
+	// Purge attachments that fall outside their note's retention policy
+	app.Cron().MustAdd("purgeExpiredAttachments", "*/10 * * * *", func() {
+		if n, err := fileService.PurgeExpiredAttachments(); err != nil {
+			log.Printf("Warning: failed to purge expired attachments: %v", err)
+		} else if n > 0 {
+			log.Printf("Purged %d attachments under retention rules", n)
+		}
+	})
+
+	// Forget saved bans once their strikes have decayed
+	if cfg.Abuse.Enabled {
+		app.Cron().MustAdd("purgeStaleAbuseTracking", "0 * * * *", func() {
+			if _, err := abuseService.PurgeStale(); err != nil {
+				log.Printf("Warning: failed to purge abuse tracking: %v", err)
+			}
+		})
+	}
+
+	// Optional features enabled on this server, for the OpenAPI document and /capabilities
+	features := map[string]bool{
+		"paste":         cfg.Paste.Enabled,
+		"blobs":         cfg.Blobs.Enabled,
+		"notifications": cfg.NotificationKey != "",
+		"stats":         cfg.Stats.Enabled,
+		"sessions":      cfg.Sessions.Enabled,
+		"malwareScan":   cfg.Scan.ClamdAddress != "",
+	}
+
+	// OpenAPI document for the routes enabled on this server
+	spec, err := buildOpenAPISpec(features)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Optional public stats (SECRETNOTES_STATS_ENABLED)
+	var statsService *services.StatsService
+	if cfg.Stats.Enabled {
+		statsService = services.NewStatsService(app, cfg.Stats.Refresh)
+	}
+
+	// Optional authentication layer in front of the API (SECRETNOTES_AUTH_MODE)
+	auth, err := newAuthenticator(cfg.Auth)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Optional malware scan of uploads before encryption (SECRETNOTES_CLAMD_ADDRESS)
+	var scanner services.Scanner
+	if cfg.Scan.ClamdAddress != "" {
+		clamd, err := services.NewClamdScanner(cfg.Scan.ClamdAddress, cfg.Scan.Timeout)
+		if err != nil {
+			log.Fatalf("invalid configuration: SECRETNOTES_CLAMD_ADDRESS: %v", err)
+		}
+		scanner = clamd
+	}
+
+	// Optional signing of export archives (SECRETNOTES_SIGNING_KEY_FILE)
+	var signer *services.ArchiveSigner
+	archiveTrust := services.ArchiveTrust{Require: cfg.Archives.RequireSigned}
+	if cfg.Archives.SigningKey != nil {
+		if signer, err = services.NewArchiveSigner(cfg.Archives.SigningKey); err != nil {
+			log.Fatalf("invalid configuration: SECRETNOTES_SIGNING_KEY_FILE: %v", err)
+		}
+		archiveTrust.Keys = append(archiveTrust.Keys, signer.PublicKey())
+		log.Printf("Signing export archives with key %s", signer.KeyID())
+	}
+	for _, key := range cfg.Archives.TrustedKeys {
+		archiveTrust.Keys = append(archiveTrust.Keys, ed25519.PublicKey(key))
+	}
+
+	// Optional access tokens in place of the passphrase (SECRETNOTES_SESSIONS_ENABLED)
+	var sessions *middleware.SessionStore
+	if cfg.Sessions.Enabled {
+		sessions = middleware.NewSessionStore(cfg.Sessions.TokenTTL, cfg.Sessions.MaxAge, cfg.Sessions.MaxSessions)
+	}
+
+	srv := &server{
+		cfg:            cfg,
+		spec:           spec,
+		features:       features,
+		auth:           auth,
+		noteService:    noteService,
+		fileService:    fileService,
+		pasteService:   pasteService,
+		blobService:    blobService,
+		digestService:  digestService,
+		webhookService: webhookService,
+		lockService:    lockService,
+		abuseService:   abuseService,
+		accessLog:      accessLogService,
+		statsService:   statsService,
+		scanner:        scanner,
+		signer:         signer,
+		archiveTrust:   archiveTrust,
+		ipLimiter:      middleware.NewLimiter(cfg.RateLimit.IPPerMinute, cfg.RateLimit.Burst),
+		phraseLimiter:  middleware.NewLimiter(cfg.RateLimit.PhrasePerMinute, cfg.RateLimit.Burst),
+		pasteLimiter:   middleware.NewLimiter(cfg.Paste.RatePerMinute, cfg.Paste.RatePerMinute),
+		idempotency:    middleware.NewIdempotencyStore(cfg.Idempotency.TTL, cfg.Idempotency.MaxEntries),
+		sessions:       sessions,
+	}
+
+	// Store files in S3 when configured. Like the SMTP overrides below this is
+	// in memory only, and it is applied again whenever PocketBase reloads its
+	// settings, so saving them in the admin UI doesn't switch storage back.
+	if cfg.S3.Bucket != "" {
+		app.OnSettingsReload().BindFunc(func(e *core.SettingsReloadEvent) error {
+			if err := e.Next(); err != nil {
+				return err
+			}
+			s3 := &e.App.Settings().S3
+			s3.Enabled = true
+			s3.Bucket = cfg.S3.Bucket
+			s3.Region = cfg.S3.Region
+			s3.Endpoint = cfg.S3.Endpoint
+			s3.AccessKey = cfg.S3.AccessKey
+			s3.Secret = cfg.S3.Secret
+			s3.ForcePathStyle = cfg.S3.ForcePathStyle
+			return nil
+		})
+	}
 
 	// Register custom routes
 	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
-		// Create a route group for our API
-		api := se.Router.Group("/api/secretnotes")
-
-		// Health check endpoint
-		api.GET("/", func(e *core.RequestEvent) error {
-			return e.JSON(http.StatusOK, map[string]string{
-				"message": "Secret Notes API is live",
-				"version": "1.0.0",
-			})
-		})
+		// Refuse to start against a bucket attachments can't be stored in
+		if se.App.Settings().S3.Enabled {
+			if err := fileService.CheckStorage(); err != nil {
+				return fmt.Errorf("S3 storage: %w", err)
+			}
+		}
+
+		// Bans issued before a restart still hold
+		if cfg.Abuse.Enabled {
+			if err := abuseService.Load(); err != nil {
+				log.Printf("Warning: failed to load abuse bans: %v", err)
+			}
+		}
 
-		// Get note using passphrase from header/body
-        api.GET("/notes", func(e *core.RequestEvent) error {
-            phrase, err := extractPassphrase(e, "")
-            if err != nil {
-                return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
-            }
-            return handleGetOrCreateNote(e, phrase, noteService)
-        })
-
-        // Create note (same behavior as GET) using passphrase from header/body
-        api.POST("/notes", func(e *core.RequestEvent) error {
-            // We don't need message body here, just passphrase
-            // Try to read minimal body to allow passphrase in JSON if provided
-            data := struct{ Passphrase string `json:"passphrase"` }{}
-            _ = e.BindBody(&data)
-            phrase, err := extractPassphrase(e, data.Passphrase)
-            if err != nil {
-                return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
-            }
-            return handleGetOrCreateNote(e, phrase, noteService)
-        })
-
-        // Update note using passphrase from header/body
-        api.PATCH("/notes", func(e *core.RequestEvent) error {
-            data := struct {
-                Passphrase string `json:"passphrase"`
-                Message    string `json:"message"`
-            }{}
-            if err := e.BindBody(&data); err != nil {
-                return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
-            }
-            phrase, err := extractPassphrase(e, data.Passphrase)
-            if err != nil {
-                return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
-            }
-            // Reuse original handler (expects phrase)
-            // Re-pack the message into the expected struct in that handler
-            e.Request.Body = http.NoBody // prevent double reads; handler will not re-bind
-            // Directly call the lower-level noteService method instead of handler expecting body
-            note, svcErr := noteService.UpdateNote(phrase, data.Message)
-            if svcErr != nil {
-                return e.JSON(http.StatusNotFound, map[string]string{"error": svcErr.Error()})
-            }
-            return e.JSON(http.StatusOK, map[string]any{
-                "id": note.ID,
-                "message": note.Message,
-                "hasImage": note.ImageHash != "",
-                "created": note.Created,
-                "updated": note.Updated,
-            })
-        })
-
-        // Upsert note using passphrase from header/body
-        api.PUT("/notes", func(e *core.RequestEvent) error {
-            data := struct {
-                Passphrase string `json:"passphrase"`
-                Message    string `json:"message"`
-            }{}
-            if err := e.BindBody(&data); err != nil {
-                return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
-            }
-            phrase, err := extractPassphrase(e, data.Passphrase)
-            if err != nil {
-                return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
-            }
-            // Reuse existing upsert logic with modified signature
-            return handleUpsertNoteWithMessage(e, phrase, data.Message, noteService)
-        })
-
-        // Upload image for note using passphrase from header
-        api.POST("/notes/image", func(e *core.RequestEvent) error {
-            phrase, err := extractPassphrase(e, "")
-            if err != nil {
-                return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
-            }
-            return handleUploadImage(e, phrase, noteService, fileService)
-        })
-
-        // Get image for note using passphrase from header
-        api.GET("/notes/image", func(e *core.RequestEvent) error {
-            phrase, err := extractPassphrase(e, "")
-            if err != nil {
-                return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
-            }
-            return handleGetImage(e, phrase, fileService)
-        })
-
-        // Delete image for note using passphrase from header
-        api.DELETE("/notes/image", func(e *core.RequestEvent) error {
-            phrase, err := extractPassphrase(e, "")
-            if err != nil {
-                return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
-            }
-            return handleDeleteImage(e, phrase, noteService, fileService)
-        })
+
+		// Apply SMTP overrides from the environment (in-memory only, the
+		// PocketBase admin settings are left untouched on disk)
+		if cfg.SMTP.Host != "" {
+			smtp := &se.App.Settings().SMTP
+			smtp.Enabled = true
+			smtp.Host = cfg.SMTP.Host
+			smtp.Port = cfg.SMTP.Port
+			smtp.Username = cfg.SMTP.Username
+			smtp.Password = cfg.SMTP.Password
+			smtp.TLS = cfg.SMTP.TLS
+		}
+		if digestService != nil && digestService.From.Address == "" {
+			digestService.From.Address = se.App.Settings().Meta.SenderAddress
+		}
+
+		// Mount the API twice: v1 keeps its historical error bodies, v2 answers
+		// with typed error codes (see package apierror)
+		srv.registerRoutes(se.Router.Group("/api/secretnotes"))
+
+		v2 := se.Router.Group("/api/secretnotes/v2")
+		v2.Bind(apierror.UseV2())
+		srv.registerRoutes(v2)
 
 		return se.Next()
 	})
 
+	// Admin commands: secretnotes fsck [--repair] [--delete-orphans] [--json],
+	// secretnotes audit-encryption [--json], secretnotes
+	// rotate-server-layer [--json] and secretnotes reencrypt [--rate N]
+	// [--restart] [--json]
+	integrityService := services.NewIntegrityService(app, fileService)
+	app.RootCmd.AddCommand(newFsckCommand(integrityService))
+	app.RootCmd.AddCommand(newAuditEncryptionCommand(integrityService))
+	app.RootCmd.AddCommand(newRotateServerLayerCommand(integrityService))
+	app.RootCmd.AddCommand(newReencryptCommand(integrityService))
+
 	if err := app.Start(); err != nil {
 		log.Fatal(err)
 	}
@@ -149,26 +342,36 @@ func main() {
 // Handler functions
 func handleGetOrCreateNote(e *core.RequestEvent, phrase string, noteService *services.NoteService) error {
 	// Use the note service to get or create the note
-	note, err := noteService.GetOrCreateNote(phrase)
+	note, wasCreated, err := noteService.GetOrCreateNote(phrase)
 	
 	if err != nil {
-		return e.JSON(http.StatusInternalServerError, map[string]string{
-			"error": err.Error(),
-		})
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+
+	usage, err := noteService.Usage(phrase, note.Message)
+	if err != nil {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, err.Error(), nil)
 	}
 
-	// Determine status code based on whether note was just created
 	status := http.StatusOK
-	if note.Created.Equal(note.Updated) {
+	if wasCreated {
 		status = http.StatusCreated
 	}
 
 	return e.JSON(status, map[string]any{
 		"id": note.ID,
 		"message": note.Message,
+		"title": note.Title,
+		"tags": note.Tags,
 		"hasImage": note.ImageHash != "",
 		"created": note.Created,
 		"updated": note.Updated,
+		"destroyAt": note.DestroyAt,
+		"accessCount": note.AccessCount,
+		"lastAccessed": note.LastAccessed,
+		"readOnly": note.ReadOnly,
+		"usage": usage,
+		"wasCreated": wasCreated,
 	})
 }
 
@@ -176,77 +379,128 @@ func handleUpdateNote(e *core.RequestEvent, phrase string, noteService *services
 	// Read request body
 	data := struct {
 		Message string `json:"message"`
+		services.NoteMetadata
 	}{}
 	
 	if err := e.BindBody(&data); err != nil {
-		return e.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Invalid request body",
-		})
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Invalid request body", nil)
+	}
+	meta, err := services.NormalizeMetadata(data.NoteMetadata)
+	if err != nil {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, err.Error(), nil)
 	}
 	
 	// Use the note service to update the note
-	note, err := noteService.UpdateNote(phrase, data.Message)
+	note, err := noteService.UpdateNote(phrase, data.Message, meta)
 	if err != nil {
-		return e.JSON(http.StatusNotFound, map[string]string{
-			"error": err.Error(),
-		})
+		return apierror.Respond(e, http.StatusNotFound, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+	usage, err := noteService.Usage(phrase, note.Message)
+	if err != nil {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, err.Error(), nil)
 	}
 	
 	return e.JSON(http.StatusOK, map[string]any{
 		"id": note.ID,
 		"message": note.Message,
+		"title": note.Title,
+		"tags": note.Tags,
 		"hasImage": note.ImageHash != "",
 		"created": note.Created,
 		"updated": note.Updated,
+		"destroyAt": note.DestroyAt,
+		"accessCount": note.AccessCount,
+		"lastAccessed": note.LastAccessed,
+		"readOnly": note.ReadOnly,
+		"usage": usage,
 	})
 }
 
-func handleUploadImage(e *core.RequestEvent, phrase string, noteService *services.NoteService, fileService *services.FileService) error {
+func handleUploadImage(e *core.RequestEvent, phrase string, limits config.LimitsConfig, multipartMemory int64, scan func(context.Context, io.Reader) error, noteService *services.NoteService, fileService *services.FileService) error {
 	// Check if note exists first
-	_, err := noteService.GetOrCreateNote(phrase)
+	_, _, err := noteService.GetOrCreateNote(phrase)
 	if err != nil {
-		return e.JSON(http.StatusInternalServerError, map[string]string{
-			"error": err.Error(),
-		})
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.FromError(err, apierror.Internal), err.Error(), nil)
 	}
 	
-	// Parse multipart form
-	if err := e.Request.ParseMultipartForm(10 << 20); err != nil { // 10 MB max
-		return e.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Failed to parse form",
-		})
+	// Parse multipart form (keeps up to multipartMemory in memory, the rest spills to temp files)
+	if err := e.Request.ParseMultipartForm(multipartMemory); err != nil {
+		if middleware.IsBodyTooLarge(err) {
+			return middleware.PayloadTooLarge(e, "upload", limits.MaxUploadBytes, -1)
+		}
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Failed to parse form", nil)
 	}
 	
 	// Get uploaded file
 	file, header, err := e.Request.FormFile("image")
 	if err != nil {
-		return e.JSON(http.StatusBadRequest, map[string]string{
-			"error": "No image file provided",
-		})
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "No image file provided", nil)
 	}
 	defer file.Close()
-	
-	// Use file service to store the encrypted file
-	fileHash, err := fileService.StoreEncryptedFile(phrase, file, header.Filename, header.Header.Get("Content-Type"))
+
+	if header.Size > limits.MaxUploadBytes {
+		return middleware.PayloadTooLarge(e, "upload", limits.MaxUploadBytes, header.Size)
+	}
+	transform, err := services.ParseImageTransform(e.Request.FormValue("maxWidth"), e.Request.FormValue("maxHeight"), e.Request.FormValue("format"), e.Request.FormValue("quality"))
 	if err != nil {
-		return e.JSON(http.StatusInternalServerError, map[string]string{
-			"error": err.Error(),
-		})
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, err.Error(), nil)
+	}
+
+	// The upload is read in passes from where the form parser left it (in
+	// memory or a temp file) rather than loaded whole, so large files are
+	// scanned and encrypted in roughly constant memory
+	content := io.NewSectionReader(file, 0, header.Size)
+	head := make([]byte, 512)
+	n, err := io.ReadFull(io.NewSectionReader(content, 0, content.Size()), head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Failed to read image", nil)
+	}
+	// Store the type the bytes actually are, not just what the client claims
+	filename := header.Filename
+	contentType, err := services.SniffContentType(head[:n], header.Header.Get("Content-Type"))
+	if err != nil {
+		return apierror.Respond(e, http.StatusUnsupportedMediaType, apierror.UnsupportedMediaType, err.Error(), nil)
+	}
+
+	// Scan what the client sent, before it is transformed or encrypted
+	if err := scan(e.Request.Context(), io.NewSectionReader(content, 0, content.Size())); err != nil {
+		return scanRejected(e, filename, err)
+	}
+
+	// Downscale and re-encode before encryption when asked to; the image is
+	// decoded whole anyway
+	if !transform.IsZero() {
+		data, err := io.ReadAll(io.NewSectionReader(content, 0, content.Size()))
+		if err != nil {
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Failed to read image", nil)
+		}
+		data, filename, contentType, err = transform.Apply(data, filename, contentType)
+		if err != nil {
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, err.Error(), nil)
+		}
+		content = io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data)))
+	}
+	if !services.ContentTypeAllowed(contentType, limits.UploadTypes) {
+		return uploadTypeNotAllowed(e, contentType, limits.UploadTypes)
+	}
+
+	// Use file service to store the encrypted file; it replaces any attachments
+	// the note has and enforces the attachment quota
+	fileHash, err := fileService.StoreEncryptedFile(phrase, content, filename, contentType)
+	if err != nil {
+		return quotaError(e, err)
 	}
 	
 	// Update note with image hash reference
 	if err := noteService.UpdateNoteImageHash(phrase, fileHash); err != nil {
-		return e.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to update note with image reference: " + err.Error(),
-		})
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, "Failed to update note with image reference: " + err.Error(), nil)
 	}
 
 	// Try to read back the encrypted_files record to include timestamps in the response.
 	// If anything fails here, we still return success without timestamps to avoid breaking clients.
-	var createdVal any
-	var updatedVal any
+	var createdVal, updatedVal *time.Time
 	if app := e.App; app != nil {
-		phraseHash := hashPhrase(phrase)
+		phraseHash := noteService.Encryption.PhraseHash(phrase)
 		records, err := app.FindRecordsByFilter(
 			"encrypted_files",
 			"phrase_hash = {:phrase_hash}",
@@ -258,57 +512,74 @@ func handleUploadImage(e *core.RequestEvent, phrase string, noteService *service
 		if err == nil && len(records) > 0 {
 			rec := records[0]
 			// Use whatever "created"/"updated" is available (system or custom Autodate fields)
-			createdVal = rec.GetDateTime("created")
-			updatedVal = rec.GetDateTime("updated")
+			created, updated := services.Timestamp(rec.GetDateTime("created")), services.Timestamp(rec.GetDateTime("updated"))
+			createdVal, updatedVal = &created, &updated
 		}
 	}
 
 	return e.JSON(http.StatusOK, map[string]any{
 		"message": "Image uploaded successfully",
-		"fileName": header.Filename,
-		"fileSize": header.Size,
-		"contentType": header.Header.Get("Content-Type"),
+		"fileName": filename,
+		"fileSize": content.Size(),
+		"originalSize": header.Size,
+		"contentType": contentType,
 		"fileHash": fileHash,
 		"created": createdVal,
 		"updated": updatedVal,
 	})
 }
 
-func handleGetImage(e *core.RequestEvent, phrase string, fileService *services.FileService) error {
-	// Use file service to retrieve and decrypt the file
-	decryptedData, filename, contentType, err := fileService.RetrieveDecryptedFile(phrase)
+func handleGetImage(e *core.RequestEvent, phrase, disposition string, fileService *services.FileService) error {
+	disposition, err := services.ParseDisposition(disposition)
 	if err != nil {
-		return e.JSON(http.StatusNotFound, map[string]string{
-			"error": err.Error(),
-		})
+		return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, err.Error(), nil)
+	}
+
+	// Answer 304 for a version the client already has, before decrypting anything
+	etag, modified, err := fileService.FileVersion(phrase)
+	if err != nil {
+		return apierror.Respond(e, http.StatusNotFound, apierror.FromError(err, apierror.Internal), err.Error(), nil)
+	}
+	e.Response.Header().Set("Cache-Control", "private, no-cache")
+	if middleware.NotModified(e, etag, modified) {
+		return e.NoContent(http.StatusNotModified)
+	}
+
+	// Open the file for reading; chunked attachments (audio and large files)
+	// decrypt only the chunks a Range request asks for
+	file, err := fileService.OpenFile(phrase)
+	if err != nil {
+		return apierror.Respond(e, http.StatusNotFound, apierror.FromError(err, apierror.Internal), err.Error(), nil)
 	}
+	defer file.Close()
 	
 	// Set appropriate headers for file download
-	e.Response.Header().Set("Content-Type", contentType)
-	e.Response.Header().Set("Content-Disposition", "attachment; filename=\"" + filename + "\"")
-	
-	// Write the decrypted file directly to the response
-	_, err = e.Response.Write(decryptedData)
-	if err != nil {
-		return e.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to send image",
-		})
+	e.Response.Header().Set("Content-Type", file.ContentType)
+	e.Response.Header().Set("Content-Disposition", services.ContentDisposition(disposition, file.Name))
+	if disposition == services.DispositionInline {
+		// Rendered in the browser: don't let it guess a type, or run scripts
+		// an uploaded HTML or SVG file might carry with the API's origin
+		e.Response.Header().Set("X-Content-Type-Options", "nosniff")
+		e.Response.Header().Set("Content-Security-Policy", "sandbox")
 	}
 	
+	// ServeContent answers Range and If-Range requests and sets Content-Length
+	http.ServeContent(e.Response, e.Request, "", modified, file)
 	return nil
 }
 
 func handleDeleteImage(e *core.RequestEvent, phrase string, noteService *services.NoteService, fileService *services.FileService) error {
 	// Use file service to delete the encrypted file
-	err := fileService.DeleteEncryptedFile(phrase)
+	imageHash, err := fileService.DeleteEncryptedFile(phrase)
 	if err != nil {
-		return e.JSON(http.StatusNotFound, map[string]string{
-			"error": err.Error(),
-		})
+		return apierror.Respond(e, http.StatusNotFound, apierror.FromError(err, apierror.Internal), err.Error(), nil)
 	}
 	
-	// TODO: Update note to remove image hash reference
-	// We need to add a method to NoteService for this
+	// Point the note at the attachment served next, or drop the reference so
+	// hasImage turns false when none are left (an orphaned attachment has no note)
+	if err := noteService.UpdateNoteImageHash(phrase, imageHash); err != nil && !errors.Is(err, services.ErrNoteNotFound) {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, "Failed to clear image reference: " + err.Error(), nil)
+	}
 	
 	return e.JSON(http.StatusOK, map[string]string{
 		"message": "Image deleted successfully",
@@ -317,24 +588,6 @@ func handleDeleteImage(e *core.RequestEvent, phrase string, noteService *service
 
 // Helper functions
 
-// extractPassphrase fetches the passphrase from X-Passphrase header or fallback string (e.g., bound body field).
-func extractPassphrase(e *core.RequestEvent, fallback string) (string, error) {
-    phrase := e.Request.Header.Get("X-Passphrase")
-    if phrase == "" {
-        phrase = fallback
-    }
-    if len(phrase) < 3 {
-        return "", fmt.Errorf("Passphrase must be at least 3 characters long")
-    }
-    return phrase, nil
-}
-
-// hashPhrase creates a SHA-256 hash of the phrase for secure storage and lookup
-func hashPhrase(phrase string) string {
-	hash := sha256.Sum256([]byte(phrase))
-	return hex.EncodeToString(hash[:])
-}
-
 // hashBytes creates a SHA-256 hash of a byte array
 func hashBytes(data []byte) string {
 	hash := sha256.Sum256(data)
@@ -355,18 +608,26 @@ func previewString(s string, max int) string {
 
 // handleUpsertNote creates or updates a note in a single call.
 // If a record for the phrase exists, it updates the message; otherwise it creates a new note with the message.
-func handleUpsertNoteWithMessage(e *core.RequestEvent, phrase string, message string, noteService *services.NoteService) error {
+func handleUpsertNoteWithMessage(e *core.RequestEvent, phrase string, message string, meta services.NoteMetadata, noteService *services.NoteService) error {
     app := e.App
-    encryptionService := services.NewEncryptionService()
+    encryptionService := noteService.Encryption
 
-    phraseHash := hashPhrase(phrase)
+    phraseHash := encryptionService.PhraseHash(phrase)
 
     // Try find existing
     records, err := app.FindRecordsByFilter("notes", "phrase_hash = {:phrase_hash}", "", 1, 0, dbx.Params{"phrase_hash": phraseHash})
     if err != nil {
-        return e.JSON(http.StatusInternalServerError, map[string]string{
-            "error": "Failed to query notes: " + err.Error(),
-        })
+        return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, "Failed to query notes: " + err.Error(), nil)
+    }
+
+    // A note past its scheduled destruction is gone, even if the purge job hasn't run yet
+    if len(records) > 0 {
+        if at := services.DestroyAt(records[0]); at != nil && !at.After(time.Now()) {
+            if err := noteService.DestroyNote(phrase); err != nil {
+                return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, "Failed to delete destroyed note: " + err.Error(), nil)
+            }
+            records = nil
+        }
     }
 
     var record *core.Record
@@ -374,41 +635,54 @@ func handleUpsertNoteWithMessage(e *core.RequestEvent, phrase string, message st
         record = records[0]
     } else {
         // Create new record
-        collection, err := app.FindCollectionByNameOrId("notes")
+        collection, err := app.FindCachedCollectionByNameOrId("notes")
         if err != nil {
-            return e.JSON(http.StatusInternalServerError, map[string]string{
-                "error": "Notes collection not found: " + err.Error(),
-            })
+            return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, "Notes collection not found: " + err.Error(), nil)
         }
         record = core.NewRecord(collection)
+        record.Set("id:autogenerate", "") // the ciphertext is bound to the id
         record.Set("phrase_hash", phraseHash)
     }
 
-    // Encrypt and set message (allow empty string, encode as base64 to prevent corruption)
-    encryptedMessage, err := encryptionService.EncryptData([]byte(message), phrase)
+    // Encrypt and set message (allow empty string)
+    encryptedMessage, err := encryptionService.EncryptStringBound(message, phrase, services.FieldBinding("notes", record.Id, "message"))
     if err != nil {
-        return e.JSON(http.StatusInternalServerError, map[string]string{
-            "error": "Failed to encrypt message",
-        })
+        return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, "Failed to encrypt message", nil)
+    }
+    record.Set("message", encryptedMessage)
+    if err := noteService.ApplyMetadata(record, phrase, meta); err != nil {
+        return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, "Failed to encrypt metadata", nil)
     }
-    record.Set("message", base64.StdEncoding.EncodeToString(encryptedMessage))
 
     if err := app.Save(record); err != nil {
-        return e.JSON(http.StatusInternalServerError, map[string]string{
-            "error": "Failed to save note",
-        })
+        return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, "Failed to save note", nil)
     }
 
+    wasCreated := len(records) == 0
     status := http.StatusOK
-    if len(records) == 0 {
+    if wasCreated {
         status = http.StatusCreated
     }
 
+    usage, err := noteService.Usage(phrase, message)
+    if err != nil {
+        return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, err.Error(), nil)
+    }
+
+    title, tags := noteService.Metadata(record, phrase)
     return e.JSON(status, map[string]any{
         "id": record.Id,
         "message": message,
+        "title": title,
+        "tags": tags,
         "hasImage": record.GetString("image_hash") != "",
-        "created": record.GetDateTime("created"),
-        "updated": record.GetDateTime("updated"),
+        "created": services.Timestamp(record.GetDateTime("created")),
+        "updated": services.Timestamp(record.GetDateTime("updated")),
+        "destroyAt": services.DestroyAt(record),
+        "accessCount": record.GetInt("access_count"),
+        "lastAccessed": services.LastAccessed(record),
+        "readOnly": record.GetBool("read_only"),
+        "usage": usage,
+        "wasCreated": wasCreated,
     })
 }
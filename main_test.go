@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+func TestDeleteImage(t *testing.T) {
+	app := migratedApp(t)
+	encryption := services.NewEncryptionService()
+	noteService := services.NewNoteService(app, encryption)
+	fileService := services.NewFileService(app, encryption)
+	registerAttachmentHooks(app, fileService)
+
+	phrase := "delete-image-phrase"
+	if _, _, err := noteService.GetOrCreateNote(phrase); err != nil {
+		t.Fatal(err)
+	}
+	files := []services.DecryptedFile{
+		{Name: "first.txt", ContentType: "text/plain", Data: []byte("the first attachment")},
+		{Name: "second.txt", ContentType: "text/plain", Data: []byte("the second attachment")},
+	}
+	var imageHash string
+	err := app.RunInTransaction(func(txApp core.App) error {
+		var err error
+		imageHash, err = fileService.ImportFiles(txApp, phrase, files)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := noteService.UpdateNoteImageHash(phrase, imageHash); err != nil {
+		t.Fatal(err)
+	}
+
+	deleteImage := func() int {
+		t.Helper()
+		e, rec := newEvent(app, http.MethodDelete, "/api/secretnotes/notes/image", nil)
+		if err := handleDeleteImage(e, phrase, noteService, fileService); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code
+	}
+	note := func() *services.Note {
+		t.Helper()
+		note, err := noteService.FindNote(phrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return note
+	}
+
+	// the served attachment goes and the note points at the other one
+	if code := deleteImage(); code != http.StatusOK {
+		t.Fatalf("expected the image deleted, got %d", code)
+	}
+	if n, _ := fileService.CountFiles(app, phrase); n != 1 {
+		t.Fatalf("expected one attachment left, got %d", n)
+	}
+	if got := note().ImageHash; got == "" || got == imageHash {
+		t.Fatalf("expected the note to point at the remaining attachment, got %q", got)
+	}
+	file, err := fileService.OpenFile(phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil || string(data) != "the second attachment" {
+		t.Fatalf("expected the second attachment served, got %q (%v)", data, err)
+	}
+
+	// deleting the last one clears the reference
+	if code := deleteImage(); code != http.StatusOK {
+		t.Fatalf("expected the image deleted, got %d", code)
+	}
+	if got := note().ImageHash; got != "" {
+		t.Fatalf("expected no image reference, got %q", got)
+	}
+	if code := deleteImage(); code != http.StatusNotFound {
+		t.Fatalf("expected 404 without attachments, got %d", code)
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// AbuseProtection rejects banned clients with 429 and feeds the abuse tracker
+// with what guessing looks like: passphrases that find no note or attachment
+// count as misses, and wrong passphrases for data that has one (an import
+// archive) as failures. Opening a note, which creates it the first time,
+// counts as neither. It must run after ExtractPhrase.
+func AbuseProtection(abuse *services.AbuseService) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		clientKey := abuse.ClientKey(e.RealIP())
+
+		if until := abuse.BannedUntil(clientKey); !until.IsZero() {
+			return tooManyRequests(e, time.Until(until))
+		}
+
+		err := e.Next()
+
+		switch apierror.ResponseCode(e) {
+		case apierror.NoteNotFound, apierror.FileNotFound:
+			if phrase := Phrase(e); phrase != "" {
+				hash := sha256.Sum256([]byte(phrase))
+				abuse.RecordMiss(clientKey, hex.EncodeToString(hash[:]))
+			}
+		case apierror.WrongPassphrase:
+			abuse.RecordFailure(clientKey)
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/config"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+func TestAbuseProtectionSignals(t *testing.T) {
+	abuse := services.NewAbuseService(nil, config.AbuseConfig{MaxMisses: 1, MaxFailures: 1, Window: time.Hour, BaseBan: time.Minute, MaxBan: time.Hour})
+	chain := &hook.Hook[*core.RequestEvent]{}
+	chain.BindFunc(AbuseProtection(abuse))
+	app := core.NewBaseApp(core.BaseAppConfig{DataDir: t.TempDir()})
+	request := func(ip, phrase string, answer func(e *core.RequestEvent) error) int {
+		rec := httptest.NewRecorder()
+		e := &core.RequestEvent{App: app}
+		e.Request, e.Response = httptest.NewRequest(http.MethodGet, "/", nil), rec
+		e.Request.RemoteAddr = ip + ":1234"
+		SetPhrase(e, phrase)
+		if err := chain.Trigger(e, answer); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code
+	}
+	created := func(e *core.RequestEvent) error { return e.JSON(http.StatusOK, map[string]any{"wasCreated": true}) }
+	notFound := func(e *core.RequestEvent) error {
+		return apierror.Respond(e, http.StatusNotFound, apierror.FileNotFound, "encrypted file not found", nil)
+	}
+	corrupt := func(e *core.RequestEvent) error {
+		return apierror.Respond(e, http.StatusInternalServerError, apierror.CorruptCiphertext, "corrupt", nil)
+	}
+
+	// opening new notes, and corrupt data, are no sign of guessing
+	for _, phrase := range []string{"first-note", "second-note", "third-note"} {
+		request("10.0.0.1", phrase, created)
+		request("10.0.0.1", phrase, corrupt)
+	}
+	if code := request("10.0.0.1", "fourth-note", created); code != http.StatusOK {
+		t.Fatalf("expected no ban for opening notes, got %d", code)
+	}
+
+	// passphrases that find nothing are
+	request("10.0.0.2", "guess-one", notFound)
+	request("10.0.0.2", "guess-two", notFound)
+	if code := request("10.0.0.2", "guess-three", created); code != http.StatusTooManyRequests {
+		t.Fatalf("expected a ban after distinct misses, got %d", code)
+	}
+}
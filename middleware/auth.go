@@ -0,0 +1,252 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+)
+
+// Authenticator decides whether a request may use the API at all. It runs
+// before any passphrase handling, so private deployments can sit behind their
+// own identity provider while the passphrase stays the encryption factor.
+// Implementations must be safe for concurrent use.
+type Authenticator interface {
+	// Authenticate reports whether the request carries valid credentials. An
+	// error means they could not be checked (e.g. the identity provider is down).
+	Authenticate(r *http.Request) (bool, error)
+
+	// Challenge is the WWW-Authenticate value sent with 401 responses
+	Challenge() string
+}
+
+// RequireAuth rejects requests the authenticator does not accept with 401.
+// CORS preflight requests pass through, since browsers never send
+// credentials with them.
+func RequireAuth(auth Authenticator) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		if e.Request.Method == http.MethodOptions {
+			return e.Next()
+		}
+
+		ok, err := auth.Authenticate(e.Request)
+		if err != nil {
+			return apierror.Respond(e, http.StatusServiceUnavailable, apierror.Internal, "Could not verify credentials", nil)
+		}
+		if !ok {
+			e.Response.Header().Set("WWW-Authenticate", auth.Challenge())
+			return apierror.Respond(e, http.StatusUnauthorized, apierror.Unauthorized, "Authentication required", nil)
+		}
+		return e.Next()
+	}
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header, or ""
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// StaticTokens accepts requests bearing one of a fixed list of tokens
+type StaticTokens struct {
+	digests [][32]byte
+}
+
+// NewStaticTokens creates an authenticator for the given bearer tokens
+func NewStaticTokens(tokens []string) *StaticTokens {
+	s := &StaticTokens{}
+	for _, token := range tokens {
+		s.digests = append(s.digests, sha256.Sum256([]byte(token)))
+	}
+	return s
+}
+
+// Authenticate compares digests in constant time, so response timing doesn't
+// reveal how much of a token matched
+func (s *StaticTokens) Authenticate(r *http.Request) (bool, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return false, nil
+	}
+	digest := sha256.Sum256([]byte(token))
+	match := 0
+	for _, known := range s.digests {
+		match |= subtle.ConstantTimeCompare(digest[:], known[:])
+	}
+	return match == 1, nil
+}
+
+func (s *StaticTokens) Challenge() string { return `Bearer realm="secretnotes"` }
+
+// BasicAuth accepts HTTP basic credentials checked against bcrypt hashes
+type BasicAuth struct {
+	users map[string][]byte // user name -> bcrypt hash
+}
+
+// NewBasicAuth creates an authenticator from "user:bcrypt-hash" entries
+func NewBasicAuth(entries []string) (*BasicAuth, error) {
+	b := &BasicAuth{users: make(map[string][]byte)}
+	for _, entry := range entries {
+		user, hash, ok := strings.Cut(entry, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("basic auth user %q: expected user:bcrypt-hash", entry)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("basic auth user %q: %w", user, err)
+		}
+		b.users[user] = []byte(hash)
+	}
+	return b, nil
+}
+
+func (b *BasicAuth) Authenticate(r *http.Request) (bool, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false, nil
+	}
+	hash, known := b.users[user]
+	if !known {
+		return false, nil
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil, nil
+}
+
+func (b *BasicAuth) Challenge() string { return `Basic realm="secretnotes", charset="UTF-8"` }
+
+// maxIntrospectionCache bounds how many accepted tokens TokenIntrospection remembers
+const maxIntrospectionCache = 10000
+
+// TokenIntrospection accepts bearer tokens that an OAuth 2.0 / OIDC provider
+// reports as active (RFC 7662). Accepted tokens are remembered for a while so
+// not every request calls the provider; rejected ones are always rechecked.
+type TokenIntrospection struct {
+	endpoint     string
+	clientID     string
+	clientSecret string
+	cacheTTL     time.Duration
+	client       *http.Client
+
+	mu    sync.Mutex
+	cache map[string]time.Time // sha256(token) -> accepted until
+	now   func() time.Time
+}
+
+// NewTokenIntrospection creates an authenticator that asks endpoint about each
+// token, authenticating as the given client
+func NewTokenIntrospection(endpoint, clientID, clientSecret string, cacheTTL time.Duration) *TokenIntrospection {
+	return &TokenIntrospection{
+		endpoint:     endpoint,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		cacheTTL:     cacheTTL,
+		client:       &http.Client{Timeout: 5 * time.Second},
+		cache:        make(map[string]time.Time),
+		now:          time.Now,
+	}
+}
+
+func (t *TokenIntrospection) Authenticate(r *http.Request) (bool, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return false, nil
+	}
+	digest := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(digest[:])
+
+	t.mu.Lock()
+	until, cached := t.cache[key]
+	t.mu.Unlock()
+	if cached && t.now().Before(until) {
+		return true, nil
+	}
+
+	active, expires, err := t.introspect(r.Context(), token)
+	if err != nil || !active {
+		return false, err
+	}
+
+	until = t.now().Add(t.cacheTTL)
+	if !expires.IsZero() && expires.Before(until) {
+		until = expires
+	}
+	t.remember(key, until)
+	return true, nil
+}
+
+func (t *TokenIntrospection) Challenge() string { return `Bearer realm="secretnotes"` }
+
+// introspect asks the provider whether token is active and when it expires
+func (t *TokenIntrospection) introspect(ctx context.Context, token string) (bool, time.Time, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(t.clientID), url.QueryEscape(t.clientSecret))
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return false, time.Time{}, fmt.Errorf("token introspection: status %d", res.StatusCode)
+	}
+
+	var body struct {
+		Active bool  `json:"active"`
+		Exp    int64 `json:"exp"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&body); err != nil {
+		return false, time.Time{}, errors.New("token introspection: unreadable response")
+	}
+	var expires time.Time
+	if body.Exp > 0 {
+		expires = time.Unix(body.Exp, 0)
+	}
+	return body.Active, expires, nil
+}
+
+// remember caches an accepted token, dropping expired entries once the cache is full
+func (t *TokenIntrospection) remember(key string, until time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.cache) >= maxIntrospectionCache {
+		now := t.now()
+		for k, v := range t.cache {
+			if !now.Before(v) {
+				delete(t.cache, k)
+			}
+		}
+		if len(t.cache) >= maxIntrospectionCache {
+			return
+		}
+	}
+	t.cache[key] = until
+}
+
+var (
+	_ Authenticator = (*StaticTokens)(nil)
+	_ Authenticator = (*BasicAuth)(nil)
+	_ Authenticator = (*TokenIntrospection)(nil)
+)
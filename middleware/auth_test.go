@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func withBearer(token string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/secretnotes/notes", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func TestStaticTokens(t *testing.T) {
+	auth := NewStaticTokens([]string{"alpha", "beta"})
+	cases := map[string]bool{"alpha": true, "beta": true, "gamma": false, "alph": false, "": false}
+	for token, want := range cases {
+		if got, _ := auth.Authenticate(withBearer(token)); got != want {
+			t.Errorf("token %q: got %v, want %v", token, got, want)
+		}
+	}
+
+	r := withBearer("")
+	r.Header.Set("Authorization", "Basic alpha")
+	if ok, _ := auth.Authenticate(r); ok {
+		t.Fatalf("accepted a token sent with the wrong scheme")
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := NewBasicAuth([]string{"alice:" + string(hash)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	check := func(user, password string) bool {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.SetBasicAuth(user, password)
+		ok, _ := auth.Authenticate(r)
+		return ok
+	}
+	if !check("alice", "hunter2") {
+		t.Fatalf("rejected valid credentials")
+	}
+	if check("alice", "hunter3") || check("bob", "hunter2") {
+		t.Fatalf("accepted invalid credentials")
+	}
+
+	if _, err := NewBasicAuth([]string{"alice:plaintext"}); err == nil {
+		t.Fatalf("expected an error for a non-bcrypt hash")
+	}
+}
+
+func TestTokenIntrospection(t *testing.T) {
+	var calls atomic.Int32
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if id, secret, _ := r.BasicAuth(); id != "api" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.PostFormValue("token") == "good" {
+			w.Write([]byte(`{"active":true}`))
+			return
+		}
+		w.Write([]byte(`{"active":false}`))
+	}))
+	defer provider.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := NewTokenIntrospection(provider.URL, "api", "s3cret", time.Minute)
+	auth.now = func() time.Time { return now }
+
+	if ok, err := auth.Authenticate(withBearer("good")); !ok || err != nil {
+		t.Fatalf("good token: got %v, %v", ok, err)
+	}
+	if ok, _ := auth.Authenticate(withBearer("good")); !ok || calls.Load() != 1 {
+		t.Fatalf("expected the second check to be cached, provider called %d times", calls.Load())
+	}
+
+	now = now.Add(2 * time.Minute)
+	auth.Authenticate(withBearer("good"))
+	if calls.Load() != 2 {
+		t.Fatalf("expected the cache entry to expire, provider called %d times", calls.Load())
+	}
+
+	if ok, _ := auth.Authenticate(withBearer("bad")); ok {
+		t.Fatalf("accepted an inactive token")
+	}
+
+	wrong := NewTokenIntrospection(provider.URL, "api", "wrong", time.Minute)
+	if _, err := wrong.Authenticate(withBearer("good")); err == nil {
+		t.Fatalf("expected an error when the provider rejects the client")
+	}
+}
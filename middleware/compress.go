@@ -0,0 +1,251 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+// Route classes for response compression. Compressing a response that holds a
+// secret next to attacker-influenced data lets the attacker recover the secret
+// from the compressed length (BREACH), so by default only routes that never
+// return decrypted content are compressed.
+const (
+	ClassPublic   = "public"   // health check, OpenAPI document, pastes
+	ClassMetadata = "metadata" // no decrypted content (locks, upload receipts)
+	ClassSecret   = "secret"   // decrypted notes, attachments and subscription details
+)
+
+// routeClassKey is the request store key holding the route's compression class
+const routeClassKey = "secretnotes.routeClass"
+
+// RouteClass tags the routes it is bound to with a compression class.
+// Untagged routes are treated as ClassSecret.
+func RouteClass(class string) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		e.Set(routeClassKey, class)
+		return e.Next()
+	}
+}
+
+// Compress gzip- or brotli-encodes JSON, HTML and plain text responses for
+// clients that accept it, when the route's class is in classes. Responses
+// under minBytes are sent as is.
+//
+// The decision is taken at the first write, so RouteClass may be bound on the
+// route or a sub-group, after Compress.
+func Compress(classes []string, minBytes int) func(e *core.RequestEvent) error {
+	enabled := make(map[string]bool, len(classes))
+	for _, class := range classes {
+		enabled[class] = true
+	}
+
+	return func(e *core.RequestEvent) error {
+		encoding := negotiateEncoding(e.Request.Header.Get("Accept-Encoding"))
+		if encoding == "" || e.Request.Method == http.MethodHead {
+			return e.Next()
+		}
+
+		original := e.Response
+		cw := &compressWriter{
+			ResponseWriter: original,
+			encoding:       encoding,
+			minBytes:       minBytes,
+			allowed: func() bool {
+				class, _ := e.Get(routeClassKey).(string)
+				if class == "" {
+					class = ClassSecret
+				}
+				return enabled[class]
+			},
+		}
+		e.Response = cw
+
+		err := e.Next()
+
+		e.Response = original
+		if closeErr := cw.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+}
+
+// negotiateEncoding picks br or gzip from an Accept-Encoding header, or "" if neither is acceptable
+func negotiateEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		accepted[name] = true
+	}
+	switch {
+	case accepted["br"]:
+		return "br"
+	case accepted["gzip"]:
+		return "gzip"
+	}
+	return ""
+}
+
+// compressibleType reports whether a Content-Type is worth compressing
+func compressibleType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch strings.TrimSpace(strings.ToLower(mediaType)) {
+	case "application/json", "text/html", "text/plain":
+		return true
+	}
+	return false
+}
+
+// compressWriter buffers the start of a response until it knows whether to
+// compress it: the class must allow it, the content type must be textual and
+// the body must reach minBytes.
+type compressWriter struct {
+	http.ResponseWriter
+
+	encoding string
+	minBytes int
+	allowed  func() bool
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	enc     io.WriteCloser // nil when passing through
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		if w.ResponseWriter.Header().Get("Content-Type") == "" {
+			w.ResponseWriter.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		if !w.eligible() {
+			w.start(false)
+		} else {
+			w.buf.Write(p)
+			if w.buf.Len() < w.minBytes {
+				return len(p), nil
+			}
+			return len(p), w.start(true)
+		}
+	}
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// eligible reports whether the response may be compressed once it is large enough
+func (w *compressWriter) eligible() bool {
+	h := w.ResponseWriter.Header()
+	if w.status < 200 || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" || !compressibleType(h.Get("Content-Type")) {
+		return false
+	}
+	return w.allowed()
+}
+
+// start sends the headers (and anything buffered) downstream, compressing from here on if compress is set
+func (w *compressWriter) start(compress bool) error {
+	w.decided = true
+	h := w.ResponseWriter.Header()
+
+	if w.allowed() {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if compress {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		if w.encoding == "br" {
+			w.enc = brotli.NewWriter(w.ResponseWriter)
+		} else {
+			w.enc = gzip.NewWriter(w.ResponseWriter)
+		}
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+// Flush sends what is buffered so far; streaming responses stop waiting for minBytes
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		_ = w.start(w.buf.Len() > 0 && w.eligible())
+	}
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Close finishes the response: small bodies go out uncompressed, compressed ones are terminated
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		if w.status == 0 && w.buf.Len() == 0 {
+			return nil // nothing was written (e.g. the error is rendered later)
+		}
+		if err := w.start(false); err != nil {
+			return err
+		}
+	}
+	if w.enc != nil {
+		return w.enc.Close()
+	}
+	return nil
+}
+
+// Status reports the response status to PocketBase (see router.StatusTracker)
+func (w *compressWriter) Status() int {
+	return w.status
+}
+
+// Written reports whether a response was started (see router.WriteTracker)
+func (w *compressWriter) Written() bool {
+	return w.status != 0
+}
+
+// Unwrap exposes the underlying writer (see router.RWUnwrapper)
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+var (
+	_ router.StatusTracker = (*compressWriter)(nil)
+	_ router.WriteTracker  = (*compressWriter)(nil)
+	_ router.RWUnwrapper   = (*compressWriter)(nil)
+)
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := map[string]string{
+		"":                   "",
+		"gzip":               "gzip",
+		"gzip, deflate, br":  "br",
+		"br;q=0, gzip;q=0.5": "gzip",
+		"identity":           "",
+		"GZIP":               "gzip",
+	}
+	for header, want := range cases {
+		if got := negotiateEncoding(header); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func writeThrough(allowed bool, contentType, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	w := &compressWriter{
+		ResponseWriter: rec,
+		encoding:       "gzip",
+		minBytes:       64,
+		allowed:        func() bool { return allowed },
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(body))
+	_ = w.Close()
+	return rec
+}
+
+func TestCompressWriter(t *testing.T) {
+	large := `{"message":"` + strings.Repeat("a", 500) + `"}`
+
+	rec := writeThrough(true, "application/json", large)
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected a gzip response, got headers %v", rec.Header())
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(zr); string(got) != large {
+		t.Fatalf("decompressed body does not match")
+	}
+
+	if rec := writeThrough(false, "application/json", large); rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != large {
+		t.Errorf("disallowed class was compressed")
+	}
+	if rec := writeThrough(true, "application/json", `{"ok":true}`); rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("body under minBytes was compressed")
+	}
+	if rec := writeThrough(true, "image/png", large); rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("binary content type was compressed")
+	}
+}
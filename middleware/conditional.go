@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// NotModified sets the ETag and Last-Modified response headers and reports
+// whether the request's If-None-Match, or without one its If-Modified-Since,
+// shows the client already has this version. Handlers call it before doing
+// any work and answer 304 when it returns true.
+func NotModified(e *core.RequestEvent, etag string, modified time.Time) bool {
+	header := e.Response.Header()
+	header.Set("ETag", etag)
+	if !modified.IsZero() {
+		header.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	return notModified(e.Request.Header, etag, modified)
+}
+
+func notModified(request http.Header, etag string, modified time.Time) bool {
+	if match := request.Get("If-None-Match"); match != "" {
+		return etagMatches(match, etag)
+	}
+	since, err := http.ParseTime(request.Get("If-Modified-Since"))
+	if err != nil || modified.IsZero() {
+		return false
+	}
+	// HTTP dates have whole seconds
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// etagMatches reports whether an If-None-Match list names etag, comparing
+// weakly as RFC 9110 asks for GET
+func etagMatches(list, etag string) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNotModified(t *testing.T) {
+	const etag = `"abc123"`
+	modified := time.Date(2024, 5, 1, 14, 7, 30, 500_000_000, time.UTC)
+	cases := []struct {
+		name    string
+		headers map[string]string
+		want    bool
+	}{
+		{"no validators", nil, false},
+		{"matching etag", map[string]string{"If-None-Match": etag}, true},
+		{"etag in a list", map[string]string{"If-None-Match": `"old", ` + etag}, true},
+		{"weak etag", map[string]string{"If-None-Match": `W/"abc123"`}, true},
+		{"wildcard", map[string]string{"If-None-Match": "*"}, true},
+		{"other etag", map[string]string{"If-None-Match": `"old"`}, false},
+		{"etag wins over date", map[string]string{"If-None-Match": `"old"`, "If-Modified-Since": modified.Add(time.Hour).Format(http.TimeFormat)}, false},
+		{"same second", map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, true},
+		{"changed since", map[string]string{"If-Modified-Since": modified.Add(-time.Minute).Format(http.TimeFormat)}, false},
+		{"bad date", map[string]string{"If-Modified-Since": "yesterday"}, false},
+	}
+	for _, c := range cases {
+		header := http.Header{}
+		for k, v := range c.headers {
+			header.Set(k, v)
+		}
+		if got := notModified(header, etag, modified); got != c.want {
+			t.Errorf("%s: notModified = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
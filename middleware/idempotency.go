@@ -0,0 +1,336 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+)
+
+// MaxIdempotencyKeyLength caps the Idempotency-Key header
+const MaxIdempotencyKeyLength = 255
+
+// maxSnapshotBytes is the largest response kept for replay; larger responses
+// are sent normally and their key is released
+const maxSnapshotBytes = 4 << 20
+
+// IdempotencyStore remembers the responses of recent mutating requests by
+// their Idempotency-Key so retries can be answered without running the
+// handler again. Entries live in memory for the store's TTL.
+//
+// Keys are scoped to the passphrase (or the client IP for requests without
+// one), and stored responses are sealed with a key derived from that scope
+// and the Idempotency-Key, so decrypted notes never sit in memory in the clear.
+type IdempotencyStore struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type idempotencyEntry struct {
+	fingerprint [32]byte // hash of method, route and body
+	done        bool     // false while the first request is still running
+	expires     time.Time
+
+	status      int
+	contentType string
+	sealed      []byte // nonce || AES-GCM(body)
+}
+
+// NewIdempotencyStore creates a store keeping responses for ttl, holding at
+// most maxEntries at once
+func NewIdempotencyStore(ttl time.Duration, maxEntries int) *IdempotencyStore {
+	return &IdempotencyStore{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*idempotencyEntry),
+		now:        time.Now,
+	}
+}
+
+// idempotencyState is the outcome of IdempotencyStore.begin
+type idempotencyState int
+
+const (
+	idempotencyNew      idempotencyState = iota // first request with the key; run it
+	idempotencyReplay                           // finished before; replay the entry
+	idempotencyInFlight                         // the first request is still running
+	idempotencyMismatch                         // the key was used for a different request
+	idempotencyFull                             // too many live entries; run without a key
+)
+
+// begin registers a request under id, or reports what happened to an earlier one
+func (s *IdempotencyStore) begin(id string, fingerprint [32]byte) (idempotencyState, idempotencyEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	if entry, ok := s.entries[id]; ok && entry.expires.After(now) {
+		switch {
+		case entry.fingerprint != fingerprint:
+			return idempotencyMismatch, idempotencyEntry{}
+		case !entry.done:
+			return idempotencyInFlight, idempotencyEntry{}
+		}
+		return idempotencyReplay, *entry
+	}
+
+	if len(s.entries) >= s.maxEntries {
+		return idempotencyFull, idempotencyEntry{}
+	}
+	s.entries[id] = &idempotencyEntry{fingerprint: fingerprint, expires: now.Add(s.ttl)}
+	return idempotencyNew, idempotencyEntry{}
+}
+
+// finish stores the response for id so retries replay it
+func (s *IdempotencyStore) finish(id string, status int, contentType string, sealed []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[id]; ok {
+		entry.done = true
+		entry.status = status
+		entry.contentType = contentType
+		entry.sealed = sealed
+		entry.expires = s.now().Add(s.ttl)
+	}
+}
+
+// abandon forgets id so the request can be retried from scratch
+func (s *IdempotencyStore) abandon(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, id)
+}
+
+// sweep drops expired entries. Runs at most once per minute.
+func (s *IdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for id, entry := range s.entries {
+		if !entry.expires.After(now) {
+			delete(s.entries, id)
+		}
+	}
+}
+
+// Idempotency makes POST, PUT and PATCH requests carrying an Idempotency-Key
+// header safe to retry: the first response (unless it is a 5xx) is stored and
+// replayed, marked with "Idempotent-Replayed: true", for later requests with
+// the same key and the same body. Reusing a key for a different request is
+// rejected with 422; a retry that arrives while the first request is still
+// running gets 409.
+//
+// It must run after ExtractPhrase and SizeLimits.
+func Idempotency(store *IdempotencyStore) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		key := e.Request.Header.Get("Idempotency-Key")
+		if key == "" {
+			return e.Next()
+		}
+		switch e.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+		default:
+			return e.Next()
+		}
+		if len(key) > MaxIdempotencyKeyLength {
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Idempotency-Key is too long", map[string]any{
+				"limit": MaxIdempotencyKeyLength,
+			})
+		}
+
+		scope := "phrase:" + Phrase(e)
+		if Phrase(e) == "" {
+			scope = "ip:" + e.RealIP()
+		}
+		digest := idempotencyDigest("id", scope, key)
+		id := hex.EncodeToString(digest[:])
+
+		fingerprint, err := requestFingerprint(e.Request)
+		if err != nil {
+			if IsBodyTooLarge(err) {
+				return bodyTooLarge(e)
+			}
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Invalid request body", nil)
+		}
+
+		state, entry := store.begin(id, fingerprint)
+		switch state {
+		case idempotencyMismatch:
+			return apierror.Respond(e, http.StatusUnprocessableEntity, apierror.IdempotencyKeyReused, "Idempotency-Key was already used for a different request", nil)
+		case idempotencyInFlight:
+			return apierror.Respond(e, http.StatusConflict, apierror.RequestInProgress, "A request with this Idempotency-Key is still in progress", nil)
+		case idempotencyFull:
+			return e.Next()
+		case idempotencyReplay:
+			body, err := openSnapshot(idempotencyDigest("key", scope, key), entry.sealed)
+			if err != nil {
+				return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, "Failed to replay response", nil)
+			}
+			if entry.contentType != "" {
+				e.Response.Header().Set("Content-Type", entry.contentType)
+			}
+			e.Response.Header().Set("Idempotent-Replayed", "true")
+			e.Response.WriteHeader(entry.status)
+			_, err = e.Response.Write(body)
+			return err
+		}
+
+		original := e.Response
+		rec := &recordingWriter{ResponseWriter: original}
+		e.Response = rec
+
+		err = e.Next()
+
+		e.Response = original
+		if err != nil || rec.status == 0 || rec.status >= 500 || rec.overflow {
+			store.abandon(id)
+			return err
+		}
+		sealed, sealErr := sealSnapshot(idempotencyDigest("key", scope, key), rec.body.Bytes())
+		if sealErr != nil {
+			store.abandon(id)
+			return nil
+		}
+		store.finish(id, rec.status, original.Header().Get("Content-Type"), sealed)
+		return nil
+	}
+}
+
+// idempotencyDigest derives a store id or a sealing key from the request scope
+// and its Idempotency-Key
+func idempotencyDigest(purpose, scope, key string) [32]byte {
+	return sha256.Sum256([]byte("secretnotes-idempotency\x00" + purpose + "\x00" + scope + "\x00" + key))
+}
+
+// requestFingerprint hashes what makes two requests "the same": method, route
+// and body. Multipart boundaries are left out, since clients pick a new one
+// per attempt. The body is read to EOF, which rewinds it for the handler.
+func requestFingerprint(r *http.Request) ([32]byte, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return [32]byte{}, err
+		}
+	}
+	if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil && params["boundary"] != "" {
+		body = bytes.ReplaceAll(body, []byte(params["boundary"]), nil)
+	}
+
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"\x00")
+	h.Write(body)
+	var sum [32]byte
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+func sealSnapshot(key [32]byte, body []byte) ([]byte, error) {
+	gcm, err := snapshotCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, body, nil), nil
+}
+
+func openSnapshot(key [32]byte, sealed []byte) ([]byte, error) {
+	gcm, err := snapshotCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, io.ErrUnexpectedEOF
+	}
+	nonce, ct := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ct, nil)
+}
+
+func snapshotCipher(key [32]byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// recordingWriter passes a response through while keeping a copy for replay
+type recordingWriter struct {
+	http.ResponseWriter
+
+	status   int
+	body     bytes.Buffer
+	overflow bool // the body outgrew maxSnapshotBytes and was not kept
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.overflow {
+		if w.body.Len()+len(p) > maxSnapshotBytes {
+			w.overflow = true
+			w.body.Reset()
+		} else {
+			w.body.Write(p)
+		}
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush forwards to the underlying writer (see http.Flusher)
+func (w *recordingWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Status reports the response status to PocketBase (see router.StatusTracker)
+func (w *recordingWriter) Status() int {
+	return w.status
+}
+
+// Written reports whether a response was started (see router.WriteTracker)
+func (w *recordingWriter) Written() bool {
+	return w.status != 0
+}
+
+// Unwrap exposes the underlying writer (see router.RWUnwrapper)
+func (w *recordingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+var (
+	_ router.StatusTracker = (*recordingWriter)(nil)
+	_ router.WriteTracker  = (*recordingWriter)(nil)
+	_ router.RWUnwrapper   = (*recordingWriter)(nil)
+)
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewIdempotencyStore(time.Minute, 2)
+	s.now = func() time.Time { return now }
+
+	body := sha256.Sum256([]byte("a"))
+	other := sha256.Sum256([]byte("b"))
+
+	if state, _ := s.begin("k1", body); state != idempotencyNew {
+		t.Fatalf("first request: got state %d", state)
+	}
+	if state, _ := s.begin("k1", body); state != idempotencyInFlight {
+		t.Fatalf("retry while running: got state %d", state)
+	}
+	if state, _ := s.begin("k1", other); state != idempotencyMismatch {
+		t.Fatalf("different body: got state %d", state)
+	}
+
+	s.finish("k1", 201, "application/json", []byte("sealed"))
+	state, entry := s.begin("k1", body)
+	if state != idempotencyReplay || entry.status != 201 || string(entry.sealed) != "sealed" {
+		t.Fatalf("retry after finish: got state %d, entry %+v", state, entry)
+	}
+
+	// the store is bounded; overflow runs unprotected rather than failing
+	s.begin("k2", body)
+	if state, _ := s.begin("k3", body); state != idempotencyFull {
+		t.Fatalf("full store: got state %d", state)
+	}
+
+	// abandoned and expired keys start over
+	s.abandon("k2")
+	if state, _ := s.begin("k2", other); state != idempotencyNew {
+		t.Fatalf("abandoned key: got state %d", state)
+	}
+	now = now.Add(2 * time.Minute)
+	if state, _ := s.begin("k1", other); state != idempotencyNew {
+		t.Fatalf("expired key: got state %d", state)
+	}
+}
+
+func TestSnapshotSealing(t *testing.T) {
+	key := idempotencyDigest("key", "phrase:secret", "retry-1")
+	sealed, err := sealSnapshot(key, []byte(`{"message":"hello"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := openSnapshot(key, sealed); err != nil || string(got) != `{"message":"hello"}` {
+		t.Fatalf("openSnapshot = %q, %v", got, err)
+	}
+
+	wrong := idempotencyDigest("key", "phrase:other", "retry-1")
+	if _, err := openSnapshot(wrong, sealed); err == nil {
+		t.Fatalf("snapshot opened with another scope's key")
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+// RequestLogger logs one line per request with the matched route pattern,
+// status and duration. The pattern is logged instead of the URL so paste ids
+// and other path secrets never reach the logs; headers and bodies (and with
+// them passphrases) are never logged.
+//
+// It runs ahead of SizeLimits so rejected uploads are logged too.
+func RequestLogger() *hook.Handler[*core.RequestEvent] {
+	return &hook.Handler[*core.RequestEvent]{
+		Id:       "secretnotesRequestLogger",
+		Priority: apis.DefaultBodyLimitMiddlewarePriority - 1,
+		Func:     logRequest,
+	}
+}
+
+func logRequest(e *core.RequestEvent) error {
+	start := time.Now()
+	err := e.Next()
+
+	status := e.Status()
+	var apiErr *router.ApiError
+	if status == 0 && errors.As(err, &apiErr) {
+		status = apiErr.Status
+	}
+
+	route := e.Request.Pattern
+	if route == "" {
+		route = e.Request.Method + " (unmatched)"
+	}
+	log.Printf("%s -> %d (%s)", route, status, time.Since(start).Round(time.Millisecond))
+
+	return err
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+)
+
+// Limiter is an in-memory token bucket rate limiter keyed by an arbitrary string
+// (client IP, phrase hash, ...). Each key gets its own bucket.
+type Limiter struct {
+	rate  float64 // tokens added per second
+	burst float64 // bucket capacity
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter creates a limiter allowing perMinute requests per key with the given burst
+func NewLimiter(perMinute, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token for key. When the bucket is empty it reports false and
+// how long the caller should wait before retrying.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if l.rate <= 0 {
+		return false, time.Minute
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops buckets that have refilled completely so idle clients don't
+// accumulate in memory. Runs at most once per minute.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimitByIP rejects requests with 429 Too Many Requests once the client IP
+// has exhausted its bucket
+func RateLimitByIP(l *Limiter) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		if ok, wait := l.Allow(e.RealIP()); !ok {
+			return tooManyRequests(e, wait)
+		}
+		return e.Next()
+	}
+}
+
+// RateLimitByPhrase throttles requests per passphrase hash so a single note
+// cannot be hammered from many addresses. It must run after ExtractPhrase;
+// requests without a passphrase are left to the per-IP limiter.
+func RateLimitByPhrase(l *Limiter) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		phrase := Phrase(e)
+		if phrase == "" {
+			return e.Next()
+		}
+		hash := sha256.Sum256([]byte(phrase))
+		if ok, wait := l.Allow(hex.EncodeToString(hash[:])); !ok {
+			return tooManyRequests(e, wait)
+		}
+		return e.Next()
+	}
+}
+
+// tooManyRequests writes a 429 response with a Retry-After header (whole seconds, rounded up)
+func tooManyRequests(e *core.RequestEvent, wait time.Duration) error {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	e.Response.Header().Set("Retry-After", strconv.Itoa(seconds))
+	return apierror.Respond(e, http.StatusTooManyRequests, apierror.RateLimited, "Too many requests, please retry later", map[string]any{
+		"retryAfter": seconds,
+	})
+}
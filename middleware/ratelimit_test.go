@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestLimiterAllowsBurstThenThrottles(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewLimiter(60, 3) // one token per second
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("1.2.3.4"); !ok {
+			t.Fatalf("request %d should be allowed within burst", i+1)
+		}
+	}
+
+	ok, wait := l.Allow("1.2.3.4")
+	if ok {
+		t.Fatalf("expected request beyond burst to be throttled")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Fatalf("expected wait in (0, 1s], got %v", wait)
+	}
+
+	// Other keys have their own bucket
+	if ok, _ := l.Allow("5.6.7.8"); !ok {
+		t.Fatalf("expected a different key to be allowed")
+	}
+
+	// Tokens refill over time
+	now = now.Add(time.Second)
+	if ok, _ := l.Allow("1.2.3.4"); !ok {
+		t.Fatalf("expected request to be allowed after refill")
+	}
+}
+
+func TestRateLimitByPhrase(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewLimiter(30, 2) // one token every two seconds
+	l.now = func() time.Time { return now }
+	limit := RateLimitByPhrase(l)
+	request := func(phrase string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e := &core.RequestEvent{}
+		e.Request, e.Response = httptest.NewRequest(http.MethodGet, "/", nil), rec
+		if phrase != "" {
+			SetPhrase(e, phrase)
+		}
+		if err := limit(e); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := request("hammered-phrase"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d should be allowed within burst, got %d", i+1, rec.Code)
+		}
+	}
+	rec := request("hammered-phrase")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "2" {
+		t.Fatalf("expected 429 with Retry-After 2, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	// other passphrases, and requests without one, have their own limits
+	if rec := request("another-phrase"); rec.Code != http.StatusOK {
+		t.Fatalf("expected another passphrase to be allowed, got %d", rec.Code)
+	}
+	for i := 0; i < 5; i++ {
+		if rec := request(""); rec.Code != http.StatusOK {
+			t.Fatalf("expected requests without a passphrase to pass, got %d", rec.Code)
+		}
+	}
+
+	now = now.Add(2 * time.Second)
+	if rec := request("hammered-phrase"); rec.Code != http.StatusOK {
+		t.Fatalf("expected the passphrase to be allowed after refill, got %d", rec.Code)
+	}
+}
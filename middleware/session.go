@@ -0,0 +1,237 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+)
+
+// challengeTTL is how long a challenge nonce can be answered
+const challengeTTL = time.Minute
+
+var (
+	// ErrSessionNotFound is returned for unknown, ended or expired sessions
+	ErrSessionNotFound = errors.New("access token is invalid or has expired")
+
+	// ErrBadProof is returned when a renewal's nonce or proof doesn't check out
+	ErrBadProof = errors.New("challenge nonce is unknown or expired, or the proof does not match")
+
+	// ErrTooManySessions is returned when the store is full
+	ErrTooManySessions = errors.New("too many open sessions, try again later")
+)
+
+// SessionStore keeps short-lived access tokens standing in for a passphrase,
+// so clients send the passphrase once instead of on every request. The
+// server still needs the passphrase to decrypt, so each session holds it in
+// memory, sealed with a key derived from the token: the store alone can't
+// reveal it, and it is forgotten when the session ends or the server restarts.
+//
+// Tokens expire after the store's TTL. Renewing one takes a fresh nonce from
+// Challenge and HMAC-SHA256(passphrase, nonce), so a leaked token stops
+// working at its expiry while the passphrase never travels again. Sessions
+// can't be renewed past maxAge.
+type SessionStore struct {
+	ttl         time.Duration
+	maxAge      time.Duration
+	maxSessions int
+
+	mu         sync.Mutex
+	sessions   map[string]*session  // token hash -> session
+	challenges map[string]time.Time // nonce -> expiry
+	lastSweep  time.Time
+	now        func() time.Time
+}
+
+// SessionToken is an access token and how long it and its session last
+type SessionToken struct {
+	Token         string    `json:"token"`
+	ExpiresAt     time.Time `json:"expiresAt"`     // renew before this
+	SessionEndsAt time.Time `json:"sessionEndsAt"` // no renewals past this; send the passphrase again
+}
+
+type session struct {
+	sealed  []byte    // nonce || AES-GCM(passphrase)
+	expires time.Time // token expiry; renewable until ends
+	ends    time.Time // hard end of the session
+}
+
+// NewSessionStore creates a store issuing tokens valid for ttl, renewable for
+// up to maxAge, with at most maxSessions open at once
+func NewSessionStore(ttl, maxAge time.Duration, maxSessions int) *SessionStore {
+	return &SessionStore{
+		ttl:         ttl,
+		maxAge:      maxAge,
+		maxSessions: maxSessions,
+		sessions:    make(map[string]*session),
+		challenges:  make(map[string]time.Time),
+		now:         time.Now,
+	}
+}
+
+// Open starts a session for phrase and returns its first token
+func (s *SessionStore) Open(phrase string) (*SessionToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	if len(s.sessions) >= s.maxSessions {
+		return nil, ErrTooManySessions
+	}
+	return s.issue(phrase, now, now.Add(s.maxAge))
+}
+
+// Resolve returns the passphrase behind an unexpired token
+func (s *SessionStore) Resolve(token string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[sessionID(token)]
+	if !ok || !sess.expires.After(s.now()) {
+		return "", ErrSessionNotFound
+	}
+	return openSession(token, sess.sealed)
+}
+
+// Challenge returns a single-use nonce for Renew
+func (s *SessionStore) Challenge() (string, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	if len(s.challenges) >= s.maxSessions {
+		return "", time.Time{}, ErrTooManySessions
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	nonce := hex.EncodeToString(raw)
+	expires := now.Add(challengeTTL)
+	s.challenges[nonce] = expires
+	return nonce, expires, nil
+}
+
+// Renew replaces token, which may have expired, with a new one when proof is
+// SessionProof(passphrase, nonce) for a nonce from Challenge. The nonce is
+// used up either way.
+func (s *SessionStore) Renew(token, nonce, proof string) (*SessionToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	expires, ok := s.challenges[nonce]
+	delete(s.challenges, nonce)
+	if !ok || !expires.After(now) {
+		return nil, ErrBadProof
+	}
+
+	id := sessionID(token)
+	sess, ok := s.sessions[id]
+	if !ok || !sess.ends.After(now) {
+		return nil, ErrSessionNotFound
+	}
+	phrase, err := openSession(token, sess.sealed)
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+	if !hmac.Equal([]byte(proof), []byte(SessionProof(phrase, nonce))) {
+		return nil, ErrBadProof
+	}
+
+	delete(s.sessions, id)
+	return s.issue(phrase, now, sess.ends)
+}
+
+// Close ends the session of token
+func (s *SessionStore) Close(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sessionID(token))
+}
+
+// issue stores a session for phrase under a new token. The caller holds s.mu.
+func (s *SessionStore) issue(phrase string, now, ends time.Time) (*SessionToken, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(raw)
+
+	sealed, err := sealSnapshot(sessionDigest("key", token), []byte(phrase))
+	if err != nil {
+		return nil, err
+	}
+	expires := now.Add(s.ttl)
+	if expires.After(ends) {
+		expires = ends
+	}
+	s.sessions[sessionID(token)] = &session{sealed: sealed, expires: expires, ends: ends}
+	return &SessionToken{Token: token, ExpiresAt: expires.UTC(), SessionEndsAt: ends.UTC()}, nil
+}
+
+// sweep drops ended sessions and expired challenges. Runs at most once per minute.
+func (s *SessionStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for id, sess := range s.sessions {
+		if !sess.ends.After(now) {
+			delete(s.sessions, id)
+		}
+	}
+	for nonce, expires := range s.challenges {
+		if !expires.After(now) {
+			delete(s.challenges, nonce)
+		}
+	}
+}
+
+// SessionProof is the renewal proof for nonce: hex HMAC-SHA256 keyed with the
+// passphrase. Sessions hold the normalized passphrase (see NormalizePhrase),
+// so clients must key the proof with its NFKC form.
+func SessionProof(phrase, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(phrase))
+	mac.Write([]byte(nonce))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sessionDigest derives a store id or a sealing key from a token
+func sessionDigest(purpose, token string) [32]byte {
+	return sha256.Sum256([]byte("secretnotes-session\x00" + purpose + "\x00" + token))
+}
+
+func sessionID(token string) string {
+	digest := sessionDigest("id", token)
+	return hex.EncodeToString(digest[:])
+}
+
+func openSession(token string, sealed []byte) (string, error) {
+	phrase, err := openSnapshot(sessionDigest("key", token), sealed)
+	if err != nil {
+		return "", ErrSessionNotFound
+	}
+	return string(phrase), nil
+}
+
+// AccessToken returns the X-Access-Token header of the request
+func AccessToken(e *core.RequestEvent) string {
+	return e.Request.Header.Get("X-Access-Token")
+}
+
+// invalidToken answers 401 for an unknown or expired access token
+func invalidToken(e *core.RequestEvent) error {
+	return apierror.Respond(e, http.StatusUnauthorized, apierror.TokenExpired, ErrSessionNotFound.Error(), nil)
+}
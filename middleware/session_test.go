@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSessionStore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewSessionStore(5*time.Minute, time.Hour, 2)
+	s.now = func() time.Time { return now }
+
+	first, err := s.Open("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if phrase, err := s.Resolve(first.Token); err != nil || phrase != "correct horse" {
+		t.Fatalf("resolve: got %q, %v", phrase, err)
+	}
+	if _, err := s.Resolve(first.Token + "0"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("unknown token: got %v", err)
+	}
+
+	// expired tokens stop resolving but can still be renewed with a proof
+	now = now.Add(6 * time.Minute)
+	if _, err := s.Resolve(first.Token); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expired token: got %v", err)
+	}
+
+	nonce, _, err := s.Challenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Renew(first.Token, nonce, SessionProof("wrong horse", nonce)); !errors.Is(err, ErrBadProof) {
+		t.Fatalf("wrong proof: got %v", err)
+	}
+	if _, err := s.Renew(first.Token, nonce, SessionProof("correct horse", nonce)); !errors.Is(err, ErrBadProof) {
+		t.Fatalf("reused nonce: got %v", err)
+	}
+
+	nonce, _, _ = s.Challenge()
+	renewed, err := s.Renew(first.Token, nonce, SessionProof("correct horse", nonce))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if phrase, err := s.Resolve(renewed.Token); err != nil || phrase != "correct horse" {
+		t.Fatalf("renewed token: got %q, %v", phrase, err)
+	}
+	if !renewed.SessionEndsAt.Equal(first.SessionEndsAt) {
+		t.Fatalf("renewal moved the session end from %v to %v", first.SessionEndsAt, renewed.SessionEndsAt)
+	}
+
+	// renewal uses up the old token
+	nonce, _, _ = s.Challenge()
+	if _, err := s.Renew(first.Token, nonce, SessionProof("correct horse", nonce)); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("renewing a replaced token: got %v", err)
+	}
+
+	// tokens never outlive the session
+	now = first.SessionEndsAt.Add(-time.Minute)
+	nonce, _, _ = s.Challenge()
+	last, err := s.Renew(renewed.Token, nonce, SessionProof("correct horse", nonce))
+	if err != nil || !last.ExpiresAt.Equal(first.SessionEndsAt) {
+		t.Fatalf("renewal near the end: got %+v, %v", last, err)
+	}
+
+	s.Open("another")
+	if _, err := s.Open("one too many"); !errors.Is(err, ErrTooManySessions) {
+		t.Fatalf("full store: got %v", err)
+	}
+	s.Close(last.Token)
+	if _, err := s.Resolve(last.Token); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("closed session: got %v", err)
+	}
+}
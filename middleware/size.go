@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+	"github.com/pocketbase/pocketbase/tools/router"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+)
+
+// multipartOverhead leaves room for multipart boundaries and headers on top of the file itself
+const multipartOverhead = 1 << 20
+
+// jsonOverhead leaves room for JSON escaping and other fields next to the note message
+const jsonOverhead = 64 << 10
+
+// sizeLimitKey is the request store key holding the limit applied to the body
+const sizeLimitKey = "secretnotes.sizeLimit"
+
+type sizeLimit struct {
+	what  string
+	limit int64
+}
+
+// SizeLimits caps request bodies: multipart uploads by maxUploadBytes and any
+// other body by roughly twice maxNoteBytes (JSON escaping can inflate a
+// message). Handlers still check the decoded message and file sizes exactly.
+//
+// Bodies are kept rereadable so ExtractPhrase and the handler can both read
+// them. That means a second in-memory copy, so multipart uploads are only
+// made rereadable when rereadUploads is set and they carry an
+// Idempotency-Key (Idempotency fingerprints them); otherwise PocketBase's own
+// rereadable wrapper is taken off too and they stream straight into
+// multipart parsing.
+//
+// It replaces PocketBase's default 32 MB body limit for the routes it is bound to.
+func SizeLimits(maxNoteBytes, maxUploadBytes int64, rereadUploads bool) *hook.Handler[*core.RequestEvent] {
+	return &hook.Handler[*core.RequestEvent]{
+		Id:       apis.DefaultBodyLimitMiddlewareId,
+		Priority: apis.DefaultBodyLimitMiddlewarePriority,
+		Func: func(e *core.RequestEvent) error {
+			configured, limit, what := maxNoteBytes, 2*maxNoteBytes+jsonOverhead, "note"
+			reread := true
+			if strings.HasPrefix(e.Request.Header.Get("Content-Type"), "multipart/") {
+				configured, limit, what = maxUploadBytes, maxUploadBytes+multipartOverhead, "upload"
+				reread = rereadUploads && e.Request.Header.Get("Idempotency-Key") != ""
+				if rr, ok := e.Request.Body.(*router.RereadableReadCloser); ok && !reread {
+					e.Request.Body = rr.ReadCloser
+				}
+			}
+
+			if e.Request.ContentLength > limit {
+				return PayloadTooLarge(e, what, configured, e.Request.ContentLength)
+			}
+			e.Request.Body = http.MaxBytesReader(e.Response, e.Request.Body, limit)
+			if reread {
+				e.Request.Body = &router.RereadableReadCloser{ReadCloser: e.Request.Body}
+			}
+			e.Set(sizeLimitKey, sizeLimit{what: what, limit: configured})
+
+			return e.Next()
+		},
+	}
+}
+
+// PayloadTooLarge writes a 413 response describing which limit was exceeded.
+// size may be -1 when the actual size is unknown.
+func PayloadTooLarge(e *core.RequestEvent, what string, limit, size int64) error {
+	details := map[string]any{
+		"limit": limit,
+	}
+	if size >= 0 {
+		details["size"] = size
+	}
+	msg := fmt.Sprintf("The %s exceeds the %d byte limit", what, limit)
+	return apierror.Respond(e, http.StatusRequestEntityTooLarge, apierror.PayloadTooLarge, msg, details)
+}
+
+// bodyTooLarge answers 413 for a body that overran the limit set by SizeLimits
+func bodyTooLarge(e *core.RequestEvent) error {
+	applied, _ := e.Get(sizeLimitKey).(sizeLimit)
+	if applied.what == "" {
+		applied.what = "request body"
+	}
+	return PayloadTooLarge(e, applied.what, applied.limit, -1)
+}
+
+// IsBodyTooLarge reports whether err was caused by reading past the body limit
+func IsBodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
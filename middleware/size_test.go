@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+func TestSizeLimitsRereadable(t *testing.T) {
+	limits := SizeLimits(1<<10, 1<<20, true)
+	rereadable := func(contentType, idempotencyKey string) bool {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("body"))
+		req.Header.Set("Content-Type", contentType)
+		if idempotencyKey != "" {
+			req.Header.Set("Idempotency-Key", idempotencyKey)
+		}
+		// as PocketBase's router hands it over
+		req.Body = &router.RereadableReadCloser{ReadCloser: req.Body}
+		e := &core.RequestEvent{}
+		e.Request, e.Response = req, httptest.NewRecorder()
+		if err := limits.Func(e); err != nil {
+			t.Fatal(err)
+		}
+		_, ok := e.Request.Body.(*router.RereadableReadCloser)
+		return ok
+	}
+
+	if !rereadable("application/json", "") {
+		t.Fatal("expected JSON bodies to stay rereadable")
+	}
+	if rereadable("multipart/form-data; boundary=x", "") {
+		t.Fatal("expected uploads to stream, without a copy in memory")
+	}
+	if !rereadable("multipart/form-data; boundary=x", "retry-1") {
+		t.Fatal("expected uploads with an Idempotency-Key to stay rereadable for the fingerprint")
+	}
+}
@@ -1,28 +1,124 @@
 package middleware
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
 	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+)
+
+// MinPhraseLength is the shortest passphrase the API accepts
+const MinPhraseLength = 3
+
+// phraseKey is the request store key holding the extracted passphrase, and
+// rawPhraseKey the passphrase as sent when normalizing changed it
+const (
+	phraseKey    = "secretnotes.phrase"
+	rawPhraseKey = "secretnotes.rawPhrase"
 )
 
-// ValidatePhraseLength middleware ensures the passphrase meets minimum length requirements
-func ValidatePhraseLength(minLength int) func(next func(e *core.RequestEvent) error) func(e *core.RequestEvent) error {
-	return func(next func(e *core.RequestEvent) error) func(e *core.RequestEvent) error {
-		return func(e *core.RequestEvent) error {
-			// Extract the phrase from the path
-			phrase := e.Request.PathValue("phrase")
-
-			// Validate the phrase length
-			if len(phrase) < minLength {
-				return e.JSON(http.StatusBadRequest, map[string]string{
-					"error": fmt.Sprintf("Passphrase must be at least %d characters long", minLength),
-				})
+// ErrPhraseTooShort is returned by ValidatePhrase for passphrases under MinPhraseLength
+var ErrPhraseTooShort = fmt.Errorf("Passphrase must be at least %d characters long", MinPhraseLength)
+
+// ExtractPhrase reads the passphrase from the X-Passphrase header, the session
+// behind an X-Access-Token header (when sessions is non-nil), or a
+// "passphrase" field in a JSON body, in that order, and keeps it in the
+// request store for the middlewares and handlers that follow (see Phrase).
+// Apart from answering 401 for an unknown or expired access token it never
+// rejects a request; bind RequirePhrase on routes that need a passphrase.
+// The passphrase is normalized (see NormalizePhrase); RawPhrase has it as sent.
+//
+// The body stays readable for handlers: PocketBase wraps it in a rereadable
+// reader, and reading it to EOF rewinds it.
+func ExtractPhrase(sessions *SessionStore) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		phrase := e.Request.Header.Get("X-Passphrase")
+
+		if token := AccessToken(e); phrase == "" && token != "" && sessions != nil {
+			var err error
+			if phrase, err = sessions.Resolve(token); err != nil {
+				return invalidToken(e)
 			}
+		}
 
-			// Continue with the next handler
-			return next(e)
+		if phrase == "" && strings.HasPrefix(e.Request.Header.Get("Content-Type"), "application/json") {
+			raw, err := io.ReadAll(e.Request.Body)
+			if err != nil {
+				if IsBodyTooLarge(err) {
+					return bodyTooLarge(e)
+				}
+				return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Invalid request body", nil)
+			}
+			body := struct {
+				Passphrase string `json:"passphrase"`
+			}{}
+			if json.Unmarshal(raw, &body) == nil {
+				phrase = body.Passphrase
+			}
+		}
+
+		if phrase != "" {
+			if normalized := NormalizePhrase(phrase); normalized != phrase {
+				e.Set(rawPhraseKey, phrase)
+				phrase = normalized
+			}
+			e.Set(phraseKey, phrase)
 		}
+
+		return e.Next()
+	}
+}
+
+// RequirePhrase rejects requests without a valid passphrase with 400.
+// It must run after ExtractPhrase.
+func RequirePhrase() func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		if err := ValidatePhrase(Phrase(e)); err != nil {
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadPassphrase, err.Error(), nil)
+		}
+		return e.Next()
+	}
+}
+
+// Phrase returns the passphrase found by ExtractPhrase, or "" if there was none
+func Phrase(e *core.RequestEvent) string {
+	phrase, _ := e.Get(phraseKey).(string)
+	return phrase
+}
+
+// RawPhrase returns the passphrase as the client sent it, before
+// normalization, or "" if there was none
+func RawPhrase(e *core.RequestEvent) string {
+	if raw, ok := e.Get(rawPhraseKey).(string); ok {
+		return raw
+	}
+	return Phrase(e)
+}
+
+// SetPhrase replaces the passphrase the rest of the request works with
+func SetPhrase(e *core.RequestEvent, phrase string) {
+	e.Set(phraseKey, phrase)
+}
+
+// NormalizePhrase returns phrase in Unicode NFKC form, so that the same
+// characters typed on different platforms, which may send "é" as one code
+// point or as "e" and a combining accent, or a full-width "Ａ" for "A", open
+// the same note. Every passphrase is normalized before it is hashed or a key
+// is derived from it.
+func NormalizePhrase(phrase string) string {
+	return norm.NFKC.String(phrase)
+}
+
+// ValidatePhrase checks a passphrase against the API's minimum requirements
+func ValidatePhrase(phrase string) error {
+	if len(phrase) < MinPhraseLength {
+		return ErrPhraseTooShort
 	}
+	return nil
 }
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestNormalizePhrase(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"caf\u00e9", "caf\u00e9"},  // precomposed é stays
+		{"cafe\u0301", "caf\u00e9"}, // e and a combining acute accent compose
+		{"ＡＢＣ１２３", "ABC123"},        // full-width forms fold
+		{"ﬁsh", "fish"},             // ligature
+		{"plain ascii", "plain ascii"},
+	}
+	for _, c := range cases {
+		if got := NormalizePhrase(c.in); got != c.want {
+			t.Errorf("NormalizePhrase(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestExtractPhraseNormalizes(t *testing.T) {
+	e := &core.RequestEvent{}
+	e.Request = httptest.NewRequest("GET", "/api/secretnotes/notes", nil)
+	e.Request.Header.Set("X-Passphrase", "cafe\u0301 au lait")
+	if err := ExtractPhrase(nil)(e); err != nil {
+		t.Fatal(err)
+	}
+	if got := Phrase(e); got != "caf\u00e9 au lait" {
+		t.Fatalf("expected the normalized passphrase, got %q", got)
+	}
+	if got := RawPhrase(e); got != "cafe\u0301 au lait" {
+		t.Fatalf("expected the raw passphrase to be kept, got %q", got)
+	}
+
+	e = &core.RequestEvent{}
+	e.Request = httptest.NewRequest("GET", "/api/secretnotes/notes", nil)
+	e.Request.Header.Set("X-Passphrase", "already normal")
+	if err := ExtractPhrase(nil)(e); err != nil {
+		t.Fatal(err)
+	}
+	if RawPhrase(e) != Phrase(e) {
+		t.Fatalf("expected RawPhrase to fall back to Phrase, got %q", RawPhrase(e))
+	}
+}
@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds the "pastes" collection backing the optional public paste mode.
+// Pastes are not tied to a passphrase and are purged once expired.
+func init() {
+	m.Register(func(app core.App) error {
+		pastes := core.NewBaseCollection("pastes")
+		pastes.Fields.Add(&core.TextField{
+			Name: "content",
+			// Size is enforced by the handler (SECRETNOTES_PASTE_MAX_BYTES);
+			// lift the 5000 character default so the setting is the only cap.
+			Max: 10 << 20,
+		})
+		pastes.Fields.Add(&core.DateField{
+			Name:     "expires_at",
+			Required: true,
+		})
+		pastes.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		pastes.AddIndex("idx_pastes_expires_at", false, "expires_at", "")
+
+		return app.Save(pastes)
+	}, func(app core.App) error {
+		pastes, err := app.FindCollectionByNameOrId("pastes")
+		if err == nil {
+			return app.Delete(pastes)
+		}
+		return nil
+	})
+}
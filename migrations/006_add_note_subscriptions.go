@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds the "note_subscriptions" collection for change/access digest emails.
+// The address is encrypted with the server notification key so digests can be
+// sent without the note's passphrase; pending holds content-free event counts.
+func init() {
+	m.Register(func(app core.App) error {
+		subs := core.NewBaseCollection("note_subscriptions")
+		subs.Fields.Add(&core.TextField{
+			Name:     "phrase_hash",
+			Required: true,
+		})
+		subs.Fields.Add(&core.TextField{
+			Name:     "email",
+			Required: true,
+		})
+		subs.Fields.Add(&core.SelectField{
+			Name:      "mode",
+			Required:  true,
+			MaxSelect: 1,
+			Values:    []string{"immediate", "daily"},
+		})
+		subs.Fields.Add(&core.JSONField{
+			Name: "pending",
+		})
+		subs.Fields.Add(&core.DateField{
+			Name: "last_sent",
+		})
+		subs.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		subs.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+		subs.AddIndex("idx_note_subscriptions_phrase_hash", true, "phrase_hash", "")
+
+		return app.Save(subs)
+	}, func(app core.App) error {
+		subs, err := app.FindCollectionByNameOrId("note_subscriptions")
+		if err == nil {
+			return app.Delete(subs)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds the "abuse_tracking" collection used for progressive brute-force bans.
+// Clients are identified by a hash of their IP; misses holds truncated phrase
+// hashes seen in the current window so distinct guesses can be counted.
+func init() {
+	m.Register(func(app core.App) error {
+		abuse := core.NewBaseCollection("abuse_tracking")
+		abuse.Fields.Add(&core.TextField{
+			Name:     "client_hash",
+			Required: true,
+		})
+		abuse.Fields.Add(&core.DateField{
+			Name: "window_start",
+		})
+		abuse.Fields.Add(&core.JSONField{
+			Name: "misses",
+		})
+		abuse.Fields.Add(&core.NumberField{
+			Name:    "failures",
+			OnlyInt: true,
+		})
+		abuse.Fields.Add(&core.NumberField{
+			Name:    "strikes",
+			OnlyInt: true,
+		})
+		abuse.Fields.Add(&core.DateField{
+			Name: "banned_until",
+		})
+		abuse.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+		abuse.AddIndex("idx_abuse_tracking_client_hash", true, "client_hash", "")
+
+		return app.Save(abuse)
+	}, func(app core.App) error {
+		abuse, err := app.FindCollectionByNameOrId("abuse_tracking")
+		if err == nil {
+			return app.Delete(abuse)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// PocketBase caps text fields at 5000 characters and file fields at 5 MB unless
+// told otherwise, which silently undercut the intended note and upload sizes.
+// Lift both so SECRETNOTES_MAX_NOTE_BYTES / SECRETNOTES_MAX_UPLOAD_BYTES (enforced
+// by middleware) are the only limits.
+const (
+	liftedTextMax = 1<<31 - 1
+	liftedFileMax = 1 << 40
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		notes, err := app.FindCollectionByNameOrId("notes")
+		if err != nil {
+			return err
+		}
+		if f, ok := notes.Fields.GetByName("message").(*core.TextField); ok {
+			f.Max = liftedTextMax
+		}
+		if err := app.Save(notes); err != nil {
+			return err
+		}
+
+		files, err := app.FindCollectionByNameOrId("encrypted_files")
+		if err != nil {
+			return err
+		}
+		if f, ok := files.Fields.GetByName("file_data").(*core.FileField); ok {
+			f.MaxSize = liftedFileMax
+		}
+		return app.Save(files)
+	}, func(app core.App) error {
+		if notes, err := app.FindCollectionByNameOrId("notes"); err == nil {
+			if f, ok := notes.Fields.GetByName("message").(*core.TextField); ok {
+				f.Max = 0
+			}
+			if err := app.Save(notes); err != nil {
+				return err
+			}
+		}
+		if files, err := app.FindCollectionByNameOrId("encrypted_files"); err == nil {
+			if f, ok := files.Fields.GetByName("file_data").(*core.FileField); ok {
+				f.MaxSize = 0
+			}
+			return app.Save(files)
+		}
+		return nil
+	})
+}
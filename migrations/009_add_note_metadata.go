@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds optional "title" and "tags" fields to notes. Both hold base64 ciphertext
+// (tags as an encrypted JSON array), encrypted with the note's passphrase.
+func init() {
+	m.Register(func(app core.App) error {
+		notes, err := app.FindCollectionByNameOrId("notes")
+		if err != nil {
+			return err
+		}
+		notes.Fields.Add(&core.TextField{Name: "title", Max: liftedTextMax})
+		notes.Fields.Add(&core.TextField{Name: "tags", Max: liftedTextMax})
+		return app.Save(notes)
+	}, func(app core.App) error {
+		notes, err := app.FindCollectionByNameOrId("notes")
+		if err != nil {
+			return nil
+		}
+		notes.Fields.RemoveByName("title")
+		notes.Fields.RemoveByName("tags")
+		return app.Save(notes)
+	})
+}
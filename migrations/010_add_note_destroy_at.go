@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds an optional "destroy_at" date to notes. A cron job deletes notes (and
+// their attachments) once it has passed; see NoteService.PurgeDestroyedNotes.
+func init() {
+	m.Register(func(app core.App) error {
+		notes, err := app.FindCollectionByNameOrId("notes")
+		if err != nil {
+			return err
+		}
+		notes.Fields.Add(&core.DateField{Name: "destroy_at"})
+		notes.AddIndex("idx_notes_destroy_at", false, "destroy_at", "")
+		return app.Save(notes)
+	}, func(app core.App) error {
+		notes, err := app.FindCollectionByNameOrId("notes")
+		if err != nil {
+			return nil
+		}
+		notes.RemoveIndex("idx_notes_destroy_at")
+		notes.Fields.RemoveByName("destroy_at")
+		return app.Save(notes)
+	})
+}
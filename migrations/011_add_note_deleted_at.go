@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds an optional "deleted_at" date to notes. Deleted notes stay in the
+// trash, recoverable, until a cron job purges them after the grace period
+// (SECRETNOTES_DELETE_GRACE); see NoteService.PurgeDeletedNotes.
+func init() {
+	m.Register(func(app core.App) error {
+		notes, err := app.FindCollectionByNameOrId("notes")
+		if err != nil {
+			return err
+		}
+		notes.Fields.Add(&core.DateField{Name: "deleted_at"})
+		notes.AddIndex("idx_notes_deleted_at", false, "deleted_at", "")
+		return app.Save(notes)
+	}, func(app core.App) error {
+		notes, err := app.FindCollectionByNameOrId("notes")
+		if err != nil {
+			return nil
+		}
+		notes.RemoveIndex("idx_notes_deleted_at")
+		notes.Fields.RemoveByName("deleted_at")
+		return app.Save(notes)
+	})
+}
@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds "access_count" and "last_accessed_at" to notes: how many times a note
+// has been read and decrypted, and when it last was. They are updated with a
+// plain UPDATE so reads don't touch the note's "updated" time.
+func init() {
+	m.Register(func(app core.App) error {
+		notes, err := app.FindCollectionByNameOrId("notes")
+		if err != nil {
+			return err
+		}
+		notes.Fields.Add(&core.NumberField{Name: "access_count", OnlyInt: true})
+		notes.Fields.Add(&core.DateField{Name: "last_accessed_at"})
+		return app.Save(notes)
+	}, func(app core.App) error {
+		notes, err := app.FindCollectionByNameOrId("notes")
+		if err != nil {
+			return nil
+		}
+		notes.Fields.RemoveByName("access_count")
+		notes.Fields.RemoveByName("last_accessed_at")
+		return app.Save(notes)
+	})
+}
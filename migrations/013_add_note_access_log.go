@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds the "note_access_log" collection: one row per request made on a note,
+// encrypted with the note's passphrase. The rows deliberately have no
+// timestamps of their own; "seq" only orders them.
+func init() {
+	m.Register(func(app core.App) error {
+		log := core.NewBaseCollection("note_access_log")
+		log.Fields.Add(&core.TextField{
+			Name:     "phrase_hash",
+			Required: true,
+		})
+		log.Fields.Add(&core.NumberField{
+			Name:    "seq",
+			OnlyInt: true,
+		})
+		log.Fields.Add(&core.TextField{
+			Name:     "entry",
+			Required: true,
+		})
+		log.AddIndex("idx_note_access_log_phrase_hash_seq", false, "phrase_hash, seq", "")
+
+		return app.Save(log)
+	}, func(app core.App) error {
+		log, err := app.FindCollectionByNameOrId("note_access_log")
+		if err == nil {
+			return app.Delete(log)
+		}
+		return nil
+	})
+}
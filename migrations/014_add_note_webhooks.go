@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds the "note_webhooks" collection: one outgoing webhook per note. The URL
+// and signing secret are encrypted with the server notification key, like
+// digest addresses, since pings are sent without the passphrase.
+func init() {
+	m.Register(func(app core.App) error {
+		hooks := core.NewBaseCollection("note_webhooks")
+		hooks.Fields.Add(&core.TextField{
+			Name:     "phrase_hash",
+			Required: true,
+		})
+		hooks.Fields.Add(&core.TextField{
+			Name:     "url",
+			Required: true,
+		})
+		hooks.Fields.Add(&core.TextField{
+			Name:     "secret",
+			Required: true,
+		})
+		hooks.Fields.Add(&core.TextField{
+			Name: "client_id",
+		})
+		hooks.Fields.Add(&core.DateField{
+			Name: "last_sent",
+		})
+		hooks.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		hooks.AddIndex("idx_note_webhooks_phrase_hash", true, "phrase_hash", "")
+
+		return app.Save(hooks)
+	}, func(app core.App) error {
+		hooks, err := app.FindCollectionByNameOrId("note_webhooks")
+		if err == nil {
+			return app.Delete(hooks)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds the "blobs" collection backing the optional opaque blob mode: client
+// encrypted ciphertext stored verbatim under a hash of a client-derived
+// lookup key, with the client's format metadata alongside.
+func init() {
+	m.Register(func(app core.App) error {
+		blobs := core.NewBaseCollection("blobs")
+		blobs.Fields.Add(&core.TextField{
+			Name:     "lookup_hash",
+			Required: true,
+		})
+		blobs.Fields.Add(&core.NumberField{
+			Name:    "version",
+			OnlyInt: true,
+		})
+		blobs.Fields.Add(&core.TextField{
+			Name: "format",
+		})
+		blobs.Fields.Add(&core.JSONField{
+			Name: "params",
+		})
+		blobs.Fields.Add(&core.TextField{
+			Name: "ciphertext",
+			Max:  liftedTextMax, // capped by SECRETNOTES_MAX_NOTE_BYTES instead
+		})
+		blobs.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		blobs.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+		blobs.AddIndex("idx_blobs_lookup_hash", true, "lookup_hash", "")
+
+		return app.Save(blobs)
+	}, func(app core.App) error {
+		blobs, err := app.FindCollectionByNameOrId("blobs")
+		if err == nil {
+			return app.Delete(blobs)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds a "read_only" flag to notes. While it is set, requests that would
+// change the note's content are refused with 423 until it is cleared.
+func init() {
+	m.Register(func(app core.App) error {
+		notes, err := app.FindCollectionByNameOrId("notes")
+		if err != nil {
+			return err
+		}
+		notes.Fields.Add(&core.BoolField{Name: "read_only"})
+		return app.Save(notes)
+	}, func(app core.App) error {
+		notes, err := app.FindCollectionByNameOrId("notes")
+		if err != nil {
+			return nil
+		}
+		notes.Fields.RemoveByName("read_only")
+		return app.Save(notes)
+	})
+}
@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds a "size" field to encrypted_files holding the decrypted size of each
+// attachment, so a passphrase's attachment usage can be summed without
+// reading the files. Existing files get the size of their stored ciphertext,
+// a few dozen bytes over the real one.
+func init() {
+	m.Register(func(app core.App) error {
+		files, err := app.FindCollectionByNameOrId("encrypted_files")
+		if err != nil {
+			return err
+		}
+		files.Fields.Add(&core.NumberField{
+			Name:    "size",
+			OnlyInt: true,
+		})
+		if err := app.Save(files); err != nil {
+			return err
+		}
+
+		records, err := app.FindAllRecords("encrypted_files")
+		if err != nil || len(records) == 0 {
+			return err
+		}
+		fs, err := app.NewFilesystem()
+		if err != nil {
+			return err
+		}
+		defer fs.Close()
+		for _, rec := range records {
+			attrs, err := fs.Attributes(rec.BaseFilesPath() + "/" + rec.GetString("file_data"))
+			if err != nil {
+				continue // file missing on disk; counts as empty
+			}
+			rec.Set("size", attrs.Size)
+			if err := app.SaveNoValidate(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		files, err := app.FindCollectionByNameOrId("encrypted_files")
+		if err != nil {
+			return nil
+		}
+		files.Fields.RemoveByName("size")
+		return app.Save(files)
+	})
+}
@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds a "thumbnail" file field to encrypted_files: a small JPEG preview of
+// image attachments, encrypted with the same passphrase as the original.
+// Existing attachments are left without one.
+func init() {
+	m.Register(func(app core.App) error {
+		files, err := app.FindCollectionByNameOrId("encrypted_files")
+		if err != nil {
+			return err
+		}
+		files.Fields.Add(&core.FileField{
+			Name: "thumbnail",
+		})
+		return app.Save(files)
+	}, func(app core.App) error {
+		files, err := app.FindCollectionByNameOrId("encrypted_files")
+		if err != nil {
+			return nil
+		}
+		files.Fields.RemoveByName("thumbnail")
+		return app.Save(files)
+	})
+}
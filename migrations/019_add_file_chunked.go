@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds a "chunked" flag to encrypted_files, set for attachments stored in
+// chunked envelopes (audio) so they can be streamed with Range requests.
+// Existing attachments keep their single envelope.
+func init() {
+	m.Register(func(app core.App) error {
+		files, err := app.FindCollectionByNameOrId("encrypted_files")
+		if err != nil {
+			return err
+		}
+		files.Fields.Add(&core.BoolField{
+			Name: "chunked",
+		})
+		return app.Save(files)
+	}, func(app core.App) error {
+		files, err := app.FindCollectionByNameOrId("encrypted_files")
+		if err != nil {
+			return nil
+		}
+		files.Fields.RemoveByName("chunked")
+		return app.Save(files)
+	})
+}
@@ -0,0 +1,66 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds the "attachment_contents" collection: encrypted attachment data stored
+// once per passphrase and content, keyed by an HMAC of the content under the
+// passphrase and counting the attachments that reference it. encrypted_files
+// gets a "content" field pointing at it; attachments stored before keep their
+// data in file_data.
+func init() {
+	m.Register(func(app core.App) error {
+		contents := core.NewBaseCollection("attachment_contents")
+		contents.Fields.Add(&core.TextField{
+			Name:     "phrase_hash",
+			Required: true,
+		})
+		contents.Fields.Add(&core.TextField{
+			Name:     "content_key",
+			Required: true,
+		})
+		contents.Fields.Add(&core.FileField{
+			Name:    "data",
+			MaxSize: liftedFileMax,
+		})
+		contents.Fields.Add(&core.TextField{
+			Name: "hash", // sha256 of the stored ciphertext
+		})
+		contents.Fields.Add(&core.NumberField{
+			Name:    "refs",
+			OnlyInt: true,
+		})
+		contents.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		contents.AddIndex("idx_attachment_contents_key", true, "content_key", "")
+		if err := app.Save(contents); err != nil {
+			return err
+		}
+
+		files, err := app.FindCollectionByNameOrId("encrypted_files")
+		if err != nil {
+			return err
+		}
+		files.Fields.Add(&core.TextField{
+			Name: "content",
+		})
+		files.AddIndex("idx_encrypted_files_content", false, "content", "")
+		return app.Save(files)
+	}, func(app core.App) error {
+		if files, err := app.FindCollectionByNameOrId("encrypted_files"); err == nil {
+			files.RemoveIndex("idx_encrypted_files_content")
+			files.Fields.RemoveByName("content")
+			if err := app.Save(files); err != nil {
+				return err
+			}
+		}
+		if contents, err := app.FindCollectionByNameOrId("attachment_contents"); err == nil {
+			return app.Delete(contents)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,88 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds the stored (encrypted) sizes of attachment files, so a passphrase's
+// storage can be summed from records: "stored_size" on attachment_contents
+// and, for attachments stored before deduplication, on encrypted_files, and
+// "thumbnail_size" on encrypted_files. Existing files are measured through
+// the filesystem's attributes, without reading them.
+func init() {
+	m.Register(func(app core.App) error {
+		contents, err := app.FindCollectionByNameOrId("attachment_contents")
+		if err != nil {
+			return err
+		}
+		contents.Fields.Add(&core.NumberField{
+			Name:    "stored_size",
+			OnlyInt: true,
+		})
+		if err := app.Save(contents); err != nil {
+			return err
+		}
+
+		files, err := app.FindCollectionByNameOrId("encrypted_files")
+		if err != nil {
+			return err
+		}
+		files.Fields.Add(&core.NumberField{
+			Name:    "stored_size",
+			OnlyInt: true,
+		})
+		files.Fields.Add(&core.NumberField{
+			Name:    "thumbnail_size",
+			OnlyInt: true,
+		})
+		if err := app.Save(files); err != nil {
+			return err
+		}
+
+		fs, err := app.NewFilesystem()
+		if err != nil {
+			return err
+		}
+		defer fs.Close()
+		for collection, sizes := range map[string]map[string]string{
+			"attachment_contents": {"data": "stored_size"},
+			"encrypted_files":     {"file_data": "stored_size", "thumbnail": "thumbnail_size"},
+		} {
+			records, err := app.FindAllRecords(collection)
+			if err != nil {
+				return err
+			}
+			for _, rec := range records {
+				for field, sizeField := range sizes {
+					name := rec.GetString(field)
+					if name == "" {
+						continue
+					}
+					attrs, err := fs.Attributes(rec.BaseFilesPath() + "/" + name)
+					if err != nil {
+						continue // file missing; counts as empty
+					}
+					rec.Set(sizeField, attrs.Size)
+				}
+				if err := app.SaveNoValidate(rec); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		if files, err := app.FindCollectionByNameOrId("encrypted_files"); err == nil {
+			files.Fields.RemoveByName("stored_size")
+			files.Fields.RemoveByName("thumbnail_size")
+			if err := app.Save(files); err != nil {
+				return err
+			}
+		}
+		if contents, err := app.FindCollectionByNameOrId("attachment_contents"); err == nil {
+			contents.Fields.RemoveByName("stored_size")
+			return app.Save(contents)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds a note's own attachment retention rule: "attachment_max_age", in
+// seconds, and "attachment_keep", the number of newest attachments kept. Zero
+// means no limit. A cron job purges what falls outside them; see
+// FileService.PurgeExpiredAttachments.
+func init() {
+	m.Register(func(app core.App) error {
+		notes, err := app.FindCollectionByNameOrId("notes")
+		if err != nil {
+			return err
+		}
+		notes.Fields.Add(&core.NumberField{
+			Name:    "attachment_max_age",
+			OnlyInt: true,
+		})
+		notes.Fields.Add(&core.NumberField{
+			Name:    "attachment_keep",
+			OnlyInt: true,
+		})
+		return app.Save(notes)
+	}, func(app core.App) error {
+		notes, err := app.FindCollectionByNameOrId("notes")
+		if err != nil {
+			return nil
+		}
+		notes.Fields.RemoveByName("attachment_max_age")
+		notes.Fields.RemoveByName("attachment_keep")
+		return app.Save(notes)
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/middleware"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// migrateLegacyPhrase moves notes stored under a passphrase as it was sent,
+// before passphrases were normalized, to its normalized form (see
+// middleware.NormalizePhrase). When a request's passphrase changed under
+// normalization, has a note under its raw form and none under the normalized
+// one, the note and its attachments are rekeyed in one transaction, the way
+// POST /notes/rekey does, and are found by either spelling from then on. If
+// that fails, and not because a concurrent request already moved the note,
+// the request is served under the raw passphrase, as before.
+func migrateLegacyPhrase(noteService *services.NoteService, fileService *services.FileService) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		raw, phrase := middleware.RawPhrase(e), middleware.Phrase(e)
+		if raw == phrase || middleware.ValidatePhrase(raw) != nil {
+			return e.Next()
+		}
+		if _, err := noteService.StatNote(raw); err != nil {
+			return e.Next()
+		}
+		if _, err := noteService.StatNote(phrase); err == nil {
+			// both spellings have a note; the normalized one wins
+			return e.Next()
+		}
+
+		err := e.App.RunInTransaction(func(txApp core.App) error {
+			imageHash, err := fileService.RekeyFiles(txApp, raw, phrase)
+			if err != nil {
+				return err
+			}
+			_, err = noteService.RekeyNote(txApp, raw, phrase, imageHash)
+			return err
+		})
+		if err != nil {
+			if _, statErr := noteService.StatNote(phrase); statErr == nil {
+				// another request moved it first
+				return e.Next()
+			}
+			log.Printf("Warning: could not move a note to its normalized passphrase: %v", err)
+			middleware.SetPhrase(e, raw)
+		}
+		return e.Next()
+	}
+}
+
+// migrateLegacyPhraseHash moves records stored under a legacy hash of the
+// request's passphrase, from before the current pepper was configured, to its
+// current one (see services.NoteService.MoveLegacyPhraseHash). The raw
+// passphrase is moved too, so migrateLegacyPhrase still finds notes saved
+// before normalization. A failed move is logged and the request goes on
+// without the records.
+func migrateLegacyPhraseHash(noteService *services.NoteService) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		phrases := []string{middleware.Phrase(e)}
+		if raw := middleware.RawPhrase(e); raw != phrases[0] {
+			phrases = append(phrases, raw)
+		}
+		for _, phrase := range phrases {
+			if middleware.ValidatePhrase(phrase) != nil {
+				continue
+			}
+			if _, err := noteService.MoveLegacyPhraseHash(phrase); err != nil {
+				log.Printf("Warning: could not move records off a legacy passphrase hash: %v", err)
+			}
+		}
+		return e.Next()
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+
+	"github.com/ktappdev/secretnotes-go-backend/middleware"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+func TestMigrateLegacyPhrase(t *testing.T) {
+	app := migratedApp(t)
+	encryption := services.NewEncryptionService()
+	noteService := services.NewNoteService(app, encryption)
+	fileService := services.NewFileService(app, encryption)
+	migrate := migrateLegacyPhrase(noteService, fileService)
+
+	// request runs a request sending raw through ExtractPhrase and the
+	// migration, returning the passphrase the rest of it works with
+	request := func(raw string) string {
+		t.Helper()
+		e, _ := newEvent(app, http.MethodGet, "/", nil)
+		e.Request.Header.Set("X-Passphrase", raw)
+		if err := middleware.ExtractPhrase(nil)(e); err != nil {
+			t.Fatal(err)
+		}
+		if err := migrate(e); err != nil {
+			t.Fatal(err)
+		}
+		return middleware.Phrase(e)
+	}
+	save := func(phrase, message string) {
+		t.Helper()
+		if _, _, err := noteService.GetOrCreateNote(phrase); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := noteService.UpdateNote(phrase, message, services.NoteMetadata{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	message := func(phrase string) string {
+		t.Helper()
+		note, err := noteService.FindNote(phrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return note.Message
+	}
+
+	// "e" and a combining accent, which NFKC turns into a single "é"
+	raw := "cafe\u0301 legacy"
+	phrase := middleware.NormalizePhrase(raw)
+	save(raw, "saved before normalization")
+	data := "a legacy attachment"
+	if _, err := fileService.StoreEncryptedFile(raw, section(data), "legacy.txt", "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := request(raw); got != phrase {
+		t.Fatalf("expected the request to use the normalized passphrase, got %q", got)
+	}
+	if got := message(phrase); got != "saved before normalization" {
+		t.Fatalf("expected the note under the normalized passphrase, got %q", got)
+	}
+	if _, err := noteService.StatNote(raw); err == nil {
+		t.Fatal("expected no note left under the raw passphrase")
+	}
+	file, err := fileService.OpenFile(phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(file)
+	file.Close()
+	if err != nil || string(got) != data {
+		t.Fatalf("expected the attachment under the normalized passphrase, got %q (%v)", got, err)
+	}
+
+	// when both spellings have a note, the normalized one wins and neither moves
+	raw, phrase = "nai\u0308ve both", middleware.NormalizePhrase("nai\u0308ve both")
+	save(raw, "raw")
+	save(phrase, "normalized")
+	if got := request(raw); got != phrase {
+		t.Fatalf("expected the normalized passphrase, got %q", got)
+	}
+	if message(raw) != "raw" || message(phrase) != "normalized" {
+		t.Fatal("expected both notes to stay where they were")
+	}
+
+	// a note that can't be moved is served under the raw passphrase
+	raw, phrase = "re\u0301sume\u0301 broken", middleware.NormalizePhrase("re\u0301sume\u0301 broken")
+	save(raw, "unmovable")
+	if _, err := fileService.StoreEncryptedFile(raw, section(data), "broken.txt", "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := app.FindFirstRecordByData("encrypted_files", "phrase_hash", encryption.PhraseHash(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Set("file_name", base64.StdEncoding.EncodeToString([]byte("not a ciphertext")))
+	if err := app.Save(rec); err != nil {
+		t.Fatal(err)
+	}
+	if got := request(raw); got != raw {
+		t.Fatalf("expected the raw passphrase after a failed move, got %q", got)
+	}
+	if got := message(raw); got != "unmovable" {
+		t.Fatalf("expected the note to stay under the raw passphrase, got %q", got)
+	}
+	if _, err := noteService.StatNote(phrase); err == nil {
+		t.Fatal("expected no note under the normalized passphrase")
+	}
+}
+
+func TestMigrateLegacyPhraseHash(t *testing.T) {
+	app := migratedApp(t)
+	plain := services.NewEncryptionService()
+	peppered := services.NewEncryptionService()
+	if err := peppered.SetPeppers(map[byte][]byte{1: []byte("a pepper of sixteen bytes or more")}, 1); err != nil {
+		t.Fatal(err)
+	}
+	noteService := services.NewNoteService(app, peppered)
+	moveHash := migrateLegacyPhraseHash(noteService)
+	migrate := migrateLegacyPhrase(noteService, services.NewFileService(app, peppered))
+
+	// saved without a pepper, and before normalization
+	raw := "cafe\u0301 unpeppered"
+	plainNotes := services.NewNoteService(app, plain)
+	if _, _, err := plainNotes.GetOrCreateNote(raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plainNotes.UpdateNote(raw, "saved without a pepper", services.NoteMetadata{}); err != nil {
+		t.Fatal(err)
+	}
+
+	e, _ := newEvent(app, http.MethodGet, "/", nil)
+	e.Request.Header.Set("X-Passphrase", raw)
+	if err := middleware.ExtractPhrase(nil)(e); err != nil {
+		t.Fatal(err)
+	}
+	if err := moveHash(e); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(e); err != nil {
+		t.Fatal(err)
+	}
+
+	phrase := middleware.NormalizePhrase(raw)
+	note, err := noteService.FindNote(phrase)
+	if err != nil || note.Message != "saved without a pepper" {
+		t.Fatalf("expected the note under the peppered hash of the normalized passphrase, got %+v (%v)", note, err)
+	}
+	if n, _ := app.CountRecords("notes", dbx.HashExp{"phrase_hash": plain.PhraseHash(raw)}); n != 0 {
+		t.Fatal("expected nothing left under the unpeppered hash")
+	}
+}
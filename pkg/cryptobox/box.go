@@ -0,0 +1,129 @@
+package cryptobox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/ktappdev/secretnotes-go-backend/gcmsiv"
+)
+
+// NewAEAD returns the AEAD for a cipher name, keyed with a KeySize key
+func NewAEAD(cipherName string, key []byte) (cipher.AEAD, error) {
+	switch cipherName {
+	case CipherChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	case CipherAESGCMSIV:
+		return gcmsiv.New(key)
+	case CipherAESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cipher: %w", err)
+		}
+		return cipher.NewGCM(block)
+	}
+	return nil, Unsupported("unknown cipher %q", cipherName)
+}
+
+// Options choose how Seal encrypts. The zero value is AES-256-GCM with
+// PBKDF2 at DefaultPBKDF2Iterations and a 16-byte salt.
+type Options struct {
+	Cipher   string    // one of Ciphers
+	Params   KDFParams // KDF and costs
+	SaltSize int       // MinSaltSize to MaxSaltSize
+}
+
+// Seal encrypts plaintext under passphrase into a version 1 envelope, which
+// the server's DecryptData and Open both read
+func Seal(plaintext []byte, passphrase string, opts *Options) ([]byte, error) {
+	e := &Envelope{Cipher: CipherAESGCM, Params: LegacyKDFParams(KDFPBKDF2)}
+	saltSize := LegacySaltSize
+	if opts != nil {
+		if opts.Cipher != "" {
+			e.Cipher = opts.Cipher
+		}
+		if opts.Params.KDF != "" {
+			params, err := DecodeKDFParams(opts.Params.KDF, opts.Params.Encode())
+			if err != nil {
+				return nil, err
+			}
+			e.Params = params
+		}
+		if opts.SaltSize != 0 {
+			saltSize = opts.SaltSize
+		}
+	}
+	if saltSize < MinSaltSize || saltSize > MaxSaltSize {
+		return nil, fmt.Errorf("salt size must be between %d and %d bytes", MinSaltSize, MaxSaltSize)
+	}
+
+	e.Salt = make([]byte, saltSize)
+	e.Nonce = make([]byte, NonceSize)
+	if _, err := io.ReadFull(rand.Reader, e.Salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	if _, err := io.ReadFull(rand.Reader, e.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	key := e.Params.DeriveKey(passphrase, e.Salt)
+	defer clear(key)
+	aead, err := NewAEAD(e.Cipher, key)
+	if err != nil {
+		return nil, err
+	}
+	e.Sealed = aead.Seal(nil, e.Nonce, plaintext, nil)
+	return e.Marshal(), nil
+}
+
+// Open decrypts an envelope sealed with the passphrase alone: version 1 or
+// 0, or headerless. Later versions need server keys or bindings and are
+// refused as unsupported. A wrong passphrase or tampered data gives
+// ErrWrongPassphrase.
+func Open(data []byte, passphrase string) ([]byte, error) {
+	e, err := Unmarshal(data)
+	if err == nil {
+		var plaintext []byte
+		if plaintext, err = e.Open(passphrase, nil); err == nil {
+			return plaintext, nil
+		}
+	}
+	if HasHeader(data) {
+		// a headerless envelope whose salt happens to start with a header
+		if legacy, legacyErr := UnmarshalHeaderless(data); legacyErr == nil {
+			if plaintext, legacyErr := legacy.Open(passphrase, nil); legacyErr == nil {
+				return plaintext, nil
+			}
+		}
+	}
+	return nil, err
+}
+
+// Open decrypts the envelope's data with the key derived from passphrase,
+// authenticating additionalData if the envelope is bound. Envelopes keyed
+// with more than the passphrase, or compressed, are refused as unsupported.
+func (e *Envelope) Open(passphrase string, additionalData []byte) ([]byte, error) {
+	if e.Purpose != 0 || e.Pepper != 0 || e.WrappedKey != nil {
+		return nil, Unsupported("version %d envelopes are keyed by the server", e.Version)
+	}
+	if e.Compressed {
+		return nil, Unsupported("compressed envelopes can't be opened here")
+	}
+	key := e.Params.DeriveKey(passphrase, e.Salt)
+	defer clear(key)
+	aead, err := NewAEAD(e.Cipher, key)
+	if err != nil {
+		return nil, err
+	}
+	if !e.Bound {
+		additionalData = nil
+	}
+	plaintext, err := aead.Open(nil, e.Nonce, e.Sealed, additionalData)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,88 @@
+package cryptobox
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+const testPhrase = "correct horse battery staple, but longer"
+
+func TestSealOpen(t *testing.T) {
+	for _, opts := range []*Options{
+		nil,
+		{Cipher: CipherChaCha20Poly1305, Params: KDFParams{KDF: KDFPBKDF2, Iterations: 2000}, SaltSize: 32},
+		{Cipher: CipherAESGCMSIV, Params: KDFParams{KDF: KDFScrypt, LogN: 10, R: 8, P: 1}},
+	} {
+		sealed, err := Seal([]byte("secret"), testPhrase, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plain, err := Open(sealed, testPhrase); err != nil || string(plain) != "secret" {
+			t.Fatalf("%+v: got %q, %v", opts, plain, err)
+		}
+		if _, err := Open(sealed, testPhrase+"!"); !errors.Is(err, ErrWrongPassphrase) {
+			t.Fatalf("%+v: wrong passphrase: expected ErrWrongPassphrase, got %v", opts, err)
+		}
+	}
+}
+
+func TestSealRejectsBadOptions(t *testing.T) {
+	for _, opts := range []*Options{
+		{Cipher: "rot13"},
+		{Params: KDFParams{KDF: KDFPBKDF2}},
+		{SaltSize: MaxSaltSize + 1},
+	} {
+		if _, err := Seal([]byte("x"), testPhrase, opts); err == nil {
+			t.Fatalf("%+v: expected an error", opts)
+		}
+	}
+}
+
+func TestOpenHeaderless(t *testing.T) {
+	// a headerless envelope whose salt happens to start with the magic
+	salt := append(append([]byte{}, magic...), bytes.Repeat([]byte{9}, LegacySaltSize-len(magic))...)
+	e := &Envelope{Cipher: CipherAESGCM, Params: LegacyKDFParams(KDFPBKDF2), Salt: salt, Nonce: make([]byte, NonceSize)}
+	aead, err := NewAEAD(e.Cipher, e.Params.DeriveKey(testPhrase, e.Salt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append(append(append([]byte{}, salt...), e.Nonce...), aead.Seal(nil, e.Nonce, []byte("old"), nil)...)
+	if plain, err := Open(data, testPhrase); err != nil || string(plain) != "old" {
+		t.Fatalf("got %q, %v", plain, err)
+	}
+}
+
+func TestOpenBound(t *testing.T) {
+	e := &Envelope{Cipher: CipherAESGCM, Params: KDFParams{KDF: KDFPBKDF2, Iterations: 1000}, Salt: make([]byte, 16), Nonce: make([]byte, NonceSize), Bound: true}
+	aead, err := NewAEAD(e.Cipher, e.Params.DeriveKey(testPhrase, e.Salt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ad := []byte("notes/abc/message")
+	e.Sealed = aead.Seal(nil, e.Nonce, []byte("bound"), ad)
+
+	parsed, err := Unmarshal(e.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := parsed.Open(testPhrase, ad); err != nil || string(plain) != "bound" {
+		t.Fatalf("got %q, %v", plain, err)
+	}
+	if _, err := parsed.Open(testPhrase, []byte("notes/xyz/message")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("other additional data: expected ErrWrongPassphrase, got %v", err)
+	}
+}
+
+func TestOpenRefusesServerKeyedEnvelopes(t *testing.T) {
+	for _, e := range []*Envelope{
+		{Purpose: PurposeMessage, Bound: true},
+		{Purpose: PurposeMessage, Bound: true, Pepper: 1},
+		{Compressed: true, Size: 10},
+	} {
+		e.Cipher, e.Params, e.Salt, e.Nonce, e.Sealed = CipherAESGCM, LegacyKDFParams(KDFPBKDF2), make([]byte, 16), make([]byte, NonceSize), make([]byte, TagSize)
+		if _, err := Open(e.Marshal(), testPhrase); !errors.Is(err, ErrUnsupportedEnvelope) {
+			t.Fatalf("%+v: expected ErrUnsupportedEnvelope, got %v", e, err)
+		}
+	}
+}
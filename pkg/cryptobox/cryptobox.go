@@ -0,0 +1,135 @@
+// Package cryptobox reads and writes the envelopes Secret Notes stores
+// encrypted data in, so clients and other tools can produce and open the same
+// ciphertexts as the server.
+//
+// An envelope holds everything needed to decrypt its data but the
+// passphrase: the cipher, the key derivation function with its costs, the
+// salt and the nonce. The current layout, version 1, is
+//
+//	"SNE" | version | cipher id | KDF id | params length | KDF params |
+//	salt length | salt | nonce | ciphertext
+//
+// The KDF params are the PBKDF2 iteration count (uint32), or scrypt's log2 N,
+// r and p (a byte each), so costs can be raised without breaking old data.
+// Version 2 seals the plaintext with additional data naming where it is
+// stored, so it only opens there. Version 3 adds a purpose id after the KDF
+// id: the key is then a subkey derived for that purpose from the passphrase
+// key. Version 4 adds the id of a server pepper mixed into the key after the
+// purpose id, and version 5 always has the pepper id, 0 for none, followed by
+// a data key wrapped by the server's key management service and mixed into
+// the key: wrapped key length (uint16) | wrapped key. In any version the
+// cipher id's high bit marks plaintext that was zstd-compressed before it was
+// sealed, and the uncompressed length (uint32) then follows the salt.
+//
+// Earlier formats stay readable: version 0, "SN\x00" | algorithm id | salt |
+// nonce | ciphertext, and the original headerless salt | nonce | ciphertext,
+// which is always AES-GCM with PBKDF2.
+//
+// Versions 1 and 0 and headerless envelopes need only the passphrase, and
+// Seal and Open handle them end to end. The later versions involve keys and
+// bindings only the server has; Marshal and Unmarshal still read and write
+// their headers.
+package cryptobox
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDecryptionFailed is returned when ciphertext is malformed or does not
+// authenticate under the given passphrase. ErrWrongPassphrase and
+// ErrCorruptCiphertext tell the two apart, and both match it.
+var ErrDecryptionFailed = errors.New("failed to decrypt data")
+
+// ErrWrongPassphrase is matched when well-formed ciphertext doesn't
+// authenticate. A wrong passphrase and tampered ciphertext look the same to
+// the cipher, so every authentication failure is reported this way: which
+// check failed never depends on the key, and the AEAD compares tags in
+// constant time.
+var ErrWrongPassphrase = fmt.Errorf("%w: wrong passphrase", ErrDecryptionFailed)
+
+// ErrCorruptCiphertext is matched when ciphertext is malformed, or stored
+// where it wasn't written, so no passphrase would open it. *EnvelopeError
+// matches it too.
+var ErrCorruptCiphertext = fmt.Errorf("%w: corrupt ciphertext", ErrDecryptionFailed)
+
+// ErrUnsupportedEnvelope is matched by envelopes of a format version or
+// algorithm this package doesn't know, typically written by a newer one
+var ErrUnsupportedEnvelope = errors.New("unsupported envelope")
+
+// EnvelopeError reports an envelope that can't be parsed. errors.Is matches
+// it against ErrDecryptionFailed, and against ErrUnsupportedEnvelope when it
+// is well formed but of an unknown version or algorithm, or else against
+// ErrCorruptCiphertext.
+type EnvelopeError struct {
+	Reason      string
+	Unsupported bool
+}
+
+func (e *EnvelopeError) Error() string {
+	return ErrDecryptionFailed.Error() + ": " + e.Reason
+}
+
+func (e *EnvelopeError) Is(target error) bool {
+	if e.Unsupported {
+		return target == ErrDecryptionFailed || target == ErrUnsupportedEnvelope
+	}
+	return target == ErrDecryptionFailed || target == ErrCorruptCiphertext
+}
+
+// Malformed returns an *EnvelopeError for data that isn't a valid envelope
+func Malformed(format string, args ...any) error {
+	return &EnvelopeError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Unsupported returns an *EnvelopeError for a valid envelope of a version or
+// algorithm that can't be read
+func Unsupported(format string, args ...any) error {
+	return &EnvelopeError{Reason: fmt.Sprintf(format, args...), Unsupported: true}
+}
+
+// Ciphers envelopes can be sealed with
+const (
+	CipherAESGCM           = "aes-256-gcm"
+	CipherChaCha20Poly1305 = "chacha20-poly1305"
+	CipherAESGCMSIV        = "aes-256-gcm-siv"
+)
+
+// Ciphers lists the supported ciphers, AES-GCM first
+var Ciphers = []string{CipherAESGCM, CipherChaCha20Poly1305, CipherAESGCMSIV}
+
+// NonceSize, TagSize and KeySize are the nonce, authentication tag and key
+// lengths of all ciphers
+const (
+	NonceSize = 12
+	TagSize   = 16
+	KeySize   = 32
+)
+
+// cipherIDs are the cipher id bytes of envelopes
+var cipherIDs = map[string]byte{
+	CipherAESGCM:           1,
+	CipherChaCha20Poly1305: 2,
+	CipherAESGCMSIV:        3,
+}
+
+// CipherID returns the id byte envelopes record cipher by, or 0 for an
+// unknown cipher
+func CipherID(cipher string) byte {
+	return cipherIDs[cipher]
+}
+
+// CipherName returns the cipher an envelope's id byte names, or "" for an
+// unknown id
+func CipherName(id byte) string {
+	return idName(cipherIDs, id)
+}
+
+func idName(ids map[string]byte, id byte) string {
+	for name, known := range ids {
+		if known == id {
+			return name
+		}
+	}
+	return ""
+}
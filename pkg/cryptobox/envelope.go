@@ -0,0 +1,265 @@
+package cryptobox
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Envelope format versions. VersionHeaderless is the original layout without
+// a header, and Version0 the first one with.
+const (
+	VersionHeaderless = -1
+	Version0          = 0
+	Version1          = 1 // unbound
+	Version2          = 2 // bound with additional data
+	Version3          = 3 // bound, with a purpose subkey
+	Version4          = 4 // version 3 with a pepper id
+	Version5          = 5 // version 4 with a KMS-wrapped data key
+)
+
+// Purpose ids of version 3 and later envelopes, naming the subkey of the
+// passphrase key a field is sealed with
+const (
+	PurposeMessage  = 1
+	PurposeFile     = 2
+	PurposeMetadata = 3
+)
+
+var (
+	magic   = []byte("SNE")
+	v0Magic = []byte("SN\x00")
+)
+
+// CompressedFlag is set in the cipher id of envelopes whose plaintext was
+// zstd-compressed before it was sealed. Readers that don't know it see an
+// unknown cipher and refuse the envelope as unsupported.
+const CompressedFlag = 0x80
+
+// MaxCompressedSize bounds the uncompressed size a compressed envelope may
+// record, so a crafted one can't make its reader allocate without limit
+const MaxCompressedSize = 64 << 20
+
+// MaxWrappedKeySize bounds the wrapped data keys an envelope may record
+const MaxWrappedKeySize = 4096
+
+// Envelope is a parsed envelope. Marshal writes the lowest version that holds
+// its fields; Version only reports what Unmarshal read.
+type Envelope struct {
+	Version int
+	Cipher  string
+	Params  KDFParams
+	Salt    []byte
+	Nonce   []byte
+	Sealed  []byte // ciphertext and tag
+
+	Bound      bool   // sealed with additional data (version 2 and later)
+	Purpose    byte   // id of the subkey purpose, 0 for the passphrase key itself
+	Pepper     byte   // id of the pepper mixed into the key, 0 for none
+	WrappedKey []byte // KMS-wrapped data key mixed into the key, nil for none
+
+	Compressed bool   // sealed plaintext is zstd-compressed
+	Size       uint32 // uncompressed plaintext size when compressed
+}
+
+// version returns the version Marshal writes
+func (e *Envelope) version() byte {
+	switch {
+	case e.WrappedKey != nil:
+		return Version5
+	case e.Pepper != 0:
+		return Version4
+	case e.Purpose != 0:
+		return Version3
+	case e.Bound:
+		return Version2
+	}
+	return Version1
+}
+
+// Marshal encodes the envelope: version 5 with a wrapped data key, 4 with a
+// pepper, 3 with a purpose, 2 for a bound envelope without one, else version 1
+func (e *Envelope) Marshal() []byte {
+	version := e.version()
+	cipherID := cipherIDs[e.Cipher]
+	if e.Compressed {
+		cipherID |= CompressedFlag
+	}
+	out := make([]byte, 0, len(magic)+17+len(e.WrappedKey)+len(e.Salt)+len(e.Nonce)+len(e.Sealed))
+	out = append(out, magic...)
+	out = append(out, version, cipherID, kdfIDs[e.Params.KDF])
+	if version >= Version3 {
+		out = append(out, e.Purpose)
+	}
+	if version >= Version4 {
+		out = append(out, e.Pepper)
+	}
+	if version == Version5 {
+		out = binary.BigEndian.AppendUint16(out, uint16(len(e.WrappedKey)))
+		out = append(out, e.WrappedKey...)
+	}
+	out = AppendKeyParams(out, e.Params, e.Salt)
+	if e.Compressed {
+		out = binary.BigEndian.AppendUint32(out, e.Size)
+	}
+	out = append(out, e.Nonce...)
+	return append(out, e.Sealed...)
+}
+
+// HasHeader reports whether data starts like a version 0 or later envelope.
+// A headerless one can too, when its random salt happens to.
+func HasHeader(data []byte) bool {
+	return bytes.HasPrefix(data, magic) || bytes.HasPrefix(data, v0Magic)
+}
+
+// Unmarshal parses an envelope of any version. Data without a header is taken
+// as the headerless layout. The envelope's slices point into data. Errors are
+// *EnvelopeError.
+func Unmarshal(data []byte) (*Envelope, error) {
+	switch {
+	case bytes.HasPrefix(data, magic):
+		return unmarshalV1(data[len(magic):])
+	case bytes.HasPrefix(data, v0Magic) && len(data) > len(v0Magic):
+		id := data[len(v0Magic)]
+		cipherName, kdf := CipherName(id&0x0f), KDFName(id>>4+1)
+		if cipherName == "" || kdf == "" {
+			return nil, Unsupported("unknown algorithm id %#x", id)
+		}
+		e, err := unmarshalHeaderless(data[len(v0Magic)+1:], cipherName, kdf)
+		if err == nil {
+			e.Version = Version0
+		}
+		return e, err
+	default:
+		return UnmarshalHeaderless(data)
+	}
+}
+
+// UnmarshalHeaderless parses data as a headerless envelope, salt | nonce |
+// ciphertext, even if it starts like a header: a headerless envelope whose
+// salt happens to is told apart from the real thing only by which of them
+// decrypts
+func UnmarshalHeaderless(data []byte) (*Envelope, error) {
+	return unmarshalHeaderless(data, CipherAESGCM, KDFPBKDF2)
+}
+
+// unmarshalV1 parses a version 1 to 5 envelope after its magic
+func unmarshalV1(data []byte) (*Envelope, error) {
+	c := &cursor{data: data}
+	version := c.byte("version")
+	if c.err == nil && (version < Version1 || version > Version5) {
+		return nil, Unsupported("unknown envelope version %d", version)
+	}
+	cipherID, kdfID := c.byte("cipher id"), c.byte("KDF id")
+	if c.err != nil {
+		return nil, c.err
+	}
+	e := &Envelope{Version: int(version), Cipher: CipherName(cipherID &^ CompressedFlag), Bound: version != Version1}
+	e.Compressed = cipherID&CompressedFlag != 0
+	if e.Cipher == "" {
+		return nil, Unsupported("unknown cipher id %d", cipherID)
+	}
+	kdf := KDFName(kdfID)
+	if kdf == "" {
+		return nil, Unsupported("unknown KDF id %d", kdfID)
+	}
+
+	if version >= Version3 {
+		if e.Purpose = c.byte("purpose id"); c.err == nil && (e.Purpose == 0 || e.Purpose > PurposeMetadata) {
+			return nil, Unsupported("unknown purpose id %d", e.Purpose)
+		}
+	}
+	if version >= Version4 {
+		if e.Pepper = c.byte("pepper id"); c.err == nil && e.Pepper == 0 && version == Version4 {
+			return nil, Malformed("pepper id 0 is reserved")
+		}
+	}
+	if version == Version5 {
+		e.WrappedKey = c.wrappedKey()
+	}
+	e.Params, e.Salt = c.keyParams(kdf)
+	if e.Compressed {
+		if e.Size = c.uint32("compressed size"); c.err == nil && e.Size > MaxCompressedSize {
+			return nil, Unsupported("compressed size %d is out of range", e.Size)
+		}
+	}
+	e.Nonce, e.Sealed = c.sealed()
+	if c.err != nil {
+		return nil, c.err
+	}
+	return e, nil
+}
+
+// ParseKeyParams reads params length | KDF params | salt length | salt, as
+// recorded in version 1 and later envelopes and the server's chunked
+// envelopes, and returns what follows
+func ParseKeyParams(kdf string, data []byte) (KDFParams, []byte, []byte, error) {
+	c := &cursor{data: data}
+	params, salt := c.keyParams(kdf)
+	rest := c.rest()
+	if c.err != nil {
+		return KDFParams{}, nil, nil, c.err
+	}
+	return params, salt, rest, nil
+}
+
+// keyParams reads the KDF params and salt as ParseKeyParams does
+func (c *cursor) keyParams(kdf string) (KDFParams, []byte) {
+	raw := c.take(int(c.byte("params length")), "KDF params")
+	if c.err != nil {
+		return KDFParams{}, nil
+	}
+	params, err := DecodeKDFParams(kdf, raw)
+	if err != nil {
+		c.fail(err)
+		return KDFParams{}, nil
+	}
+	saltSize := int(c.byte("salt length"))
+	if c.err == nil && (saltSize < MinSaltSize || saltSize > MaxSaltSize) {
+		c.fail(Malformed("salt length %d is out of range", saltSize))
+	}
+	return params, c.take(saltSize, "salt")
+}
+
+// AppendKeyParams appends params and salt as ParseKeyParams reads them
+func AppendKeyParams(out []byte, params KDFParams, salt []byte) []byte {
+	encoded := params.Encode()
+	out = append(out, byte(len(encoded)))
+	out = append(out, encoded...)
+	out = append(out, byte(len(salt)))
+	return append(out, salt...)
+}
+
+// ParseWrappedKey reads wrapped key length (uint16) | wrapped key, as
+// recorded in version 5 and the server's chunked envelopes, and returns what
+// follows
+func ParseWrappedKey(data []byte) ([]byte, []byte, error) {
+	c := &cursor{data: data}
+	wrapped := c.wrappedKey()
+	rest := c.rest()
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+	return wrapped, rest, nil
+}
+
+// wrappedKey reads a wrapped key as ParseWrappedKey does
+func (c *cursor) wrappedKey() []byte {
+	size := int(c.uint16("wrapped key length"))
+	if c.err == nil && (size == 0 || size > MaxWrappedKeySize) {
+		c.fail(Malformed("wrapped key length %d is out of range", size))
+	}
+	return c.take(size, "wrapped key")
+}
+
+// unmarshalHeaderless splits salt | nonce | ciphertext, as written before
+// envelopes recorded the salt length and KDF costs
+func unmarshalHeaderless(data []byte, cipherName, kdf string) (*Envelope, error) {
+	c := &cursor{data: data}
+	e := &Envelope{Version: VersionHeaderless, Cipher: cipherName, Params: LegacyKDFParams(kdf)}
+	e.Salt = c.take(LegacySaltSize, "salt")
+	e.Nonce, e.Sealed = c.sealed()
+	if c.err != nil {
+		return nil, c.err
+	}
+	return e, nil
+}
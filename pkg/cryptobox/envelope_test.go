@@ -0,0 +1,119 @@
+package cryptobox
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestEnvelopeMarshalRoundTrip(t *testing.T) {
+	base := Envelope{
+		Cipher: CipherChaCha20Poly1305,
+		Params: LegacyKDFParams(KDFScrypt),
+		Salt:   bytes.Repeat([]byte{1}, 24),
+		Nonce:  bytes.Repeat([]byte{2}, NonceSize),
+		Sealed: bytes.Repeat([]byte{3}, TagSize+5),
+	}
+	for _, tc := range []struct {
+		name    string
+		edit    func(e *Envelope)
+		version int
+	}{
+		{"unbound", func(e *Envelope) {}, Version1},
+		{"bound", func(e *Envelope) { e.Bound = true }, Version2},
+		{"purpose", func(e *Envelope) { e.Bound, e.Purpose = true, PurposeFile }, Version3},
+		{"pepper", func(e *Envelope) { e.Bound, e.Purpose, e.Pepper = true, PurposeMessage, 2 }, Version4},
+		{"wrapped key", func(e *Envelope) { e.Bound, e.Purpose, e.WrappedKey = true, PurposeMetadata, []byte("wrapped") }, Version5},
+		{"compressed", func(e *Envelope) { e.Compressed, e.Size = true, 1000 }, Version1},
+	} {
+		e := base
+		tc.edit(&e)
+		data := e.Marshal()
+		if data[len(magic)] != byte(tc.version) {
+			t.Fatalf("%s: marshaled version %d, want %d", tc.name, data[len(magic)], tc.version)
+		}
+		got, err := Unmarshal(data)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		e.Version = tc.version
+		if got.Version != e.Version || got.Cipher != e.Cipher || got.Params != e.Params || got.Bound != e.Bound ||
+			got.Purpose != e.Purpose || got.Pepper != e.Pepper || !bytes.Equal(got.WrappedKey, e.WrappedKey) ||
+			got.Compressed != e.Compressed || got.Size != e.Size ||
+			!bytes.Equal(got.Salt, e.Salt) || !bytes.Equal(got.Nonce, e.Nonce) || !bytes.Equal(got.Sealed, e.Sealed) {
+			t.Fatalf("%s: got %+v, want %+v", tc.name, got, e)
+		}
+	}
+}
+
+func TestUnmarshalLegacyLayouts(t *testing.T) {
+	salt, nonce, sealed := bytes.Repeat([]byte{7}, LegacySaltSize), make([]byte, NonceSize), make([]byte, TagSize)
+	body := append(append(append([]byte{}, salt...), nonce...), sealed...)
+
+	// version 0: the cipher id in the low bits, the KDF id less one above
+	v0 := append(append([]byte{}, v0Magic...), CipherID(CipherChaCha20Poly1305)|(KDFID(KDFScrypt)-1)<<4)
+	e, err := Unmarshal(append(v0, body...))
+	if err != nil || e.Version != Version0 || e.Cipher != CipherChaCha20Poly1305 || e.Params != LegacyKDFParams(KDFScrypt) {
+		t.Fatalf("version 0: got %+v, %v", e, err)
+	}
+
+	e, err = Unmarshal(body)
+	if err != nil || e.Version != VersionHeaderless || e.Cipher != CipherAESGCM || e.Params != LegacyKDFParams(KDFPBKDF2) ||
+		!bytes.Equal(e.Salt, salt) {
+		t.Fatalf("headerless: got %+v, %v", e, err)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	valid := (&Envelope{
+		Cipher: CipherAESGCM,
+		Params: LegacyKDFParams(KDFPBKDF2),
+		Salt:   make([]byte, 16),
+		Nonce:  make([]byte, NonceSize),
+		Sealed: make([]byte, TagSize),
+	}).Marshal()
+	header := len(magic)
+	with := func(i int, b byte) []byte {
+		data := append([]byte{}, valid...)
+		data[i] = b
+		return data
+	}
+
+	for _, tc := range []struct {
+		name        string
+		data        []byte
+		unsupported bool
+	}{
+		{"truncated header", valid[:header+2], false},
+		{"truncated ciphertext", valid[:len(valid)-1], false},
+		{"newer version", with(header, Version5+1), true},
+		{"unknown cipher", with(header+1, 9), true},
+		{"unknown KDF", with(header+2, 9), true},
+		{"wrong params length", with(header+3, 3), false},
+		{"short salt", with(header+8, 2), false},
+		{"unknown purpose", append(append([]byte{}, magic...), Version3, 1, 1, 0, 4, 0, 0, 0x27, 0x10, 16), true},
+		{"unknown version 0 algorithm", append(append([]byte{}, v0Magic...), 0x0f), true},
+		{"short headerless", make([]byte, LegacySaltSize+NonceSize), false},
+	} {
+		_, err := Unmarshal(tc.data)
+		var envErr *EnvelopeError
+		if !errors.As(err, &envErr) || !errors.Is(err, ErrDecryptionFailed) {
+			t.Fatalf("%s: expected an *EnvelopeError, got %v", tc.name, err)
+		}
+		if errors.Is(err, ErrUnsupportedEnvelope) != tc.unsupported || errors.Is(err, ErrCorruptCiphertext) == tc.unsupported {
+			t.Fatalf("%s: unsupported = %v, want %v (%v)", tc.name, !tc.unsupported, tc.unsupported, err)
+		}
+	}
+}
+
+func TestKDFParamsEncoding(t *testing.T) {
+	for _, p := range []KDFParams{{KDF: KDFPBKDF2, Iterations: 600000}, LegacyKDFParams(KDFScrypt)} {
+		got, err := DecodeKDFParams(p.KDF, p.Encode())
+		if err != nil || got != p {
+			t.Fatalf("got %+v, %v, want %+v", got, err, p)
+		}
+	}
+	if _, err := DecodeKDFParams(KDFScrypt, []byte{30, 255, 16}); !errors.Is(err, ErrUnsupportedEnvelope) {
+		t.Fatalf("excessive scrypt cost: expected ErrUnsupportedEnvelope, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package cryptobox
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// fuzzSeeds are envelopes of every version for the fuzzers to start from
+func fuzzSeeds(f *testing.F) {
+	base := Envelope{
+		Cipher: CipherAESGCM,
+		Params: KDFParams{KDF: KDFPBKDF2, Iterations: 1000},
+		Salt:   bytes.Repeat([]byte{1}, 16),
+		Nonce:  bytes.Repeat([]byte{2}, NonceSize),
+		Sealed: bytes.Repeat([]byte{3}, TagSize+4),
+	}
+	for _, edit := range []func(e *Envelope){
+		func(e *Envelope) {},
+		func(e *Envelope) { e.Bound = true },
+		func(e *Envelope) { e.Bound, e.Purpose = true, PurposeMessage },
+		func(e *Envelope) { e.Bound, e.Purpose, e.Pepper = true, PurposeFile, 1 },
+		func(e *Envelope) { e.Bound, e.Purpose, e.WrappedKey = true, PurposeMetadata, []byte{9, 9} },
+		func(e *Envelope) {
+			e.Cipher, e.Params = CipherChaCha20Poly1305, KDFParams{KDF: KDFScrypt, LogN: 4, R: 8, P: 1}
+		},
+		func(e *Envelope) { e.Compressed, e.Size = true, 64 },
+	} {
+		e := base
+		edit(&e)
+		f.Add(e.Marshal())
+	}
+	sealed, err := Seal([]byte("seed"), "phrase", &Options{Params: KDFParams{KDF: KDFPBKDF2, Iterations: 1000}})
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(sealed)
+	f.Add(append(append([]byte{}, v0Magic...), 0x11))
+	f.Add(make([]byte, LegacySaltSize+NonceSize+TagSize))
+	f.Add([]byte{})
+}
+
+// FuzzUnmarshal checks that Unmarshal never panics, fails only with an
+// *EnvelopeError, and that what it accepts in a current version marshals back
+// to the same bytes
+func FuzzUnmarshal(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		e, err := Unmarshal(data)
+		if err != nil {
+			var envErr *EnvelopeError
+			if !errors.As(err, &envErr) {
+				t.Fatalf("got %T %v, want an *EnvelopeError", err, err)
+			}
+			return
+		}
+		if len(e.Nonce) != NonceSize || len(e.Sealed) < TagSize {
+			t.Fatalf("accepted a %d-byte nonce and %d bytes of ciphertext", len(e.Nonce), len(e.Sealed))
+		}
+		if e.Version >= Version1 && !bytes.Equal(e.Marshal(), data) {
+			t.Fatalf("version %d envelope doesn't marshal back to its bytes", e.Version)
+		}
+	})
+}
+
+// FuzzOpen checks that Open never panics on any input and fails only with
+// errors matching ErrDecryptionFailed
+func FuzzOpen(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if e, err := Unmarshal(data); err == nil && expensive(e.Params) {
+			t.Skip("KDF costs too much to fuzz")
+		}
+		if _, err := Open(data, "phrase"); err != nil && !errors.Is(err, ErrDecryptionFailed) {
+			t.Fatalf("got %v, want an error matching ErrDecryptionFailed", err)
+		}
+	})
+}
+
+// expensive reports whether deriving a key with p takes long enough to slow
+// fuzzing to a crawl
+func expensive(p KDFParams) bool {
+	return p.Iterations > 2000 || p.LogN > 10
+}
@@ -0,0 +1,127 @@
+package cryptobox
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Key derivation functions envelopes can use
+const (
+	KDFPBKDF2 = "pbkdf2-sha256"
+	KDFScrypt = "scrypt"
+)
+
+// KDFs lists the supported key derivation functions, PBKDF2 first
+var KDFs = []string{KDFPBKDF2, KDFScrypt}
+
+// kdfIDs are the KDF id bytes of version 1 and later envelopes
+var kdfIDs = map[string]byte{
+	KDFPBKDF2: 1,
+	KDFScrypt: 2,
+}
+
+// KDFID returns the id byte envelopes record kdf by, or 0 for an unknown KDF
+func KDFID(kdf string) byte {
+	return kdfIDs[kdf]
+}
+
+// KDFName returns the KDF an envelope's id byte names, or "" for an unknown
+// id
+func KDFName(id byte) string {
+	return idName(kdfIDs, id)
+}
+
+// DefaultPBKDF2Iterations is the PBKDF2 cost of envelopes that don't record
+// one
+const DefaultPBKDF2Iterations = 10000
+
+// scrypt cost of envelopes that don't record one
+const (
+	scryptLogN = 15 // N=2^15: 32 MiB of memory per derivation with r=8
+	scryptR    = 8
+	scryptP    = 1
+)
+
+// LegacySaltSize is the salt length of envelopes that don't record one
+const LegacySaltSize = 16
+
+// Limits on the costs an envelope may ask for, so a crafted one can't tie up
+// the CPU or memory of whoever decrypts it
+const (
+	MaxPBKDF2Iterations = 10_000_000
+	maxScryptMemory     = 256 << 20
+	maxScryptP          = 16
+)
+
+// Salt lengths an envelope may record
+const (
+	MinSaltSize = 8
+	MaxSaltSize = 64
+)
+
+// KDFParams is a key derivation function with its cost parameters
+type KDFParams struct {
+	KDF        string
+	Iterations uint32 // PBKDF2
+	LogN, R, P uint8  // scrypt
+}
+
+// LegacyKDFParams returns the costs of kdf in envelopes that don't record
+// them: 10,000 PBKDF2 iterations, or scrypt with N=2^15, r=8 and p=1
+func LegacyKDFParams(kdf string) KDFParams {
+	if kdf == KDFScrypt {
+		return KDFParams{KDF: KDFScrypt, LogN: scryptLogN, R: scryptR, P: scryptP}
+	}
+	return KDFParams{KDF: KDFPBKDF2, Iterations: DefaultPBKDF2Iterations}
+}
+
+// Encode returns the params as envelopes record them
+func (p KDFParams) Encode() []byte {
+	if p.KDF == KDFScrypt {
+		return []byte{p.LogN, p.R, p.P}
+	}
+	return binary.BigEndian.AppendUint32(nil, p.Iterations)
+}
+
+// DecodeKDFParams reads params recorded for kdf, rejecting costs outside the
+// limits
+func DecodeKDFParams(kdf string, raw []byte) (KDFParams, error) {
+	p := KDFParams{KDF: kdf}
+	switch kdf {
+	case KDFPBKDF2:
+		if len(raw) != 4 {
+			return p, Malformed("PBKDF2 params are %d bytes, want 4", len(raw))
+		}
+		p.Iterations = binary.BigEndian.Uint32(raw)
+		if p.Iterations == 0 || p.Iterations > MaxPBKDF2Iterations {
+			return p, Unsupported("PBKDF2 iteration count %d is out of range", p.Iterations)
+		}
+	case KDFScrypt:
+		if len(raw) != 3 {
+			return p, Malformed("scrypt params are %d bytes, want 3", len(raw))
+		}
+		p.LogN, p.R, p.P = raw[0], raw[1], raw[2]
+		if p.LogN == 0 || p.LogN > 30 || p.R == 0 || p.P == 0 || p.P > maxScryptP ||
+			128*uint64(p.R)<<p.LogN > maxScryptMemory {
+			return p, Unsupported("scrypt cost N=2^%d r=%d p=%d is out of range", p.LogN, p.R, p.P)
+		}
+	}
+	return p, nil
+}
+
+// DeriveKey derives a KeySize key from a passphrase and salt. The params must
+// be valid, as those DecodeKDFParams returns are.
+func (p KDFParams) DeriveKey(passphrase string, salt []byte) []byte {
+	if p.KDF == KDFScrypt {
+		// only fails for invalid cost parameters
+		key, err := scrypt.Key([]byte(passphrase), salt, 1<<p.LogN, int(p.R), int(p.P), KeySize)
+		if err != nil {
+			panic(err)
+		}
+		return key
+	}
+	return pbkdf2.Key([]byte(passphrase), salt, int(p.Iterations), KeySize, sha256.New)
+}
@@ -0,0 +1,76 @@
+package cryptobox
+
+import "encoding/binary"
+
+// cursor reads an envelope front to back. Every read checks that the data
+// holds what it asks for; the first that doesn't records an *EnvelopeError
+// naming the field and offset, and later reads return zero values, so a
+// parser can read a whole header and check err once.
+type cursor struct {
+	data []byte
+	off  int
+	err  error
+}
+
+// take returns the next n bytes, which name
+func (c *cursor) take(n int, name string) []byte {
+	if c.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(c.data)-c.off {
+		c.err = Malformed("%s at byte %d is truncated", name, c.off)
+		return nil
+	}
+	b := c.data[c.off : c.off+n : c.off+n]
+	c.off += n
+	return b
+}
+
+// byte returns the next byte
+func (c *cursor) byte(name string) byte {
+	if b := c.take(1, name); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+// uint16 returns the next two bytes, big-endian
+func (c *cursor) uint16(name string) uint16 {
+	if b := c.take(2, name); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+// uint32 returns the next four bytes, big-endian
+func (c *cursor) uint32(name string) uint32 {
+	if b := c.take(4, name); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// rest returns what is left
+func (c *cursor) rest() []byte {
+	if c.err != nil {
+		return nil
+	}
+	return c.take(len(c.data)-c.off, "")
+}
+
+// fail records err unless an earlier read already failed
+func (c *cursor) fail(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// sealed reads the nonce and the ciphertext with its tag, which run to the
+// end of the data
+func (c *cursor) sealed() (nonce, sealed []byte) {
+	nonce = c.take(NonceSize, "nonce")
+	if c.err == nil && len(c.data)-c.off < TagSize {
+		c.err = Malformed("encrypted data is too short")
+	}
+	return nonce, c.rest()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// reencryptCheckpointFile is where the "reencrypt" command saves its position,
+// inside the data directory
+const reencryptCheckpointFile = "reencrypt_checkpoint.json"
+
+// newReencryptCommand builds the "reencrypt" admin command, which walks every
+// stored record in the background of a running server, throttled, bringing
+// what it can up to date without passphrases. An interrupted run (Ctrl-C,
+// SIGTERM, a crash) resumes where it stopped. It exits non-zero when any value
+// couldn't be moved.
+func newReencryptCommand(integrityService *services.IntegrityService) *cobra.Command {
+	var rate int
+	var restart, asJSON bool
+
+	command := &cobra.Command{
+		Use:          "reencrypt",
+		Short:        "Re-encrypts stored data under the current server keys, resumably and throttled",
+		SilenceUsage: true,
+		RunE: func(command *cobra.Command, args []string) error {
+			checkpoint := filepath.Join(integrityService.App.DataDir(), reencryptCheckpointFile)
+			if restart {
+				if err := os.Remove(checkpoint); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+			} else if _, err := os.Stat(checkpoint); err == nil {
+				fmt.Fprintln(os.Stderr, "Resuming the interrupted run")
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			run, err := integrityService.Reencrypt(ctx, services.ReencryptOptions{
+				RecordsPerSecond: rate,
+				CheckpointFile:   checkpoint,
+				Progress: func(p services.ReencryptProgress) {
+					fmt.Fprintf(os.Stderr, "%-20s %d/%d\n", p.Collection, p.Done, p.Total)
+				},
+			})
+			if errors.Is(err, context.Canceled) {
+				fmt.Fprintln(os.Stderr, "Interrupted; run the command again to resume")
+				os.Exit(1)
+			}
+			if err != nil {
+				return err
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(run); err != nil {
+					return err
+				}
+			} else {
+				printServerLayerRotation(&run.ServerLayerRotation)
+				if run.PendingNotes > 0 {
+					fmt.Printf("%d note(s) are keyed with older settings and move on their next read\n", run.PendingNotes)
+				}
+			}
+
+			if len(run.Failures) > 0 {
+				// PocketBase ignores command errors, so exit explicitly for scripts and cron
+				os.Exit(1)
+			}
+			return nil
+		},
+	}
+
+	command.Flags().IntVar(&rate, "rate", 50, "records handled per second at most, 0 for no limit")
+	command.Flags().BoolVar(&restart, "restart", false, "discard the checkpoint of an interrupted run and start over")
+	command.Flags().BoolVar(&asJSON, "json", false, "print the report as JSON")
+
+	return command
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// newRotateServerLayerCommand builds the "rotate-server-layer" admin command,
+// which moves every stored field and attachment to the current server layer
+// key. It exits non-zero when any value couldn't be moved, so it can be
+// retried until nothing uses the old keys.
+func newRotateServerLayerCommand(integrityService *services.IntegrityService) *cobra.Command {
+	var asJSON bool
+
+	command := &cobra.Command{
+		Use:          "rotate-server-layer",
+		Short:        "Reseals stored data in the current server layer key, without passphrases",
+		SilenceUsage: true,
+		RunE: func(command *cobra.Command, args []string) error {
+			rotation, err := integrityService.RotateServerLayer()
+			if err != nil {
+				return err
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(rotation); err != nil {
+					return err
+				}
+			} else {
+				printServerLayerRotation(rotation)
+			}
+
+			if len(rotation.Failures) > 0 {
+				// PocketBase ignores command errors, so exit explicitly for scripts and cron
+				os.Exit(1)
+			}
+			return nil
+		},
+	}
+
+	command.Flags().BoolVar(&asJSON, "json", false, "print the report as JSON")
+
+	return command
+}
+
+// printServerLayerRotation writes a human-readable rotation report to stdout
+func printServerLayerRotation(rotation *services.ServerLayerRotation) {
+	collections := make([]string, 0, len(rotation.Checked))
+	for collection := range rotation.Checked {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+	for _, collection := range collections {
+		fmt.Printf("%-20s %d checked, %d resealed\n", collection, rotation.Checked[collection], rotation.Rewrapped[collection])
+	}
+	for _, failure := range rotation.Failures {
+		fmt.Printf("%-20s %-15s %s: %s\n", failure.Collection, failure.RecordID, failure.Field, failure.Error)
+	}
+	if len(rotation.Failures) > 0 {
+		fmt.Fprintf(os.Stderr, "%d value(s) could not be resealed\n", len(rotation.Failures))
+	}
+}
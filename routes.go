@@ -0,0 +1,542 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+
+	"github.com/ktappdev/secretnotes-go-backend/apierror"
+	"github.com/ktappdev/secretnotes-go-backend/config"
+	"github.com/ktappdev/secretnotes-go-backend/middleware"
+	"github.com/ktappdev/secretnotes-go-backend/services"
+)
+
+// server bundles the settings and services the API routes need. The same
+// routes are mounted once per API version (see registerRoutes); limiters are
+// shared so v1 and v2 traffic counts against the same buckets.
+type server struct {
+	cfg  *config.Config
+	spec []byte
+	auth middleware.Authenticator // nil unless SECRETNOTES_AUTH_MODE is set
+
+	features map[string]bool // optional features by name, as in the OpenAPI document
+
+	noteService    *services.NoteService
+	fileService    *services.FileService
+	pasteService   *services.PasteService
+	blobService    *services.BlobService
+	digestService  *services.DigestService  // nil unless notifications are configured
+	webhookService *services.WebhookService // nil unless notifications are configured
+	lockService    *services.LockService
+	abuseService   *services.AbuseService
+	accessLog      *services.AccessLogService
+	statsService   *services.StatsService  // nil unless public stats are enabled
+	scanner        services.Scanner        // nil unless SECRETNOTES_CLAMD_ADDRESS is set
+	signer         *services.ArchiveSigner // nil unless SECRETNOTES_SIGNING_KEY_FILE is set
+	archiveTrust   services.ArchiveTrust
+
+	ipLimiter     *middleware.Limiter
+	phraseLimiter *middleware.Limiter
+	pasteLimiter  *middleware.Limiter
+
+	idempotency *middleware.IdempotencyStore
+	sessions    *middleware.SessionStore // nil unless sessions are enabled
+}
+
+// scopeKeys opens a key scope for the request's passphrase (see
+// services.Service.Scope), so the services it calls share key derivations
+func scopeKeys(encryption *services.Service) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		if phrase := middleware.Phrase(e); phrase != "" {
+			defer encryption.Scope(phrase)()
+		}
+		return e.Next()
+	}
+}
+
+// registerRoutes binds the middleware chain and all routes to the api group
+func (s *server) registerRoutes(api *router.RouterGroup[*core.RequestEvent]) {
+	cfg := s.cfg
+
+	// Middleware chain, in order: request log, response compression, body size
+	// caps, authentication, passphrase extraction, key scope, rate limits, abuse
+	// bans, legacy passphrase migration, idempotency replay. Routes under
+	// /notes additionally require a valid passphrase (see notes group below).
+	if cfg.LogRequests {
+		api.Bind(middleware.RequestLogger())
+	}
+
+	// Compress responses of the configured route classes (see middleware.RouteClass)
+	if cfg.Compress.Enabled {
+		api.BindFunc(middleware.Compress(cfg.Compress.Classes, cfg.Compress.MinBytes))
+	}
+
+	// Cap request bodies (replaces PocketBase's default 32 MB limit)
+	api.Bind(middleware.SizeLimits(cfg.Limits.MaxNoteBytes, cfg.Limits.MaxUploadBytes, cfg.Idempotency.Enabled))
+
+	// Private deployments: require credentials before any passphrase is looked at
+	if s.auth != nil {
+		api.BindFunc(middleware.RequireAuth(s.auth))
+	}
+
+	// Pick up the passphrase from X-Passphrase, an access token or the JSON body once, for everything below
+	api.BindFunc(middleware.ExtractPhrase(s.sessions))
+
+	// Derive each of the passphrase's keys at most once per request
+	api.BindFunc(scopeKeys(s.noteService.Encryption))
+
+	// Throttle brute-force attempts per client IP and per passphrase
+	if cfg.RateLimit.Enabled {
+		api.BindFunc(
+			middleware.RateLimitByIP(s.ipLimiter),
+			middleware.RateLimitByPhrase(s.phraseLimiter),
+		)
+	}
+
+	// Progressive bans for clients that look like they are guessing passphrases
+	if cfg.Abuse.Enabled {
+		api.BindFunc(middleware.AbuseProtection(s.abuseService))
+	}
+
+	// Move records stored under a passphrase hash from before the current pepper
+	api.BindFunc(migrateLegacyPhraseHash(s.noteService))
+
+	// Move notes stored under a passphrase before it was normalized
+	api.BindFunc(migrateLegacyPhrase(s.noteService, s.fileService))
+
+	// Replay responses to retried POST/PUT/PATCH requests with an Idempotency-Key
+	if cfg.Idempotency.Enabled {
+		api.BindFunc(middleware.Idempotency(s.idempotency))
+	}
+
+	// Health check endpoint
+	api.GET("/", func(e *core.RequestEvent) error {
+		return e.JSON(http.StatusOK, map[string]string{
+			"message": cfg.Branding.HealthMessage,
+			"version": "1.0.0",
+		})
+	}).BindFunc(middleware.RouteClass(middleware.ClassPublic))
+
+	// Deployment branding: about text for CLIs and share-page styling
+	api.GET("/about", func(e *core.RequestEvent) error {
+		return handleAbout(e, cfg.Branding)
+	}).BindFunc(middleware.RouteClass(middleware.ClassPublic))
+
+	// Enabled features, limits and the cipher used for new data
+	api.GET("/capabilities", func(e *core.RequestEvent) error {
+		return handleCapabilities(e, cfg.Limits, s.features, s.fileService.Encryption, s.signer)
+	}).BindFunc(middleware.RouteClass(middleware.ClassPublic))
+
+	// Server clock, for client-side clock skew detection
+	api.GET("/time", handleTime).BindFunc(middleware.RouteClass(middleware.ClassPublic))
+
+	// Coarse, noise-added usage figures for public instances (SECRETNOTES_STATS_ENABLED)
+	if s.statsService != nil {
+		api.GET("/stats", func(e *core.RequestEvent) error {
+			return handleStats(e, s.statsService)
+		}).BindFunc(middleware.RouteClass(middleware.ClassPublic))
+	}
+
+	// zxcvbn-style strength estimate for a candidate passphrase; the response
+	// depends on the submitted phrase, so it is never compressed
+	api.POST("/phrase/strength", func(e *core.RequestEvent) error {
+		return handlePhraseStrength(e, cfg.Limits, cfg.Branding)
+	}).BindFunc(middleware.RouteClass(middleware.ClassSecret))
+
+	// Random passphrase of BIP39 words; the response is a secret, so it is
+	// never compressed or cached
+	api.GET("/phrase/generate", func(e *core.RequestEvent) error {
+		return handleGeneratePhrase(e)
+	}).BindFunc(middleware.RouteClass(middleware.ClassSecret))
+
+	// Access tokens standing in for the passphrase (SECRETNOTES_SESSIONS_ENABLED):
+	// opened with the passphrase once, renewed by HMAC challenge-response
+	if s.sessions != nil {
+		api.POST("/auth/token", func(e *core.RequestEvent) error {
+			return handleOpenSession(e, middleware.Phrase(e), s.sessions)
+		}).BindFunc(middleware.RequirePhrase(), middleware.RouteClass(middleware.ClassSecret))
+		api.POST("/auth/challenge", func(e *core.RequestEvent) error {
+			return handleSessionChallenge(e, s.sessions)
+		}).BindFunc(middleware.RouteClass(middleware.ClassSecret))
+		api.POST("/auth/token/renew", func(e *core.RequestEvent) error {
+			return handleRenewSession(e, s.sessions)
+		}).BindFunc(middleware.RouteClass(middleware.ClassSecret))
+		api.DELETE("/auth/token", func(e *core.RequestEvent) error {
+			return handleCloseSession(e, s.sessions)
+		}).BindFunc(middleware.RouteClass(middleware.ClassSecret))
+	}
+
+	// OpenAPI 3 specification (openapi.json)
+	api.GET("/openapi.json", func(e *core.RequestEvent) error {
+		return handleOpenAPI(e, s.spec)
+	}).BindFunc(middleware.RouteClass(middleware.ClassPublic))
+
+	// Encrypted archive of the note and its attachments, for backups and moving servers
+	api.GET("/export", func(e *core.RequestEvent) error {
+		return handleExport(e, middleware.Phrase(e), s.signer, s.noteService, s.fileService)
+	}).BindFunc(middleware.RequirePhrase(), refuseDeleted(cfg.Deletion.Grace, s.noteService), logNoteAccess(s.accessLog), middleware.RouteClass(middleware.ClassSecret))
+
+	// Restore an export archive under the passphrase it was encrypted with
+	api.POST("/import", func(e *core.RequestEvent) error {
+		return handleImport(e, middleware.Phrase(e), cfg.Limits, cfg.Resources.MultipartMemory, s.scanUpload, s.archiveTrust, s.noteService, s.fileService)
+	}).BindFunc(middleware.RequirePhrase(), refuseDeleted(cfg.Deletion.Grace, s.noteService), refuseReadOnly(s.noteService), logNoteAccess(s.accessLog), middleware.RouteClass(middleware.ClassSecret))
+
+	// Restore a deleted note from the trash. Registered outside the notes group,
+	// which answers 410 for deleted notes.
+	api.POST("/notes/undelete", func(e *core.RequestEvent) error {
+		return handleUndeleteNote(e, middleware.Phrase(e), cfg.Deletion.Grace, s.noteService)
+	}).BindFunc(middleware.RequirePhrase(), middleware.RouteClass(middleware.ClassSecret))
+
+	// Ciphertext stored under the passphrase, for storage meters. Registered
+	// outside the notes group so a note in the trash, which still takes up
+	// space, is counted rather than refused.
+	api.GET("/usage", func(e *core.RequestEvent) error {
+		return handleGetStorageUsage(e, middleware.Phrase(e), s.noteService)
+	}).BindFunc(middleware.RequirePhrase(), middleware.RouteClass(middleware.ClassMetadata))
+
+	// Rebuild a passphrase from the shares of a recovery kit (POST /notes/recovery-kit)
+	api.POST("/recover", func(e *core.RequestEvent) error {
+		return handleRecover(e, s.noteService)
+	}).BindFunc(middleware.RouteClass(middleware.ClassSecret))
+
+	// Note routes; all of them need a valid passphrase (header or JSON body)
+	// and a note that isn't in the trash, and successful requests are added
+	// to the note's encrypted access log. Their responses carry decrypted
+	// content unless tagged otherwise.
+	notes := api.Group("/notes")
+	notes.BindFunc(middleware.RequirePhrase(), refuseDeleted(cfg.Deletion.Grace, s.noteService), logNoteAccess(s.accessLog), middleware.RouteClass(middleware.ClassSecret))
+	if s.webhookService != nil {
+		notes.BindFunc(notifyWebhooks(s.webhookService))
+	}
+
+	// Get note using passphrase from header/body
+	notes.GET("", func(e *core.RequestEvent) error {
+		return handleGetOrCreateNote(e, middleware.Phrase(e), s.noteService)
+	})
+
+	// Probe the note without creating it or transferring its content
+	notes.HEAD("", func(e *core.RequestEvent) error {
+		return handleHeadNote(e, middleware.Phrase(e), s.noteService)
+	}).BindFunc(middleware.RouteClass(middleware.ClassMetadata))
+
+	// Create note (same behavior as GET) using passphrase from header/body
+	notes.POST("", func(e *core.RequestEvent) error {
+		return handleGetOrCreateNote(e, middleware.Phrase(e), s.noteService)
+	})
+
+	// Update note using passphrase from header/body
+	notes.PATCH("", func(e *core.RequestEvent) error {
+		data := struct {
+			Message string `json:"message"`
+			services.NoteMetadata
+		}{}
+		if err := e.BindBody(&data); err != nil {
+			if middleware.IsBodyTooLarge(err) {
+				return middleware.PayloadTooLarge(e, "note", cfg.Limits.MaxNoteBytes, -1)
+			}
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Invalid request body", nil)
+		}
+		if err := s.noteService.CheckNoteQuota(e.App, middleware.Phrase(e), int64(len(data.Message))); err != nil {
+			return quotaError(e, err)
+		}
+		meta, err := services.NormalizeMetadata(data.NoteMetadata)
+		if err != nil {
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, err.Error(), nil)
+		}
+		// Directly call the lower-level noteService method instead of handler expecting body
+		note, svcErr := s.noteService.UpdateNote(middleware.Phrase(e), data.Message, meta)
+		if svcErr != nil {
+			return apierror.Respond(e, http.StatusNotFound, apierror.FromError(svcErr, apierror.Internal), svcErr.Error(), nil)
+		}
+		usage, err := s.noteService.Usage(middleware.Phrase(e), note.Message)
+		if err != nil {
+			return apierror.Respond(e, http.StatusInternalServerError, apierror.Internal, err.Error(), nil)
+		}
+		return e.JSON(http.StatusOK, map[string]any{
+			"id":           note.ID,
+			"message":      note.Message,
+			"title":        note.Title,
+			"tags":         note.Tags,
+			"hasImage":     note.ImageHash != "",
+			"created":      note.Created,
+			"updated":      note.Updated,
+			"destroyAt":    note.DestroyAt,
+			"accessCount":  note.AccessCount,
+			"lastAccessed": note.LastAccessed,
+			"readOnly":     note.ReadOnly,
+			"usage":        usage,
+		})
+	}).BindFunc(refuseReadOnly(s.noteService))
+
+	// Upsert note using passphrase from header/body
+	notes.PUT("", func(e *core.RequestEvent) error {
+		data := struct {
+			Message string `json:"message"`
+			services.NoteMetadata
+		}{}
+		if err := e.BindBody(&data); err != nil {
+			if middleware.IsBodyTooLarge(err) {
+				return middleware.PayloadTooLarge(e, "note", cfg.Limits.MaxNoteBytes, -1)
+			}
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Invalid request body", nil)
+		}
+		if err := s.noteService.CheckNoteQuota(e.App, middleware.Phrase(e), int64(len(data.Message))); err != nil {
+			return quotaError(e, err)
+		}
+		meta, err := services.NormalizeMetadata(data.NoteMetadata)
+		if err != nil {
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, err.Error(), nil)
+		}
+		// Reuse existing upsert logic with modified signature
+		return handleUpsertNoteWithMessage(e, middleware.Phrase(e), data.Message, meta, s.noteService)
+	}).BindFunc(refuseReadOnly(s.noteService))
+
+	// Move the note to the trash; POST /notes/undelete restores it within the grace period
+	notes.DELETE("", func(e *core.RequestEvent) error {
+		return handleDeleteNote(e, middleware.Phrase(e), cfg.Deletion.Grace, s.noteService)
+	}).BindFunc(middleware.RouteClass(middleware.ClassMetadata))
+
+	// Re-encrypt note and attachments under a new passphrase
+	notes.POST("/rekey", func(e *core.RequestEvent) error {
+		data := struct {
+			NewPassphrase string `json:"newPassphrase"`
+		}{}
+		if err := e.BindBody(&data); err != nil {
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Invalid request body", nil)
+		}
+		data.NewPassphrase = middleware.NormalizePhrase(data.NewPassphrase)
+		if middleware.ValidatePhrase(data.NewPassphrase) != nil {
+			msg := fmt.Sprintf("New passphrase must be at least %d characters long", middleware.MinPhraseLength)
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadPassphrase, msg, nil)
+		}
+		return handleRekeyNote(e, middleware.Phrase(e), data.NewPassphrase, s.noteService, s.fileService)
+	})
+
+	// Split the passphrase into k-of-n shares for recovery; nothing is stored
+	notes.POST("/recovery-kit", func(e *core.RequestEvent) error {
+		return handleRecoveryKit(e, middleware.Phrase(e), s.noteService)
+	})
+
+	// Merge another note (by its passphrase) into this one and delete it
+	notes.POST("/merge", func(e *core.RequestEvent) error {
+		data := struct {
+			SourcePassphrase string `json:"sourcePassphrase"`
+		}{}
+		if err := e.BindBody(&data); err != nil {
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Invalid request body", nil)
+		}
+		data.SourcePassphrase = middleware.NormalizePhrase(data.SourcePassphrase)
+		if middleware.ValidatePhrase(data.SourcePassphrase) != nil {
+			msg := fmt.Sprintf("Source passphrase must be at least %d characters long", middleware.MinPhraseLength)
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadPassphrase, msg, nil)
+		}
+		return handleMergeNote(e, data.SourcePassphrase, middleware.Phrase(e), s.noteService, s.fileService)
+	}).BindFunc(refuseReadOnly(s.noteService))
+
+	// Advisory editing lock, renewed by client heartbeat
+	notes.POST("/lock", func(e *core.RequestEvent) error {
+		data := struct {
+			SessionID string `json:"sessionId"`
+		}{}
+		if err := e.BindBody(&data); err != nil {
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Invalid request body", nil)
+		}
+		return handleAcquireLock(e, middleware.Phrase(e), data.SessionID, s.lockService)
+	}).BindFunc(middleware.RouteClass(middleware.ClassMetadata))
+	notes.GET("/lock", func(e *core.RequestEvent) error {
+		return handleGetLock(e, middleware.Phrase(e), s.lockService)
+	}).BindFunc(middleware.RouteClass(middleware.ClassMetadata))
+	notes.DELETE("/lock", func(e *core.RequestEvent) error {
+		data := struct {
+			SessionID string `json:"sessionId"`
+		}{}
+		_ = e.BindBody(&data)
+		return handleReleaseLock(e, middleware.Phrase(e), data.SessionID, s.lockService)
+	}).BindFunc(middleware.RouteClass(middleware.ClassMetadata))
+
+	// Read-only flag: while set, edits, uploads, merges and imports get 423
+	notes.PUT("/read-only", func(e *core.RequestEvent) error {
+		return handleSetReadOnly(e, middleware.Phrase(e), true, s.noteService)
+	}).BindFunc(middleware.RouteClass(middleware.ClassMetadata))
+	notes.DELETE("/read-only", func(e *core.RequestEvent) error {
+		return handleSetReadOnly(e, middleware.Phrase(e), false, s.noteService)
+	}).BindFunc(middleware.RouteClass(middleware.ClassMetadata))
+
+	// Schedule the note's deletion at destroyAt, or destroyIn seconds from now
+	notes.PUT("/destroy", func(e *core.RequestEvent) error {
+		data := struct {
+			DestroyAt *time.Time `json:"destroyAt"`
+			DestroyIn int        `json:"destroyIn"`
+		}{}
+		if err := e.BindBody(&data); err != nil {
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Invalid request body", nil)
+		}
+		var at time.Time
+		switch {
+		case data.DestroyAt != nil && data.DestroyIn != 0:
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Use either destroyAt or destroyIn, not both", nil)
+		case data.DestroyAt != nil:
+			at = *data.DestroyAt
+		case data.DestroyIn > 0:
+			at = time.Now().Add(time.Duration(data.DestroyIn) * time.Second)
+		default:
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "destroyAt or a positive destroyIn is required", nil)
+		}
+		return handleScheduleDestruction(e, middleware.Phrase(e), at, s.noteService)
+	}).BindFunc(middleware.RouteClass(middleware.ClassMetadata))
+
+	// Cancel a scheduled deletion
+	notes.DELETE("/destroy", func(e *core.RequestEvent) error {
+		return handleScheduleDestruction(e, middleware.Phrase(e), time.Time{}, s.noteService)
+	}).BindFunc(middleware.RouteClass(middleware.ClassMetadata))
+
+	// Decrypted note as Markdown, plain text or JSON (?format=md|txt|json)
+	notes.GET("/export", func(e *core.RequestEvent) error {
+		return handleExportNote(e, middleware.Phrase(e), e.Request.URL.Query().Get("format"), s.noteService)
+	})
+
+	// The decrypted message alone as text/plain, for curl in shell pipelines
+	notes.GET("/raw", func(e *core.RequestEvent) error {
+		return handleGetRawNote(e, middleware.Phrase(e), s.noteService)
+	})
+
+	// Search the decrypted note server-side, returning matching lines (?q=)
+	notes.GET("/search", func(e *core.RequestEvent) error {
+		return handleSearchNote(e, middleware.Phrase(e), e.Request.URL.Query().Get("q"), s.noteService)
+	})
+
+	// Upload image for note using passphrase from header
+	notes.POST("/image", func(e *core.RequestEvent) error {
+		return handleUploadImage(e, middleware.Phrase(e), cfg.Limits, cfg.Resources.MultipartMemory, s.scanUpload, s.noteService, s.fileService)
+	}).BindFunc(refuseReadOnly(s.noteService), middleware.RouteClass(middleware.ClassMetadata))
+
+	// Get image for note using passphrase from header (?disposition=inline to view it in a browser)
+	notes.GET("/image", func(e *core.RequestEvent) error {
+		return handleGetImage(e, middleware.Phrase(e), e.Request.URL.Query().Get("disposition"), s.fileService)
+	})
+
+	// Quota usage of the passphrase, for warnings before an upload is refused
+	notes.GET("/usage", func(e *core.RequestEvent) error {
+		return handleGetUsage(e, middleware.Phrase(e), s.noteService)
+	}).BindFunc(middleware.RouteClass(middleware.ClassMetadata))
+
+	// List the note's attachments without their content
+	notes.GET("/attachments", func(e *core.RequestEvent) error {
+		return handleListAttachments(e, middleware.Phrase(e), s.fileService)
+	})
+
+	// The note's own attachment retention rule: attachments older than maxAge
+	// seconds, or beyond the newest keep, are purged by a cron job
+	notes.PUT("/attachments/retention", func(e *core.RequestEvent) error {
+		var data services.Retention
+		if err := e.BindBody(&data); err != nil {
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Invalid request body", nil)
+		}
+		if data.IsZero() {
+			return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "A positive maxAge or keep is required; DELETE clears the rule", nil)
+		}
+		return handleSetAttachmentRetention(e, middleware.Phrase(e), data, s.noteService, s.fileService)
+	}).BindFunc(refuseReadOnly(s.noteService), middleware.RouteClass(middleware.ClassMetadata))
+
+	// Clear the note's own retention rule; the server-wide one still applies
+	notes.DELETE("/attachments/retention", func(e *core.RequestEvent) error {
+		return handleSetAttachmentRetention(e, middleware.Phrase(e), services.Retention{}, s.noteService, s.fileService)
+	}).BindFunc(refuseReadOnly(s.noteService), middleware.RouteClass(middleware.ClassMetadata))
+
+	// Delete one attachment by id
+	notes.DELETE("/attachments/{id}", func(e *core.RequestEvent) error {
+		return handleDeleteAttachment(e, middleware.Phrase(e), e.Request.PathValue("id"), s.noteService, s.fileService)
+	}).BindFunc(refuseReadOnly(s.noteService))
+
+	// Rename one attachment by id
+	notes.PATCH("/attachments/{id}", func(e *core.RequestEvent) error {
+		return handleRenameAttachment(e, middleware.Phrase(e), e.Request.PathValue("id"), s.fileService)
+	}).BindFunc(refuseReadOnly(s.noteService))
+
+	// Get the image's thumbnail, for previews without the full-size download
+	notes.GET("/image/thumbnail", func(e *core.RequestEvent) error {
+		return handleGetThumbnail(e, middleware.Phrase(e), s.fileService)
+	})
+
+	// Probe the image's size and version without decrypting it
+	notes.HEAD("/image", func(e *core.RequestEvent) error {
+		return handleHeadImage(e, middleware.Phrase(e), s.fileService)
+	}).BindFunc(middleware.RouteClass(middleware.ClassMetadata))
+
+	// Delete image for note using passphrase from header
+	notes.DELETE("/image", func(e *core.RequestEvent) error {
+		return handleDeleteImage(e, middleware.Phrase(e), s.noteService, s.fileService)
+	}).BindFunc(refuseReadOnly(s.noteService))
+
+	// The note's access log, decrypted with its passphrase (?limit=)
+	notes.GET("/access-log", func(e *core.RequestEvent) error {
+		return handleGetAccessLog(e, middleware.Phrase(e), e.Request.URL.Query().Get("limit"), s.accessLog)
+	})
+
+	// Digest email subscription for the note (only when notifications are configured)
+	if s.digestService != nil {
+		notes.PUT("/subscription", func(e *core.RequestEvent) error {
+			data := struct {
+				Email string `json:"email"`
+				Mode  string `json:"mode"`
+			}{}
+			if err := e.BindBody(&data); err != nil {
+				return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Invalid request body", nil)
+			}
+			return handleSubscribeDigest(e, middleware.Phrase(e), data.Email, data.Mode, s.digestService)
+		})
+		notes.GET("/subscription", func(e *core.RequestEvent) error {
+			return handleGetDigest(e, middleware.Phrase(e), s.digestService)
+		})
+		notes.DELETE("/subscription", func(e *core.RequestEvent) error {
+			return handleUnsubscribeDigest(e, middleware.Phrase(e), s.digestService)
+		})
+	}
+
+	// Outgoing webhook for the note (only when notifications are configured)
+	if s.webhookService != nil {
+		notes.PUT("/webhook", func(e *core.RequestEvent) error {
+			data := struct {
+				URL      string `json:"url"`
+				ClientID string `json:"clientId"`
+			}{}
+			if err := e.BindBody(&data); err != nil {
+				return apierror.Respond(e, http.StatusBadRequest, apierror.BadRequest, "Invalid request body", nil)
+			}
+			return handleRegisterWebhook(e, middleware.Phrase(e), data.URL, data.ClientID, s.webhookService)
+		})
+		notes.GET("/webhook", func(e *core.RequestEvent) error {
+			return handleGetWebhook(e, middleware.Phrase(e), s.webhookService)
+		})
+		notes.DELETE("/webhook", func(e *core.RequestEvent) error {
+			return handleUnregisterWebhook(e, middleware.Phrase(e), s.webhookService)
+		})
+	}
+
+	// Optional opaque blob mode (SECRETNOTES_BLOBS_ENABLED): ciphertext encrypted
+	// by the client, addressed by a client-derived key in X-Blob-Key
+	if cfg.Blobs.Enabled {
+		api.POST("/blobs", func(e *core.RequestEvent) error {
+			return handlePutBlob(e, cfg.Limits.MaxNoteBytes, s.blobService)
+		}).BindFunc(middleware.RouteClass(middleware.ClassSecret))
+		api.GET("/blobs", func(e *core.RequestEvent) error {
+			return handleGetBlob(e, s.blobService)
+		}).BindFunc(middleware.RouteClass(middleware.ClassSecret))
+		api.DELETE("/blobs", func(e *core.RequestEvent) error {
+			return handleDeleteBlob(e, s.blobService)
+		}).BindFunc(middleware.RouteClass(middleware.ClassSecret))
+	}
+
+	// Optional public paste mode (SECRETNOTES_PASTE_ENABLED), rate limited per client IP
+	if cfg.Paste.Enabled {
+		api.POST("/paste", func(e *core.RequestEvent) error {
+			return handleCreatePaste(e, cfg.Paste, s.pasteService)
+		}).BindFunc(middleware.RateLimitByIP(s.pasteLimiter), middleware.RouteClass(middleware.ClassPublic))
+		api.GET("/paste/{id}", func(e *core.RequestEvent) error {
+			return handleGetPaste(e, s.pasteService)
+		}).BindFunc(middleware.RateLimitByIP(s.pasteLimiter), middleware.RouteClass(middleware.ClassPublic))
+	}
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/config"
+)
+
+// strikeDecay is how long a client must stay out of trouble after a ban
+// before its strike count resets
+const strikeDecay = 24 * time.Hour
+
+// AbuseService tracks clients that look like they are guessing passphrases and
+// bans them for exponentially increasing periods. Like the rate limiters it
+// keeps its per-window counters in memory, so it costs no database access per
+// request. Strikes and bans are also written to the abuse_tracking collection
+// as they are issued and read back by Load, so a restart doesn't lift them.
+type AbuseService struct {
+	App    *pocketbase.PocketBase // nil keeps everything in memory
+	Config config.AbuseConfig
+
+	mu        sync.Mutex
+	clients   map[string]*abuseClient
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// abuseClient is what AbuseService knows about one client
+type abuseClient struct {
+	windowStart time.Time
+	misses      map[string]bool // truncated hashes of passphrases that found nothing
+	failures    int
+	strikes     int
+	bannedUntil time.Time
+	lastSeen    time.Time
+}
+
+// NewAbuseService creates a new abuse tracking service
+func NewAbuseService(app *pocketbase.PocketBase, cfg config.AbuseConfig) *AbuseService {
+	return &AbuseService{
+		App:     app,
+		Config:  cfg,
+		clients: make(map[string]*abuseClient),
+		now:     time.Now,
+	}
+}
+
+// ClientKey derives the client identifier from an IP so raw addresses aren't kept
+func (a *AbuseService) ClientKey(ip string) string {
+	hash := sha256.Sum256([]byte("abuse:" + ip))
+	return hex.EncodeToString(hash[:])
+}
+
+// BannedUntil returns when the client's current ban ends (zero if not banned)
+func (a *AbuseService) BannedUntil(clientKey string) time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if c, ok := a.clients[clientKey]; ok && c.bannedUntil.After(a.now()) {
+		return c.bannedUntil
+	}
+	return time.Time{}
+}
+
+// RecordMiss records a lookup of phraseHash by the client that found no note
+// or attachment. Too many distinct misses within the window earn a strike;
+// looking up the same passphrase again doesn't add to them.
+func (a *AbuseService) RecordMiss(clientKey, phraseHash string) {
+	a.update(clientKey, func(c *abuseClient) {
+		// Only a prefix is kept: enough to count distinct guesses, not enough
+		// to link a client to a specific note.
+		c.misses[phraseHash[:8]] = true
+	})
+}
+
+// RecordFailure records a wrong passphrase for data that has one, such as an
+// import archive
+func (a *AbuseService) RecordFailure(clientKey string) {
+	a.update(clientKey, func(c *abuseClient) {
+		c.failures++
+	})
+}
+
+// update applies fn to the client and, when that earns a strike, saves the
+// ban so a restart keeps it
+func (a *AbuseService) update(clientKey string, fn func(c *abuseClient)) {
+	strikes, until, ban := a.apply(clientKey, fn)
+	if ban == 0 {
+		return
+	}
+	log.Printf("Banned client %s… for %s (strike %d)", clientKey[:8], ban, strikes)
+	if err := a.saveStrike(clientKey, strikes, until); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// apply rolls the client's window, applies fn and bans the client if a
+// threshold is crossed, returning its strikes, ban end and the ban's length
+// (zero when there was no new ban)
+func (a *AbuseService) apply(clientKey string, fn func(c *abuseClient)) (int, time.Time, time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	a.sweep(now)
+
+	c, ok := a.clients[clientKey]
+	if !ok {
+		c = &abuseClient{windowStart: now, misses: map[string]bool{}}
+		a.clients[clientKey] = c
+	}
+	c.lastSeen = now
+
+	if now.Sub(c.windowStart) > a.Config.Window {
+		c.windowStart = now
+		c.misses = map[string]bool{}
+		c.failures = 0
+	}
+	if c.strikes > 0 && now.Sub(c.bannedUntil) > strikeDecay {
+		c.strikes = 0
+	}
+
+	fn(c)
+
+	if len(c.misses) <= a.Config.MaxMisses && c.failures <= a.Config.MaxFailures {
+		return c.strikes, c.bannedUntil, 0
+	}
+	c.strikes++
+	ban := BanDuration(a.Config.BaseBan, a.Config.MaxBan, c.strikes)
+	c.bannedUntil = now.Add(ban)
+	c.windowStart = now
+	c.misses = map[string]bool{}
+	c.failures = 0
+	return c.strikes, c.bannedUntil, ban
+}
+
+// saveStrike writes the client's strikes and ban to abuse_tracking
+func (a *AbuseService) saveStrike(clientKey string, strikes int, bannedUntil time.Time) error {
+	if a.App == nil {
+		return nil
+	}
+	record, err := a.App.FindFirstRecordByData("abuse_tracking", "client_hash", clientKey)
+	if err != nil {
+		collection, err := a.App.FindCachedCollectionByNameOrId("abuse_tracking")
+		if err != nil {
+			return fmt.Errorf("failed to find abuse_tracking collection: %w", err)
+		}
+		record = core.NewRecord(collection)
+		record.Set("client_hash", clientKey)
+	}
+	record.Set("strikes", strikes)
+	record.Set("banned_until", bannedUntil.UTC())
+	if err := a.App.Save(record); err != nil {
+		return fmt.Errorf("failed to save abuse ban: %w", err)
+	}
+	return nil
+}
+
+// Load reads back the strikes and bans saved before a restart. Clients whose
+// strikes have decayed are dropped from abuse_tracking rather than loaded.
+func (a *AbuseService) Load() error {
+	if a.App == nil {
+		return nil
+	}
+	if _, err := a.PurgeStale(); err != nil {
+		return err
+	}
+	records, err := a.App.FindAllRecords("abuse_tracking")
+	if err != nil {
+		return fmt.Errorf("failed to query abuse bans: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	for _, record := range records {
+		a.clients[record.GetString("client_hash")] = &abuseClient{
+			windowStart: now,
+			misses:      map[string]bool{},
+			strikes:     record.GetInt("strikes"),
+			bannedUntil: record.GetDateTime("banned_until").Time(),
+			lastSeen:    now,
+		}
+	}
+	return nil
+}
+
+// PurgeStale deletes the saved bans of clients whose strikes have decayed,
+// returning how many it deleted
+func (a *AbuseService) PurgeStale() (int, error) {
+	if a.App == nil {
+		return 0, nil
+	}
+	records, err := a.App.FindRecordsByFilter(
+		"abuse_tracking",
+		"banned_until = '' || banned_until < {:cutoff}",
+		"",
+		-1,
+		0,
+		dbx.Params{"cutoff": a.now().UTC().Add(-strikeDecay).Format("2006-01-02 15:04:05.000Z")},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query stale abuse bans: %w", err)
+	}
+	for _, record := range records {
+		if err := a.App.Delete(record); err != nil {
+			return 0, fmt.Errorf("failed to delete stale abuse ban: %w", err)
+		}
+	}
+	return len(records), nil
+}
+
+// sweep drops clients that have been quiet for a window and whose strikes
+// have decayed, so one-off visitors don't accumulate in memory. Runs at most
+// once per minute.
+func (a *AbuseService) sweep(now time.Time) {
+	if now.Sub(a.lastSweep) < time.Minute {
+		return
+	}
+	a.lastSweep = now
+	for key, c := range a.clients {
+		if now.Sub(c.lastSeen) > a.Config.Window && now.Sub(c.bannedUntil) > strikeDecay {
+			delete(a.clients, key)
+		}
+	}
+}
+
+// BanDuration returns the ban length for the given strike: base doubled for
+// every strike after the first, capped at max
+func BanDuration(base, max time.Duration, strikes int) time.Duration {
+	if strikes < 1 {
+		return 0
+	}
+	ban := base
+	for i := 1; i < strikes; i++ {
+		ban *= 2
+		if ban >= max {
+			return max
+		}
+	}
+	if ban > max {
+		return max
+	}
+	return ban
+}
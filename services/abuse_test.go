@@ -0,0 +1,112 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ktappdev/secretnotes-go-backend/config"
+)
+
+func TestBanDuration(t *testing.T) {
+	base := time.Minute
+	max := time.Hour
+
+	cases := []struct {
+		strikes int
+		want    time.Duration
+	}{
+		{0, 0},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{7, time.Hour}, // 64m capped
+		{100, time.Hour},
+	}
+	for _, c := range cases {
+		if got := BanDuration(base, max, c.strikes); got != c.want {
+			t.Errorf("BanDuration(strikes=%d) = %v, want %v", c.strikes, got, c.want)
+		}
+	}
+}
+
+func TestAbuseBans(t *testing.T) {
+	now := time.Unix(0, 0)
+	a := NewAbuseService(nil, config.AbuseConfig{MaxMisses: 2, MaxFailures: 1, Window: time.Minute, BaseBan: time.Minute, MaxBan: time.Hour})
+	a.now = func() time.Time { return now }
+	client := a.ClientKey("1.2.3.4")
+
+	// one passphrase looked up again and again is a single miss
+	for i := 0; i < 10; i++ {
+		a.RecordMiss(client, "aaaaaaaa00")
+	}
+	a.RecordMiss(client, "bbbbbbbb00")
+	if !a.BannedUntil(client).IsZero() {
+		t.Fatal("expected no ban within the miss limit")
+	}
+	a.RecordMiss(client, "cccccccc00")
+	if got := a.BannedUntil(client); !got.Equal(now.Add(time.Minute)) {
+		t.Fatalf("expected a one-minute ban, got %v", got)
+	}
+
+	// the second strike bans for twice as long
+	now = now.Add(2 * time.Minute)
+	if !a.BannedUntil(client).IsZero() {
+		t.Fatal("expected the ban to end")
+	}
+	a.RecordFailure(client)
+	a.RecordFailure(client)
+	if got := a.BannedUntil(client); !got.Equal(now.Add(2 * time.Minute)) {
+		t.Fatalf("expected a two-minute ban, got %v", got)
+	}
+
+	// misses spread over windows don't add up
+	other := a.ClientKey("5.6.7.8")
+	for _, hash := range []string{"dddddddd00", "eeeeeeee00", "ffffffff00"} {
+		a.RecordMiss(other, hash)
+		now = now.Add(time.Minute + time.Second)
+	}
+	if !a.BannedUntil(other).IsZero() {
+		t.Fatal("expected no ban for misses in different windows")
+	}
+}
+
+func TestAbuseBansSurviveRestart(t *testing.T) {
+	app := migratedApp(t)
+	cfg := config.AbuseConfig{MaxMisses: 0, MaxFailures: 0, Window: time.Minute, BaseBan: time.Minute, MaxBan: time.Hour}
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	start := func() *AbuseService {
+		a := NewAbuseService(app, cfg)
+		a.now = func() time.Time { return now }
+		if err := a.Load(); err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+
+	a := start()
+	client := a.ClientKey("1.2.3.4")
+	a.RecordFailure(client)
+
+	// a restarted server still bans the client
+	a = start()
+	if got := a.BannedUntil(client); !got.Equal(now.Add(time.Minute)) {
+		t.Fatalf("expected the ban to survive a restart, got %v", got)
+	}
+
+	// and remembers the strike, so the next ban is twice as long
+	now = now.Add(2 * time.Minute)
+	a = start()
+	a.RecordFailure(client)
+	if got := a.BannedUntil(client); !got.Equal(now.Add(2 * time.Minute)) {
+		t.Fatalf("expected a two-minute ban, got %v", got)
+	}
+
+	// once the strikes have decayed the saved ban is dropped
+	now = now.Add(strikeDecay + time.Hour)
+	if n, err := a.PurgeStale(); err != nil || n != 1 {
+		t.Fatalf("expected the stale ban purged, got %d (%v)", n, err)
+	}
+	if n, _ := app.CountRecords("abuse_tracking"); n != 0 {
+		t.Fatalf("expected no saved bans, got %d", n)
+	}
+}
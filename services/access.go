@@ -0,0 +1,26 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// LastAccessed returns when a note record was last read, or nil when it never was
+func LastAccessed(record *core.Record) *time.Time {
+	return optionalTime(record.GetDateTime("last_accessed_at"))
+}
+
+// recordAccess counts a successful read of the note. It bypasses the record
+// model so the note's "updated" time and update hooks are left alone.
+func (n *NoteService) recordAccess(record *core.Record) {
+	_, err := n.App.DB().NewQuery("UPDATE notes SET access_count = access_count + 1, last_accessed_at = {:now} WHERE id = {:id}").
+		Bind(dbx.Params{"now": types.NowDateTime().String(), "id": record.Id}).
+		Execute()
+	if err != nil {
+		log.Printf("Warning: failed to record note access: %v", err)
+	}
+}
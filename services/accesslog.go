@@ -0,0 +1,155 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	// MaxAccessLogEntries is how many entries are kept per note; older ones are dropped
+	MaxAccessLogEntries = 100
+
+	// maxUserAgentLength is where user agents are cut off before they are logged
+	maxUserAgentLength = 64
+)
+
+// AccessLogEntry is one request made on a note
+type AccessLogEntry struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"` // method and route, e.g. "GET /notes/image"
+	UserAgent string    `json:"userAgent"` // truncated to 64 bytes
+}
+
+// AccessLogService keeps an append-only log of the requests made on each
+// note. Entries are encrypted with the note's passphrase, so only its owner
+// can read them; the server stores nothing but ciphertext and an order.
+type AccessLogService struct {
+	App        *pocketbase.PocketBase
+	Encryption *Service
+}
+
+// NewAccessLogService creates a new access log service
+func NewAccessLogService(app *pocketbase.PocketBase, encryption *Service) *AccessLogService {
+	return &AccessLogService{
+		App:        app,
+		Encryption: encryption,
+	}
+}
+
+// Append adds an entry to the log of the phrase's note, dropping the oldest
+// beyond MaxAccessLogEntries. Errors are logged rather than returned so
+// bookkeeping never fails a request.
+func (a *AccessLogService) Append(phrase, operation, userAgent string) {
+	if err := a.append(phrase, operation, userAgent); err != nil {
+		log.Printf("Warning: failed to append to note access log: %v", err)
+	}
+}
+
+func (a *AccessLogService) append(phrase, operation, userAgent string) error {
+	entry, err := json.Marshal(AccessLogEntry{
+		Time:      time.Now().UTC(),
+		Operation: operation,
+		UserAgent: truncateUTF8(userAgent, maxUserAgentLength),
+	})
+	if err != nil {
+		return err
+	}
+	collection, err := a.App.FindCachedCollectionByNameOrId("note_access_log")
+	if err != nil {
+		return fmt.Errorf("access log collection not found: %w", err)
+	}
+
+	phraseHash := a.hashPhrase(phrase)
+	var last struct {
+		Seq int `db:"seq"`
+	}
+	err = a.App.DB().NewQuery("SELECT COALESCE(MAX(seq), 0) AS seq FROM note_access_log WHERE phrase_hash = {:phrase_hash}").
+		Bind(dbx.Params{"phrase_hash": phraseHash}).
+		One(&last)
+	if err != nil {
+		return fmt.Errorf("failed to query access log: %w", err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("id:autogenerate", "")
+	encrypted, err := a.Encryption.EncryptBound(entry, phrase, recordBinding(record, "entry"))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt entry: %w", err)
+	}
+	record.Set("phrase_hash", phraseHash)
+	record.Set("seq", last.Seq+1)
+	record.Set("entry", base64.StdEncoding.EncodeToString(encrypted))
+	if err := a.App.Save(record); err != nil {
+		return fmt.Errorf("failed to save entry: %w", err)
+	}
+
+	_, err = a.App.DB().NewQuery("DELETE FROM note_access_log WHERE phrase_hash = {:phrase_hash} AND seq <= {:cutoff}").
+		Bind(dbx.Params{"phrase_hash": phraseHash, "cutoff": last.Seq + 1 - MaxAccessLogEntries}).
+		Execute()
+	return err
+}
+
+// List returns the newest limit entries of the phrase's note log, newest first
+func (a *AccessLogService) List(phrase string, limit int) ([]AccessLogEntry, error) {
+	if limit <= 0 || limit > MaxAccessLogEntries {
+		limit = MaxAccessLogEntries
+	}
+	records, err := a.App.FindRecordsByFilter("note_access_log", "phrase_hash = {:phrase_hash}", "-seq", limit, 0, dbx.Params{"phrase_hash": a.hashPhrase(phrase)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query access log: %w", err)
+	}
+
+	entries := make([]AccessLogEntry, 0, len(records))
+	for _, record := range records {
+		encrypted, err := base64.StdEncoding.DecodeString(record.GetString("entry"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode entry: %w", err)
+		}
+		plain, err := a.Encryption.DecryptBound(encrypted, phrase, recordBinding(record, "entry"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt entry: %w", err)
+		}
+		var entry AccessLogEntry
+		if err := json.Unmarshal(plain, &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// DeleteForPhrase removes the log of a note that was deleted or moved to a
+// new passphrase; entries encrypted under the old one can't follow it
+func (a *AccessLogService) DeleteForPhrase(app core.App, phraseHash string) {
+	_, err := app.DB().NewQuery("DELETE FROM note_access_log WHERE phrase_hash = {:phrase_hash}").
+		Bind(dbx.Params{"phrase_hash": phraseHash}).
+		Execute()
+	if err != nil {
+		log.Printf("Warning: failed to delete note access log: %v", err)
+	}
+}
+
+// hashPhrase returns the hash the phrase's records are stored and looked up
+// under (see Service.PhraseHash)
+func (a *AccessLogService) hashPhrase(phrase string) string {
+	return a.Encryption.PhraseHash(phrase)
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
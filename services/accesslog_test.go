@@ -0,0 +1,22 @@
+package services
+
+import "testing"
+
+func TestTruncateUTF8(t *testing.T) {
+	cases := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"curl/8.0", 64, "curl/8.0"},
+		{"abcdef", 3, "abc"},
+		{"añb", 2, "a"}, // ñ is two bytes and must not be split
+		{"añb", 3, "añ"},
+		{"", 5, ""},
+	}
+	for _, c := range cases {
+		if got := truncateUTF8(c.in, c.n); got != c.want {
+			t.Errorf("truncateUTF8(%q, %d) = %q, want %q", c.in, c.n, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// Export archives are a tar file holding manifest.json, the note message and
+// its attachments, encrypted as a whole with EncryptData under the note's
+// passphrase. Anyone holding the passphrase can decrypt one offline or import
+// it on another server. Servers with a signing key also sign the manifest; see
+// ArchiveSigner.
+const (
+	ArchiveFormat  = "secretnotes-export"
+	ArchiveVersion = 1
+
+	archiveManifestPath = "manifest.json"
+	archiveNotePath     = "note.txt"
+)
+
+// ErrInvalidArchive is returned when an archive is malformed or its contents do
+// not match its manifest
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// ArchiveManifest describes the contents of an export archive
+type ArchiveManifest struct {
+	Format      string              `json:"format"`
+	Version     int                 `json:"version"`
+	ExportedAt  time.Time           `json:"exportedAt"`
+	Note        ArchiveNote         `json:"note"`
+	Versions    []ArchiveNote       `json:"versions"` // earlier revisions of the message, oldest first
+	Attachments []ArchiveAttachment `json:"attachments"`
+}
+
+// ArchiveNote points at a message stored in the archive
+type ArchiveNote struct {
+	Path    string    `json:"path"`
+	Size    int       `json:"size,omitempty"`
+	SHA256  string    `json:"sha256,omitempty"` // absent in archives from older servers
+	Title   string    `json:"title,omitempty"`
+	Tags    []string  `json:"tags,omitempty"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// ArchiveAttachment points at an attachment stored in the archive
+type ArchiveAttachment struct {
+	Path        string    `json:"path"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"contentType"`
+	Size        int       `json:"size"`
+	SHA256      string    `json:"sha256"`
+	Created     time.Time `json:"created"`
+}
+
+// Archive is the decoded contents of an export archive
+type Archive struct {
+	Manifest    ArchiveManifest
+	Message     string
+	Versions    []string // earlier revisions, oldest first
+	Attachments []DecryptedFile
+
+	SignedBy ed25519.PublicKey // key of the manifest's valid signature, nil if unsigned
+}
+
+// archiveEntry is a file written to an export archive
+type archiveEntry struct {
+	path string
+	data []byte
+	mod  time.Time
+}
+
+// BuildArchive packs a note and its attachments into an unencrypted tar
+// archive, signed by signer unless it is nil; see EncryptData for sealing it.
+func BuildArchive(note *Note, files []DecryptedFile, exportedAt time.Time, signer *ArchiveSigner) ([]byte, error) {
+	noteSum := sha256.Sum256([]byte(note.Message))
+	manifest := ArchiveManifest{
+		Format:     ArchiveFormat,
+		Version:    ArchiveVersion,
+		ExportedAt: exportedAt.UTC().Truncate(time.Millisecond),
+		Note: ArchiveNote{
+			Path:    archiveNotePath,
+			Size:    len(note.Message),
+			SHA256:  hex.EncodeToString(noteSum[:]),
+			Title:   note.Title,
+			Tags:    note.Tags,
+			Created: note.Created,
+			Updated: note.Updated,
+		},
+		Versions:    []ArchiveNote{},
+		Attachments: make([]ArchiveAttachment, 0, len(files)),
+	}
+
+	entries := []archiveEntry{{archiveNotePath, []byte(note.Message), note.Updated}}
+
+	for i, file := range files {
+		sum := sha256.Sum256(file.Data)
+		entry := ArchiveAttachment{
+			// prefix with the index so equal names can't collide
+			Path:        fmt.Sprintf("attachments/%d-%s", i+1, archiveName(file.Name)),
+			Name:        file.Name,
+			ContentType: file.ContentType,
+			Size:        len(file.Data),
+			SHA256:      hex.EncodeToString(sum[:]),
+			Created:     file.Created,
+		}
+		manifest.Attachments = append(manifest.Attachments, entry)
+		entries = append(entries, archiveEntry{entry.Path, file.Data, file.Created})
+	}
+
+	rawManifest, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	write := func(name string, data []byte, mod time.Time) error {
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    0o600,
+			Size:    int64(len(data)),
+			ModTime: mod,
+			Format:  tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	// the manifest goes first so readers can stream the archive
+	if err := write(archiveManifestPath, rawManifest, manifest.ExportedAt); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	if signer != nil {
+		signature, err := signer.sign(rawManifest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign manifest: %w", err)
+		}
+		if err := write(archiveSignaturePath, signature, manifest.ExportedAt); err != nil {
+			return nil, fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	for _, entry := range entries {
+		if err := write(entry.path, entry.data, entry.mod); err != nil {
+			return nil, fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ReadArchive unpacks an unencrypted archive written by BuildArchive,
+// checking every file the manifest lists against its recorded size and digest,
+// and the manifest's signature if it has one. Whether the signer is trusted is
+// up to the caller (see ArchiveTrust). Entries the manifest does not mention
+// are ignored.
+func ReadArchive(data []byte) (*Archive, error) {
+	tr := tar.NewReader(bytes.NewReader(data))
+	entries := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if len(entries) == 0 && hdr.Name != archiveManifestPath {
+			return nil, fmt.Errorf("%w: %s is not the first entry", ErrInvalidArchive, archiveManifestPath)
+		}
+		if _, dup := entries[hdr.Name]; dup {
+			return nil, fmt.Errorf("%w: duplicate entry %q", ErrInvalidArchive, hdr.Name)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		entries[hdr.Name] = content
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: archive is empty", ErrInvalidArchive)
+	}
+
+	archive := &Archive{}
+	if err := json.Unmarshal(entries[archiveManifestPath], &archive.Manifest); err != nil {
+		return nil, fmt.Errorf("%w: unreadable manifest: %v", ErrInvalidArchive, err)
+	}
+	if raw, ok := entries[archiveSignaturePath]; ok {
+		pub, err := verifyArchiveSignature(raw, entries[archiveManifestPath])
+		if err != nil {
+			return nil, err
+		}
+		archive.SignedBy = pub
+	}
+	manifest := archive.Manifest
+	if manifest.Format != ArchiveFormat {
+		return nil, fmt.Errorf("%w: not a %s archive", ErrInvalidArchive, ArchiveFormat)
+	}
+	if manifest.Version < 1 || manifest.Version > ArchiveVersion {
+		return nil, fmt.Errorf("%w: unsupported archive version %d", ErrInvalidArchive, manifest.Version)
+	}
+
+	message, ok := entries[manifest.Note.Path]
+	if !ok {
+		return nil, fmt.Errorf("%w: missing note %q", ErrInvalidArchive, manifest.Note.Path)
+	}
+	if !manifest.Note.matches(message) {
+		return nil, fmt.Errorf("%w: note %q does not match the manifest", ErrInvalidArchive, manifest.Note.Path)
+	}
+	archive.Message = string(message)
+
+	for _, version := range manifest.Versions {
+		content, ok := entries[version.Path]
+		if !ok {
+			return nil, fmt.Errorf("%w: missing version %q", ErrInvalidArchive, version.Path)
+		}
+		if !version.matches(content) {
+			return nil, fmt.Errorf("%w: version %q does not match the manifest", ErrInvalidArchive, version.Path)
+		}
+		archive.Versions = append(archive.Versions, string(content))
+	}
+
+	for _, attachment := range manifest.Attachments {
+		content, ok := entries[attachment.Path]
+		if !ok {
+			return nil, fmt.Errorf("%w: missing attachment %q", ErrInvalidArchive, attachment.Path)
+		}
+		sum := sha256.Sum256(content)
+		if len(content) != attachment.Size || hex.EncodeToString(sum[:]) != attachment.SHA256 {
+			return nil, fmt.Errorf("%w: attachment %q does not match the manifest", ErrInvalidArchive, attachment.Path)
+		}
+		archive.Attachments = append(archive.Attachments, DecryptedFile{
+			Name:        attachment.Name,
+			ContentType: attachment.ContentType,
+			Data:        content,
+			Created:     attachment.Created,
+		})
+	}
+
+	return archive, nil
+}
+
+// matches reports whether content has the size and digest the manifest
+// records for the message, if it records them
+func (n ArchiveNote) matches(content []byte) bool {
+	if n.SHA256 == "" {
+		return true
+	}
+	sum := sha256.Sum256(content)
+	return len(content) == n.Size && hex.EncodeToString(sum[:]) == n.SHA256
+}
+
+// archiveName turns an uploaded file name into a safe archive path component
+func archiveName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == ".." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
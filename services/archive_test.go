@@ -0,0 +1,93 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestBuildArchive(t *testing.T) {
+	created := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	note := &Note{Message: "hello", Created: created, Updated: created.Add(time.Hour)}
+	files := []DecryptedFile{
+		{Name: "../../etc/passwd", ContentType: "text/plain", Data: []byte("one"), Created: created},
+		{Name: "photo.png", ContentType: "image/png", Data: []byte("two"), Created: created},
+	}
+
+	raw, err := BuildArchive(note, files, created.Add(2*time.Hour), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := map[string]string{}
+	var order []string
+	tr := tar.NewReader(bytes.NewReader(raw))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		contents[hdr.Name] = string(data)
+		order = append(order, hdr.Name)
+	}
+
+	if order[0] != "manifest.json" {
+		t.Fatalf("manifest is not the first entry: %v", order)
+	}
+	var manifest ArchiveManifest
+	if err := json.Unmarshal([]byte(contents["manifest.json"]), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Format != ArchiveFormat || manifest.Version != ArchiveVersion || len(manifest.Attachments) != 2 {
+		t.Fatalf("unexpected manifest: %+v", manifest)
+	}
+	if contents[manifest.Note.Path] != "hello" {
+		t.Errorf("note message = %q", contents[manifest.Note.Path])
+	}
+
+	first := manifest.Attachments[0]
+	if first.Path != "attachments/1-passwd" || first.Name != "../../etc/passwd" {
+		t.Errorf("attachment path not sanitised: %+v", first)
+	}
+	if contents[first.Path] != "one" || first.Size != 3 {
+		t.Errorf("attachment content = %q, size %d", contents[first.Path], first.Size)
+	}
+}
+
+func TestReadArchive(t *testing.T) {
+	created := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	note := &Note{Message: "hello", Created: created, Updated: created}
+	files := []DecryptedFile{{Name: "photo.png", ContentType: "image/png", Data: []byte("image bytes"), Created: created}}
+
+	raw, err := BuildArchive(note, files, created, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := ReadArchive(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive.Message != "hello" || len(archive.Attachments) != 1 || string(archive.Attachments[0].Data) != "image bytes" {
+		t.Fatalf("unexpected archive: %+v", archive)
+	}
+	if archive.Attachments[0].Name != "photo.png" || archive.Attachments[0].ContentType != "image/png" {
+		t.Errorf("attachment metadata lost: %+v", archive.Attachments[0])
+	}
+
+	// tamper with the attachment without updating the manifest
+	tampered := bytes.Replace(raw, []byte("image bytes"), []byte("IMAGE BYTES"), 1)
+	if _, err := ReadArchive(tampered); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("tampered attachment: got %v", err)
+	}
+	if _, err := ReadArchive([]byte("not a tar file")); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("garbage input: got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// A signed export archive holds manifest.sig right after manifest.json: an
+// Ed25519 signature by the exporting server over the manifest exactly as
+// stored. The manifest records the size and SHA-256 of every entry, so an
+// importer that trusts the key knows the archive is whole and unchanged since
+// it was exported. The passphrase encryption already guards against anyone
+// without the passphrase; the signature also shows which server wrote it.
+const (
+	archiveSignaturePath = "manifest.sig"
+
+	// archiveSignatureContext is signed ahead of the manifest, so the key's
+	// signatures can't be passed off as anything else
+	archiveSignatureContext = "secretnotes-export-manifest\x00"
+
+	// SignatureEd25519 is the only archive signature algorithm
+	SignatureEd25519 = "ed25519"
+)
+
+// ErrUntrustedArchive is returned when an archive is required to be signed by
+// a trusted key and isn't
+var ErrUntrustedArchive = fmt.Errorf("%w: not signed by a trusted key", ErrInvalidArchive)
+
+// ArchiveSignature is the content of manifest.sig
+type ArchiveSignature struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"keyId"`
+	PublicKey string `json:"publicKey"` // base64
+	Signature string `json:"signature"` // base64
+}
+
+// ArchiveSigner signs the manifests of export archives
+type ArchiveSigner struct {
+	key ed25519.PrivateKey
+}
+
+// NewArchiveSigner creates a signer from an Ed25519 private key seed
+func NewArchiveSigner(seed []byte) (*ArchiveSigner, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key must be %d bytes, got %d", ed25519.SeedSize, len(seed))
+	}
+	return &ArchiveSigner{key: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+// PublicKey returns the key that verifies the signer's signatures
+func (s *ArchiveSigner) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// KeyID returns the signer's key id
+func (s *ArchiveSigner) KeyID() string {
+	return SigningKeyID(s.PublicKey())
+}
+
+// sign signs a manifest as stored in an archive
+func (s *ArchiveSigner) sign(manifest []byte) ([]byte, error) {
+	return json.MarshalIndent(ArchiveSignature{
+		Algorithm: SignatureEd25519,
+		KeyID:     s.KeyID(),
+		PublicKey: base64.StdEncoding.EncodeToString(s.PublicKey()),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, signedManifest(manifest))),
+	}, "", "  ")
+}
+
+// SigningKeyID names a public key in archive signatures and capabilities: the
+// first 8 bytes of its SHA-256, in hex
+func SigningKeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// signedManifest returns the message an archive signature covers
+func signedManifest(manifest []byte) []byte {
+	return append([]byte(archiveSignatureContext), manifest...)
+}
+
+// verifyArchiveSignature checks that raw, the content of manifest.sig, is a
+// valid signature of manifest by the key it names, and returns that key
+func verifyArchiveSignature(raw, manifest []byte) (ed25519.PublicKey, error) {
+	var sig ArchiveSignature
+	if err := json.Unmarshal(raw, &sig); err != nil {
+		return nil, fmt.Errorf("%w: unreadable signature: %v", ErrInvalidArchive, err)
+	}
+	if sig.Algorithm != SignatureEd25519 {
+		return nil, fmt.Errorf("%w: unsupported signature algorithm %q", ErrInvalidArchive, sig.Algorithm)
+	}
+	pub, err := base64.StdEncoding.DecodeString(sig.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: invalid signing key", ErrInvalidArchive)
+	}
+	signature, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil || !ed25519.Verify(pub, signedManifest(manifest), signature) {
+		return nil, fmt.Errorf("%w: the manifest signature does not verify", ErrInvalidArchive)
+	}
+	if sig.KeyID != SigningKeyID(pub) {
+		return nil, fmt.Errorf("%w: signature key id does not match its key", ErrInvalidArchive)
+	}
+	return pub, nil
+}
+
+// ArchiveTrust decides which signed archives an import accepts
+type ArchiveTrust struct {
+	Keys    []ed25519.PublicKey // trusted signers, this server's own key included
+	Require bool                // refuse archives not signed by a trusted key
+}
+
+// Trusted reports whether a was signed by one of t's keys
+func (t ArchiveTrust) Trusted(a *Archive) bool {
+	if a.SignedBy == nil {
+		return false
+	}
+	return slices.ContainsFunc(t.Keys, func(key ed25519.PublicKey) bool {
+		return key.Equal(a.SignedBy)
+	})
+}
+
+// Check returns ErrUntrustedArchive if signatures are required and a has no
+// trusted one
+func (t ArchiveTrust) Check(a *Archive) error {
+	if t.Require && !t.Trusted(a) {
+		if a.SignedBy == nil {
+			return fmt.Errorf("%w: the archive is not signed", ErrUntrustedArchive)
+		}
+		return fmt.Errorf("%w: signed by unknown key %s", ErrUntrustedArchive, SigningKeyID(a.SignedBy))
+	}
+	return nil
+}
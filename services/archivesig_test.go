@@ -0,0 +1,73 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestArchiveSignature(t *testing.T) {
+	signer, err := NewArchiveSigner(bytes.Repeat([]byte{7}, ed25519.SeedSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := NewArchiveSigner(bytes.Repeat([]byte{8}, ed25519.SeedSize))
+	if _, err := NewArchiveSigner([]byte("short")); err == nil {
+		t.Fatal("expected an error for a short seed")
+	}
+
+	created := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	note := &Note{Message: "hello", Created: created, Updated: created}
+	files := []DecryptedFile{{Name: "photo.png", ContentType: "image/png", Data: []byte("image bytes"), Created: created}}
+	signed, err := BuildArchive(note, files, created, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned, err := BuildArchive(note, files, created, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := ReadArchive(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !signer.PublicKey().Equal(archive.SignedBy) || archive.Message != "hello" {
+		t.Fatalf("unexpected archive: %+v", archive)
+	}
+	plain, err := ReadArchive(unsigned)
+	if err != nil || plain.SignedBy != nil {
+		t.Fatalf("unsigned archive: %v, signed by %x", err, plain.SignedBy)
+	}
+
+	trusted := ArchiveTrust{Keys: []ed25519.PublicKey{signer.PublicKey()}, Require: true}
+	if err := trusted.Check(archive); err != nil || !trusted.Trusted(archive) {
+		t.Fatalf("trusted signer refused: %v", err)
+	}
+	if err := trusted.Check(plain); !errors.Is(err, ErrUntrustedArchive) {
+		t.Fatalf("unsigned archive: expected ErrUntrustedArchive, got %v", err)
+	}
+	stranger := ArchiveTrust{Keys: []ed25519.PublicKey{other.PublicKey()}, Require: true}
+	if err := stranger.Check(archive); !errors.Is(err, ErrUntrustedArchive) {
+		t.Fatalf("unknown signer: expected ErrUntrustedArchive, got %v", err)
+	}
+	if err := (ArchiveTrust{}).Check(plain); err != nil {
+		t.Fatalf("signatures not required: %v", err)
+	}
+
+	// the note's digest is in the signed manifest
+	tampered := bytes.Replace(signed, []byte("hello"), []byte("HELLO"), 1)
+	if _, err := ReadArchive(tampered); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("tampered note: got %v", err)
+	}
+	// and the manifest can't change under the signature
+	tampered = bytes.Replace(signed, []byte(`"exportedAt": "2024`), []byte(`"exportedAt": "2025`), 1)
+	if bytes.Equal(tampered, signed) {
+		t.Fatal("manifest not found")
+	}
+	if _, err := ReadArchive(tampered); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("tampered manifest: got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// MaxFilenameLength caps an attachment's filename, in bytes
+const MaxFilenameLength = 255
+
+// ErrInvalidFilename is returned for an empty, overlong or path-like filename
+var ErrInvalidFilename = errors.New("invalid filename")
+
+// Attachment describes a stored attachment without its content
+type Attachment struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Size         int64      `json:"size"` // decrypted bytes
+	ContentType  string     `json:"contentType"`
+	HasThumbnail bool       `json:"hasThumbnail"`
+	Created      time.Time  `json:"created"`
+	Updated      time.Time  `json:"updated"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"` // when the retention policy's age limit purges it
+}
+
+// ListAttachments describes every attachment stored under the phrase, oldest
+// first. Only the filenames are decrypted.
+func (f *FileService) ListAttachments(phrase string) ([]Attachment, error) {
+	policy, err := f.AttachmentRetention(phrase)
+	if err != nil {
+		return nil, err
+	}
+	records, err := f.App.FindRecordsByFilter(
+		"encrypted_files",
+		"phrase_hash = {:phrase_hash}",
+		"created",
+		-1,
+		0,
+		dbx.Params{"phrase_hash": f.hashPhrase(phrase)},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error finding encrypted files: %w", err)
+	}
+
+	attachments := make([]Attachment, 0, len(records))
+	for _, rec := range records {
+		name, err := f.decryptFilename(rec, phrase)
+		if err != nil {
+			return nil, err
+		}
+		contentType, err := f.decryptContentType(f.App, rec, phrase)
+		if err != nil {
+			return nil, err
+		}
+		attachment := attachmentFromRecord(rec, name, contentType)
+		attachment.ExpiresAt = policy.ExpiresAt(attachment.Created)
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
+}
+
+// RenameAttachment replaces the stored filename of the attachment id, when it
+// belongs to the phrase; the stored data is left as it is
+func (f *FileService) RenameAttachment(phrase, id, name string) (*Attachment, error) {
+	name = strings.TrimSpace(name)
+	if err := ValidateFilename(name); err != nil {
+		return nil, err
+	}
+	rec, err := f.App.FindRecordById("encrypted_files", id)
+	if err != nil || rec.GetString("phrase_hash") != f.hashPhrase(phrase) {
+		return nil, ErrFileNotFound
+	}
+	contentType, err := f.decryptContentType(f.App, rec, phrase)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedName, err := f.Encryption.EncryptBound([]byte(name), phrase, recordBinding(rec, "file_name"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt filename: %w", err)
+	}
+	rec.Set("file_name", base64.StdEncoding.EncodeToString(encryptedName))
+	if err := f.App.Save(rec); err != nil {
+		return nil, fmt.Errorf("failed to rename attachment: %w", err)
+	}
+	attachment := attachmentFromRecord(rec, name, contentType)
+	return &attachment, nil
+}
+
+// ValidateFilename checks that name can be sent as a download filename: 1 to
+// MaxFilenameLength bytes, without path separators or control characters
+func ValidateFilename(name string) error {
+	if name == "" || len(name) > MaxFilenameLength {
+		return fmt.Errorf("%w: must be 1 to %d bytes", ErrInvalidFilename, MaxFilenameLength)
+	}
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%w: must not be a path", ErrInvalidFilename)
+	}
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 || strings.Contains(name, `"`) {
+		return fmt.Errorf("%w: must not contain control characters or quotes", ErrInvalidFilename)
+	}
+	return nil
+}
+
+func attachmentFromRecord(rec *core.Record, name, contentType string) Attachment {
+	return Attachment{
+		ID:           rec.Id,
+		Name:         name,
+		Size:         int64(rec.GetInt("size")),
+		ContentType:  contentType,
+		HasThumbnail: rec.GetString("thumbnail") != "",
+		Created:      Timestamp(rec.GetDateTime("created")),
+		Updated:      Timestamp(rec.GetDateTime("updated")),
+	}
+}
+
+// DeleteAttachment removes the attachment id, record and stored data, when it
+// belongs to the phrase; otherwise it returns ErrFileNotFound. It returns the
+// hash the note's image_hash should now hold: that of the attachment
+// GET /notes/image serves next, or "" when none are left.
+func (f *FileService) DeleteAttachment(phrase, id string) (string, error) {
+	rec, err := f.App.FindRecordById("encrypted_files", id)
+	if err != nil || rec.GetString("phrase_hash") != f.hashPhrase(phrase) {
+		return "", ErrFileNotFound
+	}
+	if err := f.App.Delete(rec); err != nil {
+		return "", fmt.Errorf("failed to delete encrypted file: %w", err)
+	}
+
+	return f.servedImageHash(f.hashPhrase(phrase))
+}
+
+// servedImageHash returns the hash of the attachment GET /notes/image serves
+// for phraseHash, or "" when there is none
+func (f *FileService) servedImageHash(phraseHash string) (string, error) {
+	next, err := f.findFileByHash(phraseHash)
+	if errors.Is(err, ErrFileNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := f.readStoredFile(f.App, next)
+	if err != nil {
+		return "", err
+	}
+	return f.hashBytes(encrypted), nil
+}
@@ -0,0 +1,20 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateFilename(t *testing.T) {
+	for _, name := range []string{"memo.m4a", "Holiday photo (1).jpg", "résumé.pdf", strings.Repeat("a", MaxFilenameLength)} {
+		if err := ValidateFilename(name); err != nil {
+			t.Errorf("%q: unexpected error %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "..", "dir/file.txt", `C:\file.txt`, "bad\nname", `say "hi".txt`, strings.Repeat("a", MaxFilenameLength+1)} {
+		if err := ValidateFilename(name); !errors.Is(err, ErrInvalidFilename) {
+			t.Errorf("%q: expected ErrInvalidFilename, got %v", name, err)
+		}
+	}
+}
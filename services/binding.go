@@ -0,0 +1,74 @@
+package services
+
+import (
+	"crypto/sha256"
+	"io"
+
+	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/ktappdev/secretnotes-go-backend/pkg/cryptobox"
+)
+
+// Key purposes. Stored fields aren't encrypted with the key derived from the
+// passphrase itself but with a subkey derived from it with HKDF for one of
+// these, so note messages, attachment files and the metadata around them
+// never share a key, and a weakness in how one is used doesn't carry over to
+// the others.
+const (
+	PurposeMessage  = "message"  // note messages
+	PurposeFile     = "file"     // attachment data and thumbnails
+	PurposeMetadata = "metadata" // titles, tags, filenames and everything else
+)
+
+// purposeIDs are the purpose id bytes of version 3 and SNC4 envelopes
+var purposeIDs = map[string]byte{
+	PurposeMessage:  cryptobox.PurposeMessage,
+	PurposeFile:     cryptobox.PurposeFile,
+	PurposeMetadata: cryptobox.PurposeMetadata,
+}
+
+// fieldPurposes maps "collection/field" to its key purpose; fields not listed
+// are metadata
+var fieldPurposes = map[string]string{
+	"notes/message":             PurposeMessage,
+	"encrypted_files/file_data": PurposeFile,
+	"encrypted_files/thumbnail": PurposeFile,
+	"attachment_contents/data":  PurposeFile,
+}
+
+// Binding ties a ciphertext to where it is stored. Its purpose selects the
+// subkey it is encrypted with, and its additional data, naming the
+// collection, record and field such as "notes/message:<id>", is authenticated
+// with it, so a ciphertext copied into another record or field fails to
+// decrypt, even under the same passphrase or server key. The zero Binding
+// binds nothing.
+type Binding struct {
+	Purpose string
+	AAD     []byte
+}
+
+// FieldBinding returns the Binding of a field of the record id in collection
+func FieldBinding(collection, recordID, field string) Binding {
+	purpose, ok := fieldPurposes[collection+"/"+field]
+	if !ok {
+		purpose = PurposeMetadata
+	}
+	return Binding{Purpose: purpose, AAD: []byte(collection + "/" + field + ":" + recordID)}
+}
+
+// recordBinding returns the FieldBinding of a field of rec, which must have
+// its id set
+func recordBinding(rec *core.Record, field string) Binding {
+	return FieldBinding(rec.Collection().Name, rec.Id, field)
+}
+
+// subkey derives the key for purpose from a passphrase key
+func subkey(key []byte, purpose string) []byte {
+	sub := make([]byte, len(key))
+	// only fails when asked for more than 255 hashes of output
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, nil, []byte("secretnotes "+purpose)), sub); err != nil {
+		panic(err)
+	}
+	return sub
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// BlobKeyLength is the length of a blob lookup key: 32 bytes, hex encoded
+	BlobKeyLength = 64
+
+	// MaxBlobFormatLength caps the client's format name
+	MaxBlobFormatLength = 64
+
+	// MaxBlobParamsBytes caps the client's format parameters (salt, KDF cost, ...)
+	MaxBlobParamsBytes = 1024
+)
+
+var (
+	// ErrBlobNotFound is returned when no blob is stored under a lookup key
+	ErrBlobNotFound = errors.New("blob not found")
+
+	// ErrInvalidBlob is returned for a malformed lookup key, format or ciphertext
+	ErrInvalidBlob = errors.New("invalid blob")
+)
+
+// BlobFormat is the client's description of how a blob was encrypted. The
+// server only stores it; Version lets clients evolve their scheme and still
+// read old blobs.
+type BlobFormat struct {
+	Version int             `json:"version"`          // client format version, 1 or higher
+	Name    string          `json:"name"`             // e.g. "aes-256-gcm+pbkdf2-sha256"
+	Params  json.RawMessage `json:"params,omitempty"` // a JSON object, e.g. {"salt": "...", "iterations": 600000}
+}
+
+// Blob is client-encrypted data the server stores verbatim
+type Blob struct {
+	Format     BlobFormat `json:"format"`
+	Ciphertext string     `json:"ciphertext,omitempty"` // base64, as sent by the client
+	Created    time.Time  `json:"created"`
+	Updated    time.Time  `json:"updated"`
+}
+
+// BlobService stores opaque, client-side encrypted blobs. Clients derive the
+// lookup key and encryption key from their passphrase themselves, so the
+// server never sees a passphrase or plaintext. Only a hash of the lookup key
+// is stored, so a copy of the database can't be used to fetch blobs.
+type BlobService struct {
+	App *pocketbase.PocketBase
+}
+
+// NewBlobService creates a new blob service
+func NewBlobService(app *pocketbase.PocketBase) *BlobService {
+	return &BlobService{App: app}
+}
+
+// PutBlob creates or replaces the blob stored under key and reports whether
+// it was created
+func (b *BlobService) PutBlob(key string, format BlobFormat, ciphertext string) (*Blob, bool, error) {
+	if err := ValidateBlobKey(key); err != nil {
+		return nil, false, err
+	}
+	if err := validateBlobFormat(format); err != nil {
+		return nil, false, err
+	}
+	if raw, err := base64.StdEncoding.DecodeString(ciphertext); err != nil || len(raw) == 0 {
+		return nil, false, fmt.Errorf("%w: ciphertext must be non-empty base64", ErrInvalidBlob)
+	}
+
+	lookupHash := b.hashKey(key)
+	record, err := b.App.FindFirstRecordByData("blobs", "lookup_hash", lookupHash)
+	created := err != nil
+	if created {
+		collection, err := b.App.FindCachedCollectionByNameOrId("blobs")
+		if err != nil {
+			return nil, false, fmt.Errorf("blobs collection not found: %w", err)
+		}
+		record = core.NewRecord(collection)
+		record.Set("lookup_hash", lookupHash)
+	}
+	record.Set("version", format.Version)
+	record.Set("format", format.Name)
+	record.Set("params", types.JSONRaw(format.Params))
+	record.Set("ciphertext", ciphertext)
+
+	if err := b.App.Save(record); err != nil {
+		return nil, false, fmt.Errorf("failed to save blob: %w", err)
+	}
+	return blobFromRecord(record), created, nil
+}
+
+// GetBlob returns the blob stored under key
+func (b *BlobService) GetBlob(key string) (*Blob, error) {
+	if err := ValidateBlobKey(key); err != nil {
+		return nil, err
+	}
+	record, err := b.App.FindFirstRecordByData("blobs", "lookup_hash", b.hashKey(key))
+	if err != nil {
+		return nil, ErrBlobNotFound
+	}
+	return blobFromRecord(record), nil
+}
+
+// DeleteBlob removes the blob stored under key
+func (b *BlobService) DeleteBlob(key string) error {
+	if err := ValidateBlobKey(key); err != nil {
+		return err
+	}
+	record, err := b.App.FindFirstRecordByData("blobs", "lookup_hash", b.hashKey(key))
+	if err != nil {
+		return ErrBlobNotFound
+	}
+	if err := b.App.Delete(record); err != nil {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return nil
+}
+
+// ValidateBlobKey checks that key is 32 bytes of lowercase hex, e.g. a
+// SHA-256 the client derived from its passphrase
+func ValidateBlobKey(key string) error {
+	if len(key) != BlobKeyLength {
+		return fmt.Errorf("%w: lookup key must be %d hex characters", ErrInvalidBlob, BlobKeyLength)
+	}
+	if _, err := hex.DecodeString(key); err != nil || key != strings.ToLower(key) {
+		return fmt.Errorf("%w: lookup key must be lowercase hex", ErrInvalidBlob)
+	}
+	return nil
+}
+
+func validateBlobFormat(format BlobFormat) error {
+	if format.Version < 1 {
+		return fmt.Errorf("%w: format version must be 1 or higher", ErrInvalidBlob)
+	}
+	if format.Name == "" || len(format.Name) > MaxBlobFormatLength {
+		return fmt.Errorf("%w: format name must be 1 to %d characters", ErrInvalidBlob, MaxBlobFormatLength)
+	}
+	if len(format.Params) > 0 {
+		if len(format.Params) > MaxBlobParamsBytes {
+			return fmt.Errorf("%w: format params exceed %d bytes", ErrInvalidBlob, MaxBlobParamsBytes)
+		}
+		if trimmed := bytes.TrimSpace(format.Params); len(trimmed) == 0 || trimmed[0] != '{' {
+			return fmt.Errorf("%w: format params must be a JSON object", ErrInvalidBlob)
+		}
+	}
+	return nil
+}
+
+func blobFromRecord(record *core.Record) *Blob {
+	blob := &Blob{
+		Format: BlobFormat{
+			Version: record.GetInt("version"),
+			Name:    record.GetString("format"),
+		},
+		Ciphertext: record.GetString("ciphertext"),
+		Created:    Timestamp(record.GetDateTime("created")),
+		Updated:    Timestamp(record.GetDateTime("updated")),
+	}
+	if params := record.GetString("params"); params != "" && params != "null" {
+		blob.Format.Params = json.RawMessage(params)
+	}
+	return blob
+}
+
+// hashKey hashes a lookup key for storage, so stored hashes can't be replayed as keys
+func (b *BlobService) hashKey(key string) string {
+	hash := sha256.Sum256([]byte("blob:" + key))
+	return hex.EncodeToString(hash[:])
+}
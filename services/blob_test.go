@@ -0,0 +1,40 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateBlobKey(t *testing.T) {
+	valid := strings.Repeat("ab", 32)
+	if err := ValidateBlobKey(valid); err != nil {
+		t.Fatalf("expected %q to be valid, got %v", valid, err)
+	}
+	for _, key := range []string{"", "abc", strings.Repeat("AB", 32), strings.Repeat("zz", 32), valid + "00"} {
+		if err := ValidateBlobKey(key); !errors.Is(err, ErrInvalidBlob) {
+			t.Errorf("ValidateBlobKey(%q) = %v, want ErrInvalidBlob", key, err)
+		}
+	}
+}
+
+func TestValidateBlobFormat(t *testing.T) {
+	cases := []struct {
+		format BlobFormat
+		ok     bool
+	}{
+		{BlobFormat{Version: 1, Name: "aes-256-gcm+pbkdf2-sha256"}, true},
+		{BlobFormat{Version: 2, Name: "x", Params: json.RawMessage(`{"salt":"c2FsdA==","iterations":600000}`)}, true},
+		{BlobFormat{Version: 0, Name: "x"}, false},
+		{BlobFormat{Version: 1}, false},
+		{BlobFormat{Version: 1, Name: strings.Repeat("x", MaxBlobFormatLength+1)}, false},
+		{BlobFormat{Version: 1, Name: "x", Params: json.RawMessage(`[1,2]`)}, false},
+		{BlobFormat{Version: 1, Name: "x", Params: json.RawMessage(`{"pad":"` + strings.Repeat("x", MaxBlobParamsBytes) + `"}`)}, false},
+	}
+	for _, c := range cases {
+		if err := validateBlobFormat(c.format); (err == nil) != c.ok {
+			t.Errorf("validateBlobFormat(%+v) = %v, want ok=%v", c.format, err, c.ok)
+		}
+	}
+}
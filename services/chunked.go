@@ -0,0 +1,588 @@
+package services
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ktappdev/secretnotes-go-backend/cryptoutil"
+	"github.com/ktappdev/secretnotes-go-backend/pkg/cryptobox"
+)
+
+// Chunked envelopes encrypt data in fixed-size chunks, each sealed on its
+// own, so any byte range can be decrypted without reading the rest. They may
+// use AES-GCM-SIV, under which a chunk nonce used twice, say by a bug in the
+// counter handling, only shows whether two chunks are equal instead of
+// breaking the whole envelope. Layout:
+//
+//	"SNC2" | cipher id | KDF id | chunk size (uint32) | params length |
+//	KDF params | salt length | salt | base nonce | sealed chunks
+//
+// with the cipher and KDF ids and params as in EncryptData envelopes. Chunk i
+// is sealed with the base nonce XOR i and authenticates i and whether it is
+// the last chunk, so chunks can't be reordered, dropped or truncated.
+// "SNC4" envelopes, which stored fields use, add a purpose id after the KDF
+// id: they are keyed with the subkey for that purpose, and every chunk also
+// authenticates the additional data of the Binding where the envelope is
+// stored. "SNC5" envelopes add a pepper id after the purpose id, like version
+// 4 EncryptData envelopes, and "SNC6" envelopes the pepper id (0 for none)
+// and the KMS-wrapped data key, like version 5. "SNC3" envelopes were bound
+// the same way without a subkey.
+// Envelopes from before the KDF costs were recorded stay readable:
+//
+//	"SNC1" | algorithm id | chunk size (uint32) | salt | base nonce | sealed chunks
+var chunkedMagic = []byte("SNC2")
+
+// boundChunkedMagic starts chunked envelopes written by a Binding
+var boundChunkedMagic = []byte("SNC4")
+
+// pepperedChunkedMagic starts chunked envelopes written by a Binding with a
+// server pepper
+var pepperedChunkedMagic = []byte("SNC5")
+
+// wrappedChunkedMagic starts chunked envelopes written by a Binding with a
+// KMS-wrapped data key
+var wrappedChunkedMagic = []byte("SNC6")
+
+// v3ChunkedMagic starts chunked envelopes sealed with additional data but
+// keyed with the passphrase key itself
+var v3ChunkedMagic = []byte("SNC3")
+
+// v1ChunkedMagic starts chunked envelopes without recorded KDF costs
+var v1ChunkedMagic = []byte("SNC1")
+
+// ChunkSize is the plaintext size of each chunk but the last
+const ChunkSize = 64 << 10
+
+// chunkedCipherIDs are the cipher ids of SNC1 envelopes, combined with the
+// KDF into the algorithm id byte as in version 0 envelopes
+var chunkedCipherIDs = map[string]byte{
+	CipherAESGCM:           1,
+	CipherChaCha20Poly1305: 2,
+}
+
+// Streamable reports whether attachments of contentType are stored in
+// chunked envelopes, so players can stream them with Range requests
+func Streamable(contentType string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(contentType)), "audio/")
+}
+
+// chunkedHeader is the parsed header of a chunked envelope
+type chunkedHeader struct {
+	cipher    string
+	params    cryptobox.KDFParams
+	chunkSize int64
+	salt      []byte
+	baseNonce []byte
+	bound     bool   // chunks authenticate additional data
+	purpose   string // subkey purpose, "" for the passphrase key itself
+	pepper    byte   // id of the pepper mixed into the key, 0 for none
+	wrapped   []byte // KMS-wrapped data key mixed into the key, nil for none
+}
+
+// marshal encodes the header in the current format: SNC6 with a wrapped data
+// key, SNC5 with a pepper, SNC4 with a purpose, else SNC2, or SNC3 for a
+// bound header without one
+func (h *chunkedHeader) marshal(out []byte) []byte {
+	switch {
+	case h.wrapped != nil:
+		out = append(out, wrappedChunkedMagic...)
+	case h.pepper != 0:
+		out = append(out, pepperedChunkedMagic...)
+	case h.purpose != "":
+		out = append(out, boundChunkedMagic...)
+	case h.bound:
+		out = append(out, v3ChunkedMagic...)
+	default:
+		out = append(out, chunkedMagic...)
+	}
+	out = append(out, cryptobox.CipherID(h.cipher), cryptobox.KDFID(h.params.KDF))
+	if h.purpose != "" {
+		out = append(out, purposeIDs[h.purpose])
+	}
+	if h.pepper != 0 || h.wrapped != nil {
+		out = append(out, h.pepper)
+	}
+	if h.wrapped != nil {
+		out = binary.BigEndian.AppendUint16(out, uint16(len(h.wrapped)))
+		out = append(out, h.wrapped...)
+	}
+	out = binary.BigEndian.AppendUint32(out, uint32(h.chunkSize))
+	out = cryptobox.AppendKeyParams(out, h.params, h.salt)
+	return append(out, h.baseNonce...)
+}
+
+// size is the length of the marshalled header
+func (h *chunkedHeader) size() int {
+	size := len(chunkedMagic) + 2 + 4 + 2 + len(h.params.Encode()) + len(h.salt) + len(h.baseNonce)
+	if h.purpose != "" {
+		size++
+	}
+	if h.pepper != 0 || h.wrapped != nil {
+		size++
+	}
+	if h.wrapped != nil {
+		size += 2 + len(h.wrapped)
+	}
+	return size
+}
+
+// readChunkedHeader reads a chunked envelope header of any version from r
+func readChunkedHeader(r io.Reader) (*chunkedHeader, int64, error) {
+	short := func(err error) error {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return malformed("chunked envelope is too short")
+		}
+		return fmt.Errorf("failed to read envelope header: %w", err)
+	}
+
+	fixed := make([]byte, len(chunkedMagic)+2+4)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, 0, short(err)
+	}
+	h := &chunkedHeader{}
+	var rest []byte
+	switch {
+	case bytes.HasPrefix(fixed, v1ChunkedMagic):
+		// one algorithm id byte, so fixed already holds the first byte of the salt
+		cipherName, kdf, ok := parseAlgorithmID(chunkedCipherIDs, fixed[4])
+		if !ok {
+			return nil, 0, unsupported("unsupported chunked envelope")
+		}
+		h.cipher, h.params = cipherName, cryptobox.LegacyKDFParams(kdf)
+		h.chunkSize = int64(binary.BigEndian.Uint32(fixed[5:]))
+		rest = make([]byte, legacySaltSize+nonceSize-1)
+		if _, err := io.ReadFull(r, rest); err != nil {
+			return nil, 0, short(err)
+		}
+		size := int64(len(fixed) + len(rest))
+		rest = append([]byte{fixed[9]}, rest...)
+		h.salt, h.baseNonce = rest[:legacySaltSize], rest[legacySaltSize:]
+		return h.checked(size)
+	case bytes.HasPrefix(fixed, chunkedMagic), bytes.HasPrefix(fixed, v3ChunkedMagic), bytes.HasPrefix(fixed, boundChunkedMagic), bytes.HasPrefix(fixed, pepperedChunkedMagic),
+		bytes.HasPrefix(fixed, wrappedChunkedMagic):
+		h.bound = !bytes.HasPrefix(fixed, chunkedMagic)
+		h.cipher = cryptobox.CipherName(fixed[4])
+		kdf := cryptobox.KDFName(fixed[5])
+		if h.cipher == "" || kdf == "" {
+			return nil, 0, unsupported("unsupported chunked envelope")
+		}
+		if bytes.HasPrefix(fixed, wrappedChunkedMagic) {
+			// purpose id | pepper id | wrapped key length, then the wrapped
+			// key and the chunk size
+			if h.purpose = idName(purposeIDs, fixed[6]); h.purpose == "" {
+				return nil, 0, unsupported("unknown purpose id %d", fixed[6])
+			}
+			h.pepper = fixed[7]
+			size := int(binary.BigEndian.Uint16(fixed[8:]))
+			if size == 0 || size > cryptobox.MaxWrappedKeySize {
+				return nil, 0, malformed("wrapped key length %d is out of range", size)
+			}
+			next := make([]byte, size+4)
+			if _, err := io.ReadFull(r, next); err != nil {
+				return nil, 0, short(err)
+			}
+			fixed = append(fixed, next...)
+			h.wrapped = next[:size]
+		} else if bytes.HasPrefix(fixed, boundChunkedMagic) || bytes.HasPrefix(fixed, pepperedChunkedMagic) {
+			// the purpose id, and the pepper id if any, come before the chunk size
+			ids := 1
+			if bytes.HasPrefix(fixed, pepperedChunkedMagic) {
+				ids = 2
+			}
+			next := make([]byte, ids)
+			if _, err := io.ReadFull(r, next); err != nil {
+				return nil, 0, short(err)
+			}
+			fixed = append(fixed, next...)
+			if h.purpose = idName(purposeIDs, fixed[6]); h.purpose == "" {
+				return nil, 0, unsupported("unknown purpose id %d", fixed[6])
+			}
+			if ids == 2 {
+				if h.pepper = fixed[7]; h.pepper == 0 {
+					return nil, 0, malformed("pepper id 0 is reserved")
+				}
+			}
+		}
+		h.chunkSize = int64(binary.BigEndian.Uint32(fixed[len(fixed)-4:]))
+
+		// params length | params | salt length, then the salt and nonce
+		paramsLen := make([]byte, 1)
+		if _, err := io.ReadFull(r, paramsLen); err != nil {
+			return nil, 0, short(err)
+		}
+		keyParams := make([]byte, 1+int(paramsLen[0])+1)
+		keyParams[0] = paramsLen[0]
+		if _, err := io.ReadFull(r, keyParams[1:]); err != nil {
+			return nil, 0, short(err)
+		}
+		saltSize := int(keyParams[len(keyParams)-1])
+		if saltSize < MinSaltSize || saltSize > MaxSaltSize {
+			return nil, 0, malformed("salt length %d is out of range", saltSize)
+		}
+		tail := make([]byte, saltSize+nonceSize)
+		if _, err := io.ReadFull(r, tail); err != nil {
+			return nil, 0, short(err)
+		}
+		params, salt, nonce, err := cryptobox.ParseKeyParams(kdf, append(keyParams, tail...))
+		if err != nil {
+			return nil, 0, err
+		}
+		h.params, h.salt, h.baseNonce = params, salt, nonce
+		return h.checked(int64(len(fixed) + len(keyParams) + len(tail)))
+	default:
+		return nil, 0, malformed("not a chunked envelope")
+	}
+}
+
+// checked validates the chunk size of a parsed header of size bytes
+func (h *chunkedHeader) checked(size int64) (*chunkedHeader, int64, error) {
+	if h.chunkSize == 0 || h.chunkSize > 1<<24 {
+		return nil, 0, malformed("unsupported chunk size %d", h.chunkSize)
+	}
+	return h, size, nil
+}
+
+// EncryptChunked encrypts data into a chunked envelope with the service's
+// ChunkCipher and KDF, bound as in EncryptBound unless b is the zero Binding
+func (s *Service) EncryptChunked(data []byte, phrase string, b Binding) ([]byte, error) {
+	chunks := max((len(data)+ChunkSize-1)/ChunkSize, 1)
+	out := bytes.NewBuffer(make([]byte, 0, len(data)+chunks*tagSize+64+s.SaltSize))
+	if _, err := s.SealChunked(out, bytes.NewReader(data), phrase, b); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// SealChunked encrypts everything read from src into a chunked envelope
+// written to dst, as EncryptChunked does, holding only a chunk or two of
+// plaintext at a time. It returns the number of plaintext bytes sealed.
+func (s *Service) SealChunked(dst io.Writer, src io.Reader, phrase string, b Binding) (int64, error) {
+	id := s.serverLayerFor(b)
+	if id == 0 {
+		return s.sealChunked(dst, src, phrase, b)
+	}
+	w, err := s.newServerLayerWriter(dst, id)
+	if err != nil {
+		return 0, err
+	}
+	n, err := s.sealChunked(w, src, phrase, b)
+	if err != nil {
+		return n, err
+	}
+	return n, w.Close()
+}
+
+// sealChunked writes a chunked envelope as SealChunked does, without a
+// server layer
+func (s *Service) sealChunked(dst io.Writer, src io.Reader, phrase string, b Binding) (int64, error) {
+	h := &chunkedHeader{cipher: cmp.Or(s.ChunkCipher, s.Cipher), params: s.kdfParams(), chunkSize: ChunkSize, bound: b.AAD != nil, purpose: b.Purpose, pepper: s.pepperFor(b), wrapped: s.kmsFor(b)}
+	salt, err := s.newSalt(phrase)
+	if err != nil {
+		return 0, err
+	}
+	h.salt = salt
+	h.baseNonce = make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, h.baseNonce); err != nil {
+		return 0, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	key, err := s.chunkedKey(h, phrase)
+	if err != nil {
+		return 0, err
+	}
+	aead, err := newAEAD(h.cipher, key)
+	cryptoutil.Wipe(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create AEAD: %w", err)
+	}
+	if _, err := dst.Write(h.marshal(make([]byte, 0, h.size()))); err != nil {
+		return 0, err
+	}
+
+	// A chunk is only sealed once the next one has been read, since the last
+	// chunk is sealed differently and src's end isn't known before then. With
+	// ParallelChunks, a batch of chunks is read ahead and sealed at once.
+	workers := max(s.chunkWorkers, 1)
+	plain, sealed := make([][]byte, workers+1), make([][]byte, workers)
+	defer func() { cryptoutil.Wipe(plain...) }()
+	var lens []int // of the chunks read into plain
+	var total, first int64
+	ended := false
+	for {
+		for !ended && len(lens) <= workers {
+			k := len(lens)
+			if plain[k] == nil {
+				plain[k] = make([]byte, ChunkSize)
+			}
+			n, err := readChunk(src, plain[k])
+			if err != nil {
+				return total, err
+			}
+			if n == 0 && k > 0 {
+				ended = true
+				break
+			}
+			lens = append(lens, n)
+			ended = n < ChunkSize
+		}
+
+		batch := min(len(lens), workers)
+		final := ended && batch == len(lens)
+		forEachChunk(int64(batch), workers, func(j int64) error {
+			nonce, chunkAAD := chunkNonce(h.baseNonce, first+j, final && j == int64(batch-1), b.AAD)
+			sealed[j] = aead.Seal(sealed[j][:0], nonce, plain[j][:lens[j]], chunkAAD)
+			return nil
+		})
+		for j := range batch {
+			if _, err := dst.Write(sealed[j]); err != nil {
+				return total, err
+			}
+			total += int64(lens[j])
+		}
+		if final {
+			return total, nil
+		}
+		// the chunk read ahead starts the next batch
+		plain[0], plain[batch] = plain[batch], plain[0]
+		lens = append(lens[:0], lens[batch:]...)
+		first += int64(batch)
+	}
+}
+
+// readChunk fills buf from r, short only at the end of r
+func readChunk(r io.Reader, buf []byte) (int, error) {
+	n, err := io.ReadFull(r, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return n, nil
+	}
+	if err != nil {
+		return n, fmt.Errorf("failed to read data: %w", err)
+	}
+	return n, nil
+}
+
+// DecryptChunked decrypts a whole chunked envelope
+func (s *Service) DecryptChunked(encryptedData []byte, phrase string, b Binding) ([]byte, error) {
+	encryptedData, err := s.openServerLayer(encryptedData)
+	if err != nil {
+		return nil, err
+	}
+	r, err := s.OpenChunked(bytes.NewReader(encryptedData), int64(len(encryptedData)), phrase, b)
+	if err != nil {
+		return nil, err
+	}
+
+	// decrypt the chunks straight into a buffer of the exact size, so no
+	// copies of the plaintext are left behind
+	plain := make([]byte, r.Size())
+	if err := r.openAll(encryptedData, plain, s.chunkWorkers); err != nil {
+		cryptoutil.Wipe(plain)
+		return nil, err
+	}
+	return plain, nil
+}
+
+// OpenChunked returns a reader of the plaintext in the chunked envelope src,
+// which is size bytes long. Chunks are read and decrypted as they are needed,
+// so seeking and reading a range only touches the chunks it spans. b's subkey
+// and additional data are used if the envelope was written with them; older
+// ones carry neither.
+func (s *Service) OpenChunked(src io.ReadSeeker, size int64, phrase string, b Binding) (*ChunkedReader, error) {
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	magic := make([]byte, len(serverLayerMagic))
+	if _, err := io.ReadFull(src, magic); err == nil && bytes.Equal(magic, serverLayerMagic) {
+		layer, err := s.newServerLayerReader(src, size)
+		if err != nil {
+			return nil, err
+		}
+		src, size = layer, layer.Size()
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	h, headerSize, err := readChunkedHeader(io.LimitReader(src, size))
+	if err != nil {
+		return nil, err
+	}
+
+	body := size - headerSize
+	sealedSize := h.chunkSize + tagSize
+	chunks := (body + sealedSize - 1) / sealedSize
+	if body < tagSize || (body%sealedSize != 0 && body%sealedSize < tagSize) {
+		return nil, malformed("chunked envelope is truncated")
+	}
+
+	if h.purpose != "" && h.purpose != b.Purpose {
+		return nil, fmt.Errorf("%w: encrypted for %s, not %s", ErrCorruptCiphertext, h.purpose, b.Purpose)
+	}
+	if err := s.checkFIPS(h.cipher, h.params, h.salt); err != nil {
+		return nil, err
+	}
+	key, err := s.chunkedKey(h, phrase)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(h.cipher, key)
+	cryptoutil.Wipe(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AEAD: %w", err)
+	}
+	aad := b.AAD
+	if !h.bound {
+		aad = nil
+	}
+	return &ChunkedReader{
+		src:        src,
+		aead:       aead,
+		baseNonce:  h.baseNonce,
+		aad:        aad,
+		headerSize: headerSize,
+		chunkSize:  h.chunkSize,
+		chunks:     chunks,
+		cipherSize: size,
+		size:       body - chunks*tagSize,
+		cached:     -1,
+	}, nil
+}
+
+// chunkedKey derives the key of a chunked envelope
+func (s *Service) chunkedKey(h *chunkedHeader, phrase string) ([]byte, error) {
+	return s.fieldKey(h.params, phrase, h.salt, h.purpose, h.pepper, h.wrapped)
+}
+
+// chunkNonce returns the nonce and additional data sealing chunk i, ending
+// with the envelope's own additional data if any
+func chunkNonce(baseNonce []byte, i int64, last bool, bound []byte) ([]byte, []byte) {
+	nonce := make([]byte, len(baseNonce))
+	copy(nonce, baseNonce)
+	counter := binary.BigEndian.Uint64(nonce[len(nonce)-8:]) ^ uint64(i)
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], counter)
+
+	aad := binary.BigEndian.AppendUint64(nil, uint64(i))
+	if last {
+		aad = append(aad, 1)
+	} else {
+		aad = append(aad, 0)
+	}
+	return nonce, append(aad, bound...)
+}
+
+// ChunkedReader decrypts a chunked envelope on demand. It implements
+// io.ReadSeeker over the plaintext, as http.ServeContent needs for ranges.
+type ChunkedReader struct {
+	src        io.ReadSeeker
+	aead       cipher.AEAD
+	baseNonce  []byte
+	aad        []byte
+	headerSize int64
+	chunkSize  int64
+	chunks     int64
+	cipherSize int64
+	size       int64 // plaintext size
+
+	offset int64
+	cached int64 // index of the chunk in plain, or -1
+	plain  []byte
+}
+
+// Size returns the plaintext size
+func (r *ChunkedReader) Size() int64 {
+	return r.size
+}
+
+// Wipe zeroes the decrypted chunk the reader holds. Reading again decrypts
+// it anew.
+func (r *ChunkedReader) Wipe() {
+	cryptoutil.Wipe(r.plain)
+	r.cached = -1
+}
+
+// Read implements io.Reader
+func (r *ChunkedReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		// the last chunk authenticates the end of the data, so read it even
+		// when it is empty
+		if r.cached != r.chunks-1 {
+			if err := r.load(r.chunks - 1); err != nil {
+				return 0, err
+			}
+		}
+		return 0, io.EOF
+	}
+	i := r.offset / r.chunkSize
+	if i != r.cached {
+		if err := r.load(i); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plain[r.offset-i*r.chunkSize:])
+	r.offset += int64(n)
+	return n, nil
+}
+
+// Seek implements io.Seeker
+func (r *ChunkedReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// openAll decrypts every chunk of data, the whole envelope, into plain, which
+// must be Size bytes long, up to workers chunks at a time
+func (r *ChunkedReader) openAll(data, plain []byte, workers int) error {
+	sealedSize := r.chunkSize + tagSize
+	body := data[r.headerSize:]
+	return forEachChunk(r.chunks, workers, func(i int64) error {
+		sealed := body[i*sealedSize : min((i+1)*sealedSize, int64(len(body)))]
+		start := i * r.chunkSize
+		out := plain[start:start:min(start+r.chunkSize, r.size)]
+		nonce, aad := chunkNonce(r.baseNonce, i, i == r.chunks-1, r.aad)
+		if _, err := r.aead.Open(out, nonce, sealed, aad); err != nil {
+			// as in load
+			return ErrWrongPassphrase
+		}
+		return nil
+	})
+}
+
+// load reads and decrypts chunk i
+func (r *ChunkedReader) load(i int64) error {
+	start := r.headerSize + i*(r.chunkSize+tagSize)
+	sealed := make([]byte, min(r.chunkSize+tagSize, r.cipherSize-start))
+	if _, err := r.src.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(r.src, sealed); err != nil {
+		return fmt.Errorf("failed to read chunk %d: %w", i, err)
+	}
+
+	nonce, aad := chunkNonce(r.baseNonce, i, i == r.chunks-1, r.aad)
+	plain, err := r.aead.Open(r.plain[:0], nonce, sealed, aad)
+	if err != nil {
+		r.cached = -1
+		// like a wrong passphrase, whichever chunk it is: a later chunk
+		// failing would otherwise show the key was right
+		return ErrWrongPassphrase
+	}
+	r.plain, r.cached = plain, i
+	return nil
+}
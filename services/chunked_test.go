@@ -0,0 +1,340 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/ktappdev/secretnotes-go-backend/pkg/cryptobox"
+)
+
+func TestChunkedEnvelope(t *testing.T) {
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+
+	for _, name := range Ciphers {
+		svc := NewEncryptionService()
+		svc.Cipher = name
+
+		for _, size := range []int{0, 1, ChunkSize, ChunkSize + 1, 3*ChunkSize + 5} {
+			data := make([]byte, size)
+			rand.Read(data)
+
+			sealed, err := svc.EncryptChunked(data, phrase, Binding{})
+			if err != nil {
+				t.Fatalf("%s/%d: encrypt: %v", name, size, err)
+			}
+			got, err := svc.DecryptChunked(sealed, phrase, Binding{})
+			if err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("%s/%d: round trip failed: %v", name, size, err)
+			}
+			if _, err := svc.DecryptChunked(sealed, phrase+"x", Binding{}); !errors.Is(err, ErrDecryptionFailed) {
+				t.Fatalf("%s/%d: wrong passphrase gave %v", name, size, err)
+			}
+		}
+	}
+}
+
+func TestSealChunkedStream(t *testing.T) {
+	svc := NewEncryptionService()
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	b := FieldBinding("attachment_contents", "abc123", "data")
+
+	for _, size := range []int{0, ChunkSize - 1, ChunkSize, 2 * ChunkSize, 2*ChunkSize + 3} {
+		data := make([]byte, size)
+		rand.Read(data)
+
+		// reads of a byte or half a buffer at a time still give whole chunks
+		for name, src := range map[string]io.Reader{
+			"one byte": iotest.OneByteReader(bytes.NewReader(data)),
+			"half":     iotest.HalfReader(bytes.NewReader(data)),
+		} {
+			var out bytes.Buffer
+			n, err := svc.SealChunked(&out, src, phrase, b)
+			if err != nil || n != int64(size) {
+				t.Fatalf("%d/%s: sealed %d bytes, %v", size, name, n, err)
+			}
+			chunks := max((size+ChunkSize-1)/ChunkSize, 1)
+			if want := len(data) + chunks*tagSize; out.Len() <= want || out.Len() > want+128 {
+				t.Fatalf("%d/%s: unexpected envelope size %d", size, name, out.Len())
+			}
+			if got, err := svc.DecryptChunked(out.Bytes(), phrase, b); err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("%d/%s: round trip failed: %v", size, name, err)
+			}
+		}
+	}
+
+	failing := io.MultiReader(bytes.NewReader(make([]byte, ChunkSize+1)), iotest.ErrReader(errors.New("disk gone")))
+	if _, err := svc.SealChunked(io.Discard, failing, phrase, b); err == nil {
+		t.Fatal("expected a read error")
+	}
+}
+
+func TestChunkThreshold(t *testing.T) {
+	f := &FileService{}
+	small, large := int64(10), int64(100)
+	if f.chunks(large, "application/pdf") || !f.chunks(small, "audio/ogg") {
+		t.Fatal("without a threshold only audio should be chunked")
+	}
+	f.SetChunkThreshold(50)
+	if f.chunks(small, "application/pdf") || !f.chunks(large, "application/pdf") {
+		t.Fatal("expected only files over the threshold to be chunked")
+	}
+}
+
+func TestChunkedReaderRanges(t *testing.T) {
+	svc := NewEncryptionService()
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	data := make([]byte, 3*ChunkSize+100)
+	rand.Read(data)
+	sealed, err := svc.EncryptChunked(data, phrase, Binding{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := svc.OpenChunked(bytes.NewReader(sealed), int64(len(sealed)), phrase, Binding{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != int64(len(data)) {
+		t.Fatalf("expected size %d, got %d", len(data), r.Size())
+	}
+
+	// a range spanning a chunk boundary
+	start, length := int64(ChunkSize-10), int64(50)
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, length)
+	if _, err := io.ReadFull(r, got); err != nil || !bytes.Equal(got, data[start:start+length]) {
+		t.Fatalf("range read failed: %v", err)
+	}
+
+	// the tail, read from the end
+	if _, err := r.Seek(-100, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	tail, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(tail, data[len(data)-100:]) {
+		t.Fatalf("tail read failed: %v", err)
+	}
+
+	// wiping zeroes the decrypted chunk; later reads decrypt it again
+	held := r.plain
+	r.Wipe()
+	if !bytes.Equal(held, make([]byte, len(held))) {
+		t.Fatal("expected the decrypted chunk to be zeroed")
+	}
+	if _, err := r.Seek(-100, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if tail, err = io.ReadAll(r); err != nil || !bytes.Equal(tail, data[len(data)-100:]) {
+		t.Fatalf("read after wipe failed: %v", err)
+	}
+}
+
+func TestChunkedEnvelopeTampering(t *testing.T) {
+	svc := NewEncryptionService()
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	data := make([]byte, 2*ChunkSize+10)
+	sealed, err := svc.EncryptChunked(data, phrase, Binding{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := len(sealed) - (2*(ChunkSize+tagSize) + 10 + tagSize)
+
+	flipped := bytes.Clone(sealed)
+	flipped[header+ChunkSize+tagSize+5] ^= 1
+	if _, err := svc.DecryptChunked(flipped, phrase, Binding{}); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("flipped byte: expected ErrDecryptionFailed, got %v", err)
+	}
+
+	// dropping the last chunk leaves a chunk that wasn't sealed as the last
+	truncated := sealed[:header+2*(ChunkSize+tagSize)]
+	if _, err := svc.DecryptChunked(truncated, phrase, Binding{}); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("dropped chunk: expected ErrDecryptionFailed, got %v", err)
+	}
+
+	// swapping two full chunks
+	swapped := bytes.Clone(sealed)
+	first := sealed[header : header+ChunkSize+tagSize]
+	second := sealed[header+ChunkSize+tagSize : header+2*(ChunkSize+tagSize)]
+	copy(swapped[header:], second)
+	copy(swapped[header+ChunkSize+tagSize:], first)
+	if _, err := svc.DecryptChunked(swapped, phrase, Binding{}); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("swapped chunks: expected ErrDecryptionFailed, got %v", err)
+	}
+}
+
+func TestChunkedEnvelopeAAD(t *testing.T) {
+	svc := NewEncryptionService()
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	b := FieldBinding("attachment_contents", "abc123", "data")
+	data := make([]byte, ChunkSize+10)
+	sealed, err := svc.EncryptChunked(data, phrase, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(sealed, boundChunkedMagic) {
+		t.Fatalf("expected a bound envelope, got %q", sealed[:4])
+	}
+	if got, err := svc.DecryptChunked(sealed, phrase, b); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("round trip failed: %v", err)
+	}
+	if _, err := svc.DecryptChunked(sealed, phrase, FieldBinding("attachment_contents", "def456", "data")); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("another record's data: expected ErrDecryptionFailed, got %v", err)
+	}
+}
+
+func TestChunkCipher(t *testing.T) {
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	b := FieldBinding("attachment_contents", "abc123", "data")
+	svc, reader := NewEncryptionService(), NewEncryptionService()
+	svc.Cipher, svc.ChunkCipher = CipherAESGCM, CipherAESGCMSIV
+	data := make([]byte, 2*ChunkSize+3)
+	rand.Read(data)
+
+	sealed, err := svc.EncryptChunked(data, phrase, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _, err := readChunkedHeader(bytes.NewReader(sealed))
+	if err != nil || h.cipher != CipherAESGCMSIV {
+		t.Fatalf("expected an AES-GCM-SIV header, got %+v (%v)", h, err)
+	}
+	if got, err := reader.DecryptChunked(sealed, phrase, b); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("round trip failed: %v", err)
+	}
+	if _, err := reader.DecryptChunked(sealed, phrase+"x", b); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("wrong passphrase gave %v", err)
+	}
+
+	// everything else keeps the main cipher
+	field, err := svc.EncryptBound([]byte("hello"), phrase, FieldBinding("notes", "abc123", "message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env, err := parseEnvelope(field); err != nil || env.Cipher != CipherAESGCM {
+		t.Fatalf("expected an AES-GCM field, got %v", err)
+	}
+}
+
+func TestChunkedEnvelopeSettings(t *testing.T) {
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	svc, reader := NewEncryptionService(), NewEncryptionService()
+	svc.Iterations, svc.SaltSize = 20000, 24
+	data := make([]byte, ChunkSize+7)
+	rand.Read(data)
+
+	sealed, err := svc.EncryptChunked(data, phrase, Binding{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := reader.DecryptChunked(sealed, phrase, Binding{}); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("recorded settings: round trip failed: %v", err)
+	}
+
+	// an SNC1 envelope, which records neither the salt length nor the KDF cost
+	salt, baseNonce := make([]byte, legacySaltSize), make([]byte, nonceSize)
+	aead, err := newAEAD(CipherAESGCM, reader.deriveKey(cryptobox.LegacyKDFParams(KDFPBKDF2), phrase, salt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := append(append([]byte{}, v1ChunkedMagic...), algorithmID(chunkedCipherIDs, CipherAESGCM, KDFPBKDF2))
+	legacy = binary.BigEndian.AppendUint32(legacy, ChunkSize)
+	legacy = append(append(legacy, salt...), baseNonce...)
+	nonce, aad := chunkNonce(baseNonce, 0, true, nil)
+	legacy = aead.Seal(legacy, nonce, []byte("old chunks"), aad)
+	if got, err := svc.DecryptChunked(legacy, phrase, Binding{}); err != nil || string(got) != "old chunks" {
+		t.Fatalf("SNC1 envelope: got %q, %v", got, err)
+	}
+}
+
+func TestParallelChunks(t *testing.T) {
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	b := FieldBinding("attachment_contents", "abc123", "data")
+	serial, parallel := NewEncryptionService(), NewEncryptionService()
+	parallel.ParallelChunks(3)
+
+	// sizes around a batch of three chunks and the chunk read ahead
+	for _, size := range []int{0, 1, 2 * ChunkSize, 3 * ChunkSize, 3*ChunkSize + 1, 4 * ChunkSize, 7*ChunkSize + 9} {
+		data := make([]byte, size)
+		rand.Read(data)
+
+		for _, pair := range [][2]*Service{{parallel, serial}, {serial, parallel}, {parallel, parallel}} {
+			var out bytes.Buffer
+			n, err := pair[0].SealChunked(&out, iotest.HalfReader(bytes.NewReader(data)), phrase, b)
+			if err != nil || n != int64(size) {
+				t.Fatalf("%d: sealed %d bytes, %v", size, n, err)
+			}
+			if got, err := pair[1].DecryptChunked(out.Bytes(), phrase, b); err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("%d: round trip failed: %v", size, err)
+			}
+		}
+	}
+
+	sealed, err := parallel.EncryptChunked(make([]byte, 5*ChunkSize), phrase, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed[len(sealed)-3*(ChunkSize+tagSize)] ^= 1
+	if _, err := parallel.DecryptChunked(sealed, phrase, b); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("tampered chunk: expected ErrWrongPassphrase, got %v", err)
+	}
+	// dropping the last chunk leaves one that wasn't sealed as the last
+	if _, err := parallel.DecryptChunked(sealed[:len(sealed)-(ChunkSize+tagSize)], phrase, b); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("dropped chunk: expected ErrDecryptionFailed, got %v", err)
+	}
+}
+
+// benchmarkChunkWorkers runs fn on an 8 MB attachment, with chunks processed
+// one after another and then several at a time
+func benchmarkChunkWorkers(b *testing.B, fn func(svc *Service, data []byte, phrase string) error) {
+	data := make([]byte, 8<<20)
+	rand.Read(data)
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			svc := NewEncryptionService()
+			svc.ParallelChunks(workers)
+			// a scope derives the key once, keeping the KDF out of the timings
+			end := svc.Scope(phrase)
+			defer end()
+			if err := fn(svc, data, phrase); err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+			for range b.N {
+				if err := fn(svc, data, phrase); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSealChunked(b *testing.B) {
+	benchmarkChunkWorkers(b, func(svc *Service, data []byte, phrase string) error {
+		_, err := svc.SealChunked(io.Discard, bytes.NewReader(data), phrase, Binding{})
+		return err
+	})
+}
+
+func BenchmarkDecryptChunked(b *testing.B) {
+	data := make([]byte, 8<<20)
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	sealed, err := NewEncryptionService().EncryptChunked(data, phrase, Binding{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkChunkWorkers(b, func(svc *Service, _ []byte, phrase string) error {
+		_, err := svc.DecryptChunked(sealed, phrase, Binding{})
+		return err
+	})
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/ktappdev/secretnotes-go-backend/cryptoutil"
+	"github.com/ktappdev/secretnotes-go-backend/pkg/cryptobox"
+)
+
+// maxCompressedSize bounds the uncompressed size a compressed envelope may
+// record, so a crafted one can't make the server allocate without limit
+const maxCompressedSize = cryptobox.MaxCompressedSize
+
+// zstd codecs are safe for concurrent EncodeAll and DecodeAll calls, so one of
+// each serves every request
+var (
+	zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			panic(err)
+		}
+		return enc
+	})
+	zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+		dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(maxCompressedSize))
+		if err != nil {
+			panic(err)
+		}
+		return dec
+	})
+)
+
+// CompressMessages has note messages of at least minSize bytes compressed
+// with zstd before they are encrypted, when that makes them smaller. The
+// compressed length shows how repetitive a note is, and if someone can both
+// add text to a note and watch its stored size, how much that text has in
+// common with the rest: leave it off where that matters. minSize 0 turns
+// compression off, the default. Compressed messages always decrypt.
+func (s *Service) CompressMessages(minSize int) {
+	s.compressMin = max(minSize, 0)
+}
+
+// compress returns data compressed for an envelope bound by b, or nil when it
+// is to be sealed as it is
+func (s *Service) compress(data []byte, b Binding) []byte {
+	if s.compressMin == 0 || b.Purpose != PurposeMessage || len(data) < s.compressMin || len(data) > maxCompressedSize {
+		return nil
+	}
+	compressed := zstdEncoder().EncodeAll(data, make([]byte, 0, len(data)))
+	if len(compressed) >= len(data) {
+		cryptoutil.Wipe(compressed)
+		return nil
+	}
+	return compressed
+}
+
+// decompress returns the plaintext of a compressed envelope, which must be
+// size bytes long
+func decompress(compressed []byte, size uint32) ([]byte, error) {
+	plain, err := zstdDecoder().DecodeAll(compressed, make([]byte, 0, size))
+	if err != nil || len(plain) != int(size) {
+		cryptoutil.Wipe(plain)
+		return nil, fmt.Errorf("%w: compressed data is corrupt", ErrCorruptCiphertext)
+	}
+	return plain, nil
+}
+
+// compressedAAD returns aad extended with the compression flag and size, so
+// neither can be changed in the header without failing authentication
+func compressedAAD(aad []byte, size uint32) []byte {
+	out := append(append([]byte(nil), aad...), "\x00zstd"...)
+	return binary.BigEndian.AppendUint32(out, size)
+}
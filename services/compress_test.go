@@ -0,0 +1,71 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ktappdev/secretnotes-go-backend/pkg/cryptobox"
+)
+
+func TestCompressMessages(t *testing.T) {
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	message := FieldBinding("notes", "abc123", "message")
+	note := []byte(strings.Repeat("a note that repeats itself. ", 400))
+
+	plain := NewEncryptionService()
+	uncompressed, _ := plain.EncryptBound(note, phrase, message)
+
+	svc := NewEncryptionService()
+	svc.CompressMessages(1024)
+	sealed, err := svc.EncryptBound(note, phrase, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := parseEnvelope(sealed)
+	if err != nil || !env.Compressed || env.Size != uint32(len(note)) {
+		t.Fatalf("expected a compressed envelope, got %+v, %v", env, err)
+	}
+	if len(sealed) >= len(uncompressed)/4 {
+		t.Fatalf("expected compression to shrink %d bytes, got %d", len(uncompressed), len(sealed))
+	}
+	if svc.PlaintextSize(sealed) != len(note) {
+		t.Fatalf("expected the uncompressed size, got %d", svc.PlaintextSize(sealed))
+	}
+	// any server decrypts it, compressing or not
+	if got, err := plain.DecryptBound(sealed, phrase, message); err != nil || !bytes.Equal(got, note) {
+		t.Fatalf("decrypt failed: %v", err)
+	}
+
+	// small notes, other fields and incompressible data stay as they are
+	random := make([]byte, 4096)
+	rand.Read(random)
+	for name, tc := range map[string]struct {
+		data []byte
+		b    Binding
+	}{
+		"short note": {[]byte("short"), message},
+		"title":      {note, FieldBinding("notes", "abc123", "title")},
+		"archive":    {note, Binding{}},
+		"random":     {random, message},
+	} {
+		sealed, _ := svc.EncryptBound(tc.data, phrase, tc.b)
+		if env, _ := parseEnvelope(sealed); env.Compressed {
+			t.Fatalf("%s: expected no compression", name)
+		}
+	}
+
+	// the flag and size are authenticated
+	for _, tamper := range []func([]byte){
+		func(b []byte) { b[4] &^= cryptobox.CompressedFlag },
+		func(b []byte) { b[len(b)-len(env.Sealed)-nonceSize-1]-- },
+	} {
+		tampered := append([]byte(nil), sealed...)
+		tamper(tampered)
+		if _, err := svc.DecryptBound(tampered, phrase, message); !errors.Is(err, ErrDecryptionFailed) {
+			t.Fatalf("expected a tampered header to fail, got %v", err)
+		}
+	}
+}
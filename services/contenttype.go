@@ -0,0 +1,57 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/cryptoutil"
+)
+
+// encryptContentType encrypts an attachment's content type for the
+// content_type field, base64 encoded like the filename, so the database
+// doesn't reveal what kind of files a passphrase holds
+func (f *FileService) encryptContentType(rec *core.Record, contentType, phrase string) (string, error) {
+	encrypted, err := f.Encryption.EncryptBound([]byte(contentType), phrase, recordBinding(rec, "content_type"))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt content type: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// decryptContentType returns a record's content type. Records stored before
+// content types were encrypted hold it in plaintext; those are encrypted in
+// place on first read, without touching the record's updated time (and so
+// its ETag).
+func (f *FileService) decryptContentType(app core.App, rec *core.Record, phrase string) (string, error) {
+	stored := rec.GetString("content_type")
+	if stored == "" {
+		return "", nil
+	}
+	// ciphertext is at least a salt, a nonce and a tag long; a short type like
+	// text/css can pass for base64, but not for that
+	encrypted, err := base64.StdEncoding.DecodeString(stored)
+	if err == nil && len(encrypted) > legacySaltSize+nonceSize+tagSize {
+		plain, err := f.Encryption.DecryptBound(encrypted, phrase, recordBinding(rec, "content_type"))
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt content type: %w", err)
+		}
+		defer cryptoutil.Wipe(plain)
+		return string(plain), nil
+	}
+	if _, _, err := mime.ParseMediaType(stored); err != nil {
+		return "", fmt.Errorf("failed to decrypt content type: %w", ErrCorruptCiphertext)
+	}
+
+	// legacy plaintext; a failed upgrade is retried on the next read
+	if sealed, err := f.encryptContentType(rec, stored, phrase); err == nil {
+		_, err = app.DB().Update("encrypted_files", dbx.Params{"content_type": sealed}, dbx.HashExp{"id": rec.Id}).Execute()
+		if err == nil {
+			rec.Set("content_type", sealed)
+		}
+	}
+	return stored, nil
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestContentTypeRoundTrip(t *testing.T) {
+	f := &FileService{Encryption: NewEncryptionService()}
+	collection := core.NewBaseCollection("encrypted_files")
+	collection.Fields.Add(&core.TextField{Name: "content_type"})
+	rec := core.NewRecord(collection)
+	rec.Id = "file1"
+
+	sealed, err := f.encryptContentType(rec, "audio/mp4", "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintextReason(sealed) != "" {
+		t.Fatalf("expected the stored value to read as ciphertext, got %q", sealed)
+	}
+	rec.Set("content_type", sealed)
+	if got, err := f.decryptContentType(nil, rec, "correct horse battery"); err != nil || got != "audio/mp4" {
+		t.Fatalf("expected audio/mp4, got %q (%v)", got, err)
+	}
+
+	// neither ciphertext for the phrase nor a legacy plaintext type
+	if _, err := f.decryptContentType(nil, rec, "another phrase"); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("expected ErrDecryptionFailed, got %v", err)
+	}
+
+	// the ciphertext is bound to its record
+	other := core.NewRecord(collection)
+	other.Id = "file2"
+	other.Set("content_type", sealed)
+	if _, err := f.decryptContentType(nil, other, "correct horse battery"); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("expected ErrDecryptionFailed for a copied value, got %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+
+	"github.com/ktappdev/secretnotes-go-backend/cryptoutil"
+)
+
+// Attachment data lives in attachment_contents, one record per passphrase and
+// distinct content, so the same file attached several times (an import of
+// duplicates, a re-upload) is encrypted and stored once. Each encrypted_files
+// record names its content record in "content"; the content record counts
+// those references in "refs" and is deleted with the last of them.
+
+// contentKeys identifies content for a passphrase: an HMAC keyed with a
+// secret derived from the passphrase (see Service.contentSecrets), so equal
+// files under different passphrases can't be matched up from the database.
+// Chunked and whole-file encryptions are kept apart. It returns one key per
+// secret, reading content once.
+func contentKeys(secrets [][]byte, content io.Reader, chunked bool) ([]string, error) {
+	macs := make([]hash.Hash, len(secrets))
+	writers := make([]io.Writer, len(secrets))
+	for i, secret := range secrets {
+		macs[i] = hmac.New(sha256.New, secret)
+		macs[i].Write([]byte("attachment-content\x00"))
+		if chunked {
+			macs[i].Write([]byte{1})
+		} else {
+			macs[i].Write([]byte{0})
+		}
+		writers[i] = macs[i]
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), content); err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	keys := make([]string, len(macs))
+	for i, mac := range macs {
+		keys[i] = hex.EncodeToString(mac.Sum(nil))
+	}
+	return keys, nil
+}
+
+// acquireContent returns the attachment_contents record holding content for
+// the phrase, with one more reference counted, encrypting and storing it
+// first when no attachment of the phrase has it yet. It returns the record id
+// and the hash of the stored ciphertext.
+func (f *FileService) acquireContent(app core.App, phrase string, content *io.SectionReader, chunked bool) (string, string, error) {
+	prepared, err := f.prepareContent(app, phrase, content, chunked)
+	if err != nil {
+		return "", "", err
+	}
+	defer prepared.cleanup()
+	return f.acquirePrepared(app, prepared)
+}
+
+// preparedContent is attachment content ready for acquirePrepared: its key
+// and, unless the phrase already had it stored, its sealed record
+type preparedContent struct {
+	phrase  string
+	content *io.SectionReader
+	chunked bool
+	key     string
+	rec     *core.Record // nil while the content was already stored
+	hash    string
+	cleanup func() // removes what sealing left on disk, once rec is saved
+}
+
+// prepareContent does the slow part of acquireContent, hashing and sealing
+// the content, which needs no transaction
+func (f *FileService) prepareContent(app core.App, phrase string, content *io.SectionReader, chunked bool) (*preparedContent, error) {
+	keys, err := contentKeys(f.Encryption.contentSecrets(phrase), reread(content), chunked)
+	if err != nil {
+		return nil, err
+	}
+	key := keys[0]
+	prepared := &preparedContent{phrase: phrase, content: content, chunked: chunked, key: key, cleanup: func() {}}
+	if _, err := app.FindFirstRecordByData("attachment_contents", "content_key", key); err == nil {
+		return prepared, nil
+	}
+	// content stored before the current pepper moves to its key; if another
+	// upload moved or stored it first, the update fails and one of those is used
+	for _, legacy := range keys[1:] {
+		res, err := app.DB().NewQuery("UPDATE attachment_contents SET content_key = {:key} WHERE content_key = {:legacy}").
+			Bind(dbx.Params{"key": key, "legacy": legacy}).
+			Execute()
+		if err != nil {
+			break
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			return prepared, nil
+		}
+	}
+	if err := f.sealPrepared(app, prepared); err != nil {
+		return nil, err
+	}
+	return prepared, nil
+}
+
+// sealPrepared encrypts prepared's content into a new attachment_contents record
+func (f *FileService) sealPrepared(app core.App, prepared *preparedContent) error {
+	collection, err := app.FindCachedCollectionByNameOrId("attachment_contents")
+	if err != nil {
+		return fmt.Errorf("attachment contents collection not found: %w", err)
+	}
+	rec := core.NewRecord(collection)
+	rec.Set("id:autogenerate", "") // the ciphertext is bound to the id
+	encFile, hash, cleanup, err := f.sealContent(prepared.content, prepared.phrase, prepared.chunked, recordBinding(rec, "data"), f.generateStorageFilename(prepared.key))
+	if err != nil {
+		return err
+	}
+
+	rec.Set("phrase_hash", f.hashPhrase(prepared.phrase))
+	rec.Set("content_key", prepared.key)
+	rec.Set("data", []*filesystem.File{encFile})
+	rec.Set("stored_size", encFile.Size)
+	rec.Set("hash", hash)
+	rec.Set("refs", 1)
+	prepared.rec, prepared.hash, prepared.cleanup = rec, hash, cleanup
+	return nil
+}
+
+// acquirePrepared references the content stored under prepared's key, or
+// saves prepared's sealed record when there is none
+func (f *FileService) acquirePrepared(app core.App, prepared *preparedContent) (string, string, error) {
+	if existing, err := app.FindFirstRecordByData("attachment_contents", "content_key", prepared.key); err == nil {
+		res, err := app.DB().NewQuery("UPDATE attachment_contents SET refs = refs + 1 WHERE id = {:id}").
+			Bind(dbx.Params{"id": existing.Id}).
+			Execute()
+		if err != nil {
+			return "", "", fmt.Errorf("failed to reference attachment content: %w", err)
+		}
+		// zero rows: the last reference was released in the meantime
+		if n, _ := res.RowsAffected(); n > 0 {
+			return existing.Id, existing.GetString("hash"), nil
+		}
+	}
+
+	if prepared.rec == nil {
+		// stored when prepared, but released since
+		if err := f.sealPrepared(app, prepared); err != nil {
+			return "", "", err
+		}
+	}
+	if err := app.Save(prepared.rec); err != nil {
+		return "", "", fmt.Errorf("failed to save attachment content: %w", err)
+	}
+	return prepared.rec.Id, prepared.hash, nil
+}
+
+// sealContent encrypts content into a file named name for a file field,
+// returning it with the hash of its ciphertext; cleanup removes what it left
+// on disk once the record is saved. Chunked content is sealed a chunk at a
+// time into a temporary file, so neither the file nor its ciphertext is held
+// in memory.
+func (f *FileService) sealContent(content *io.SectionReader, phrase string, chunked bool, b Binding, name string) (*filesystem.File, string, func(), error) {
+	if !chunked {
+		plain, err := io.ReadAll(reread(content))
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		encrypted, err := f.encryptContent(plain, phrase, false, b)
+		cryptoutil.Wipe(plain)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("failed to encrypt file: %w", err)
+		}
+		encFile, err := filesystem.NewFileFromBytes(encrypted, name)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("failed to create file from bytes: %w", err)
+		}
+		return encFile, f.hashBytes(encrypted), func() {}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "secretnotes-upload-")
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	path := filepath.Join(dir, name)
+	out, err := os.Create(path)
+	if err != nil {
+		cleanup()
+		return nil, "", nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	hash := sha256.New()
+	_, err = f.Encryption.SealChunked(io.MultiWriter(out, hash), reread(content), phrase, b)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return nil, "", nil, fmt.Errorf("failed to encrypt file: %w", err)
+	}
+	encFile, err := filesystem.NewFileFromPath(path)
+	if err != nil {
+		cleanup()
+		return nil, "", nil, fmt.Errorf("failed to create file from path: %w", err)
+	}
+	return encFile, hex.EncodeToString(hash.Sum(nil)), cleanup, nil
+}
+
+// ReleaseContent drops one reference to the attachment_contents record id,
+// deleting it and its stored data when none are left
+func (f *FileService) ReleaseContent(app core.App, id string) error {
+	return app.RunInTransaction(func(txApp core.App) error {
+		_, err := txApp.DB().NewQuery("UPDATE attachment_contents SET refs = refs - 1 WHERE id = {:id}").
+			Bind(dbx.Params{"id": id}).
+			Execute()
+		if err != nil {
+			return fmt.Errorf("failed to release attachment content: %w", err)
+		}
+		rec, err := txApp.FindRecordById("attachment_contents", id)
+		if err != nil {
+			return nil // already gone
+		}
+		if rec.GetInt("refs") > 0 {
+			return nil
+		}
+		if err := txApp.Delete(rec); err != nil {
+			return fmt.Errorf("failed to delete attachment content: %w", err)
+		}
+		return nil
+	})
+}
+
+// contentRecord returns the attachment_contents record an attachment's data is
+// stored in, or nil for attachments that keep it in their own file_data field
+func contentRecord(app core.App, rec *core.Record) (*core.Record, error) {
+	id := rec.GetString("content")
+	if id == "" {
+		return nil, nil
+	}
+	content, err := app.FindRecordById("attachment_contents", id)
+	if err != nil {
+		return nil, fmt.Errorf("attachment content %s is missing: %w", id, err)
+	}
+	return content, nil
+}
+
+// contentBinding returns the Binding an attachment's data is sealed with:
+// that of its content record's data, or of its own file_data for attachments
+// stored before deduplication
+func contentBinding(rec *core.Record) Binding {
+	if id := rec.GetString("content"); id != "" {
+		return FieldBinding("attachment_contents", id, "data")
+	}
+	return recordBinding(rec, "file_data")
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestContentKey(t *testing.T) {
+	contentKey := func(phrase string, content []byte, chunked bool) string {
+		keys, err := contentKeys([][]byte{[]byte(phrase)}, strings.NewReader(string(content)), chunked)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return keys[0]
+	}
+	content := []byte("the same file")
+	key := contentKey("phrase one", content, false)
+	if key != contentKey("phrase one", content, false) {
+		t.Fatalf("expected equal content to get the same key")
+	}
+	for name, other := range map[string]string{
+		"other phrase":  contentKey("phrase two", content, false),
+		"other content": contentKey("phrase one", []byte("another file"), false),
+		"chunked":       contentKey("phrase one", content, true),
+	} {
+		if other == key {
+			t.Errorf("%s: expected a different key", name)
+		}
+	}
+}
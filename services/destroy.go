@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// ErrDestroyInPast is returned when a scheduled deletion time has already passed
+var ErrDestroyInPast = errors.New("destruction time must be in the future")
+
+// DestroyAt returns a note record's scheduled deletion time, or nil when none is set
+func DestroyAt(record *core.Record) *time.Time {
+	return optionalTime(record.GetDateTime("destroy_at"))
+}
+
+// ScheduleDestruction sets the time at which the phrase's note and its
+// attachments are deleted; a zero time cancels a pending deletion.
+func (n *NoteService) ScheduleDestruction(phrase string, at time.Time) (*Note, error) {
+	if !at.IsZero() && !at.After(time.Now()) {
+		return nil, ErrDestroyInPast
+	}
+
+	records, err := n.App.FindRecordsByFilter("notes", "phrase_hash = {:phrase_hash}", "", 1, 0, dbx.Params{"phrase_hash": n.hashPhrase(phrase)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notes: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, ErrNoteNotFound
+	}
+
+	record := records[0]
+	if at.IsZero() {
+		record.Set("destroy_at", "")
+	} else {
+		record.Set("destroy_at", at.UTC())
+	}
+	if err := n.App.Save(record); err != nil {
+		return nil, fmt.Errorf("failed to update note: %w", err)
+	}
+	return n.openNote(record, phrase), nil
+}
+
+// PurgeDestroyedNotes deletes every note (with its attachments) whose
+// scheduled deletion time has passed
+func (n *NoteService) PurgeDestroyedNotes() (int, error) {
+	now, err := types.ParseDateTime(time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	records, err := n.App.FindRecordsByFilter("notes", "destroy_at != '' && destroy_at <= {:now}", "", -1, 0, dbx.Params{"now": now.String()})
+	if err != nil {
+		return 0, fmt.Errorf("failed to query notes due for destruction: %w", err)
+	}
+
+	for _, record := range records {
+		if err := n.deleteNoteRecord(record); err != nil {
+			return 0, err
+		}
+	}
+	return len(records), nil
+}
+
+// destroyDue reports whether a note record's scheduled deletion time has
+// passed, so reads between purge runs don't serve it
+func destroyDue(record *core.Record) bool {
+	at := DestroyAt(record)
+	return at != nil && !at.After(time.Now())
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Digest event kinds recorded against a subscription
+const (
+	DigestEventChanged    = "changed"
+	DigestEventAttachment = "attachment"
+	DigestEventAccessed   = "accessed"
+)
+
+// Digest delivery modes
+const (
+	DigestModeImmediate = "immediate"
+	DigestModeDaily     = "daily"
+)
+
+// ErrSubscriptionNotFound is returned when the phrase has no digest subscription
+var ErrSubscriptionNotFound = errors.New("subscription not found")
+
+// Subscription describes a note's digest email subscription
+type Subscription struct {
+	Email    string     `json:"email"`
+	Mode     string     `json:"mode"`
+	LastSent *time.Time `json:"lastSent"` // nil until the first digest is sent
+}
+
+// DigestService sends content-free "your note changed / was accessed" emails.
+// Addresses are encrypted with a server-held key (not the passphrase) because
+// digests are sent from a background job where no passphrase is available.
+type DigestService struct {
+	App        *pocketbase.PocketBase
+	Encryption *Service
+	Key        string
+	From       mail.Address
+	Brand      string // service name used in digest emails
+}
+
+// NewDigestService creates a new digest service
+func NewDigestService(app *pocketbase.PocketBase, encryption *Service, key string, from mail.Address, brand string) *DigestService {
+	return &DigestService{
+		App:        app,
+		Encryption: encryption,
+		Key:        key,
+		From:       from,
+		Brand:      brand,
+	}
+}
+
+// Subscribe creates or replaces the digest subscription for the phrase's note
+func (d *DigestService) Subscribe(phrase, email, mode string) (*Subscription, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil {
+		return nil, fmt.Errorf("invalid email address")
+	}
+	if mode != DigestModeImmediate && mode != DigestModeDaily {
+		return nil, fmt.Errorf("mode must be %q or %q", DigestModeImmediate, DigestModeDaily)
+	}
+
+	phraseHash := d.hashPhrase(phrase)
+
+	notes, err := d.App.CountRecords("notes", dbx.HashExp{"phrase_hash": phraseHash})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notes: %w", err)
+	}
+	if notes == 0 {
+		return nil, ErrNoteNotFound
+	}
+
+	record, err := d.findSubscription(d.App, phraseHash)
+	if err != nil {
+		collection, err := d.App.FindCachedCollectionByNameOrId("note_subscriptions")
+		if err != nil {
+			return nil, fmt.Errorf("subscriptions collection not found: %w", err)
+		}
+		record = core.NewRecord(collection)
+		record.Set("id:autogenerate", "")
+		record.Set("phrase_hash", phraseHash)
+	}
+
+	// bound to the record, as every subscription shares the server key
+	encryptedEmail, err := d.Encryption.EncryptBound([]byte(addr.Address), d.Key, recordBinding(record, "email"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt email: %w", err)
+	}
+	record.Set("email", base64.StdEncoding.EncodeToString(encryptedEmail))
+	record.Set("mode", mode)
+
+	if err := d.App.Save(record); err != nil {
+		return nil, fmt.Errorf("failed to save subscription: %w", err)
+	}
+
+	return &Subscription{
+		Email:    addr.Address,
+		Mode:     mode,
+		LastSent: optionalTime(record.GetDateTime("last_sent")),
+	}, nil
+}
+
+// GetSubscription returns the phrase's digest subscription
+func (d *DigestService) GetSubscription(phrase string) (*Subscription, error) {
+	record, err := d.findSubscription(d.App, d.hashPhrase(phrase))
+	if err != nil {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	email, err := d.decryptEmail(record)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Subscription{
+		Email:    email,
+		Mode:     record.GetString("mode"),
+		LastSent: optionalTime(record.GetDateTime("last_sent")),
+	}, nil
+}
+
+// Unsubscribe removes the phrase's digest subscription
+func (d *DigestService) Unsubscribe(phrase string) error {
+	record, err := d.findSubscription(d.App, d.hashPhrase(phrase))
+	if err != nil {
+		return ErrSubscriptionNotFound
+	}
+	if err := d.App.Delete(record); err != nil {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+	return nil
+}
+
+// RecordEvent adds an event to the pending digest of the note identified by
+// phraseHash. Notes without a subscription are ignored. Errors are logged
+// rather than returned so notification bookkeeping never fails a request.
+func (d *DigestService) RecordEvent(app core.App, phraseHash, event string) {
+	record, err := d.findSubscription(app, phraseHash)
+	if err != nil {
+		return
+	}
+
+	pending := d.pending(record)
+	if len(pending) == 0 {
+		pending["since"] = time.Now().UTC().Format(time.RFC3339)
+	}
+	count, _ := pending[event].(float64)
+	pending[event] = count + 1
+	record.Set("pending", pending)
+
+	if err := app.Save(record); err != nil {
+		log.Printf("Warning: failed to record digest event: %v", err)
+	}
+}
+
+// MovePhrase re-points subscriptions after a note moved to a new phrase hash (rekey)
+func (d *DigestService) MovePhrase(app core.App, oldHash, newHash string) {
+	record, err := d.findSubscription(app, oldHash)
+	if err != nil {
+		return
+	}
+	record.Set("phrase_hash", newHash)
+	if err := app.Save(record); err != nil {
+		log.Printf("Warning: failed to move digest subscription: %v", err)
+	}
+}
+
+// DeleteForPhrase removes the subscription of a deleted note
+func (d *DigestService) DeleteForPhrase(app core.App, phraseHash string) {
+	record, err := d.findSubscription(app, phraseHash)
+	if err != nil {
+		return
+	}
+	if err := app.Delete(record); err != nil {
+		log.Printf("Warning: failed to delete digest subscription: %v", err)
+	}
+}
+
+// SendDue emails every subscription whose pending digest is due: immediate
+// subscriptions as soon as they have events, daily ones at most once a day.
+func (d *DigestService) SendDue() (int, error) {
+	records, err := d.App.FindAllRecords("note_subscriptions")
+	if err != nil {
+		return 0, fmt.Errorf("failed to query subscriptions: %w", err)
+	}
+
+	now := time.Now().UTC()
+	sent := 0
+	for _, record := range records {
+		pending := d.pending(record)
+		if len(pending) == 0 {
+			continue
+		}
+
+		if record.GetString("mode") == DigestModeDaily {
+			last := record.GetDateTime("last_sent").Time()
+			if last.IsZero() {
+				last = record.GetDateTime("created").Time()
+			}
+			if now.Sub(last) < 24*time.Hour {
+				continue
+			}
+		}
+
+		email, err := d.decryptEmail(record)
+		if err != nil {
+			log.Printf("Warning: skipping digest for subscription %s: %v", record.Id, err)
+			continue
+		}
+
+		message := &mailer.Message{
+			From:    d.From,
+			To:      []mail.Address{{Address: email}},
+			Subject: "Activity on your " + d.Brand + " note",
+			Text:    digestText(d.Brand, pending),
+		}
+		if err := d.App.NewMailClient().Send(message); err != nil {
+			log.Printf("Warning: failed to send digest for subscription %s: %v", record.Id, err)
+			continue
+		}
+
+		record.Set("pending", map[string]any{})
+		record.Set("last_sent", now)
+		if err := d.App.Save(record); err != nil {
+			log.Printf("Warning: failed to update subscription %s: %v", record.Id, err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// digestText renders the content-free digest body
+func digestText(brand string, pending map[string]any) string {
+	var b strings.Builder
+	b.WriteString("There has been activity on a " + brand + " note you subscribed to")
+	if since, ok := pending["since"].(string); ok {
+		b.WriteString(" since " + since)
+	}
+	b.WriteString(":\n\n")
+
+	lines := []struct{ key, label string }{
+		{DigestEventChanged, "Edited"},
+		{DigestEventAttachment, "Attachment uploaded"},
+		{DigestEventAccessed, "Opened"},
+	}
+	for _, line := range lines {
+		if count, ok := pending[line.key].(float64); ok && count > 0 {
+			fmt.Fprintf(&b, "- %s: %d time(s)\n", line.label, int(count))
+		}
+	}
+
+	b.WriteString("\nIf this wasn't you, someone else knows your passphrase. Consider moving the note to a new passphrase.\n")
+	return b.String()
+}
+
+func (d *DigestService) findSubscription(app core.App, phraseHash string) (*core.Record, error) {
+	return app.FindFirstRecordByData("note_subscriptions", "phrase_hash", phraseHash)
+}
+
+func (d *DigestService) decryptEmail(record *core.Record) (string, error) {
+	encryptedEmail, err := base64.StdEncoding.DecodeString(record.GetString("email"))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode email: %w", err)
+	}
+	email, err := d.Encryption.DecryptBound(encryptedEmail, d.Key, recordBinding(record, "email"))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt email: %w", err)
+	}
+	return string(email), nil
+}
+
+func (d *DigestService) pending(record *core.Record) map[string]any {
+	pending := map[string]any{}
+	if raw := record.GetString("pending"); raw != "" && raw != "null" {
+		_ = json.Unmarshal([]byte(raw), &pending)
+	}
+	return pending
+}
+
+// hashPhrase returns the hash the phrase's records are stored and looked up
+// under (see Service.PhraseHash)
+func (d *DigestService) hashPhrase(phrase string) string {
+	return d.Encryption.PhraseHash(phrase)
+}
+
+// optionalTime returns nil for an unset date field
+func optionalTime(dt types.DateTime) *time.Time {
+	if dt.IsZero() {
+		return nil
+	}
+	t := Timestamp(dt)
+	return &t
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Content-Disposition types a download can be sent with
+const (
+	DispositionAttachment = "attachment" // save as a file (the default)
+	DispositionInline     = "inline"     // render in the browser
+)
+
+// ParseDisposition validates a ?disposition= value; empty means attachment
+func ParseDisposition(value string) (string, error) {
+	switch strings.ToLower(value) {
+	case "", DispositionAttachment:
+		return DispositionAttachment, nil
+	case DispositionInline:
+		return DispositionInline, nil
+	default:
+		return "", fmt.Errorf("disposition must be %q or %q", DispositionInline, DispositionAttachment)
+	}
+}
+
+// ContentDisposition formats a Content-Disposition header for filename.
+// filename="..." carries an ASCII approximation that old clients can use,
+// with quotes, backslashes, control and non-ASCII characters replaced by
+// underscores; when that differs from the real name, filename* carries it
+// exactly, percent-encoded as UTF-8 per RFC 5987.
+func ContentDisposition(disposition, filename string) string {
+	if filename == "" {
+		return disposition
+	}
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
+
+	header := disposition + `; filename="` + fallback + `"`
+	if fallback != filename {
+		header += "; filename*=UTF-8''" + encodeExtValue(filename)
+	}
+	return header
+}
+
+// encodeExtValue percent-encodes s for an RFC 5987 ext-value, leaving only
+// attr-char unescaped
+func encodeExtValue(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0f])
+	}
+	return b.String()
+}
+
+func isAttrChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"mime"
+	"testing"
+)
+
+func TestContentDisposition(t *testing.T) {
+	for _, tc := range []struct {
+		disposition, filename, want string
+	}{
+		{DispositionAttachment, "photo.jpg", `attachment; filename="photo.jpg"`},
+		{DispositionInline, "my photo.jpg", `inline; filename="my photo.jpg"`},
+		{DispositionInline, `say "hi".txt`, `inline; filename="say _hi_.txt"; filename*=UTF-8''say%20%22hi%22.txt`},
+		{DispositionAttachment, "résumé.pdf", `attachment; filename="r_sum_.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9.pdf`},
+		{DispositionAttachment, "a\r\nb", `attachment; filename="a__b"; filename*=UTF-8''a%0D%0Ab`},
+		{DispositionInline, "", "inline"},
+	} {
+		if got := ContentDisposition(tc.disposition, tc.filename); got != tc.want {
+			t.Errorf("%q: got %s, want %s", tc.filename, got, tc.want)
+		}
+	}
+
+	// the standard library reads the exact name back from filename*
+	_, params, err := mime.ParseMediaType(ContentDisposition(DispositionInline, "日記 2024.png"))
+	if err != nil || params["filename"] != "日記 2024.png" {
+		t.Fatalf("got %q (%v)", params["filename"], err)
+	}
+}
+
+func TestParseDisposition(t *testing.T) {
+	for value, want := range map[string]string{"": DispositionAttachment, "attachment": DispositionAttachment, "Inline": DispositionInline} {
+		if got, err := ParseDisposition(value); err != nil || got != want {
+			t.Errorf("%q: got %q (%v)", value, got, err)
+		}
+	}
+	if _, err := ParseDisposition("download"); err == nil {
+		t.Fatalf("expected an error for an unknown disposition")
+	}
+}
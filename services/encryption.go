@@ -1,135 +1,417 @@
 package services
 
 import (
-	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
-	"crypto/sha256"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"runtime"
+	"sync"
 
-	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/sys/cpu"
+
+	"github.com/ktappdev/secretnotes-go-backend/cryptoutil"
+	"github.com/ktappdev/secretnotes-go-backend/pkg/cryptobox"
+)
+
+// ErrDecryptionFailed is returned when ciphertext is malformed or does not
+// authenticate under the given passphrase. ErrWrongPassphrase and
+// ErrCorruptCiphertext tell the two apart, and both match it.
+var ErrDecryptionFailed = cryptobox.ErrDecryptionFailed
+
+// ErrWrongPassphrase is matched when well-formed ciphertext doesn't
+// authenticate, which is also what tampered ciphertext looks like
+var ErrWrongPassphrase = cryptobox.ErrWrongPassphrase
+
+// ErrCorruptCiphertext is matched when ciphertext is malformed, or stored
+// where it wasn't written, so no passphrase would open it. *EnvelopeError
+// matches it too.
+var ErrCorruptCiphertext = cryptobox.ErrCorruptCiphertext
+
+// Ciphers EncryptData can write, and AES-GCM-SIV, which only chunked envelopes
+// are written with (see Service.ChunkCipher). All are always readable.
+const (
+	CipherAESGCM           = cryptobox.CipherAESGCM
+	CipherChaCha20Poly1305 = cryptobox.CipherChaCha20Poly1305
+	CipherAESGCMSIV        = cryptobox.CipherAESGCMSIV
+)
+
+// Ciphers lists the supported ciphers, AES-GCM first
+var Ciphers = cryptobox.Ciphers
+
+// Key derivation functions EncryptData can use. Both are always readable.
+const (
+	KDFPBKDF2 = cryptobox.KDFPBKDF2
+	KDFScrypt = cryptobox.KDFScrypt
+)
+
+// KDFs lists the supported key derivation functions, PBKDF2 first
+var KDFs = cryptobox.KDFs
+
+// DefaultPBKDF2Iterations is the PBKDF2 cost of new encryptions unless
+// configured otherwise, and the cost of all envelopes that don't record one
+const DefaultPBKDF2Iterations = cryptobox.DefaultPBKDF2Iterations
+
+// Limits on the costs and salt lengths an envelope may ask for
+const (
+	MaxPBKDF2Iterations = cryptobox.MaxPBKDF2Iterations
+	MinSaltSize         = cryptobox.MinSaltSize
+	MaxSaltSize         = cryptobox.MaxSaltSize
+)
+
+const (
+	nonceSize      = cryptobox.NonceSize
+	tagSize        = cryptobox.TagSize
+	legacySaltSize = cryptobox.LegacySaltSize
 )
 
 // Service provides encryption and decryption functionality
 type Service struct {
-	SaltSize int
-	KeySize  int
+	SaltSize    int    // salt length of new encryptions, MinSaltSize to MaxSaltSize
+	KeySize     int    // fixed by the ciphers, which all take 256-bit keys
+	Cipher      string // cipher for new encryptions, AES-GCM or ChaCha20-Poly1305
+	ChunkCipher string // cipher for new chunked envelopes, one of Ciphers; "" for Cipher
+	KDF         string // key derivation for new encryptions, one of KDFs
+	Iterations  int    // PBKDF2 iteration count of new encryptions
+
+	kdfSlots chan struct{}   // nil unless LimitKDF was called
+	keys     *keyCache       // nil unless CacheKeys was called
+	peppers  map[byte][]byte // by id; see SetPeppers
+	pepperID byte            // pepper of new stored fields, 0 for none
+	kms      *kmsKeys        // nil unless UseKMS was called
+	fips     bool            // see RequireFIPS
+
+	layerKeys  map[byte]cipher.AEAD // server layer keys by id; see SetServerLayerKeys
+	layerKeyID byte                 // server layer key of new stored fields, 0 for none
+
+	compressMin  int // see CompressMessages
+	chunkWorkers int // see ParallelChunks
+
+	scopeMu sync.Mutex
+	scopes  map[string]*keyScope // open key scopes by passphrase
 }
 
-// NewEncryptionService creates a new encryption service
+// NewEncryptionService creates a new encryption service that encrypts with
+// DefaultCipher and derives keys with PBKDF2
 func NewEncryptionService() *Service {
 	return &Service{
-		SaltSize: 16, // 128 bits
-		KeySize:  32, // 256 bits
+		SaltSize:   16, // 128 bits
+		KeySize:    cryptobox.KeySize,
+		Cipher:     DefaultCipher(),
+		KDF:        KDFPBKDF2,
+		Iterations: DefaultPBKDF2Iterations,
 	}
 }
 
-// DeriveKey derives a key from a passphrase using PBKDF2
+// HasAESHardware reports whether this CPU has AES and carry-less multiply
+// instructions, without which AES-GCM is several times slower than
+// ChaCha20-Poly1305 (typical for Raspberry Pi class ARM boards)
+func HasAESHardware() bool {
+	switch runtime.GOARCH {
+	case "amd64", "386":
+		return cpu.X86.HasAES && cpu.X86.HasPCLMULQDQ
+	case "arm64":
+		return cpu.ARM64.HasAES && cpu.ARM64.HasPMULL
+	case "s390x":
+		return cpu.S390X.HasAES && cpu.S390X.HasAESGCM
+	case "ppc64", "ppc64le":
+		return true
+	}
+	return false
+}
+
+// DefaultCipher is AES-256-GCM on CPUs with AES hardware and
+// ChaCha20-Poly1305 elsewhere
+func DefaultCipher() string {
+	if HasAESHardware() {
+		return CipherAESGCM
+	}
+	return CipherChaCha20Poly1305
+}
+
+// LimitKDF lets at most n key derivations run at once; further callers wait
+// for a free slot. It must be called before the service is used.
+func (s *Service) LimitKDF(n int) {
+	if n > 0 {
+		s.kdfSlots = make(chan struct{}, n)
+	}
+}
+
+// DeriveKey derives a key from a passphrase with the service's KDF
 func (s *Service) DeriveKey(phrase string, salt []byte) []byte {
-	return pbkdf2.Key([]byte(phrase), salt, 10000, s.KeySize, sha256.New)
+	return s.deriveKey(s.kdfParams(), phrase, salt)
+}
+
+// kdfParams returns the KDF and costs new encryptions use
+func (s *Service) kdfParams() cryptobox.KDFParams {
+	if s.KDF == KDFScrypt {
+		return cryptobox.LegacyKDFParams(KDFScrypt)
+	}
+	return cryptobox.KDFParams{KDF: KDFPBKDF2, Iterations: uint32(s.Iterations)}
+}
+
+// deriveKey derives a key from a passphrase with a KDF and its costs, or
+// takes it from the passphrase's key scope or the key cache
+func (s *Service) deriveKey(params cryptobox.KDFParams, phrase string, salt []byte) []byte {
+	if sc := s.scope(phrase); sc != nil {
+		return sc.derive(params, salt, func() []byte { return s.cachedKey(params, phrase, salt) })
+	}
+	return s.cachedKey(params, phrase, salt)
+}
+
+// cachedKey derives a key from a passphrase with a KDF and its costs, or
+// takes it from the key cache
+func (s *Service) cachedKey(params cryptobox.KDFParams, phrase string, salt []byte) []byte {
+	if s.keys == nil {
+		return s.runKDF(params, phrase, salt)
+	}
+	id := s.keys.id(params, phrase, salt)
+	if key := s.keys.get(id); key != nil {
+		return key
+	}
+	key := s.runKDF(params, phrase, salt)
+	s.keys.put(id, key)
+	return key
 }
 
-// EncryptData encrypts data using AES-256-GCM
+// runKDF derives a key from a passphrase with a KDF and its costs
+func (s *Service) runKDF(params cryptobox.KDFParams, phrase string, salt []byte) []byte {
+	if s.kdfSlots != nil {
+		s.kdfSlots <- struct{}{}
+		defer func() { <-s.kdfSlots }()
+	}
+	return params.DeriveKey(phrase, salt)
+}
+
+// newAEAD returns the AEAD for a cipher name
+func newAEAD(name string, key []byte) (cipher.AEAD, error) {
+	return cryptobox.NewAEAD(name, key)
+}
+
+// EncryptData encrypts data with the service's cipher (AES-256-GCM unless set
+// otherwise) and KDF into a version 1 envelope
 func (s *Service) EncryptData(data []byte, phrase string) ([]byte, error) {
-	// Generate random salt
-	salt := make([]byte, s.SaltSize)
-	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
-		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	return s.EncryptBound(data, phrase, Binding{})
+}
+
+// EncryptBound is EncryptData for data stored where b says, usually a
+// FieldBinding: it is encrypted with the subkey for b's purpose and
+// authenticates b's additional data, in a version 3 envelope that only
+// DecryptBound with the same binding opens
+func (s *Service) EncryptBound(data []byte, phrase string, b Binding) ([]byte, error) {
+	// Generate random salt, or take the key scope's
+	salt, err := s.newSalt(phrase)
+	if err != nil {
+		return nil, err
 	}
 
 	// Derive key from phrase
-	key := s.DeriveKey(phrase, salt)
-
-	// Create AES cipher
-	block, err := aes.NewCipher(key)
+	params, pepper, wrapped := s.kdfParams(), s.pepperFor(b), s.kmsFor(b)
+	key, err := s.fieldKey(params, phrase, salt, b.Purpose, pepper, wrapped)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
+		return nil, err
 	}
+	defer cryptoutil.Wipe(key)
 
-	// Use GCM mode
-	gcm, err := cipher.NewGCM(block)
+	aead, err := newAEAD(s.Cipher, key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return nil, fmt.Errorf("failed to create AEAD: %w", err)
 	}
 
 	// Generate nonce
-	nonce := make([]byte, gcm.NonceSize())
+	nonce := make([]byte, aead.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return nil, fmt.Errorf("failed to generate nonce: %w", err)
 	}
 
-	// Encrypt data
-	encrypted := gcm.Seal(nil, nonce, data, nil)
-
-	// Combine salt + nonce + encrypted data
-	result := make([]byte, 0, len(salt)+len(nonce)+len(encrypted))
-	result = append(result, salt...)
-	result = append(result, nonce...)
-	result = append(result, encrypted...)
-
-	return result, nil
+	// Encrypt data, compressed first if it is a note message worth compressing
+	env := &envelope{Envelope: cryptobox.Envelope{Cipher: s.Cipher, Params: params, Salt: salt, Nonce: nonce, Bound: b.AAD != nil, Pepper: pepper, WrappedKey: wrapped}, purpose: b.Purpose}
+	aad := b.AAD
+	if compressed := s.compress(data, b); compressed != nil {
+		defer cryptoutil.Wipe(compressed)
+		env.Compressed, env.Size = true, uint32(len(data))
+		data, aad = compressed, compressedAAD(aad, env.Size)
+	}
+	env.Sealed = aead.Seal(nil, nonce, data, aad)
+	if id := s.serverLayerFor(b); id != 0 {
+		return s.sealServerLayer(env.marshal(), id)
+	}
+	return env.marshal(), nil
 }
 
-// DecryptData decrypts data using AES-256-GCM
+// DecryptData decrypts data written by EncryptData with any supported format,
+// cipher and KDF. Malformed envelopes give an *EnvelopeError.
 func (s *Service) DecryptData(encryptedData []byte, phrase string) ([]byte, error) {
-	// Extract salt, nonce, and encrypted data
-	if len(encryptedData) < s.SaltSize+12 { // 12 is minimum nonce size
-		return nil, fmt.Errorf("encrypted data is too short")
+	return s.DecryptBound(encryptedData, phrase, Binding{})
+}
+
+// DecryptBound decrypts data written by EncryptBound with b. Envelopes from
+// before ciphertexts were bound to their fields, or encrypted with subkeys,
+// still open, so existing data stays readable until it is re-encrypted.
+func (s *Service) DecryptBound(encryptedData []byte, phrase string, b Binding) ([]byte, error) {
+	if HasServerLayer(encryptedData) {
+		inner, err := s.openServerLayer(encryptedData)
+		if err != nil {
+			// a headerless envelope whose salt happens to start like a
+			// server layer
+			if legacy, legacyErr := parseHeaderless(encryptedData); legacyErr == nil {
+				if decrypted, legacyErr := s.open(legacy, phrase, Binding{}); legacyErr == nil {
+					return decrypted, nil
+				}
+			}
+			return nil, err
+		}
+		encryptedData = inner
 	}
+	env, err := parseEnvelope(encryptedData)
+	if err == nil {
+		var decrypted []byte
+		if decrypted, err = s.open(env, phrase, b); err == nil {
+			return decrypted, nil
+		}
+	}
+	if cryptobox.HasHeader(encryptedData) {
+		// a headerless envelope whose salt happens to start with a header;
+		// the authentication tag tells the two apart
+		if legacy, legacyErr := parseHeaderless(encryptedData); legacyErr == nil {
+			if decrypted, legacyErr := s.open(legacy, phrase, Binding{}); legacyErr == nil {
+				return decrypted, nil
+			}
+		}
+	}
+	return nil, err
+}
 
-	// Extract components
-	salt := encryptedData[:s.SaltSize]
-	nonceStart := s.SaltSize
-	nonceEnd := nonceStart + 12 // GCM nonce size is 12 bytes
-	encryptedStart := nonceEnd
+// PlaintextSize returns the length of the data sealed in an EncryptData
+// envelope, without decrypting it, or 0 for a malformed one
+func (s *Service) PlaintextSize(encryptedData []byte) int {
+	if HasServerLayer(encryptedData) {
+		inner, err := s.openServerLayer(encryptedData)
+		if err != nil {
+			return 0
+		}
+		encryptedData = inner
+	}
+	env, err := parseEnvelope(encryptedData)
+	if err != nil {
+		return 0
+	}
+	if env.Compressed {
+		return int(env.Size)
+	}
+	return max(len(env.Sealed)-tagSize, 0)
+}
 
-	if len(encryptedData) <= encryptedStart {
-		return nil, fmt.Errorf("invalid encrypted data format")
+// Outdated reports whether an EncryptData envelope predates the current
+// format, isn't bound as b says, or was keyed with other KDF settings, salt
+// length or pepper than the service's, or with or without a KMS data key
+// when the service has the opposite, or is sealed in another server layer
+// than the service writes, so re-encrypting it would bring it up to date
+func (s *Service) Outdated(encryptedData []byte, b Binding) bool {
+	if s.serverLayerOutdated(encryptedData, b) {
+		return true
+	}
+	if HasServerLayer(encryptedData) {
+		inner, err := s.openServerLayer(encryptedData)
+		if err != nil {
+			return false
+		}
+		encryptedData = inner
 	}
+	env, err := parseEnvelope(encryptedData)
+	if err == nil && env.Version < envelopeVersion {
+		return true
+	}
+	return err == nil && (env.Params != s.kdfParams() || len(env.Salt) != s.SaltSize ||
+		env.Bound != (b.AAD != nil) || env.purpose != b.Purpose || env.Pepper != s.pepperFor(b) ||
+		(env.WrappedKey != nil) != (s.kmsFor(b) != nil))
+}
 
-	// Extract components
-	nonce := encryptedData[nonceStart:nonceEnd]
-	encrypted := encryptedData[encryptedStart:]
+// open decrypts a parsed envelope, with the subkey and additional data of b
+// if it was sealed with them
+func (s *Service) open(env *envelope, phrase string, b Binding) ([]byte, error) {
+	if env.purpose != "" && env.purpose != b.Purpose {
+		return nil, fmt.Errorf("%w: encrypted for %s, not %s", ErrCorruptCiphertext, env.purpose, b.Purpose)
+	}
+	if err := s.checkFIPS(env.Cipher, env.Params, env.Salt); err != nil {
+		return nil, err
+	}
 
 	// Derive key from phrase
-	key := s.DeriveKey(phrase, salt)
-
-	// Create AES cipher
-	block, err := aes.NewCipher(key)
+	key, err := s.fieldKey(env.Params, phrase, env.Salt, env.purpose, env.Pepper, env.WrappedKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
+		return nil, err
 	}
+	defer cryptoutil.Wipe(key)
 
-	// Use GCM mode
-	gcm, err := cipher.NewGCM(block)
+	aead, err := newAEAD(env.Cipher, key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return nil, fmt.Errorf("failed to create AEAD: %w", err)
 	}
 
 	// Decrypt data
-	decrypted, err := gcm.Open(nil, nonce, encrypted, nil)
+	aad := b.AAD
+	if !env.Bound {
+		aad = nil
+	}
+	if env.Compressed {
+		aad = compressedAAD(aad, env.Size)
+	}
+	decrypted, err := aead.Open(nil, env.Nonce, env.Sealed, aad)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+		return nil, ErrWrongPassphrase
+	}
+	if env.Compressed {
+		defer cryptoutil.Wipe(decrypted)
+		return decompress(decrypted, env.Size)
 	}
 
 	return decrypted, nil
 }
 
-// EncryptString encrypts a string and returns a base64 encoded string
+// EncryptString encrypts text and returns the envelope standard base64
+// encoded, as stored fields hold it
 func (s *Service) EncryptString(text string, phrase string) (string, error) {
-	encrypted, err := s.EncryptData([]byte(text), phrase)
+	return s.EncryptStringBound(text, phrase, Binding{})
+}
+
+// EncryptStringBound is EncryptString for a field bound by b, as in
+// EncryptBound
+func (s *Service) EncryptStringBound(text string, phrase string, b Binding) (string, error) {
+	encrypted, err := s.EncryptBound([]byte(text), phrase, b)
 	if err != nil {
 		return "", err
 	}
-	return string(encrypted), nil
+	return base64.StdEncoding.EncodeToString(encrypted), nil
 }
 
-// DecryptString decrypts a base64 encoded string and returns the original string
+// DecryptString decrypts a base64 encoded string from EncryptString and
+// returns the original string
 func (s *Service) DecryptString(encryptedText string, phrase string) (string, error) {
-	decrypted, err := s.DecryptData([]byte(encryptedText), phrase)
-	if err != nil {
+	return s.DecryptStringBound(encryptedText, phrase, Binding{})
+}
+
+// DecryptStringBound decrypts a base64 encoded string from EncryptStringBound
+// with b. EncryptString used to return the raw envelope bytes as a string;
+// those still decrypt.
+func (s *Service) DecryptStringBound(encryptedText string, phrase string, b Binding) (string, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(encryptedText)
+	if err == nil {
+		var decrypted []byte
+		if decrypted, err = s.DecryptBound(encrypted, phrase, b); err == nil {
+			defer cryptoutil.Wipe(decrypted)
+			return string(decrypted), nil
+		}
+	}
+	decrypted, rawErr := s.DecryptBound([]byte(encryptedText), phrase, b)
+	if rawErr != nil {
+		if err == nil || errors.As(err, new(base64.CorruptInputError)) {
+			err = rawErr
+		}
 		return "", err
 	}
+	defer cryptoutil.Wipe(decrypted)
 	return string(decrypted), nil
 }
@@ -1,7 +1,14 @@
 package services
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
 	"testing"
+
+	"github.com/ktappdev/secretnotes-go-backend/pkg/cryptobox"
 )
 
 func TestEncryptionService(t *testing.T) {
@@ -30,6 +37,41 @@ func TestEncryptionService(t *testing.T) {
 	}
 }
 
+func TestEncryptStringBase64(t *testing.T) {
+	svc := NewEncryptionService()
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+
+	encrypted, err := svc.EncryptString("hello", phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || !bytes.HasPrefix(raw, envelopeMagic) {
+		t.Fatalf("expected a base64 encoded envelope, got %q (%v)", encrypted, err)
+	}
+
+	// what EncryptString returned before it encoded its output
+	legacy, err := svc.EncryptData([]byte("old"), phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := svc.DecryptString(string(legacy), phrase); err != nil || plain != "old" {
+		t.Fatalf("raw envelope: got %q, %v", plain, err)
+	}
+
+	b := FieldBinding("notes", "abc123", "message")
+	bound, err := svc.EncryptStringBound("bound", phrase, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := svc.DecryptStringBound(bound, phrase, b); err != nil || plain != "bound" {
+		t.Fatalf("bound: got %q, %v", plain, err)
+	}
+	if _, err := svc.DecryptString(bound, phrase); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("bound without its binding: expected ErrDecryptionFailed, got %v", err)
+	}
+}
+
 func TestEncryptionServiceWithDifferentPhrases(t *testing.T) {
 	// Create a new encryption service
 	svc := NewEncryptionService()
@@ -51,3 +93,215 @@ func TestEncryptionServiceWithDifferentPhrases(t *testing.T) {
 		t.Error("Expected decryption to fail with different phrase, but it succeeded")
 	}
 }
+
+func TestEncryptionServiceLimitKDF(t *testing.T) {
+	svc := NewEncryptionService()
+	svc.LimitKDF(1)
+
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		go func() {
+			encrypted, err := svc.EncryptData([]byte("queued"), phrase)
+			if err == nil {
+				_, err = svc.DecryptData(encrypted, phrase)
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("round trip with a single KDF slot failed: %v", err)
+		}
+	}
+}
+
+func TestEncryptionServiceCiphers(t *testing.T) {
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	aesSvc, chachaSvc := NewEncryptionService(), NewEncryptionService()
+	aesSvc.Cipher, chachaSvc.Cipher = CipherAESGCM, CipherChaCha20Poly1305
+
+	sealedAES, err := aesSvc.EncryptData([]byte("aes"), phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealedChaCha, err := chachaSvc.EncryptData([]byte("chacha"), phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env, err := parseEnvelope(sealedChaCha); err != nil || env.Cipher != CipherChaCha20Poly1305 {
+		t.Fatalf("expected a chacha20-poly1305 envelope, got %+v, %v", env, err)
+	}
+
+	// either service reads both envelopes, whatever it writes itself
+	for _, svc := range []*Service{aesSvc, chachaSvc} {
+		if plain, err := svc.DecryptData(sealedAES, phrase); err != nil || string(plain) != "aes" {
+			t.Fatalf("%s: aes envelope: %q, %v", svc.Cipher, plain, err)
+		}
+		if plain, err := svc.DecryptData(sealedChaCha, phrase); err != nil || string(plain) != "chacha" {
+			t.Fatalf("%s: chacha envelope: %q, %v", svc.Cipher, plain, err)
+		}
+	}
+}
+
+func TestEncryptionServiceKDFs(t *testing.T) {
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	reader := NewEncryptionService() // PBKDF2, as servers are by default
+
+	for _, name := range Ciphers {
+		svc := NewEncryptionService()
+		svc.Cipher, svc.KDF = name, KDFScrypt
+
+		sealed, err := svc.EncryptData([]byte("scrypt"), phrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if env, err := parseEnvelope(sealed); err != nil || env.Cipher != name || env.Params != cryptobox.LegacyKDFParams(KDFScrypt) {
+			t.Fatalf("%s: expected an scrypt envelope, got %+v, %v", name, env, err)
+		}
+		if svc.PlaintextSize(sealed) != len("scrypt") {
+			t.Fatalf("%s: PlaintextSize = %d", name, svc.PlaintextSize(sealed))
+		}
+		// the KDF is read from the header, whatever the reader writes
+		if plain, err := reader.DecryptData(sealed, phrase); err != nil || string(plain) != "scrypt" {
+			t.Fatalf("%s: %q, %v", name, plain, err)
+		}
+
+		chunked, err := svc.EncryptChunked([]byte("scrypt chunks"), phrase, Binding{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plain, err := reader.DecryptChunked(chunked, phrase, Binding{}); err != nil || string(plain) != "scrypt chunks" {
+			t.Fatalf("%s: chunked: %q, %v", name, plain, err)
+		}
+	}
+}
+
+func TestPlaintextSize(t *testing.T) {
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	for _, name := range Ciphers {
+		svc := NewEncryptionService()
+		svc.Cipher = name
+		for _, data := range []string{"", "x", "a somewhat longer note"} {
+			sealed, err := svc.EncryptData([]byte(data), phrase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := svc.PlaintextSize(sealed); got != len(data) {
+				t.Errorf("%s: PlaintextSize = %d, want %d", name, got, len(data))
+			}
+		}
+	}
+}
+
+// TestDecryptLegacyEnvelopeLookingTagged checks that a headerless AES-GCM
+// envelope whose random salt starts with an envelope header still decrypts
+func TestDecryptLegacyEnvelopeLookingTagged(t *testing.T) {
+	svc := NewEncryptionService()
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+
+	for _, header := range [][]byte{
+		append(append([]byte{}, envelopeMagic...), envelopeVersion, cryptobox.CipherID(CipherAESGCM)),
+		append(append([]byte{}, v0EnvelopeMagic...), cryptobox.CipherID(CipherChaCha20Poly1305)),
+	} {
+		salt := append(header, bytes.Repeat([]byte{7}, svc.SaltSize-len(header))...)
+		block, err := aes.NewCipher(svc.DeriveKey(phrase, salt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonce := make([]byte, gcm.NonceSize())
+		envelope := append(append(salt, nonce...), gcm.Seal(nil, nonce, []byte("old"), nil)...)
+
+		if plain, err := svc.DecryptData(envelope, phrase); err != nil || string(plain) != "old" {
+			t.Fatalf("%q: expected the legacy fallback to decrypt, got %q, %v", header, plain, err)
+		}
+	}
+}
+
+func TestEncryptionServiceOutdated(t *testing.T) {
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	pbkdf2Svc, scryptSvc := NewEncryptionService(), NewEncryptionService()
+	scryptSvc.KDF = KDFScrypt
+
+	current, err := pbkdf2Svc.EncryptData([]byte("note"), phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pbkdf2Svc.Outdated(current, Binding{}) {
+		t.Fatalf("expected a fresh envelope to be current")
+	}
+	if !scryptSvc.Outdated(current, Binding{}) {
+		t.Fatalf("expected a PBKDF2 envelope to be outdated once scrypt is configured")
+	}
+
+	headerless := current[len(envelopeMagic)+5+4+1:] // salt | nonce | ciphertext
+	if !pbkdf2Svc.Outdated(headerless, Binding{}) {
+		t.Fatalf("expected a headerless envelope to be outdated")
+	}
+
+	weaker := &envelope{Envelope: cryptobox.Envelope{Cipher: CipherAESGCM, Params: cryptobox.KDFParams{KDF: KDFPBKDF2, Iterations: 1000}, Salt: make([]byte, 16), Nonce: make([]byte, nonceSize), Sealed: make([]byte, tagSize)}}
+	if !pbkdf2Svc.Outdated(weaker.marshal(), Binding{}) {
+		t.Fatalf("expected other PBKDF2 costs to be outdated")
+	}
+}
+
+func TestEncryptionServiceSettings(t *testing.T) {
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	svc, reader := NewEncryptionService(), NewEncryptionService()
+	svc.Iterations, svc.SaltSize = 20000, 32
+
+	sealed, err := svc.EncryptData([]byte("tuned"), phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := parseEnvelope(sealed)
+	if err != nil || env.Params.Iterations != 20000 || len(env.Salt) != 32 {
+		t.Fatalf("expected the settings to be recorded, got %+v, %v", env, err)
+	}
+	// the recorded settings are used, whatever the reader's own are
+	if plain, err := reader.DecryptData(sealed, phrase); err != nil || string(plain) != "tuned" {
+		t.Fatalf("got %q, %v", plain, err)
+	}
+	if svc.Outdated(sealed, Binding{}) || !reader.Outdated(sealed, Binding{}) {
+		t.Fatalf("expected the envelope to be current only for the service that wrote it")
+	}
+}
+
+func TestDecryptionErrors(t *testing.T) {
+	svc := NewEncryptionService()
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	wrong := "this_is_another_passphrase_that_is_at_least_32_characters_long"
+	b := FieldBinding("notes", "abc123", "message")
+
+	sealed, _ := svc.EncryptBound([]byte("hello"), phrase, b)
+	if _, err := svc.DecryptBound(sealed, wrong, b); !errors.Is(err, ErrWrongPassphrase) || errors.Is(err, ErrCorruptCiphertext) {
+		t.Fatalf("wrong passphrase: expected ErrWrongPassphrase, got %v", err)
+	}
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := svc.DecryptBound(tampered, phrase, b); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("tampered: expected ErrWrongPassphrase, got %v", err)
+	}
+	if _, err := svc.DecryptBound(sealed[:20], phrase, b); !errors.Is(err, ErrCorruptCiphertext) || !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("truncated: expected ErrCorruptCiphertext, got %v", err)
+	}
+	if _, err := svc.DecryptBound(sealed, phrase, FieldBinding("notes", "abc123", "title")); !errors.Is(err, ErrCorruptCiphertext) {
+		t.Fatalf("other purpose: expected ErrCorruptCiphertext, got %v", err)
+	}
+
+	// a tampered later chunk fails like a wrong passphrase, not revealing
+	// that the key was right
+	data := make([]byte, 2*ChunkSize)
+	chunked, _ := svc.EncryptChunked(data, phrase, Binding{})
+	chunked[len(chunked)-1] ^= 1
+	if _, err := svc.DecryptChunked(chunked, phrase, Binding{}); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("tampered chunk: expected ErrWrongPassphrase, got %v", err)
+	}
+	if _, err := svc.DecryptChunked(chunked[:len(chunked)-ChunkSize-10], phrase, Binding{}); !errors.Is(err, ErrCorruptCiphertext) {
+		t.Fatalf("truncated chunks: expected ErrCorruptCiphertext, got %v", err)
+	}
+}
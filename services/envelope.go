@@ -0,0 +1,100 @@
+package services
+
+import "github.com/ktappdev/secretnotes-go-backend/pkg/cryptobox"
+
+// Envelopes are what EncryptData writes, in the format package cryptobox
+// describes and reads, so clients and other tools can open them too. Version
+// 1 is written for unbound data. Stored fields are written in version 3, with
+// the purpose subkey and the additional data of their Binding, or version 4
+// when the server has a pepper (see Service.SetPeppers), and version 5 for
+// servers with a KMS (see Service.UseKMS). Plaintext is compressed in
+// messages worth it (see CompressMessages).
+
+// Envelope versions EncryptData and EncryptBound write
+const (
+	envelopeVersion         = cryptobox.Version1
+	v2EnvelopeVersion       = cryptobox.Version2
+	boundEnvelopeVersion    = cryptobox.Version3
+	pepperedEnvelopeVersion = cryptobox.Version4
+	wrappedEnvelopeVersion  = cryptobox.Version5
+)
+
+// ErrUnsupportedEnvelope is matched by envelopes of a format version or
+// algorithm this server doesn't know, typically written by a newer one
+var ErrUnsupportedEnvelope = cryptobox.ErrUnsupportedEnvelope
+
+// EnvelopeError reports an envelope that can't be parsed; see
+// cryptobox.EnvelopeError
+type EnvelopeError = cryptobox.EnvelopeError
+
+var (
+	malformed   = cryptobox.Malformed
+	unsupported = cryptobox.Unsupported
+)
+
+// algorithmID packs a cipher id from ids and the KDF into one byte, as in
+// version 0 and SNC1 envelopes: the cipher in the low bits and the KDF id
+// less one in the high bits, so PBKDF2 is zero there as it was before the
+// KDF was recorded
+func algorithmID(ids map[string]byte, cipherName, kdf string) byte {
+	return ids[cipherName] | (cryptobox.KDFID(kdf)-1)<<4
+}
+
+// parseAlgorithmID splits an algorithm id byte into the cipher and KDF it
+// names, reporting false when either is unknown
+func parseAlgorithmID(ids map[string]byte, id byte) (string, string, bool) {
+	cipherName := idName(ids, id&0x0f)
+	kdf := cryptobox.KDFName(id>>4 + 1)
+	return cipherName, kdf, cipherName != "" && kdf != ""
+}
+
+func idName(ids map[string]byte, id byte) string {
+	for name, known := range ids {
+		if known == id {
+			return name
+		}
+	}
+	return ""
+}
+
+// envelope is a parsed EncryptData output, with its purpose by name
+type envelope struct {
+	cryptobox.Envelope
+	purpose string // subkey purpose, "" for the passphrase key itself
+}
+
+// marshal encodes the envelope in the current format
+func (e *envelope) marshal() []byte {
+	e.Purpose = purposeIDs[e.purpose]
+	return e.Envelope.Marshal()
+}
+
+// parseEnvelope parses EncryptData output of any version. Data without a
+// header is taken as the headerless layout.
+func parseEnvelope(data []byte) (*envelope, error) {
+	env, err := cryptobox.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return withPurpose(env)
+}
+
+// parseHeaderless parses data as the headerless layout
+func parseHeaderless(data []byte) (*envelope, error) {
+	env, err := cryptobox.UnmarshalHeaderless(data)
+	if err != nil {
+		return nil, err
+	}
+	return &envelope{Envelope: *env}, nil
+}
+
+// withPurpose names the purpose of a parsed envelope
+func withPurpose(env *cryptobox.Envelope) (*envelope, error) {
+	e := &envelope{Envelope: *env}
+	if env.Purpose != 0 {
+		if e.purpose = idName(purposeIDs, env.Purpose); e.purpose == "" {
+			return nil, unsupported("unknown purpose id %d", env.Purpose)
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/ktappdev/secretnotes-go-backend/pkg/cryptobox"
+)
+
+var (
+	envelopeMagic   = []byte("SNE")
+	v0EnvelopeMagic = []byte("SN\x00")
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	env := &envelope{Envelope: cryptobox.Envelope{
+		Cipher: CipherChaCha20Poly1305,
+		Params: cryptobox.LegacyKDFParams(KDFScrypt),
+		Salt:   bytes.Repeat([]byte{1}, 16),
+		Nonce:  bytes.Repeat([]byte{2}, nonceSize),
+		Sealed: bytes.Repeat([]byte{3}, tagSize+5),
+	}}
+	data := env.marshal()
+	if !bytes.HasPrefix(data, append(envelopeMagic, envelopeVersion)) {
+		t.Fatalf("expected a version %d header, got %x", envelopeVersion, data[:8])
+	}
+	parsed, err := parseEnvelope(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Cipher != env.Cipher || parsed.Params != env.Params ||
+		!bytes.Equal(parsed.Salt, env.Salt) || !bytes.Equal(parsed.Nonce, env.Nonce) || !bytes.Equal(parsed.Sealed, env.Sealed) {
+		t.Fatalf("got %+v, want %+v", parsed, env)
+	}
+}
+
+// TestEnvelopeRecordedCost checks that decryption uses the KDF cost recorded
+// in the envelope rather than the current default
+func TestEnvelopeRecordedCost(t *testing.T) {
+	svc := NewEncryptionService()
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+
+	params := cryptobox.KDFParams{KDF: KDFPBKDF2, Iterations: 12345}
+	env := &envelope{Envelope: cryptobox.Envelope{Cipher: CipherAESGCM, Params: params, Salt: bytes.Repeat([]byte{4}, 16), Nonce: make([]byte, nonceSize)}}
+	aead, err := newAEAD(env.Cipher, svc.deriveKey(params, phrase, env.Salt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Sealed = aead.Seal(nil, env.Nonce, []byte("costly"), nil)
+
+	if plain, err := svc.DecryptData(env.marshal(), phrase); err != nil || string(plain) != "costly" {
+		t.Fatalf("got %q, %v", plain, err)
+	}
+}
+
+func TestEnvelopeAAD(t *testing.T) {
+	svc := NewEncryptionService()
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	b := FieldBinding("notes", "abc123", "message")
+
+	sealed, err := svc.EncryptBound([]byte("bound"), phrase, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed[len(envelopeMagic)] != boundEnvelopeVersion {
+		t.Fatalf("expected a version %d envelope, got %d", boundEnvelopeVersion, sealed[len(envelopeMagic)])
+	}
+	if plain, err := svc.DecryptBound(sealed, phrase, b); err != nil || string(plain) != "bound" {
+		t.Fatalf("got %q, %v", plain, err)
+	}
+	for _, wrong := range []Binding{{}, FieldBinding("notes", "abc123", "title"), FieldBinding("notes", "def456", "message")} {
+		if _, err := svc.DecryptBound(sealed, phrase, wrong); !errors.Is(err, ErrDecryptionFailed) {
+			t.Errorf("%+v: expected a decryption error, got %v", wrong, err)
+		}
+	}
+
+	// envelopes from before fields were bound still open, and are outdated
+	unbound, err := svc.EncryptData([]byte("unbound"), phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := svc.DecryptBound(unbound, phrase, b); err != nil || string(plain) != "unbound" {
+		t.Fatalf("got %q, %v", plain, err)
+	}
+	if !svc.Outdated(unbound, b) || svc.Outdated(sealed, b) {
+		t.Fatalf("expected only the unbound envelope to be outdated")
+	}
+}
+
+func TestEnvelopeSubkeys(t *testing.T) {
+	svc := NewEncryptionService()
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	b := FieldBinding("notes", "abc123", "message")
+
+	key := make([]byte, 32)
+	if bytes.Equal(subkey(key, PurposeMessage), subkey(key, PurposeFile)) || bytes.Equal(subkey(key, PurposeMessage), key) {
+		t.Fatal("expected distinct subkeys per purpose")
+	}
+
+	// a version 2 envelope, bound but keyed with the passphrase key itself
+	env := &envelope{Envelope: cryptobox.Envelope{Cipher: CipherAESGCM, Params: svc.kdfParams(), Salt: make([]byte, svc.SaltSize), Nonce: make([]byte, nonceSize), Bound: true}}
+	aead, err := newAEAD(env.Cipher, svc.deriveKey(env.Params, phrase, env.Salt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Sealed = aead.Seal(nil, env.Nonce, []byte("v2"), b.AAD)
+	v2 := env.marshal()
+	if v2[len(envelopeMagic)] != v2EnvelopeVersion {
+		t.Fatalf("expected a version %d envelope, got %d", v2EnvelopeVersion, v2[len(envelopeMagic)])
+	}
+	if plain, err := svc.DecryptBound(v2, phrase, b); err != nil || string(plain) != "v2" {
+		t.Fatalf("got %q, %v", plain, err)
+	}
+	if !svc.Outdated(v2, b) {
+		t.Fatal("expected a version 2 envelope to be outdated")
+	}
+
+	// the same field name in another purpose's binding doesn't open it
+	sealed, err := svc.EncryptBound([]byte("message"), phrase, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.DecryptBound(sealed, phrase, Binding{Purpose: PurposeFile, AAD: b.AAD}); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("another purpose: expected ErrDecryptionFailed, got %v", err)
+	}
+}
+
+func TestDecryptVersion0Envelope(t *testing.T) {
+	svc := NewEncryptionService()
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+
+	salt, nonce := bytes.Repeat([]byte{5}, svc.SaltSize), make([]byte, nonceSize)
+	aead, err := newAEAD(CipherChaCha20Poly1305, svc.deriveKey(cryptobox.LegacyKDFParams(KDFScrypt), phrase, salt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append(append([]byte{}, v0EnvelopeMagic...), cryptobox.CipherID(CipherChaCha20Poly1305)|(cryptobox.KDFID(KDFScrypt)-1)<<4)
+	data = append(append(append(data, salt...), nonce...), aead.Seal(nil, nonce, []byte("v0"), nil)...)
+
+	if plain, err := svc.DecryptData(data, phrase); err != nil || string(plain) != "v0" {
+		t.Fatalf("got %q, %v", plain, err)
+	}
+	if got := svc.PlaintextSize(data); got != 2 {
+		t.Fatalf("PlaintextSize = %d, want 2", got)
+	}
+}
+
+func TestParseEnvelopeErrors(t *testing.T) {
+	valid := (&envelope{Envelope: cryptobox.Envelope{
+		Cipher: CipherAESGCM,
+		Params: cryptobox.LegacyKDFParams(KDFPBKDF2),
+		Salt:   make([]byte, 16),
+		Nonce:  make([]byte, nonceSize),
+		Sealed: make([]byte, tagSize),
+	}}).marshal()
+	header := len(envelopeMagic)
+	with := func(i int, b byte) []byte {
+		data := append([]byte{}, valid...)
+		data[i] = b
+		return data
+	}
+
+	for _, tc := range []struct {
+		name        string
+		data        []byte
+		unsupported bool
+	}{
+		{"truncated header", valid[:header+2], false},
+		{"truncated ciphertext", valid[:len(valid)-1], false},
+		{"newer version", with(header, boundEnvelopeVersion+1), true},
+		{"unknown cipher", with(header+1, 9), true},
+		{"unknown KDF", with(header+2, 9), true},
+		{"wrong params length", with(header+3, 3), false},
+		{"zero iterations", append(append([]byte{}, valid[:header+4]...), append([]byte{0, 0, 0, 0}, valid[header+8:]...)...), true},
+		{"short salt", with(header+8, 2), false},
+		{"excessive scrypt cost", append(append(append([]byte{}, envelopeMagic...), envelopeVersion, 1, cryptobox.KDFID(KDFScrypt), 3, 24, 8, 1, 16), make([]byte, 16+nonceSize+tagSize)...), true},
+		{"unknown version 0 algorithm", append(append([]byte{}, v0EnvelopeMagic...), 0x0f), true},
+	} {
+		_, err := parseEnvelope(tc.data)
+		var envErr *EnvelopeError
+		if !errors.As(err, &envErr) || !errors.Is(err, ErrDecryptionFailed) {
+			t.Errorf("%s: expected an EnvelopeError, got %v", tc.name, err)
+			continue
+		}
+		if errors.Is(err, ErrUnsupportedEnvelope) != tc.unsupported {
+			t.Errorf("%s: unsupported = %v, want %v (%v)", tc.name, !tc.unsupported, tc.unsupported, err)
+		}
+	}
+
+	// a headerless envelope too short to hold a salt and nonce
+	if _, err := NewEncryptionService().DecryptData(make([]byte, 20), "phrase"); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("expected a decryption error, got %v", err)
+	}
+}
+
+// TestCryptoboxInterop checks that envelopes sealed by clients with package
+// cryptobox decrypt on the server, and the server's unbound ones open there
+func TestCryptoboxInterop(t *testing.T) {
+	svc := NewEncryptionService()
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+
+	sealed, err := cryptobox.Seal([]byte("from a client"), phrase, &cryptobox.Options{Cipher: CipherChaCha20Poly1305})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := svc.DecryptData(sealed, phrase); err != nil || string(plain) != "from a client" {
+		t.Fatalf("got %q, %v", plain, err)
+	}
+
+	sealed, err = svc.EncryptData([]byte("from the server"), phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := cryptobox.Open(sealed, phrase); err != nil || string(plain) != "from the server" {
+		t.Fatalf("got %q, %v", plain, err)
+	}
+}
@@ -1,23 +1,35 @@
 package services
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
+	"time"
 
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/filesystem/blob"
+
+	"github.com/ktappdev/secretnotes-go-backend/cryptoutil"
 )
 
+// ErrFileNotFound is returned when no attachment is stored for the passphrase
+var ErrFileNotFound = errors.New("encrypted file not found")
+
 // FileService handles encrypted file operations
 type FileService struct {
 	App        *pocketbase.PocketBase
 	Encryption *Service
+
+	quota          Quota     // attachment caps; the note caps are NoteService's
+	chunkThreshold int64     // larger files are stored chunked; 0 chunks only audio
+	retention      Retention // server-wide; notes may set stricter rules
 }
 
 // NewFileService creates a new file service
@@ -28,81 +40,236 @@ func NewFileService(app *pocketbase.PocketBase, encryption *Service) *FileServic
 	}
 }
 
-// StoreEncryptedFile stores an encrypted file (encrypted bytes go into the file_data field)
-func (f *FileService) StoreEncryptedFile(phrase string, file multipart.File, filename, contentType string) (string, error) {
-	// Read the file content
-	content, err := io.ReadAll(file)
+// StoreEncryptedFile stores an encrypted file (encrypted bytes go into the
+// file_data field) in place of the phrase's current files. A *QuotaError is
+// returned when the file alone is over the attachment quota. The content is
+// read in passes rather than loaded into memory, so an uploaded multipart
+// file spilled to disk is encrypted from there; see storeFile. Encryption
+// happens before the transaction, which holds the database's only write
+// connection, so a large upload doesn't hold up every other write.
+func (f *FileService) StoreEncryptedFile(phrase string, content *io.SectionReader, filename, contentType string) (string, error) {
+	// The upload replaces the phrase's files, so it only has to fit on its own
+	phraseHash := f.hashPhrase(phrase)
+	if err := checkAttachmentQuota(f.App, f.quota, phraseHash, content.Size(), 1, true); err != nil {
+		return "", err
+	}
+	prepared, err := f.prepareFile(f.App, phrase, content, filename, contentType)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file: %w", err)
+		return "", err
+	}
+	defer prepared.cleanup()
+
+	var fileHash string
+	err = f.App.RunInTransaction(func(txApp core.App) error {
+		if err := checkAttachmentQuota(txApp, f.quota, phraseHash, content.Size(), 1, true); err != nil {
+			return err
+		}
+
+		// Delete any existing files with the same phrase hash
+		existingRecords, _ := txApp.FindRecordsByFilter(
+			"encrypted_files",
+			"phrase_hash = {:phrase_hash}",
+			"",
+			-1, // get all
+			0,
+			dbx.Params{"phrase_hash": phraseHash},
+		)
+		for _, existingRec := range existingRecords {
+			txApp.Delete(existingRec)
+		}
+
+		var err error
+		fileHash, err = f.savePrepared(txApp, prepared)
+		return err
+	})
+	return fileHash, err
+}
+
+// SetQuota sets the attachment caps StoreEncryptedFile and ImportFiles enforce
+func (f *FileService) SetQuota(quota Quota) {
+	f.quota = quota
+}
+
+// SetChunkThreshold makes files larger than n bytes be stored in chunked
+// envelopes, which are written and served a chunk at a time, like audio
+func (f *FileService) SetChunkThreshold(n int64) {
+	f.chunkThreshold = n
+}
+
+// chunks reports whether size bytes of contentType are stored chunked
+func (f *FileService) chunks(size int64, contentType string) bool {
+	return Streamable(contentType) || (f.chunkThreshold > 0 && size > f.chunkThreshold)
+}
+
+// sectionOf returns content as a section reader, as storeFile takes it
+func sectionOf(content []byte) *io.SectionReader {
+	return io.NewSectionReader(bytes.NewReader(content), 0, int64(len(content)))
+}
+
+// reread returns a reader over all of content, independent of other passes
+func reread(content *io.SectionReader) *io.SectionReader {
+	return io.NewSectionReader(content, 0, content.Size())
+}
+
+// ImportFiles stores decrypted files (e.g. from an export archive) under the
+// phrase next to any it already has. It should be called with a transactional
+// app. The returned hash references the first file (empty when there are none).
+func (f *FileService) ImportFiles(txApp core.App, phrase string, files []DecryptedFile) (string, error) {
+	var size int64
+	for _, file := range files {
+		size += int64(len(file.Data))
+	}
+	if err := checkAttachmentQuota(txApp, f.quota, f.hashPhrase(phrase), size, len(files), false); err != nil {
+		return "", err
 	}
 
-	// Encrypt the file content
-	encryptedContent, err := f.Encryption.EncryptData(content, phrase)
+	var firstHash string
+	for i, file := range files {
+		fileHash, err := f.storeFile(txApp, phrase, sectionOf(file.Data), file.Name, file.ContentType)
+		if err != nil {
+			return "", err
+		}
+		if i == 0 {
+			firstHash = fileHash
+		}
+	}
+	return firstHash, nil
+}
+
+// storeFile saves content as a new encrypted_files record, returning the hash
+// of the stored ciphertext. Content the phrase already has stored is shared
+// rather than encrypted and stored again. Content is read once to look for
+// that, once to encrypt it and, for images, once for the thumbnail; only
+// files stored whole (below the chunk threshold) are held in memory.
+func (f *FileService) storeFile(app core.App, phrase string, content *io.SectionReader, filename, contentType string) (string, error) {
+	prepared, err := f.prepareFile(app, phrase, content, filename, contentType)
 	if err != nil {
-		return "", fmt.Errorf("failed to encrypt file: %w", err)
+		return "", err
 	}
+	defer prepared.cleanup()
+	return f.savePrepared(app, prepared)
+}
 
-	// Hash the phrase for secure lookup
-	phraseHash := f.hashPhrase(phrase)
+// preparedFile is an attachment encrypted and ready for savePrepared
+type preparedFile struct {
+	rec     *core.Record
+	content *preparedContent
+}
 
-	// Generate a hash for the encrypted file
-	fileHash := f.hashBytes(encryptedContent)
+func (p *preparedFile) cleanup() {
+	p.content.cleanup()
+}
 
-	// Find or create the record in encrypted_files
-	filesCollection, err := f.App.FindCollectionByNameOrId("encrypted_files")
+// prepareFile does the slow part of storing an attachment, which needs no
+// transaction: deriving the key, encrypting the content, filename and type,
+// and making the thumbnail
+func (f *FileService) prepareFile(app core.App, phrase string, content *io.SectionReader, filename, contentType string) (*preparedFile, error) {
+	// Encrypt the file content; audio and large files are chunked so they can
+	// be streamed
+	chunked := f.chunks(content.Size(), contentType)
+	preparedContent, err := f.prepareContent(app, phrase, content, chunked)
 	if err != nil {
-		return "", fmt.Errorf("files collection not found: %w", err)
+		return nil, err
 	}
+	prepared := &preparedFile{content: preparedContent}
 
-	// Delete any existing files with the same phrase hash
-	existingRecords, _ := f.App.FindRecordsByFilter(
-		"encrypted_files",
-		"phrase_hash = {:phrase_hash}",
-		"",
-		-1, // get all
-		0,
-		dbx.Params{"phrase_hash": phraseHash},
-	)
-	for _, existingRec := range existingRecords {
-		f.App.Delete(existingRec)
+	filesCollection, err := app.FindCachedCollectionByNameOrId("encrypted_files")
+	if err != nil {
+		prepared.cleanup()
+		return nil, fmt.Errorf("files collection not found: %w", err)
 	}
 
 	// Create a new record
 	rec := core.NewRecord(filesCollection)
-	rec.Set("phrase_hash", phraseHash)
+	rec.Set("id:autogenerate", "") // the ciphertexts are bound to the id
+	rec.Set("phrase_hash", f.hashPhrase(phrase))
+	prepared.rec = rec
 
 	// Encrypt the filename before storing (obscures it in admin UI)
-	encryptedFilename, err := f.Encryption.EncryptData([]byte(filename), phrase)
+	encryptedFilename, err := f.Encryption.EncryptBound([]byte(filename), phrase, recordBinding(rec, "file_name"))
+	if err != nil {
+		prepared.cleanup()
+		return nil, fmt.Errorf("failed to encrypt filename: %w", err)
+	}
+
+	encryptedContentType, err := f.encryptContentType(rec, contentType, phrase)
 	if err != nil {
-		return "", fmt.Errorf("failed to encrypt filename: %w", err)
+		prepared.cleanup()
+		return nil, err
 	}
 
 	// Set metadata fields (encode encrypted binary data as base64 to prevent corruption)
 	rec.Set("file_name", base64.StdEncoding.EncodeToString(encryptedFilename))
-	rec.Set("content_type", contentType)
-
-	// Generate hash-based storage filename to obscure it on disk
-	storageFilename := f.generateStorageFilename(filename)
+	rec.Set("content_type", encryptedContentType)
+	rec.Set("size", content.Size())
+	rec.Set("chunked", chunked)
 
-	// Create a file from the encrypted bytes and attach it to the file field
-	encFile, err := filesystem.NewFileFromBytes(encryptedContent, storageFilename)
+	// Image attachments get an encrypted preview for GET /notes/image/thumbnail
+	thumbnail, err := makeThumbnail(reread(content))
 	if err != nil {
-		return "", fmt.Errorf("failed to create file from bytes: %w", err)
+		prepared.cleanup()
+		return nil, err
+	}
+	if thumbnail != nil {
+		if err := f.setThumbnail(rec, thumbnail, filename, phrase); err != nil {
+			prepared.cleanup()
+			return nil, err
+		}
 	}
-	// File fields expect a slice of files
-	rec.Set("file_data", []*filesystem.File{encFile})
+	return prepared, nil
+}
 
-	if err := f.App.Save(rec); err != nil {
+// savePrepared saves a prepared attachment with its content, returning the
+// hash of the stored ciphertext
+func (f *FileService) savePrepared(app core.App, prepared *preparedFile) (string, error) {
+	contentID, fileHash, err := f.acquirePrepared(app, prepared.content)
+	if err != nil {
+		return "", err
+	}
+	prepared.rec.Set("content", contentID)
+	if err := app.Save(prepared.rec); err != nil {
 		return "", fmt.Errorf("failed to save encrypted file: %w", err)
 	}
-
 	return fileHash, nil
 }
 
-// RetrieveDecryptedFile retrieves and decrypts a file from the file_data field
-func (f *FileService) RetrieveDecryptedFile(phrase string) ([]byte, string, string, error) {
-	phraseHash := f.hashPhrase(phrase)
+// setThumbnail encrypts thumbnail and attaches it to rec's thumbnail field
+func (f *FileService) setThumbnail(rec *core.Record, thumbnail []byte, filename, phrase string) error {
+	encrypted, err := f.Encryption.EncryptBound(thumbnail, phrase, recordBinding(rec, "thumbnail"))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt thumbnail: %w", err)
+	}
+	thumbFile, err := filesystem.NewFileFromBytes(encrypted, f.generateStorageFilename("thumbnail:"+filename))
+	if err != nil {
+		return fmt.Errorf("failed to create thumbnail from bytes: %w", err)
+	}
+	rec.Set("thumbnail", []*filesystem.File{thumbFile})
+	rec.Set("thumbnail_size", thumbFile.Size)
+	return nil
+}
+
+// FileVersion identifies the file OpenFile opens without decrypting it: an opaque, quoted ETag and when the file last changed
+func (f *FileService) FileVersion(phrase string) (string, time.Time, error) {
+	record, err := f.findFile(phrase)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	etag, modified := fileVersion(record)
+	return etag, modified, nil
+}
+
+func fileVersion(record *core.Record) (string, time.Time) {
+	modified := Timestamp(record.GetDateTime("updated"))
+	tag := sha256.Sum256([]byte(record.Id + ":" + modified.Format(time.RFC3339Nano)))
+	return `"` + hex.EncodeToString(tag[:16]) + `"`, modified
+}
 
+// findFile returns the phrase's attachment record, the one GET /notes/image serves
+func (f *FileService) findFile(phrase string) (*core.Record, error) {
+	return f.findFileByHash(f.hashPhrase(phrase))
+}
+
+func (f *FileService) findFileByHash(phraseHash string) (*core.Record, error) {
 	records, err := f.App.FindRecordsByFilter(
 		"encrypted_files",
 		"phrase_hash = {:phrase_hash}",
@@ -112,103 +279,334 @@ func (f *FileService) RetrieveDecryptedFile(phrase string) ([]byte, string, stri
 		dbx.Params{"phrase_hash": phraseHash},
 	)
 	if err != nil {
-		return nil, "", "", fmt.Errorf("error finding encrypted file: %w", err)
+		return nil, fmt.Errorf("error finding encrypted file: %w", err)
 	}
 	if len(records) == 0 {
-		return nil, "", "", fmt.Errorf("encrypted file not found")
+		return nil, ErrFileNotFound
 	}
+	return records[0], nil
+}
 
-	rec := records[0]
-	contentType := rec.GetString("content_type")
+// DecryptedFile is an attachment with its metadata, decrypted
+type DecryptedFile struct {
+	Name        string
+	ContentType string
+	Data        []byte
+	Created     time.Time
+}
 
-	// Decrypt the filename (it's stored encrypted and base64-encoded in the database)
-	encryptedFilenameB64 := rec.GetString("file_name")
-	encryptedFilename, err := base64.StdEncoding.DecodeString(encryptedFilenameB64)
-	if err != nil {
-		return nil, "", "", fmt.Errorf("failed to decode filename: %w", err)
-	}
-	decryptedFilenameBytes, err := f.Encryption.DecryptData(encryptedFilename, phrase)
+// RetrieveDecryptedFiles decrypts every attachment stored under the phrase, oldest first
+func (f *FileService) RetrieveDecryptedFiles(phrase string) ([]DecryptedFile, error) {
+	records, err := f.App.FindRecordsByFilter(
+		"encrypted_files",
+		"phrase_hash = {:phrase_hash}",
+		"created",
+		-1,
+		0,
+		dbx.Params{"phrase_hash": f.hashPhrase(phrase)},
+	)
 	if err != nil {
-		return nil, "", "", fmt.Errorf("failed to decrypt filename: %w", err)
+		return nil, fmt.Errorf("error finding encrypted files: %w", err)
 	}
-	filename := string(decryptedFilenameBytes)
 
-	// Extract the stored filename from the file_data field
-	// PocketBase stores this as a string reference to the actual file
-	fileData := rec.Get("file_data")
-	var storedFilename string
-	switch v := fileData.(type) {
-	case string:
-		storedFilename = v
-	case []*filesystem.File:
-		if len(v) > 0 {
-			storedFilename = v[0].Name
+	files := make([]DecryptedFile, 0, len(records))
+	for _, rec := range records {
+		file, err := f.decryptRecord(rec, phrase)
+		if err != nil {
+			return nil, err
 		}
-	case *filesystem.File:
-		storedFilename = v.Name
-	default:
-		return nil, "", "", fmt.Errorf("invalid file data format")
+		files = append(files, file)
 	}
+	return files, nil
+}
 
-	if storedFilename == "" {
-		return nil, "", "", fmt.Errorf("no file stored")
+// decryptRecord reads and decrypts an encrypted_files record
+func (f *FileService) decryptRecord(rec *core.Record, phrase string) (DecryptedFile, error) {
+	filename, err := f.decryptFilename(rec, phrase)
+	if err != nil {
+		return DecryptedFile{}, err
+	}
+	contentType, err := f.decryptContentType(f.App, rec, phrase)
+	if err != nil {
+		return DecryptedFile{}, err
 	}
 
-	// Access the file through PocketBase's filesystem
-	// Use the original BaseFilesPath approach but fix the file access method
-	fs, err := f.App.NewFilesystem()
+	encryptedBytes, err := f.readStoredFile(f.App, rec)
 	if err != nil {
-		return nil, "", "", fmt.Errorf("filesystem init: %w", err)
+		return DecryptedFile{}, err
+	}
+	content, err := f.decryptContent(rec, encryptedBytes, phrase)
+	if err != nil {
+		return DecryptedFile{}, err
 	}
-	defer fs.Close()
 
-	// Construct the file storage key using PocketBase's BaseFilesPath
-	// Files are stored directly under the record path (no /file_data/ subdirectory)
-	fileKey := rec.BaseFilesPath() + "/" + storedFilename
+	return DecryptedFile{
+		Name:        filename,
+		ContentType: contentType,
+		Data:        content,
+		Created:     Timestamp(rec.GetDateTime("created")),
+	}, nil
+}
 
-	// Use GetReader to access the encrypted file through PocketBase's filesystem API
-	reader, err := fs.GetReader(fileKey)
+// decryptFilename decrypts a record's filename (it's stored encrypted and
+// base64-encoded in the database)
+func (f *FileService) decryptFilename(rec *core.Record, phrase string) (string, error) {
+	encryptedFilename, err := base64.StdEncoding.DecodeString(rec.GetString("file_name"))
 	if err != nil {
-		return nil, "", "", fmt.Errorf("failed to access encrypted file: %w", err)
+		return "", fmt.Errorf("failed to decode filename: %w", err)
 	}
-	defer reader.Close()
-
-	encryptedBytes, err := io.ReadAll(reader)
+	filename, err := f.Encryption.DecryptBound(encryptedFilename, phrase, recordBinding(rec, "file_name"))
 	if err != nil {
-		return nil, "", "", fmt.Errorf("read file content: %w", err)
+		return "", fmt.Errorf("failed to decrypt filename: %w", err)
 	}
+	defer cryptoutil.Wipe(filename)
+	return string(filename), nil
+}
 
-	decryptedContent, err := f.Encryption.DecryptData(encryptedBytes, phrase)
-	if err != nil {
-		return nil, "", "", fmt.Errorf("failed to decrypt file: %w", err)
+// encryptContent encrypts attachment content bound by b, into a chunked
+// envelope when chunked is set
+func (f *FileService) encryptContent(content []byte, phrase string, chunked bool, b Binding) ([]byte, error) {
+	if chunked {
+		return f.Encryption.EncryptChunked(content, phrase, b)
 	}
+	return f.Encryption.EncryptBound(content, phrase, b)
+}
 
-	return decryptedContent, filename, contentType, nil
+// decryptContent decrypts rec's stored content
+func (f *FileService) decryptContent(rec *core.Record, encrypted []byte, phrase string) ([]byte, error) {
+	decrypt := f.Encryption.DecryptBound
+	if rec.GetBool("chunked") {
+		decrypt = f.Encryption.DecryptChunked
+	}
+	content, err := decrypt(encrypted, phrase, contentBinding(rec))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt file: %w", err)
+	}
+	return content, nil
 }
 
-// DeleteEncryptedFile deletes an encrypted file record (file bytes are removed by PocketBase)
-func (f *FileService) DeleteEncryptedFile(phrase string) error {
+// DeleteEncryptedFile deletes the file GET /notes/image serves for the phrase
+// (file bytes are removed by PocketBase). Other attachments stay; it returns
+// the hash the note's image_hash should now hold: that of the attachment
+// served next, or "" when none are left.
+func (f *FileService) DeleteEncryptedFile(phrase string) (string, error) {
 	phraseHash := f.hashPhrase(phrase)
+	rec, err := f.findFileByHash(phraseHash)
+	if err != nil {
+		return "", ErrFileNotFound
+	}
+	if err := f.App.Delete(rec); err != nil {
+		return "", fmt.Errorf("failed to delete encrypted file: %w", err)
+	}
+	return f.servedImageHash(phraseHash)
+}
 
-	records, err := f.App.FindRecordsByFilter(
+// RekeyFiles re-encrypts every file stored under oldPhrase with newPhrase and
+// moves the records to the new phrase hash. It must be called with a
+// transactional app. The returned hash references the re-encrypted file
+// (empty when the phrase had no files).
+func (f *FileService) RekeyFiles(txApp core.App, oldPhrase, newPhrase string) (string, error) {
+	records, err := txApp.FindRecordsByFilter(
 		"encrypted_files",
 		"phrase_hash = {:phrase_hash}",
 		"",
-		1,
+		-1,
 		0,
-		dbx.Params{"phrase_hash": phraseHash},
+		dbx.Params{"phrase_hash": f.hashPhrase(oldPhrase)},
 	)
-	if err != nil || len(records) == 0 {
-		return fmt.Errorf("encrypted file not found")
+	if err != nil {
+		return "", fmt.Errorf("error finding encrypted files: %w", err)
 	}
 
-	rec := records[0]
-	if err := f.App.Delete(rec); err != nil {
-		return fmt.Errorf("failed to delete encrypted file: %w", err)
+	var fileHash string
+	for _, rec := range records {
+		encryptedFilename, err := base64.StdEncoding.DecodeString(rec.GetString("file_name"))
+		if err != nil {
+			return "", fmt.Errorf("failed to decode filename: %w", err)
+		}
+		filenameBytes, err := f.Encryption.DecryptBound(encryptedFilename, oldPhrase, recordBinding(rec, "file_name"))
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt filename: %w", err)
+		}
+
+		contentType, err := f.decryptContentType(txApp, rec, oldPhrase)
+		if err != nil {
+			return "", err
+		}
+
+		encryptedBytes, err := f.readStoredFile(txApp, rec)
+		if err != nil {
+			return "", err
+		}
+		content, err := f.decryptContent(rec, encryptedBytes, oldPhrase)
+		if err != nil {
+			return "", err
+		}
+
+		reencryptedFilename, err := f.Encryption.EncryptBound(filenameBytes, newPhrase, recordBinding(rec, "file_name"))
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt filename: %w", err)
+		}
+		// the old content record is released once the record is saved
+		contentID, contentHash, err := f.acquireContent(txApp, newPhrase, sectionOf(content), rec.GetBool("chunked"))
+		cryptoutil.Wipe(content)
+		if err != nil {
+			return "", err
+		}
+		reencryptedContentType, err := f.encryptContentType(rec, contentType, newPhrase)
+		if err != nil {
+			return "", err
+		}
+
+		rec.Set("phrase_hash", f.hashPhrase(newPhrase))
+		rec.Set("file_name", base64.StdEncoding.EncodeToString(reencryptedFilename))
+		rec.Set("content_type", reencryptedContentType)
+		rec.Set("content", contentID)
+		rec.Set("file_data", nil) // data stored before deduplication moves to the content record
+		rec.Set("stored_size", 0)
+
+		if rec.GetString("thumbnail") != "" {
+			encryptedThumb, err := f.readStoredField(txApp, rec, "thumbnail")
+			if err != nil {
+				return "", err
+			}
+			thumbnail, err := f.Encryption.DecryptBound(encryptedThumb, oldPhrase, recordBinding(rec, "thumbnail"))
+			if err != nil {
+				return "", fmt.Errorf("failed to decrypt thumbnail: %w", err)
+			}
+			err = f.setThumbnail(rec, thumbnail, string(filenameBytes), newPhrase)
+			cryptoutil.Wipe(thumbnail)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		cryptoutil.Wipe(filenameBytes)
+		if err := txApp.Save(rec); err != nil {
+			return "", fmt.Errorf("failed to save rekeyed file: %w", err)
+		}
+		fileHash = contentHash
+	}
+
+	return fileHash, nil
+}
+
+// CountFiles returns how many encrypted files are stored under the phrase
+func (f *FileService) CountFiles(app core.App, phrase string) (int, error) {
+	total, err := app.CountRecords("encrypted_files", dbx.HashExp{"phrase_hash": f.hashPhrase(phrase)})
+	if err != nil {
+		return 0, fmt.Errorf("error counting encrypted files: %w", err)
+	}
+	return int(total), nil
+}
+
+// readStoredFile reads the raw (still encrypted) bytes referenced by a record's file_data field
+func (f *FileService) readStoredFile(app core.App, rec *core.Record) ([]byte, error) {
+	return f.readStoredField(app, rec, "file_data")
+}
+
+// readStoredField reads the raw (still encrypted) bytes referenced by one of a
+// record's file fields
+func (f *FileService) readStoredField(app core.App, rec *core.Record, field string) ([]byte, error) {
+	reader, release, err := f.openStoredField(app, rec, field)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// read into a buffer of the exact size rather than letting io.ReadAll grow one
+	encryptedBytes := make([]byte, reader.Size())
+	if _, err := io.ReadFull(reader, encryptedBytes); err != nil {
+		return nil, fmt.Errorf("read file content: %w", err)
+	}
+	return encryptedBytes, nil
+}
+
+// openStoredField opens the file referenced by one of a record's file fields
+// for reading; release closes it. An attachment's file_data is read from its
+// shared content record when it has one.
+func (f *FileService) openStoredField(app core.App, rec *core.Record, field string) (*blob.Reader, func(), error) {
+	fileKey, err := storedFileKey(app, rec, field)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Access the file through PocketBase's filesystem
+	fs, err := app.NewFilesystem()
+	if err != nil {
+		return nil, nil, fmt.Errorf("filesystem init: %w", err)
+	}
+
+	// Use GetReader to access the encrypted file through PocketBase's filesystem API
+	reader, err := fs.GetReader(fileKey)
+	if err != nil {
+		fs.Close()
+		return nil, nil, fmt.Errorf("failed to access encrypted file: %w", err)
+	}
+	return reader, func() {
+		reader.Close()
+		fs.Close()
+	}, nil
+}
+
+// replaceStoredField overwrites the file referenced by one of a record's file
+// fields with data, keeping its name, so the record itself is unchanged
+func (f *FileService) replaceStoredField(app core.App, rec *core.Record, field string, data []byte) error {
+	fileKey, err := storedFileKey(app, rec, field)
+	if err != nil {
+		return err
+	}
+	fs, err := app.NewFilesystem()
+	if err != nil {
+		return fmt.Errorf("filesystem init: %w", err)
+	}
+	defer fs.Close()
+	if err := fs.Upload(data, fileKey); err != nil {
+		return fmt.Errorf("failed to replace encrypted file: %w", err)
 	}
 	return nil
 }
 
+// storedFileKey returns the storage key of the file referenced by one of a
+// record's file fields, following an attachment's file_data to its shared
+// content record when it has one
+func storedFileKey(app core.App, rec *core.Record, field string) (string, error) {
+	if field == "file_data" {
+		content, err := contentRecord(app, rec)
+		if err != nil {
+			return "", err
+		}
+		if content != nil {
+			rec, field = content, "data"
+		}
+	}
+
+	// Extract the stored filename from the file field
+	// PocketBase stores this as a string reference to the actual file
+	fileData := rec.Get(field)
+	var storedFilename string
+	switch v := fileData.(type) {
+	case string:
+		storedFilename = v
+	case []*filesystem.File:
+		if len(v) > 0 {
+			storedFilename = v[0].Name
+		}
+	case *filesystem.File:
+		storedFilename = v.Name
+	default:
+		return "", fmt.Errorf("invalid file data format")
+	}
+
+	if storedFilename == "" {
+		return "", fmt.Errorf("no file stored")
+	}
+
+	// Construct the file storage key using PocketBase's BaseFilesPath
+	// Files are stored directly under the record path (no /file_data/ subdirectory)
+	return rec.BaseFilesPath() + "/" + storedFilename, nil
+}
+
 // generateStorageFilename creates a SHA-256 hash-based filename for filesystem storage
 // This obscures the original filename on disk while maintaining consistency
 func (f *FileService) generateStorageFilename(originalFilename string) string {
@@ -216,10 +614,10 @@ func (f *FileService) generateStorageFilename(originalFilename string) string {
 	return hex.EncodeToString(hash[:])
 }
 
-// hashPhrase creates a SHA-256 hash of the phrase for secure storage and lookup
+// hashPhrase returns the hash the phrase's records are stored and looked up
+// under (see Service.PhraseHash)
 func (f *FileService) hashPhrase(phrase string) string {
-	hash := sha256.Sum256([]byte(phrase))
-	return hex.EncodeToString(hash[:])
+	return f.Encryption.PhraseHash(phrase)
 }
 
 // hashBytes creates a SHA-256 hash of a byte array
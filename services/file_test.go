@@ -0,0 +1,57 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+)
+
+func TestStoreEncryptedFile(t *testing.T) {
+	app := migratedApp(t)
+	files := NewFileService(app, NewEncryptionService())
+	files.SetChunkThreshold(ChunkSize)
+	phrase := "store-encrypted-file-phrase"
+
+	read := func() []byte {
+		t.Helper()
+		file, err := files.OpenFile(phrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	small := []byte("a small attachment")
+	if _, err := files.StoreEncryptedFile(phrase, sectionOf(small), "small.txt", "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(); !bytes.Equal(got, small) {
+		t.Fatalf("expected the stored file back, got %q", got)
+	}
+
+	// the same file again replaces the first, sharing its stored content
+	if _, err := files.StoreEncryptedFile(phrase, sectionOf(small), "again.txt", "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := app.CountRecords("attachment_contents"); n != 1 {
+		t.Fatalf("expected one stored content, got %d", n)
+	}
+
+	large := make([]byte, 3*ChunkSize+5)
+	rand.Read(large)
+	if _, err := files.StoreEncryptedFile(phrase, sectionOf(large), "large.bin", "application/octet-stream"); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(); !bytes.Equal(got, large) {
+		t.Fatal("expected the chunked file back")
+	}
+	if n, _ := app.CountRecords("encrypted_files"); n != 1 {
+		t.Fatalf("expected the upload to replace the phrase's files, got %d", n)
+	}
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/ktappdev/secretnotes-go-backend/pkg/cryptobox"
+)
+
+// FIPSCiphers and FIPSKDFs are the FIPS-approved ciphers and key derivation
+// functions, the only ones a service in FIPS mode uses
+var (
+	FIPSCiphers = []string{CipherAESGCM}
+	FIPSKDFs    = []string{KDFPBKDF2}
+)
+
+// FIPS parameter floors, after NIST SP 800-132: salts of at least 128 bits,
+// and at least 1000 PBKDF2 iterations
+const (
+	MinFIPSSaltSize         = 16
+	MinFIPSPBKDF2Iterations = 1000
+)
+
+// RequireFIPS restricts the service to FIPS-approved primitives: AES-256-GCM,
+// PBKDF2-HMAC-SHA256 with a compliant salt length and iteration count, and
+// HMAC-SHA256 and HKDF-SHA256 for the subkeys, pepper and KMS data keys it
+// already uses. It fails if the service is set up otherwise. From then on,
+// ciphertexts written with ChaCha20-Poly1305, AES-GCM-SIV or scrypt, or with
+// shorter salts, are refused as unsupported rather than decrypted. It must be
+// called after the service is configured and before it is used.
+func (s *Service) RequireFIPS() error {
+	switch {
+	case s.Cipher != CipherAESGCM:
+		return fmt.Errorf("cipher %s is not FIPS-approved", s.Cipher)
+	case s.ChunkCipher != "" && s.ChunkCipher != CipherAESGCM:
+		return fmt.Errorf("cipher %s is not FIPS-approved", s.ChunkCipher)
+	case s.KDF != KDFPBKDF2:
+		return fmt.Errorf("KDF %s is not FIPS-approved", s.KDF)
+	case s.SaltSize < MinFIPSSaltSize:
+		return fmt.Errorf("salts must be at least %d bytes in FIPS mode", MinFIPSSaltSize)
+	case s.Iterations < MinFIPSPBKDF2Iterations:
+		return fmt.Errorf("PBKDF2 needs at least %d iterations in FIPS mode", MinFIPSPBKDF2Iterations)
+	}
+	s.fips = true
+	return nil
+}
+
+// FIPS reports whether RequireFIPS restricted the service
+func (s *Service) FIPS() bool {
+	return s.fips
+}
+
+// checkFIPS refuses a ciphertext's algorithms and params if the service is in
+// FIPS mode and they aren't approved
+func (s *Service) checkFIPS(cipherName string, params cryptobox.KDFParams, salt []byte) error {
+	if !s.fips {
+		return nil
+	}
+	switch {
+	case cipherName != CipherAESGCM:
+		return unsupported("cipher %s is not FIPS-approved", cipherName)
+	case params.KDF != KDFPBKDF2:
+		return unsupported("KDF %s is not FIPS-approved", params.KDF)
+	case len(salt) < MinFIPSSaltSize:
+		return unsupported("%d-byte salt is too short for FIPS mode", len(salt))
+	case params.Iterations < MinFIPSPBKDF2Iterations:
+		return unsupported("%d PBKDF2 iterations are too few for FIPS mode", params.Iterations)
+	}
+	return nil
+}
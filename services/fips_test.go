@@ -0,0 +1,54 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRequireFIPS(t *testing.T) {
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	b := FieldBinding("notes", "abc123", "message")
+
+	for _, setup := range []func(*Service){
+		func(s *Service) { s.Cipher = CipherChaCha20Poly1305 },
+		func(s *Service) { s.ChunkCipher = CipherAESGCMSIV },
+		func(s *Service) { s.KDF = KDFScrypt },
+		func(s *Service) { s.SaltSize = 8 },
+		func(s *Service) { s.Iterations = 500 },
+	} {
+		svc := NewEncryptionService()
+		svc.Cipher = CipherAESGCM
+		setup(svc)
+		if err := svc.RequireFIPS(); err == nil || svc.FIPS() {
+			t.Fatalf("expected %s/%s, %d-byte salts and %d iterations to be refused", svc.Cipher, svc.KDF, svc.SaltSize, svc.Iterations)
+		}
+	}
+
+	other := NewEncryptionService()
+	other.Cipher = CipherChaCha20Poly1305
+	chacha, _ := other.EncryptBound([]byte("hello"), phrase, b)
+	chachaChunked, _ := other.EncryptChunked([]byte("hello"), phrase, b)
+	other.Cipher, other.KDF = CipherAESGCM, KDFScrypt
+	scrypted, _ := other.EncryptBound([]byte("hello"), phrase, b)
+
+	svc := NewEncryptionService()
+	svc.Cipher = CipherAESGCM
+	if err := svc.RequireFIPS(); err != nil || !svc.FIPS() {
+		t.Fatalf("expected the AES-GCM and PBKDF2 defaults to be approved, got %v", err)
+	}
+	sealed, err := svc.EncryptBound([]byte("hello"), phrase, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := svc.DecryptBound(sealed, phrase, b); err != nil || string(got) != "hello" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	for name, data := range map[string][]byte{"chacha20-poly1305": chacha, "scrypt": scrypted} {
+		if _, err := svc.DecryptBound(data, phrase, b); !errors.Is(err, ErrUnsupportedEnvelope) {
+			t.Fatalf("%s: expected ErrUnsupportedEnvelope, got %v", name, err)
+		}
+	}
+	if _, err := svc.DecryptChunked(chachaChunked, phrase, b); !errors.Is(err, ErrUnsupportedEnvelope) {
+		t.Fatalf("chunked chacha20-poly1305: expected ErrUnsupportedEnvelope, got %v", err)
+	}
+}
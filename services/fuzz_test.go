@@ -0,0 +1,77 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const fuzzPhrase = "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+
+// fuzzService returns a service with a cheap KDF and a pepper, compressing
+// messages, so the fuzzers reach every layer of the decrypt path quickly
+func fuzzService(f *testing.F) *Service {
+	svc := NewEncryptionService()
+	svc.Iterations = 1000
+	if err := svc.SetPeppers(map[byte][]byte{1: bytes.Repeat([]byte{7}, MinPepperSize)}, 1); err != nil {
+		f.Fatal(err)
+	}
+	svc.CompressMessages(64)
+	return svc
+}
+
+// checkDecryptError fails unless err is one decryption may return
+func checkDecryptError(t *testing.T, err error) {
+	if err != nil && !errors.Is(err, ErrDecryptionFailed) && !errors.Is(err, ErrNoKMS) {
+		t.Fatalf("got %v, want an error matching ErrDecryptionFailed", err)
+	}
+}
+
+// FuzzDecryptBound checks that the whole decrypt path, from parsing through
+// key derivation to decompression, never panics and fails only with
+// decryption errors
+func FuzzDecryptBound(f *testing.F) {
+	svc := fuzzService(f)
+	b := FieldBinding("notes", "abc123", "message")
+	for _, seal := range []func() ([]byte, error){
+		func() ([]byte, error) { return svc.EncryptData([]byte("unbound"), fuzzPhrase) },
+		func() ([]byte, error) { return svc.EncryptBound([]byte("bound"), fuzzPhrase, b) },
+		func() ([]byte, error) {
+			return svc.EncryptBound([]byte(strings.Repeat("compressible ", 20)), fuzzPhrase, b)
+		},
+	} {
+		sealed, err := seal()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(sealed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if env, err := parseEnvelope(data); err == nil && (env.Params.Iterations > 2000 || env.Params.LogN > 10) {
+			t.Skip("KDF costs too much to fuzz")
+		}
+		_, err := svc.DecryptBound(data, fuzzPhrase, b)
+		checkDecryptError(t, err)
+	})
+}
+
+// FuzzDecryptChunked checks the same of chunked envelopes
+func FuzzDecryptChunked(f *testing.F) {
+	svc := fuzzService(f)
+	b := FieldBinding("notes", "abc123", "file")
+	for _, data := range [][]byte{nil, []byte("small"), bytes.Repeat([]byte{1}, ChunkSize+3)} {
+		sealed, err := svc.EncryptChunked(data, fuzzPhrase, b)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(sealed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if h, _, err := readChunkedHeader(bytes.NewReader(data)); err == nil && (h.params.Iterations > 2000 || h.params.LogN > 10) {
+			t.Skip("KDF costs too much to fuzz")
+		}
+		_, err := svc.DecryptChunked(data, fuzzPhrase, b)
+		checkDecryptError(t, err)
+	})
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// minEnvelopeSize is the smallest valid EncryptData output: salt, GCM nonce
+// and GCM tag around an empty plaintext, in the headerless format
+const minEnvelopeSize = 16 + 12 + 16
+
+// integrityBatchSize is how many records are loaded at once while checking
+const integrityBatchSize = 500
+
+// Repair actions reported by CheckIntegrity
+const (
+	RepairNone         = ""               // needs manual attention
+	RepairSetImageHash = "set_image_hash" // point the note at its stored attachment
+	RepairClearImage   = "clear_image"    // drop a reference to a missing attachment
+	RepairDeleteRecord = "delete_record"  // the record is unreadable and cannot be recovered
+	RepairDeleteOrphan = "delete_orphan"  // nothing references the record (only with DeleteOrphans)
+	RepairSetRefs      = "set_refs"       // correct a shared attachment content's reference count
+)
+
+// IntegrityOptions selects which repairs CheckIntegrity applies
+type IntegrityOptions struct {
+	Repair        bool // apply set_image_hash, clear_image, delete_record and set_refs repairs
+	DeleteOrphans bool // also delete attachments and subscriptions without a note, and unreferenced attachment contents
+}
+
+// IntegrityIssue is one problem found by CheckIntegrity
+type IntegrityIssue struct {
+	Collection string `json:"collection"`
+	RecordID   string `json:"recordId"`
+	Problem    string `json:"problem"`
+	Repair     string `json:"repair,omitempty"` // RepairNone when it needs manual attention
+	Repaired   bool   `json:"repaired"`
+	RepairErr  string `json:"repairError,omitempty"`
+}
+
+// IntegrityReport summarises a CheckIntegrity run
+type IntegrityReport struct {
+	Checked map[string]int   `json:"checked"` // records checked per collection
+	Issues  []IntegrityIssue `json:"issues"`
+}
+
+// Unrepaired returns how many issues are still outstanding
+func (r *IntegrityReport) Unrepaired() int {
+	n := 0
+	for _, issue := range r.Issues {
+		if !issue.Repaired {
+			n++
+		}
+	}
+	return n
+}
+
+// IntegrityService checks stored notes, attachments and subscriptions for
+// corruption without knowing any passphrase: it can verify structure and
+// cross-references, but not that ciphertexts decrypt.
+type IntegrityService struct {
+	App   *pocketbase.PocketBase
+	Files *FileService
+}
+
+// NewIntegrityService creates a new integrity service
+func NewIntegrityService(app *pocketbase.PocketBase, files *FileService) *IntegrityService {
+	return &IntegrityService{
+		App:   app,
+		Files: files,
+	}
+}
+
+// storedFile is what CheckIntegrity learned about an encrypted_files record
+type storedFile struct {
+	record *core.Record
+	hash   string // sha256 of the stored ciphertext; empty when unreadable
+}
+
+// CheckIntegrity walks every note, attachment and subscription and reports
+// structural problems, applying the repairs enabled in opts.
+func (s *IntegrityService) CheckIntegrity(opts IntegrityOptions) (*IntegrityReport, error) {
+	report := &IntegrityReport{Checked: map[string]int{}}
+
+	// Attachments first, so notes can be cross-referenced against them
+	files := map[string][]storedFile{}
+	refs := map[string]int{} // attachment_contents id -> attachments using it
+	err := s.eachRecord("encrypted_files", func(rec *core.Record) {
+		report.Checked["encrypted_files"]++
+		if content := rec.GetString("content"); content != "" {
+			refs[content]++
+		}
+		phraseHash := rec.GetString("phrase_hash")
+		if problem := checkPhraseHash(phraseHash); problem != "" {
+			report.add(rec, problem, RepairNone)
+		}
+		if problem := checkEnvelope(rec.GetString("file_name")); problem != "" {
+			report.add(rec, "file_name "+problem, RepairNone)
+		}
+
+		file := storedFile{record: rec}
+		data, err := s.Files.readStoredFile(s.App, rec)
+		switch {
+		case err != nil:
+			report.add(rec, fmt.Sprintf("attachment data unreadable: %v", err), RepairDeleteRecord)
+		case len(data) < minEnvelopeSize:
+			report.add(rec, fmt.Sprintf("attachment ciphertext truncated (%d bytes)", len(data)), RepairDeleteRecord)
+		default:
+			file.hash = s.Files.hashBytes(data)
+			files[phraseHash] = append(files[phraseHash], file)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, list := range files {
+		for _, extra := range list[1:] {
+			report.add(extra.record, fmt.Sprintf("%d attachments share a phrase hash; only one is served", len(list)), RepairNone)
+		}
+	}
+
+	notes := map[string]bool{}
+	err = s.eachRecord("notes", func(rec *core.Record) {
+		report.Checked["notes"]++
+		phraseHash := rec.GetString("phrase_hash")
+		if problem := checkPhraseHash(phraseHash); problem != "" {
+			report.add(rec, problem, RepairNone)
+		}
+		if notes[phraseHash] {
+			report.add(rec, "another note has the same phrase hash; only one is served", RepairNone)
+		}
+		notes[phraseHash] = true
+
+		if problem := checkEnvelope(rec.GetString("message")); problem != "" {
+			report.add(rec, "message "+problem, RepairNone)
+		}
+		for _, field := range []string{"title", "tags"} {
+			if rec.GetString(field) == "" {
+				continue // optional
+			}
+			if problem := checkEnvelope(rec.GetString(field)); problem != "" {
+				report.add(rec, field+" "+problem, RepairNone)
+			}
+		}
+
+		imageHash := rec.GetString("image_hash")
+		attached := files[phraseHash]
+		switch {
+		case imageHash != "" && len(attached) == 0:
+			report.add(rec, "image_hash references a missing attachment", RepairClearImage)
+		case len(attached) > 0 && imageHash != attached[0].hash:
+			if imageHash == "" {
+				report.add(rec, "attachment exists but image_hash is empty", RepairSetImageHash)
+			} else {
+				report.add(rec, "image_hash does not match the stored attachment", RepairSetImageHash)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for phraseHash, list := range files {
+		if !notes[phraseHash] {
+			for _, file := range list {
+				report.add(file.record, "attachment has no note", RepairDeleteOrphan)
+			}
+		}
+	}
+
+	if _, err := s.App.FindCachedCollectionByNameOrId("attachment_contents"); err == nil {
+		err = s.eachRecord("attachment_contents", func(rec *core.Record) {
+			report.Checked["attachment_contents"]++
+			used, counted := refs[rec.Id], rec.GetInt("refs")
+			switch {
+			case used == 0:
+				report.add(rec, "attachment content is not used by any attachment", RepairDeleteOrphan)
+			case counted != used:
+				report.add(rec, fmt.Sprintf("reference count is %d but %d attachments use the content", counted, used), RepairSetRefs)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := s.App.FindCachedCollectionByNameOrId("note_subscriptions"); err == nil {
+		err = s.eachRecord("note_subscriptions", func(rec *core.Record) {
+			report.Checked["note_subscriptions"]++
+			if problem := checkEnvelope(rec.GetString("email")); problem != "" {
+				report.add(rec, "email "+problem, RepairNone)
+			}
+			if !notes[rec.GetString("phrase_hash")] {
+				report.add(rec, "subscription has no note", RepairDeleteOrphan)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.repair(report, files, refs, opts)
+	return report, nil
+}
+
+// repair applies the repairs enabled in opts, recording the outcome on each issue
+func (s *IntegrityService) repair(report *IntegrityReport, files map[string][]storedFile, refs map[string]int, opts IntegrityOptions) {
+	for i := range report.Issues {
+		issue := &report.Issues[i]
+		enabled := opts.Repair && issue.Repair != RepairNone && issue.Repair != RepairDeleteOrphan ||
+			opts.DeleteOrphans && issue.Repair == RepairDeleteOrphan
+		if !enabled {
+			continue
+		}
+
+		rec, err := s.App.FindRecordById(issue.Collection, issue.RecordID)
+		if err == nil {
+			switch issue.Repair {
+			case RepairSetImageHash:
+				rec.Set("image_hash", files[rec.GetString("phrase_hash")][0].hash)
+				err = s.App.Save(rec)
+			case RepairClearImage:
+				rec.Set("image_hash", "")
+				err = s.App.Save(rec)
+			case RepairSetRefs:
+				rec.Set("refs", refs[rec.Id])
+				err = s.App.Save(rec)
+			case RepairDeleteRecord, RepairDeleteOrphan:
+				err = s.App.Delete(rec)
+			}
+		}
+		if err != nil {
+			issue.RepairErr = err.Error()
+			continue
+		}
+		issue.Repaired = true
+	}
+}
+
+// eachRecord calls fn for every record of the collection, in batches
+func (s *IntegrityService) eachRecord(collection string, fn func(rec *core.Record)) error {
+	for offset := 0; ; offset += integrityBatchSize {
+		records, err := s.App.FindRecordsByFilter(collection, "", "id", integrityBatchSize, offset)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", collection, err)
+		}
+		for _, rec := range records {
+			fn(rec)
+		}
+		if len(records) < integrityBatchSize {
+			return nil
+		}
+	}
+}
+
+func (r *IntegrityReport) add(rec *core.Record, problem, repair string) {
+	r.Issues = append(r.Issues, IntegrityIssue{
+		Collection: rec.Collection().Name,
+		RecordID:   rec.Id,
+		Problem:    problem,
+		Repair:     repair,
+	})
+}
+
+// checkEnvelope describes what is wrong with a base64-encoded EncryptData
+// output, or returns "" when it looks well formed
+func checkEnvelope(value string) string {
+	if value == "" {
+		return "is empty"
+	}
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "is not valid base64"
+	}
+	if len(raw) < minEnvelopeSize {
+		return fmt.Sprintf("ciphertext is truncated (%d bytes)", len(raw))
+	}
+	if HasServerLayer(raw) {
+		return "" // the envelope inside is sealed with the server layer key
+	}
+	var envErr *EnvelopeError
+	if _, err := parseEnvelope(raw); errors.As(err, &envErr) {
+		return "ciphertext header is invalid: " + envErr.Reason
+	}
+	return ""
+}
+
+// checkPhraseHash describes what is wrong with a stored phrase hash, or returns "" when it is a sha256 hex digest
+func checkPhraseHash(value string) string {
+	if raw, err := hex.DecodeString(value); err != nil || len(raw) != 32 {
+		return "phrase_hash is not a sha256 hex digest"
+	}
+	return ""
+}
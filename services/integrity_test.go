@@ -0,0 +1,42 @@
+package services
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestCheckEnvelope(t *testing.T) {
+	enc := NewEncryptionService()
+	sealed, err := enc.EncryptData(nil, "phrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problem := checkEnvelope(base64.StdEncoding.EncodeToString(sealed)); problem != "" {
+		t.Errorf("valid empty-message envelope reported as %q", problem)
+	}
+
+	cases := map[string]string{
+		"":                     "is empty",
+		"not*base64":           "is not valid base64",
+		"c2hvcnQ=":             "ciphertext is truncated (5 bytes)",
+		strings.Repeat("A", 4): "ciphertext is truncated (3 bytes)",
+		base64.StdEncoding.EncodeToString(append([]byte("SNE\x09"), make([]byte, minEnvelopeSize)...)): "ciphertext header is invalid: unknown envelope version 9",
+	}
+	for value, want := range cases {
+		if got := checkEnvelope(value); got != want {
+			t.Errorf("checkEnvelope(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestCheckPhraseHash(t *testing.T) {
+	if problem := checkPhraseHash(NewEncryptionService().PhraseHash("phrase")); problem != "" {
+		t.Errorf("sha256 digest reported as %q", problem)
+	}
+	for _, value := range []string{"", "abc", strings.Repeat("z", 64)} {
+		if checkPhraseHash(value) == "" {
+			t.Errorf("checkPhraseHash(%q) accepted an invalid digest", value)
+		}
+	}
+}
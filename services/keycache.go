@@ -0,0 +1,121 @@
+package services
+
+import (
+	"container/list"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/ktappdev/secretnotes-go-backend/pkg/cryptobox"
+)
+
+// keyCache remembers recently derived keys so reading the same ciphertexts
+// again, as every request for a passphrase does, doesn't re-run the KDF.
+// Entries are looked up by an HMAC of the passphrase, salt and KDF params
+// under a secret drawn at startup, so the cache's index isn't a passphrase
+// verifier. It holds at most max keys, each for ttl, and evicts the least
+// recently used one first. Keys are zeroed when they leave the cache.
+type keyCache struct {
+	max int
+	ttl time.Duration
+
+	mu      sync.Mutex
+	secret  []byte
+	order   *list.List // most recently used first
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+type cachedKey struct {
+	id      string
+	key     []byte
+	expires time.Time
+}
+
+// newKeyCache creates a cache of at most max keys kept for ttl
+func newKeyCache(max int, ttl time.Duration) *keyCache {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return &keyCache{
+		max:     max,
+		ttl:     ttl,
+		secret:  secret,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// CacheKeys keeps up to n derived keys in memory for ttl, so repeated reads
+// of the same ciphertexts skip the KDF. It must be called before the service
+// is used; without it every key is derived afresh.
+func (s *Service) CacheKeys(n int, ttl time.Duration) {
+	if n > 0 && ttl > 0 {
+		s.keys = newKeyCache(n, ttl)
+	}
+}
+
+// id returns the cache index of the key params derive from phrase and salt
+func (c *keyCache) id(params cryptobox.KDFParams, phrase string, salt []byte) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(params.KDF))
+	mac.Write([]byte{0})
+	mac.Write(params.Encode())
+	mac.Write([]byte{byte(len(salt))})
+	mac.Write(salt)
+	mac.Write([]byte(phrase))
+	return string(mac.Sum(nil))
+}
+
+// get returns a copy of the key cached under id, or nil
+func (c *keyCache) get(id string) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[id]
+	if !ok {
+		return nil
+	}
+	entry := el.Value.(*cachedKey)
+	if !entry.expires.After(c.now()) {
+		c.remove(el)
+		return nil
+	}
+	c.order.MoveToFront(el)
+	return append([]byte(nil), entry.key...)
+}
+
+// put caches a copy of key under id, evicting expired keys and then the least
+// recently used ones to make room
+func (c *keyCache) put(id string, key []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if el, ok := c.entries[id]; ok {
+		c.remove(el)
+	}
+	for el := c.order.Back(); el != nil; {
+		prev := el.Prev()
+		if !el.Value.(*cachedKey).expires.After(now) {
+			c.remove(el)
+		}
+		el = prev
+	}
+	for c.order.Len() >= c.max {
+		c.remove(c.order.Back())
+	}
+	entry := &cachedKey{id: id, key: append([]byte(nil), key...), expires: now.Add(c.ttl)}
+	c.entries[id] = c.order.PushFront(entry)
+}
+
+// remove drops an entry and zeroes its key
+func (c *keyCache) remove(el *list.Element) {
+	entry := c.order.Remove(el).(*cachedKey)
+	delete(c.entries, entry.id)
+	clear(entry.key)
+}
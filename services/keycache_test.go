@@ -0,0 +1,71 @@
+package services
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ktappdev/secretnotes-go-backend/pkg/cryptobox"
+)
+
+func TestKeyCache(t *testing.T) {
+	c := newKeyCache(2, time.Minute)
+	now := time.Unix(1_700_000_000, 0)
+	c.now = func() time.Time { return now }
+
+	params := cryptobox.LegacyKDFParams(KDFPBKDF2)
+	a, b := c.id(params, "phrase", []byte("salt a")), c.id(params, "phrase", []byte("salt b"))
+	if a == b || a == c.id(params, "other phrase", []byte("salt a")) || a != c.id(params, "phrase", []byte("salt a")) {
+		t.Fatal("expected ids to depend on exactly the phrase and salt")
+	}
+
+	keyA := []byte("key a")
+	c.put(a, keyA)
+	c.put(b, []byte("key b"))
+	got := c.get(a)
+	if !bytes.Equal(got, keyA) {
+		t.Fatalf("expected the cached key, got %q", got)
+	}
+	got[0] = 'x' // callers get their own copy
+	if !bytes.Equal(c.get(a), keyA) {
+		t.Fatal("a returned key shares memory with the cache")
+	}
+
+	// b is the least recently used, so a third key evicts it and wipes it
+	stored := c.entries[b].Value.(*cachedKey).key
+	c.put(c.id(params, "phrase", []byte("salt c")), []byte("key c"))
+	if c.get(b) != nil || c.get(a) == nil {
+		t.Fatal("expected the least recently used key to be evicted")
+	}
+	if !bytes.Equal(stored, make([]byte, len(stored))) {
+		t.Fatalf("expected an evicted key to be zeroed, got %q", stored)
+	}
+
+	now = now.Add(time.Minute)
+	if c.get(a) != nil || len(c.entries) != 1 {
+		t.Fatal("expected keys to expire after the TTL")
+	}
+}
+
+func TestCachedKeyDerivation(t *testing.T) {
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	svc := NewEncryptionService()
+	svc.CacheKeys(10, time.Minute)
+
+	sealed, err := svc.EncryptData([]byte("cached"), phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if plain, err := svc.DecryptData(sealed, phrase); err != nil || string(plain) != "cached" {
+			t.Fatalf("read %d: got %q, %v", i, plain, err)
+		}
+	}
+	// the key derived to encrypt served both reads
+	if len(svc.keys.entries) != 1 {
+		t.Fatalf("expected one cached key, got %d", len(svc.keys.entries))
+	}
+	if _, err := svc.DecryptData(sealed, phrase+"x"); err == nil {
+		t.Fatal("expected another passphrase to miss the cache and fail")
+	}
+}
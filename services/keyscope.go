@@ -0,0 +1,120 @@
+package services
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ktappdev/secretnotes-go-backend/pkg/cryptobox"
+)
+
+// A key scope shares key derivations among the requests in flight for one
+// passphrase, so an API call that reads a note, stores an attachment and logs
+// the access pays the KDF once per salt rather than once per field. While a
+// scope is open, each stored salt is derived at most once, and everything
+// encrypted under the passphrase uses one salt drawn for the scope, so all new
+// fields share one derivation too. Fields written together then carry the
+// same salt; their keys still differ by purpose, and their nonces are random.
+// Derived keys are zeroed when the last request closes the scope.
+type keyScope struct {
+	refs int // guarded by Service.scopeMu
+
+	mu   sync.Mutex
+	salt []byte                // salt of new encryptions, drawn on first use
+	keys map[string]*scopedKey // by KDF params and salt
+}
+
+// scopedKey is a key derived once for a scope
+type scopedKey struct {
+	once sync.Once
+	key  []byte
+}
+
+// Scope opens a key scope for phrase, or joins the one already open for it.
+// Every call must be paired with a call of the returned end.
+func (s *Service) Scope(phrase string) (end func()) {
+	s.scopeMu.Lock()
+	defer s.scopeMu.Unlock()
+
+	if s.scopes == nil {
+		s.scopes = make(map[string]*keyScope)
+	}
+	sc, ok := s.scopes[phrase]
+	if !ok {
+		sc = &keyScope{keys: make(map[string]*scopedKey)}
+		s.scopes[phrase] = sc
+	}
+	sc.refs++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { s.endScope(phrase, sc) })
+	}
+}
+
+// endScope drops a reference to sc, wiping its keys after the last one
+func (s *Service) endScope(phrase string, sc *keyScope) {
+	s.scopeMu.Lock()
+	sc.refs--
+	last := sc.refs == 0
+	if last {
+		delete(s.scopes, phrase)
+	}
+	s.scopeMu.Unlock()
+
+	if last {
+		sc.mu.Lock()
+		defer sc.mu.Unlock()
+		for _, k := range sc.keys {
+			clear(k.key)
+		}
+		clear(sc.salt)
+	}
+}
+
+// scope returns the key scope open for phrase, or nil
+func (s *Service) scope(phrase string) *keyScope {
+	s.scopeMu.Lock()
+	defer s.scopeMu.Unlock()
+	return s.scopes[phrase]
+}
+
+// newSalt returns the salt for a new encryption under phrase: the scope's
+// when one is open, else a fresh one
+func (s *Service) newSalt(phrase string) ([]byte, error) {
+	sc := s.scope(phrase)
+	if sc == nil {
+		salt := make([]byte, s.SaltSize)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return nil, fmt.Errorf("failed to generate salt: %w", err)
+		}
+		return salt, nil
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if len(sc.salt) != s.SaltSize {
+		sc.salt = make([]byte, s.SaltSize)
+		if _, err := io.ReadFull(rand.Reader, sc.salt); err != nil {
+			return nil, fmt.Errorf("failed to generate salt: %w", err)
+		}
+	}
+	return append([]byte(nil), sc.salt...), nil
+}
+
+// derive returns a copy of the key params derive from salt, calling kdf the
+// first time it is asked for
+func (sc *keyScope) derive(params cryptobox.KDFParams, salt []byte, kdf func() []byte) []byte {
+	id := params.KDF + "\x00" + string(params.Encode()) + "\x00" + string(salt)
+	sc.mu.Lock()
+	k, ok := sc.keys[id]
+	if !ok {
+		k = &scopedKey{}
+		sc.keys[id] = k
+	}
+	sc.mu.Unlock()
+
+	k.once.Do(func() { k.key = kdf() })
+	return append([]byte(nil), k.key...)
+}
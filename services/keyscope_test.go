@@ -0,0 +1,88 @@
+package services
+
+import (
+	"bytes"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ktappdev/secretnotes-go-backend/pkg/cryptobox"
+)
+
+func TestKeyScope(t *testing.T) {
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	svc := NewEncryptionService()
+
+	// outside a scope every encryption gets its own salt
+	a, _ := svc.EncryptData([]byte("a"), phrase)
+	b, _ := svc.EncryptData([]byte("b"), phrase)
+	envA, _ := parseEnvelope(a)
+	envB, _ := parseEnvelope(b)
+	if bytes.Equal(envA.Salt, envB.Salt) {
+		t.Fatal("expected fresh salts without a scope")
+	}
+
+	end := svc.Scope(phrase)
+	sc := svc.scope(phrase)
+	endAgain := svc.Scope(phrase) // a second request joins the same scope
+	if svc.scope(phrase) != sc {
+		t.Fatal("expected concurrent requests to share a scope")
+	}
+
+	message, err := svc.EncryptBound([]byte("message"), phrase, FieldBinding("notes", "abc123", "message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunked, err := svc.EncryptChunked([]byte("file"), phrase, FieldBinding("attachment_contents", "abc123", "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	envMessage, _ := parseEnvelope(message)
+	if !bytes.Contains(chunked, envMessage.Salt) {
+		t.Fatal("expected encryptions in a scope to share its salt")
+	}
+	if plain, err := svc.DecryptData(a, phrase); err != nil || string(plain) != "a" {
+		t.Fatalf("got %q, %v", plain, err)
+	}
+	// the new salt and a's were each derived once
+	if len(sc.keys) != 2 {
+		t.Fatalf("expected 2 derivations in the scope, got %d", len(sc.keys))
+	}
+
+	end()
+	end() // ending twice is harmless
+	if svc.scope(phrase) == nil {
+		t.Fatal("expected the scope to stay open for the other request")
+	}
+	endAgain()
+	if svc.scope(phrase) != nil {
+		t.Fatal("expected the scope to close with its last request")
+	}
+	for _, k := range sc.keys {
+		if !bytes.Equal(k.key, make([]byte, len(k.key))) {
+			t.Fatal("expected the scope's keys to be zeroed")
+		}
+	}
+}
+
+func TestKeyScopeDerivesOnce(t *testing.T) {
+	sc := &keyScope{keys: make(map[string]*scopedKey)}
+	var calls atomic.Int32
+	kdf := func() []byte {
+		calls.Add(1)
+		return []byte("key")
+	}
+	params := cryptobox.LegacyKDFParams(KDFPBKDF2)
+	done := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		go func() {
+			sc.derive(params, []byte("salt"), kdf)
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		<-done
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected one derivation, got %d", calls.Load())
+	}
+}
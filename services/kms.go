@@ -0,0 +1,163 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ktappdev/secretnotes-go-backend/pkg/cryptobox"
+)
+
+// KeyWrapper wraps and unwraps data keys with a key that never leaves an
+// external KMS or HSM
+type KeyWrapper interface {
+	WrapKey(key []byte) ([]byte, error)
+	UnwrapKey(wrapped []byte) ([]byte, error)
+}
+
+// ErrKMS is matched when the KMS can't wrap or unwrap a data key. Unlike
+// ErrDecryptionFailed it says nothing about the passphrase: the KMS may just
+// be unreachable.
+var ErrKMS = errors.New("key management service failed")
+
+// ErrNoKMS is matched when a ciphertext has a KMS-wrapped data key but the
+// server isn't configured with a KMS
+var ErrNoKMS = errors.New("no key management service is configured")
+
+// maxWrappedKeySize bounds the wrapped data keys an envelope may record
+const maxWrappedKeySize = cryptobox.MaxWrappedKeySize
+
+// kmsKeys is the KMS layer of a service: the data key new encryptions use,
+// and the data keys of older ciphertexts unwrapped so far
+type kmsKeys struct {
+	wrapper KeyWrapper
+	wrapped []byte // current data key, as the KMS wrapped it
+
+	mu        sync.Mutex
+	unwrapped map[string][]byte // by wrapped key
+}
+
+// UseKMS adds a layer of envelope encryption to stored fields: a data key
+// drawn now is wrapped by w, recorded in every field encrypted from here on,
+// and mixed into its key, so reading a field takes the passphrase and the
+// KMS both. Keys wrapped by earlier runs are unwrapped on first use and kept
+// in memory. It must be called before the service is used.
+func (s *Service) UseKMS(w KeyWrapper) error {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return fmt.Errorf("failed to generate data key: %w", err)
+	}
+	wrapped, err := w.WrapKey(key)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrKMS, err)
+	}
+	if len(wrapped) == 0 || len(wrapped) > maxWrappedKeySize {
+		return fmt.Errorf("%w: wrapped key is %d bytes", ErrKMS, len(wrapped))
+	}
+	// fail now rather than on the first read if the KMS can't unwrap its keys
+	unwrapped, err := w.UnwrapKey(wrapped)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrKMS, err)
+	}
+	if !hmac.Equal(unwrapped, key) {
+		return fmt.Errorf("%w: unwrapping the data key gave a different key", ErrKMS)
+	}
+	s.kms = &kmsKeys{wrapper: w, wrapped: wrapped, unwrapped: map[string][]byte{string(wrapped): key}}
+	return nil
+}
+
+// kmsFor returns the wrapped data key new encryptions bound by b record:
+// stored fields get the current one when a KMS is configured, anything else
+// (such as export archives, which must open on other servers) none
+func (s *Service) kmsFor(b Binding) []byte {
+	if b.Purpose == "" || s.kms == nil {
+		return nil
+	}
+	return s.kms.wrapped
+}
+
+// dataKey returns the data key wrapped as wrapped, asking the KMS the first
+// time
+func (s *Service) dataKey(wrapped []byte) ([]byte, error) {
+	if s.kms == nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptionFailed, ErrNoKMS)
+	}
+	s.kms.mu.Lock()
+	defer s.kms.mu.Unlock()
+	if key, ok := s.kms.unwrapped[string(wrapped)]; ok {
+		return key, nil
+	}
+	key, err := s.kms.wrapper.UnwrapKey(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKMS, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%w: unwrapped key is %d bytes", ErrKMS, len(key))
+	}
+	s.kms.unwrapped[string(wrapped)] = key
+	return key, nil
+}
+
+// mixDataKey mixes the data key wrapped as wrapped into key
+func (s *Service) mixDataKey(key, wrapped []byte) ([]byte, error) {
+	dataKey, err := s.dataKey(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, dataKey)
+	mac.Write(key)
+	return mac.Sum(nil), nil
+}
+
+// CommandKeyWrapper is a KeyWrapper that runs a plugin command, so any KMS
+// or HSM with a command line client can be used (aws kms, gcloud kms, age
+// with a plugin, a PKCS#11 tool). The command is run with "wrap" or "unwrap"
+// appended to its arguments; it reads the key on stdin and writes the result
+// to stdout.
+type CommandKeyWrapper struct {
+	Command []string      // program and arguments
+	Timeout time.Duration // per call; 0 waits indefinitely
+}
+
+// WrapKey runs the command to wrap key
+func (c *CommandKeyWrapper) WrapKey(key []byte) ([]byte, error) {
+	return c.run("wrap", key)
+}
+
+// UnwrapKey runs the command to unwrap wrapped
+func (c *CommandKeyWrapper) UnwrapKey(wrapped []byte) ([]byte, error) {
+	return c.run("unwrap", wrapped)
+}
+
+func (c *CommandKeyWrapper) run(op string, in []byte) ([]byte, error) {
+	if len(c.Command) == 0 {
+		return nil, errors.New("no KMS command is set")
+	}
+	ctx := context.Background()
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, c.Command[0], append(c.Command[1:], op)...)
+	cmd.Stdin = bytes.NewReader(in)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s %s: %w: %s", c.Command[0], op, err, msg)
+		}
+		return nil, fmt.Errorf("%s %s: %w", c.Command[0], op, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+// testKMS wraps keys with an AES-GCM key made of seed, counting unwraps
+type testKMS struct {
+	aead    cipher.AEAD
+	unwraps int
+}
+
+func newTestKMS(t *testing.T, seed byte) *testKMS {
+	block, err := aes.NewCipher(bytes.Repeat([]byte{seed}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testKMS{aead: aead}
+}
+
+func (k *testKMS) WrapKey(key []byte) ([]byte, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	return k.aead.Seal(nonce, nonce, key, nil), nil
+}
+
+func (k *testKMS) UnwrapKey(wrapped []byte) ([]byte, error) {
+	k.unwraps++
+	n := k.aead.NonceSize()
+	return k.aead.Open(nil, wrapped[:n], wrapped[n:], nil)
+}
+
+func TestKMS(t *testing.T) {
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	b := FieldBinding("notes", "abc123", "message")
+	fileBinding := FieldBinding("attachment_contents", "abc123", "data")
+
+	plain := NewEncryptionService()
+	unwrapped, _ := plain.EncryptBound([]byte("hello"), phrase, b)
+
+	kms := newTestKMS(t, 7)
+	svc := NewEncryptionService()
+	if err := svc.UseKMS(kms); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := svc.EncryptBound([]byte("hello"), phrase, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := parseEnvelope(sealed)
+	if err != nil || sealed[3] != wrappedEnvelopeVersion || !bytes.Equal(env.WrappedKey, svc.kms.wrapped) {
+		t.Fatalf("expected a version %d envelope with the wrapped data key, got %+v, %v", wrappedEnvelopeVersion, env, err)
+	}
+	if svc.Outdated(sealed, b) || !svc.Outdated(unwrapped, b) {
+		t.Fatal("expected only fields without a data key to be outdated")
+	}
+	if got, err := svc.DecryptBound(unwrapped, phrase, b); err != nil || string(got) != "hello" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	chunked, err := svc.EncryptChunked([]byte("file"), phrase, fileBinding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(chunked, wrappedChunkedMagic) {
+		t.Fatalf("expected an SNC6 envelope, got %q", chunked[:4])
+	}
+
+	// the passphrase alone doesn't open it
+	if _, err := plain.DecryptBound(sealed, phrase, b); !errors.Is(err, ErrNoKMS) || !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("expected ErrNoKMS, got %v", err)
+	}
+	if _, err := svc.DecryptBound(sealed, "wrong passphrase that is long enough to be accepted", b); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("expected the wrong passphrase to fail, got %v", err)
+	}
+
+	// a later run unwraps the earlier data key once
+	restarted := NewEncryptionService()
+	if err := restarted.UseKMS(kms); err != nil {
+		t.Fatal(err)
+	}
+	unwraps := kms.unwraps
+	for range 2 {
+		if got, err := restarted.DecryptBound(sealed, phrase, b); err != nil || string(got) != "hello" {
+			t.Fatalf("got %q, %v", got, err)
+		}
+	}
+	if got, err := restarted.DecryptChunked(chunked, phrase, fileBinding); err != nil || string(got) != "file" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if kms.unwraps != unwraps+1 {
+		t.Fatalf("expected 1 unwrap, got %d", kms.unwraps-unwraps)
+	}
+
+	// a KMS that can't unwrap fails without blaming the passphrase
+	other := NewEncryptionService()
+	if err := other.UseKMS(kms); err != nil {
+		t.Fatal(err)
+	}
+	other.kms.wrapper = newTestKMS(t, 8) // can't open kms's keys
+	if _, err := other.DecryptBound(sealed, phrase, b); !errors.Is(err, ErrKMS) || errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("expected ErrKMS, got %v", err)
+	}
+
+	// archives don't depend on the KMS
+	archive, _ := svc.EncryptData([]byte("export"), phrase)
+	if got, err := plain.DecryptData(archive, phrase); err != nil || string(got) != "export" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+}
+
+func TestCommandKeyWrapper(t *testing.T) {
+	if _, err := exec.LookPath("base64"); err != nil {
+		t.Skip("base64 is not installed")
+	}
+	// a stand-in plugin: base64 "wraps" keys
+	w := &CommandKeyWrapper{Command: []string{"sh", "-c", `if [ "$1" = wrap ]; then base64; else base64 -d; fi`, "kms"}}
+	svc := NewEncryptionService()
+	if err := svc.UseKMS(w); err != nil {
+		t.Fatal(err)
+	}
+
+	failing := &CommandKeyWrapper{Command: []string{"sh", "-c", `echo "access denied" >&2; exit 1`, "kms"}}
+	if err := NewEncryptionService().UseKMS(failing); !errors.Is(err, ErrKMS) {
+		t.Fatalf("expected ErrKMS, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrLockHeld is returned when another session holds the note's editing lock
+var ErrLockHeld = errors.New("note is being edited by another session")
+
+// Lock is an advisory, short-lived editing lock on a note
+type Lock struct {
+	SessionID string    `json:"sessionId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// LockService keeps advisory editing locks in memory. Locks expire unless the
+// holder renews them by heartbeat, so a crashed client never blocks others
+// for long. Locks are advisory: writes are not rejected, clients are expected
+// to warn their user instead.
+type LockService struct {
+	TTL time.Duration
+
+	mu    sync.Mutex
+	locks map[string]Lock
+}
+
+// NewLockService creates a lock service whose locks last ttl without renewal
+func NewLockService(ttl time.Duration) *LockService {
+	return &LockService{
+		TTL:   ttl,
+		locks: make(map[string]Lock),
+	}
+}
+
+// Acquire takes or renews the lock on the phrase's note for sessionID. If
+// another live session holds it, the current lock is returned with ErrLockHeld.
+func (l *LockService) Acquire(phrase, sessionID string) (Lock, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now().UTC()
+	key := l.hashPhrase(phrase)
+
+	if current, ok := l.locks[key]; ok && current.SessionID != sessionID && current.ExpiresAt.After(now) {
+		return current, ErrLockHeld
+	}
+
+	lock := Lock{SessionID: sessionID, ExpiresAt: now.Add(l.TTL)}
+	l.locks[key] = lock
+	l.sweep(now)
+	return lock, nil
+}
+
+// Release drops the lock if sessionID holds it
+func (l *LockService) Release(phrase, sessionID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := l.hashPhrase(phrase)
+	if current, ok := l.locks[key]; ok && current.SessionID == sessionID {
+		delete(l.locks, key)
+	}
+}
+
+// Current returns the live lock on the phrase's note, if any
+func (l *LockService) Current(phrase string) (Lock, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	current, ok := l.locks[l.hashPhrase(phrase)]
+	if !ok || !current.ExpiresAt.After(time.Now()) {
+		return Lock{}, false
+	}
+	return current, true
+}
+
+// sweep drops expired locks so the map doesn't grow without bound
+func (l *LockService) sweep(now time.Time) {
+	for key, lock := range l.locks {
+		if !lock.ExpiresAt.After(now) {
+			delete(l.locks, key)
+		}
+	}
+}
+
+// hashPhrase creates a SHA-256 hash of the phrase for secure storage and lookup
+func (l *LockService) hashPhrase(phrase string) string {
+	hash := sha256.Sum256([]byte(phrase))
+	return hex.EncodeToString(hash[:])
+}
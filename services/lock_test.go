@@ -0,0 +1,48 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockServiceAcquire(t *testing.T) {
+	locks := NewLockService(time.Minute)
+
+	if _, err := locks.Acquire("phrase", "a"); err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+	if _, err := locks.Acquire("phrase", "a"); err != nil {
+		t.Fatalf("renew by holder: %v", err)
+	}
+	if _, err := locks.Acquire("phrase", "b"); !errors.Is(err, ErrLockHeld) {
+		t.Fatalf("acquire by other session: got %v, want ErrLockHeld", err)
+	}
+	if _, err := locks.Acquire("other phrase", "b"); err != nil {
+		t.Fatalf("acquire on another note: %v", err)
+	}
+
+	locks.Release("phrase", "b") // not the holder: no-op
+	if _, ok := locks.Current("phrase"); !ok {
+		t.Fatal("lock released by a session that didn't hold it")
+	}
+
+	locks.Release("phrase", "a")
+	if _, err := locks.Acquire("phrase", "b"); err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+}
+
+func TestLockServiceExpiry(t *testing.T) {
+	locks := NewLockService(-time.Second) // every lock is already expired
+
+	if _, err := locks.Acquire("phrase", "a"); err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+	if _, ok := locks.Current("phrase"); ok {
+		t.Fatal("expired lock reported as current")
+	}
+	if _, err := locks.Acquire("phrase", "b"); err != nil {
+		t.Fatalf("acquire over expired lock: %v", err)
+	}
+}
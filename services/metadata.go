@@ -0,0 +1,144 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Limits on note metadata, checked by NormalizeMetadata
+const (
+	MaxTitleLength = 200 // characters
+	MaxTags        = 20
+	MaxTagLength   = 40 // characters
+)
+
+// ErrInvalidMetadata is returned when a title or tag list breaks the limits above
+var ErrInvalidMetadata = errors.New("invalid note metadata")
+
+// NoteMetadata is an optional title and tag list for a note. Nil fields are
+// left unchanged on update. Both are encrypted with the passphrase like the
+// message, so the server never sees them either.
+type NoteMetadata struct {
+	Title *string   `json:"title"`
+	Tags  *[]string `json:"tags"`
+}
+
+// NormalizeMetadata trims the title and tags, drops empty and duplicate tags,
+// and checks the limits
+func NormalizeMetadata(meta NoteMetadata) (NoteMetadata, error) {
+	if meta.Title != nil {
+		title := strings.TrimSpace(*meta.Title)
+		if utf8.RuneCountInString(title) > MaxTitleLength {
+			return meta, fmt.Errorf("%w: title is longer than %d characters", ErrInvalidMetadata, MaxTitleLength)
+		}
+		meta.Title = &title
+	}
+	if meta.Tags != nil {
+		tags := []string{}
+		seen := map[string]bool{}
+		for _, tag := range *meta.Tags {
+			tag = strings.TrimSpace(tag)
+			if tag == "" || seen[tag] {
+				continue
+			}
+			if utf8.RuneCountInString(tag) > MaxTagLength {
+				return meta, fmt.Errorf("%w: tag %q is longer than %d characters", ErrInvalidMetadata, tag, MaxTagLength)
+			}
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+		if len(tags) > MaxTags {
+			return meta, fmt.Errorf("%w: more than %d tags", ErrInvalidMetadata, MaxTags)
+		}
+		meta.Tags = &tags
+	}
+	return meta, nil
+}
+
+// mergeTags appends the tags of b missing from a, keeping at most MaxTags
+func mergeTags(a, b []string) []string {
+	merged := append([]string{}, a...)
+	for _, tag := range b {
+		if len(merged) == MaxTags {
+			break
+		}
+		if !slices.Contains(merged, tag) {
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
+
+// ApplyMetadata encrypts the set fields of meta into a note record. Empty
+// values are stored as empty fields rather than encrypted empty strings.
+func (n *NoteService) ApplyMetadata(record *core.Record, phrase string, meta NoteMetadata) error {
+	if meta.Title != nil {
+		value, err := n.encryptField(record, "title", []byte(*meta.Title), phrase)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt title: %w", err)
+		}
+		record.Set("title", value)
+	}
+	if meta.Tags != nil {
+		var raw []byte
+		if len(*meta.Tags) > 0 {
+			raw, _ = json.Marshal(*meta.Tags)
+		}
+		value, err := n.encryptField(record, "tags", raw, phrase)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt tags: %w", err)
+		}
+		record.Set("tags", value)
+	}
+	return nil
+}
+
+// Metadata decrypts a note record's title and tags. Fields that are missing or
+// fail to decrypt come back empty, so a damaged title never hides the note.
+func (n *NoteService) Metadata(record *core.Record, phrase string) (string, []string) {
+	title, _ := n.decryptField(record, "title", phrase)
+
+	tags := []string{}
+	if raw, err := n.decryptField(record, "tags", phrase); err == nil && len(raw) > 0 {
+		if err := json.Unmarshal(raw, &tags); err != nil {
+			tags = []string{}
+		}
+	}
+	return string(title), tags
+}
+
+// rekeyMetadata re-encrypts a note record's title and tags from oldPhrase to newPhrase
+func (n *NoteService) rekeyMetadata(record *core.Record, oldPhrase, newPhrase string) error {
+	title, tags := n.Metadata(record, oldPhrase)
+	return n.ApplyMetadata(record, newPhrase, NoteMetadata{Title: &title, Tags: &tags})
+}
+
+func (n *NoteService) encryptField(record *core.Record, field string, plain []byte, phrase string) (string, error) {
+	if len(plain) == 0 {
+		return "", nil
+	}
+	encrypted, err := n.Encryption.EncryptBound(plain, phrase, recordBinding(record, field))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+func (n *NoteService) decryptField(record *core.Record, field, phrase string) ([]byte, error) {
+	value := record.GetString(field)
+	if value == "" {
+		return nil, nil
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid base64", ErrCorruptCiphertext)
+	}
+	return n.Encryption.DecryptBound(encrypted, phrase, recordBinding(record, field))
+}
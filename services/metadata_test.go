@@ -0,0 +1,49 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeMetadata(t *testing.T) {
+	title := "  Shopping  "
+	tags := []string{" home ", "", "home", "work"}
+	meta, err := NormalizeMetadata(NoteMetadata{Title: &title, Tags: &tags})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *meta.Title != "Shopping" || !slices.Equal(*meta.Tags, []string{"home", "work"}) {
+		t.Errorf("got title %q, tags %q", *meta.Title, *meta.Tags)
+	}
+
+	if meta, err := NormalizeMetadata(NoteMetadata{}); err != nil || meta.Title != nil || meta.Tags != nil {
+		t.Errorf("unset fields should stay unset: %+v, %v", meta, err)
+	}
+
+	long := strings.Repeat("é", MaxTitleLength+1)
+	if _, err := NormalizeMetadata(NoteMetadata{Title: &long}); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("long title: got %v", err)
+	}
+	many := make([]string, MaxTags+1)
+	for i := range many {
+		many[i] = strings.Repeat("x", i+1)
+	}
+	if _, err := NormalizeMetadata(NoteMetadata{Tags: &many}); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("too many tags: got %v", err)
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	if got := mergeTags([]string{"a", "b"}, []string{"b", "c"}); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("mergeTags = %q", got)
+	}
+	full := make([]string, MaxTags)
+	for i := range full {
+		full[i] = strings.Repeat("x", i+1)
+	}
+	if got := mergeTags(full, []string{"extra"}); len(got) != MaxTags {
+		t.Errorf("mergeTags kept %d tags, want %d", len(got), MaxTags)
+	}
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrContentTypeMismatch is returned when an upload's declared type
+	// contradicts what its bytes are
+	ErrContentTypeMismatch = errors.New("content type does not match the file")
+
+	// ErrContentTypeNotAllowed is returned for uploads whose type is not in
+	// the configured allowlist
+	ErrContentTypeNotAllowed = errors.New("content type is not allowed")
+)
+
+// sniffAliases lists, per type http.DetectContentType reports, declared types
+// naming the same format more precisely or by another name
+var sniffAliases = map[string][]string{
+	"audio/wave":         {"audio/wav", "audio/x-wav", "audio/vnd.wave"},
+	"audio/mpeg":         {"audio/mp3", "audio/x-mp3", "audio/mpeg3"},
+	"audio/aiff":         {"audio/x-aiff"},
+	"application/ogg":    {"audio/ogg", "video/ogg", "audio/opus", "audio/vorbis"},
+	"video/webm":         {"audio/webm"},
+	"video/mp4":          {"audio/mp4", "audio/x-m4a", "audio/m4a", "video/quicktime"},
+	"video/avi":          {"video/x-msvideo"},
+	"application/x-gzip": {"application/gzip"},
+	"application/zip":    {"application/x-zip-compressed", "application/java-archive"},
+	"image/x-icon":       {"image/vnd.microsoft.icon"},
+	"image/bmp":          {"image/x-ms-bmp"},
+	"text/xml":           {"application/xml"},
+}
+
+// SniffContentType returns the type to store for an upload: the type its
+// bytes are sniffed as, or declared when the sniffer can't tell or declared
+// names the sniffed format more precisely (audio/mp4 for video/mp4, or
+// text/markdown for plain text). A declared type that contradicts the content,
+// such as image/png for an HTML page, is ErrContentTypeMismatch.
+func SniffContentType(content []byte, declared string) (string, error) {
+	detected := http.DetectContentType(content)
+	detectedType, _, _ := mime.ParseMediaType(detected)
+
+	declaredType, params, err := mime.ParseMediaType(declared)
+	if err != nil || declaredType == "application/octet-stream" {
+		return detected, nil
+	}
+	if detectedType == "application/octet-stream" || detectedType == declaredType || compatibleType(detectedType, declaredType) {
+		return mime.FormatMediaType(declaredType, params), nil
+	}
+	return "", fmt.Errorf("%w: declared %s but the content is %s", ErrContentTypeMismatch, declaredType, detectedType)
+}
+
+// compatibleType reports whether declared can describe content sniffed as detected
+func compatibleType(detected, declared string) bool {
+	for _, alias := range sniffAliases[detected] {
+		if declared == alias {
+			return true
+		}
+	}
+	switch detected {
+	case "text/plain":
+		// JSON, CSV, Markdown, scripts, ... all sniff as plain text
+		return declared != "text/html" && (strings.HasPrefix(declared, "text/") || strings.HasPrefix(declared, "application/"))
+	case "text/xml":
+		return strings.HasSuffix(declared, "+xml")
+	case "application/zip":
+		// office documents, EPUB and other zip containers
+		return strings.HasSuffix(declared, "+zip") || strings.HasPrefix(declared, "application/vnd.")
+	}
+	return false
+}
+
+// ContentTypeAllowed reports whether contentType matches one of patterns:
+// exact types like application/pdf, or wildcards like image/* and */*. No
+// patterns allow everything.
+func ContentTypeAllowed(contentType string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if pattern == "*" || pattern == "*/*" || pattern == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
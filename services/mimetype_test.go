@@ -0,0 +1,71 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestSniffContentType(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	pngData := buf.Bytes()
+	html := []byte("<!DOCTYPE html><html><script>alert(1)</script></html>")
+	wav := append([]byte("RIFF\x00\x00\x00\x00WAVEfmt "), make([]byte, 32)...)
+	unknown := []byte{0x00, 0x01, 0x02, 0x03, 0xff, 0xfe}
+
+	for _, tc := range []struct {
+		name, declared, want string
+		content              []byte
+	}{
+		{"matching", "image/png", "image/png", pngData},
+		{"no declared type", "", "image/png", pngData},
+		{"octet-stream declared", "application/octet-stream", "image/png", pngData},
+		{"alias", "audio/x-wav", "audio/x-wav", wav},
+		{"text subtype", "text/markdown", "text/markdown", []byte("# Title\n\nbody\n")},
+		{"json", "application/json", "application/json", []byte(`{"a": 1}`)},
+		{"unrecognised bytes", "image/heic", "image/heic", unknown},
+		{"nothing known", "", "application/octet-stream", unknown},
+	} {
+		got, err := SniffContentType(tc.content, tc.declared)
+		if err != nil || got != tc.want {
+			t.Errorf("%s: expected %q, got %q (%v)", tc.name, tc.want, got, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name, declared string
+		content        []byte
+	}{
+		{"html as image", "image/png", html},
+		{"png as jpeg", "image/jpeg", pngData},
+		{"html as text", "text/plain", html},
+	} {
+		if _, err := SniffContentType(tc.content, tc.declared); !errors.Is(err, ErrContentTypeMismatch) {
+			t.Errorf("%s: expected ErrContentTypeMismatch, got %v", tc.name, err)
+		}
+	}
+}
+
+func TestContentTypeAllowed(t *testing.T) {
+	patterns := []string{"image/*", "audio/*", "application/pdf"}
+	for contentType, want := range map[string]bool{
+		"image/png":                 true,
+		"audio/mpeg":                true,
+		"application/pdf":           true,
+		"text/plain; charset=utf-8": false,
+		"application/zip":           false,
+		"imagery/png":               false,
+	} {
+		if got := ContentTypeAllowed(contentType, patterns); got != want {
+			t.Errorf("%s: expected %v, got %v", contentType, want, got)
+		}
+	}
+	if !ContentTypeAllowed("application/zip", nil) {
+		t.Error("no patterns should allow everything")
+	}
+}
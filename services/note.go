@@ -1,9 +1,8 @@
 package services
 
 import (
-	"crypto/sha256"
 	"encoding/base64"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -11,22 +10,39 @@ import (
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/dbx"
+
+	"github.com/ktappdev/secretnotes-go-backend/cryptoutil"
 )
 
+// ErrNoteNotFound is returned when no note exists for the passphrase
+var ErrNoteNotFound = errors.New("note not found")
+
+// ErrPhraseInUse is returned when a note already exists under the target passphrase
+var ErrPhraseInUse = errors.New("a note already exists for the new passphrase")
+
 // Note represents a secret note
 type Note struct {
-	ID        string    `json:"id"`
-    Phrase    string    `json:"phrase"`    // Encrypted identifier
-	Message   string    `json:"message"`   // Encrypted note content
-	ImageHash string    `json:"image_hash"` // Hash for encrypted image lookup
-	Created   time.Time `json:"created"`
-	Updated   time.Time `json:"updated"`
+	ID           string     `json:"id"`
+    Phrase       string     `json:"phrase"`       // Encrypted identifier
+	Message      string     `json:"message"`      // Encrypted note content
+	Title        string     `json:"title"`        // Optional, encrypted like the message
+	Tags         []string   `json:"tags"`         // Optional, encrypted like the message; never nil
+	ImageHash    string     `json:"image_hash"`   // Hash for encrypted image lookup
+	Created      time.Time  `json:"created"`
+	Updated      time.Time  `json:"updated"`
+	DestroyAt    *time.Time `json:"destroyAt"`    // Scheduled deletion, nil when none
+	AccessCount  int        `json:"accessCount"`  // Successful reads before the current one
+	LastAccessed *time.Time `json:"lastAccessed"` // When the note was last read before now; nil if never
+	ReadOnly     bool       `json:"readOnly"`     // Changes are refused until the flag is cleared
 }
 
 // NoteService handles note operations
 type NoteService struct {
 	App        *pocketbase.PocketBase
 	Encryption *Service
+
+	accessHooks []func(phraseHash string)
+	quota       Quota
 }
 
 // NewNoteService creates a new note service
@@ -37,11 +53,17 @@ func NewNoteService(app *pocketbase.PocketBase, encryption *Service) *NoteServic
 	}
 }
 
-// GetOrCreateNote retrieves an existing note or creates a new one
-func (n *NoteService) GetOrCreateNote(phrase string) (*Note, error) {
+// OnAccess registers a callback invoked whenever an existing note is read
+func (n *NoteService) OnAccess(fn func(phraseHash string)) {
+	n.accessHooks = append(n.accessHooks, fn)
+}
+
+// GetOrCreateNote retrieves an existing note or creates a new one, reporting
+// whether it was created by this call
+func (n *NoteService) GetOrCreateNote(phrase string) (*Note, bool, error) {
 	// Validate phrase length
 	if len(phrase) < 3 {
-		return nil, fmt.Errorf("phrase must be at least 3 characters long")
+		return nil, false, fmt.Errorf("phrase must be at least 3 characters long")
 	}
 
 	// Hash the phrase for secure lookup
@@ -50,76 +72,119 @@ func (n *NoteService) GetOrCreateNote(phrase string) (*Note, error) {
 	// Try to find existing note
 	records, err := n.App.FindRecordsByFilter("notes", "phrase_hash = {:phrase_hash}", "", 1, 0, dbx.Params{"phrase_hash": phraseHash})
 	if err != nil {
-		return nil, fmt.Errorf("failed to query notes: %w", err)
+		return nil, false, fmt.Errorf("failed to query notes: %w", err)
 	}
 
-	if len(records) > 0 {
-		// Note exists, decrypt and return
-		record := records[0]
-		encryptedMessageB64 := record.GetString("message")
-		var message string
-
-		if encryptedMessageB64 != "" {
-			// Decode from base64 first
-			encryptedMessage, err := base64.StdEncoding.DecodeString(encryptedMessageB64)
-			if err != nil {
-				// If decode fails, assume it's old format or plaintext
-				message = encryptedMessageB64
-			} else {
-				// Try to decrypt the message
-				decryptedBytes, err := n.Encryption.DecryptData(encryptedMessage, phrase)
-				if err != nil {
-					// If decryption fails, assume it's plaintext
-					message = encryptedMessageB64
-				} else {
-					message = string(decryptedBytes)
-				}
-			}
+	if len(records) > 0 && destroyDue(records[0]) {
+		// past its scheduled deletion; finish the job and start afresh
+		if err := n.deleteNoteRecord(records[0]); err != nil {
+			return nil, false, err
 		}
+		records = nil
+	}
 
-		return &Note{
-			ID:        record.Id,
-			Phrase:    phraseHash, // Store hash, not original phrase
-			Message:   message,
-			ImageHash: record.GetString("image_hash"),
-			Created:   record.GetDateTime("created").Time(),
-			Updated:   record.GetDateTime("updated").Time(),
-		}, nil
+	if len(records) > 0 {
+		return n.openNote(records[0], phrase), false, nil
 	}
 
 	// Create new note
-	collection, err := n.App.FindCollectionByNameOrId("notes")
+	collection, err := n.App.FindCachedCollectionByNameOrId("notes")
 	if err != nil {
-		return nil, fmt.Errorf("notes collection not found: %w", err)
+		return nil, false, fmt.Errorf("notes collection not found: %w", err)
 	}
 
 	record := core.NewRecord(collection)
+	record.Set("id:autogenerate", "") // the ciphertext is bound to the id
 	record.Set("phrase_hash", phraseHash)
 
-	// Create an encrypted empty message (encode as base64 to prevent corruption)
-	encryptedMessage, err := n.Encryption.EncryptData([]byte(""), phrase)
+	// Create an encrypted empty message
+	encryptedMessage, err := n.Encryption.EncryptStringBound("", phrase, recordBinding(record, "message"))
 	if err != nil {
-		return nil, fmt.Errorf("failed to encrypt initial message: %w", err)
+		return nil, false, fmt.Errorf("failed to encrypt initial message: %w", err)
 	}
 
-	record.Set("message", base64.StdEncoding.EncodeToString(encryptedMessage))
+	record.Set("message", encryptedMessage)
 
 	if err := n.App.Save(record); err != nil {
-		return nil, fmt.Errorf("failed to create note: %w", err)
+		return nil, false, fmt.Errorf("failed to create note: %w", err)
 	}
 
 	return &Note{
-		ID:        record.Id,
-		Phrase:    phraseHash,
-		Message:   "",
-		ImageHash: "",
-		Created:   record.GetDateTime("created").Time(),
-		Updated:   record.GetDateTime("updated").Time(),
-	}, nil
+		ID:           record.Id,
+		Phrase:       phraseHash,
+		Message:      "",
+		Tags:         []string{},
+		ImageHash:    "",
+		Created:      Timestamp(record.GetDateTime("created")),
+		Updated:      Timestamp(record.GetDateTime("updated")),
+		DestroyAt:    DestroyAt(record),
+		AccessCount:  record.GetInt("access_count"),
+		LastAccessed: LastAccessed(record),
+		ReadOnly:     record.GetBool("read_only"),
+	}, true, nil
+}
+
+// FindNote returns the phrase's note without creating it
+func (n *NoteService) FindNote(phrase string) (*Note, error) {
+	records, err := n.App.FindRecordsByFilter("notes", "phrase_hash = {:phrase_hash}", "", 1, 0, dbx.Params{"phrase_hash": n.hashPhrase(phrase)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notes: %w", err)
+	}
+	if len(records) == 0 || destroyDue(records[0]) {
+		return nil, ErrNoteNotFound
+	}
+	return n.openNote(records[0], phrase), nil
 }
 
-// UpdateNote updates an existing note
-func (n *NoteService) UpdateNote(phrase, message string) (*Note, error) {
+// openNote decrypts a note record and notifies the access hooks
+func (n *NoteService) openNote(record *core.Record, phrase string) *Note {
+	phraseHash := record.GetString("phrase_hash")
+	encryptedMessageB64 := record.GetString("message")
+	var message string
+	var decrypted bool
+
+	if encryptedMessageB64 != "" {
+		// If decryption fails, assume it's an old plaintext message
+		plain, err := n.Encryption.DecryptStringBound(encryptedMessageB64, phrase, recordBinding(record, "message"))
+		if err != nil {
+			message = encryptedMessageB64
+		} else {
+			message = plain
+			decrypted = true
+		}
+	}
+
+	title, tags := n.Metadata(record, phrase)
+
+	// Report the counters as they were before this read, so the caller sees
+	// whether anyone else opened the note since
+	if decrypted {
+		n.recordAccess(record)
+		n.upgradeEncryption(record, phrase)
+	}
+
+	for _, fn := range n.accessHooks {
+		fn(phraseHash)
+	}
+
+	return &Note{
+		ID:           record.Id,
+		Phrase:       phraseHash, // Store hash, not original phrase
+		Message:      message,
+		Title:        title,
+		Tags:         tags,
+		ImageHash:    record.GetString("image_hash"),
+		Created:      Timestamp(record.GetDateTime("created")),
+		Updated:      Timestamp(record.GetDateTime("updated")),
+		DestroyAt:    DestroyAt(record),
+		AccessCount:  record.GetInt("access_count"),
+		LastAccessed: LastAccessed(record),
+		ReadOnly:     record.GetBool("read_only"),
+	}
+}
+
+// UpdateNote updates an existing note's message and the metadata fields set in meta
+func (n *NoteService) UpdateNote(phrase, message string, meta NoteMetadata) (*Note, error) {
 	// Validate phrase length
 	if len(phrase) < 3 {
 		return nil, fmt.Errorf("phrase must be at least 3 characters long")
@@ -131,36 +196,70 @@ func (n *NoteService) UpdateNote(phrase, message string) (*Note, error) {
 	// Find the existing note
 	records, err := n.App.FindRecordsByFilter("notes", "phrase_hash = {:phrase_hash}", "", 1, 0, dbx.Params{"phrase_hash": phraseHash})
 	if err != nil || len(records) == 0 {
-		return nil, fmt.Errorf("note not found")
+		return nil, ErrNoteNotFound
 	}
 
 	record := records[0]
 
-	// Encrypt the message (encode as base64 to prevent corruption)
-	encryptedMessage, err := n.Encryption.EncryptData([]byte(message), phrase)
+	// Encrypt the message
+	encryptedMessage, err := n.Encryption.EncryptStringBound(message, phrase, recordBinding(record, "message"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to encrypt message: %w", err)
 	}
 
 	// Update the record
-	record.Set("message", base64.StdEncoding.EncodeToString(encryptedMessage))
+	record.Set("message", encryptedMessage)
+	if err := n.ApplyMetadata(record, phrase, meta); err != nil {
+		return nil, err
+	}
 
 	if err := n.App.Save(record); err != nil {
 		return nil, fmt.Errorf("failed to update note: %w", err)
 	}
 
+	title, tags := n.Metadata(record, phrase)
 	return &Note{
-		ID:        record.Id,
-		Phrase:    phraseHash,
-		Message:   message, // Return unencrypted message
-		ImageHash: record.GetString("image_hash"),
-		Created:   record.GetDateTime("created").Time(),
-		Updated:   record.GetDateTime("updated").Time(),
+		ID:           record.Id,
+		Phrase:       phraseHash,
+		Message:      message, // Return unencrypted message
+		Title:        title,
+		Tags:         tags,
+		ImageHash:    record.GetString("image_hash"),
+		Created:      Timestamp(record.GetDateTime("created")),
+		Updated:      Timestamp(record.GetDateTime("updated")),
+		DestroyAt:    DestroyAt(record),
+		AccessCount:  record.GetInt("access_count"),
+		LastAccessed: LastAccessed(record),
+		ReadOnly:     record.GetBool("read_only"),
 	}, nil
 }
 
-// DeleteNote deletes a note
-func (n *NoteService) DeleteNote(phrase string) error {
+// DeleteNote moves a note to the trash and returns when it was deleted. A
+// deleted note is hidden until UndeleteNote restores it, and purged along with
+// its attachments by PurgeDeletedNotes once the grace period has passed.
+func (n *NoteService) DeleteNote(phrase string) (time.Time, error) {
+	// Validate phrase length
+	if len(phrase) < 3 {
+		return time.Time{}, fmt.Errorf("phrase must be at least 3 characters long")
+	}
+
+	// Find the note to delete
+	records, err := n.App.FindRecordsByFilter("notes", "phrase_hash = {:phrase_hash}", "", 1, 0, dbx.Params{"phrase_hash": n.hashPhrase(phrase)})
+	if err != nil || len(records) == 0 || DeletedAt(records[0]) != nil {
+		return time.Time{}, ErrNoteNotFound
+	}
+
+	record := records[0]
+	record.Set("deleted_at", time.Now().UTC())
+	if err := n.App.Save(record); err != nil {
+		return time.Time{}, fmt.Errorf("failed to delete note: %w", err)
+	}
+
+	return Timestamp(record.GetDateTime("deleted_at")), nil
+}
+
+// DestroyNote permanently deletes a note and its attachments, bypassing the trash
+func (n *NoteService) DestroyNote(phrase string) error {
 	// Validate phrase length
 	if len(phrase) < 3 {
 		return fmt.Errorf("phrase must be at least 3 characters long")
@@ -172,13 +271,16 @@ func (n *NoteService) DeleteNote(phrase string) error {
 	// Find the note to delete
 	records, err := n.App.FindRecordsByFilter("notes", "phrase_hash = {:phrase_hash}", "", 1, 0, dbx.Params{"phrase_hash": phraseHash})
 	if err != nil || len(records) == 0 {
-		return fmt.Errorf("note not found")
+		return ErrNoteNotFound
 	}
 
-	record := records[0]
+	return n.deleteNoteRecord(records[0])
+}
 
+// deleteNoteRecord deletes a note record and its encrypted files
+func (n *NoteService) deleteNoteRecord(record *core.Record) error {
 	// Also delete any associated encrypted files
-	fileRecords, err := n.App.FindRecordsByFilter("encrypted_files", "phrase_hash = {:phrase_hash}", "", -1, 0, dbx.Params{"phrase_hash": phraseHash})
+	fileRecords, err := n.App.FindRecordsByFilter("encrypted_files", "phrase_hash = {:phrase_hash}", "", -1, 0, dbx.Params{"phrase_hash": record.GetString("phrase_hash")})
 	if err == nil {
 		for _, fileRecord := range fileRecords {
 			if deleteErr := n.App.Delete(fileRecord); deleteErr != nil {
@@ -208,7 +310,7 @@ func (n *NoteService) UpdateNoteImageHash(phrase, imageHash string) error {
 	// Find the existing note
 	records, err := n.App.FindRecordsByFilter("notes", "phrase_hash = {:phrase_hash}", "", 1, 0, dbx.Params{"phrase_hash": phraseHash})
 	if err != nil || len(records) == 0 {
-		return fmt.Errorf("note not found")
+		return ErrNoteNotFound
 	}
 
 	record := records[0]
@@ -223,8 +325,257 @@ func (n *NoteService) UpdateNoteImageHash(phrase, imageHash string) error {
 	return nil
 }
 
-// hashPhrase creates a SHA-256 hash of the phrase for secure storage and lookup
+// CheckPhraseFree returns ErrPhraseInUse when a note is stored under phrase
+func (n *NoteService) CheckPhraseFree(app core.App, phrase string) error {
+	count, err := app.CountRecords("notes", dbx.HashExp{"phrase_hash": n.hashPhrase(phrase)})
+	if err != nil {
+		return fmt.Errorf("failed to query notes: %w", err)
+	}
+	if count > 0 {
+		return ErrPhraseInUse
+	}
+	return nil
+}
+
+// RekeyNote re-encrypts the note stored under oldPhrase with newPhrase and moves
+// it to the new phrase hash. It must be called with a transactional app so the
+// note and its attachments move together. If imageHash is non-empty it replaces
+// the stored image reference (re-encrypted files produce a new hash).
+func (n *NoteService) RekeyNote(txApp core.App, oldPhrase, newPhrase, imageHash string) (*Note, error) {
+	if len(oldPhrase) < 3 || len(newPhrase) < 3 {
+		return nil, fmt.Errorf("phrase must be at least 3 characters long")
+	}
+
+	oldHash := n.hashPhrase(oldPhrase)
+	newHash := n.hashPhrase(newPhrase)
+
+	if err := n.CheckPhraseFree(txApp, newPhrase); err != nil {
+		return nil, err
+	}
+
+	records, err := txApp.FindRecordsByFilter("notes", "phrase_hash = {:phrase_hash}", "", 1, 0, dbx.Params{"phrase_hash": oldHash})
+	if err != nil || len(records) == 0 {
+		return nil, ErrNoteNotFound
+	}
+	record := records[0]
+
+	message, err := n.decryptMessage(record, oldPhrase)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedMessage, err := n.Encryption.EncryptStringBound(message, newPhrase, recordBinding(record, "message"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt message: %w", err)
+	}
+
+	if err := n.rekeyMetadata(record, oldPhrase, newPhrase); err != nil {
+		return nil, err
+	}
+
+	record.Set("phrase_hash", newHash)
+	record.Set("message", encryptedMessage)
+	if imageHash != "" {
+		record.Set("image_hash", imageHash)
+	}
+
+	if err := txApp.Save(record); err != nil {
+		return nil, fmt.Errorf("failed to rekey note: %w", err)
+	}
+
+	title, tags := n.Metadata(record, newPhrase)
+	return &Note{
+		ID:           record.Id,
+		Phrase:       newHash,
+		Message:      message,
+		Title:        title,
+		Tags:         tags,
+		ImageHash:    record.GetString("image_hash"),
+		Created:      Timestamp(record.GetDateTime("created")),
+		Updated:      Timestamp(record.GetDateTime("updated")),
+		DestroyAt:    DestroyAt(record),
+		AccessCount:  record.GetInt("access_count"),
+		LastAccessed: LastAccessed(record),
+		ReadOnly:     record.GetBool("read_only"),
+	}, nil
+}
+
+// MergeNotes appends the message of the note stored under sourcePhrase to the
+// note stored under destPhrase and deletes the source note. It must be called
+// with a transactional app; attachments are moved separately by FileService.
+// If imageHash is non-empty it replaces the destination's image reference.
+// It returns a *QuotaError when the merged note is over the note quota.
+func (n *NoteService) MergeNotes(txApp core.App, sourcePhrase, destPhrase, imageHash string) (*Note, error) {
+	if len(sourcePhrase) < 3 || len(destPhrase) < 3 {
+		return nil, fmt.Errorf("phrase must be at least 3 characters long")
+	}
+
+	sourceRecords, err := txApp.FindRecordsByFilter("notes", "phrase_hash = {:phrase_hash}", "", 1, 0, dbx.Params{"phrase_hash": n.hashPhrase(sourcePhrase)})
+	if err != nil || len(sourceRecords) == 0 || DeletedAt(sourceRecords[0]) != nil {
+		return nil, ErrNoteNotFound
+	}
+	destRecords, err := txApp.FindRecordsByFilter("notes", "phrase_hash = {:phrase_hash}", "", 1, 0, dbx.Params{"phrase_hash": n.hashPhrase(destPhrase)})
+	if err != nil || len(destRecords) == 0 {
+		return nil, ErrNoteNotFound
+	}
+	source := sourceRecords[0]
+	dest := destRecords[0]
+
+	sourceMessage, err := n.decryptMessage(source, sourcePhrase)
+	if err != nil {
+		return nil, err
+	}
+	destMessage, err := n.decryptMessage(dest, destPhrase)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := destMessage
+	switch {
+	case merged == "":
+		merged = sourceMessage
+	case sourceMessage != "":
+		merged = merged + "\n\n" + sourceMessage
+	}
+	// the merged note can be over the limit even if neither half was
+	if err := n.noteQuota(int64(len(destMessage)), int64(len(merged))); err != nil {
+		return nil, err
+	}
+
+	encryptedMessage, err := n.Encryption.EncryptStringBound(merged, destPhrase, recordBinding(dest, "message"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt message: %w", err)
+	}
+
+	dest.Set("message", encryptedMessage)
+	if imageHash != "" {
+		dest.Set("image_hash", imageHash)
+	}
+
+	// keep the destination's title unless it has none; combine the tags
+	title, tags := n.Metadata(dest, destPhrase)
+	sourceTitle, sourceTags := n.Metadata(source, sourcePhrase)
+	if title == "" {
+		title = sourceTitle
+	}
+	tags = mergeTags(tags, sourceTags)
+	if err := n.ApplyMetadata(dest, destPhrase, NoteMetadata{Title: &title, Tags: &tags}); err != nil {
+		return nil, err
+	}
+
+	if err := txApp.Save(dest); err != nil {
+		return nil, fmt.Errorf("failed to update note: %w", err)
+	}
+	if err := txApp.Delete(source); err != nil {
+		return nil, fmt.Errorf("failed to delete source note: %w", err)
+	}
+
+	return &Note{
+		ID:           dest.Id,
+		Phrase:       dest.GetString("phrase_hash"),
+		Message:      merged,
+		Title:        title,
+		Tags:         tags,
+		ImageHash:    dest.GetString("image_hash"),
+		Created:      Timestamp(dest.GetDateTime("created")),
+		Updated:      Timestamp(dest.GetDateTime("updated")),
+		DestroyAt:    DestroyAt(dest),
+		AccessCount:  dest.GetInt("access_count"),
+		LastAccessed: LastAccessed(dest),
+		ReadOnly:     dest.GetBool("read_only"),
+	}, nil
+}
+
+// ImportNote stores message and meta as the phrase's note, for restoring an
+// export archive. It should be called with a transactional app. A note that
+// already exists is only replaced while it is still empty and has no
+// attachment; otherwise ErrPhraseInUse is returned.
+func (n *NoteService) ImportNote(txApp core.App, phrase, message, imageHash string, meta NoteMetadata) (*Note, error) {
+	if len(phrase) < 3 {
+		return nil, fmt.Errorf("phrase must be at least 3 characters long")
+	}
+	phraseHash := n.hashPhrase(phrase)
+
+	records, err := txApp.FindRecordsByFilter("notes", "phrase_hash = {:phrase_hash}", "", 1, 0, dbx.Params{"phrase_hash": phraseHash})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notes: %w", err)
+	}
+
+	var record *core.Record
+	if len(records) > 0 {
+		record = records[0]
+		existing, err := n.decryptMessage(record, phrase)
+		if err != nil {
+			return nil, err
+		}
+		title, tags := n.Metadata(record, phrase)
+		if existing != "" || title != "" || len(tags) > 0 || record.GetString("image_hash") != "" {
+			return nil, ErrPhraseInUse
+		}
+	} else {
+		collection, err := txApp.FindCachedCollectionByNameOrId("notes")
+		if err != nil {
+			return nil, fmt.Errorf("notes collection not found: %w", err)
+		}
+		record = core.NewRecord(collection)
+		record.Set("id:autogenerate", "")
+		record.Set("phrase_hash", phraseHash)
+	}
+
+	encryptedMessage, err := n.Encryption.EncryptStringBound(message, phrase, recordBinding(record, "message"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	record.Set("message", encryptedMessage)
+	record.Set("image_hash", imageHash)
+	if err := n.ApplyMetadata(record, phrase, meta); err != nil {
+		return nil, err
+	}
+
+	if err := txApp.Save(record); err != nil {
+		return nil, fmt.Errorf("failed to import note: %w", err)
+	}
+
+	title, tags := n.Metadata(record, phrase)
+	return &Note{
+		ID:           record.Id,
+		Phrase:       phraseHash,
+		Message:      message,
+		Title:        title,
+		Tags:         tags,
+		ImageHash:    imageHash,
+		Created:      Timestamp(record.GetDateTime("created")),
+		Updated:      Timestamp(record.GetDateTime("updated")),
+		DestroyAt:    DestroyAt(record),
+		AccessCount:  record.GetInt("access_count"),
+		LastAccessed: LastAccessed(record),
+		ReadOnly:     record.GetBool("read_only"),
+	}, nil
+}
+
+// decryptMessage decodes and decrypts a note record's message. Unlike the
+// lenient read path in GetOrCreateNote, a decryption failure is reported so
+// callers never re-encrypt ciphertext as if it were plaintext.
+func (n *NoteService) decryptMessage(record *core.Record, phrase string) (string, error) {
+	encryptedMessageB64 := record.GetString("message")
+	if encryptedMessageB64 == "" {
+		return "", nil
+	}
+	encryptedMessage, err := base64.StdEncoding.DecodeString(encryptedMessageB64)
+	if err != nil {
+		// Legacy plaintext message
+		return encryptedMessageB64, nil
+	}
+	decryptedBytes, err := n.Encryption.DecryptBound(encryptedMessage, phrase, recordBinding(record, "message"))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt message: %w", err)
+	}
+	defer cryptoutil.Wipe(decryptedBytes)
+	return string(decryptedBytes), nil
+}
+
+// hashPhrase returns the hash the phrase's records are stored and looked up
+// under (see Service.PhraseHash)
 func (n *NoteService) hashPhrase(phrase string) string {
-	hash := sha256.Sum256([]byte(phrase))
-	return hex.EncodeToString(hash[:])
+	return n.Encryption.PhraseHash(phrase)
 }
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Formats accepted by RenderNote
+const (
+	FormatText     = "txt"
+	FormatMarkdown = "md"
+	FormatJSON     = "json"
+)
+
+// ErrUnknownFormat is returned by RenderNote for an unsupported format
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// RenderNote writes a decrypted note in one of the export formats and returns
+// it with its Content-Type. Plain text is the message alone; Markdown puts the
+// title, tags and timestamps in YAML front matter above the message.
+func RenderNote(note *Note, format string) ([]byte, string, error) {
+	switch format {
+	case FormatText:
+		return []byte(note.Message), "text/plain; charset=utf-8", nil
+	case FormatMarkdown:
+		var b strings.Builder
+		b.WriteString("---\n")
+		if note.Title != "" {
+			fmt.Fprintf(&b, "title: %s\n", yamlString(note.Title))
+		}
+		if len(note.Tags) > 0 {
+			quoted := make([]string, len(note.Tags))
+			for i, tag := range note.Tags {
+				quoted[i] = yamlString(tag)
+			}
+			fmt.Fprintf(&b, "tags: [%s]\n", strings.Join(quoted, ", "))
+		}
+		fmt.Fprintf(&b, "created: %s\n", note.Created.Format(time.RFC3339Nano))
+		fmt.Fprintf(&b, "updated: %s\n", note.Updated.Format(time.RFC3339Nano))
+		b.WriteString("---\n\n")
+		b.WriteString(note.Message)
+		if note.Message != "" && !strings.HasSuffix(note.Message, "\n") {
+			b.WriteString("\n")
+		}
+		return []byte(b.String()), "text/markdown; charset=utf-8", nil
+	case FormatJSON:
+		body, err := json.MarshalIndent(map[string]any{
+			"title":    note.Title,
+			"tags":     note.Tags,
+			"message":  note.Message,
+			"hasImage": note.ImageHash != "",
+			"created":  note.Created,
+			"updated":  note.Updated,
+		}, "", "  ")
+		if err != nil {
+			return nil, "", err
+		}
+		return append(body, '\n'), "application/json", nil
+	}
+	return nil, "", fmt.Errorf("%w %q (expected %s, %s or %s)", ErrUnknownFormat, format, FormatMarkdown, FormatText, FormatJSON)
+}
+
+// NoteFilename suggests a download name for a note export: the title reduced
+// to lowercase letters, digits and dashes, or "secretnote" without one
+func NoteFilename(note *Note, format string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(note.Title) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		default:
+			dash = true
+		}
+		if b.Len() >= 60 {
+			break
+		}
+	}
+	name := b.String()
+	if name == "" {
+		name = "secretnote"
+	}
+	return name + "." + format
+}
+
+// yamlString quotes s for YAML; JSON strings are valid YAML double-quoted scalars
+func yamlString(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
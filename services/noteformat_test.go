@@ -0,0 +1,53 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRenderNote(t *testing.T) {
+	at := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	note := &Note{Message: "milk\neggs", Title: `Shopping "list"`, Tags: []string{"home"}, Created: at, Updated: at}
+
+	body, contentType, err := RenderNote(note, FormatMarkdown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "---\ntitle: \"Shopping \\\"list\\\"\"\ntags: [\"home\"]\ncreated: 2024-05-01T09:30:00Z\nupdated: 2024-05-01T09:30:00Z\n---\n\nmilk\neggs\n"
+	if string(body) != want || contentType != "text/markdown; charset=utf-8" {
+		t.Errorf("markdown = %q (%s)", body, contentType)
+	}
+
+	if body, _, _ := RenderNote(note, FormatText); string(body) != "milk\neggs" {
+		t.Errorf("text = %q", body)
+	}
+
+	body, _, err = RenderNote(note, FormatJSON)
+	var decoded struct {
+		Title   string   `json:"title"`
+		Tags    []string `json:"tags"`
+		Message string   `json:"message"`
+	}
+	if err != nil || json.Unmarshal(body, &decoded) != nil || decoded.Title != note.Title || decoded.Message != note.Message {
+		t.Errorf("json = %s, %v", body, err)
+	}
+
+	if _, _, err := RenderNote(note, "pdf"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("unknown format: got %v", err)
+	}
+}
+
+func TestNoteFilename(t *testing.T) {
+	cases := map[string]string{
+		"":                      "secretnote.md",
+		"Shopping List!":        "shopping-list.md",
+		"  ../Meeting  notes  ": "meeting-notes.md",
+	}
+	for title, want := range cases {
+		if got := NoteFilename(&Note{Title: title}, FormatMarkdown); got != want {
+			t.Errorf("NoteFilename(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
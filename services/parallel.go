@@ -0,0 +1,63 @@
+package services
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ParallelChunks has chunked envelopes sealed and decrypted up to n chunks at
+// a time, each on its own goroutine, so a large attachment uses several cores
+// instead of one. n <= 0 means one per CPU (GOMAXPROCS). SealChunked then
+// holds up to n+1 chunks of plaintext at once rather than two. It must be
+// called before the service is used; without it chunks are processed one
+// after another. Envelopes are the same either way.
+func (s *Service) ParallelChunks(n int) {
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	s.chunkWorkers = n
+}
+
+// forEachChunk calls fn for chunks 0 to n-1 on up to workers goroutines and
+// returns the first error; chunks not yet started when one fails are skipped
+func forEachChunk(n int64, workers int, fn func(i int64) error) error {
+	if int64(workers) > n {
+		workers = int(n)
+	}
+	if workers <= 1 {
+		for i := range n {
+			if err := fn(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		next  atomic.Int64
+		wg    sync.WaitGroup
+		once  sync.Once
+		first error
+		stop  atomic.Bool
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() {
+				i := next.Add(1) - 1
+				if i >= n {
+					return
+				}
+				if err := fn(i); err != nil {
+					once.Do(func() { first = err })
+					stop.Store(true)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return first
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// bip39English is the BIP39 English wordlist: 2048 common words, told apart
+// by their first four letters, so each word carries 11 bits of entropy
+//
+//go:embed bip39_english.txt
+var bip39English string
+
+var generatorWords = strings.Fields(bip39English)
+
+const (
+	// DefaultGeneratedWords makes 66-bit passphrases, out of reach of offline
+	// guessing against the KDF
+	DefaultGeneratedWords = 6
+	MinGeneratedWords     = 4
+	MaxGeneratedWords     = 24
+
+	// DefaultSeparator joins generated words
+	DefaultSeparator = "-"
+
+	maxSeparatorLen = 3
+)
+
+// GeneratedPhrase is a passphrase of random words
+type GeneratedPhrase struct {
+	Passphrase string  `json:"passphrase"`
+	Words      int     `json:"words"`
+	Entropy    float64 `json:"entropy"` // bits
+}
+
+// GeneratePassphrase draws words uniformly at random from the BIP39 English
+// wordlist and joins them with separator, which may be empty or up to three
+// characters that aren't letters
+func GeneratePassphrase(words int, separator string) (*GeneratedPhrase, error) {
+	if words < MinGeneratedWords || words > MaxGeneratedWords {
+		return nil, fmt.Errorf("words must be between %d and %d", MinGeneratedWords, MaxGeneratedWords)
+	}
+	if len(separator) > maxSeparatorLen || strings.IndexFunc(separator, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsControl(r)
+	}) >= 0 {
+		return nil, fmt.Errorf("separator must be at most %d characters and contain no letters", maxSeparatorLen)
+	}
+
+	// the list has 2^11 words, so 11 random bits pick one without bias
+	buf := make([]byte, 2*words)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to draw words: %w", err)
+	}
+	picked := make([]string, words)
+	for i := range picked {
+		picked[i] = generatorWords[binary.BigEndian.Uint16(buf[2*i:])%uint16(len(generatorWords))]
+	}
+	clear(buf)
+	return &GeneratedPhrase{
+		Passphrase: strings.Join(picked, separator),
+		Words:      words,
+		Entropy:    float64(11 * words),
+	}, nil
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGeneratePassphrase(t *testing.T) {
+	if len(generatorWords) != 2048 {
+		t.Fatalf("expected the BIP39 list of 2048 words, got %d", len(generatorWords))
+	}
+
+	p, err := GeneratePassphrase(6, DefaultSeparator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := strings.Split(p.Passphrase, "-")
+	if len(words) != 6 || p.Words != 6 || p.Entropy != 66 {
+		t.Fatalf("unexpected passphrase %+v", p)
+	}
+	for _, w := range words {
+		if !slices.Contains(generatorWords, w) {
+			t.Fatalf("%q is not on the wordlist", w)
+		}
+	}
+	if q, _ := GeneratePassphrase(6, DefaultSeparator); q.Passphrase == p.Passphrase {
+		t.Fatal("expected a different passphrase every time")
+	}
+
+	if p, err := GeneratePassphrase(4, " "); err != nil || len(strings.Fields(p.Passphrase)) != 4 {
+		t.Fatalf("expected four space-separated words, got %+v, %v", p, err)
+	}
+	if p, err := GeneratePassphrase(4, ""); err != nil || strings.ContainsAny(p.Passphrase, " -") {
+		t.Fatalf("expected the words to be run together, got %+v, %v", p, err)
+	}
+}
+
+func TestGeneratePassphraseLimits(t *testing.T) {
+	for _, n := range []int{0, MinGeneratedWords - 1, MaxGeneratedWords + 1} {
+		if _, err := GeneratePassphrase(n, "-"); err == nil {
+			t.Fatalf("expected %d words to be refused", n)
+		}
+	}
+	for _, sep := range []string{"and", "----", "\n"} {
+		if _, err := GeneratePassphrase(6, sep); err == nil {
+			t.Fatalf("expected separator %q to be refused", sep)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// ErrPasteNotFound is returned for unknown or expired pastes
+var ErrPasteNotFound = errors.New("paste not found")
+
+// Paste is a public, passphrase-free snippet reachable by its random ID
+type Paste struct {
+	ID        string    `json:"id"`
+	Content   string    `json:"content"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Created   time.Time `json:"created"`
+}
+
+// PasteService handles public paste operations
+type PasteService struct {
+	App *pocketbase.PocketBase
+}
+
+// NewPasteService creates a new paste service
+func NewPasteService(app *pocketbase.PocketBase) *PasteService {
+	return &PasteService{App: app}
+}
+
+// CreatePaste stores content that expires after ttl
+func (p *PasteService) CreatePaste(content string, ttl time.Duration) (*Paste, error) {
+	collection, err := p.App.FindCachedCollectionByNameOrId("pastes")
+	if err != nil {
+		return nil, fmt.Errorf("pastes collection not found: %w", err)
+	}
+
+	expiresAt := time.Now().UTC().Add(ttl)
+
+	record := core.NewRecord(collection)
+	record.Set("content", content)
+	record.Set("expires_at", expiresAt)
+
+	if err := p.App.Save(record); err != nil {
+		return nil, fmt.Errorf("failed to create paste: %w", err)
+	}
+
+	return &Paste{
+		ID:        record.Id,
+		Content:   content,
+		ExpiresAt: Timestamp(record.GetDateTime("expires_at")),
+		Created:   Timestamp(record.GetDateTime("created")),
+	}, nil
+}
+
+// GetPaste returns an unexpired paste by ID
+func (p *PasteService) GetPaste(id string) (*Paste, error) {
+	record, err := p.App.FindRecordById("pastes", id)
+	if err != nil {
+		return nil, ErrPasteNotFound
+	}
+
+	expiresAt := Timestamp(record.GetDateTime("expires_at"))
+	if !expiresAt.After(time.Now()) {
+		return nil, ErrPasteNotFound
+	}
+
+	return &Paste{
+		ID:        record.Id,
+		Content:   record.GetString("content"),
+		ExpiresAt: expiresAt,
+		Created:   Timestamp(record.GetDateTime("created")),
+	}, nil
+}
+
+// PurgeExpiredPastes deletes every paste whose expiry has passed
+func (p *PasteService) PurgeExpiredPastes() (int, error) {
+	now, err := types.ParseDateTime(time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	records, err := p.App.FindRecordsByFilter("pastes", "expires_at <= {:now}", "", -1, 0, dbx.Params{"now": now.String()})
+	if err != nil {
+		return 0, fmt.Errorf("failed to query expired pastes: %w", err)
+	}
+
+	for _, record := range records {
+		if err := p.App.Delete(record); err != nil {
+			return 0, fmt.Errorf("failed to delete expired paste: %w", err)
+		}
+	}
+	return len(records), nil
+}
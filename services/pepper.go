@@ -0,0 +1,148 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/ktappdev/secretnotes-go-backend/cryptoutil"
+	"github.com/ktappdev/secretnotes-go-backend/pkg/cryptobox"
+)
+
+// MinPepperSize is the shortest pepper SetPeppers accepts
+const MinPepperSize = 16
+
+// ErrUnknownPepper is matched when a ciphertext was keyed with a server pepper
+// this server isn't configured with, typically one rotated out too early
+var ErrUnknownPepper = errors.New("server pepper is not configured")
+
+// SetPeppers configures server-held secrets mixed into the keys of stored
+// fields, so the database alone isn't enough to brute-force weak passphrases
+// offline. Peppers are looked up by a non-zero id recorded in each
+// ciphertext; new encryptions use current, and fields keyed with another
+// pepper (or none) stay readable as long as theirs is configured, and count
+// as outdated, so they move to the current one as they are read. A zero
+// current leaves new fields unpeppered. It must be called before the service
+// is used.
+func (s *Service) SetPeppers(peppers map[byte][]byte, current byte) error {
+	for id, pepper := range peppers {
+		if id == 0 {
+			return errors.New("pepper id 0 is reserved")
+		}
+		if len(pepper) < MinPepperSize {
+			return fmt.Errorf("pepper %d is shorter than %d bytes", id, MinPepperSize)
+		}
+	}
+	if _, ok := peppers[current]; current != 0 && !ok {
+		return fmt.Errorf("pepper %d is not configured", current)
+	}
+	s.peppers, s.pepperID = peppers, current
+	return nil
+}
+
+// pepperFor returns the id of the pepper new encryptions bound by b use:
+// stored fields get the current one, anything else (such as export archives,
+// which must open on other servers) none
+func (s *Service) pepperFor(b Binding) byte {
+	if b.Purpose == "" {
+		return 0
+	}
+	return s.pepperID
+}
+
+// fieldKey derives the key of a ciphertext from the passphrase key for its
+// salt: mixed with the pepper with id pepper if that is non-zero and with the
+// data key wrapped as wrapped if there is one (see UseKMS), then the subkey
+// for purpose if that is set
+func (s *Service) fieldKey(params cryptobox.KDFParams, phrase string, salt []byte, purpose string, pepper byte, wrapped []byte) ([]byte, error) {
+	key := s.deriveKey(params, phrase, salt)
+	// each step replaces key, so wipe the one it replaces
+	if pepper != 0 {
+		secret, ok := s.peppers[pepper]
+		if !ok {
+			cryptoutil.Wipe(key)
+			return nil, fmt.Errorf("%w: %w (id %d)", ErrDecryptionFailed, ErrUnknownPepper, pepper)
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(key)
+		cryptoutil.Wipe(key)
+		key = mac.Sum(nil)
+	}
+	if wrapped != nil {
+		mixed, err := s.mixDataKey(key, wrapped)
+		cryptoutil.Wipe(key)
+		if err != nil {
+			return nil, err
+		}
+		key = mixed
+	}
+	if purpose != "" {
+		sub := subkey(key, purpose)
+		cryptoutil.Wipe(key)
+		key = sub
+	}
+	return key, nil
+}
+
+// PhraseHash returns the hash records of the passphrase are stored and looked
+// up under. With a current pepper it is an HMAC-SHA256 keyed with it, so a copy
+// of the database can't be checked against guessed passphrases without the
+// pepper; without one it is a plain SHA-256.
+func (s *Service) PhraseHash(phrase string) string {
+	return s.phraseHash(s.pepperID, phrase)
+}
+
+// LegacyPhraseHashes returns the other hashes records of the passphrase may
+// still be stored under: those of the other configured peppers, and the plain
+// SHA-256 of servers without one
+func (s *Service) LegacyPhraseHashes(phrase string) []string {
+	var hashes []string
+	if s.pepperID != 0 {
+		hashes = append(hashes, s.phraseHash(0, phrase))
+	}
+	for id := range s.peppers {
+		if id != s.pepperID {
+			hashes = append(hashes, s.phraseHash(id, phrase))
+		}
+	}
+	return hashes
+}
+
+func (s *Service) phraseHash(pepper byte, phrase string) string {
+	if pepper == 0 {
+		hash := sha256.Sum256([]byte(phrase))
+		return hex.EncodeToString(hash[:])
+	}
+	mac := hmac.New(sha256.New, s.peppers[pepper])
+	mac.Write([]byte("phrase-hash\x00"))
+	mac.Write([]byte(phrase))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// contentSecrets returns the secrets attachment content keys of the passphrase
+// are keyed with (see contentKeys), the current pepper's first, then those of
+// the other peppers and none, which older records may still use. Without a
+// pepper the secret is the passphrase itself.
+func (s *Service) contentSecrets(phrase string) [][]byte {
+	secret := func(pepper byte) []byte {
+		if pepper == 0 {
+			return []byte(phrase)
+		}
+		mac := hmac.New(sha256.New, s.peppers[pepper])
+		mac.Write([]byte("attachment-content\x00"))
+		mac.Write([]byte(phrase))
+		return mac.Sum(nil)
+	}
+	secrets := [][]byte{secret(s.pepperID)}
+	if s.pepperID != 0 {
+		secrets = append(secrets, secret(0))
+	}
+	for id := range s.peppers {
+		if id != s.pepperID {
+			secrets = append(secrets, secret(id))
+		}
+	}
+	return secrets
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestPepper(t *testing.T) {
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	b := FieldBinding("notes", "abc123", "message")
+	old := []byte("an old pepper of sixteen bytes or more")
+	current := []byte("the current pepper, also long enough")
+
+	plain := NewEncryptionService()
+	unpeppered, _ := plain.EncryptBound([]byte("hello"), phrase, b)
+
+	svc := NewEncryptionService()
+	if err := svc.SetPeppers(map[byte][]byte{1: []byte("short")}, 1); err == nil {
+		t.Fatal("expected a short pepper to be rejected")
+	}
+	if err := svc.SetPeppers(map[byte][]byte{1: old}, 2); err == nil {
+		t.Fatal("expected an unknown current pepper to be rejected")
+	}
+	if err := svc.SetPeppers(map[byte][]byte{1: old}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := svc.EncryptBound([]byte("hello"), phrase, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := parseEnvelope(sealed)
+	if err != nil || sealed[3] != pepperedEnvelopeVersion || env.Pepper != 1 {
+		t.Fatalf("expected a version %d envelope with pepper 1, got %+v, %v", pepperedEnvelopeVersion, env, err)
+	}
+	if svc.Outdated(sealed, b) {
+		t.Fatal("expected a field keyed with the current pepper to be up to date")
+	}
+	if !svc.Outdated(unpeppered, b) {
+		t.Fatal("expected an unpeppered field to be outdated once a pepper is set")
+	}
+	if got, err := svc.DecryptBound(unpeppered, phrase, b); err != nil || string(got) != "hello" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+
+	// the database alone doesn't open a peppered field
+	if _, err := plain.DecryptBound(sealed, phrase, b); !errors.Is(err, ErrUnknownPepper) || !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("expected ErrUnknownPepper, got %v", err)
+	}
+	wrong := NewEncryptionService()
+	wrong.SetPeppers(map[byte][]byte{1: current}, 1)
+	if _, err := wrong.DecryptBound(sealed, phrase, b); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("expected the wrong pepper to fail, got %v", err)
+	}
+
+	// chunked envelopes record the pepper too
+	chunked, err := svc.EncryptChunked([]byte("file"), phrase, FieldBinding("attachment_contents", "abc123", "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(chunked, pepperedChunkedMagic) {
+		t.Fatalf("expected an SNC5 envelope, got %q", chunked[:4])
+	}
+
+	// rotating keeps old fields readable but outdated
+	if err := svc.SetPeppers(map[byte][]byte{1: old, 2: current}, 2); err != nil {
+		t.Fatal(err)
+	}
+	if !svc.Outdated(sealed, b) {
+		t.Fatal("expected a field keyed with a rotated-out pepper to be outdated")
+	}
+	if got, err := svc.DecryptBound(sealed, phrase, b); err != nil || string(got) != "hello" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if got, err := svc.DecryptChunked(chunked, phrase, FieldBinding("attachment_contents", "abc123", "data")); err != nil || string(got) != "file" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+
+	// archives aren't peppered, so they open elsewhere
+	archive, _ := svc.EncryptData([]byte("export"), phrase)
+	if got, err := plain.DecryptData(archive, phrase); err != nil || string(got) != "export" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+}
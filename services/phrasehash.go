@@ -0,0 +1,69 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// phraseHashCollections are the collections whose records name their
+// passphrase by its hash in "phrase_hash"
+var phraseHashCollections = []string{
+	"notes",
+	"encrypted_files",
+	"attachment_contents",
+	"note_subscriptions",
+	"note_access_log",
+	"note_webhooks",
+}
+
+// MoveLegacyPhraseHash moves the records of the passphrase still stored under
+// one of its legacy hashes (see Service.LegacyPhraseHashes), such as those
+// saved before a pepper was configured, to its current hash, so they are found
+// again and no longer give the passphrase away to a copy of the database. It
+// reports whether anything moved. Records are only read until one is found, so
+// passphrases with nothing to move don't wait for a write.
+func (n *NoteService) MoveLegacyPhraseHash(phrase string) (bool, error) {
+	legacy := n.Encryption.LegacyPhraseHashes(phrase)
+	if len(legacy) == 0 {
+		return false, nil
+	}
+	hashes := make([]any, len(legacy))
+	for i, hash := range legacy {
+		hashes[i] = hash
+	}
+
+	found := false
+	for _, collection := range phraseHashCollections {
+		var id string
+		err := n.App.DB().Select("id").From(collection).Where(dbx.In("phrase_hash", hashes...)).Limit(1).Row(&id)
+		if err == nil {
+			found = true
+			break
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return false, fmt.Errorf("failed to look up %s: %w", collection, err)
+		}
+	}
+	if !found {
+		return false, nil
+	}
+
+	current := n.Encryption.PhraseHash(phrase)
+	err := n.App.RunInTransaction(func(txApp core.App) error {
+		for _, collection := range phraseHashCollections {
+			_, err := txApp.DB().Update(collection, dbx.Params{"phrase_hash": current}, dbx.In("phrase_hash", hashes...)).Execute()
+			if err != nil {
+				return fmt.Errorf("failed to move %s: %w", collection, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
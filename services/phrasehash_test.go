@@ -0,0 +1,114 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestPhraseHash(t *testing.T) {
+	phrase := "phrase-hash-phrase"
+	sum := sha256.Sum256([]byte(phrase))
+	plainHash := hex.EncodeToString(sum[:])
+
+	plain := NewEncryptionService()
+	if got := plain.PhraseHash(phrase); got != plainHash {
+		t.Fatalf("expected a plain SHA-256 without a pepper, got %s", got)
+	}
+	if legacy := plain.LegacyPhraseHashes(phrase); len(legacy) != 0 {
+		t.Fatalf("expected no legacy hashes without a pepper, got %v", legacy)
+	}
+
+	svc := NewEncryptionService()
+	old := []byte("an old pepper of sixteen bytes or more")
+	current := []byte("the current pepper, also long enough")
+	if err := svc.SetPeppers(map[byte][]byte{1: old, 2: current}, 2); err != nil {
+		t.Fatal(err)
+	}
+	hash := svc.PhraseHash(phrase)
+	if hash == plainHash {
+		t.Fatal("expected the pepper to change the hash")
+	}
+	oldOnly := NewEncryptionService()
+	oldOnly.SetPeppers(map[byte][]byte{1: old}, 1)
+	legacy := svc.LegacyPhraseHashes(phrase)
+	if len(legacy) != 2 || !slices.Contains(legacy, plainHash) || !slices.Contains(legacy, oldOnly.PhraseHash(phrase)) {
+		t.Fatalf("expected the unpeppered and old pepper's hashes as legacy, got %v", legacy)
+	}
+	if slices.Contains(legacy, hash) {
+		t.Fatal("expected the current hash not to be legacy")
+	}
+}
+
+func TestMoveLegacyPhraseHash(t *testing.T) {
+	app := migratedApp(t)
+	phrase := "move-legacy-phrase-hash"
+	attachment := DecryptedFile{Name: "legacy.txt", ContentType: "text/plain", Data: []byte("saved before the pepper")}
+	importFile := func(files *FileService) {
+		t.Helper()
+		err := app.RunInTransaction(func(txApp core.App) error {
+			_, err := files.ImportFiles(txApp, phrase, []DecryptedFile{attachment})
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// saved by a server without a pepper
+	plain := NewEncryptionService()
+	plainNotes := NewNoteService(app, plain)
+	if _, _, err := plainNotes.GetOrCreateNote(phrase); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plainNotes.UpdateNote(phrase, "saved before the pepper", NoteMetadata{}); err != nil {
+		t.Fatal(err)
+	}
+	importFile(NewFileService(app, plain))
+
+	peppered := NewEncryptionService()
+	if err := peppered.SetPeppers(map[byte][]byte{1: []byte("a pepper of sixteen bytes or more")}, 1); err != nil {
+		t.Fatal(err)
+	}
+	notes, files := NewNoteService(app, peppered), NewFileService(app, peppered)
+	if _, err := notes.FindNote(phrase); err == nil {
+		t.Fatal("expected the note not found under the peppered hash before it moves")
+	}
+
+	moved, err := notes.MoveLegacyPhraseHash(phrase)
+	if err != nil || !moved {
+		t.Fatalf("expected the records moved, got %v (%v)", moved, err)
+	}
+	note, err := notes.FindNote(phrase)
+	if err != nil || note.Message != "saved before the pepper" {
+		t.Fatalf("expected the note under the peppered hash, got %+v (%v)", note, err)
+	}
+	if list, err := files.ListAttachments(phrase); err != nil || len(list) != 1 {
+		t.Fatalf("expected the attachment under the peppered hash, got %d (%v)", len(list), err)
+	}
+	plainHash := plain.PhraseHash(phrase)
+	for _, collection := range []string{"notes", "encrypted_files", "attachment_contents"} {
+		if n, _ := app.CountRecords(collection, dbx.HashExp{"phrase_hash": plainHash}); n != 0 {
+			t.Fatalf("expected nothing left in %s under the unpeppered hash, got %d", collection, n)
+		}
+	}
+	if moved, err := notes.MoveLegacyPhraseHash(phrase); err != nil || moved {
+		t.Fatalf("expected nothing left to move, got %v (%v)", moved, err)
+	}
+
+	// the same content again is matched up with the stored one, whose key moves
+	importFile(files)
+	contents, err := app.FindAllRecords("attachment_contents")
+	if err != nil || len(contents) != 1 || contents[0].GetInt("refs") != 2 {
+		t.Fatalf("expected the stored content shared, got %d records (%v)", len(contents), err)
+	}
+	plainKeys, _ := contentKeys(plain.contentSecrets(phrase), bytes.NewReader(attachment.Data), false)
+	if contents[0].GetString("content_key") == plainKeys[0] {
+		t.Fatal("expected the content key moved to the peppered one")
+	}
+}
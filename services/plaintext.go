@@ -0,0 +1,128 @@
+package services
+
+import (
+	"encoding/base64"
+	"net/http"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// encryptedFields lists, per collection, the text fields that must only ever
+// hold base64-encoded ciphertext: EncryptData output, or client-encrypted blobs
+var encryptedFields = []struct {
+	collection string
+	fields     []string
+}{
+	{"notes", []string{"message", "title", "tags"}},
+	{"encrypted_files", []string{"file_name", "content_type"}},
+	{"note_subscriptions", []string{"email"}},
+	{"note_webhooks", []string{"url", "secret"}},
+	{"note_access_log", []string{"entry"}},
+	{"blobs", []string{"ciphertext"}},
+}
+
+// PlaintextFinding is a stored value that reads as plaintext without decryption
+type PlaintextFinding struct {
+	Collection string `json:"collection"`
+	RecordID   string `json:"recordId"`
+	Field      string `json:"field"`
+	Reason     string `json:"reason"`
+}
+
+// EncryptionAudit summarises an AuditEncryption run
+type EncryptionAudit struct {
+	Checked  map[string]int     `json:"checked"`  // records checked per collection
+	Flagged  map[string]int     `json:"flagged"`  // records with at least one finding, per collection
+	Findings []PlaintextFinding `json:"findings"` // one per offending field
+}
+
+// AuditEncryption checks that every value stored as ciphertext actually is:
+// note fields, attachment names, types, contents and thumbnails, and the server-key
+// encrypted notification targets. Values that decode as readable text or a known file
+// format without decryption are reported, typically data written before
+// encryption was introduced. Nothing is modified.
+func (s *IntegrityService) AuditEncryption() (*EncryptionAudit, error) {
+	audit := &EncryptionAudit{Checked: map[string]int{}, Flagged: map[string]int{}}
+
+	for _, c := range encryptedFields {
+		if _, err := s.App.FindCachedCollectionByNameOrId(c.collection); err != nil {
+			continue // optional feature never set up
+		}
+		audit.Checked[c.collection] = 0
+		err := s.eachRecord(c.collection, func(rec *core.Record) {
+			audit.Checked[c.collection]++
+			flagged := false
+			for _, field := range c.fields {
+				if reason := plaintextReason(rec.GetString(field)); reason != "" {
+					audit.add(rec, field, reason)
+					flagged = true
+				}
+			}
+
+			if c.collection == "encrypted_files" {
+				for _, field := range []string{"file_data", "thumbnail"} {
+					// file_data is empty for attachments whose data is shared content
+					if rec.GetString(field) == "" && (field != "file_data" || rec.GetString("content") == "") {
+						continue
+					}
+					if data, err := s.Files.readStoredField(s.App, rec, field); err == nil {
+						if kind := http.DetectContentType(data); len(data) > 0 && kind != "application/octet-stream" {
+							audit.add(rec, field, "content is readable as "+kind)
+							flagged = true
+						}
+					}
+				}
+			}
+
+			if flagged {
+				audit.Flagged[c.collection]++
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return audit, nil
+}
+
+func (a *EncryptionAudit) add(rec *core.Record, field, reason string) {
+	a.Findings = append(a.Findings, PlaintextFinding{
+		Collection: rec.Collection().Name,
+		RecordID:   rec.Id,
+		Field:      field,
+		Reason:     reason,
+	})
+}
+
+// plaintextReason explains why a stored value looks like plaintext rather
+// than base64 ciphertext, or returns "" when it doesn't. Empty values are
+// fine: optional fields are left unset rather than encrypted.
+func plaintextReason(value string) string {
+	if value == "" {
+		return ""
+	}
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "is not base64, so it was stored unencrypted"
+	}
+	if isReadableText(raw) {
+		return "decodes to readable text without decryption"
+	}
+	return ""
+}
+
+// isReadableText reports whether b is valid UTF-8 without control characters
+// other than whitespace. Ciphertext of any real length practically never is.
+func isReadableText(b []byte) bool {
+	if len(b) == 0 || !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
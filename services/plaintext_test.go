@@ -0,0 +1,31 @@
+package services
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestPlaintextReason(t *testing.T) {
+	enc := NewEncryptionService()
+	for _, message := range []string{"", "hello", "a much longer secret message\nwith lines"} {
+		sealed, err := enc.EncryptData([]byte(message), "phrase")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reason := plaintextReason(base64.StdEncoding.EncodeToString(sealed)); reason != "" {
+			t.Errorf("ciphertext of %q flagged: %s", message, reason)
+		}
+	}
+
+	cases := map[string]bool{
+		"":         false, // unset optional field
+		"buy milk": true,  // not base64
+		base64.StdEncoding.EncodeToString([]byte("legacy note\n")):  true,
+		base64.StdEncoding.EncodeToString([]byte{0x00, 0xff, 0x10}): false,
+	}
+	for value, want := range cases {
+		if got := plaintextReason(value) != ""; got != want {
+			t.Errorf("plaintextReason(%q) flagged = %v, want %v", value, got, want)
+		}
+	}
+}
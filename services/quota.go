@@ -0,0 +1,234 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Quota caps what a single passphrase can store. Zero leaves a cap off.
+type Quota struct {
+	MaxNoteBytes       int64 // decrypted note message
+	MaxAttachmentBytes int64 // all attachments together, decrypted
+	MaxAttachments     int   // number of attachments
+}
+
+// Usage is how much of its quota a passphrase uses, for clients to display.
+// A limit of 0 means there is none.
+type Usage struct {
+	NoteBytes            int64 `json:"noteBytes"`
+	NoteLimit            int64 `json:"noteLimit"`
+	AttachmentBytes      int64 `json:"attachmentBytes"`
+	AttachmentLimit      int64 `json:"attachmentLimit"`
+	AttachmentCount      int   `json:"attachmentCount"`
+	AttachmentCountLimit int   `json:"attachmentCountLimit"`
+}
+
+// StorageUsage is how many bytes of ciphertext a passphrase has stored
+type StorageUsage struct {
+	NoteBytes       int64 `json:"noteBytes"`       // the note's message, title and tags
+	AttachmentBytes int64 `json:"attachmentBytes"` // attachment files, names and content types
+	ThumbnailBytes  int64 `json:"thumbnailBytes"`
+	TotalBytes      int64 `json:"totalBytes"`
+	Attachments     int   `json:"attachments"`
+}
+
+// QuotaError is returned when a change would take a passphrase over its quota
+type QuotaError struct {
+	What  string // "note", "attachments" or "attachment count"
+	Limit int64
+	Usage int64 // bytes (or attachments) stored before the change
+	Size  int64 // bytes (or attachments) the change would leave stored
+}
+
+func (e *QuotaError) Error() string {
+	if e.What == "attachment count" {
+		return fmt.Sprintf("the change would leave %d attachments, over the limit of %d (%d stored)", e.Size, e.Limit, e.Usage)
+	}
+	return fmt.Sprintf("the %s would take %d bytes, over the %d byte limit (%d bytes in use)", e.What, e.Size, e.Limit, e.Usage)
+}
+
+// SetQuota sets the caps enforced by CheckNoteQuota and CheckAttachmentQuota
+func (n *NoteService) SetQuota(quota Quota) {
+	n.quota = quota
+}
+
+// Usage reports the phrase's usage, for a note whose decrypted message is message
+func (n *NoteService) Usage(phrase, message string) (*Usage, error) {
+	return n.usage(phrase, int64(len(message)))
+}
+
+// StoredUsage reports the phrase's usage without decrypting its note, whose
+// size is worked out from the ciphertext
+func (n *NoteService) StoredUsage(phrase string) (*Usage, error) {
+	noteBytes, err := n.StoredNoteBytes(n.App, phrase)
+	if err != nil {
+		return nil, err
+	}
+	return n.usage(phrase, noteBytes)
+}
+
+func (n *NoteService) usage(phrase string, noteBytes int64) (*Usage, error) {
+	attachments, err := storedAttachments(n.App, n.hashPhrase(phrase))
+	if err != nil {
+		return nil, err
+	}
+	return &Usage{
+		NoteBytes:            noteBytes,
+		NoteLimit:            n.quota.MaxNoteBytes,
+		AttachmentBytes:      attachments.Size,
+		AttachmentLimit:      n.quota.MaxAttachmentBytes,
+		AttachmentCount:      attachments.Count,
+		AttachmentCountLimit: n.quota.MaxAttachments,
+	}, nil
+}
+
+// CheckNoteQuota returns a *QuotaError when a note of size bytes is over the
+// note quota, with the size of the note as stored now as its usage
+func (n *NoteService) CheckNoteQuota(app core.App, phrase string, size int64) error {
+	if n.quota.MaxNoteBytes <= 0 || size <= n.quota.MaxNoteBytes {
+		return nil
+	}
+	usage, err := n.StoredNoteBytes(app, phrase)
+	if err != nil {
+		return err
+	}
+	return n.noteQuota(usage, size)
+}
+
+// noteQuota returns a *QuotaError when size is over the note quota
+func (n *NoteService) noteQuota(usage, size int64) error {
+	if n.quota.MaxNoteBytes <= 0 || size <= n.quota.MaxNoteBytes {
+		return nil
+	}
+	return &QuotaError{What: "note", Limit: n.quota.MaxNoteBytes, Usage: usage, Size: size}
+}
+
+// CheckAttachmentQuota returns a *QuotaError when adding count attachments
+// of adding bytes would take the phrase over its attachment quota. With
+// replace set the new attachments take the place of the current ones.
+func (n *NoteService) CheckAttachmentQuota(app core.App, phrase string, adding int64, count int, replace bool) error {
+	return checkAttachmentQuota(app, n.quota, n.hashPhrase(phrase), adding, count, replace)
+}
+
+// checkAttachmentQuota is CheckAttachmentQuota for a phrase hash, shared with
+// FileService, which enforces the quota as it stores files
+func checkAttachmentQuota(app core.App, quota Quota, phraseHash string, adding int64, count int, replace bool) error {
+	if quota.MaxAttachmentBytes <= 0 && quota.MaxAttachments <= 0 {
+		return nil
+	}
+	stored, err := storedAttachments(app, phraseHash)
+	if err != nil {
+		return err
+	}
+	total, files := stored.Size+adding, stored.Count+count
+	if replace {
+		total, files = adding, count
+	}
+	if quota.MaxAttachments > 0 && files > quota.MaxAttachments {
+		return &QuotaError{What: "attachment count", Limit: int64(quota.MaxAttachments), Usage: int64(stored.Count), Size: int64(files)}
+	}
+	if quota.MaxAttachmentBytes > 0 && total > quota.MaxAttachmentBytes {
+		return &QuotaError{What: "attachments", Limit: quota.MaxAttachmentBytes, Usage: stored.Size, Size: total}
+	}
+	return nil
+}
+
+// StoredNoteBytes returns the decrypted size of the phrase's stored note,
+// worked out from its ciphertext; 0 when there is none
+func (n *NoteService) StoredNoteBytes(app core.App, phrase string) (int64, error) {
+	records, err := app.FindRecordsByFilter("notes", "phrase_hash = {:phrase_hash}", "", 1, 0, dbx.Params{"phrase_hash": n.hashPhrase(phrase)})
+	if err != nil {
+		return 0, fmt.Errorf("failed to query notes: %w", err)
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(records[0].GetString("message"))
+	if err != nil || len(sealed) == 0 {
+		return 0, nil
+	}
+	return int64(n.Encryption.PlaintextSize(sealed)), nil
+}
+
+// AttachmentBytes returns the decrypted size of all attachments stored under the phrase
+func (n *NoteService) AttachmentBytes(app core.App, phrase string) (int64, error) {
+	stored, err := storedAttachments(app, n.hashPhrase(phrase))
+	if err != nil {
+		return 0, err
+	}
+	return stored.Size, nil
+}
+
+// attachmentTotals is the number and decrypted size of a phrase's attachments
+type attachmentTotals struct {
+	Size  int64 `db:"size"`
+	Count int   `db:"count"`
+}
+
+func storedAttachments(app core.App, phraseHash string) (*attachmentTotals, error) {
+	var totals attachmentTotals
+	err := app.DB().NewQuery("SELECT COALESCE(SUM(size), 0) AS size, COUNT(*) AS count FROM encrypted_files WHERE phrase_hash = {:phrase_hash}").
+		Bind(dbx.Params{"phrase_hash": phraseHash}).
+		One(&totals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum attachment sizes: %w", err)
+	}
+	return &totals, nil
+}
+
+// StorageUsage reports the ciphertext a passphrase has stored, summed from
+// the stored sizes records keep rather than by reading files. Attachment data
+// shared by several attachments counts once, and a note in the trash counts
+// until it is purged.
+func (n *NoteService) StorageUsage(phrase string) (*StorageUsage, error) {
+	params := dbx.Params{"phrase_hash": n.hashPhrase(phrase)}
+	var note struct {
+		Bytes int64 `db:"bytes"`
+	}
+	err := n.App.DB().NewQuery("SELECT COALESCE(SUM(" + decodedLen("message") + " + " + decodedLen("title") + " + " + decodedLen("tags") + "), 0) AS bytes FROM notes WHERE phrase_hash = {:phrase_hash}").
+		Bind(params).
+		One(&note)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum note sizes: %w", err)
+	}
+
+	var files struct {
+		Bytes     int64 `db:"bytes"`
+		Thumbnail int64 `db:"thumbnail"`
+		Count     int   `db:"count"`
+	}
+	err = n.App.DB().NewQuery("SELECT COALESCE(SUM(stored_size + " + decodedLen("file_name") + " + " + decodedLen("content_type") + "), 0) AS bytes, COALESCE(SUM(thumbnail_size), 0) AS thumbnail, COUNT(*) AS count FROM encrypted_files WHERE phrase_hash = {:phrase_hash}").
+		Bind(params).
+		One(&files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum attachment sizes: %w", err)
+	}
+
+	var contents struct {
+		Bytes int64 `db:"bytes"`
+	}
+	err = n.App.DB().NewQuery("SELECT COALESCE(SUM(stored_size), 0) AS bytes FROM attachment_contents WHERE phrase_hash = {:phrase_hash}").
+		Bind(params).
+		One(&contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum attachment content sizes: %w", err)
+	}
+
+	usage := &StorageUsage{
+		NoteBytes:       note.Bytes,
+		AttachmentBytes: files.Bytes + contents.Bytes,
+		ThumbnailBytes:  files.Thumbnail,
+		Attachments:     files.Count,
+	}
+	usage.TotalBytes = usage.NoteBytes + usage.AttachmentBytes + usage.ThumbnailBytes
+	return usage, nil
+}
+
+// decodedLen is SQL for the length of the bytes the base64 text in column
+// decodes to
+func decodedLen(column string) string {
+	return fmt.Sprintf("(LENGTH(COALESCE(%[1]s, '')) / 4 * 3 - (CASE WHEN %[1]s LIKE '%%==' THEN 2 WHEN %[1]s LIKE '%%=' THEN 1 ELSE 0 END))", column)
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestNoteQuota(t *testing.T) {
+	n := &NoteService{}
+	if err := n.noteQuota(10, 1<<30); err != nil {
+		t.Fatalf("no quota set, got %v", err)
+	}
+
+	n.SetQuota(Quota{MaxNoteBytes: 100})
+	if err := n.noteQuota(10, 100); err != nil {
+		t.Fatalf("at the limit, got %v", err)
+	}
+	var quotaErr *QuotaError
+	if err := n.noteQuota(10, 101); !errors.As(err, &quotaErr) {
+		t.Fatalf("over the limit, got %v", err)
+	}
+	if quotaErr.What != "note" || quotaErr.Limit != 100 || quotaErr.Usage != 10 || quotaErr.Size != 101 {
+		t.Fatalf("unexpected quota error %+v", quotaErr)
+	}
+}
+
+func TestQuotaErrorMessage(t *testing.T) {
+	count := &QuotaError{What: "attachment count", Limit: 20, Usage: 18, Size: 23}
+	if got := count.Error(); got != "the change would leave 23 attachments, over the limit of 20 (18 stored)" {
+		t.Fatalf("unexpected message %q", got)
+	}
+	size := &QuotaError{What: "attachments", Limit: 100, Usage: 40, Size: 140}
+	if got := size.Error(); got != "the attachments would take 140 bytes, over the 100 byte limit (40 bytes in use)" {
+		t.Fatalf("unexpected message %q", got)
+	}
+}
+
+func TestStorageUsage(t *testing.T) {
+	app := migratedApp(t)
+	encryption := NewEncryptionService()
+	notes := NewNoteService(app, encryption)
+	files := NewFileService(app, encryption)
+	phrase := "storage-usage-phrase"
+
+	title, tags := "Usage", []string{"one", "two"}
+	if _, _, err := notes.GetOrCreateNote(phrase); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := notes.UpdateNote(phrase, "a note whose ciphertext is counted", NoteMetadata{Title: &title, Tags: &tags}); err != nil {
+		t.Fatal(err)
+	}
+	// the same attachment twice shares one stored content
+	same := DecryptedFile{Name: "same.txt", ContentType: "text/plain", Data: []byte("an attachment stored twice")}
+	err := app.RunInTransaction(func(txApp core.App) error {
+		_, err := files.ImportFiles(txApp, phrase, []DecryptedFile{same, same})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+	fileSize := func(rec *core.Record, field string) int64 {
+		t.Helper()
+		name := rec.GetString(field)
+		if name == "" {
+			return 0
+		}
+		attrs, err := fsys.Attributes(rec.BaseFilesPath() + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return attrs.Size
+	}
+	decoded := func(rec *core.Record, fields ...string) int64 {
+		t.Helper()
+		var n int64
+		for _, field := range fields {
+			data, err := base64.StdEncoding.DecodeString(rec.GetString(field))
+			if err != nil {
+				t.Fatal(err)
+			}
+			n += int64(len(data))
+		}
+		return n
+	}
+
+	note, err := app.FindFirstRecordByData("notes", "phrase_hash", notes.hashPhrase(phrase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNote := decoded(note, "message", "title", "tags")
+
+	attachments, err := app.FindAllRecords("encrypted_files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := app.FindAllRecords("attachment_contents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attachments) != 2 || len(contents) != 1 {
+		t.Fatalf("expected two attachments sharing one content, got %d and %d", len(attachments), len(contents))
+	}
+	var wantAttachments, wantThumbnails int64
+	for _, rec := range attachments {
+		wantAttachments += fileSize(rec, "file_data") + decoded(rec, "file_name", "content_type")
+		wantThumbnails += fileSize(rec, "thumbnail")
+	}
+	wantAttachments += fileSize(contents[0], "data")
+
+	usage, err := notes.StorageUsage(phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.NoteBytes != wantNote {
+		t.Fatalf("expected %d note bytes, got %d", wantNote, usage.NoteBytes)
+	}
+	if usage.AttachmentBytes != wantAttachments {
+		t.Fatalf("expected %d attachment bytes, got %d", wantAttachments, usage.AttachmentBytes)
+	}
+	if usage.ThumbnailBytes != wantThumbnails || usage.Attachments != 2 {
+		t.Fatalf("expected %d thumbnail bytes and 2 attachments, got %+v", wantThumbnails, usage)
+	}
+	if want := wantNote + wantAttachments + wantThumbnails; usage.TotalBytes != want {
+		t.Fatalf("expected %d bytes in total, got %d", want, usage.TotalBytes)
+	}
+}
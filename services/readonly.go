@@ -0,0 +1,35 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/dbx"
+)
+
+// IsReadOnly reports whether the phrase's note is marked read-only. A missing
+// note isn't.
+func (n *NoteService) IsReadOnly(phrase string) (bool, error) {
+	count, err := n.App.CountRecords("notes", dbx.HashExp{"phrase_hash": n.hashPhrase(phrase), "read_only": true})
+	if err != nil {
+		return false, fmt.Errorf("failed to query notes: %w", err)
+	}
+	return count > 0, nil
+}
+
+// SetReadOnly marks the phrase's note read-only, or writable again
+func (n *NoteService) SetReadOnly(phrase string, readOnly bool) error {
+	records, err := n.App.FindRecordsByFilter("notes", "phrase_hash = {:phrase_hash}", "", 1, 0, dbx.Params{"phrase_hash": n.hashPhrase(phrase)})
+	if err != nil {
+		return fmt.Errorf("failed to query notes: %w", err)
+	}
+	if len(records) == 0 {
+		return ErrNoteNotFound
+	}
+
+	record := records[0]
+	record.Set("read_only", readOnly)
+	if err := n.App.Save(record); err != nil {
+		return fmt.Errorf("failed to update note: %w", err)
+	}
+	return nil
+}
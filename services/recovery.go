@@ -0,0 +1,198 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ktappdev/secretnotes-go-backend/cryptoutil"
+	"github.com/ktappdev/secretnotes-go-backend/shamir"
+)
+
+// A recovery kit splits a passphrase into shares, any threshold of which give
+// it back, so losing the passphrase needn't mean losing the note. The server
+// keeps nothing: shares are handed to the user to print or pass to people
+// they trust, and recovery needs only the shares. Fewer than the threshold
+// reveal nothing about the passphrase.
+//
+// A share is written as "SNR1-" followed by base32 in groups of five, and
+// decodes to
+//
+//	version (1) | kit id (4) | threshold (1) | Shamir share | checksum (4)
+//
+// where the checksum is the first bytes of the SHA-256 of what precedes it,
+// so a mistyped share is caught before it spoils the recovery. The secret
+// shared is the passphrase's length (2, big-endian), the passphrase, zero
+// padding to a multiple of recoveryPad bytes, so shares don't give away the
+// passphrase's exact length, and a check value over all of that and the kit
+// id, which tells a correct recovery from shares of different kits.
+const (
+	recoveryPrefix   = "SNR1"
+	recoveryVersion  = 1
+	recoveryPad      = 32
+	recoveryCheckLen = 8
+
+	// MaxRecoveryShares is the most shares a kit can have
+	MaxRecoveryShares = 16
+
+	// maxRecoveryPhrase bounds the passphrases a kit can hold
+	maxRecoveryPhrase = 1024
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+var (
+	// ErrInvalidShare is returned for a recovery share that is malformed or
+	// mistyped, or for shares that don't recover a passphrase together
+	ErrInvalidShare = errors.New("invalid recovery share")
+
+	// ErrNotEnoughShares is returned when fewer shares are given than the kit
+	// needs
+	ErrNotEnoughShares = errors.New("not enough recovery shares")
+)
+
+// RecoveryKit is a passphrase split into shares
+type RecoveryKit struct {
+	ID        string   // 8 hex digits, the same in every share
+	Threshold int      // shares needed to recover the passphrase
+	Shares    []string // as written down, "SNR1-…"
+}
+
+// SplitPhrase splits phrase into a kit of n shares, any threshold of which
+// recover it
+func SplitPhrase(phrase string, threshold, n int) (*RecoveryKit, error) {
+	if threshold < 2 || threshold > n || n > MaxRecoveryShares {
+		return nil, fmt.Errorf("a recovery kit needs 2 <= threshold <= shares <= %d", MaxRecoveryShares)
+	}
+	if len(phrase) > maxRecoveryPhrase {
+		return nil, fmt.Errorf("passphrases over %d bytes can't be split", maxRecoveryPhrase)
+	}
+
+	var id [4]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate kit id: %w", err)
+	}
+
+	secret := make([]byte, 2+len(phrase), (2+len(phrase)+recoveryPad-1)/recoveryPad*recoveryPad+recoveryCheckLen)
+	defer cryptoutil.Wipe(secret)
+	binary.BigEndian.PutUint16(secret, uint16(len(phrase)))
+	copy(secret[2:], phrase)
+	secret = secret[:cap(secret)-recoveryCheckLen]
+	secret = append(secret, recoveryCheck(id[:], secret)...)
+
+	parts, err := shamir.Split(secret, n, threshold)
+	if err != nil {
+		return nil, err
+	}
+	kit := &RecoveryKit{ID: hex.EncodeToString(id[:]), Threshold: threshold}
+	for _, part := range parts {
+		kit.Shares = append(kit.Shares, encodeShare(id, threshold, part))
+		cryptoutil.Wipe(part)
+	}
+	return kit, nil
+}
+
+// RecoverPhrase recovers the passphrase from shares of one kit, returning it
+// and the kit's id. Shares may be written in either case, and spaces and
+// dashes are ignored.
+func RecoverPhrase(shares []string) (phrase, kitID string, err error) {
+	var (
+		id        []byte
+		threshold int
+		parts     [][]byte
+	)
+	for i, s := range shares {
+		shareID, t, part, err := decodeShare(s)
+		if err != nil {
+			return "", "", fmt.Errorf("%w: share %d: %v", ErrInvalidShare, i+1, err)
+		}
+		if id == nil {
+			id, threshold = shareID, t
+		} else if !bytes.Equal(shareID, id) || t != threshold {
+			return "", "", fmt.Errorf("%w: share %d belongs to kit %x, not %x", ErrInvalidShare, i+1, shareID, id)
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) < max(threshold, 2) {
+		return "", "", fmt.Errorf("%w: %d of %d given", ErrNotEnoughShares, len(parts), max(threshold, 2))
+	}
+
+	secret, err := shamir.Combine(parts)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrInvalidShare, err)
+	}
+	defer cryptoutil.Wipe(secret)
+	body, check := secret[:len(secret)-recoveryCheckLen], secret[len(secret)-recoveryCheckLen:]
+	if len(body) < 2 || !bytes.Equal(check, recoveryCheck(id, body)) {
+		return "", "", fmt.Errorf("%w: the shares don't recover a passphrase", ErrInvalidShare)
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if n > len(body)-2 {
+		return "", "", fmt.Errorf("%w: the shares don't recover a passphrase", ErrInvalidShare)
+	}
+	return string(body[2 : 2+n]), hex.EncodeToString(id), nil
+}
+
+// recoveryCheck returns the check value ending a kit's secret
+func recoveryCheck(id, body []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("secretnotes-recovery\x00"))
+	h.Write(id)
+	h.Write(body)
+	return h.Sum(nil)[:recoveryCheckLen]
+}
+
+// encodeShare writes one Shamir share of a kit as text
+func encodeShare(id [4]byte, threshold int, part []byte) string {
+	raw := []byte{recoveryVersion}
+	raw = append(raw, id[:]...)
+	raw = append(raw, byte(threshold))
+	raw = append(raw, part...)
+	sum := sha256.Sum256(raw)
+	raw = append(raw, sum[:4]...)
+
+	text := recoveryEncoding.EncodeToString(raw)
+	var b strings.Builder
+	b.WriteString(recoveryPrefix)
+	for i := 0; i < len(text); i += 5 {
+		b.WriteByte('-')
+		b.WriteString(text[i:min(i+5, len(text))])
+	}
+	return b.String()
+}
+
+// decodeShare parses a share written by encodeShare
+func decodeShare(s string) (id []byte, threshold int, part []byte, err error) {
+	s = strings.ToUpper(strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, s))
+	text, ok := strings.CutPrefix(s, recoveryPrefix)
+	if !ok {
+		return nil, 0, nil, fmt.Errorf("expected it to start with %s", recoveryPrefix)
+	}
+	raw, err := recoveryEncoding.DecodeString(text)
+	if err != nil {
+		return nil, 0, nil, errors.New("it contains characters a share can't have")
+	}
+	// version, id, threshold, at least two bytes of share and the checksum
+	if len(raw) < 1+4+1+2+4 {
+		return nil, 0, nil, errors.New("it is too short")
+	}
+	body, sum := raw[:len(raw)-4], raw[len(raw)-4:]
+	if want := sha256.Sum256(body); !bytes.Equal(sum, want[:4]) {
+		return nil, 0, nil, errors.New("its checksum doesn't match; check it for typos")
+	}
+	if body[0] != recoveryVersion {
+		return nil, 0, nil, fmt.Errorf("unsupported version %d", body[0])
+	}
+	return body[1:5], int(body[5]), body[6:], nil
+}
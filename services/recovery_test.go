@@ -0,0 +1,77 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRecoveryKit(t *testing.T) {
+	phrase := "correct horse battery staple ✓"
+	kit, err := SplitPhrase(phrase, 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kit.Shares) != 5 || kit.Threshold != 3 || len(kit.ID) != 8 {
+		t.Fatalf("unexpected kit: %+v", kit)
+	}
+	for _, share := range kit.Shares {
+		if !strings.HasPrefix(share, "SNR1-") {
+			t.Fatalf("unexpected share format: %s", share)
+		}
+	}
+
+	// any three shares, retyped in lower case without dashes, recover it
+	retyped := strings.ToLower(strings.ReplaceAll(kit.Shares[4], "-", " "))
+	got, id, err := RecoverPhrase([]string{kit.Shares[1], retyped, kit.Shares[2]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != phrase || id != kit.ID {
+		t.Fatalf("recovered %q from kit %s", got, id)
+	}
+
+	// two aren't enough
+	if _, _, err := RecoverPhrase(kit.Shares[:2]); !errors.Is(err, ErrNotEnoughShares) {
+		t.Fatalf("expected ErrNotEnoughShares, got %v", err)
+	}
+
+	// a typo is caught by the share's checksum
+	typo := []byte(kit.Shares[0])
+	if typo[6] == 'A' {
+		typo[6] = 'B'
+	} else {
+		typo[6] = 'A'
+	}
+	if _, _, err := RecoverPhrase([]string{string(typo), kit.Shares[1], kit.Shares[2]}); !errors.Is(err, ErrInvalidShare) {
+		t.Fatalf("expected a mistyped share to be refused, got %v", err)
+	}
+
+	// shares of another kit don't mix in
+	other, err := SplitPhrase(phrase, 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := RecoverPhrase([]string{kit.Shares[0], kit.Shares[1], other.Shares[2]}); !errors.Is(err, ErrInvalidShare) {
+		t.Fatalf("expected shares of different kits to be refused, got %v", err)
+	}
+}
+
+func TestRecoveryKitPadding(t *testing.T) {
+	short, _ := SplitPhrase("abc", 2, 2)
+	longer, _ := SplitPhrase("a somewhat longer passphrase", 2, 2)
+	if len(short.Shares[0]) != len(longer.Shares[0]) {
+		t.Fatalf("expected shares to hide the passphrase length, got %d and %d characters", len(short.Shares[0]), len(longer.Shares[0]))
+	}
+}
+
+func TestRecoveryKitLimits(t *testing.T) {
+	for _, c := range []struct{ threshold, n int }{{1, 3}, {4, 3}, {2, MaxRecoveryShares + 1}} {
+		if _, err := SplitPhrase("passphrase", c.threshold, c.n); err == nil {
+			t.Fatalf("expected threshold %d of %d to be refused", c.threshold, c.n)
+		}
+	}
+	if _, _, err := RecoverPhrase([]string{"not a share", "SNR1-AAAAA"}); !errors.Is(err, ErrInvalidShare) {
+		t.Fatalf("expected ErrInvalidShare, got %v", err)
+	}
+}
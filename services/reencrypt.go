@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// reencryptBatchSize is how many records Reencrypt handles between checkpoints
+const reencryptBatchSize = 100
+
+// ReencryptOptions tunes a Reencrypt run
+type ReencryptOptions struct {
+	RecordsPerSecond int                     // throttle, so a live server keeps up; 0 runs flat out
+	CheckpointFile   string                  // where the position is saved, so an interrupted run resumes; empty saves nothing
+	Progress         func(ReencryptProgress) // called after each batch
+}
+
+// ReencryptProgress is how far a Reencrypt run is through a collection
+type ReencryptProgress struct {
+	Collection string `json:"collection"`
+	Done       int    `json:"done"`
+	Total      int    `json:"total"`
+}
+
+// Reencryption summarises a Reencrypt run, resumed runs included
+type Reencryption struct {
+	ServerLayerRotation
+	PendingNotes int `json:"pendingNotes"` // notes keyed with older settings, which take their passphrase to move
+}
+
+// reencryptCheckpoint is what Reencrypt saves after each batch
+type reencryptCheckpoint struct {
+	LayerKey byte          `json:"layerKey"` // server layer key the run moves data to
+	Step     int           `json:"step"`     // index into reencryptSteps
+	After    string        `json:"after"`    // id of the last record handled in the step
+	Run      *Reencryption `json:"run"`
+}
+
+// reencryptStep is a collection Reencrypt walks, with its encrypted fields and files
+type reencryptStep struct {
+	collection string
+	fields     []string
+	files      []string
+}
+
+// reencryptSteps returns the collections Reencrypt walks, in order
+func reencryptSteps() []reencryptStep {
+	var steps []reencryptStep
+	for _, c := range encryptedFields {
+		if c.collection == "blobs" {
+			continue // client-encrypted, never layered
+		}
+		steps = append(steps, reencryptStep{collection: c.collection, fields: c.fields})
+	}
+	for _, c := range serverLayerFiles {
+		i := slices.IndexFunc(steps, func(step reencryptStep) bool { return step.collection == c.collection })
+		if i < 0 {
+			steps = append(steps, reencryptStep{collection: c.collection, files: c.fields})
+			continue
+		}
+		steps[i].files = c.fields
+	}
+	return steps
+}
+
+// Reencrypt walks every record holding ciphertext, in id order, and brings
+// what it can up to date without passphrases: stored fields and attachment
+// files move to the current server layer key, as RotateServerLayer describes.
+// The KDF settings, pepper and KMS data key a field was keyed with can only
+// change with its passphrase, so notes keyed with older ones are counted as
+// pending; they move on their next read.
+//
+// With a checkpoint file the run's position and counts are saved after every
+// batch and when ctx is cancelled, and a later run picks up from there, unless
+// the server layer key changed in between; the file is removed once the run
+// completes. A cancelled run returns what it did so far along with ctx's error.
+func (s *IntegrityService) Reencrypt(ctx context.Context, opts ReencryptOptions) (*Reencryption, error) {
+	layerKey := s.Files.Encryption.layerKeyID
+	checkpoint, err := loadReencryptCheckpoint(opts.CheckpointFile, layerKey)
+	if err != nil {
+		return nil, err
+	}
+	run := checkpoint.Run
+	save := func() error {
+		if opts.CheckpointFile == "" {
+			return nil
+		}
+		return saveReencryptCheckpoint(opts.CheckpointFile, checkpoint)
+	}
+
+	var tick <-chan time.Time
+	if opts.RecordsPerSecond > 0 {
+		interval := time.Second / time.Duration(opts.RecordsPerSecond)
+		if interval <= 0 {
+			interval = time.Nanosecond // over a billion a second: as good as no throttle
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	steps := reencryptSteps()
+	for ; checkpoint.Step < len(steps); checkpoint.Step, checkpoint.After = checkpoint.Step+1, "" {
+		step := steps[checkpoint.Step]
+		if _, err := s.App.FindCachedCollectionByNameOrId(step.collection); err != nil {
+			continue // optional feature never set up
+		}
+		total, err := s.App.CountRecords(step.collection)
+		if err != nil {
+			return nil, fmt.Errorf("error counting %s: %w", step.collection, err)
+		}
+		done, err := s.App.CountRecords(step.collection, dbx.NewExp("id <= {:after}", dbx.Params{"after": checkpoint.After}))
+		if err != nil {
+			return nil, fmt.Errorf("error counting %s: %w", step.collection, err)
+		}
+		if _, ok := run.Checked[step.collection]; !ok {
+			run.Checked[step.collection] = 0
+		}
+
+		for {
+			records, err := s.App.FindRecordsByFilter(step.collection, "id > {:after}", "id", reencryptBatchSize, 0, dbx.Params{"after": checkpoint.After})
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %w", step.collection, err)
+			}
+			for _, rec := range records {
+				select {
+				case <-ctx.Done():
+					return run, errors.Join(ctx.Err(), save())
+				default:
+				}
+				if tick != nil {
+					select {
+					case <-tick:
+					case <-ctx.Done():
+						return run, errors.Join(ctx.Err(), save())
+					}
+				}
+				s.reencryptRecord(rec, step, run)
+				checkpoint.After = rec.Id
+				done++
+			}
+			if err := save(); err != nil {
+				return nil, err
+			}
+			if opts.Progress != nil {
+				opts.Progress(ReencryptProgress{Collection: step.collection, Done: int(done), Total: int(total)})
+			}
+			if len(records) < reencryptBatchSize {
+				break
+			}
+		}
+	}
+
+	if opts.CheckpointFile != "" {
+		if err := os.Remove(opts.CheckpointFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove the checkpoint: %w", err)
+		}
+	}
+	return run, nil
+}
+
+// reencryptRecord brings one record up to date for Reencrypt
+func (s *IntegrityService) reencryptRecord(rec *core.Record, step reencryptStep, run *Reencryption) {
+	run.Checked[step.collection]++
+	s.rotateRecord(rec, step.fields, step.files, &run.ServerLayerRotation)
+	if step.collection != "notes" {
+		return
+	}
+	for _, field := range upgradedNoteFields {
+		raw, err := base64.StdEncoding.DecodeString(rec.GetString(field))
+		if err == nil && len(raw) > 0 && s.Files.Encryption.Outdated(raw, recordBinding(rec, field)) {
+			run.PendingNotes++
+			return
+		}
+	}
+}
+
+// loadReencryptCheckpoint reads the checkpoint of an interrupted run moving
+// data to layerKey, or starts a new one when there is none
+func loadReencryptCheckpoint(path string, layerKey byte) (*reencryptCheckpoint, error) {
+	fresh := &reencryptCheckpoint{
+		LayerKey: layerKey,
+		Run: &Reencryption{
+			ServerLayerRotation: ServerLayerRotation{Checked: map[string]int{}, Rewrapped: map[string]int{}},
+		},
+	}
+	if path == "" {
+		return fresh, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fresh, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the checkpoint: %w", err)
+	}
+	var checkpoint reencryptCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil || checkpoint.Run == nil {
+		return nil, fmt.Errorf("checkpoint %s is damaged; delete it to start over", path)
+	}
+	if checkpoint.LayerKey != layerKey {
+		return fresh, nil // the records done so far would have to move again
+	}
+	if checkpoint.Run.Checked == nil {
+		checkpoint.Run.Checked = map[string]int{}
+	}
+	if checkpoint.Run.Rewrapped == nil {
+		checkpoint.Run.Rewrapped = map[string]int{}
+	}
+	return &checkpoint, nil
+}
+
+// saveReencryptCheckpoint writes the checkpoint through a temporary file, so
+// a crash leaves the previous one in place
+func saveReencryptCheckpoint(path string, checkpoint *reencryptCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to save the checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to save the checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReencryptSteps(t *testing.T) {
+	steps := reencryptSteps()
+	var names []string
+	for _, step := range steps {
+		names = append(names, step.collection)
+		if step.collection == "blobs" {
+			t.Fatal("expected client-encrypted blobs to be skipped")
+		}
+		if step.collection == "encrypted_files" && (len(step.fields) == 0 || len(step.files) == 0) {
+			t.Fatalf("expected attachments to have their fields and files in one step, got %+v", step)
+		}
+	}
+	if names[0] != "notes" || !slices.Contains(names, "attachment_contents") {
+		t.Fatalf("unexpected steps %v", names)
+	}
+}
+
+func TestReencryptCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	fresh, err := loadReencryptCheckpoint(path, 1)
+	if err != nil || fresh.Step != 0 || fresh.After != "" || fresh.Run.Checked == nil {
+		t.Fatalf("expected a fresh checkpoint, got %+v, %v", fresh, err)
+	}
+	fresh.Step, fresh.After = 2, "abc123"
+	fresh.Run.Checked["notes"] = 40
+	fresh.Run.PendingNotes = 3
+	if err := saveReencryptCheckpoint(path, fresh); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, err := loadReencryptCheckpoint(path, 1)
+	if err != nil || resumed.Step != 2 || resumed.After != "abc123" || resumed.Run.Checked["notes"] != 40 || resumed.Run.PendingNotes != 3 {
+		t.Fatalf("expected the saved position, got %+v, %v", resumed, err)
+	}
+	if other, err := loadReencryptCheckpoint(path, 2); err != nil || other.Step != 0 || other.LayerKey != 2 {
+		t.Fatalf("expected a new server layer key to start over, got %+v, %v", other, err)
+	}
+
+	os.WriteFile(path, []byte("{"), 0o600)
+	if _, err := loadReencryptCheckpoint(path, 1); err == nil {
+		t.Fatal("expected a damaged checkpoint to be an error")
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	app := migratedApp(t)
+	encryption := NewEncryptionService()
+	notes := NewNoteService(app, encryption)
+	integrity := NewIntegrityService(app, NewFileService(app, encryption))
+
+	phrases := []string{"reencrypt-one", "reencrypt-two", "reencrypt-three", "reencrypt-four"}
+	for _, phrase := range phrases {
+		if _, _, err := notes.GetOrCreateNote(phrase); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := notes.UpdateNote(phrase, "keyed with the old settings", NoteMetadata{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// every note now needs its passphrase to move to the new settings
+	encryption.Iterations += 1000
+
+	// rates past a nanosecond per record don't stop the ticker
+	run, err := integrity.Reencrypt(context.Background(), ReencryptOptions{RecordsPerSecond: 2_000_000_000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Checked["notes"] != 4 || run.PendingNotes != 4 {
+		t.Fatalf("expected four pending notes, got %d of %d", run.PendingNotes, run.Checked["notes"])
+	}
+
+	// reading a note moves it
+	if _, err := notes.FindNote(phrases[0]); err != nil {
+		t.Fatal(err)
+	}
+	if run, err := integrity.Reencrypt(context.Background(), ReencryptOptions{}); err != nil || run.PendingNotes != 3 {
+		t.Fatalf("expected three pending notes after a read, got %+v, %v", run, err)
+	}
+
+	// a checkpoint past the first two notes resumes with its counts
+	records, err := app.FindRecordsByFilter("notes", "", "id", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	checkpoint, _ := loadReencryptCheckpoint(path, encryption.layerKeyID)
+	checkpoint.After = records[1].Id
+	checkpoint.Run.Checked["notes"] = 2
+	if err := saveReencryptCheckpoint(path, checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	var pending int
+	for _, rec := range records[2:] {
+		raw, _ := base64.StdEncoding.DecodeString(rec.GetString("message"))
+		if encryption.Outdated(raw, recordBinding(rec, "message")) {
+			pending++
+		}
+	}
+	run, err = integrity.Reencrypt(context.Background(), ReencryptOptions{CheckpointFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Checked["notes"] != 4 || run.PendingNotes != pending {
+		t.Fatalf("expected the last two notes walked with %d pending, got %d of %d", pending, run.PendingNotes, run.Checked["notes"])
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("expected the checkpoint to be removed once the run completes")
+	}
+
+	// a cancelled run saves where it stopped
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := integrity.Reencrypt(ctx, ReencryptOptions{CheckpointFile: path}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the run to be cancelled, got %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected a checkpoint after cancelling, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/disintegration/imaging"
+)
+
+const (
+	// DefaultImageQuality is the JPEG quality used when a transform doesn't set one
+	DefaultImageQuality = 85
+
+	// MaxImageDimension caps the requested maximum width or height
+	MaxImageDimension = 16384
+)
+
+var (
+	// ErrInvalidImageTransform is returned for out-of-range or unknown transform parameters
+	ErrInvalidImageTransform = errors.New("invalid image transform")
+
+	// ErrNotAnImage is returned when a transform is requested for content that
+	// isn't an image the server can decode
+	ErrNotAnImage = errors.New("upload is not a decodable image")
+)
+
+// ImageTransform downscales and re-encodes an image upload before it is
+// encrypted. The zero value leaves uploads untouched.
+type ImageTransform struct {
+	MaxWidth  int    // 0 for no limit
+	MaxHeight int    // 0 for no limit
+	Format    string // "jpeg", "webp", or "" to keep the source format
+	Quality   int    // JPEG quality 1-100; 0 for DefaultImageQuality
+}
+
+// ParseImageTransform reads the maxWidth, maxHeight, format and quality upload
+// parameters; empty ones are left at their defaults
+func ParseImageTransform(maxWidth, maxHeight, format, quality string) (ImageTransform, error) {
+	var t ImageTransform
+	var err error
+	if t.MaxWidth, err = parseTransformInt("maxWidth", maxWidth, MaxImageDimension); err != nil {
+		return t, err
+	}
+	if t.MaxHeight, err = parseTransformInt("maxHeight", maxHeight, MaxImageDimension); err != nil {
+		return t, err
+	}
+	if t.Quality, err = parseTransformInt("quality", quality, 100); err != nil {
+		return t, err
+	}
+
+	switch t.Format = strings.ToLower(format); t.Format {
+	case "", "jpeg", "webp":
+	case "jpg":
+		t.Format = "jpeg"
+	default:
+		return t, fmt.Errorf("%w: format must be jpeg or webp", ErrInvalidImageTransform)
+	}
+	return t, nil
+}
+
+func parseTransformInt(name, value string, max int) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > max {
+		return 0, fmt.Errorf("%w: %s must be between 1 and %d", ErrInvalidImageTransform, name, max)
+	}
+	return n, nil
+}
+
+// IsZero reports whether t leaves uploads untouched
+func (t ImageTransform) IsZero() bool {
+	return t == ImageTransform{}
+}
+
+// Apply downscales content to fit the maximum size and re-encodes it, and
+// returns the new content with a matching filename and content type. EXIF
+// orientation is applied and all metadata, such as location, is dropped. An
+// image already within bounds and with no format requested is returned as is.
+//
+// JPEG output honours Quality. WebP output is lossless, which suits
+// screenshots and graphics; photos are usually smaller as JPEG.
+func (t ImageTransform) Apply(content []byte, filename, contentType string) ([]byte, string, string, error) {
+	config, source, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, "", "", ErrNotAnImage
+	}
+	if config.Width*config.Height > maxDecodePixels {
+		return nil, "", "", fmt.Errorf("%w: %dx%d is too large to resize", ErrInvalidImageTransform, config.Width, config.Height)
+	}
+	fits := (t.MaxWidth == 0 || config.Width <= t.MaxWidth) && (t.MaxHeight == 0 || config.Height <= t.MaxHeight)
+	if fits && t.Format == "" {
+		return content, filename, contentType, nil
+	}
+
+	img, err := imaging.Decode(bytes.NewReader(content), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, "", "", ErrNotAnImage
+	}
+	if !fits {
+		width, height := t.MaxWidth, t.MaxHeight
+		if width == 0 {
+			width = config.Width
+		}
+		if height == 0 {
+			height = config.Height
+		}
+		img = imaging.Fit(img, width, height, imaging.Lanczos)
+	}
+
+	format := t.Format
+	if format == "" {
+		format = source // "jpeg", "png", "gif", "webp", ...
+	}
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		quality := t.Quality
+		if quality == 0 {
+			quality = DefaultImageQuality
+		}
+		err = imaging.Encode(&buf, img, imaging.JPEG, imaging.JPEGQuality(quality))
+	case "webp":
+		err = nativewebp.Encode(&buf, img, nil)
+	default:
+		// other sources keep their transparency as PNG
+		format = "png"
+		err = imaging.Encode(&buf, img, imaging.PNG)
+	}
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to encode image: %w", err)
+	}
+
+	ext := map[string]string{"jpeg": ".jpg", "webp": ".webp", "png": ".png"}[format]
+	return buf.Bytes(), strings.TrimSuffix(filename, filepath.Ext(filename)) + ext, "image/" + format, nil
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestParseImageTransform(t *testing.T) {
+	got, err := ParseImageTransform("1600", "", "JPG", "70")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ImageTransform{MaxWidth: 1600, Format: "jpeg", Quality: 70}); got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	if got, err := ParseImageTransform("", "", "", ""); err != nil || !got.IsZero() {
+		t.Fatalf("expected the zero transform, got %+v, %v", got, err)
+	}
+
+	for _, bad := range [][4]string{
+		{"0", "", "", ""},
+		{"", "abc", "", ""},
+		{"", "", "gif", ""},
+		{"", "", "", "101"},
+	} {
+		if _, err := ParseImageTransform(bad[0], bad[1], bad[2], bad[3]); !errors.Is(err, ErrInvalidImageTransform) {
+			t.Errorf("%q: expected ErrInvalidImageTransform, got %v", bad, err)
+		}
+	}
+}
+
+func TestImageTransformApply(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 400, 300))); err != nil {
+		t.Fatal(err)
+	}
+	src := buf.Bytes()
+
+	// within bounds and no format: untouched
+	out, name, kind, err := ImageTransform{MaxWidth: 800}.Apply(src, "shot.png", "image/png")
+	if err != nil || !bytes.Equal(out, src) || name != "shot.png" || kind != "image/png" {
+		t.Fatalf("expected the upload unchanged, got %q %q %v", name, kind, err)
+	}
+
+	for format, wantKind := range map[string]string{"": "image/png", "jpeg": "image/jpeg", "webp": "image/webp"} {
+		out, name, kind, err := ImageTransform{MaxWidth: 200, Format: format}.Apply(src, "shot.png", "image/png")
+		if err != nil {
+			t.Fatalf("%q: %v", format, err)
+		}
+		if kind != wantKind {
+			t.Errorf("%q: expected %s, got %s", format, wantKind, kind)
+		}
+		config, _, err := image.DecodeConfig(bytes.NewReader(out))
+		if err != nil || config.Width != 200 || config.Height != 150 {
+			t.Errorf("%q: expected 200x150, got %dx%d (%v)", format, config.Width, config.Height, err)
+		}
+		if format == "jpeg" && name != "shot.jpg" {
+			t.Errorf("expected the extension to follow the format, got %q", name)
+		}
+	}
+
+	if _, _, _, err := (ImageTransform{MaxWidth: 10}).Apply([]byte("plain text"), "a.txt", "text/plain"); !errors.Is(err, ErrNotAnImage) {
+		t.Fatalf("expected ErrNotAnImage, got %v", err)
+	}
+}
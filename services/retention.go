@@ -0,0 +1,226 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ErrInvalidRetention is returned for a retention rule with negative limits
+var ErrInvalidRetention = errors.New("invalid retention rule")
+
+// Retention limits how long a note's attachments are kept. Zero leaves a
+// limit off. Filenames are encrypted, so the server can't tell versions of
+// one file apart from other files: Keep counts every attachment of the note.
+type Retention struct {
+	MaxAge int64 `json:"maxAge,omitempty"` // seconds since upload
+	Keep   int   `json:"keep,omitempty"`   // newest attachments kept
+}
+
+// RetentionPolicy is the retention that applies to a note's attachments: the
+// note's own rule, the server-wide one, and the stricter of the two, which is
+// what the cron job enforces
+type RetentionPolicy struct {
+	Retention
+	Note   Retention `json:"note"`
+	Server Retention `json:"server"`
+}
+
+// Validate checks that neither limit is negative
+func (r Retention) Validate() error {
+	if r.MaxAge < 0 || r.Keep < 0 {
+		return fmt.Errorf("%w: maxAge and keep must not be negative", ErrInvalidRetention)
+	}
+	return nil
+}
+
+// IsZero reports whether the rule limits nothing
+func (r Retention) IsZero() bool {
+	return r.MaxAge == 0 && r.Keep == 0
+}
+
+// Stricter combines two rules into one that satisfies both
+func (r Retention) Stricter(other Retention) Retention {
+	return Retention{
+		MaxAge: minLimit(r.MaxAge, other.MaxAge),
+		Keep:   int(minLimit(int64(r.Keep), int64(other.Keep))),
+	}
+}
+
+// ExpiresAt returns when an attachment uploaded at created is purged for its
+// age, or nil when there is no age limit
+func (r Retention) ExpiresAt(created time.Time) *time.Time {
+	if r.MaxAge == 0 {
+		return nil
+	}
+	at := created.Add(time.Duration(r.MaxAge) * time.Second)
+	return &at
+}
+
+// Expired reports whether the attachment uploaded at created, the rank-th
+// newest of its note counting from 0, falls outside the rule at now
+func (r Retention) Expired(rank int, created, now time.Time) bool {
+	if r.Keep > 0 && rank >= r.Keep {
+		return true
+	}
+	at := r.ExpiresAt(created)
+	return at != nil && !at.After(now)
+}
+
+// minLimit returns the smaller of two limits, where 0 is no limit
+func minLimit(a, b int64) int64 {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// noteRetention returns the rule a note record sets for its attachments
+func noteRetention(record *core.Record) Retention {
+	return Retention{
+		MaxAge: int64(record.GetInt("attachment_max_age")),
+		Keep:   record.GetInt("attachment_keep"),
+	}
+}
+
+// SetAttachmentRetention sets the phrase's note's own attachment retention
+// rule; a zero rule clears it. The server-wide rule still applies.
+func (n *NoteService) SetAttachmentRetention(phrase string, retention Retention) error {
+	if err := retention.Validate(); err != nil {
+		return err
+	}
+	records, err := n.App.FindRecordsByFilter("notes", "phrase_hash = {:phrase_hash}", "", 1, 0, dbx.Params{"phrase_hash": n.hashPhrase(phrase)})
+	if err != nil {
+		return fmt.Errorf("failed to query notes: %w", err)
+	}
+	if len(records) == 0 {
+		return ErrNoteNotFound
+	}
+
+	record := records[0]
+	record.Set("attachment_max_age", retention.MaxAge)
+	record.Set("attachment_keep", retention.Keep)
+	if err := n.App.Save(record); err != nil {
+		return fmt.Errorf("failed to update note: %w", err)
+	}
+	return nil
+}
+
+// SetRetention sets the server-wide attachment retention rule, which applies
+// to every note on top of its own
+func (f *FileService) SetRetention(retention Retention) {
+	f.retention = retention
+}
+
+// AttachmentRetention returns the retention that applies to the phrase's
+// attachments. A phrase without a note has only the server-wide rule.
+func (f *FileService) AttachmentRetention(phrase string) (*RetentionPolicy, error) {
+	return f.retentionPolicy(f.hashPhrase(phrase))
+}
+
+func (f *FileService) retentionPolicy(phraseHash string) (*RetentionPolicy, error) {
+	policy := &RetentionPolicy{Retention: f.retention, Server: f.retention}
+	records, err := f.App.FindRecordsByFilter("notes", "phrase_hash = {:phrase_hash}", "", 1, 0, dbx.Params{"phrase_hash": phraseHash})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notes: %w", err)
+	}
+	if len(records) > 0 {
+		policy.Note = noteRetention(records[0])
+		policy.Retention = policy.Note.Stricter(policy.Server)
+	}
+	return policy, nil
+}
+
+// PurgeExpiredAttachments deletes every attachment that falls outside its
+// note's retention policy, with its stored data, and points the notes that
+// lost the attachment they served at the one served next. Notes in the trash
+// are left alone, so a restored note comes back with what it had, and a note
+// that fails is logged and skipped. It returns how many attachments it
+// deleted.
+func (f *FileService) PurgeExpiredAttachments() (int, error) {
+	// Only notes with a rule of their own, unless there is a server-wide one
+	var phraseHashes []string
+	if f.retention.IsZero() {
+		records, err := f.App.FindRecordsByFilter("notes", "(attachment_max_age > 0 || attachment_keep > 0) && deleted_at = ''", "", -1, 0)
+		if err != nil {
+			return 0, fmt.Errorf("failed to query notes with retention rules: %w", err)
+		}
+		for _, rec := range records {
+			phraseHashes = append(phraseHashes, rec.GetString("phrase_hash"))
+		}
+	} else {
+		err := f.App.DB().NewQuery("SELECT DISTINCT phrase_hash FROM encrypted_files WHERE phrase_hash NOT IN (SELECT phrase_hash FROM notes WHERE deleted_at != '')").
+			Column(&phraseHashes)
+		if err != nil {
+			return 0, fmt.Errorf("error finding encrypted files: %w", err)
+		}
+	}
+
+	now := time.Now()
+	purged := 0
+	for _, phraseHash := range phraseHashes {
+		deleted, err := f.purgeExpired(phraseHash, now)
+		purged += deleted
+		if err != nil {
+			log.Printf("Warning: failed to purge expired attachments of %s…: %v", phraseHash[:8], err)
+		}
+	}
+	return purged, nil
+}
+
+// purgeExpired deletes the attachments of phraseHash that fall outside its
+// retention policy at now, returning how many it deleted
+func (f *FileService) purgeExpired(phraseHash string, now time.Time) (int, error) {
+	policy, err := f.retentionPolicy(phraseHash)
+	if err != nil || policy.IsZero() {
+		return 0, err
+	}
+	records, err := f.App.FindRecordsByFilter("encrypted_files", "phrase_hash = {:phrase_hash}", "-created", -1, 0, dbx.Params{"phrase_hash": phraseHash})
+	if err != nil {
+		return 0, fmt.Errorf("error finding encrypted files: %w", err)
+	}
+
+	deleted := 0
+	for rank, rec := range records {
+		if !policy.Expired(rank, rec.GetDateTime("created").Time(), now) {
+			continue
+		}
+		if err := f.App.Delete(rec); err != nil {
+			err = fmt.Errorf("failed to delete encrypted file: %w", err)
+			if deleted > 0 {
+				err = errors.Join(err, f.refreshImageHash(phraseHash))
+			}
+			return deleted, err
+		}
+		deleted++
+	}
+	if deleted == 0 {
+		return 0, nil
+	}
+	return deleted, f.refreshImageHash(phraseHash)
+}
+
+// refreshImageHash points the note of phraseHash at the attachment
+// GET /notes/image now serves, or at none when none are left
+func (f *FileService) refreshImageHash(phraseHash string) error {
+	imageHash, err := f.servedImageHash(phraseHash)
+	if err != nil {
+		return err
+	}
+	records, err := f.App.FindRecordsByFilter("notes", "phrase_hash = {:phrase_hash}", "", 1, 0, dbx.Params{"phrase_hash": phraseHash})
+	if err != nil {
+		return fmt.Errorf("failed to query notes: %w", err)
+	}
+	if len(records) == 0 || records[0].GetString("image_hash") == imageHash {
+		return nil
+	}
+	records[0].Set("image_hash", imageHash)
+	if err := f.App.Save(records[0]); err != nil {
+		return fmt.Errorf("failed to update note image hash: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func TestRetentionStricter(t *testing.T) {
+	note := Retention{MaxAge: 3600, Keep: 0}
+	server := Retention{MaxAge: 86400, Keep: 5}
+	if got := note.Stricter(server); got != (Retention{MaxAge: 3600, Keep: 5}) {
+		t.Fatalf("expected the lower of each limit, got %+v", got)
+	}
+	if got := server.Stricter(Retention{}); got != server {
+		t.Fatalf("expected a zero rule to change nothing, got %+v", got)
+	}
+}
+
+func TestRetentionExpired(t *testing.T) {
+	now := time.Now()
+	r := Retention{MaxAge: 60, Keep: 2}
+	if r.Expired(0, now.Add(-30*time.Second), now) || r.Expired(1, now, now) {
+		t.Fatal("expected the newest attachments within the age limit to be kept")
+	}
+	if !r.Expired(2, now, now) {
+		t.Fatal("expected attachments beyond keep to expire")
+	}
+	if !r.Expired(0, now.Add(-time.Minute), now) {
+		t.Fatal("expected attachments past the age limit to expire")
+	}
+	if (Retention{}).Expired(100, now.Add(-24*365*time.Hour), now) {
+		t.Fatal("expected a zero rule to keep everything")
+	}
+	if (Retention{}).ExpiresAt(now) != nil {
+		t.Fatal("expected no expiry without an age limit")
+	}
+}
+
+func TestRetentionValidate(t *testing.T) {
+	if err := (Retention{MaxAge: -1}).Validate(); !errors.Is(err, ErrInvalidRetention) {
+		t.Fatalf("expected ErrInvalidRetention, got %v", err)
+	}
+	if err := (Retention{Keep: 3}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPurgeExpiredAttachments(t *testing.T) {
+	app := migratedApp(t)
+	encryption := NewEncryptionService()
+	notes := NewNoteService(app, encryption)
+	files := NewFileService(app, encryption)
+
+	// store gives phrase a note with rule and an attachment per age, oldest
+	// first, each named after its age
+	store := func(phrase string, rule Retention, ages ...time.Duration) {
+		t.Helper()
+		if _, _, err := notes.GetOrCreateNote(phrase); err != nil {
+			t.Fatal(err)
+		}
+		if err := notes.SetAttachmentRetention(phrase, rule); err != nil {
+			t.Fatal(err)
+		}
+		for _, age := range ages {
+			err := app.RunInTransaction(func(txApp core.App) error {
+				_, err := files.ImportFiles(txApp, phrase, []DecryptedFile{{Name: age.String(), ContentType: "text/plain", Data: []byte(phrase + age.String())}})
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = app.DB().NewQuery("UPDATE encrypted_files SET created = {:created} WHERE id = (SELECT id FROM encrypted_files ORDER BY rowid DESC LIMIT 1)").
+				Bind(dbx.Params{"created": types.NowDateTime().Add(-age).String()}).
+				Execute()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		served, err := files.servedImageHash(files.hashPhrase(phrase))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := notes.UpdateNoteImageHash(phrase, served); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := func(phrase string) []string {
+		t.Helper()
+		list, err := files.ListAttachments(phrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, a := range list {
+			names = append(names, a.Name)
+		}
+		return names
+	}
+	purge := func(want int) {
+		t.Helper()
+		if n, err := files.PurgeExpiredAttachments(); err != nil || n != want {
+			t.Fatalf("expected %d attachments purged, got %d (%v)", want, n, err)
+		}
+	}
+
+	store("retention-keep", Retention{Keep: 2}, 3*time.Hour, 2*time.Hour, time.Hour)
+	store("retention-age", Retention{MaxAge: 3600}, 2*time.Hour, 10*time.Minute)
+	store("retention-trash", Retention{Keep: 1}, 2*time.Hour, time.Hour)
+	store("retention-none", Retention{}, 2*time.Hour, time.Hour)
+	if _, err := notes.DeleteNote("retention-trash"); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := notes.FindNote("retention-keep")
+
+	// the oldest beyond the newest two, and anything over an hour old
+	purge(2)
+	if got := names("retention-keep"); !slices.Equal(got, []string{"2h0m0s", "1h0m0s"}) {
+		t.Fatalf("expected the newest two kept, got %v", got)
+	}
+	if got := names("retention-age"); !slices.Equal(got, []string{"10m0s"}) {
+		t.Fatalf("expected attachments over an hour old purged, got %v", got)
+	}
+	if got := names("retention-trash"); len(got) != 2 {
+		t.Fatalf("expected a trashed note's attachments kept, got %v", got)
+	}
+	if got := names("retention-none"); len(got) != 2 {
+		t.Fatalf("expected a note without a rule left alone, got %v", got)
+	}
+
+	// the note served the purged attachment and now serves the next one
+	after, err := notes.FindNote("retention-keep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served, _ := files.servedImageHash(files.hashPhrase("retention-keep"))
+	if after.ImageHash == before.ImageHash || after.ImageHash != served {
+		t.Fatalf("expected the note to point at %s, got %s", served, after.ImageHash)
+	}
+
+	// a server-wide rule reaches notes without one of their own
+	files.SetRetention(Retention{Keep: 1})
+	purge(2)
+	if got := names("retention-none"); !slices.Equal(got, []string{"1h0m0s"}) {
+		t.Fatalf("expected the server rule to keep the newest, got %v", got)
+	}
+	if got := names("retention-keep"); !slices.Equal(got, []string{"1h0m0s"}) {
+		t.Fatalf("expected the stricter rule to apply, got %v", got)
+	}
+	if got := names("retention-trash"); len(got) != 2 {
+		t.Fatalf("expected a trashed note's attachments kept, got %v", got)
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/pkg/cryptobox"
+)
+
+// serverLayerFiles lists, per collection, the file fields holding ciphertext
+// sealed in a server layer along with the text fields of encryptedFields
+var serverLayerFiles = []struct {
+	collection string
+	fields     []string
+}{
+	{"encrypted_files", []string{"file_data", "thumbnail"}},
+	{"attachment_contents", []string{"data"}},
+}
+
+// ServerLayerFailure is a stored value RotateServerLayer couldn't rewrap
+type ServerLayerFailure struct {
+	Collection string `json:"collection"`
+	RecordID   string `json:"recordId"`
+	Field      string `json:"field"`
+	Error      string `json:"error"`
+}
+
+// ServerLayerRotation summarises a RotateServerLayer run
+type ServerLayerRotation struct {
+	Checked   map[string]int       `json:"checked"`   // records checked per collection
+	Rewrapped map[string]int       `json:"rewrapped"` // values moved to the current key, per collection
+	Failures  []ServerLayerFailure `json:"failures"`
+}
+
+// RotateServerLayer moves every stored field and attachment file to the
+// current server layer key (see Service.SetServerLayerKeys), sealing those
+// without a layer in it and taking the layer off everything when there is
+// no current key. No passphrase is needed. Values written before envelopes
+// had headers are left for their next re-encryption, since they can't be
+// told apart from legacy plaintext. Fields are updated in place, without
+// changing records' updated times, and only if they haven't changed since
+// they were read; when an attachment's ciphertext changes, the image_hash of
+// the notes pointing at it follows. It is a Reencrypt run in one go.
+func (s *IntegrityService) RotateServerLayer() (*ServerLayerRotation, error) {
+	run, err := s.Reencrypt(context.Background(), ReencryptOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &run.ServerLayerRotation, nil
+}
+
+// rotateRecord moves a record's stored fields and files to the current server
+// layer key, recording what it rewrapped or failed to in rotation
+func (s *IntegrityService) rotateRecord(rec *core.Record, fields, files []string, rotation *ServerLayerRotation) {
+	enc := s.Files.Encryption
+	collection := rec.Collection().Name
+	fail := func(field string, err error) {
+		rotation.Failures = append(rotation.Failures, ServerLayerFailure{
+			Collection: collection,
+			RecordID:   rec.Id,
+			Field:      field,
+			Error:      err.Error(),
+		})
+	}
+
+	for _, field := range fields {
+		stored := rec.GetString(field)
+		raw, err := base64.StdEncoding.DecodeString(stored)
+		if stored == "" || err != nil || !layerable(raw) {
+			continue
+		}
+		rewrapped, changed, err := enc.RewrapServerLayer(raw)
+		if err != nil {
+			fail(field, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		value := base64.StdEncoding.EncodeToString(rewrapped)
+		_, err = s.App.DB().Update(collection,
+			dbx.Params{field: value},
+			dbx.HashExp{"id": rec.Id, field: stored},
+		).Execute()
+		if err != nil {
+			fail(field, err)
+			continue
+		}
+		rec.Set(field, value)
+		rotation.Rewrapped[collection]++
+	}
+
+	for _, field := range files {
+		// shared content is rotated with its own record
+		if rec.GetString(field) == "" || field == "file_data" && rec.GetString("content") != "" {
+			continue
+		}
+		changed, err := s.rewrapStoredFile(rec, field)
+		if err != nil {
+			fail(field, err)
+			continue
+		}
+		if changed {
+			rotation.Rewrapped[collection]++
+		}
+	}
+}
+
+// rewrapStoredFile moves one of a record's stored files to the current server
+// layer key, updating its stored size and the hashes that name its ciphertext
+func (s *IntegrityService) rewrapStoredFile(rec *core.Record, field string) (bool, error) {
+	raw, err := s.Files.readStoredField(s.App, rec, field)
+	if err != nil {
+		return false, err
+	}
+	if !layerable(raw) {
+		return false, nil
+	}
+	rewrapped, changed, err := s.Files.Encryption.RewrapServerLayer(raw)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	oldHash, newHash := s.Files.hashBytes(raw), s.Files.hashBytes(rewrapped)
+	if err := s.Files.replaceStoredField(s.App, rec, field, rewrapped); err != nil {
+		return false, err
+	}
+	params := dbx.Params{"stored_size": len(rewrapped)}
+	if field == "thumbnail" {
+		params = dbx.Params{"thumbnail_size": len(rewrapped)}
+	}
+	if rec.Collection().Name == "attachment_contents" {
+		params["hash"] = newHash
+	}
+	return true, s.App.RunInTransaction(func(txApp core.App) error {
+		_, err := txApp.DB().Update(rec.Collection().Name, params, dbx.HashExp{"id": rec.Id}).Execute()
+		if err != nil {
+			return fmt.Errorf("failed to update the stored file: %w", err)
+		}
+		if field == "thumbnail" {
+			return nil
+		}
+		_, err = txApp.DB().Update("notes", dbx.Params{"image_hash": newHash}, dbx.HashExp{"image_hash": oldHash}).Execute()
+		if err != nil {
+			return fmt.Errorf("failed to update image hashes: %w", err)
+		}
+		return nil
+	})
+}
+
+// layerable reports whether raw is a ciphertext RotateServerLayer can move:
+// one in a server layer, or an envelope or chunked envelope with a header
+func layerable(raw []byte) bool {
+	return HasServerLayer(raw) || cryptobox.HasHeader(raw) || bytes.HasPrefix(raw, []byte("SNC"))
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty request body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Bucket makes the S3 calls PocketBase's own client doesn't: listing and
+// deleting the versions of an object, so that nothing of a shredded file is
+// left behind in a versioned bucket. Requests are signed with AWS Signature
+// Version 4, the same way PocketBase signs its own.
+type s3Bucket struct {
+	core.S3Config
+	client *http.Client
+}
+
+// s3Version is an object version or delete marker in a ListObjectVersions result
+type s3Version struct {
+	Key       string `xml:"Key"`
+	VersionID string `xml:"VersionId"`
+}
+
+// listVersionsResult is a page of a ListObjectVersions response
+type listVersionsResult struct {
+	IsTruncated         bool        `xml:"IsTruncated"`
+	NextKeyMarker       string      `xml:"NextKeyMarker"`
+	NextVersionIDMarker string      `xml:"NextVersionIdMarker"`
+	Versions            []s3Version `xml:"Version"`
+	DeleteMarkers       []s3Version `xml:"DeleteMarker"`
+}
+
+// deleteVersions permanently deletes every version and delete marker of the
+// object stored under key and returns how many were deleted. In a bucket
+// without versioning that is just the object itself.
+func (b *s3Bucket) deleteVersions(key string) (int, error) {
+	versions, err := b.objectVersions(key)
+	if err != nil {
+		return 0, err
+	}
+	for i, id := range versions {
+		resp, err := b.do(http.MethodDelete, key, url.Values{"versionId": {id}})
+		if err != nil {
+			return i, fmt.Errorf("failed to delete version %s: %w", id, err)
+		}
+		resp.Body.Close()
+	}
+	return len(versions), nil
+}
+
+// objectVersions returns the IDs of the versions and delete markers of the
+// object stored under key
+func (b *s3Bucket) objectVersions(key string) ([]string, error) {
+	var ids []string
+	query := url.Values{"versions": {""}, "prefix": {key}}
+	for {
+		resp, err := b.do(http.MethodGet, "", query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list object versions: %w", err)
+		}
+		var page listVersionsResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read object versions: %w", err)
+		}
+		// the prefix also matches longer keys
+		for _, v := range append(page.Versions, page.DeleteMarkers...) {
+			if v.Key == key {
+				ids = append(ids, v.VersionID)
+			}
+		}
+		if !page.IsTruncated {
+			return ids, nil
+		}
+		query.Set("key-marker", page.NextKeyMarker)
+		query.Set("version-id-marker", page.NextVersionIDMarker)
+	}
+}
+
+// do sends a signed, bodiless request for key (the bucket itself when key is
+// empty), turning error responses into errors
+func (b *s3Bucket) do(method, key string, query url.Values) (*http.Response, error) {
+	req, err := http.NewRequest(method, b.url(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = s3Query(query)
+	b.sign(req, time.Now().UTC())
+
+	client := b.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// url returns the address of key in the bucket, path-style or
+// virtual-hosted as PocketBase addresses it
+func (b *s3Bucket) url(key string) string {
+	scheme, endpoint := "https", strings.TrimRight(b.Endpoint, "/")
+	if after, ok := strings.CutPrefix(endpoint, "https://"); ok {
+		endpoint = after
+	} else if after, ok := strings.CutPrefix(endpoint, "http://"); ok {
+		scheme, endpoint = "http", after
+	}
+	if b.ForcePathStyle {
+		return fmt.Sprintf("%s://%s/%s/%s", scheme, endpoint, b.Bucket, key)
+	}
+	return fmt.Sprintf("%s://%s.%s/%s", scheme, b.Bucket, endpoint, key)
+}
+
+// sign adds a Signature Version 4 Authorization header to a bodiless request
+func (b *s3Bucket) sign(req *http.Request, now time.Time) {
+	date, dateTime := now.Format("20060102"), now.Format("20060102T150405Z")
+	req.Header.Set("x-amz-content-sha256", emptyPayloadHash)
+	req.Header.Set("x-amz-date", dateTime)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		s3Escape(req.URL.Path, true),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + emptyPayloadHash,
+		"x-amz-date:" + dateTime,
+		"",
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+
+	scope := date + "/" + b.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + dateTime + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+	key := []byte("AWS4" + b.Secret)
+	for _, part := range []string{date, b.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.AccessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Query encodes query parameters in the canonical form signatures cover:
+// sorted by name, with every reserved byte percent-encoded
+func s3Query(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var parts []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			parts = append(parts, s3Escape(name, false)+"="+s3Escape(value, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes every byte of s but the unreserved characters
+// (and "/" in paths), with uppercase hex digits, as AWS's UriEncode does
+func s3Escape(s string, path bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' || path && c == '/' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
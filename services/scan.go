@@ -0,0 +1,168 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// scanChunkSize is how much of a file goes into each INSTREAM chunk
+const scanChunkSize = 64 << 10
+
+var (
+	// ErrMalwareDetected is returned when the scanner flags an upload
+	ErrMalwareDetected = errors.New("upload was rejected by the malware scanner")
+
+	// ErrScanUnavailable is returned when the scanner can't be reached or
+	// gives no verdict, and the server is configured to fail closed
+	ErrScanUnavailable = errors.New("malware scanner is unavailable")
+)
+
+// Scanner inspects uploaded content before it is encrypted, reading it to
+// the end. Scan returns nil for clean content, an *InfectedError for flagged
+// content, and an error wrapping ErrScanUnavailable when no verdict could be
+// had.
+type Scanner interface {
+	Scan(ctx context.Context, content io.Reader) error
+}
+
+// InfectedError names what the scanner found in an upload
+type InfectedError struct {
+	Signature string // e.g. "Eicar-Signature"
+}
+
+func (e *InfectedError) Error() string {
+	return ErrMalwareDetected.Error() + ": " + e.Signature
+}
+
+// Unwrap lets errors.Is match ErrMalwareDetected
+func (e *InfectedError) Unwrap() error {
+	return ErrMalwareDetected
+}
+
+// ClamdScanner scans content with a ClamAV daemon over its INSTREAM command
+type ClamdScanner struct {
+	Network string        // "tcp" or "unix"
+	Address string        // host:port, or a socket path
+	Timeout time.Duration // for the whole exchange, connecting included
+}
+
+// NewClamdScanner parses an address of the form tcp://host:port or
+// unix:///path/to/clamd.sock. A bare host:port is taken as TCP.
+func NewClamdScanner(address string, timeout time.Duration) (*ClamdScanner, error) {
+	network, addr := "tcp", address
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		network, addr = "unix", strings.TrimPrefix(address, "unix://")
+	case strings.HasPrefix(address, "tcp://"):
+		addr = strings.TrimPrefix(address, "tcp://")
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("clamd address %q is empty", address)
+	}
+	if network == "tcp" {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, fmt.Errorf("clamd address %q: %w", address, err)
+		}
+	}
+	return &ClamdScanner{Network: network, Address: addr, Timeout: timeout}, nil
+}
+
+// Scan streams content to clamd and reads back its verdict
+func (c *ClamdScanner) Scan(ctx context.Context, content io.Reader) error {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrScanUnavailable, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// zINSTREAM: length-prefixed chunks, ended by a zero-length chunk
+	w := bufio.NewWriter(conn)
+	w.WriteString("zINSTREAM\x00")
+	var size [4]byte
+	chunk := make([]byte, scanChunkSize)
+	for {
+		n, err := io.ReadFull(content, chunk)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			w.Write(size[:])
+			w.Write(chunk[:n])
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read the upload: %w", err)
+		}
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	w.Write(size[:])
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("%w: %v", ErrScanUnavailable, err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return fmt.Errorf("%w: %v", ErrScanUnavailable, err)
+	}
+	return parseClamdReply(reply)
+}
+
+// parseClamdReply reads a reply like "stream: OK" or
+// "stream: Eicar-Signature FOUND"
+func parseClamdReply(reply string) error {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	_, verdict, ok := strings.Cut(reply, ": ")
+	if !ok {
+		return fmt.Errorf("%w: unexpected reply %q", ErrScanUnavailable, reply)
+	}
+	switch {
+	case verdict == "OK":
+		return nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return &InfectedError{Signature: strings.TrimSuffix(verdict, " FOUND")}
+	default:
+		// e.g. "INSTREAM size limit exceeded. ERROR"
+		return fmt.Errorf("%w: %s", ErrScanUnavailable, verdict)
+	}
+}
+
+// ScanUpload runs scanner over content unless it is nil. With failOpen, an
+// unavailable scanner lets the upload through instead of refusing it.
+func ScanUpload(ctx context.Context, scanner Scanner, content io.Reader, failOpen bool) error {
+	if scanner == nil {
+		return nil
+	}
+	err := scanner.Scan(ctx, content)
+	if failOpen && errors.Is(err, ErrScanUnavailable) {
+		log.Printf("Warning: accepting unscanned upload: %v", err)
+		return nil
+	}
+	return err
+}
+
+// MalwareSignature returns the signature of an *InfectedError, or ""
+func MalwareSignature(err error) string {
+	var infected *InfectedError
+	if errors.As(err, &infected) {
+		return infected.Signature
+	}
+	return ""
+}
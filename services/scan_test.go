@@ -0,0 +1,141 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eicar is the standard antivirus test string
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!H+H*`
+
+// fakeClamd answers INSTREAM like clamd, flagging streams that contain the
+// EICAR string, and returns its address
+func fakeClamd(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+					conn.Write([]byte("UNKNOWN COMMAND\x00"))
+					return
+				}
+				var stream bytes.Buffer
+				for {
+					var size uint32
+					if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					if _, err := io.CopyN(&stream, r, int64(size)); err != nil {
+						return
+					}
+				}
+				if bytes.Contains(stream.Bytes(), []byte(eicar)) {
+					conn.Write([]byte("stream: Eicar-Signature FOUND\x00"))
+				} else {
+					conn.Write([]byte("stream: OK\x00"))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestClamdScanner(t *testing.T) {
+	scanner, err := NewClamdScanner("tcp://"+fakeClamd(t), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// larger than one INSTREAM chunk, so the stream is split
+	clean := bytes.Repeat([]byte("harmless "), scanChunkSize/4)
+	if err := scanner.Scan(ctx, bytes.NewReader(clean)); err != nil {
+		t.Fatalf("expected clean content to pass, got %v", err)
+	}
+
+	infected := append(clean, eicar...)
+	err = scanner.Scan(ctx, bytes.NewReader(infected))
+	if !errors.Is(err, ErrMalwareDetected) || MalwareSignature(err) != "Eicar-Signature" {
+		t.Fatalf("expected the EICAR signature, got %v", err)
+	}
+}
+
+func TestScanUploadUnavailable(t *testing.T) {
+	// a port nothing listens on
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	scanner, err := NewClamdScanner(addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := ScanUpload(ctx, scanner, strings.NewReader("data"), false); !errors.Is(err, ErrScanUnavailable) {
+		t.Fatalf("expected ErrScanUnavailable when failing closed, got %v", err)
+	}
+	if err := ScanUpload(ctx, scanner, strings.NewReader("data"), true); err != nil {
+		t.Fatalf("expected the upload through when failing open, got %v", err)
+	}
+	if err := ScanUpload(ctx, nil, strings.NewReader(eicar), false); err != nil {
+		t.Fatalf("expected no scan without a scanner, got %v", err)
+	}
+}
+
+func TestNewClamdScanner(t *testing.T) {
+	for _, tc := range []struct {
+		address, network, addr string
+	}{
+		{"tcp://clamav:3310", "tcp", "clamav:3310"},
+		{"localhost:3310", "tcp", "localhost:3310"},
+		{"unix:///run/clamav/clamd.ctl", "unix", "/run/clamav/clamd.ctl"},
+	} {
+		scanner, err := NewClamdScanner(tc.address, time.Second)
+		if err != nil || scanner.Network != tc.network || scanner.Address != tc.addr {
+			t.Errorf("%s: got %+v (%v)", tc.address, scanner, err)
+		}
+	}
+	for _, address := range []string{"clamav", "unix://", "tcp://"} {
+		if _, err := NewClamdScanner(address, time.Second); err == nil {
+			t.Errorf("%s: expected an error", address)
+		}
+	}
+}
+
+func TestParseClamdReply(t *testing.T) {
+	if err := parseClamdReply("stream: OK\x00"); err != nil {
+		t.Fatalf("expected OK, got %v", err)
+	}
+	if err := parseClamdReply("stream: INSTREAM size limit exceeded. ERROR\x00"); !errors.Is(err, ErrScanUnavailable) {
+		t.Fatalf("expected an error verdict to count as unavailable, got %v", err)
+	}
+	if err := parseClamdReply("garbage"); !errors.Is(err, ErrScanUnavailable) {
+		t.Fatalf("expected an unreadable reply to count as unavailable, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Limits for SearchMessage
+const (
+	MaxSearchQueryLength = 200 // characters
+	MaxSearchMatches     = 100
+	searchSnippetRunes   = 160
+)
+
+// SearchMatch is one line of a note containing the query
+type SearchMatch struct {
+	Line    int    `json:"line"`    // 1-based
+	Column  int    `json:"column"`  // 1-based, in characters
+	Snippet string `json:"snippet"` // the line, shortened around the match when long
+}
+
+// SearchResult lists where a query occurs in a message
+type SearchResult struct {
+	Matches    []SearchMatch `json:"matches"`
+	Truncated  bool          `json:"truncated"` // more than limit lines matched
+	TotalLines int           `json:"totalLines"`
+}
+
+// SearchMessage finds the lines of message containing query, ignoring case,
+// and returns at most limit of them (first match per line).
+func SearchMessage(message, query string, limit int) SearchResult {
+	result := SearchResult{Matches: []SearchMatch{}}
+	needle := foldRunes(query)
+	if len(needle) == 0 {
+		return result
+	}
+
+	lines := strings.Split(message, "\n")
+	result.TotalLines = len(lines)
+	for i, line := range lines {
+		runes := []rune(strings.TrimSuffix(line, "\r"))
+		col := indexRunes(foldRunes(string(runes)), needle)
+		if col < 0 {
+			continue
+		}
+		if len(result.Matches) == limit {
+			result.Truncated = true
+			break
+		}
+		result.Matches = append(result.Matches, SearchMatch{
+			Line:    i + 1,
+			Column:  col + 1,
+			Snippet: snippet(runes, col, len(needle)),
+		})
+	}
+	return result
+}
+
+// foldRunes lowercases s rune by rune, so indexes match the original runes
+func foldRunes(s string) []rune {
+	runes := []rune(s)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
+
+func indexRunes(haystack, needle []rune) int {
+	for i := 0; i+len(needle) <= len(haystack); i++ {
+		if string(haystack[i:i+len(needle)]) == string(needle) {
+			return i
+		}
+	}
+	return -1
+}
+
+// snippet cuts a long line down to searchSnippetRunes around the match at col,
+// marking cut ends with "…"
+func snippet(line []rune, col, length int) string {
+	if len(line) <= searchSnippetRunes {
+		return string(line)
+	}
+	start := max(0, col-(searchSnippetRunes-length)/2)
+	end := min(len(line), start+searchSnippetRunes)
+	start = max(0, end-searchSnippetRunes)
+
+	out := string(line[start:end])
+	if start > 0 {
+		out = "…" + out
+	}
+	if end < len(line) {
+		out += "…"
+	}
+	return out
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSearchMessage(t *testing.T) {
+	message := "Shopping\r\nbuy MILK\nnothing here\nÉclair and milkshake"
+	result := SearchMessage(message, "milk", 10)
+	if result.TotalLines != 4 || len(result.Matches) != 2 || result.Truncated {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if m := result.Matches[0]; m.Line != 2 || m.Column != 5 || m.Snippet != "buy MILK" {
+		t.Errorf("first match = %+v", m)
+	}
+	// columns count characters, not bytes
+	if m := result.Matches[1]; m.Line != 4 || m.Column != 12 {
+		t.Errorf("second match = %+v", m)
+	}
+
+	if result := SearchMessage(message, "milk", 1); len(result.Matches) != 1 || !result.Truncated {
+		t.Errorf("limit not applied: %+v", result)
+	}
+	if result := SearchMessage(message, "éCLAIR", 10); len(result.Matches) != 1 {
+		t.Errorf("case folding: %+v", result)
+	}
+}
+
+func TestSearchSnippet(t *testing.T) {
+	line := strings.Repeat("a", 500) + "needle" + strings.Repeat("b", 500)
+	m := SearchMessage(line, "needle", 1).Matches[0]
+	if !strings.HasPrefix(m.Snippet, "…") || !strings.HasSuffix(m.Snippet, "…") || !strings.Contains(m.Snippet, "needle") {
+		t.Errorf("snippet = %q", m.Snippet)
+	}
+	if n := len([]rune(m.Snippet)); n != searchSnippetRunes+2 {
+		t.Errorf("snippet has %d characters", n)
+	}
+}
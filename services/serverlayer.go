@@ -0,0 +1,332 @@
+package services
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The server layer is optional double encryption. With server layer keys set
+// (see SetServerLayerKeys), stored fields and attachment files, once sealed
+// under the passphrase as usual, are sealed again with AES-256-GCM under a
+// key only the server holds:
+//
+//	"SNS1" | key id | base nonce (12 bytes) | segments
+//
+// Each segment seals up to ServerLayerSegmentSize bytes of the inner
+// ciphertext, with the nonce and additional data of chunked envelopes (see
+// chunkNonce) followed by the header, so segments can't be reordered,
+// dropped or moved to another ciphertext, and a range of a large attachment
+// is read by opening only the segments it spans. A copy of the database then
+// can't be attacked without the server key, and a leaked server key doesn't
+// open anything without the passphrase. Unlike a pepper, the layer comes off
+// without the passphrase, so its key can be rotated by rewrapping everything
+// stored (see RewrapServerLayer).
+var serverLayerMagic = []byte("SNS1")
+
+const (
+	// ServerLayerKeySize is the length of server layer keys
+	ServerLayerKeySize = 32
+
+	// ServerLayerSegmentSize is the inner ciphertext sealed in each segment
+	ServerLayerSegmentSize = 64 << 10
+
+	serverLayerHeaderSize = 4 + 1 + nonceSize
+	serverLayerSealedSize = ServerLayerSegmentSize + tagSize
+)
+
+// ErrUnknownServerLayerKey is matched when a ciphertext's server layer was
+// sealed with a key the server isn't configured with
+var ErrUnknownServerLayerKey = fmt.Errorf("%w: unknown server layer key", ErrDecryptionFailed)
+
+// SetServerLayerKeys turns on the server layer: stored fields and attachments
+// written from here on are sealed again with the key with id current, and
+// those sealed with any of keys open. Keys are ServerLayerKeySize bytes with
+// non-zero ids. A zero current writes no layer, while layered data stays
+// readable as long as its key is listed. It must be called before the service
+// is used.
+func (s *Service) SetServerLayerKeys(keys map[byte][]byte, current byte) error {
+	aeads := make(map[byte]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		if id == 0 {
+			return errors.New("server layer key id 0 is reserved")
+		}
+		if len(key) != ServerLayerKeySize {
+			return fmt.Errorf("server layer key %d is %d bytes, want %d", id, len(key), ServerLayerKeySize)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return err
+		}
+		if aeads[id], err = cipher.NewGCM(block); err != nil {
+			return err
+		}
+	}
+	if _, ok := keys[current]; current != 0 && !ok {
+		return fmt.Errorf("server layer key %d is not configured", current)
+	}
+	s.layerKeys, s.layerKeyID = aeads, current
+	return nil
+}
+
+// serverLayerFor returns the id of the server layer key new encryptions bound
+// by b are sealed with: stored fields get the current one, anything else
+// (such as export archives, which must open on other servers) none
+func (s *Service) serverLayerFor(b Binding) byte {
+	if b.Purpose == "" {
+		return 0
+	}
+	return s.layerKeyID
+}
+
+// HasServerLayer reports whether data is sealed in a server layer
+func HasServerLayer(data []byte) bool {
+	return len(data) >= serverLayerHeaderSize && bytes.HasPrefix(data, serverLayerMagic)
+}
+
+// serverLayerKey returns the AEAD of the key a server layer header names
+func (s *Service) serverLayerKey(header []byte) (cipher.AEAD, error) {
+	aead, ok := s.layerKeys[header[len(serverLayerMagic)]]
+	if !ok {
+		return nil, fmt.Errorf("%w (id %d)", ErrUnknownServerLayerKey, header[len(serverLayerMagic)])
+	}
+	return aead, nil
+}
+
+// sealServerLayer seals data in a server layer with the key with id id
+func (s *Service) sealServerLayer(data []byte, id byte) ([]byte, error) {
+	segments := max((len(data)+ServerLayerSegmentSize-1)/ServerLayerSegmentSize, 1)
+	out := bytes.NewBuffer(make([]byte, 0, serverLayerHeaderSize+len(data)+segments*tagSize))
+	w, err := s.newServerLayerWriter(out, id)
+	if err != nil {
+		return nil, err
+	}
+	w.Write(data) // a bytes.Buffer doesn't fail
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// openServerLayer returns the ciphertext sealed in data's server layer, or
+// data itself when it has none
+func (s *Service) openServerLayer(data []byte) ([]byte, error) {
+	if !HasServerLayer(data) {
+		return data, nil
+	}
+	r, err := s.newServerLayerReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	inner := make([]byte, r.Size())
+	if _, err := io.ReadFull(r, inner); err != nil {
+		return nil, err
+	}
+	return inner, nil
+}
+
+// RewrapServerLayer moves a stored ciphertext to the current server layer
+// key, or out of the layer when there is none, without the passphrase. It
+// reports whether anything changed; ciphertexts already under the current
+// key are returned as they are.
+func (s *Service) RewrapServerLayer(data []byte) ([]byte, bool, error) {
+	current := s.layerKeyID
+	if HasServerLayer(data) && data[len(serverLayerMagic)] == current {
+		return data, false, nil
+	}
+	if !HasServerLayer(data) && current == 0 {
+		return data, false, nil
+	}
+	inner, err := s.openServerLayer(data)
+	if err != nil {
+		return nil, false, err
+	}
+	if current == 0 {
+		return inner, true, nil
+	}
+	sealed, err := s.sealServerLayer(inner, current)
+	if err != nil {
+		return nil, false, err
+	}
+	return sealed, true, nil
+}
+
+// serverLayerOutdated reports whether data's server layer, or lack of one,
+// differs from what the service writes for b
+func (s *Service) serverLayerOutdated(data []byte, b Binding) bool {
+	id := byte(0)
+	if HasServerLayer(data) {
+		id = data[len(serverLayerMagic)]
+	}
+	return id != s.serverLayerFor(b)
+}
+
+// serverLayerWriter seals what is written to it in a server layer. A segment
+// is only sealed once more data follows it, since the last one is sealed
+// differently; Close seals the last.
+type serverLayerWriter struct {
+	dst    io.Writer
+	aead   cipher.AEAD
+	header []byte
+	buf    []byte
+	sealed []byte
+	next   int64
+}
+
+// newServerLayerWriter writes a server layer header for the key with id id to
+// dst and returns a writer of the segments
+func (s *Service) newServerLayerWriter(dst io.Writer, id byte) (*serverLayerWriter, error) {
+	header := make([]byte, serverLayerHeaderSize)
+	copy(header, serverLayerMagic)
+	header[len(serverLayerMagic)] = id
+	if _, err := io.ReadFull(rand.Reader, header[len(serverLayerMagic)+1:]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	aead, err := s.serverLayerKey(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dst.Write(header); err != nil {
+		return nil, err
+	}
+	return &serverLayerWriter{dst: dst, aead: aead, header: header, buf: make([]byte, 0, ServerLayerSegmentSize)}, nil
+}
+
+// Write implements io.Writer
+func (w *serverLayerWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if len(w.buf) == ServerLayerSegmentSize {
+			if err := w.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):ServerLayerSegmentSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p, written = p[n:], written+n
+	}
+	return written, nil
+}
+
+// Close seals the last segment. It doesn't close the destination.
+func (w *serverLayerWriter) Close() error {
+	return w.seal(true)
+}
+
+// seal writes the buffered segment
+func (w *serverLayerWriter) seal(last bool) error {
+	nonce, aad := chunkNonce(w.header[len(serverLayerMagic)+1:], w.next, last, w.header)
+	w.sealed = w.aead.Seal(w.sealed[:0], nonce, w.buf, aad)
+	w.buf, w.next = w.buf[:0], w.next+1
+	_, err := w.dst.Write(w.sealed)
+	return err
+}
+
+// serverLayerReader opens a server layer on demand. It implements
+// io.ReadSeeker over the inner ciphertext, opening only the segments read.
+type serverLayerReader struct {
+	src      io.ReadSeeker
+	aead     cipher.AEAD
+	header   []byte
+	segments int64
+	size     int64 // of the inner ciphertext
+
+	offset int64
+	cached int64 // index of the segment in plain, or -1
+	plain  []byte
+	sealed []byte
+}
+
+// newServerLayerReader returns a reader of the inner ciphertext of the server
+// layer in src, which is size bytes long
+func (s *Service) newServerLayerReader(src io.ReadSeeker, size int64) (*serverLayerReader, error) {
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	header := make([]byte, serverLayerHeaderSize)
+	if _, err := io.ReadFull(src, header); err != nil || !bytes.HasPrefix(header, serverLayerMagic) {
+		return nil, malformed("server layer header is truncated")
+	}
+	aead, err := s.serverLayerKey(header)
+	if err != nil {
+		return nil, err
+	}
+	body := size - serverLayerHeaderSize
+	segments := (body + serverLayerSealedSize - 1) / serverLayerSealedSize
+	if body < tagSize || (body%serverLayerSealedSize != 0 && body%serverLayerSealedSize < tagSize) {
+		return nil, malformed("server layer is truncated")
+	}
+	return &serverLayerReader{
+		src:      src,
+		aead:     aead,
+		header:   header,
+		segments: segments,
+		size:     body - segments*tagSize,
+		cached:   -1,
+	}, nil
+}
+
+// Size returns the size of the inner ciphertext
+func (r *serverLayerReader) Size() int64 {
+	return r.size
+}
+
+// Read implements io.Reader
+func (r *serverLayerReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	i := r.offset / ServerLayerSegmentSize
+	if err := r.load(i); err != nil {
+		return 0, err
+	}
+	n := copy(p, r.plain[r.offset-i*ServerLayerSegmentSize:])
+	r.offset += int64(n)
+	return n, nil
+}
+
+// Seek implements io.Seeker
+func (r *serverLayerReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// load opens segment i into plain
+func (r *serverLayerReader) load(i int64) error {
+	if r.cached == i {
+		return nil
+	}
+	start := serverLayerHeaderSize + i*serverLayerSealedSize
+	n := min(serverLayerSealedSize, serverLayerHeaderSize+r.size+r.segments*tagSize-start)
+	if int64(cap(r.sealed)) < n {
+		r.sealed = make([]byte, n)
+	}
+	r.sealed = r.sealed[:n]
+	if _, err := r.src.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(r.src, r.sealed); err != nil {
+		return fmt.Errorf("%w: server layer is truncated", ErrCorruptCiphertext)
+	}
+	nonce, aad := chunkNonce(r.header[len(serverLayerMagic)+1:], i, i == r.segments-1, r.header)
+	plain, err := r.aead.Open(r.plain[:0], nonce, r.sealed, aad)
+	if err != nil {
+		r.cached = -1
+		return fmt.Errorf("%w: server layer doesn't authenticate", ErrCorruptCiphertext)
+	}
+	r.plain, r.cached = plain, i
+	return nil
+}
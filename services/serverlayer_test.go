@@ -0,0 +1,160 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestServerLayer(t *testing.T) {
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	b := FieldBinding("notes", "abc123", "message")
+	key1, key2 := bytes.Repeat([]byte{1}, ServerLayerKeySize), bytes.Repeat([]byte{2}, ServerLayerKeySize)
+
+	svc := NewEncryptionService()
+	if err := svc.SetServerLayerKeys(map[byte][]byte{1: key1[:16]}, 1); err == nil {
+		t.Fatal("expected a short key to be rejected")
+	}
+	if err := svc.SetServerLayerKeys(map[byte][]byte{0: key1}, 0); err == nil {
+		t.Fatal("expected key id 0 to be rejected")
+	}
+	if err := svc.SetServerLayerKeys(map[byte][]byte{1: key1}, 2); err == nil {
+		t.Fatal("expected an unknown current key to be rejected")
+	}
+	if err := svc.SetServerLayerKeys(map[byte][]byte{1: key1}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := svc.EncryptBound([]byte("hello"), phrase, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !HasServerLayer(sealed) || sealed[len(serverLayerMagic)] != 1 {
+		t.Fatalf("expected a layer with key 1, got %x", sealed[:8])
+	}
+	if got, err := svc.DecryptBound(sealed, phrase, b); err != nil || string(got) != "hello" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if n := svc.PlaintextSize(sealed); n != 5 {
+		t.Fatalf("expected a plaintext size of 5, got %d", n)
+	}
+	if svc.Outdated(sealed, b) {
+		t.Fatal("expected a field under the current key to be up to date")
+	}
+	if unbound, _ := svc.EncryptData([]byte("hello"), phrase); HasServerLayer(unbound) {
+		t.Fatal("expected unbound encryptions to have no layer")
+	}
+
+	// the passphrase alone doesn't open a layered field
+	plain := NewEncryptionService()
+	if _, err := plain.DecryptBound(sealed, phrase, b); !errors.Is(err, ErrUnknownServerLayerKey) || !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("expected ErrUnknownServerLayerKey, got %v", err)
+	}
+	if !plain.Outdated(sealed, b) {
+		t.Fatal("expected a layered field to be outdated without a current key")
+	}
+	wrong := NewEncryptionService()
+	wrong.SetServerLayerKeys(map[byte][]byte{1: key2}, 1)
+	if _, err := wrong.DecryptBound(sealed, phrase, b); !errors.Is(err, ErrCorruptCiphertext) {
+		t.Fatalf("expected the wrong key to fail, got %v", err)
+	}
+	tampered := bytes.Clone(sealed)
+	tampered[serverLayerHeaderSize] ^= 1
+	if _, err := svc.DecryptBound(tampered, phrase, b); !errors.Is(err, ErrCorruptCiphertext) {
+		t.Fatalf("expected a tampered layer to fail, got %v", err)
+	}
+	if _, err := svc.DecryptBound(sealed[:len(sealed)-1], phrase, b); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("expected a truncated layer to fail, got %v", err)
+	}
+
+	// rotation rewraps without the passphrase
+	rotated := NewEncryptionService()
+	if err := rotated.SetServerLayerKeys(map[byte][]byte{1: key1, 2: key2}, 2); err != nil {
+		t.Fatal(err)
+	}
+	if !rotated.Outdated(sealed, b) {
+		t.Fatal("expected a field under a retired key to be outdated")
+	}
+	rewrapped, changed, err := rotated.RewrapServerLayer(sealed)
+	if err != nil || !changed || rewrapped[len(serverLayerMagic)] != 2 {
+		t.Fatalf("expected a rewrap to key 2, got %v, %v", changed, err)
+	}
+	if again, changed, err := rotated.RewrapServerLayer(rewrapped); err != nil || changed || !bytes.Equal(again, rewrapped) {
+		t.Fatalf("expected a current layer to be left alone, got %v, %v", changed, err)
+	}
+	only2 := NewEncryptionService()
+	only2.SetServerLayerKeys(map[byte][]byte{2: key2}, 2)
+	if got, err := only2.DecryptBound(rewrapped, phrase, b); err != nil || string(got) != "hello" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+
+	// and takes the layer off when there's no current key
+	off := NewEncryptionService()
+	off.SetServerLayerKeys(map[byte][]byte{2: key2}, 0)
+	stripped, changed, err := off.RewrapServerLayer(rewrapped)
+	if err != nil || !changed || HasServerLayer(stripped) {
+		t.Fatalf("expected the layer to come off, got %v, %v", changed, err)
+	}
+	if got, err := plain.DecryptBound(stripped, phrase, b); err != nil || string(got) != "hello" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if _, changed, _ := off.RewrapServerLayer(stripped); changed {
+		t.Fatal("expected no change to a field without a layer")
+	}
+}
+
+func TestServerLayerChunked(t *testing.T) {
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	b := FieldBinding("attachment_contents", "abc123", "data")
+	svc := NewEncryptionService()
+	if err := svc.SetServerLayerKeys(map[byte][]byte{7: bytes.Repeat([]byte{7}, ServerLayerKeySize)}, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 3*ServerLayerSegmentSize+1234)
+	rand.Read(data)
+	sealed, err := svc.EncryptChunked(data, phrase, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !HasServerLayer(sealed) {
+		t.Fatal("expected a chunked envelope in a server layer")
+	}
+	if got, err := svc.DecryptChunked(sealed, phrase, b); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("round trip failed: %v", err)
+	}
+
+	r, err := svc.OpenChunked(bytes.NewReader(sealed), int64(len(sealed)), phrase, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != int64(len(data)) {
+		t.Fatalf("expected size %d, got %d", len(data), r.Size())
+	}
+	for _, offset := range []int64{0, ServerLayerSegmentSize - 3, 2*ServerLayerSegmentSize + 17, int64(len(data)) - 10} {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, 10)
+		if _, err := io.ReadFull(r, got); err != nil || !bytes.Equal(got, data[offset:offset+10]) {
+			t.Fatalf("range at %d doesn't match: %v", offset, err)
+		}
+	}
+
+	// segments can't be moved around
+	swapped := bytes.Clone(sealed)
+	first := swapped[serverLayerHeaderSize : serverLayerHeaderSize+serverLayerSealedSize]
+	second := swapped[serverLayerHeaderSize+serverLayerSealedSize : serverLayerHeaderSize+2*serverLayerSealedSize]
+	tmp := bytes.Clone(first)
+	copy(first, second)
+	copy(second, tmp)
+	if _, err := svc.DecryptChunked(swapped, phrase, b); !errors.Is(err, ErrCorruptCiphertext) {
+		t.Fatalf("expected swapped segments to fail, got %v", err)
+	}
+	truncated := sealed[:serverLayerHeaderSize+2*serverLayerSealedSize]
+	if _, err := svc.DecryptChunked(truncated, phrase, b); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("expected a layer cut at a segment boundary to fail, got %v", err)
+	}
+}
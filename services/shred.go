@@ -0,0 +1,99 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// shredFields lists, per collection, the file fields whose stored files are
+// shredded when records are deleted or the files replaced
+var shredFields = map[string][]string{
+	"encrypted_files":     {"file_data", "thumbnail"},
+	"attachment_contents": {"data"},
+}
+
+// ShredRecordFiles shreds the attachment files a deleted record pointed at.
+// It has to run before PocketBase removes them, which it does right after
+// the delete.
+func (f *FileService) ShredRecordFiles(app core.App, rec *core.Record) error {
+	var errs []error
+	for _, field := range shredFields[rec.Collection().Name] {
+		if name := rec.GetString(field); name != "" {
+			if err := f.ShredFile(app, rec.BaseFilesPath()+"/"+name); err != nil {
+				errs = append(errs, fmt.Errorf("%s %s: %w", rec.Id, field, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ShredReplacedFiles shreds the attachment files an update replaced or
+// cleared, such as a thumbnail replaced on rekey or data moved to shared
+// content. Like ShredRecordFiles it has to run before PocketBase removes them.
+func (f *FileService) ShredReplacedFiles(app core.App, rec *core.Record) error {
+	var errs []error
+	for _, field := range shredFields[rec.Collection().Name] {
+		old := rec.Original().GetString(field)
+		if old == "" || old == rec.GetString(field) {
+			continue
+		}
+		if err := f.ShredFile(app, rec.BaseFilesPath()+"/"+old); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", rec.Id, field, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ShredFile makes the file stored under key unrecoverable from storage. On
+// local disk its bytes are overwritten in place with random data, so the
+// ciphertext isn't left in freed blocks once PocketBase unlinks it (on
+// copy-on-write filesystems and SSDs the old blocks may still survive). In an
+// S3 bucket every version of the object is deleted, so a versioned bucket
+// keeps no noncurrent copies. Files already gone are no error.
+func (f *FileService) ShredFile(app core.App, key string) error {
+	if s3 := app.Settings().S3; s3.Enabled {
+		_, err := (&s3Bucket{S3Config: s3}).deleteVersions(key)
+		return err
+	}
+	return overwriteFile(filepath.Join(app.DataDir(), core.LocalStorageDirName, filepath.FromSlash(key)))
+}
+
+// overwriteFile overwrites the file at path with random bytes, keeping its
+// size, and flushes it to disk
+func overwriteFile(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 64<<10)
+	for left := info.Size(); left > 0; {
+		n := int64(len(buf))
+		if left < n {
+			n = left
+		}
+		rand.Read(buf[:n])
+		if _, err := file.Write(buf[:n]); err != nil {
+			return fmt.Errorf("failed to overwrite: %w", err)
+		}
+		left -= n
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to flush: %w", err)
+	}
+	return file.Close()
+}
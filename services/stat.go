@@ -0,0 +1,62 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+)
+
+// NoteStat describes a stored note without decrypting it
+type NoteStat struct {
+	Size    int64 // decrypted message size in bytes
+	Updated time.Time
+}
+
+// FileStat describes the attachment GET /notes/image serves, without decrypting it
+type FileStat struct {
+	Size        int64 // decrypted size in bytes
+	ContentType string
+	ETag        string
+	Modified    time.Time
+}
+
+// StatNote describes the phrase's note. Unlike GetOrCreateNote it never
+// creates one: a missing note, or one past its scheduled deletion, is
+// ErrNoteNotFound.
+func (n *NoteService) StatNote(phrase string) (*NoteStat, error) {
+	records, err := n.App.FindRecordsByFilter("notes", "phrase_hash = {:phrase_hash}", "", 1, 0, dbx.Params{"phrase_hash": n.hashPhrase(phrase)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notes: %w", err)
+	}
+	if len(records) == 0 || destroyDue(records[0]) {
+		return nil, ErrNoteNotFound
+	}
+
+	record := records[0]
+	stat := &NoteStat{Updated: Timestamp(record.GetDateTime("updated"))}
+	if sealed, err := base64.StdEncoding.DecodeString(record.GetString("message")); err == nil && len(sealed) > 0 {
+		stat.Size = int64(n.Encryption.PlaintextSize(sealed))
+	}
+	return stat, nil
+}
+
+// StatFile describes the phrase's attachment, or returns ErrFileNotFound
+func (f *FileService) StatFile(phrase string) (*FileStat, error) {
+	record, err := f.findFile(phrase)
+	if err != nil {
+		return nil, err
+	}
+	contentType, err := f.decryptContentType(f.App, record, phrase)
+	if err != nil {
+		return nil, err
+	}
+	etag, modified := fileVersion(record)
+	return &FileStat{
+		Size:        int64(record.GetInt("size")),
+		ContentType: contentType,
+		ETag:        etag,
+		Modified:    modified,
+	}, nil
+}
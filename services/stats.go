@@ -0,0 +1,122 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+)
+
+// statsEpsilon is the differential privacy budget spent on each count per
+// snapshot; the Laplace noise added has scale 1/statsEpsilon
+const statsEpsilon = 0.1
+
+// PublicStats is a coarse, noisy snapshot of the instance that is safe to
+// publish: counts are reported only as orders of magnitude after noise is
+// added, and uptime is rounded.
+type PublicStats struct {
+	Notes       string    `json:"notes"`       // e.g. "1k+"
+	Attachments string    `json:"attachments"` // e.g. "100+"
+	Uptime      string    `json:"uptime"`      // e.g. "3 days"
+	GeneratedAt time.Time `json:"generatedAt"`
+}
+
+// StatsService produces PublicStats. A snapshot is kept for the refresh
+// interval so polling can't average the noise away.
+type StatsService struct {
+	App     *pocketbase.PocketBase
+	refresh time.Duration
+	started time.Time
+
+	mu       sync.Mutex
+	snapshot *PublicStats
+	expires  time.Time
+
+	now   func() time.Time
+	noise func() float64
+}
+
+// NewStatsService creates a stats service; uptime is measured from now
+func NewStatsService(app *pocketbase.PocketBase, refresh time.Duration) *StatsService {
+	return &StatsService{
+		App:     app,
+		refresh: refresh,
+		started: time.Now(),
+		now:     time.Now,
+		noise:   func() float64 { return laplace(1 / statsEpsilon) },
+	}
+}
+
+// PublicStats returns the current snapshot, drawing a new one when it has expired
+func (s *StatsService) PublicStats() (*PublicStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if s.snapshot != nil && now.Before(s.expires) {
+		return s.snapshot, nil
+	}
+
+	notes, err := s.App.CountRecords("notes")
+	if err != nil {
+		return nil, fmt.Errorf("error counting notes: %w", err)
+	}
+	files, err := s.App.CountRecords("encrypted_files")
+	if err != nil {
+		return nil, fmt.Errorf("error counting attachments: %w", err)
+	}
+
+	s.snapshot = &PublicStats{
+		Notes:       magnitude(float64(notes) + s.noise()),
+		Attachments: magnitude(float64(files) + s.noise()),
+		Uptime:      coarseDuration(now.Sub(s.started)),
+		GeneratedAt: now.UTC().Truncate(time.Millisecond),
+	}
+	s.expires = now.Add(s.refresh)
+	return s.snapshot, nil
+}
+
+// magnitude reports n as its order of magnitude: "under 10", "10+", "100+", "1k+", ...
+func magnitude(n float64) string {
+	if n < 10 {
+		return "under 10"
+	}
+	exp := int(math.Floor(math.Log10(n)))
+	switch {
+	case exp >= 9:
+		return fmt.Sprintf("%sB+", pow10(exp-9))
+	case exp >= 6:
+		return fmt.Sprintf("%sM+", pow10(exp-6))
+	case exp >= 3:
+		return fmt.Sprintf("%sk+", pow10(exp-3))
+	}
+	return pow10(exp) + "+"
+}
+
+func pow10(exp int) string {
+	return fmt.Sprintf("%.0f", math.Pow10(exp))
+}
+
+// coarseDuration rounds an uptime down to whole hours or days
+func coarseDuration(d time.Duration) string {
+	switch {
+	case d < time.Hour:
+		return "under an hour"
+	case d < 2*time.Hour:
+		return "1 hour"
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%d hours", int(d/time.Hour))
+	case d < 48*time.Hour:
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", int(d/(24*time.Hour)))
+}
+
+// laplace samples Laplace(0, scale) noise
+func laplace(scale float64) float64 {
+	u := rand.Float64() - 0.5
+	return -scale * math.Copysign(1, u) * math.Log(1-2*math.Abs(u))
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMagnitude(t *testing.T) {
+	cases := map[float64]string{
+		-4:      "under 10",
+		9.9:     "under 10",
+		10:      "10+",
+		999:     "100+",
+		1000:    "1k+",
+		54321:   "10k+",
+		2.5e6:   "1M+",
+		3.1e10:  "10B+",
+		123_456: "100k+",
+	}
+	for n, want := range cases {
+		if got := magnitude(n); got != want {
+			t.Errorf("magnitude(%v) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestCoarseDuration(t *testing.T) {
+	cases := map[time.Duration]string{
+		10 * time.Minute:             "under an hour",
+		90 * time.Minute:             "1 hour",
+		5*time.Hour + 59*time.Minute: "5 hours",
+		30 * time.Hour:               "1 day",
+		100 * time.Hour:              "4 days",
+	}
+	for d, want := range cases {
+		if got := coarseDuration(d); got != want {
+			t.Errorf("coarseDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// storageProbe is what CheckStorage writes and reads back
+var storageProbe = []byte("secretnotes storage check: 0123456789abcdef")
+
+// CheckStorage makes sure encrypted files can be stored where PocketBase
+// keeps them, local disk or an S3 bucket: it uploads a probe file, reads part
+// of it back with a seek, as ranged downloads of chunked attachments do, and
+// deletes it. With S3 this turns a wrong endpoint, bucket or credentials into
+// an error at startup instead of at the first upload.
+func (f *FileService) CheckStorage() error {
+	fs, err := f.App.NewFilesystem()
+	if err != nil {
+		return fmt.Errorf("filesystem init: %w", err)
+	}
+	defer fs.Close()
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	key := "secretnotes_storage_check_" + hex.EncodeToString(suffix)
+	if err := fs.Upload(storageProbe, key); err != nil {
+		return fmt.Errorf("failed to upload a test file: %w", err)
+	}
+
+	err = readProbe(fs, key)
+	if deleteErr := fs.Delete(key); err == nil && deleteErr != nil {
+		err = fmt.Errorf("failed to delete the test file: %w", deleteErr)
+	}
+	return err
+}
+
+// readProbe checks that the probe file stored under key reads back as written
+func readProbe(fs *filesystem.System, key string) error {
+	reader, err := fs.GetReader(key)
+	if err != nil {
+		return fmt.Errorf("failed to open the test file: %w", err)
+	}
+	defer reader.Close()
+	const offset = 27
+	if _, err := reader.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek in the test file: %w", err)
+	}
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read the test file: %w", err)
+	}
+	if reader.Size() != int64(len(storageProbe)) || !bytes.Equal(got, storageProbe[offset:]) {
+		return fmt.Errorf("the test file read back differently than it was written")
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+
+	_ "github.com/ktappdev/secretnotes-go-backend/migrations"
+)
+
+// fakeS3 is just enough of the S3 API for PocketBase's client: single-part
+// PUT, GET and HEAD with ranges, and DELETE of path-style keys, plus listing
+// and deleting object versions
+type fakeS3 struct {
+	mu         sync.Mutex
+	objects    map[string][]byte
+	noncurrent map[string][]string // older version IDs per key
+	ranges     int                 // ranged GETs served
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.objects[r.URL.Path] = data
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodGet, http.MethodHead:
+		if r.URL.Query().Has("versions") {
+			s.listVersions(w, r)
+			return
+		}
+		data, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "<Error><Code>NoSuchKey</Code></Error>")
+			return
+		}
+		if r.Header.Get("Range") != "" {
+			s.ranges++
+		}
+		http.ServeContent(w, r, "", time.Unix(0, 0), bytes.NewReader(data))
+	case http.MethodDelete:
+		if id := r.URL.Query().Get("versionId"); id != "null" && id != "" {
+			s.noncurrent[r.URL.Path] = slices.DeleteFunc(s.noncurrent[r.URL.Path], func(v string) bool { return v == id })
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// listVersions answers ListObjectVersions, the current version of each
+// object being "null"
+func (s *fakeS3) listVersions(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	prefix := r.URL.Path + r.URL.Query().Get("prefix")
+	io.WriteString(w, "<ListVersionsResult>")
+	for path := range s.objects {
+		if strings.HasPrefix(path, prefix) {
+			fmt.Fprintf(w, "<Version><Key>%s</Key><VersionId>null</VersionId></Version>", strings.TrimPrefix(path, r.URL.Path))
+		}
+	}
+	for path, ids := range s.noncurrent {
+		for _, id := range ids {
+			if strings.HasPrefix(path, prefix) {
+				fmt.Fprintf(w, "<Version><Key>%s</Key><VersionId>%s</VersionId></Version>", strings.TrimPrefix(path, r.URL.Path), id)
+			}
+		}
+	}
+	io.WriteString(w, "</ListVersionsResult>")
+}
+
+// s3App returns an app storing files in a fake S3 bucket
+func s3App(t *testing.T) (*pocketbase.PocketBase, *fakeS3) {
+	fake := &fakeS3{objects: map[string][]byte{}, noncurrent: map[string][]string{}}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	s3 := &app.Settings().S3
+	s3.Enabled = true
+	s3.Bucket = "notes"
+	s3.Region = "us-east-1"
+	s3.Endpoint = srv.URL
+	s3.AccessKey = "access"
+	s3.Secret = "secret"
+	s3.ForcePathStyle = true
+	return app, fake
+}
+
+// migratedApp returns an app on a fresh data directory with the server's
+// collections, storing files on local disk
+func migratedApp(t *testing.T) *pocketbase.PocketBase {
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.ResetBootstrapState() })
+	if err := app.RunAllMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestCheckStorage(t *testing.T) {
+	local := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := NewFileService(local, NewEncryptionService()).CheckStorage(); err != nil {
+		t.Fatalf("local storage: %v", err)
+	}
+
+	app, fake := s3App(t)
+	if err := NewFileService(app, NewEncryptionService()).CheckStorage(); err != nil {
+		t.Fatalf("S3 storage: %v", err)
+	}
+	if len(fake.objects) != 0 || fake.ranges == 0 {
+		t.Fatalf("expected a ranged read and the probe deleted, got %d ranged reads and %d objects", fake.ranges, len(fake.objects))
+	}
+
+	app.Settings().S3.Endpoint = "http://127.0.0.1:1"
+	if err := NewFileService(app, NewEncryptionService()).CheckStorage(); err == nil {
+		t.Fatal("expected an unreachable bucket to fail the check")
+	}
+}
+
+func TestChunkedFromS3(t *testing.T) {
+	phrase := "this_is_a_very_long_passphrase_that_is_at_least_32_characters_long"
+	b := FieldBinding("attachment_contents", "abc123", "data")
+	app, fake := s3App(t)
+	enc := NewEncryptionService()
+
+	data := make([]byte, 5*ChunkSize+100)
+	rand.Read(data)
+	sealed, err := enc.EncryptChunked(data, phrase, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := app.NewFilesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	if err := fs.Upload(sealed, "collection/abc123/data"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a range is read from the bucket without downloading the rest
+	stored, err := fs.GetReader("collection/abc123/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stored.Close()
+	r, err := enc.OpenChunked(stored, stored.Size(), phrase, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := int64(3*ChunkSize + 7)
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 32)
+	if _, err := io.ReadFull(r, got); err != nil || !bytes.Equal(got, data[offset:offset+32]) {
+		t.Fatalf("range doesn't match: %v", err)
+	}
+	if fake.ranges == 0 {
+		t.Fatal("expected ranged GETs")
+	}
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/ktappdev/secretnotes-go-backend/cryptoutil"
+)
+
+// OpenedFile is an attachment opened for download. Reads return plaintext and
+// it can seek, so ranges of it can be served; handlers copy it to the response
+// rather than holding the whole file, and Close it when done.
+type OpenedFile struct {
+	io.ReadSeeker
+	Name        string
+	ContentType string
+	Size        int64 // plaintext size
+
+	release func()
+}
+
+// Close zeroes the plaintext the file holds and releases the stored file
+func (o *OpenedFile) Close() error {
+	if o.release != nil {
+		o.release()
+	}
+	return nil
+}
+
+// OpenFile opens the attachment GET /notes/image serves. Chunked attachments
+// are decrypted chunk by chunk as they are read, so a download of any size
+// holds one chunk of plaintext at a time and goes at the client's pace; others,
+// small files or ones stored before chunking, are decrypted up front.
+func (f *FileService) OpenFile(phrase string) (*OpenedFile, error) {
+	record, err := f.findFile(phrase)
+	if err != nil {
+		return nil, err
+	}
+
+	if !record.GetBool("chunked") {
+		file, err := f.decryptRecord(record, phrase)
+		if err != nil {
+			return nil, err
+		}
+		return &OpenedFile{
+			ReadSeeker:  bytes.NewReader(file.Data),
+			Name:        file.Name,
+			ContentType: file.ContentType,
+			Size:        int64(len(file.Data)),
+			release:     func() { cryptoutil.Wipe(file.Data) },
+		}, nil
+	}
+
+	name, err := f.decryptFilename(record, phrase)
+	if err != nil {
+		return nil, err
+	}
+	contentType, err := f.decryptContentType(f.App, record, phrase)
+	if err != nil {
+		return nil, err
+	}
+	stored, release, err := f.openStoredField(f.App, record, "file_data")
+	if err != nil {
+		return nil, err
+	}
+	plain, err := f.Encryption.OpenChunked(stored, stored.Size(), phrase, contentBinding(record))
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &OpenedFile{
+		ReadSeeker:  plain,
+		Name:        name,
+		ContentType: contentType,
+		Size:        plain.Size(),
+		release: func() {
+			plain.Wipe()
+			release()
+		},
+	}, nil
+}
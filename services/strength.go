@@ -0,0 +1,837 @@
+package services
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// MaxStrengthInputLength is how many characters of a passphrase are
+// evaluated; anything beyond adds no more than the estimate already shows
+const MaxStrengthInputLength = 100
+
+// Tuning constants, the same as zxcvbn's so scores are comparable
+const (
+	minGuessesBeforeGrowingSequence = 10000
+	minSubmatchGuessesSingleChar    = 10
+	minSubmatchGuessesMultiChar     = 50
+	minYearSpace                    = 20
+	bruteforceCardinality           = 10
+	keyboardStartingPositions       = 94
+	keyboardAverageDegree           = 4.6
+)
+
+// PhraseStrength is a zxcvbn-style estimate of how hard a passphrase is to guess
+type PhraseStrength struct {
+	Score       int                  `json:"score"`   // 0 (too guessable) to 4 (very unguessable)
+	Guesses     float64              `json:"guesses"` // estimated guesses needed to find it
+	Entropy     float64              `json:"entropy"` // log2 of Guesses, in bits
+	CrackTimes  map[string]CrackTime `json:"crackTimes"`
+	Warning     string               `json:"warning"`
+	Suggestions []string             `json:"suggestions"`
+}
+
+// CrackTime is how long Guesses take at one attack rate
+type CrackTime struct {
+	Seconds float64 `json:"seconds"`
+	Display string  `json:"display"` // e.g. "3 hours", "centuries"
+}
+
+// crackScenarios are the attack rates crack times are given for, in guesses per second
+var crackScenarios = map[string]float64{
+	"onlineThrottled":   100.0 / 3600, // a server with rate limits, like this one
+	"onlineUnthrottled": 10,
+	"offlineSlowHash":   1e4, // a stolen database with a slow KDF
+	"offlineFastHash":   1e10,
+}
+
+// strengthMatch is one guessable piece of a passphrase. i and j are inclusive
+// rune offsets.
+type strengthMatch struct {
+	pattern string // "dictionary", "sequence", "repeat", "spatial", "date" or "bruteforce"
+	i, j    int
+	token   []rune
+	guesses float64
+
+	// dictionary
+	dictionary string
+	rank       int
+	reversed   bool
+	l33t       map[rune]rune // substituted character -> letter
+
+	// sequence
+	ascending bool
+
+	// repeat
+	baseToken   []rune
+	baseGuesses float64
+	repeatCount int
+
+	// spatial
+	shifted int
+
+	// date
+	year      int
+	separator bool
+}
+
+// EstimateStrength estimates how many guesses a passphrase takes, the way
+// zxcvbn does: it is split into the most guessable sequence of dictionary
+// words, keyboard runs, sequences, repeats and dates, and whatever is left is
+// counted as brute force. userInputs are treated as one more dictionary (a
+// user name, the service name), since attackers try those first.
+func EstimateStrength(phrase string, userInputs []string) PhraseStrength {
+	runes := []rune(phrase)
+	if len(runes) > MaxStrengthInputLength {
+		runes = runes[:MaxStrengthInputLength]
+	}
+
+	matcher := newStrengthMatcher(userInputs)
+	guesses, sequence := mostGuessableSequence(runes, matcher.omnimatch(runes))
+
+	strength := PhraseStrength{
+		Score:      guessesToScore(guesses),
+		Guesses:    guesses,
+		Entropy:    math.Log2(math.Max(guesses, 1)),
+		CrackTimes: make(map[string]CrackTime, len(crackScenarios)),
+	}
+	for scenario, rate := range crackScenarios {
+		seconds := guesses / rate
+		strength.CrackTimes[scenario] = CrackTime{Seconds: seconds, Display: displayCrackTime(seconds)}
+	}
+	strength.Warning, strength.Suggestions = strengthFeedback(strength.Score, sequence)
+	return strength
+}
+
+// guessesToScore maps guesses to zxcvbn's 0-4 score
+func guessesToScore(guesses float64) int {
+	const delta = 5
+	switch {
+	case guesses < 1e3+delta:
+		return 0
+	case guesses < 1e6+delta:
+		return 1
+	case guesses < 1e8+delta:
+		return 2
+	case guesses < 1e10+delta:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// mostGuessableSequence finds the sequence of non-overlapping matches, with
+// brute force filling the gaps, that needs the fewest guesses overall:
+// l! * product(match guesses) + 10000^(l-1) for l matches. It returns the
+// guesses and the sequence.
+func mostGuessableSequence(runes []rune, matches []*strengthMatch) (float64, []*strengthMatch) {
+	n := len(runes)
+	if n == 0 {
+		return 1, nil
+	}
+
+	byEnd := make([][]*strengthMatch, n)
+	for _, m := range matches {
+		byEnd[m.j] = append(byEnd[m.j], m)
+	}
+
+	// optimal[k][l] is the best sequence of l matches covering runes[:k+1]
+	type step struct {
+		match *strengthMatch
+		pi    float64 // product of match guesses
+		g     float64 // overall guesses
+	}
+	optimal := make([]map[int]step, n)
+	for k := range optimal {
+		optimal[k] = map[int]step{}
+	}
+
+	update := func(m *strengthMatch, l int) {
+		k := m.j
+		pi := estimateGuesses(m, n)
+		if l > 1 {
+			pi *= optimal[m.i-1][l-1].pi
+		}
+		g := factorial(l)*pi + math.Pow(minGuessesBeforeGrowingSequence, float64(l-1))
+		for competingL, competing := range optimal[k] {
+			if competingL <= l && competing.g <= g {
+				return
+			}
+		}
+		optimal[k][l] = step{match: m, pi: pi, g: g}
+	}
+	bruteforce := func(i, j int) *strengthMatch {
+		return &strengthMatch{pattern: "bruteforce", i: i, j: j, token: runes[i : j+1]}
+	}
+
+	for k := 0; k < n; k++ {
+		for _, m := range byEnd[k] {
+			if m.i == 0 {
+				update(m, 1)
+				continue
+			}
+			for l := range optimal[m.i-1] {
+				update(m, l+1)
+			}
+		}
+
+		update(bruteforce(0, k), 1)
+		for i := 1; i <= k; i++ {
+			for l, last := range optimal[i-1] {
+				// two brute force matches in a row are never better than one
+				if last.match.pattern != "bruteforce" {
+					update(bruteforce(i, k), l+1)
+				}
+			}
+		}
+	}
+
+	bestL, best := 0, math.Inf(1)
+	for l, s := range optimal[n-1] {
+		if s.g < best || s.g == best && l < bestL {
+			bestL, best = l, s.g
+		}
+	}
+
+	sequence := make([]*strengthMatch, 0, bestL)
+	for k, l := n-1, bestL; k >= 0 && l > 0; l-- {
+		m := optimal[k][l].match
+		sequence = append(sequence, m)
+		k = m.i - 1
+	}
+	for a, b := 0, len(sequence)-1; a < b; a, b = a+1, b-1 {
+		sequence[a], sequence[b] = sequence[b], sequence[a]
+	}
+	return best, sequence
+}
+
+// estimateGuesses fills in m.guesses. Matches shorter than the whole passphrase
+// get a floor so that tiny matches can't split a passphrase into cheap pieces.
+func estimateGuesses(m *strengthMatch, passwordLength int) float64 {
+	if m.guesses != 0 {
+		return m.guesses
+	}
+
+	minGuesses := 1.0
+	if len(m.token) < passwordLength {
+		minGuesses = minSubmatchGuessesMultiChar
+		if len(m.token) == 1 {
+			minGuesses = minSubmatchGuessesSingleChar
+		}
+	}
+
+	var guesses float64
+	switch m.pattern {
+	case "bruteforce":
+		guesses = math.Pow(bruteforceCardinality, float64(len(m.token)))
+		floor := float64(minSubmatchGuessesMultiChar + 1)
+		if len(m.token) == 1 {
+			floor = minSubmatchGuessesSingleChar + 1
+		}
+		guesses = math.Max(guesses, floor)
+	case "dictionary":
+		guesses = float64(m.rank) * uppercaseVariations(m.token) * l33tVariations(m)
+		if m.reversed {
+			guesses *= 2
+		}
+	case "sequence":
+		base := 26.0
+		switch first := m.token[0]; {
+		case strings.ContainsRune("aAzZ019", first):
+			base = 4
+		case unicode.IsDigit(first):
+			base = 10
+		}
+		if !m.ascending {
+			base *= 2
+		}
+		guesses = base * float64(len(m.token))
+	case "repeat":
+		guesses = m.baseGuesses * float64(m.repeatCount)
+	case "spatial":
+		// straight runs only: one turn, starting anywhere on the keyboard
+		guesses = float64(len(m.token)-1) * keyboardStartingPositions * keyboardAverageDegree
+		if m.shifted > 0 {
+			unshifted := len(m.token) - m.shifted
+			if unshifted == 0 {
+				guesses *= 2
+			} else {
+				guesses *= variations(m.shifted, unshifted)
+			}
+		}
+	case "date":
+		guesses = math.Max(math.Abs(float64(m.year-time.Now().Year())), minYearSpace)
+		if len(m.token) > 4 {
+			guesses *= 365
+		}
+		if m.separator {
+			guesses *= 4
+		}
+	}
+
+	m.guesses = math.Max(guesses, minGuesses)
+	return m.guesses
+}
+
+// uppercaseVariations counts the capitalisations an attacker would try to
+// reach token: 1 for all lowercase, 2 for the common patterns
+func uppercaseVariations(token []rune) float64 {
+	upper, lower := 0, 0
+	for _, r := range token {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	if upper == 0 {
+		return 1
+	}
+	first, last := unicode.IsUpper(token[0]), unicode.IsUpper(token[len(token)-1])
+	if lower == 0 || upper == 1 && (first || last) {
+		return 2
+	}
+	return variations(upper, lower)
+}
+
+// l33tVariations counts the ways the substitutions of a l33t match could have
+// been applied to the word
+func l33tVariations(m *strengthMatch) float64 {
+	if len(m.l33t) == 0 {
+		return 1
+	}
+	total := 1.0
+	for sub, letter := range m.l33t {
+		subbed, unsubbed := 0, 0
+		for _, r := range m.token {
+			switch unicode.ToLower(r) {
+			case sub:
+				subbed++
+			case letter:
+				unsubbed++
+			}
+		}
+		if subbed == 0 || unsubbed == 0 {
+			total *= 2
+		} else {
+			total *= variations(subbed, unsubbed)
+		}
+	}
+	return total
+}
+
+// variations sums C(a+b, i) for i from 1 to min(a, b)
+func variations(a, b int) float64 {
+	total := 0.0
+	for i := 1; i <= min(a, b); i++ {
+		total += binomial(a+b, i)
+	}
+	return total
+}
+
+func binomial(n, k int) float64 {
+	if k > n {
+		return 0
+	}
+	result := 1.0
+	for d := 1; d <= k; d++ {
+		result = result * float64(n-k+d) / float64(d)
+	}
+	return result
+}
+
+func factorial(n int) float64 {
+	result := 1.0
+	for i := 2; i <= n; i++ {
+		result *= float64(i)
+	}
+	return result
+}
+
+// l33tTable maps common character substitutions back to the letter they replace
+var l33tTable = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '{': 'c', '[': 'c', '<': 'c',
+	'3': 'e', '6': 'g', '9': 'g', '1': 'i', '!': 'i', '|': 'i', '0': 'o',
+	'$': 's', '5': 's', '+': 't', '7': 't', '%': 'x', '2': 'z',
+}
+
+// keyboardRows is a US QWERTY keyboard, unshifted and shifted
+var keyboardRows = [][2]string{
+	{"`1234567890-=", "~!@#$%^&*()_+"},
+	{"qwertyuiop[]\\", "QWERTYUIOP{}|"},
+	{"asdfghjkl;'", "ASDFGHJKL:\""},
+	{"zxcvbnm,./", "ZXCVBNM<>?"},
+}
+
+// maxDictionaryWordLength bounds the substrings looked up in the dictionaries
+const maxDictionaryWordLength = 32
+
+var dateWithSeparator = regexp.MustCompile(`^(\d{1,4})([\s/\\_.-])(\d{1,2})([\s/\\_.-])(\d{1,4})$`)
+
+type keyPosition struct {
+	row, col int
+	shifted  bool
+}
+
+// dictionaryNames fixes the order dictionaries are searched in
+var dictionaryNames = []string{"passwords", "words", "userInputs"}
+
+type strengthMatcher struct {
+	dictionaries map[string]map[string]int // dictionary name -> word -> rank
+	keyboard     map[rune]keyPosition
+}
+
+func newStrengthMatcher(userInputs []string) *strengthMatcher {
+	m := &strengthMatcher{
+		dictionaries: map[string]map[string]int{
+			"passwords": rankedWords(commonPasswords),
+			"words":     rankedWords(commonWords),
+		},
+		keyboard: map[rune]keyPosition{},
+	}
+
+	var inputs []string
+	for _, input := range userInputs {
+		inputs = append(inputs, strings.Fields(strings.ToLower(input))...)
+	}
+	m.dictionaries["userInputs"] = rankedWords(inputs)
+
+	for row, keys := range keyboardRows {
+		for col, r := range []rune(keys[0]) {
+			m.keyboard[r] = keyPosition{row: row, col: col}
+		}
+		for col, r := range []rune(keys[1]) {
+			m.keyboard[r] = keyPosition{row: row, col: col, shifted: true}
+		}
+	}
+	return m
+}
+
+// rankedWords indexes a list by 1-based position; earlier words are more common
+func rankedWords(words []string) map[string]int {
+	ranked := make(map[string]int, len(words))
+	for i, word := range words {
+		if _, ok := ranked[word]; !ok {
+			ranked[word] = i + 1
+		}
+	}
+	return ranked
+}
+
+// omnimatch returns every match any pattern finds in runes
+func (s *strengthMatcher) omnimatch(runes []rune) []*strengthMatch {
+	var matches []*strengthMatch
+	matches = append(matches, s.dictionaryMatches(runes)...)
+	matches = append(matches, s.reversedDictionaryMatches(runes)...)
+	matches = append(matches, s.l33tMatches(runes)...)
+	matches = append(matches, s.spatialMatches(runes)...)
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, s.repeatMatches(runes)...)
+	matches = append(matches, dateMatches(runes)...)
+	sort.SliceStable(matches, func(a, b int) bool {
+		if matches[a].i != matches[b].i {
+			return matches[a].i < matches[b].i
+		}
+		return matches[a].j < matches[b].j
+	})
+	return matches
+}
+
+func (s *strengthMatcher) dictionaryMatches(runes []rune) []*strengthMatch {
+	lower := []rune(strings.ToLower(string(runes)))
+	if len(lower) != len(runes) {
+		return nil // a case change altered the length; offsets would no longer line up
+	}
+
+	var matches []*strengthMatch
+	for i := range lower {
+		for j := i; j < len(lower) && j-i < maxDictionaryWordLength; j++ {
+			word := string(lower[i : j+1])
+			for _, name := range dictionaryNames {
+				if rank, ok := s.dictionaries[name][word]; ok {
+					matches = append(matches, &strengthMatch{
+						pattern:    "dictionary",
+						i:          i,
+						j:          j,
+						token:      runes[i : j+1],
+						dictionary: name,
+						rank:       rank,
+					})
+				}
+			}
+		}
+	}
+	return matches
+}
+
+func (s *strengthMatcher) reversedDictionaryMatches(runes []rune) []*strengthMatch {
+	reversed := make([]rune, len(runes))
+	for i, r := range runes {
+		reversed[len(runes)-1-i] = r
+	}
+
+	matches := s.dictionaryMatches(reversed)
+	for _, m := range matches {
+		m.i, m.j = len(runes)-1-m.j, len(runes)-1-m.i
+		m.token = runes[m.i : m.j+1]
+		m.reversed = true
+	}
+	return matches
+}
+
+func (s *strengthMatcher) l33tMatches(runes []rune) []*strengthMatch {
+	translated := make([]rune, len(runes))
+	substituted := false
+	for i, r := range runes {
+		translated[i] = r
+		if letter, ok := l33tTable[r]; ok {
+			translated[i] = letter
+			substituted = true
+		}
+	}
+	if !substituted {
+		return nil
+	}
+
+	var matches []*strengthMatch
+	for _, m := range s.dictionaryMatches(translated) {
+		m.token = runes[m.i : m.j+1]
+		subs := map[rune]rune{}
+		for _, r := range m.token {
+			if letter, ok := l33tTable[r]; ok {
+				subs[r] = letter
+			}
+		}
+		// single characters and words without substitutions are found elsewhere
+		if len(subs) == 0 || len(m.token) == 1 {
+			continue
+		}
+		m.l33t = subs
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// spatialMatches finds runs of three or more neighbouring keys along a
+// keyboard row, in either direction
+func (s *strengthMatcher) spatialMatches(runes []rune) []*strengthMatch {
+	var matches []*strengthMatch
+	emit := func(i, j int) {
+		if j-i < 2 {
+			return
+		}
+		m := &strengthMatch{pattern: "spatial", i: i, j: j, token: runes[i : j+1]}
+		for _, r := range m.token {
+			if s.keyboard[r].shifted {
+				m.shifted++
+			}
+		}
+		matches = append(matches, m)
+	}
+
+	start, direction := 0, 0
+	for k := 1; k <= len(runes); k++ {
+		step := 0
+		if k < len(runes) {
+			prev, okPrev := s.keyboard[runes[k-1]]
+			cur, okCur := s.keyboard[runes[k]]
+			if okPrev && okCur && prev.row == cur.row && (cur.col-prev.col == 1 || cur.col-prev.col == -1) {
+				step = cur.col - prev.col
+			}
+		}
+		if step != 0 && (direction == 0 || step == direction) {
+			direction = step
+			continue
+		}
+		emit(start, k-1)
+		start, direction = k-1, step
+		if step == 0 {
+			start = k
+		}
+	}
+	return matches
+}
+
+// sequenceMatches finds runs like "abc", "7654" or "ace" where each character
+// is a constant step (up to 5) from the previous one
+func sequenceMatches(runes []rune) []*strengthMatch {
+	if len(runes) < 2 {
+		return nil
+	}
+
+	var matches []*strengthMatch
+	emit := func(i, j, delta int) {
+		abs := delta
+		if abs < 0 {
+			abs = -abs
+		}
+		if (j-i > 1 || abs == 1) && abs > 0 && abs <= 5 {
+			matches = append(matches, &strengthMatch{
+				pattern:   "sequence",
+				i:         i,
+				j:         j,
+				token:     runes[i : j+1],
+				ascending: delta > 0,
+			})
+		}
+	}
+
+	i, lastDelta := 0, int(runes[1])-int(runes[0])
+	for k := 2; k < len(runes); k++ {
+		delta := int(runes[k]) - int(runes[k-1])
+		if delta == lastDelta {
+			continue
+		}
+		emit(i, k-1, lastDelta)
+		i, lastDelta = k-1, delta
+	}
+	emit(i, len(runes)-1, lastDelta)
+	return matches
+}
+
+// repeatMatches finds a substring repeated back to back, like "aaa" or
+// "abcabc". At each position the repeat covering the most characters wins,
+// with the shortest repeating unit breaking ties.
+func (s *strengthMatcher) repeatMatches(runes []rune) []*strengthMatch {
+	var matches []*strengthMatch
+	for i := 0; i < len(runes); {
+		bestSize, bestCount := 0, 0
+		for size := 1; i+2*size <= len(runes); size++ {
+			count := 1
+			for i+(count+1)*size <= len(runes) && string(runes[i+count*size:i+(count+1)*size]) == string(runes[i:i+size]) {
+				count++
+			}
+			if count >= 2 && count*size > bestSize*bestCount {
+				bestSize, bestCount = size, count
+			}
+		}
+		if bestCount == 0 {
+			i++
+			continue
+		}
+
+		base := runes[i : i+bestSize]
+		baseGuesses, _ := mostGuessableSequence(base, s.omnimatch(base))
+		j := i + bestCount*bestSize - 1
+		matches = append(matches, &strengthMatch{
+			pattern:     "repeat",
+			i:           i,
+			j:           j,
+			token:       runes[i : j+1],
+			baseToken:   base,
+			baseGuesses: baseGuesses,
+			repeatCount: bestCount,
+		})
+		i = j + 1
+	}
+	return matches
+}
+
+// dateMatches finds years (1900-2099) and dates with or without separators
+// such as 13/5/1991, 1991-05-13 or 130591
+func dateMatches(runes []rune) []*strengthMatch {
+	var matches []*strengthMatch
+	for i := range runes {
+		for j := i + 3; j < len(runes) && j-i < 10; j++ {
+			token := string(runes[i : j+1])
+			m := &strengthMatch{pattern: "date", i: i, j: j, token: runes[i : j+1]}
+
+			switch {
+			case isDigits(token) && len(token) == 4:
+				year, _ := strconv.Atoi(token)
+				if year < 1900 || year > 2099 {
+					continue
+				}
+				m.year = year
+			case isDigits(token) && (len(token) == 6 || len(token) == 8):
+				year, ok := dateYear(splitDigits(token))
+				if !ok {
+					continue
+				}
+				m.year = year
+			default:
+				parts := dateWithSeparator.FindStringSubmatch(token)
+				if parts == nil || parts[2] != parts[4] {
+					continue
+				}
+				year, ok := dateYear([][3]string{{parts[1], parts[3], parts[5]}})
+				if !ok {
+					continue
+				}
+				m.year, m.separator = year, true
+			}
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// splitDigits lists the ways a 6 or 8 digit run splits into three date parts
+func splitDigits(token string) [][3]string {
+	if len(token) == 6 {
+		return [][3]string{{token[:2], token[2:4], token[4:]}}
+	}
+	return [][3]string{
+		{token[:2], token[2:4], token[4:]}, // ddmmyyyy, mmddyyyy
+		{token[:4], token[4:6], token[6:]}, // yyyymmdd
+	}
+}
+
+// dateYear returns the year of the first split that reads as a plausible
+// date in day-month-year, month-day-year or year-month-day order
+func dateYear(splits [][3]string) (int, bool) {
+	for _, p := range splits {
+		for _, dmy := range [][3]string{{p[0], p[1], p[2]}, {p[1], p[0], p[2]}, {p[2], p[1], p[0]}} {
+			if year, ok := validDate(dmy[0], dmy[1], dmy[2]); ok {
+				return year, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// validDate checks a day, month and two or four digit year, returning the
+// full year
+func validDate(day, month, year string) (int, bool) {
+	d, _ := strconv.Atoi(day)
+	m, _ := strconv.Atoi(month)
+	y, _ := strconv.Atoi(year)
+	if len(day) > 2 || len(month) > 2 || d < 1 || d > 31 || m < 1 || m > 12 {
+		return 0, false
+	}
+	switch len(year) {
+	case 2:
+		if y > 50 {
+			return 1900 + y, true
+		}
+		return 2000 + y, true
+	case 4:
+		return y, y >= 1000 && y <= 2099
+	}
+	return 0, false
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// strengthFeedback explains the weakest part of a passphrase scoring 2 or less
+func strengthFeedback(score int, sequence []*strengthMatch) (string, []string) {
+	if score > 2 {
+		return "", []string{}
+	}
+	suggestions := []string{"Add another word or two. Uncommon words are better."}
+	if len(sequence) == 0 {
+		return "", append(suggestions, "Use a few words, avoid common phrases.")
+	}
+
+	longest := sequence[0]
+	for _, m := range sequence[1:] {
+		if len(m.token) > len(longest.token) {
+			longest = m
+		}
+	}
+
+	switch longest.pattern {
+	case "dictionary":
+		warning := ""
+		switch {
+		case longest.dictionary == "passwords" && len(sequence) == 1 && !longest.reversed && len(longest.l33t) == 0:
+			switch {
+			case longest.rank <= 10:
+				warning = "This is a top-10 common password."
+			case longest.rank <= 100:
+				warning = "This is a top-100 common password."
+			default:
+				warning = "This is a very common password."
+			}
+		case longest.dictionary == "passwords":
+			warning = "This is similar to a commonly used password."
+		case longest.dictionary == "userInputs":
+			warning = "Avoid names and details that are associated with you."
+		case len(sequence) == 1:
+			warning = "A word by itself is easy to guess."
+		}
+
+		word := string(longest.token)
+		switch {
+		case strings.ToUpper(word) == word && strings.ToLower(word) != word:
+			suggestions = append(suggestions, "All-uppercase is almost as easy to guess as all-lowercase.")
+		case unicode.IsUpper(longest.token[0]):
+			suggestions = append(suggestions, "Capitalization doesn't help very much.")
+		}
+		if longest.reversed && len(longest.token) >= 4 {
+			suggestions = append(suggestions, "Reversed words aren't much harder to guess.")
+		}
+		if len(longest.l33t) > 0 {
+			suggestions = append(suggestions, "Predictable substitutions like '@' instead of 'a' don't help very much.")
+		}
+		return warning, suggestions
+	case "spatial":
+		return "Straight rows of keys are easy to guess.", append(suggestions, "Use a longer keyboard pattern with more turns.")
+	case "repeat":
+		warning := `Repeats like "abcabcabc" are only slightly harder to guess than "abc".`
+		if len(longest.baseToken) == 1 {
+			warning = `Repeats like "aaa" are easy to guess.`
+		}
+		return warning, append(suggestions, "Avoid repeated words and characters.")
+	case "sequence":
+		return "Sequences like abc or 6543 are easy to guess.", append(suggestions, "Avoid sequences.")
+	case "date":
+		if len(longest.token) == 4 {
+			return "Recent years are easy to guess.", append(suggestions, "Avoid recent years.", "Avoid years that are associated with you.")
+		}
+		return "Dates are often easy to guess.", append(suggestions, "Avoid dates and years that are associated with you.")
+	}
+	return "", suggestions
+}
+
+// displayCrackTime renders seconds the way zxcvbn does: "less than a second",
+// "5 minutes", "centuries"
+func displayCrackTime(seconds float64) string {
+	const (
+		minute  = 60
+		hour    = minute * 60
+		day     = hour * 24
+		month   = day * 31
+		year    = month * 12
+		century = year * 100
+	)
+
+	unit := func(n float64, name string) string {
+		rounded := int64(math.Round(n))
+		if rounded == 1 {
+			return "1 " + name
+		}
+		return strconv.FormatInt(rounded, 10) + " " + name + "s"
+	}
+
+	switch {
+	case seconds < 1:
+		return "less than a second"
+	case seconds < minute:
+		return unit(seconds, "second")
+	case seconds < hour:
+		return unit(seconds/minute, "minute")
+	case seconds < day:
+		return unit(seconds/hour, "hour")
+	case seconds < month:
+		return unit(seconds/day, "day")
+	case seconds < year:
+		return unit(seconds/month, "month")
+	case seconds < century:
+		return unit(seconds/year, "year")
+	default:
+		return "centuries"
+	}
+}
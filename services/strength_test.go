@@ -0,0 +1,67 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEstimateStrength(t *testing.T) {
+	tests := []struct {
+		phrase   string
+		maxScore int
+		minScore int
+		warning  string
+	}{
+		{"password", 0, 0, "This is a top-10 common password."},
+		{"p@ssw0rd", 0, 0, "This is similar to a commonly used password."},
+		{"qwertyuiop", 0, 0, ""},
+		{"poiuytre", 1, 0, "Straight rows of keys are easy to guess."},
+		{"abcdefgh", 0, 0, "Sequences like abc or 6543 are easy to guess."},
+		{"aaaaaaaaaa", 0, 0, `Repeats like "aaa" are easy to guess.`},
+		{"13/05/1991", 1, 0, "Dates are often easy to guess."},
+		{"alice", 0, 0, "Avoid names and details that are associated with you."},
+		{"correct horse battery staple", 4, 4, ""},
+		{"x7$kQ9!mZ2#vL", 4, 3, ""},
+	}
+	for _, tt := range tests {
+		got := EstimateStrength(tt.phrase, []string{"Alice"})
+		if got.Score < tt.minScore || got.Score > tt.maxScore {
+			t.Errorf("%q: expected score %d-%d, got %d (%.0f guesses)", tt.phrase, tt.minScore, tt.maxScore, got.Score, got.Guesses)
+		}
+		if tt.warning != "" && got.Warning != tt.warning {
+			t.Errorf("%q: expected warning %q, got %q", tt.phrase, tt.warning, got.Warning)
+		}
+		if got.Score <= 2 && len(got.Suggestions) == 0 {
+			t.Errorf("%q: expected suggestions for a weak passphrase", tt.phrase)
+		}
+		if len(got.CrackTimes) != len(crackScenarios) {
+			t.Errorf("%q: expected %d crack times, got %v", tt.phrase, len(crackScenarios), got.CrackTimes)
+		}
+	}
+}
+
+func TestEstimateStrengthTruncatesLongInput(t *testing.T) {
+	long := strings.Repeat("Zq8#", 1000)
+	got := EstimateStrength(long, nil)
+	if want := EstimateStrength(long[:MaxStrengthInputLength], nil); got.Guesses != want.Guesses {
+		t.Fatalf("expected only the first %d characters to count, got %v guesses vs %v", MaxStrengthInputLength, got.Guesses, want.Guesses)
+	}
+}
+
+func TestDisplayCrackTime(t *testing.T) {
+	tests := map[float64]string{
+		0.5:   "less than a second",
+		1:     "1 second",
+		90:    "2 minutes",
+		7200:  "2 hours",
+		4e9:   "centuries",
+		86400: "1 day",
+		5e6:   "2 months",
+		6e7:   "2 years",
+	}
+	for seconds, want := range tests {
+		if got := displayCrackTime(seconds); got != want {
+			t.Errorf("displayCrackTime(%v) = %q, want %q", seconds, got, want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package services
+
+import "strings"
+
+// commonPasswords are frequently leaked passwords, most common first. The
+// list is short on purpose: it catches the passwords guessers try first,
+// which is what matters for the score.
+var commonPasswords = strings.Fields(`
+123456 password 12345678 qwerty 123456789 12345 1234 111111 1234567 dragon
+123123 baseball abc123 football monkey letmein 696969 shadow master 666666
+qwertyuiop 123321 mustang 1234567890 michael 654321 superman 1qaz2wsx 7777777 121212
+000000 qazwsx 123qwe killer trustno1 jordan jennifer zxcvbnm asdfgh hunter
+buster soccer harley batman andrew tigger sunshine iloveyou 2000 charlie
+robert thomas hockey ranger daniel starwars klaster 112233 george computer
+michelle jessica pepper 1111 zxcvbn 555555 11111111 131313 freedom 777777
+pass maggie 159753 aaaaaa ginger princess joshua cheese amanda summer
+love ashley nicole chelsea biteme matthew access yankees 987654321 dallas
+austin thunder taylor matrix mobilemail mom monitor monitoring montana moon
+moscow welcome admin login passw0rd password1 password123 qwerty123 secret
+abc123456 letmein1 iloveyou1 monkey1 dragon1 123abc football1 baseball1 sunshine1
+princess1 qwe123 1q2w3e4r 1q2w3e zaq12wsx q1w2e3r4 123qweasd asdf1234 asdfghjkl
+changeme default guest root toor test test123 hello hello123 welcome1
+master1 whatever nothing internet cookie flower hannah samsung apple orange
+banana chocolate butterfly purple jasmine loveme lovely angel angels friends
+secretnotes secretnote notes note passphrase mypassword mysecret secret123 private
+`)
+
+// commonWords are frequent English words, most common first. Passphrases
+// built from them are only as strong as the number of words.
+var commonWords = strings.Fields(`
+the be to of and a in that have it for not on with he as you do at this but
+his by from they we say her she or an will my one all would there their what
+so up out if about who get which go me when make can like time no just him
+know take people into year your good some could them see other than then now
+look only come its over think also back after use two how our work first well
+way even new want because any these give day most us is was are been has had
+were said did having may should call world school still try last ask need too
+feel three state never become between high really something another family own
+leave put old while mean keep student why let great same big group begin seem
+country help talk where turn problem every start hand might american show part
+against place such again few case week company system each right program hear
+question during play government run small number off always move night live point
+believe hold today bring happen next without before large million must home
+under water room write mother area national money story young fact month different
+lot study book eye job word though business issue side kind four head far black
+long both little house yes since provide service around friend important father
+sit away until power hour game often yet line political end among ever stand bad
+lose however member pay law meet car city almost include continue set later
+community much name five once white least president learn real change team
+minute best several idea kid body information nothing ago lead social understand
+whether watch together follow parent stop face anything create public already
+speak others read level allow add office spend door health person art sure war
+history party within grow result open morning walk reason low win research girl
+guy early food moment himself air teacher force offer enough education across
+although remember foot second boy maybe toward able age policy everything love
+process music including consider appear actually buy probably human wait serve
+market die send expect sense build stay fall oh nation plan cut college interest
+death course someone experience behind reach local kill six remain effect yeah
+suggest class control raise care perhaps late hard field else pass former sell
+major sometimes require along development themselves report role better economic
+effort decide rate strong possible heart drug show leader light voice wife whole
+police mind finally pull return free military price less according decision
+explain son hope develop view relationship carry town road drive arm true federal
+break difference thank receive value international building action full model
+join season society tax director position player agree especially record pick
+wear paper special space ground form support event official whose matter everyone
+center couple site project hit base activity star table need court produce eat
+american oil situation easy cost industry figure street image itself phone either
+data cover quite picture clear practice piece land recent describe product doctor
+wall patient worker news test movie certain north personal simply third technology
+catch step baby computer type attention draw film republican tree source red
+nearly organization choose cause hair century evidence window difficult listen
+soon culture billion chance brother energy period summer realize hundred available
+plant likely opportunity term short letter condition choice single rule daughter
+administration south husband floor campaign material population economy medical
+hospital church close thousand risk current fire future wrong involve defense
+anyone increase security bank myself certainly west sport board seek per subject
+officer private rest behavior deal performance fight throw top quickly past goal
+bed order author fill represent focus foreign drop blood upon agency push nature
+color recently store reduce sound note fine near movement page enter share common
+poor natural race concern series significant similar hot language each usually
+response dead rise animal factor decade article shoot east save seven artist away
+scene stock career despite central eight thus treatment beyond happy exactly
+protect approach lie size dog fund serious occur media ready sign thought list
+individual simple quality pressure accept answer resource identify left meeting
+determine prepare disease whatever success argue cup particularly amount ability
+staff recognize indicate character growth loss degree wonder attack herself region
+television box training pretty trade election everybody physical lay general
+feeling standard bill message fail outside arrive analysis benefit sex forward
+lawyer present section environmental glass skill sister professor operation
+financial crime stage ok compare authority miss design sort act ten knowledge gun
+station blue state strategy clearly discuss indeed truth song example democratic
+check environment leg dark various rather laugh guess executive prove hang
+entire rock forget claim remove manager enjoy network legal religious cold final
+main science green memory card above seat cell establish nice trial expert spring
+firm radio visit management avoid imagine tonight huge ball finish yourself theory
+impact respond statement maintain charge popular traditional onto reveal direction
+weapon employee cultural contain peace pain apply play measure wide shake fly
+interview manage chair fish particular camera structure politics perform bit
+weight suddenly discover candidate production treat trip evening affect inside
+conference unit style adult worry range mention deep edge specific writer trouble
+necessary throughout challenge fear shoulder institution middle sea dream bar
+beautiful property instead improve stuff secret horse battery staple correct dragon
+`)
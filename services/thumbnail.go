@@ -0,0 +1,78 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+
+	"github.com/disintegration/imaging"
+	_ "golang.org/x/image/webp" // register the WebP decoder
+)
+
+const (
+	// ThumbnailSize bounds a thumbnail's width and height in pixels
+	ThumbnailSize = 256
+
+	// ThumbnailContentType is the format every thumbnail is stored in
+	ThumbnailContentType = "image/jpeg"
+
+	// maxDecodePixels caps the images thumbnails and transforms decode;
+	// decoding allocates 4 bytes per pixel
+	maxDecodePixels = 40_000_000
+)
+
+// ErrThumbnailNotFound is returned when the attachment has no thumbnail: it
+// isn't an image, or was stored before thumbnails were generated
+var ErrThumbnailNotFound = errors.New("attachment has no thumbnail")
+
+// makeThumbnail scales an image down to fit ThumbnailSize, flattened onto
+// white and encoded as JPEG. It returns nil when content isn't an image it can
+// decode, which is not an error: such attachments just have no thumbnail.
+// The image is read twice, for its size and then its pixels.
+func makeThumbnail(content *io.SectionReader) ([]byte, error) {
+	config, _, err := image.DecodeConfig(reread(content))
+	if err != nil || config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxDecodePixels {
+		return nil, nil
+	}
+	img, err := imaging.Decode(reread(content), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, nil
+	}
+
+	if img.Bounds().Dx() > ThumbnailSize || img.Bounds().Dy() > ThumbnailSize {
+		img = imaging.Fit(img, ThumbnailSize, ThumbnailSize, imaging.Lanczos)
+	}
+	bounds := img.Bounds()
+	flat := imaging.Overlay(imaging.New(bounds.Dx(), bounds.Dy(), color.White), img, image.Pt(0, 0), 1)
+
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, flat, imaging.JPEG, imaging.JPEGQuality(80)); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// RetrieveThumbnail decrypts the thumbnail of the attachment GET /notes/image
+// serves, or returns ErrFileNotFound or ErrThumbnailNotFound
+func (f *FileService) RetrieveThumbnail(phrase string) ([]byte, error) {
+	record, err := f.findFile(phrase)
+	if err != nil {
+		return nil, err
+	}
+	if record.GetString("thumbnail") == "" {
+		return nil, ErrThumbnailNotFound
+	}
+
+	encrypted, err := f.readStoredField(f.App, record, "thumbnail")
+	if err != nil {
+		return nil, err
+	}
+	thumbnail, err := f.Encryption.DecryptBound(encrypted, phrase, recordBinding(record, "thumbnail"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt thumbnail: %w", err)
+	}
+	return thumbnail, nil
+}
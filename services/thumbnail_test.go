@@ -0,0 +1,46 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestMakeThumbnail(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 1024, 512))
+	for x := 0; x < 1024; x++ {
+		src.Set(x, 0, color.NRGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	thumb, err := makeThumbnail(sectionOf(buf.Bytes()))
+	if err != nil || thumb == nil {
+		t.Fatalf("expected a thumbnail, got %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(thumb))
+	if err != nil {
+		t.Fatalf("thumbnail isn't a JPEG: %v", err)
+	}
+	if got := img.Bounds().Size(); got != image.Pt(ThumbnailSize, ThumbnailSize/2) {
+		t.Fatalf("expected %dx%d, got %v", ThumbnailSize, ThumbnailSize/2, got)
+	}
+	// transparent pixels are flattened onto white
+	if r, g, b, _ := img.At(10, 100).RGBA(); r>>8 < 240 || g>>8 < 240 || b>>8 < 240 {
+		t.Fatalf("expected a white background, got %d,%d,%d", r>>8, g>>8, b>>8)
+	}
+
+	for name, data := range map[string][]byte{
+		"text":  []byte("not an image at all"),
+		"empty": nil,
+	} {
+		if thumb, err := makeThumbnail(sectionOf(data)); thumb != nil || err != nil {
+			t.Errorf("%s: expected no thumbnail, got %d bytes, %v", name, len(thumb), err)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package services
+
+import (
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Timestamp converts a stored date field to the form used in API responses:
+// UTC with millisecond precision, the resolution PocketBase stores. Freshly
+// saved records would otherwise report nanoseconds that a later read loses.
+func Timestamp(dt types.DateTime) time.Time {
+	return dt.Time().UTC().Truncate(time.Millisecond)
+}
@@ -0,0 +1,22 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func TestTimestamp(t *testing.T) {
+	local := time.FixedZone("UTC+2", 2*60*60)
+	dt, err := types.ParseDateTime(time.Date(2024, 5, 1, 11, 30, 0, 123456789, local))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _ := json.Marshal(Timestamp(dt))
+	if want := `"2024-05-01T09:30:00.123Z"`; string(raw) != want {
+		t.Errorf("Timestamp marshals as %s, want %s", raw, want)
+	}
+}
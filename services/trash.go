@@ -0,0 +1,81 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// DeletedAt returns when a note record was moved to the trash, or nil when it wasn't
+func DeletedAt(record *core.Record) *time.Time {
+	return optionalTime(record.GetDateTime("deleted_at"))
+}
+
+// FindDeleted reports when the phrase's note was deleted, or nil when it isn't
+// in the trash
+func (n *NoteService) FindDeleted(phrase string, grace time.Duration) (*time.Time, error) {
+	record, err := n.deletedRecord(phrase, grace)
+	if err != nil || record == nil {
+		return nil, err
+	}
+	return DeletedAt(record), nil
+}
+
+// UndeleteNote restores a note from the trash while its grace period lasts
+func (n *NoteService) UndeleteNote(phrase string, grace time.Duration) (*Note, error) {
+	record, err := n.deletedRecord(phrase, grace)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrNoteNotFound
+	}
+
+	record.Set("deleted_at", "")
+	if err := n.App.Save(record); err != nil {
+		return nil, fmt.Errorf("failed to restore note: %w", err)
+	}
+	return n.openNote(record, phrase), nil
+}
+
+// deletedRecord finds the phrase's note if it is in the trash. A note whose
+// grace period has passed is purged on the spot rather than waiting for
+// PurgeDeletedNotes, and reported as absent.
+func (n *NoteService) deletedRecord(phrase string, grace time.Duration) (*core.Record, error) {
+	records, err := n.App.FindRecordsByFilter("notes", "phrase_hash = {:phrase_hash} && deleted_at != ''", "", 1, 0, dbx.Params{"phrase_hash": n.hashPhrase(phrase)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notes: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	if !DeletedAt(records[0]).Add(grace).After(time.Now()) {
+		return nil, n.deleteNoteRecord(records[0])
+	}
+	return records[0], nil
+}
+
+// PurgeDeletedNotes permanently deletes every note (with its attachments) that
+// has been in the trash for longer than grace
+func (n *NoteService) PurgeDeletedNotes(grace time.Duration) (int, error) {
+	cutoff, err := types.ParseDateTime(time.Now().UTC().Add(-grace))
+	if err != nil {
+		return 0, err
+	}
+
+	records, err := n.App.FindRecordsByFilter("notes", "deleted_at != '' && deleted_at <= {:cutoff}", "", -1, 0, dbx.Params{"cutoff": cutoff.String()})
+	if err != nil {
+		return 0, fmt.Errorf("failed to query deleted notes: %w", err)
+	}
+
+	for _, record := range records {
+		if err := n.deleteNoteRecord(record); err != nil {
+			return 0, err
+		}
+	}
+	return len(records), nil
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"encoding/base64"
+	"log"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/ktappdev/secretnotes-go-backend/cryptoutil"
+)
+
+// upgradedNoteFields are the encrypted fields of a note record
+var upgradedNoteFields = []string{"message", "title", "tags"}
+
+// upgradeEncryption re-encrypts the note record's encrypted fields that were
+// written in an older envelope format, without being bound to the record, or
+// with other KDF settings, so stored notes move to the current settings as
+// they are read rather than in one big migration. Fields that don't decrypt are left alone. Like the content type
+// upgrade it writes straight to the database, so the note's updated time
+// stays as it is, and only if the fields haven't changed since they were
+// read; a failed upgrade is retried on the next read.
+func (n *NoteService) upgradeEncryption(record *core.Record, phrase string) {
+	upgraded := dbx.Params{}
+	unchanged := dbx.HashExp{"id": record.Id}
+	for _, field := range upgradedNoteFields {
+		stored := record.GetString(field)
+		binding := recordBinding(record, field)
+		encrypted, err := base64.StdEncoding.DecodeString(stored)
+		if stored == "" || err != nil || !n.Encryption.Outdated(encrypted, binding) {
+			continue
+		}
+		plain, err := n.Encryption.DecryptBound(encrypted, phrase, binding)
+		if err != nil {
+			continue
+		}
+		sealed, err := n.Encryption.EncryptBound(plain, phrase, binding)
+		cryptoutil.Wipe(plain)
+		if err != nil {
+			log.Printf("Warning: failed to re-encrypt note %s: %v", field, err)
+			return
+		}
+		upgraded[field] = base64.StdEncoding.EncodeToString(sealed)
+		unchanged[field] = stored
+	}
+	if len(upgraded) == 0 {
+		return
+	}
+
+	res, err := n.App.DB().Update("notes", upgraded, unchanged).Execute()
+	if err != nil {
+		log.Printf("Warning: failed to upgrade note encryption: %v", err)
+		return
+	}
+	if rows, _ := res.RowsAffected(); rows > 0 {
+		for field, value := range upgraded {
+			record.Set(field, value)
+		}
+	}
+}
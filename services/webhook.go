@@ -0,0 +1,350 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/ktappdev/secretnotes-go-backend/config"
+)
+
+// Webhook event kinds
+const (
+	WebhookEventNoteUpdated     = "note.updated"
+	WebhookEventAttachmentAdded = "attachment.added"
+)
+
+// ErrWebhookNotFound is returned when the phrase has no webhook
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// errPrivateAddress is returned when a webhook would reach a private address
+var errPrivateAddress = errors.New("webhook target resolves to a private address")
+
+// Webhook describes a note's outgoing webhook. Secret is only filled in when
+// the webhook is registered; it can't be read back afterwards.
+type Webhook struct {
+	URL      string     `json:"url"`
+	Secret   string     `json:"secret,omitempty"`
+	LastSent *time.Time `json:"lastSent"` // nil until the first ping
+}
+
+// WebhookService sends signed, content-free pings to a URL registered for a
+// note when it changes. URLs and secrets are encrypted with the server-held
+// notification key, like digest addresses, since pings go out without the
+// passphrase.
+type WebhookService struct {
+	App        *pocketbase.PocketBase
+	Encryption *Service
+	Key        string
+	Config     config.WebhookConfig
+
+	client *http.Client
+
+	mu   sync.Mutex
+	last map[string]time.Time // phrase hash + event -> last ping, for MinInterval
+}
+
+// NewWebhookService creates a new webhook service
+func NewWebhookService(app *pocketbase.PocketBase, encryption *Service, key string, cfg config.WebhookConfig) *WebhookService {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivate {
+		// checked at connect time so DNS can't be used to point a hook inside
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+				return errPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	return &WebhookService{
+		App:        app,
+		Encryption: encryption,
+		Key:        key,
+		Config:     cfg,
+		client: &http.Client{
+			Transport: &http.Transport{DialContext: dialer.DialContext, Proxy: nil},
+			Timeout:   cfg.Timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		last: make(map[string]time.Time),
+	}
+}
+
+// Register creates or replaces the phrase's webhook with a fresh signing
+// secret. Changes made by requests carrying clientID in X-Client-Id don't
+// ping it, so a device can automate around edits made elsewhere.
+func (w *WebhookService) Register(phrase, rawURL, clientID string) (*Webhook, error) {
+	if err := w.validateURL(rawURL); err != nil {
+		return nil, err
+	}
+
+	phraseHash := w.hashPhrase(phrase)
+	notes, err := w.App.CountRecords("notes", dbx.HashExp{"phrase_hash": phraseHash})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notes: %w", err)
+	}
+	if notes == 0 {
+		return nil, ErrNoteNotFound
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	secretHex := hex.EncodeToString(secret)
+
+	record, err := w.findWebhook(w.App, phraseHash)
+	if err != nil {
+		collection, err := w.App.FindCachedCollectionByNameOrId("note_webhooks")
+		if err != nil {
+			return nil, fmt.Errorf("webhooks collection not found: %w", err)
+		}
+		record = core.NewRecord(collection)
+		record.Set("id:autogenerate", "")
+		record.Set("phrase_hash", phraseHash)
+	}
+
+	// bound to the record, as every webhook shares the server key
+	encryptedURL, err := w.Encryption.EncryptBound([]byte(rawURL), w.Key, recordBinding(record, "url"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt webhook URL: %w", err)
+	}
+	encryptedSecret, err := w.Encryption.EncryptBound([]byte(secretHex), w.Key, recordBinding(record, "secret"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt webhook secret: %w", err)
+	}
+	record.Set("url", base64.StdEncoding.EncodeToString(encryptedURL))
+	record.Set("secret", base64.StdEncoding.EncodeToString(encryptedSecret))
+	record.Set("client_id", hashClientID(clientID))
+	record.Set("last_sent", "")
+
+	if err := w.App.Save(record); err != nil {
+		return nil, fmt.Errorf("failed to save webhook: %w", err)
+	}
+	return &Webhook{URL: rawURL, Secret: secretHex}, nil
+}
+
+// GetWebhook returns the phrase's webhook, without its secret
+func (w *WebhookService) GetWebhook(phrase string) (*Webhook, error) {
+	record, err := w.findWebhook(w.App, w.hashPhrase(phrase))
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+	target, err := w.decrypt(record, "url")
+	if err != nil {
+		return nil, err
+	}
+	return &Webhook{URL: target, LastSent: optionalTime(record.GetDateTime("last_sent"))}, nil
+}
+
+// Unregister removes the phrase's webhook
+func (w *WebhookService) Unregister(phrase string) error {
+	record, err := w.findWebhook(w.App, w.hashPhrase(phrase))
+	if err != nil {
+		return ErrWebhookNotFound
+	}
+	if err := w.App.Delete(record); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	return nil
+}
+
+// Notify pings the phrase's webhook about event in the background, unless the
+// change came from the webhook's own client or the same event was sent less
+// than MinInterval ago. Notes without a webhook are ignored.
+func (w *WebhookService) Notify(phrase, event, clientID string) {
+	phraseHash := w.hashPhrase(phrase)
+	record, err := w.findWebhook(w.App, phraseHash)
+	if err != nil {
+		return
+	}
+	if clientID != "" && record.GetString("client_id") == hashClientID(clientID) {
+		return
+	}
+
+	now := time.Now()
+	w.mu.Lock()
+	key := phraseHash + "/" + event
+	if now.Sub(w.last[key]) < w.Config.MinInterval {
+		w.mu.Unlock()
+		return
+	}
+	for k, t := range w.last {
+		if now.Sub(t) >= w.Config.MinInterval {
+			delete(w.last, k)
+		}
+	}
+	w.last[key] = now
+	w.mu.Unlock()
+
+	go func() {
+		if err := w.deliver(record, event, now); err != nil {
+			log.Printf("Warning: webhook delivery failed: %v", err)
+		}
+	}()
+}
+
+// deliver POSTs {"event", "timestamp"} to the webhook, signed with
+// X-SecretNotes-Signature: sha256=HMAC(secret, timestamp + "." + body)
+func (w *WebhookService) deliver(record *core.Record, event string, at time.Time) error {
+	target, err := w.decrypt(record, "url")
+	if err != nil {
+		return err
+	}
+	secret, err := w.decrypt(record, "secret")
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"event":     event,
+		"timestamp": at.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.Config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SecretNotes-Webhook/1.0")
+	req.Header.Set("X-SecretNotes-Event", event)
+	req.Header.Set("X-SecretNotes-Timestamp", timestamp)
+	req.Header.Set("X-SecretNotes-Signature", "sha256="+SignWebhook(secret, timestamp, body))
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("status %d", res.StatusCode)
+	}
+
+	// a plain UPDATE so a registration saved meanwhile isn't overwritten
+	_, err = w.App.DB().NewQuery("UPDATE note_webhooks SET last_sent = {:now} WHERE id = {:id}").
+		Bind(dbx.Params{"now": types.NowDateTime().String(), "id": record.Id}).
+		Execute()
+	if err != nil {
+		log.Printf("Warning: failed to update webhook: %v", err)
+	}
+	return nil
+}
+
+// SignWebhook returns the hex HMAC-SHA256 a receiver should compare against
+// X-SecretNotes-Signature
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// MovePhrase re-points a webhook after its note moved to a new phrase hash (rekey)
+func (w *WebhookService) MovePhrase(app core.App, oldHash, newHash string) {
+	record, err := w.findWebhook(app, oldHash)
+	if err != nil {
+		return
+	}
+	record.Set("phrase_hash", newHash)
+	if err := app.Save(record); err != nil {
+		log.Printf("Warning: failed to move webhook: %v", err)
+	}
+}
+
+// DeleteForPhrase removes the webhook of a deleted note
+func (w *WebhookService) DeleteForPhrase(app core.App, phraseHash string) {
+	record, err := w.findWebhook(app, phraseHash)
+	if err != nil {
+		return
+	}
+	if err := app.Delete(record); err != nil {
+		log.Printf("Warning: failed to delete webhook: %v", err)
+	}
+}
+
+// validateURL accepts absolute https URLs, and http ones when private
+// targets are allowed
+func (w *WebhookService) validateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || u.User != nil {
+		return fmt.Errorf("invalid webhook URL")
+	}
+	if u.Scheme != "https" && !(w.Config.AllowPrivate && u.Scheme == "http") {
+		return fmt.Errorf("webhook URL must use https")
+	}
+	if len(rawURL) > 2048 {
+		return fmt.Errorf("webhook URL is too long")
+	}
+	return nil
+}
+
+// hashPhrase returns the hash the phrase's records are stored and looked up
+// under (see Service.PhraseHash)
+func (w *WebhookService) hashPhrase(phrase string) string {
+	return w.Encryption.PhraseHash(phrase)
+}
+
+func (w *WebhookService) findWebhook(app core.App, phraseHash string) (*core.Record, error) {
+	return app.FindFirstRecordByData("note_webhooks", "phrase_hash", phraseHash)
+}
+
+func (w *WebhookService) decrypt(record *core.Record, field string) (string, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(record.GetString(field))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode webhook %s: %w", field, err)
+	}
+	plain, err := w.Encryption.DecryptBound(encrypted, w.Key, recordBinding(record, field))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt webhook %s: %w", field, err)
+	}
+	return string(plain), nil
+}
+
+// hashClientID hides the client id a webhook ignores; empty stays empty
+func hashClientID(clientID string) string {
+	if clientID == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte("client:" + clientID))
+	return hex.EncodeToString(hash[:])
+}
+
+// isPrivateIP reports whether ip is loopback, private, link-local or otherwise
+// not a public unicast address
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"net"
+	"testing"
+
+	"github.com/ktappdev/secretnotes-go-backend/config"
+)
+
+func TestSignWebhook(t *testing.T) {
+	// echo -n '1700000000.{"event":"note.updated"}' | openssl dgst -sha256 -hmac secret
+	got := SignWebhook("secret", "1700000000", []byte(`{"event":"note.updated"}`))
+	if want := "1add5ba9e95da6775a6d81578b766e60493587c4979394b1530d75ab3dc383fe"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if other := SignWebhook("secret", "1700000001", []byte(`{"event":"note.updated"}`)); other == got {
+		t.Fatalf("signature does not cover the timestamp")
+	}
+}
+
+func TestWebhookValidateURL(t *testing.T) {
+	public := &WebhookService{Config: config.WebhookConfig{}}
+	private := &WebhookService{Config: config.WebhookConfig{AllowPrivate: true}}
+
+	cases := []struct {
+		url             string
+		public, private bool
+	}{
+		{"https://hooks.example.com/notes", true, true},
+		{"http://hooks.example.com/notes", false, true},
+		{"https://user:pw@hooks.example.com/", false, false},
+		{"ftp://hooks.example.com/", false, false},
+		{"/relative", false, false},
+	}
+	for _, c := range cases {
+		if err := public.validateURL(c.url); (err == nil) != c.public {
+			t.Errorf("%s without private targets: got error %v", c.url, err)
+		}
+		if err := private.validateURL(c.url); (err == nil) != c.private {
+			t.Errorf("%s with private targets: got error %v", c.url, err)
+		}
+	}
+}
+
+func TestIsPrivateIP(t *testing.T) {
+	cases := map[string]bool{
+		"127.0.0.1":       true,
+		"10.1.2.3":        true,
+		"192.168.0.10":    true,
+		"169.254.169.254": true,
+		"::1":             true,
+		"fd00::1":         true,
+		"0.0.0.0":         true,
+		"93.184.216.34":   false,
+		"2606:4700::1111": false,
+	}
+	for ip, want := range cases {
+		if got := isPrivateIP(net.ParseIP(ip)); got != want {
+			t.Errorf("isPrivateIP(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
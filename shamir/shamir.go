@@ -0,0 +1,139 @@
+// Package shamir implements Shamir's secret sharing over GF(2^8): a secret is
+// split into n shares of which any k reconstruct it, while fewer than k reveal
+// nothing about it. Each share is the secret's length plus one byte, its x
+// coordinate, which comes last.
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/ktappdev/secretnotes-go-backend/cryptoutil"
+)
+
+// MaxShares is the most shares a secret can be split into, one per nonzero
+// element of the field
+const MaxShares = 255
+
+var (
+	// ErrTooFewShares is returned by Combine when given fewer than two shares
+	ErrTooFewShares = errors.New("shamir: at least two shares are required")
+
+	// ErrInvalidShares is returned by Combine for shares that can't belong
+	// together: different lengths or repeated x coordinates
+	ErrInvalidShares = errors.New("shamir: shares are inconsistent")
+)
+
+// Split splits secret into n shares, any k of which recover it. 2 <= k <= n <=
+// MaxShares. Share i has x coordinate i+1.
+func Split(secret []byte, n, k int) ([][]byte, error) {
+	if k < 2 || k > n || n > MaxShares {
+		return nil, fmt.Errorf("shamir: need 2 <= k <= n <= %d, got k=%d n=%d", MaxShares, k, n)
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("shamir: empty secret")
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+
+	// one polynomial of degree k-1 per byte, with the byte as its constant term
+	coeffs := make([]byte, k)
+	defer cryptoutil.Wipe(coeffs)
+	for b, s := range secret {
+		coeffs[0] = s
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, fmt.Errorf("shamir: failed to draw coefficients: %w", err)
+		}
+		for i := range shares {
+			shares[i][b] = evaluate(coeffs, byte(i+1))
+		}
+	}
+	return shares, nil
+}
+
+// Combine recovers the secret from k or more shares of it. Given shares of
+// different secrets, or fewer than k, it returns garbage rather than an
+// error; callers that need to know should check the result.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, ErrTooFewShares
+	}
+	size := len(shares[0])
+	if size < 2 {
+		return nil, ErrInvalidShares
+	}
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool, len(shares))
+	for i, share := range shares {
+		if len(share) != size {
+			return nil, ErrInvalidShares
+		}
+		x := share[size-1]
+		if x == 0 || seen[x] {
+			return nil, ErrInvalidShares
+		}
+		seen[x] = true
+		xs[i] = x
+	}
+
+	// Lagrange interpolation at x = 0; in GF(2^8) subtraction is XOR
+	weights := make([]byte, len(shares))
+	for i, xi := range xs {
+		num, den := byte(1), byte(1)
+		for j, xj := range xs {
+			if i != j {
+				num = mul(num, xj)
+				den = mul(den, xi^xj)
+			}
+		}
+		weights[i] = mul(num, inverse(den))
+	}
+
+	secret := make([]byte, size-1)
+	for b := range secret {
+		var v byte
+		for i, share := range shares {
+			v ^= mul(share[b], weights[i])
+		}
+		secret[b] = v
+	}
+	return secret, nil
+}
+
+// evaluate returns the polynomial with the given coefficients, constant term
+// first, at x
+func evaluate(coeffs []byte, x byte) byte {
+	var v byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		v = mul(v, x) ^ coeffs[i]
+	}
+	return v
+}
+
+// mul multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x + 1, the AES field,
+// without branching on its operands
+func mul(a, b byte) byte {
+	var p byte
+	for range 8 {
+		p ^= a & -(b & 1)
+		carry := -(a >> 7)
+		a = a<<1 ^ 0x1b&carry
+		b >>= 1
+	}
+	return p
+}
+
+// inverse returns a^254, the multiplicative inverse of a nonzero a
+func inverse(a byte) byte {
+	b := a
+	for range 6 {
+		a = mul(a, a)
+		b = mul(b, a)
+	}
+	return mul(b, b)
+}
@@ -0,0 +1,89 @@
+package shamir
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestField(t *testing.T) {
+	// 0x53 * 0xca = 1 in the AES field (FIPS 197, section 4.2)
+	if got := mul(0x53, 0xca); got != 1 {
+		t.Fatalf("0x53 * 0xca = %#x, want 1", got)
+	}
+	if got := mul(0x57, 0x83); got != 0xc1 {
+		t.Fatalf("0x57 * 0x83 = %#x, want 0xc1", got)
+	}
+	for a := 1; a < 256; a++ {
+		if got := mul(byte(a), inverse(byte(a))); got != 1 {
+			t.Fatalf("%#x * inverse = %#x", a, got)
+		}
+	}
+}
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("correct horse battery staple")
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != 5 || len(shares[0]) != len(secret)+1 {
+		t.Fatalf("unexpected shares: %d of %d bytes", len(shares), len(shares[0]))
+	}
+
+	// every subset of three or more recovers the secret
+	for mask := 0; mask < 1<<5; mask++ {
+		var subset [][]byte
+		for i := range shares {
+			if mask&(1<<i) != 0 {
+				subset = append(subset, shares[i])
+			}
+		}
+		if len(subset) < 3 {
+			continue
+		}
+		got, err := Combine(subset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, secret) {
+			t.Fatalf("subset %05b recovered %q", mask, got)
+		}
+	}
+
+	// two shares of a 3-of-5 split don't
+	got, err := Combine(shares[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(got, secret) {
+		t.Fatal("expected two shares not to recover the secret")
+	}
+}
+
+func TestSplitRandomized(t *testing.T) {
+	secret := []byte{0, 0, 0, 0}
+	a, _ := Split(secret, 2, 2)
+	b, _ := Split(secret, 2, 2)
+	if bytes.Equal(a[0], b[0]) && bytes.Equal(a[1], b[1]) {
+		t.Fatal("expected fresh coefficients for every split")
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	for _, c := range []struct{ n, k int }{{3, 1}, {2, 3}, {256, 2}} {
+		if _, err := Split([]byte("x"), c.n, c.k); err == nil {
+			t.Fatalf("expected n=%d k=%d to be refused", c.n, c.k)
+		}
+	}
+	shares, _ := Split([]byte("secret"), 3, 2)
+	if _, err := Combine(shares[:1]); !errors.Is(err, ErrTooFewShares) {
+		t.Fatalf("expected ErrTooFewShares, got %v", err)
+	}
+	if _, err := Combine([][]byte{shares[0], shares[0]}); !errors.Is(err, ErrInvalidShares) {
+		t.Fatalf("expected a repeated share to be refused, got %v", err)
+	}
+	if _, err := Combine([][]byte{shares[0], shares[1][1:]}); !errors.Is(err, ErrInvalidShares) {
+		t.Fatalf("expected shares of different lengths to be refused, got %v", err)
+	}
+}